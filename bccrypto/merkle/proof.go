@@ -0,0 +1,145 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Proof: the merkle proof of a leaf, which is the path from the leaf to the root
+// note: the proof matches the tree generated by HashFromByteSlices
+type Proof struct {
+	Total    int64    // the total number of leaves
+	Index    int64    // the index of the leaf
+	LeafHash []byte   // the hash of the leaf
+	Aunts    [][]byte // the hashes of the sibling nodes from the leaf to the root
+}
+
+// ProofsFromByteSlices: compute a merkle tree and the proof of each leaf
+// params:
+// -input: all leaf message
+// return root hash of merkle tree and the proofs, the i-th proof corresponds to the i-th leaf
+func ProofsFromByteSlices(input [][]byte) ([]byte, []*Proof) {
+	trails, rootSPN := trailsFromByteSlices(input)
+	rootHash := rootSPN.Hash
+	proofs := make([]*Proof, len(input))
+	for i, trail := range trails {
+		proofs[i] = &Proof{
+			Total:    int64(len(input)),
+			Index:    int64(i),
+			LeafHash: trail.Hash,
+			Aunts:    trail.FlattenAunts(),
+		}
+	}
+	return rootHash, proofs
+}
+
+// Verify: check that the leaf is in the tree with the root hash
+// params:
+// -rootHash: the root hash of merkle tree
+// -leaf: 	  the leaf message
+// return nil if the proof is valid, or the error
+func (p *Proof) Verify(rootHash []byte, leaf []byte) error {
+	if p.Total < 0 {
+		return errors.New("proof total must be positive")
+	}
+	if p.Index < 0 || p.Index >= p.Total {
+		return errors.New("proof index out of range")
+	}
+	if !bytes.Equal(p.LeafHash, leafHash(leaf)) {
+		return fmt.Errorf("invalid leaf hash: wanted %X got %X", leafHash(leaf), p.LeafHash)
+	}
+	computedHash := p.ComputeRootHash()
+	if !bytes.Equal(computedHash, rootHash) {
+		return fmt.Errorf("invalid root hash: wanted %X got %X", rootHash, computedHash)
+	}
+	return nil
+}
+
+// ComputeRootHash: compute the root hash by the leaf hash and the aunts
+func (p *Proof) ComputeRootHash() []byte {
+	return computeHashFromAunts(p.Index, p.Total, p.LeafHash, p.Aunts)
+}
+
+// computeHashFromAunts: compute the hash of the subtree recursively which the leaf is in
+// params:
+// -index: 	   the index of the leaf in the subtree
+// -total: 	   the number of leaves in the subtree
+// -leafHash:  the hash of the leaf
+// -innerHashes: the aunts of the leaf in the subtree
+// return the hash of the subtree, nil if the proof is malformed
+func computeHashFromAunts(index, total int64, leafHash []byte, innerHashes [][]byte) []byte {
+	if index >= total || index < 0 || total <= 0 {
+		return nil
+	}
+	switch total {
+	case 1:
+		if len(innerHashes) != 0 {
+			return nil
+		}
+		return leafHash
+	default:
+		if len(innerHashes) == 0 {
+			return nil
+		}
+		numLeft := getSplitPoint(total)
+		if index < numLeft {
+			leftHash := computeHashFromAunts(index, numLeft, leafHash, innerHashes[:len(innerHashes)-1])
+			if leftHash == nil {
+				return nil
+			}
+			return innerHash(leftHash, innerHashes[len(innerHashes)-1])
+		}
+		rightHash := computeHashFromAunts(index-numLeft, total-numLeft, leafHash, innerHashes[:len(innerHashes)-1])
+		if rightHash == nil {
+			return nil
+		}
+		return innerHash(innerHashes[len(innerHashes)-1], rightHash)
+	}
+}
+
+// proofNode: the node in the tree for generating proofs, it knows its parent and siblings
+type proofNode struct {
+	Hash   []byte
+	Parent *proofNode
+	Left   *proofNode // left sibling, only one of Left and Right is set
+	Right  *proofNode // right sibling, only one of Left and Right is set
+}
+
+// FlattenAunts: get the hashes of siblings from the leaf to the root
+func (spn *proofNode) FlattenAunts() [][]byte {
+	innerHashes := [][]byte{}
+	for spn != nil {
+		switch {
+		case spn.Left != nil:
+			innerHashes = append(innerHashes, spn.Left.Hash)
+		case spn.Right != nil:
+			innerHashes = append(innerHashes, spn.Right.Hash)
+		}
+		spn = spn.Parent
+	}
+	return innerHashes
+}
+
+// trailsFromByteSlices: build the tree in the same way as HashFromByteSlices
+// return the leaf nodes and the root node
+func trailsFromByteSlices(input [][]byte) (trails []*proofNode, root *proofNode) {
+	switch len(input) {
+	case 0:
+		return []*proofNode{}, &proofNode{EmptyHash(), nil, nil, nil}
+	case 1:
+		trail := &proofNode{leafHash(input[0]), nil, nil, nil}
+		return []*proofNode{trail}, trail
+	default:
+		k := getSplitPoint(int64(len(input)))
+		lefts, leftRoot := trailsFromByteSlices(input[:k])
+		rights, rightRoot := trailsFromByteSlices(input[k:])
+		rootHash := innerHash(leftRoot.Hash, rightRoot.Hash)
+		root := &proofNode{rootHash, nil, nil, nil}
+		leftRoot.Parent = root
+		leftRoot.Right = rightRoot
+		rightRoot.Parent = root
+		rightRoot.Left = leftRoot
+		return append(lefts, rights...), root
+	}
+}
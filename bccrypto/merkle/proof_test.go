@@ -0,0 +1,35 @@
+package merkle_test
+
+import (
+	"bytes"
+	"common"
+	"fmt"
+	"merkle"
+	"testing"
+)
+
+// TestProof: test that the proofs of all leaves can be verified by the root of HashFromByteSlices
+func TestProof(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 7, 128, 129} {
+		leaves := common.GenerateSecureRandom2ByteSlice(count, 16)
+		root, proofs := merkle.ProofsFromByteSlices(leaves)
+		if !bytes.Equal(root, merkle.HashFromByteSlices(leaves)) {
+			t.Fatal("root hash is different from HashFromByteSlices", count)
+		}
+
+		for i, proof := range proofs {
+			if err := proof.Verify(root, leaves[i]); err != nil {
+				t.Fatal(count, i, err)
+			}
+		}
+
+		// a proof can not verify other leaf
+		if count > 1 {
+			err := proofs[0].Verify(root, leaves[1])
+			fmt.Println(count, err)
+			if err == nil {
+				t.Fatal("proof verified a wrong leaf", count)
+			}
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package tss
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/share"
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	vss "go.dedis.ch/kyber/v3/share/vss/pedersen"
+)
+
+// DKGMsgType: the type of the message of the distributed key generation
+type DKGMsgType uint8
+
+const (
+	DKG_DEAL          DKGMsgType = iota // the encrypted share dealt to a participant of the new nodes
+	DKG_RESPONSE                        // the approval or complaint of a deal, which is broadcast to all participants
+	DKG_JUSTIFICATION                   // the share revealed by the dealer against a complaint, which is broadcast to all participants
+)
+
+// DKGMsg: the message of the distributed key generation
+type DKGMsg struct {
+	Type DKGMsgType
+	To   int    // the index of the new node the deal is sent to, -1 if the message is broadcast
+	Data []byte // the encoded deal, response or justification
+}
+
+// DKGKey: the long-term key of a participant of the distributed key generation, the deals to it are encrypted
+// by its public key and the messages of it are signed by its private key
+type DKGKey struct {
+	Private kyber.Scalar
+	Public  kyber.Point
+}
+
+// DKG: a run of the distributed key generation, or the resharing of the threshold key, among the nodes,
+// no participant learns the shared secret, see NewDKG and NewReshare
+// note: it isn't safe for concurrent use
+type DKG struct {
+	suite     *bn256.Suite               // the suite of the group G2, where the public keys of the threshold signers are
+	gen       *dkg.DistKeyGenerator      // the generator of the pedersen dkg
+	self      int                        // the index of this node in the new nodes, -1 if it isn't one of them
+	nodeNum   int                        // the number of new nodes
+	threshold int                        // the threshold of the new nodes
+	dealerNum int                        // the number of dealers, which are the new nodes in a fresh generation or the old nodes in the resharing
+	oldThresh int                        // the threshold of the old nodes in the resharing, 0 in a fresh generation
+	early     map[uint32][]*dkg.Response // the responses recieved before the deal of their dealer
+}
+
+// NewDKGKey: generate a new long-term key of the distributed key generation
+func NewDKGKey() *DKGKey {
+	suite := bn256.NewSuiteG2()
+	private := suite.Scalar().Pick(suite.RandomStream())
+	return &DKGKey{Private: private, Public: suite.Point().Mul(private, nil)}
+}
+
+// DeriveDKGKey: derive the long-term key of the distributed key generation from a seed, such as the private key of the node,
+// so the node which loads its key from file has the same key on every start
+// params:
+// - seed: the secret seed
+// return the derived key
+func DeriveDKGKey(seed []byte) *DKGKey {
+	suite := bn256.NewSuiteG2()
+	h := sha256.Sum256(append([]byte("dcschain dkg key"), seed...))
+	private := suite.Scalar().SetBytes(h[:])
+	return &DKGKey{Private: private, Public: suite.Point().Mul(private, nil)}
+}
+
+// PublicBytes: get the byte slice of the public key, which is given to the other nodes
+func (k *DKGKey) PublicBytes() []byte {
+	pk, err := k.Public.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return pk
+}
+
+// NewDKG: start a fresh distributed key generation among the nodes, every node deals a random secret
+// and the new group key is the sum of the qualified secrets
+// params:
+// - key:       the long-term key of this node
+// - nodes:     the public keys of the long-term keys of the nodes, the index of the share of a node is its index in nodes
+// - threshold: the min number of nodes to sign a same message
+// return the run and error
+func NewDKG(key *DKGKey, nodes [][]byte, threshold int) (*DKG, error) {
+	suite := bn256.NewSuiteG2()
+	pubs, err := decodePoints(suite, nodes)
+	if err != nil {
+		return nil, err
+	}
+	gen, err := dkg.NewDistKeyHandler(&dkg.Config{
+		Suite:     suite,
+		Longterm:  key.Private,
+		NewNodes:  pubs,
+		Threshold: threshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newRun(suite, gen, key, pubs, threshold, len(pubs), 0), nil
+}
+
+// NewReshare: start the resharing of the threshold key from the old nodes to the new nodes, every old node deals its share,
+// and the new nodes get the shares of the same group key with the new threshold
+// note: the old nodes and the new nodes may overlap, and at least the old threshold of deals must be qualified
+// params:
+// - key:       the long-term key of this node
+// - signer:    the threshold signer of this node if it is one of the old nodes, otherwise nil
+// - commits:   the commitments of the shared public polynomial of the old nodes, see Signer.Commits
+// - olds:      the public keys of the long-term keys of the old nodes in order of the index of their shares
+// - nodes:     the public keys of the long-term keys of the new nodes, the index of the new share of a node is its index in nodes
+// - threshold: the min number of new nodes to sign a same message
+// return the run and error
+func NewReshare(key *DKGKey, signer *Signer, commits [][]byte, olds [][]byte, nodes [][]byte, threshold int) (*DKG, error) {
+	suite := bn256.NewSuiteG2()
+	oldPubs, err := decodePoints(suite, olds)
+	if err != nil {
+		return nil, err
+	}
+	newPubs, err := decodePoints(suite, nodes)
+	if err != nil {
+		return nil, err
+	}
+	coeffs, err := decodePoints(suite, commits)
+	if err != nil {
+		return nil, err
+	}
+	if len(coeffs) == 0 {
+		return nil, errors.New("tss: resharing needs the public polynomial")
+	}
+
+	c := &dkg.Config{
+		Suite:        suite,
+		Longterm:     key.Private,
+		OldNodes:     oldPubs,
+		NewNodes:     newPubs,
+		Threshold:    threshold,
+		OldThreshold: len(coeffs),
+		PublicCoeffs: coeffs,
+	}
+	if signer != nil {
+		c.Share = &dkg.DistKeyShare{Commits: coeffs, Share: signer.PrivateKey}
+	}
+	gen, err := dkg.NewDistKeyHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return newRun(suite, gen, key, newPubs, threshold, len(oldPubs), len(coeffs)), nil
+}
+
+// newRun: create the run of the generator among the new nodes
+func newRun(suite *bn256.Suite, gen *dkg.DistKeyGenerator, key *DKGKey, nodes []kyber.Point, threshold int, dealerNum int, oldThresh int) *DKG {
+	self := -1
+	for i, pub := range nodes {
+		if pub.Equal(key.Public) {
+			self = i
+		}
+	}
+	return &DKG{
+		suite:     suite,
+		gen:       gen,
+		self:      self,
+		nodeNum:   len(nodes),
+		threshold: threshold,
+		dealerNum: dealerNum,
+		oldThresh: oldThresh,
+		early:     make(map[uint32][]*dkg.Response),
+	}
+}
+
+// Start: deal the shares of this node to the new nodes, the deal to this node itself is processed at once
+// return the messages to send, and error
+func (d *DKG) Start() ([]DKGMsg, error) {
+	deals, err := d.gen.Deals()
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]DKGMsg, 0, len(deals))
+	for i, deal := range deals {
+		data, err := json.Marshal(deal)
+		if err != nil {
+			return nil, err
+		}
+
+		// the node in both the old nodes and the new nodes gets its own deal in the resharing
+		if i == d.self {
+			resps, err := d.processDeal(deal)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, resps...)
+			continue
+		}
+		msgs = append(msgs, DKGMsg{Type: DKG_DEAL, To: i, Data: data})
+	}
+	return msgs, nil
+}
+
+// Process: process the message recieved from another participant
+// params:
+// - msg: the recieved message
+// return the messages to broadcast, and error if the message is invalid
+func (d *DKG) Process(msg DKGMsg) ([]DKGMsg, error) {
+	switch msg.Type {
+	case DKG_DEAL:
+		deal := &dkg.Deal{}
+		if err := json.Unmarshal(msg.Data, deal); err != nil {
+			return nil, err
+		}
+		if deal.Deal == nil {
+			return nil, errors.New("tss: empty deal")
+		}
+		return d.processDeal(deal)
+	case DKG_RESPONSE:
+		resp := &dkg.Response{}
+		if err := json.Unmarshal(msg.Data, resp); err != nil {
+			return nil, err
+		}
+		if resp.Response == nil {
+			return nil, errors.New("tss: empty response")
+		}
+		return d.processResponse(resp)
+	case DKG_JUSTIFICATION:
+		j, err := decodeJustification(d.suite, msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return nil, d.gen.ProcessJustification(j)
+	}
+	return nil, errors.New("tss: unknown dkg message")
+}
+
+// processDeal: verify the deal and broadcast the response, then process the responses of the deal recieved before it
+func (d *DKG) processDeal(deal *dkg.Deal) ([]DKGMsg, error) {
+	resp, err := d.gen.ProcessDeal(deal)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []DKGMsg{{Type: DKG_RESPONSE, To: -1, Data: data}}
+
+	early := d.early[deal.Index]
+	delete(d.early, deal.Index)
+	for _, r := range early {
+		if more, err := d.processResponse(r); err == nil {
+			msgs = append(msgs, more...)
+		}
+	}
+	return msgs, nil
+}
+
+// processResponse: process the response of a deal, the response recieved before the deal is kept,
+// and the dealer justifies its deal against a complaint
+func (d *DKG) processResponse(resp *dkg.Response) ([]DKGMsg, error) {
+	j, err := d.gen.ProcessResponse(resp)
+	if err == vss.ErrNoDealBeforeResponse {
+		if len(d.early[resp.Index]) < d.nodeNum {
+			d.early[resp.Index] = append(d.early[resp.Index], resp)
+		}
+		return nil, nil
+	}
+	if err != nil || j == nil {
+		return nil, err
+	}
+	data, err := encodeJustification(j)
+	if err != nil {
+		return nil, err
+	}
+	return []DKGMsg{{Type: DKG_JUSTIFICATION, To: -1, Data: data}}, nil
+}
+
+// Certified: check whether all deals are certified by the responses of all new nodes, so the run ends before the timeout
+func (d *DKG) Certified() bool {
+	return d.gen.Certified()
+}
+
+// SetTimeout: end the run at the timeout, the deals are certified by the threshold of responses,
+// and the nodes which haven't responded are not qualified
+func (d *DKG) SetTimeout() {
+	d.gen.SetTimeout()
+}
+
+// QUAL: get the indexes of the dealers whose deals are certified by this node in order, which may differ from the ones
+// of the other nodes at the timeout, so the nodes agree on the dealers before the signers are generated, see SignerOf
+func (d *DKG) QUAL() []int {
+	qual := d.gen.QUAL()
+	sort.Ints(qual)
+	return qual
+}
+
+// Responses: get the responses recieved by this node for the deals of the dealers, which are sent with the proposal of the dealers,
+// so the nodes which missed some of them certify the deals as well
+// params:
+// - qual: the indexes of the dealers
+// return the response messages
+func (d *DKG) Responses(qual []int) []DKGMsg {
+	verifiers := d.gen.Verifiers()
+	msgs := make([]DKGMsg, 0)
+	for _, i := range qual {
+		v, ok := verifiers[uint32(i)]
+		if !ok {
+			continue
+		}
+		for _, resp := range v.Responses() {
+			data, err := json.Marshal(&dkg.Response{Index: uint32(i), Response: resp})
+			if err != nil {
+				continue
+			}
+			msgs = append(msgs, DKGMsg{Type: DKG_RESPONSE, To: -1, Data: data})
+		}
+	}
+	return msgs
+}
+
+// Qualified: check the signer of this node can be generated from the deals of the dealers, that is, the dealers are in order,
+// there are enough of them, and their deals are certified by this node
+// params:
+// - qual: the indexes of the dealers
+// return error if the signer can't be generated from them
+func (d *DKG) Qualified(qual []int) error {
+	need := d.threshold
+	if d.oldThresh > 0 {
+		need = d.oldThresh
+	}
+	if len(qual) < need {
+		return errors.New("tss: not enough qualified dealers")
+	}
+	verifiers := d.gen.Verifiers()
+	for k, i := range qual {
+		if k > 0 && i <= qual[k-1] {
+			return errors.New("tss: the qualified dealers are not in order")
+		}
+		if v, ok := verifiers[uint32(i)]; !ok || v.Deal() == nil {
+			return fmt.Errorf("tss: the deal of dealer %d isn't certified", i)
+		}
+	}
+	return nil
+}
+
+// Signer: get the threshold signer of this node from the deals certified by itself
+// return the signer, and error if this node isn't one of the new nodes or there aren't enough qualified deals
+func (d *DKG) Signer() (*Signer, error) {
+	return d.SignerOf(d.QUAL())
+}
+
+// SignerOf: get the threshold signer of this node from the deals of the dealers agreed by the nodes, the share is the sum
+// of the shares dealt by the dealers in a fresh generation, or interpolated from them in the resharing
+// params:
+// - qual: the indexes of the dealers in order, whose deals are certified by this node
+// return the signer, and error if this node isn't one of the new nodes or the signer can't be generated from the dealers
+func (d *DKG) SignerOf(qual []int) (*Signer, error) {
+	if err := d.Qualified(qual); err != nil {
+		return nil, err
+	}
+	verifiers := d.gen.Verifiers()
+	var sh kyber.Scalar
+	var commits []kyber.Point
+	if d.oldThresh == 0 {
+		sh = d.suite.Scalar().Zero()
+		var pub *share.PubPoly
+		for _, i := range qual {
+			deal := verifiers[uint32(i)].Deal()
+			sh = sh.Add(sh, deal.SecShare.V)
+			poly := share.NewPubPoly(d.suite, d.suite.Point().Base(), deal.Commitments)
+			if pub == nil {
+				pub = poly
+				continue
+			}
+			var err error
+			if pub, err = pub.Add(poly); err != nil {
+				return nil, err
+			}
+		}
+		_, commits = pub.Info()
+	} else {
+		// the shares dealt by the old nodes are the points of the polynomial of the old threshold, whose secret is the new share,
+		// and the commitments are interpolated coefficient-wise in the same way
+		shares := make([]*share.PriShare, d.dealerNum)
+		coeffs := make([][]kyber.Point, d.dealerNum)
+		for _, i := range qual {
+			deal := verifiers[uint32(i)].Deal()
+			shares[i] = &share.PriShare{I: i, V: deal.SecShare.V}
+			coeffs[i] = deal.Commitments
+		}
+		priPoly, err := share.RecoverPriPoly(d.suite, shares, d.oldThresh, d.dealerNum)
+		if err != nil {
+			return nil, err
+		}
+		sh = priPoly.Secret()
+		commits = make([]kyber.Point, d.threshold)
+		for k := range commits {
+			points := make([]*share.PubShare, d.dealerNum)
+			for i := range coeffs {
+				if coeffs[i] != nil {
+					points[i] = &share.PubShare{I: i, V: coeffs[i][k]}
+				}
+			}
+			if commits[k], err = share.RecoverCommit(d.suite, points, d.oldThresh, d.dealerNum); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	priShare := &share.PriShare{I: d.self, V: sh}
+	if !share.NewPubPoly(d.suite, d.suite.Point().Base(), commits).Check(priShare) {
+		return nil, errors.New("tss: the share doesn't match the public polynomial")
+	}
+	suite := bn256.NewSuite()
+	return &Signer{
+		Suite:      suite,
+		PrivateKey: priShare,
+		PublicKey:  share.NewPubPoly(suite.G2(), suite.G2().Point().Base(), commits),
+		SignNum:    d.nodeNum,
+		Threshold:  d.threshold,
+	}, nil
+}
+
+// decodePoints: decode the byte slices to the points of the group
+func decodePoints(group kyber.Group, data [][]byte) ([]kyber.Point, error) {
+	points := make([]kyber.Point, len(data))
+	for i, b := range data {
+		points[i] = group.Point()
+		if err := points[i].UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// justificationJson: the encoding of the justification, whose deal carries the scalar and the points
+type justificationJson struct {
+	Index       uint32
+	SessionID   []byte
+	Verifier    uint32
+	ShareIndex  int
+	Share       []byte
+	T           uint32
+	Commitments [][]byte
+	Signature   []byte
+}
+
+// encodeJustification: encode the justification of the dealer
+func encodeJustification(j *dkg.Justification) ([]byte, error) {
+	deal := j.Justification.Deal
+	sh, err := deal.SecShare.V.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	jj := justificationJson{
+		Index:      j.Index,
+		SessionID:  j.Justification.SessionID,
+		Verifier:   j.Justification.Index,
+		ShareIndex: deal.SecShare.I,
+		Share:      sh,
+		T:          deal.T,
+		Signature:  j.Justification.Signature,
+	}
+	for _, c := range deal.Commitments {
+		cb, err := c.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		jj.Commitments = append(jj.Commitments, cb)
+	}
+	return json.Marshal(jj)
+}
+
+// decodeJustification: decode the justification of the dealer
+func decodeJustification(suite *bn256.Suite, data []byte) (*dkg.Justification, error) {
+	jj := justificationJson{}
+	if err := json.Unmarshal(data, &jj); err != nil {
+		return nil, err
+	}
+	commits, err := decodePoints(suite, jj.Commitments)
+	if err != nil {
+		return nil, err
+	}
+	v := suite.Scalar()
+	if err := v.UnmarshalBinary(jj.Share); err != nil {
+		return nil, err
+	}
+	return &dkg.Justification{
+		Index: jj.Index,
+		Justification: &vss.Justification{
+			SessionID: jj.SessionID,
+			Index:     jj.Verifier,
+			Deal: &vss.Deal{
+				SessionID:   jj.SessionID,
+				SecShare:    &share.PriShare{I: jj.ShareIndex, V: v},
+				T:           jj.T,
+				Commitments: commits,
+			},
+			Signature: jj.Signature,
+		},
+	}, nil
+}
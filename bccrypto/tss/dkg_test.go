@@ -0,0 +1,272 @@
+package tss_test
+
+import (
+	"bytes"
+	"testing"
+	"tss"
+)
+
+// runDKG: deliver the messages of the runs among the participants until no message is left,
+// the runs of the old nodes which are not new nodes get the responses but no deal
+// params:
+// - runs:  the runs of all participants
+// - index: the index of each participant in the new nodes, -1 for the old nodes only
+// - lost:  whether the message from a participant to another one is lost, nil if no message is lost
+func runDKG(t *testing.T, runs []*tss.DKG, index []int, lost func(from int, to int) bool) {
+	type envelope struct {
+		from int
+		msg  tss.DKGMsg
+	}
+	queue := make([]envelope, 0)
+	for i, run := range runs {
+		msgs, err := run.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range msgs {
+			queue = append(queue, envelope{i, msg})
+		}
+	}
+	for len(queue) > 0 {
+		env := queue[0]
+		queue = queue[1:]
+		for i, run := range runs {
+			if i == env.from || (env.msg.To >= 0 && env.msg.To != index[i]) || (lost != nil && lost(env.from, i)) {
+				continue
+			}
+			msgs, err := run.Process(env.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, msg := range msgs {
+				queue = append(queue, envelope{i, msg})
+			}
+		}
+	}
+}
+
+// checkSigners: check the signers of the new nodes combine a signature verified by the group public key
+func checkSigners(t *testing.T, signers []*tss.Signer, groupKey []byte) {
+	msg := []byte("hello dkg")
+	sigs := make([][]byte, 0, len(signers))
+	for _, s := range signers {
+		sig, err := s.ThresholdSign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, sig)
+	}
+	sig, err := signers[0].CombineSig(msg, sigs[:signers[0].Threshold])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range signers {
+		if !s.ThresholdSignVerify(msg, sig) || !bytes.Equal(s.PublicKeyBytes(), groupKey) {
+			t.Fatal("the signers don't share the group key")
+		}
+	}
+	if !tss.VerifyByPublicKey(groupKey, msg, sig) {
+		t.Fatal("the signature isn't verified by the group key")
+	}
+}
+
+// TestDKG: the nodes generate the threshold signers without a dealer, and reshare them to the nodes after a join and an exit
+func TestDKG(t *testing.T) {
+	keys := make([]*tss.DKGKey, 5)
+	pubs := make([][]byte, 5)
+	for i := range keys {
+		keys[i] = tss.NewDKGKey()
+		pubs[i] = keys[i].PublicBytes()
+	}
+
+	// a fresh dkg among r_0 to r_3
+	runs := make([]*tss.DKG, 4)
+	for i := range runs {
+		run, err := tss.NewDKG(keys[i], pubs[:4], 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs[i] = run
+	}
+	runDKG(t, runs, []int{0, 1, 2, 3}, nil)
+	signers := make([]*tss.Signer, 4)
+	for i, run := range runs {
+		if !run.Certified() {
+			t.Fatal("the dkg isn't certified")
+		}
+		s, err := run.Signer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[i] = s
+	}
+	groupKey := signers[0].PublicKeyBytes()
+	checkSigners(t, signers, groupKey)
+
+	// r_4 joins, the old nodes reshare the same group key to 5 nodes
+	commits := signers[0].Commits()
+	runs = make([]*tss.DKG, 5)
+	for i := range runs {
+		var signer *tss.Signer
+		if i < 4 {
+			signer = signers[i]
+		}
+		run, err := tss.NewReshare(keys[i], signer, commits, pubs[:4], pubs, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs[i] = run
+	}
+	runDKG(t, runs, []int{0, 1, 2, 3, 4}, nil)
+	signers = make([]*tss.Signer, 5)
+	for i, run := range runs {
+		s, err := run.Signer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[i] = s
+	}
+	checkSigners(t, signers, groupKey)
+
+	// r_0 exits, it deals its share but gets no new one, and the old shares can't be combined with the new ones
+	oldSigner := signers[0]
+	commits = signers[0].Commits()
+	runs = make([]*tss.DKG, 5)
+	for i := range runs {
+		run, err := tss.NewReshare(keys[i], signers[i], commits, pubs, pubs[1:], 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs[i] = run
+	}
+	runDKG(t, runs, []int{-1, 0, 1, 2, 3}, nil)
+	if _, err := runs[0].Signer(); err == nil {
+		t.Fatal("the exited node gets a share")
+	}
+	signers = make([]*tss.Signer, 4)
+	for i, run := range runs[1:] {
+		s, err := run.Signer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[i] = s
+	}
+	checkSigners(t, signers, groupKey)
+
+	msg := []byte("hello dkg")
+	sigs := make([][]byte, 0, 3)
+	for _, s := range []*tss.Signer{oldSigner, signers[0], signers[1]} {
+		sig, _ := s.ThresholdSign(msg)
+		sigs = append(sigs, sig)
+	}
+	if sig, err := signers[0].CombineSig(msg, sigs); err == nil && signers[0].ThresholdSignVerify(msg, sig) {
+		t.Fatal("the share of the exited node is still valid")
+	}
+}
+
+// TestDKGTimeout: the dkg ends at the timeout without the responses of a crashed node, and the forged deal is rejected
+func TestDKGTimeout(t *testing.T) {
+	keys := make([]*tss.DKGKey, 4)
+	pubs := make([][]byte, 4)
+	for i := range keys {
+		keys[i] = tss.NewDKGKey()
+		pubs[i] = keys[i].PublicBytes()
+	}
+	runs := make([]*tss.DKG, 4)
+	for i := range runs {
+		run, err := tss.NewDKG(keys[i], pubs, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs[i] = run
+	}
+
+	// r_3 deals to r_0 only and crashes, r_0 broadcasts its response which the others keep without the deal
+	msgs, err := runs[3].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range msgs {
+		if msg.To != 0 {
+			continue
+		}
+		forged := msg
+		forged.Data = bytes.Replace(msg.Data, []byte(`"Index":3`), []byte(`"Index":2`), 1)
+		if _, err := runs[0].Process(forged); err == nil {
+			t.Fatal("the forged deal is accepted")
+		}
+		if _, err := runs[0].Process(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runDKG(t, runs[:3], []int{0, 1, 2}, nil)
+
+	signers := make([]*tss.Signer, 3)
+	for i, run := range runs[:3] {
+		if run.Certified() {
+			t.Fatal("the dkg is certified without the crashed node")
+		}
+		run.SetTimeout()
+		s, err := run.Signer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[i] = s
+	}
+	checkSigners(t, signers, signers[0].PublicKeyBytes())
+}
+
+// TestDKGQual: the deal of r_3 is lost to r_2, so r_2 certifies the other deals only at the timeout while the others certify all of them,
+// and the signers generated from their own deals don't share the group key, but the ones from the agreed dealers do
+func TestDKGQual(t *testing.T) {
+	keys := make([]*tss.DKGKey, 4)
+	pubs := make([][]byte, 4)
+	for i := range keys {
+		keys[i] = tss.NewDKGKey()
+		pubs[i] = keys[i].PublicBytes()
+	}
+	runs := make([]*tss.DKG, 4)
+	for i := range runs {
+		run, err := tss.NewDKG(keys[i], pubs, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs[i] = run
+	}
+	runDKG(t, runs, []int{0, 1, 2, 3}, func(from int, to int) bool {
+		return from == 3 && to == 2
+	})
+	for _, run := range runs {
+		run.SetTimeout()
+	}
+	if qual := runs[2].QUAL(); len(qual) != 3 || runs[2].Qualified([]int{0, 1, 2, 3}) == nil {
+		t.Fatal("r_2 certifies the lost deal", qual)
+	}
+	if qual := runs[0].QUAL(); len(qual) != 4 {
+		t.Fatal("r_0 doesn't certify all deals", qual)
+	}
+	own0, err := runs[0].Signer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	own2, err := runs[2].Signer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(own0.PublicKeyBytes(), own2.PublicKeyBytes()) {
+		t.Fatal("the signers of different dealers share the group key")
+	}
+
+	signers := make([]*tss.Signer, 4)
+	for i, run := range runs {
+		s, err := run.SignerOf(runs[2].QUAL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[i] = s
+	}
+	checkSigners(t, signers, signers[0].PublicKeyBytes())
+	if _, err := runs[0].SignerOf([]int{1, 0, 2}); err == nil {
+		t.Fatal("the dealers out of order are accepted")
+	}
+}
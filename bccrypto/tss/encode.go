@@ -5,6 +5,7 @@ type SignerJson struct {
 	V         []byte
 	SignNum   int
 	Threshold int
+	Commits   [][]byte // the commitments of the shared public polynomial
 
 	// G       kyber.Group
 	// B       kyber.Point
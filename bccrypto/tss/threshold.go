@@ -81,29 +81,109 @@ func (s *Signer) ThresholdSignVerify(msg []byte, sig []byte) bool {
 	}
 }
 
-// Encode: encode the signer self private key to []byte
+// PartialSignVerify: use the shared public key to verify a partial signature before it is combined,
+// such as the signatures of different messages which are kept apart instead of being combined
+// params:
+// - msg: the signed message
+// - sigShare: the partial signature which need to be verify
+// return the index of the signer and whether the partial signature is valid
+func (s *Signer) PartialSignVerify(msg []byte, sigShare []byte) (int, bool) {
+	if err := tbls.Verify(s.Suite, s.PublicKey, msg, sigShare); err != nil {
+		return 0, false
+	}
+	index, err := tbls.SigShare(sigShare).Index()
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
+
+// PublicKeyBytes: get the byte slice of the shared public key, which can be given to the client
+func (s *Signer) PublicKeyBytes() []byte {
+	pk, err := s.PublicKey.Commit().MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return pk
+}
+
+// Commits: get the byte slices of the commitments of the shared public polynomial, the first one is the group public key
+func (s *Signer) Commits() [][]byte {
+	if s.PublicKey == nil {
+		return nil
+	}
+	_, commits := s.PublicKey.Info()
+	cbs := make([][]byte, len(commits))
+	for i, c := range commits {
+		cb, err := c.MarshalBinary()
+		if err != nil {
+			return nil
+		}
+		cbs[i] = cb
+	}
+	return cbs
+}
+
+// VerifyByPublicKey: verify the recovered signature by the byte slice of the shared public key
+// note: it is used by the one who has no signer, e.g. the client
+// params:
+// - pk:  the byte slice of the shared public key, see PublicKeyBytes
+// - msg: the signed message
+// - sig: the recovered signature which need to be verify
+// return whether the signature is valid
+func VerifyByPublicKey(pk []byte, msg []byte, sig []byte) bool {
+	suite := bn256.NewSuite()
+	point := suite.G2().Point()
+	if err := point.UnmarshalBinary(pk); err != nil {
+		return false
+	}
+	return bdn.Verify(suite, point, msg, sig) == nil
+}
+
+// Encode: encode the signer self private key and the shared public key to []byte
 func (s *Signer) Encode() []byte {
 	pri, err := s.PrivateKey.V.MarshalBinary()
 	if err != nil {
 		return nil
 	}
-	js, err := json.Marshal(SignerJson{s.PrivateKey.I, pri, s.SignNum, s.Threshold})
+	signerJson := SignerJson{I: s.PrivateKey.I, V: pri, SignNum: s.SignNum, Threshold: s.Threshold, Commits: s.Commits()}
+	js, err := json.Marshal(signerJson)
 	if err != nil {
 		return nil
 	}
 	return js
 }
 
-// Encode: decode []byte to the signer self private key
+// Decode: decode []byte to the signer self private key,
+// the shared public key is also rebuilt if the commitments are encoded, so the signer can be loaded from a file
 func (s *Signer) Decode(data []byte) error {
 	var signerJson SignerJson
 	err := json.Unmarshal(data, &signerJson)
 	if err != nil {
 		return err
 	}
+	if s.Suite == nil {
+		s.Suite = bn256.NewSuite()
+	}
+	if s.PrivateKey == nil {
+		s.PrivateKey = &share.PriShare{V: s.Suite.G2().Scalar()}
+	}
 	s.SignNum = signerJson.SignNum
 	s.Threshold = signerJson.Threshold
 	s.PrivateKey.I = signerJson.I
-	kyber.Scalar.SetBytes(s.PrivateKey.V, signerJson.V)
+	if err := s.PrivateKey.V.UnmarshalBinary(signerJson.V); err != nil {
+		return err
+	}
+	if len(signerJson.Commits) == 0 {
+		return nil
+	}
+	commits := make([]kyber.Point, len(signerJson.Commits))
+	for i, cb := range signerJson.Commits {
+		commits[i] = s.Suite.G2().Point()
+		if err := commits[i].UnmarshalBinary(cb); err != nil {
+			return err
+		}
+	}
+	s.PublicKey = share.NewPubPoly(s.Suite.G2(), s.Suite.G2().Point().Base(), commits)
 	return nil
 }
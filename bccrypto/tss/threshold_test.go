@@ -436,3 +436,60 @@ func TestConsumeTime(t *testing.T) {
 	// fmt.Println("verify time	: ", ct3/time.Duration(count))
 	// fmt.Println("one round		: ", ct4/time.Duration(count/100))
 }
+
+// TestEncodeDecode: test the signer loaded from the encoded bytes signs and verifies with the others
+func TestEncodeDecode(t *testing.T) {
+	msg := []byte("hello tss")
+	newSigners := tss.NewSigners(4, 3)
+	loaded := make([]*tss.Signer, 4)
+	for i, s := range newSigners {
+		loaded[i] = &tss.Signer{}
+		if err := loaded[i].Decode(s.Encode()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sigs := make([][]byte, 0)
+	for _, s := range loaded[1:] {
+		sig, err := s.ThresholdSign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, sig)
+	}
+	comSig, err := loaded[0].CombineSig(msg, sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newSigners[0].ThresholdSignVerify(msg, comSig) || !loaded[3].ThresholdSignVerify(msg, comSig) {
+		t.Fatal("verify the signature of loaded signers failed")
+	}
+	fmt.Println(loaded[0].PrivateKey.I, loaded[0].Threshold)
+}
+
+// TestPartialSignVerify: test the partial signatures are verified one by one with the index of signer,
+// and the ones of another message or another cluster are rejected
+func TestPartialSignVerify(t *testing.T) {
+	msg := []byte("hello tss")
+	newSigners := tss.NewSigners(4, 3)
+	for i, s := range newSigners {
+		sig, err := s.ThresholdSign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, ok := newSigners[0].PartialSignVerify(msg, sig)
+		if !ok || index != i {
+			t.Fatal("partial signature of signer", i, "is verified as", index, ok)
+		}
+		if _, ok := newSigners[0].PartialSignVerify([]byte("hello test"), sig); ok {
+			t.Fatal("partial signature of another message is verified")
+		}
+	}
+	sig, _ := tss.NewSigners(4, 3)[0].ThresholdSign(msg)
+	if _, ok := newSigners[0].PartialSignVerify(msg, sig); ok {
+		t.Fatal("partial signature of another cluster is verified")
+	}
+	if _, ok := newSigners[0].PartialSignVerify(msg, nil); ok {
+		t.Fatal("empty partial signature is verified")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bcrequest"
+	"bufio"
+	"config"
+	"encoding/json"
+	"factory"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"server"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	// define the type and number of parameters you need
+	confPtr := flag.String("c", "", "The node config file")
+	recoverPtr := flag.Bool("re", false, "Restart from the local data in the storage path instead of clearing it")
+	keygenPtr := flag.Bool("keygen", false, "Generate the configs and the key files of a cluster on localhost")
+	nodePtr := flag.Int("n", 4, "The node number, only for -keygen")
+	protocolPtr := flag.String("pr", "bh", "The protocol to use, only for -keygen")
+	outPtr := flag.String("o", "./cluster", "The directory to write the generated files, only for -keygen")
+	caPtr := flag.String("ca", "./cluster-ca", "The directory to write the cluster CA and its private key, kept by the operator off the replicas, only for -keygen")
+	portPtr := flag.Int("po", 21000, "The first port of replicas, only for -keygen")
+	signPtr := flag.String("sign", "", "Print the commands separated by ';' as the requests signed by the key of the operator, which are sent to a replica by s, such as the reconfigurations")
+	opPtr := flag.String("op", "./cluster/operator", "The directory of the key of the operator, only for -sign")
+	helpPtr := flag.Bool("h", false, "Display this help message")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	// parse command line arguments
+	flag.Parse()
+
+	if *helpPtr {
+		flag.Usage()
+		return
+	}
+
+	mainLogger := *log.New(os.Stdout, "", 0)
+	mainLogger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+
+	if *keygenPtr {
+		confs, err := factory.GenClusterConfigs(*nodePtr, *protocolPtr, *outPtr, *caPtr, *portPtr)
+		if err != nil {
+			mainLogger.Println("generate cluster error:", err)
+			os.Exit(1)
+		}
+		for _, nc := range confs {
+			fmt.Println(nc.Name(), nc.Cluster[nc.ID].Addr, "client:", nc.Listen)
+		}
+		return
+	}
+
+	// the operator signs the requests on its own host, and the replicas only check them
+	if *signPtr != "" {
+		if err := factory.LoadOperator(*opPtr); err != nil {
+			mainLogger.Println("load operator error:", err)
+			os.Exit(1)
+		}
+		for _, req := range factory.SignCmd(factory.ParseCmds([]string{*signPtr})) {
+			reqJson, err := json.Marshal(req)
+			if err != nil {
+				mainLogger.Println("encode request error:", err)
+				os.Exit(1)
+			}
+			fmt.Println("s", string(reqJson))
+		}
+		return
+	}
+
+	if *confPtr == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	nc, err := config.ReadNodeConfig(*confPtr)
+	if err != nil {
+		mainLogger.Println("read config error:", err)
+		os.Exit(1)
+	}
+	if *recoverPtr {
+		nc.Recover = true
+	}
+
+	s, err := StartNode(nc)
+	if err != nil {
+		mainLogger.Println("start node error:", err)
+		os.Exit(1)
+	}
+	mainLogger.Println("Node", s.ServerID.ID.Name, "is started and ready", s.Orderer.ConsType)
+
+	// stop the node when the process is interrupted, the node is only stopped by the signals of its host,
+	// the clients connected to the listen address can't stop it
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		StopNode(s)
+		os.Exit(0)
+	}()
+
+	StartClientPort(nc.Listen, s, nc.Operator != "")
+}
+
+// StartNode: create the replica by the node config and start the first round or rejoin the cluster
+// params:
+// - nc: the node config
+// return the server and error
+func StartNode(nc config.NodeConfig) (*server.Server, error) {
+	consType, err := factory.ParseProtocol(nc.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := factory.LoadSigner(consType, nc.SignerFile)
+	if err != nil {
+		return nil, err
+	}
+	s, err := server.NewNodeServer(nc, consType, signer)
+	if err != nil {
+		return nil, err
+	}
+	if nc.Operator != "" {
+		if err := factory.LoadOperator(nc.Operator); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes := []*server.Server{s}
+	if s.Recovered {
+		factory.RejoinServers(nodes)
+	} else if s.ServerID.ID.Name == s.Orderer.GetLeaderName() {
+		factory.GenFirstRound(nodes, nc.Path)
+	} else {
+		factory.ClearBlockInPath(nodes, nc.Path)
+	}
+
+	// start three process to handle the message, handle requests and propose the requests left in the mempool
+	go s.RouteServerMsg(s.ServerID.Address)
+	go s.HandleReq()
+	go s.WatchReqs(50 * time.Millisecond)
+
+	// the coordinator signs the reconfigurations by the key of the operator, so it only runs on the replica holding the key
+	if nc.Operator != "" {
+		s.StartCoordinator(factory.SignCmd)
+	}
+	s.StartHistory()
+	return s, nil
+}
+
+// StopNode: stop the consensus, flush the storage and close the transport
+func StopNode(s *server.Server) {
+	s.Orderer.Stop()
+	s.StopCoordinator()
+	s.StopHistory()
+	s.StopWatchReqs()
+	s.CloseStorage()
+	s.CloseTransport()
+}
+
+// StartClientPort: listen for the client commands
+// params:
+// - addr:     the address to listen
+// - s:        the replica
+// - operator: whether the replica holds the key of the operator to sign the console requests
+func StartClientPort(addr string, s *server.Server, operator bool) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println("Error listening:", err.Error())
+		select {}
+	}
+	defer ln.Close()
+
+	fmt.Println("Node listens the client on", addr)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			fmt.Println("Error accepting connection:", err.Error())
+			continue
+		}
+		go handleClient(conn, s, operator)
+	}
+}
+
+// handleClient: the replica handles the client commands
+// - r <request>: submit the request signed by the operator to the mempool, which is gossiped to all replicas,
+// only on the replica holding the key of the operator, and never the reconfiguration
+// - s <signed request>: submit the request signed by a registered client, which is the json of bcrequest.BCRequest
+// the rejected requests are replied to the client, such as "rejected 0: mempool is full"
+// note: the client port isn't authenticated, so it doesn't accept the command to stop the replica, see main,
+// and it doesn't sign the reconfigurations by the key of the operator for anyone connected,
+// the operator signs them on its own host by -sign and sends them by s
+func handleClient(conn net.Conn, s *server.Server, operator bool) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line := strings.TrimRight(msg, "\r\n")
+		input := strings.Split(line, " ")
+
+		switch input[0] {
+		case "r":
+			if !operator {
+				fmt.Fprintln(conn, "rejected: the replica doesn't hold the key of the operator, send the signed request by s")
+				continue
+			}
+			cmds := factory.ParseCmds(input[1:])
+			if i := reconfigIndex(cmds); i >= 0 {
+				fmt.Fprintf(conn, "rejected %d: the reconfiguration isn't signed for the client port, sign it by -sign and send it by s\n", i)
+				continue
+			}
+			replyRejected(conn, s.SubmitReqs(factory.SignCmd(cmds)))
+		case "s":
+			req := bcrequest.BCRequest{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "s ")), &req); err != nil {
+				fmt.Println("request is invalid:", err)
+				continue
+			}
+			replyRejected(conn, s.SubmitReqs([]bcrequest.BCRequest{req}))
+		default:
+			fmt.Fprintf(conn, "unknown command %q\n", input[0])
+		}
+	}
+}
+
+// reconfigIndex: get the index of the first command of reconfiguration, the malformed one included
+// return:
+// - the index, -1 if there is no command of reconfiguration
+func reconfigIndex(cmds [][]byte) int {
+	for i, cmd := range cmds {
+		if rc, err := bcrequest.ParseReconfigCmd(cmd); rc != nil || err != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// replyRejected: reply the index and the reason of each rejected request to the client
+func replyRejected(conn net.Conn, errs []error) {
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(conn, "rejected %d: %v\n", i, err)
+		}
+	}
+}
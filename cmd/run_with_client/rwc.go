@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	common "common"
+	"config"
 	"deltachain/core/client"
+	"encoding/hex"
 	"factory"
 	"flag"
 	"fmt"
@@ -25,6 +27,9 @@ func main() {
 	protocolPtr := flag.String("pr", "bh", "The protocol to use")
 	pathPtr := flag.String("pa", "./BCData", "The protocol to use")
 	nodePtr := flag.Int("n", 4, "The node number")
+	confPtr := flag.String("c", "", "The config file, the default config is used if it is empty")
+	recoverPtr := flag.Bool("re", false, "Restart from the local data in the storage path instead of clearing it")
+	keyPtr := flag.String("pk", "./proof.key", "The file of the public key verifying the proofs of blocks, written by the server and read by the client")
 
 	// parse command line arguments
 	flag.Parse()
@@ -52,22 +57,52 @@ func main() {
 			pro = common.HOTSTUFF_PROTOCOL_CHAINED
 		case "h2":
 			pro = common.HOTSTUFF_2_PROTOCOL
+		case "fh":
+			pro = common.FAST_HOTSTUFF_PROTOCOL
+		case "bs":
+			pro = common.BULLSHARK
 		case "pbft":
 			pro = common.PBFT
 		default:
 			fmt.Println("Input invalid")
 		}
-		simulateServers := factory.GenServers(node, path, pro, mgmt.BASIC)
+		// read the system config
+		conf := config.DefaultConfig()
+		if *confPtr != "" {
+			var err error
+			conf, err = config.ReadConfig(*confPtr)
+			if err != nil {
+				mainLogger.Println("read config error:", err)
+				return
+			}
+		}
+		if *recoverPtr {
+			conf.Recover = true
+		}
+		simulateServers := factory.GenServers(node, path, pro, mgmt.BASIC, conf)
 		// mainLogger.Println(simulateServers)
 		factory.ClearBlockInPath(simulateServers, path)
+		factory.RejoinServers(simulateServers)
 		mainLogger.Println("All nodes are started and ready", simulateServers[0].Orderer.ConsType)
 
+		// the client gets the public key from the file instead of the proofs sent by the servers
+		if err := os.WriteFile(*keyPtr, []byte(hex.EncodeToString(simulateServers[0].Orderer.PublicKey())), 0644); err != nil {
+			mainLogger.Println("write public key error:", err)
+		}
+
 		StartServerPort(port, simulateServers)
 
 	} else if role == "client" {
 		address := "127.0.0.1"
 
 		client := client.NewClient(address, port)
+		if content, err := os.ReadFile(*keyPtr); err != nil {
+			fmt.Println("read public key error, the proofs are not verified:", err)
+		} else if pk, err := hex.DecodeString(strings.TrimSpace(string(content))); err != nil {
+			fmt.Println("public key is invalid, the proofs are not verified:", err)
+		} else {
+			client.SetProofKey(pk)
+		}
 		client.StartClient()
 	} else {
 		fmt.Println("Invalid mode. Please specify 'server' or 'client'.")
@@ -125,16 +160,22 @@ outerLoop:
 		// the input command calls the function to process
 		switch input[0] {
 		case "r":
-			factory.GenNewReq(simulateServers, factory.SignCmd(common.StringSlice2TwoDimByteSlice(input[1:])))
+			factory.GenNewReq(simulateServers, factory.SignCmd(factory.ParseCmds(input[1:])))
 		case "a":
 			factory.AutoGenNewReq(simulateServers, input[1:])
 		case "c":
 			fmt.Println(len(simulateServers[1].NodeManager.NodesTable))
 			// factory.CheckNodeInfo(simulateServers)
+		case "p":
+			factory.GenProof(simulateServers, input[1:])
 		case "b":
 			count := factory.CheckBlkInfo(simulateServers)
 			fmt.Println("all blocks contains commonds:", count)
 			// p2p.Send(simulateServers[0].Clients["c_0"].Addr, append([]byte{byte(count)}, []byte("\n")...))
+		case "t":
+			for _, s := range simulateServers {
+				fmt.Printf("%s %+v\n", s.ServerID.ID.Name, s.GetPacemakerMetrics())
+			}
 		case "j":
 			test.NewServerJoin(&simulateServers)
 		case "e":
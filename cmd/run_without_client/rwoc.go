@@ -2,6 +2,7 @@ package main
 
 import (
 	common "common"
+	"config"
 	"flag"
 	"fmt"
 	"mgmt"
@@ -16,6 +17,8 @@ func main() {
 	protocolPtr := flag.String("pr", "bh", "The protocol to use")
 	nodePtr := flag.Int("n", 4, "The node number")
 	pathPtr := flag.String("pa", "./BCData", "Storage path for blocks ")
+	confPtr := flag.String("c", "", "The config file, the default config is used if it is empty")
+	recoverPtr := flag.Bool("re", false, "Restart from the local data in the storage path instead of clearing it")
 	helpPtr := flag.Bool("h", false, "Display this help message")
 
 	flag.Usage = func() {
@@ -36,15 +39,33 @@ func main() {
 	node := *nodePtr
 	path := *pathPtr
 
+	// read the system config
+	conf := config.DefaultConfig()
+	if *confPtr != "" {
+		var err error
+		conf, err = config.ReadConfig(*confPtr)
+		if err != nil {
+			fmt.Println("read config error:", err)
+			return
+		}
+	}
+	if *recoverPtr {
+		conf.Recover = true
+	}
+
 	switch protocol {
 	case "bh":
-		test.Start(node, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC)
+		test.Start(node, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC, conf)
 	case "ch":
-		test.Start(node, path, common.HOTSTUFF_PROTOCOL_CHAINED, mgmt.BASIC)
+		test.Start(node, path, common.HOTSTUFF_PROTOCOL_CHAINED, mgmt.BASIC, conf)
 	case "h2":
-		test.Start(node, path, common.HOTSTUFF_2_PROTOCOL, mgmt.BASIC)
+		test.Start(node, path, common.HOTSTUFF_2_PROTOCOL, mgmt.BASIC, conf)
+	case "fh":
+		test.Start(node, path, common.FAST_HOTSTUFF_PROTOCOL, mgmt.BASIC, conf)
+	case "bs":
+		test.Start(node, path, common.BULLSHARK, mgmt.BASIC, conf)
 	case "pbft":
-		test.Start(node, path, common.PBFT, mgmt.BASIC)
+		test.Start(node, path, common.PBFT, mgmt.BASIC, conf)
 	default:
 		fmt.Println("Input invalid")
 	}
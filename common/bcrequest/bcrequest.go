@@ -1,8 +1,128 @@
 package bcrequest
 
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/xlcetc/cryptogm/sm/sm2"
+	"github.com/xlcetc/cryptogm/sm/sm3"
+)
+
 // BCRequest: the request
 type BCRequest struct {
 	Id   string // id of the client that sent the request
+	Seq  uint64 // sequence number of the request given by the client, unique for each request of the client and starts from 1
 	Cmd  []byte // commands of the request
 	Sign []byte // sign for the request by the client
 }
+
+// reqTx: the request in proposal and block, which keeps the client, the sequence number and the signature
+// so that every replica can verify it and find the replayed one
+type reqTx struct {
+	Id   string `json:"id"`
+	Seq  uint64 `json:"seq"`
+	Cmd  string `json:"cmd"`
+	Sign []byte `json:"sign"`
+}
+
+// SignedBytes: get the bytes signed by the client, that is, the client id, the sequence number and the command
+// the client id and the command are length-prefixed, so that different requests never get the same bytes
+func (req *BCRequest) SignedBytes() []byte {
+	var buf bytes.Buffer
+	writeBytes(&buf, []byte(req.Id))
+	binary.Write(&buf, binary.BigEndian, req.Seq)
+	writeBytes(&buf, req.Cmd)
+	return buf.Bytes()
+}
+
+// Hash: get the hash of request, which is the identity of request in the mempool
+// note: the signature is not hashed, the same request signed twice gets the same hash
+func (req *BCRequest) Hash() string {
+	h := sm3.SumSM3(req.SignedBytes())
+	return string(h[:])
+}
+
+// writeBytes: write the length and the content of byte slice to buffer
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// Verify: verify the signature of request by the public key of client
+func (req *BCRequest) Verify(pk []byte) bool {
+	if len(pk) == 0 || len(req.Sign) == 0 {
+		return false
+	}
+	return sm2.Sm2Verify(req.Sign, pk, req.SignedBytes())
+}
+
+// SignWith: sign the request by the key of client
+// params:
+// - sk: the SM2 private key of client
+// - pk: the SM2 public key of client
+// return:
+// - error
+func (req *BCRequest) SignWith(sk []byte, pk []byte) error {
+	sign, err := sm2.Sm2Sign(sk, pk, req.SignedBytes())
+	if err != nil {
+		return err
+	}
+	req.Sign = sign
+	return nil
+}
+
+// Encode: encode the request to the transaction in proposal and block
+func (req *BCRequest) Encode() []byte {
+	tx, _ := json.Marshal(reqTx{
+		Id:   req.Id,
+		Seq:  req.Seq,
+		Cmd:  string(req.Cmd),
+		Sign: req.Sign,
+	})
+	return tx
+}
+
+// DecodeTx: decode the transaction generated by Encode
+// params:
+// - tx: the transaction in proposal or block
+// return:
+// - the request and error
+func DecodeTx(tx []byte) (*BCRequest, error) {
+	if len(tx) == 0 || tx[0] != '{' {
+		return nil, ErrBadRequest
+	}
+	var rt reqTx
+	if err := json.Unmarshal(tx, &rt); err != nil || rt.Id == "" {
+		return nil, ErrBadRequest
+	}
+	return &BCRequest{
+		Id:   rt.Id,
+		Seq:  rt.Seq,
+		Cmd:  []byte(rt.Cmd),
+		Sign: rt.Sign,
+	}, nil
+}
+
+// CmdOf: get the command of transaction which is executed by the application
+// note: the transaction which is not an encoded request, such as the ones in the blocks of old version, is the command itself
+func CmdOf(tx string) string {
+	req, err := DecodeTx([]byte(tx))
+	if err != nil {
+		return tx
+	}
+	return string(req.Cmd)
+}
+
+var (
+	ErrBadRequest    = errors.New("request can't be decoded")
+	ErrUnknownClient = errors.New("unknown client")
+	ErrBadSignature  = errors.New("request signature verification failed")
+	ErrReplayed      = errors.New("request has been committed")
+	ErrRegistered    = errors.New("client has been registered")
+	ErrRevoked       = errors.New("client has been revoked")
+	ErrBadClientId   = errors.New("client id must start with " + CLIENT_PREFIX)
+	ErrNotOperator   = errors.New("reconfiguration must be sent by an operator")
+	ErrNotCertified  = errors.New("reconfiguration is not certified by a quorum of nodes")
+)
@@ -1,3 +1,5 @@
 module bcrequest
 
 go 1.21.5
+
+require github.com/xlcetc/cryptogm v0.0.0-20230110084342-b375192b90bc
@@ -0,0 +1,94 @@
+package bcrequest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// the commands of reconfiguration, which are ordered by consensus as other requests,
+// so that all replicas retune themselves at the same height
+const (
+	RECONFIG_BATCH    = "batch"    // dcs batch <n>: set the number of requests within a block
+	RECONFIG_TIMEOUT  = "timeout"  // dcs timeout <ms>: set the base view timeout of the pacemaker in milliseconds
+	RECONFIG_PROTOCOL = "protocol" // dcs protocol <type>: switch the consensus protocol
+	RECONFIG_ADMIT    = "admit"    // dcs admit <node>: admit the node to join the system
+	RECONFIG_JOIN     = "join"     // dcs join <node>: add the node to the consensus from the next block
+	RECONFIG_EXIT     = "exit"     // dcs exit <node>: remove the node from the consensus from the next block
+)
+
+// the admission and the exit decided by the node manager instead of an operator carry the certificate of the votes of the nodes,
+// that is, dcs admit <node> <certificate> and dcs exit <node> <certificate>, see Validator.SetCertifier
+
+// ReconfigCmd: the parsed command of reconfiguration
+type ReconfigCmd struct {
+	Op     string // RECONFIG_BATCH, RECONFIG_TIMEOUT, RECONFIG_PROTOCOL, RECONFIG_ADMIT, RECONFIG_JOIN or RECONFIG_EXIT
+	Value  string // the batch size, the timeout, the consensus type or the node name
+	Height int    // the height of the block which commits the reconfiguration, -1 if it is unknown
+	Client string // the operator which sends the committed reconfiguration, empty if it is only parsed
+	Cert   string // the certificate of the votes of the nodes, empty for the reconfiguration of an operator
+}
+
+// ReconfigCommand: get the command of reconfiguration
+// params:
+// - op:    the reconfiguration, such as RECONFIG_BATCH
+// - value: the new value
+func ReconfigCommand(op string, value string) []byte {
+	return []byte("dcs " + op + " " + value)
+}
+
+// CertifiedCommand: get the admission or the exit certified by the votes of the nodes
+// params:
+// - op:   RECONFIG_ADMIT or RECONFIG_EXIT
+// - node: the node admitted or evicted
+// - cert: the encoded votes, which contains no spaces
+func CertifiedCommand(op string, node string, cert string) []byte {
+	return []byte("dcs " + op + " " + node + " " + cert)
+}
+
+// Int: get the value of the batch size or the timeout
+func (rc *ReconfigCmd) Int() int {
+	n, _ := strconv.Atoi(rc.Value)
+	return n
+}
+
+// ParseReconfigCmd: parse the command of reconfiguration
+// return:
+// - the parsed command, nil if it is not a command of reconfiguration
+// - ErrBadRequest if it is a malformed command of reconfiguration
+func ParseReconfigCmd(cmd []byte) (*ReconfigCmd, error) {
+	fields := strings.Fields(string(cmd))
+	if len(fields) == 0 || fields[0] != "dcs" {
+		return nil, nil
+	}
+	if len(fields) != 3 && len(fields) != 4 {
+		return nil, ErrBadRequest
+	}
+
+	rc := &ReconfigCmd{Op: fields[1], Value: fields[2], Height: -1}
+	if len(fields) == 4 {
+		if rc.Op != RECONFIG_ADMIT && rc.Op != RECONFIG_EXIT {
+			return nil, ErrBadRequest
+		}
+		rc.Cert = fields[3]
+	}
+	switch rc.Op {
+	case RECONFIG_BATCH, RECONFIG_TIMEOUT:
+		if n, err := strconv.Atoi(rc.Value); err != nil || n <= 0 {
+			return nil, ErrBadRequest
+		}
+	case RECONFIG_PROTOCOL:
+	case RECONFIG_ADMIT, RECONFIG_JOIN, RECONFIG_EXIT:
+		if !strings.HasPrefix(rc.Value, "r_") {
+			return nil, ErrBadRequest
+		}
+	default:
+		return nil, ErrBadRequest
+	}
+	return rc, nil
+}
+
+// IsReconfigCmd: check the command is a well-formed command of reconfiguration
+func IsReconfigCmd(cmd []byte) bool {
+	rc, err := ParseReconfigCmd(cmd)
+	return rc != nil && err == nil
+}
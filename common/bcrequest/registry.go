@@ -0,0 +1,125 @@
+package bcrequest
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// the commands of the client registry, which are ordered by consensus as other requests
+const (
+	CLIENT_REGISTER = "register" // client register <pk> [addr]: register the client with its SM2 public key in hex and the address to send replies, signed by the key
+	CLIENT_REVOKE   = "revoke"   // client revoke: revoke the key of client, signed by the key, and the client id can't be used again
+)
+
+// CLIENT_PREFIX: the prefix of client id, which keeps the clients apart from the replicas when the replies are routed
+const CLIENT_PREFIX = "c_"
+
+// ClientEntry: the client in the registry
+type ClientEntry struct {
+	Id      string // the id of client, which is the BCRequest.Id of its requests
+	Pk      []byte // the SM2 public key of client
+	Addr    string // the address of client to send the replies, no reply is sent if it is empty
+	Revoked bool   // whether the key of client has been revoked
+}
+
+// ClientCmd: the parsed command of the client registry
+type ClientCmd struct {
+	Op   string // CLIENT_REGISTER or CLIENT_REVOKE
+	Pk   []byte // the public key to register
+	Addr string // the address to register
+}
+
+// ValidClientId: check the id can be registered as a client
+func ValidClientId(id string) bool {
+	return strings.HasPrefix(id, CLIENT_PREFIX) && len(id) > len(CLIENT_PREFIX) && !strings.ContainsAny(id, " \t\r\n")
+}
+
+// RegisterCmd: get the command to register the client
+// params:
+// - pk:   the SM2 public key of client
+// - addr: the address of client to send the replies
+func RegisterCmd(pk []byte, addr string) []byte {
+	return []byte(strings.TrimSpace("client " + CLIENT_REGISTER + " " + hex.EncodeToString(pk) + " " + addr))
+}
+
+// RevokeCmd: get the command to revoke the key of client
+func RevokeCmd() []byte {
+	return []byte("client " + CLIENT_REVOKE)
+}
+
+// ParseClientCmd: parse the command of the client registry
+// return:
+// - the parsed command, nil if it is not a command of the client registry
+// - ErrBadRequest if it is a malformed command of the client registry
+func ParseClientCmd(cmd []byte) (*ClientCmd, error) {
+	fields := strings.Fields(string(cmd))
+	if len(fields) == 0 || fields[0] != "client" {
+		return nil, nil
+	}
+	if len(fields) < 2 {
+		return nil, ErrBadRequest
+	}
+
+	switch fields[1] {
+	case CLIENT_REGISTER:
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, ErrBadRequest
+		}
+		pk, err := hex.DecodeString(fields[2])
+		if err != nil || len(pk) == 0 {
+			return nil, ErrBadRequest
+		}
+		cc := &ClientCmd{Op: CLIENT_REGISTER, Pk: pk}
+		if len(fields) == 4 {
+			cc.Addr = fields[3]
+		}
+		return cc, nil
+	case CLIENT_REVOKE:
+		if len(fields) != 2 {
+			return nil, ErrBadRequest
+		}
+		return &ClientCmd{Op: CLIENT_REVOKE}, nil
+	}
+	return nil, ErrBadRequest
+}
+
+// IsClientCmd: check the command is a well-formed command of the client registry
+func IsClientCmd(cmd []byte) bool {
+	cc, err := ParseClientCmd(cmd)
+	return cc != nil && err == nil
+}
+
+// ClientResults: the results of the requests of a client in the executed blocks, which are replied to the client
+type ClientResults struct {
+	Id      string
+	Results []string
+}
+
+// GroupResults: group the results of the executed transactions by their clients
+// the clients are in the order of their first requests, the transactions which are not encoded requests are not replied
+// params:
+// - txs:     the executed transactions
+// - results: the result of each transaction
+// return:
+// - the results of each client
+func GroupResults(txs []string, results []string) []ClientResults {
+	if len(txs) != len(results) {
+		return nil
+	}
+	index := make(map[string]int)
+	groups := make([]ClientResults, 0)
+	for i, tx := range txs {
+		req, err := DecodeTx([]byte(tx))
+		if err != nil {
+			continue
+		}
+		j, ok := index[req.Id]
+		if !ok {
+			j = len(groups)
+			index[req.Id] = j
+			groups = append(groups, ClientResults{Id: req.Id})
+		}
+		groups[j].Results = append(groups[j].Results, results[i])
+	}
+	return groups
+}
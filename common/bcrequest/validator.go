@@ -0,0 +1,414 @@
+package bcrequest
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// WINDOW_SIZE: the default number of committed sequence numbers kept for each client
+const WINDOW_SIZE = 4096
+
+// window: the committed sequence numbers of a client
+// the latest size ones are kept, the older ones are represented by floor, the largest sequence number dropped from the window,
+// so the request whose sequence number is not larger than floor is regarded as a replay
+type window struct {
+	seqs  map[uint64]bool // the kept sequence numbers
+	order []uint64        // the kept sequence numbers in commit order
+	floor uint64          // the largest dropped sequence number
+}
+
+// Validator: the registry of clients, which verifies the signatures of client requests and rejects the requests committed before
+// the leader filters its batch by it, and the replicas check the proposal by it before voting
+// note: the clients registered or revoked by the committed requests are the state of the chain, they are rebuilt when the blocks are replayed
+type Validator struct {
+	clients map[string]*ClientEntry                     // the registered clients
+	static  map[string]ClientEntry                      // the clients given at startup, which are registered without consensus
+	windows map[string]*window                          // the deduplication window of each client
+	size    int                                         // the size of window
+	commits []func(txs []string)                        // the functions called with the transactions of each committed block
+	reconfs []func(rc *ReconfigCmd)                     // the functions called with each committed command of reconfiguration
+	certify func(req *BCRequest, rc *ReconfigCmd) error // verify the certified reconfiguration, see SetCertifier
+	lock    sync.Mutex
+}
+
+// NewValidator: create a validator without clients
+// params:
+// - size: the number of committed sequence numbers kept for each client, WINDOW_SIZE is used if it is not positive
+func NewValidator(size int) *Validator {
+	if size <= 0 {
+		size = WINDOW_SIZE
+	}
+	return &Validator{
+		clients: make(map[string]*ClientEntry),
+		static:  make(map[string]ClientEntry),
+		windows: make(map[string]*window),
+		size:    size,
+	}
+}
+
+// AddClient: register a client at startup, such as the client whose key is read from file
+// note: all replicas must add the same clients, the client without public key is ignored
+func (v *Validator) AddClient(entry ClientEntry) {
+	if len(entry.Pk) == 0 {
+		return
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.static[entry.Id] = entry
+	v.clients[entry.Id] = &entry
+}
+
+// Client: get the registered client which is not revoked
+// return:
+// - the client and whether it is found
+func (v *Validator) Client(id string) (ClientEntry, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	entry, ok := v.clients[id]
+	if !ok || entry.Revoked {
+		return ClientEntry{}, false
+	}
+	return *entry, true
+}
+
+// SetCertifier: set the function verifying the admission and the exit certified by the votes of the nodes,
+// which is sent by a node instead of a client, the certified reconfiguration is rejected if the function isn't set
+// note: the function is called with the lock of validator held, and it must give the same result on all replicas at the same height
+func (v *Validator) SetCertifier(f func(req *BCRequest, rc *ReconfigCmd) error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.certify = f
+}
+
+// Check: check the request is signed by its client and has not been committed
+// the registration is signed by the key in it, and the client id must be new,
+// the reconfiguration must be sent by an operator, that is, a client given at startup,
+// or certified by the votes of the nodes, see SetCertifier
+// return:
+// - nil if the request is valid, or the reason to reject it
+func (v *Validator) Check(req *BCRequest) error {
+	cc, err := ParseClientCmd(req.Cmd)
+	if err != nil {
+		return err
+	}
+	rc, err := ParseReconfigCmd(req.Cmd)
+	if err != nil {
+		return err
+	}
+
+	v.lock.Lock()
+	entry := v.clients[req.Id]
+	committed := v.committed(req.Id, req.Seq)
+	_, operator := v.static[req.Id]
+	certify := v.certify
+	v.lock.Unlock()
+
+	if rc != nil && rc.Cert != "" {
+		if committed {
+			return ErrReplayed
+		}
+		if certify == nil {
+			return ErrNotCertified
+		}
+		return certify(req, rc)
+	}
+	if rc != nil && !operator {
+		return ErrNotOperator
+	}
+
+	var pk []byte
+	if cc != nil && cc.Op == CLIENT_REGISTER {
+		if entry != nil {
+			return ErrRegistered
+		}
+		if !ValidClientId(req.Id) {
+			return ErrBadClientId
+		}
+		pk = cc.Pk
+	} else {
+		if entry == nil {
+			return ErrUnknownClient
+		}
+		if entry.Revoked {
+			return ErrRevoked
+		}
+		pk = entry.Pk
+	}
+
+	if committed {
+		return ErrReplayed
+	}
+	if !req.Verify(pk) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Filter: keep the valid requests, a request repeated in the batch is kept only once
+// params:
+// - reqs: the requests recieved by the leader
+// return:
+// - the valid requests and the error of each rejected one
+func (v *Validator) Filter(reqs []BCRequest) ([]BCRequest, []error) {
+	valid := make([]BCRequest, 0, len(reqs))
+	errs := make([]error, 0)
+	seen := make(map[string]map[uint64]bool)
+	for i := range reqs {
+		if seen[reqs[i].Id][reqs[i].Seq] {
+			errs = append(errs, ErrReplayed)
+			continue
+		}
+		if err := v.Check(&reqs[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[reqs[i].Id] == nil {
+			seen[reqs[i].Id] = make(map[uint64]bool)
+		}
+		seen[reqs[i].Id][reqs[i].Seq] = true
+		valid = append(valid, reqs[i])
+	}
+	return valid, errs
+}
+
+// CheckTxs: check all transactions of a proposed block, a block with any invalid or repeated request is rejected
+// params:
+// - txs: the transactions of the proposed block
+// return:
+// - nil if all requests are valid, or the reason to reject the block
+func (v *Validator) CheckTxs(txs []string) error {
+	reqs := make([]BCRequest, len(txs))
+	for i, tx := range txs {
+		req, err := DecodeTx([]byte(tx))
+		if err != nil {
+			return err
+		}
+		reqs[i] = *req
+	}
+	_, errs := v.Filter(reqs)
+	if len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Commit: record the requests of a committed block in the windows of their clients, and register or revoke the clients
+// note: the block has been checked before commit, but in the pipelined protocols a request may be proposed again
+// before its first block is committed, or its client may be revoked by a previous block,
+// so the requests are checked against the committed state here again without the signatures
+// params:
+// - txs: the transactions of the committed block
+// return:
+// - nil for each transaction which should be executed, or the reason not to execute it,
+// the transactions which are not encoded requests are always executed
+func (v *Validator) Commit(txs []string) []error {
+	return v.CommitBlock(-1, txs)
+}
+
+// CommitBlock: record the requests of the committed block at the height, see Commit,
+// and the committed commands of reconfiguration carry the height, such as the join of node taking effect from the next block
+// params:
+// - height: the height of the committed block
+// - txs:    the transactions of the committed block
+// return:
+// - nil for each transaction which should be executed, or the reason not to execute it
+func (v *Validator) CommitBlock(height int, txs []string) []error {
+	errs, rcs := v.commit(txs)
+
+	v.lock.Lock()
+	commits := v.commits
+	reconfs := v.reconfs
+	v.lock.Unlock()
+	for _, f := range commits {
+		f(txs)
+	}
+	for _, rc := range rcs {
+		rc.Height = height
+		for _, f := range reconfs {
+			f(rc)
+		}
+	}
+	return errs
+}
+
+// OnCommit: add the function called with the transactions of each committed block, such as evicting them from the mempool
+func (v *Validator) OnCommit(f func(txs []string)) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.commits = append(v.commits, f)
+}
+
+// OnReconfig: add the function called with each committed command of reconfiguration in order, such as retuning the replica
+// note: the commands are committed again when the blocks are replayed, so the function must set the values instead of changing them
+func (v *Validator) OnReconfig(f func(rc *ReconfigCmd)) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.reconfs = append(v.reconfs, f)
+}
+
+// commit: record the requests of a committed block
+// return:
+// - the errors of Commit and the committed commands of reconfiguration
+func (v *Validator) commit(txs []string) ([]error, []*ReconfigCmd) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	errs := make([]error, len(txs))
+	rcs := make([]*ReconfigCmd, 0)
+	for i, tx := range txs {
+		req, err := DecodeTx([]byte(tx))
+		if err != nil {
+			continue
+		}
+		if v.committed(req.Id, req.Seq) {
+			errs[i] = ErrReplayed
+			continue
+		}
+		if errs[i] = v.apply(req); errs[i] != nil {
+			continue
+		}
+		if rc, _ := ParseReconfigCmd(req.Cmd); rc != nil {
+			rc.Client = req.Id
+			rcs = append(rcs, rc)
+		}
+
+		w, ok := v.windows[req.Id]
+		if !ok {
+			w = &window{seqs: make(map[uint64]bool)}
+			v.windows[req.Id] = w
+		}
+		w.seqs[req.Seq] = true
+		w.order = append(w.order, req.Seq)
+		for len(w.order) > v.size {
+			if w.order[0] > w.floor {
+				w.floor = w.order[0]
+			}
+			delete(w.seqs, w.order[0])
+			w.order = w.order[1:]
+		}
+	}
+	return errs, rcs
+}
+
+// apply: register or revoke the client by the committed request, the lock must be held by the caller
+// note: the certified reconfiguration is verified again, since the nodes voting for it may be changed by a previous block
+// return:
+// - nil if the request can be executed
+func (v *Validator) apply(req *BCRequest) error {
+	cc, err := ParseClientCmd(req.Cmd)
+	if err != nil {
+		return err
+	}
+	if rc, _ := ParseReconfigCmd(req.Cmd); rc != nil && rc.Cert != "" {
+		if v.certify == nil {
+			return ErrNotCertified
+		}
+		return v.certify(req, rc)
+	}
+	entry := v.clients[req.Id]
+	if cc != nil && cc.Op == CLIENT_REGISTER {
+		if entry != nil {
+			return ErrRegistered
+		}
+		v.clients[req.Id] = &ClientEntry{Id: req.Id, Pk: cc.Pk, Addr: cc.Addr}
+		return nil
+	}
+
+	if entry == nil {
+		return ErrUnknownClient
+	}
+	if entry.Revoked {
+		return ErrRevoked
+	}
+	if rc, err := ParseReconfigCmd(req.Cmd); err != nil {
+		return err
+	} else if _, operator := v.static[req.Id]; rc != nil && !operator {
+		return ErrNotOperator
+	}
+	if cc != nil && cc.Op == CLIENT_REVOKE {
+		entry.Revoked = true
+	}
+	return nil
+}
+
+// Reset: clear the windows of all clients and the clients registered by consensus, the clients given at startup are kept
+// note: it is required before the blocks are replayed from height 0
+func (v *Validator) Reset() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.windows = make(map[string]*window)
+	v.clients = make(map[string]*ClientEntry)
+	for id, entry := range v.static {
+		entry := entry
+		v.clients[id] = &entry
+	}
+}
+
+// validatorSnapshot: the content of the snapshot of validator
+type validatorSnapshot struct {
+	Clients map[string]ClientEntry    // the registered clients
+	Windows map[string]windowSnapshot // the deduplication window of each client
+}
+
+// windowSnapshot: the content of the snapshot of window, the kept sequence numbers are rebuilt by the order
+type windowSnapshot struct {
+	Order []uint64
+	Floor uint64
+}
+
+// Snapshot: get the json of the clients and the windows, which is the same on all replicas at the same height
+func (v *Validator) Snapshot() ([]byte, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	s := validatorSnapshot{
+		Clients: make(map[string]ClientEntry, len(v.clients)),
+		Windows: make(map[string]windowSnapshot, len(v.windows)),
+	}
+	for id, entry := range v.clients {
+		s.Clients[id] = *entry
+	}
+	for id, w := range v.windows {
+		s.Windows[id] = windowSnapshot{Order: w.order, Floor: w.floor}
+	}
+	return json.Marshal(s)
+}
+
+// Restore: replace the clients and the windows with the snapshot, such as the one synced by the joined node,
+// the clients given at startup are kept
+// params:
+// - snapshot: the json generated by Snapshot
+func (v *Validator) Restore(snapshot []byte) error {
+	var s validatorSnapshot
+	if err := json.Unmarshal(snapshot, &s); err != nil {
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.clients = make(map[string]*ClientEntry, len(s.Clients))
+	for id, entry := range v.static {
+		entry := entry
+		v.clients[id] = &entry
+	}
+	for id, entry := range s.Clients {
+		entry := entry
+		v.clients[id] = &entry
+	}
+	v.windows = make(map[string]*window, len(s.Windows))
+	for id, ws := range s.Windows {
+		w := &window{seqs: make(map[uint64]bool, len(ws.Order)), order: ws.Order, floor: ws.Floor}
+		for _, seq := range ws.Order {
+			w.seqs[seq] = true
+		}
+		v.windows[id] = w
+	}
+	return nil
+}
+
+// committed: whether the request of client has been committed, the lock must be held by the caller
+func (v *Validator) committed(id string, seq uint64) bool {
+	w, ok := v.windows[id]
+	if !ok {
+		return seq == 0
+	}
+	return seq <= w.floor || w.seqs[seq]
+}
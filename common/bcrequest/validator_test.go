@@ -0,0 +1,229 @@
+package bcrequest_test
+
+import (
+	"bcrequest"
+	"fmt"
+	"ssm2"
+	"testing"
+)
+
+// newReq: generate a request signed by the signer
+func newReq(signer *ssm2.Signer, seq uint64, cmd string) bcrequest.BCRequest {
+	req := bcrequest.BCRequest{Id: "c_0", Seq: seq, Cmd: []byte(cmd)}
+	req.Sign = signer.Sign(req.SignedBytes())
+	return req
+}
+
+// TestValidator: test the validator rejects the forged, unknown and replayed requests,
+// and the window keeps the latest committed sequence numbers
+func TestValidator(t *testing.T) {
+	signers := ssm2.NewSigners(2)
+	v := bcrequest.NewValidator(2)
+	v.AddClient(bcrequest.ClientEntry{Id: "c_0", Pk: signers[0].Pk})
+
+	req := newReq(signers[0], 1, "put a 1")
+	tx := req.Encode()
+	decoded, err := bcrequest.DecodeTx(tx)
+	if err != nil || v.Check(decoded) != nil || bcrequest.CmdOf(string(tx)) != "put a 1" {
+		t.Fatal("valid request is rejected", err)
+	}
+
+	// signed by another key, changed after signing and sent by an unknown client
+	forged := newReq(signers[1], 2, "put a 1")
+	changed := newReq(signers[0], 3, "put a 1")
+	changed.Cmd = []byte("put a 2")
+	unknown := newReq(signers[0], 4, "put a 1")
+	unknown.Id = "c_1"
+	for i, err := range []error{v.Check(&forged), v.Check(&changed), v.Check(&unknown)} {
+		fmt.Println(i, err)
+		if err == nil {
+			t.Fatal("invalid request is accepted", i)
+		}
+	}
+
+	// the request repeated in a batch is kept only once
+	valid, errs := v.Filter([]bcrequest.BCRequest{req, req, changed})
+	if len(valid) != 1 || len(errs) != 2 || v.CheckTxs([]string{string(tx), string(tx)}) != bcrequest.ErrReplayed {
+		t.Fatal("repeated request is accepted", len(valid), errs)
+	}
+
+	// the committed request is replayed, even if it has been dropped from the window
+	errs = v.Commit([]string{string(tx), string(tx), "raw command"})
+	if errs[0] != nil || errs[1] != bcrequest.ErrReplayed || errs[2] != nil || v.Check(&req) != bcrequest.ErrReplayed {
+		t.Fatal("committed request is accepted", errs)
+	}
+	for seq := uint64(5); seq < 8; seq++ {
+		r := newReq(signers[0], seq, "get a")
+		v.Commit([]string{string(r.Encode())})
+	}
+	if v.Check(&req) != bcrequest.ErrReplayed {
+		t.Fatal("old request is accepted")
+	}
+	pending := newReq(signers[0], 8, "get a")
+	if v.Check(&pending) != nil {
+		t.Fatal("new request is rejected")
+	}
+
+	// the window is rebuilt after reset
+	v.Reset()
+	if v.Check(&req) != nil {
+		t.Fatal("reset error")
+	}
+}
+
+// TestClientRegistry: test the client is registered by the request signed by its own key, and can't send requests after revoked
+func TestClientRegistry(t *testing.T) {
+	signers := ssm2.NewSigners(2)
+	v := bcrequest.NewValidator(0)
+
+	sign := func(req *bcrequest.BCRequest, signer *ssm2.Signer) string {
+		req.SignWith(signer.Sk, signer.Pk)
+		return string(req.Encode())
+	}
+
+	// the registration must be signed by the registered key, and the id must be a client id
+	reg := bcrequest.BCRequest{Id: "c_1", Seq: 1, Cmd: bcrequest.RegisterCmd(signers[0].Pk, "127.0.0.1:30001")}
+	forged := reg
+	sign(&forged, signers[1])
+	if v.Check(&forged) != bcrequest.ErrBadSignature {
+		t.Fatal("registration signed by another key is accepted")
+	}
+	replica := bcrequest.BCRequest{Id: "r_1", Seq: 1, Cmd: bcrequest.RegisterCmd(signers[0].Pk, "")}
+	sign(&replica, signers[0])
+	if v.Check(&replica) != bcrequest.ErrBadClientId {
+		t.Fatal("replica name is registered as client")
+	}
+
+	put := bcrequest.BCRequest{Id: "c_1", Seq: 2, Cmd: []byte("put a 1")}
+	putTx := sign(&put, signers[0])
+	if v.Check(&put) != bcrequest.ErrUnknownClient {
+		t.Fatal("request of unknown client is accepted")
+	}
+	regTx := sign(&reg, signers[0])
+	if err := v.Check(&reg); err != nil {
+		t.Fatal("registration is rejected", err)
+	}
+
+	// the registration and the request of the client are committed in order
+	errs := v.Commit([]string{regTx, putTx})
+	entry, ok := v.Client("c_1")
+	fmt.Println(errs, entry.Addr)
+	if errs[0] != nil || errs[1] != nil || !ok || entry.Addr != "127.0.0.1:30001" {
+		t.Fatal("register error", errs)
+	}
+	again := bcrequest.BCRequest{Id: "c_1", Seq: 3, Cmd: bcrequest.RegisterCmd(signers[1].Pk, "")}
+	sign(&again, signers[1])
+	if v.Check(&again) != bcrequest.ErrRegistered {
+		t.Fatal("client is registered twice")
+	}
+
+	// the client revokes its key, then its requests are rejected
+	revoke := bcrequest.BCRequest{Id: "c_1", Seq: 4, Cmd: bcrequest.RevokeCmd()}
+	get := bcrequest.BCRequest{Id: "c_1", Seq: 5, Cmd: []byte("get a")}
+	getTx := sign(&get, signers[0])
+	errs = v.Commit([]string{sign(&revoke, signers[0]), getTx})
+	if _, ok := v.Client("c_1"); ok || errs[1] != bcrequest.ErrRevoked || v.Check(&get) != bcrequest.ErrRevoked {
+		t.Fatal("revoke error", errs)
+	}
+
+	// the registry is rebuilt by replaying
+	v.Reset()
+	if _, ok := v.Client("c_1"); ok {
+		t.Fatal("reset error")
+	}
+
+	groups := bcrequest.GroupResults([]string{regTx, "raw", putTx, getTx}, []string{"OK", "ERROR", "OK", "1"})
+	if len(groups) != 1 || groups[0].Id != "c_1" || len(groups[0].Results) != 3 {
+		t.Fatal("group results error", groups)
+	}
+}
+
+// TestReconfig: test the reconfiguration is only committed from an operator, and the committed ones are passed to the functions in order
+func TestReconfig(t *testing.T) {
+	signers := ssm2.NewSigners(2)
+	v := bcrequest.NewValidator(0)
+	v.AddClient(bcrequest.ClientEntry{Id: "c_0", Pk: signers[0].Pk})
+	rcs := make([]bcrequest.ReconfigCmd, 0)
+	v.OnReconfig(func(rc *bcrequest.ReconfigCmd) {
+		rcs = append(rcs, *rc)
+	})
+
+	for _, cmd := range []string{"dcs batch 0", "dcs batch x", "dcs timeout", "dcs admit c_1", "dcs join c_1", "dcs exit", "dcs resize 4"} {
+		if _, err := bcrequest.ParseReconfigCmd([]byte(cmd)); err != bcrequest.ErrBadRequest {
+			t.Fatal("malformed reconfiguration is parsed", cmd)
+		}
+	}
+
+	// the client registered by consensus is not an operator
+	reg := bcrequest.BCRequest{Id: "c_1", Seq: 1, Cmd: bcrequest.RegisterCmd(signers[1].Pk, "")}
+	reg.SignWith(signers[1].Sk, signers[1].Pk)
+	v.Commit([]string{string(reg.Encode())})
+	batch := bcrequest.BCRequest{Id: "c_1", Seq: 2, Cmd: bcrequest.ReconfigCommand(bcrequest.RECONFIG_BATCH, "64")}
+	batch.SignWith(signers[1].Sk, signers[1].Pk)
+	if v.Check(&batch) != bcrequest.ErrNotOperator {
+		t.Fatal("reconfiguration of client is accepted")
+	}
+
+	txs := make([]string, 0)
+	for i, cmd := range [][]byte{
+		bcrequest.ReconfigCommand(bcrequest.RECONFIG_BATCH, "64"),
+		[]byte("put a 1"),
+		bcrequest.ReconfigCommand(bcrequest.RECONFIG_ADMIT, "r_4"),
+	} {
+		req := newReq(signers[0], uint64(i+1), string(cmd))
+		if err := v.Check(&req); err != nil {
+			t.Fatal("reconfiguration of operator is rejected", err)
+		}
+		txs = append(txs, string(req.Encode()))
+	}
+	errs := v.Commit(append(txs, string(batch.Encode())))
+	fmt.Println(errs, rcs)
+	if errs[3] != bcrequest.ErrNotOperator || len(rcs) != 2 || rcs[0].Int() != 64 || rcs[1].Value != "r_4" || rcs[1].Height != -1 {
+		t.Fatal("commit reconfiguration error", errs, rcs)
+	}
+
+	// the committed join carries the height of its block and its operator
+	join := newReq(signers[0], 4, string(bcrequest.ReconfigCommand(bcrequest.RECONFIG_JOIN, "r_4")))
+	v.CommitBlock(7, []string{string(join.Encode())})
+	if len(rcs) != 3 || rcs[2].Op != bcrequest.RECONFIG_JOIN || rcs[2].Height != 7 || rcs[2].Client != "c_0" {
+		t.Fatal("commit join error", rcs)
+	}
+}
+
+// TestCertifiedReconfig: test the admission and the exit sent by a node are committed only if the certifier accepts their votes
+func TestCertifiedReconfig(t *testing.T) {
+	v := bcrequest.NewValidator(0)
+	rcs := make([]bcrequest.ReconfigCmd, 0)
+	v.OnReconfig(func(rc *bcrequest.ReconfigCmd) {
+		rcs = append(rcs, *rc)
+	})
+	if _, err := bcrequest.ParseReconfigCmd(bcrequest.CertifiedCommand(bcrequest.RECONFIG_JOIN, "r_4", "votes")); err != bcrequest.ErrBadRequest {
+		t.Fatal("certified join is parsed")
+	}
+
+	exit := bcrequest.BCRequest{Id: "r_1", Seq: 1, Cmd: bcrequest.CertifiedCommand(bcrequest.RECONFIG_EXIT, "r_3", "votes")}
+	if err := v.Check(&exit); err != bcrequest.ErrNotCertified {
+		t.Fatal("certified exit is accepted without certifier", err)
+	}
+	v.SetCertifier(func(req *bcrequest.BCRequest, rc *bcrequest.ReconfigCmd) error {
+		if rc.Cert != "quorum" {
+			return bcrequest.ErrNotCertified
+		}
+		return nil
+	})
+	if err := v.Check(&exit); err != bcrequest.ErrNotCertified {
+		t.Fatal("exit without quorum is accepted", err)
+	}
+
+	// the node isn't an operator, so its reconfiguration without votes is rejected
+	batch := bcrequest.BCRequest{Id: "r_1", Seq: 2, Cmd: bcrequest.ReconfigCommand(bcrequest.RECONFIG_BATCH, "64")}
+	certified := bcrequest.BCRequest{Id: "r_1", Seq: 3, Cmd: bcrequest.CertifiedCommand(bcrequest.RECONFIG_EXIT, "r_3", "quorum")}
+	if v.Check(&batch) != bcrequest.ErrNotOperator || v.Check(&certified) != nil {
+		t.Fatal("check certified reconfiguration error")
+	}
+	errs := v.CommitBlock(5, []string{string(exit.Encode()), string(certified.Encode()), string(certified.Encode())})
+	if errs[0] != bcrequest.ErrNotCertified || errs[1] != nil || errs[2] != bcrequest.ErrReplayed || len(rcs) != 1 ||
+		rcs[0].Op != bcrequest.RECONFIG_EXIT || rcs[0].Value != "r_3" || rcs[0].Client != "r_1" || rcs[0].Height != 5 {
+		t.Fatal("commit certified exit error", errs, rcs)
+	}
+}
@@ -1,8 +1,11 @@
 package blockchain
 
 import (
+	"bytes"
+	"canonical"
 	common "common"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"merkle"
 	"os"
@@ -15,16 +18,24 @@ import (
 
 // BlockStore: the storage core of the blockchain is responsible for the reading and writing of the blockchain
 type BlockStore struct {
-	Base            int64  // reserved field
-	Height          int    // the height of form a new block or current block
-	GeneratedHeight int    // the height of the generated block,mainly used for Chained-Hotstuff
-	PreBlkHash      []byte // the hash of previous block
-	CurBlkHash      []byte // the hash of current block
-	CurProposalBlk  Block  // the block of current proposal in current view
-	Path            string // the storage path of the block
+	Base            int64        // reserved field
+	Height          int          // the height of form a new block or current block
+	GeneratedHeight int          // the height of the generated block,mainly used for Chained-Hotstuff
+	PreBlkHash      []byte       // the hash of previous block
+	CurBlkHash      []byte       // the hash of current block
+	CurProposalBlk  Block        // the block of current proposal in current view
+	Path            string       // the storage path of the block
+	Storage         BlockStorage // the storage engine of blocks, file storage in Path by default
 	WMu             sync.Mutex
+	halted          bool // whether the blocks committed later are dropped, see Halt
 }
 
+// the encoding versions of the block header hash
+const (
+	LEGACY_VERSION    = 0 // the blocks stored before the canonical encoding, whose hash is kept for verification
+	CANONICAL_VERSION = 1 // the blocks hashed by the canonical encoding
+)
+
 // Block: block entity, Block = BlockHeader + BlockData
 type Block struct {
 	BlkHdr  BlockHeader // the header of block
@@ -33,6 +44,7 @@ type Block struct {
 
 // BlockHeader: the header of a block, which include some information about block but no concrete transactions
 type BlockHeader struct {
+	Version     int    `json:",omitempty"` // the encoding version of the block hash, LEGACY_VERSION for the blocks stored before the canonical encoding
 	Height      int    // the height of the block
 	ViewNumber  int    // the view number when the block is presented
 	TimeStamp   int64  // the timestamp when the block is presented
@@ -40,6 +52,8 @@ type BlockHeader struct {
 	RootHash    []byte // the root hash of merkel tree consisting of all transactions in the block
 	Validation  []byte // the signature of the block of 2f+1 nodes
 	BlkDataHash []byte // the hash of the block data
+
+	ValidationMsg []byte `json:",omitempty"` // the message signed by the validation, which contains the block hash
 }
 
 // BlockData: the data body of a block, which include concrete transctions and necessary information
@@ -79,13 +93,13 @@ func (bs *BlockStore) WriteBlock(path string, blk Block) error {
 func (bs *BlockStore) ReadBlock(path string, blkHeight int) (*Block, error) {
 	content, err := os.ReadFile(path + strconv.Itoa(blkHeight) + ".txt")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	var Blk Block
 	// var BlkData BlockData
 	err = json.Unmarshal(content, &Blk)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &Blk, nil
 }
@@ -128,16 +142,24 @@ func GetBlockHeight(root string) (int64, error) {
 
 // Hash: get the block data hash
 func (bd *BlockData) Hash() []byte {
-	bdHash := make([]byte, 0)
-	bdHash = append(bdHash, byte(bd.Height))
-	bdHash = append(bdHash, bd.RootHash...)
-	bdHash = append(bdHash, common.StringSlice2OneDimByteSlice(bd.Trans)...)
-	return merkle.Sum(bdHash)
+	e := canonical.NewEncoder(canonical.TAG_BLOCK_DATA)
+	e.Int(bd.Height).Bytes(bd.RootHash).Strings(bd.Trans)
+	return merkle.Sum(e.Encoded())
 }
 
 // Hash: get the block hash
-// !!! the hash the entire block
+// note: the block hash of the canonical version is the hash of the block header, the transactions are contained by the root hash
+// and the block data hash, so that the block can be verified by the block header only,
+// and the legacy blocks keep their old hash which covers the block data, so the stored chain and its validations are still valid after upgrade
 func (b *Block) Hash() []byte {
+	if b.BlkHdr.Version == LEGACY_VERSION {
+		return b.legacyHash()
+	}
+	return b.BlkHdr.Hash()
+}
+
+// legacyHash: get the hash of the legacy block, whose integers are truncated to a byte and whose data is hashed with the header
+func (b *Block) legacyHash() []byte {
 	bHash := make([]byte, 0)
 	bHash = append(bHash, byte(b.BlkHdr.Height))
 	bHash = append(bHash, byte(b.BlkHdr.ViewNumber))
@@ -152,33 +174,109 @@ func (b *Block) Hash() []byte {
 	return merkle.Sum(bHash)
 }
 
+// Hash: get the block header hash by the canonical encoding, the validation is excluded because it signs the hash
+// note: it is the block hash of the canonical version only, the hash of legacy block covers its data, see Block.Hash
+func (bh *BlockHeader) Hash() []byte {
+	e := canonical.NewEncoder(canonical.TAG_BLOCK_HEADER)
+	e.Int(bh.Version).Int(bh.Height).Int(bh.ViewNumber).Int64(bh.TimeStamp)
+	e.Bytes(bh.PreBlkHash).Bytes(bh.RootHash).Bytes(bh.BlkDataHash)
+	return merkle.Sum(e.Encoded())
+}
+
+// IsCanonical: whether the block header is hashed by the canonical encoding,
+// the proposed blocks must be canonical, only the stored legacy blocks are hashed by the legacy encoding
+func (bh *BlockHeader) IsCanonical() bool {
+	return bh.Version == CANONICAL_VERSION
+}
+
+// VerifyBlockData: check the block data is the one committed by the block header,
+// since the canonical block hash covers the header only, the certified hash must not be trusted for the transactions without it
+// note: the hash of legacy block covers its data, so the legacy block is always accepted
+// return:
+// - error if the root hash isn't the merkle root of the transactions, or the block data hash isn't the hash of the block data
+func (b *Block) VerifyBlockData() error {
+	if !b.BlkHdr.IsCanonical() {
+		return nil
+	}
+	root := merkle.HashFromByteSlices(common.StringSlice2TwoDimByteSlice(b.BlkData.Trans))
+	if !bytes.Equal(b.BlkHdr.RootHash, root) || !bytes.Equal(b.BlkData.RootHash, root) {
+		return errors.New("the root hash doesn't match the transactions")
+	}
+	if b.BlkData.Height != b.BlkHdr.Height {
+		return errors.New("the height of block data doesn't match the header")
+	}
+	if !bytes.Equal(b.BlkHdr.BlkDataHash, b.BlkData.Hash()) {
+		return errors.New("the block data hash doesn't match the block data")
+	}
+	return nil
+}
+
+// Latency: get the time since the block is presented, which is the commit latency when the block is committed
+// return:
+// - the latency, and false if the block has no timestamp
+func (bh *BlockHeader) Latency() (time.Duration, bool) {
+	if bh.TimeStamp == 0 {
+		return 0, false
+	}
+	return time.Since(time.UnixMilli(bh.TimeStamp)), true
+}
+
 // WirteBlock: write current the lastest node's block to local blockchain and refresh current block state
 // params:
 // - blk: the block to be stored
 func (bs *BlockStore) StoreBlock(blk Block) {
 	bs.WMu.Lock()
 	defer bs.WMu.Unlock()
+	if bs.halted {
+		return
+	}
+	storage := bs.GetStorage()
 	for {
-		dirPath := bs.Path
-		_, err := os.Stat(dirPath)
-
-		if os.IsNotExist(err) {
-			os.MkdirAll(dirPath, 0755)
-		} else if err != nil {
-			fmt.Println("error occur:", err)
+		err := storage.WriteBlock(blk)
+		if err == nil {
+			break
 		} else {
-			err := bs.WriteBlock(dirPath+"/", blk)
-			if err == nil {
-				break
-			} else {
-				fmt.Println("write block error", err)
-			}
+			fmt.Println("write block error", err)
 		}
 	}
+	bs.Height += 1
 	bs.PreBlkHash = bs.CurBlkHash
 	bs.CurBlkHash = nil
 }
 
+// Halt: drop the blocks committed later, so that the tip stays at the current block,
+// such as the consensus is switched at it and the blocks in flight are proposed again by the new consensus
+func (bs *BlockStore) Halt() {
+	bs.WMu.Lock()
+	defer bs.WMu.Unlock()
+	bs.halted = true
+}
+
+// Halted: check whether the block store drops the committed blocks
+func (bs *BlockStore) Halted() bool {
+	bs.WMu.Lock()
+	defer bs.WMu.Unlock()
+	return bs.halted
+}
+
+// GetStorage: get the storage engine of blocks, create the file storage in Path if it is not set
+func (bs *BlockStore) GetStorage() BlockStorage {
+	if bs.Storage == nil {
+		bs.Storage = NewFileStorage(bs.Path)
+	}
+	return bs.Storage
+}
+
+// SetStorage: replace the storage engine of blocks and close the old one
+// params:
+// - storage: the new storage engine
+func (bs *BlockStore) SetStorage(storage BlockStorage) {
+	if bs.Storage != nil && bs.Storage != storage {
+		bs.Storage.Close()
+	}
+	bs.Storage = storage
+}
+
 // GenNewBlock: generate a new block and assign it to bs
 // params:
 // - viewNumber: the view number when the block is generated
@@ -194,23 +292,36 @@ func (bs *BlockStore) GenNewBlock(viewNumber int, commands []string, heights ...
 		bs.GeneratedHeight += 1
 	}
 
+	bs.CurProposalBlk = NewBlock(newHeight, bs.PreBlkHash, viewNumber, commands)
+	bs.CurBlkHash = bs.CurProposalBlk.Hash()
+}
+
+// NewBlock: generate a new block on the previous block, which may be not committed yet, such as the pipelined proposals
+// params:
+// - height: the height of the block
+// - preBlkHash: the hash of the previous block
+// - viewNumber: the view number when the block is generated
+// - commands: the block contains commands/transctions
+// return:
+// - the new block
+func NewBlock(height int, preBlkHash []byte, viewNumber int, commands []string) Block {
 	newBlock := Block{
 		BlkData: BlockData{
-			Height:   newHeight,
+			Height:   height,
 			RootHash: merkle.HashFromByteSlices(common.StringSlice2TwoDimByteSlice(commands)),
 			Trans:    commands,
 		},
 		BlkHdr: BlockHeader{
-			Height:     newHeight,
-			PreBlkHash: bs.PreBlkHash,
+			Version:    CANONICAL_VERSION,
+			Height:     height,
+			PreBlkHash: preBlkHash,
 			ViewNumber: viewNumber,
 			TimeStamp:  time.Now().UnixNano() / int64(time.Millisecond),
 		},
 	}
 	newBlock.BlkHdr.RootHash = newBlock.BlkData.RootHash
-	bs.CurProposalBlk = newBlock
-	bs.CurProposalBlk.BlkHdr.BlkDataHash = bs.CurProposalBlk.BlkData.Hash()
-	bs.CurBlkHash = bs.CurProposalBlk.Hash()
+	newBlock.BlkHdr.BlkDataHash = newBlock.BlkData.Hash()
+	return newBlock
 }
 
 // GenEmptyBlock: generate an empty block
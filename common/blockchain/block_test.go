@@ -2,9 +2,13 @@ package blockchain_test
 
 import (
 	bc "blockchain"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"testing"
+	"wire"
 )
 
 // TestFileReadAndWrite: try to wirte blocks and read
@@ -105,3 +109,88 @@ func TestGenerateBlock(t *testing.T) {
 	}
 
 }
+
+// TestBlockHash: test the golden vectors of the block hash, the legacy blocks keep their hash covering the block data after upgrade,
+// and the heights which collide in the legacy encoding get different canonical hashes
+func TestBlockHash(t *testing.T) {
+	hdr := bc.BlockHeader{Height: 300, ViewNumber: 44, TimeStamp: 1700000000000, PreBlkHash: []byte{1, 2}, RootHash: []byte{3}, BlkDataHash: []byte{4, 5}}
+	bd := bc.BlockData{Height: 300, RootHash: []byte{3}, Trans: []string{"put a 1", "get a"}}
+	blk := bc.Block{BlkHdr: hdr, BlkData: bd}
+	legacy := "f22a3167b81c299b5d3ff75bdc6ea5c6dd2d884a3e068b979026c05839bc2433"
+	if hex.EncodeToString(blk.Hash()) != legacy {
+		t.Fatalf("legacy hash: expected %s, got %x", legacy, blk.Hash())
+	}
+
+	// the legacy block stored without the version is still hashed by the legacy encoding
+	stored, _ := json.Marshal(blk)
+	read := bc.Block{}
+	if err := json.Unmarshal(stored, &read); err != nil || read.BlkHdr.IsCanonical() || hex.EncodeToString(read.Hash()) != legacy {
+		t.Fatal("stored legacy block hash changed", err)
+	}
+
+	// the legacy block sent by the binary codec keeps its hash, the nil hashes are not turned into empty ones
+	sent, _ := wire.Marshal(&blk, wire.BINARY)
+	read = bc.Block{}
+	if err := wire.Unmarshal(sent, &read); err != nil || hex.EncodeToString(read.Hash()) != legacy {
+		t.Fatal("sent legacy block hash changed", err)
+	}
+
+	// the hash of legacy block covers its data
+	read.BlkData.Trans = []string{"put a 2", "get a"}
+	if hex.EncodeToString(read.Hash()) == legacy {
+		t.Fatal("legacy hash doesn't cover the block data")
+	}
+
+	hdr.Version = bc.CANONICAL_VERSION
+	canonical := "9dbfa92a4b48d49b67d0f5405ba9d078a7d6af385e10840f4c1fcfe1019fae36"
+	if hex.EncodeToString(hdr.Hash()) != canonical {
+		t.Fatalf("canonical hash: expected %s, got %x", canonical, hdr.Hash())
+	}
+	blk.BlkHdr = hdr
+	if !bytes.Equal(blk.Hash(), hdr.Hash()) {
+		t.Fatal("canonical block hash is not the header hash")
+	}
+
+	data := "299b6e0bf7ca3bdb47303b223ef360c41948e4145f09fd76f9c92f6222d10f00"
+	if hex.EncodeToString(bd.Hash()) != data {
+		t.Fatalf("data hash: expected %s, got %x", data, bd.Hash())
+	}
+
+	// the height 300 is truncated to 44 by the legacy encoding
+	wrapped := blk
+	wrapped.BlkHdr.Height, wrapped.BlkData.Height = 44, 44
+	if bytes.Equal(wrapped.Hash(), blk.Hash()) {
+		t.Fatal("wrapped height collision")
+	}
+	wrapped.BlkHdr.Version, blk.BlkHdr.Version = bc.LEGACY_VERSION, bc.LEGACY_VERSION
+	if !bytes.Equal(wrapped.Hash(), blk.Hash()) {
+		t.Fatal("legacy hash changed")
+	}
+}
+
+// TestVerifyBlockData: test the block data is checked against the header, since the canonical block hash covers the header only
+func TestVerifyBlockData(t *testing.T) {
+	blk := bc.NewBlock(3, []byte{1}, 2, []string{"put a 1", "get a"})
+	if err := blk.VerifyBlockData(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tampered transactions keep the block hash but fail the check
+	tampered := blk
+	tampered.BlkData.Trans = []string{"get a", "put a 1"}
+	if !bytes.Equal(tampered.Hash(), blk.Hash()) || tampered.VerifyBlockData() == nil {
+		t.Fatal("tampered transactions are accepted")
+	}
+
+	// the block data consistent with itself but not with the header fails the check
+	forged := bc.NewBlock(3, []byte{1}, 2, []string{"put a 2"})
+	forged.BlkHdr = blk.BlkHdr
+	if forged.VerifyBlockData() == nil {
+		t.Fatal("forged block data is accepted")
+	}
+	forged = blk
+	forged.BlkData.Height = 4
+	if forged.VerifyBlockData() == nil {
+		t.Fatal("block data of another height is accepted")
+	}
+}
@@ -0,0 +1,81 @@
+package blockchain
+
+import (
+	common "common"
+	"errors"
+	"fmt"
+	"merkle"
+)
+
+// BlockProof: the proof that a request was packaged into a committed block
+type BlockProof struct {
+	Height   int                  // the height of the block
+	Index    int                  // the index of the request in the block
+	Cmd      string               // the command of the request
+	Proof    merkle.Proof         // the merkle proof from the request to the root hash
+	BlkHdr   BlockHeader          // the header of the block, which contains the root hash and the validation
+	ConsType common.ConsensusType // the consensus protocol which generates the validation
+}
+
+// GenProof: generate the merkle proof of the request in the block
+// params:
+// - index: the index of the request in the block
+// return:
+// - the merkle proof and error
+func (b *Block) GenProof(index int) (*merkle.Proof, error) {
+	if index < 0 || index >= len(b.BlkData.Trans) {
+		return nil, fmt.Errorf("index %d out of range, the block contains %d requests", index, len(b.BlkData.Trans))
+	}
+	_, proofs := merkle.ProofsFromByteSlices(common.StringSlice2TwoDimByteSlice(b.BlkData.Trans))
+	return proofs[index], nil
+}
+
+// GenBlockProof: read the block of the height from the storage and generate the proof of the request in it
+// params:
+// - height: the height of block
+// - index:  the index of the request in the block
+// return:
+// - the block proof without consensus type, and error
+func (bs *BlockStore) GenBlockProof(height int, index int) (*BlockProof, error) {
+	blk, err := bs.GetStorage().ReadBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := blk.GenProof(index)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockProof{
+		Height: height,
+		Index:  index,
+		Cmd:    blk.BlkData.Trans[index],
+		Proof:  *proof,
+		BlkHdr: blk.BlkHdr,
+	}, nil
+}
+
+// VerifyInclusion: check that the command is included by the root hash of the block header
+// and the block header has the validation and the message signed by it
+// note: the message signed by the validation is decoded by the consensus protocol, which checks that it certifies
+// exactly the block hash and verifies the signature, see orderer.VerifyBlockProof
+// return:
+// - nil if the proof is valid, or the error
+func (bp *BlockProof) VerifyInclusion() error {
+	if bp.BlkHdr.Height != bp.Height || bp.Proof.Index != int64(bp.Index) {
+		return errors.New("the height or index of proof is mismatched")
+	}
+	// the hash of legacy block covers its data, so the header alone doesn't prove the block
+	if !bp.BlkHdr.IsCanonical() {
+		return fmt.Errorf("the block of version %d can't be proven by its header", bp.BlkHdr.Version)
+	}
+	if err := bp.Proof.Verify(bp.BlkHdr.RootHash, []byte(bp.Cmd)); err != nil {
+		return err
+	}
+	if len(bp.BlkHdr.Validation) == 0 {
+		return errors.New("the block has no validation")
+	}
+	if len(bp.BlkHdr.ValidationMsg) == 0 {
+		return errors.New("the block has no validation message")
+	}
+	return nil
+}
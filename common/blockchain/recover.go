@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// StateFileName: the file name of the consensus state in the storage path
+const StateFileName = "consensus.state"
+
+// StoreState: the state of block store which is persisted with the consensus state
+type StoreState struct {
+	Height          int    // the height of form a new block or current block
+	GeneratedHeight int    // the height of the generated block, mainly used for Chained-Hotstuff
+	PreBlkHash      []byte // the hash of previous block
+	CurBlkHash      []byte // the hash of current block
+}
+
+// GetStoreState: get the state of block store to persist
+func (bs *BlockStore) GetStoreState() StoreState {
+	return StoreState{
+		Height:          bs.Height,
+		GeneratedHeight: bs.GeneratedHeight,
+		PreBlkHash:      bs.PreBlkHash,
+		CurBlkHash:      bs.CurBlkHash,
+	}
+}
+
+// SetStoreState: restore the state of block store
+func (bs *BlockStore) SetStoreState(s StoreState) {
+	bs.Height = s.Height
+	bs.GeneratedHeight = s.GeneratedHeight
+	bs.PreBlkHash = s.PreBlkHash
+	bs.CurBlkHash = s.CurBlkHash
+}
+
+// Recover: reload the height and previous block hash from the tip block in the storage
+// return:
+// - the tip block, nil if there is no block, and error
+func (bs *BlockStore) Recover() (*Block, error) {
+	storage := bs.GetStorage()
+	height, err := storage.GetBlockHeight()
+	if err != nil || height < 0 {
+		return nil, err
+	}
+	tip, err := storage.ReadBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	bs.Height = height + 1
+	bs.GeneratedHeight = height + 1
+	bs.PreBlkHash = tip.Hash()
+	bs.CurBlkHash = nil
+	return tip, nil
+}
+
+// SaveState: persist the consensus state to the storage path
+// note: the state is written to a temporary file and renamed, so that a crash never leaves a partial state,
+// and the state isn't saved once the block store is halted, since the halted consensus is replaced by another one
+// params:
+// - state: the consensus state which can be encoded to json
+// return:
+// - error
+func (bs *BlockStore) SaveState(state interface{}) error {
+	bs.WMu.Lock()
+	defer bs.WMu.Unlock()
+	if bs.halted {
+		return nil
+	}
+	return bs.writeJson(StateFileName, state)
+}
+
+// writeJson: write the json of the value to the file in the storage path by a temporary file and renaming
+// params:
+// - name:  the file name
+// - value: the value which can be encoded to json
+// return:
+// - error
+func (bs *BlockStore) writeJson(name string, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(bs.Path, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(bs.Path, name)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadState: load the consensus state from the storage path
+// params:
+// - state: the pointer of consensus state to decode to
+// return:
+// - true if the state exists, and error
+func (bs *BlockStore) LoadState(state interface{}) (bool, error) {
+	content, err := os.ReadFile(filepath.Join(bs.Path, StateFileName))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(content, state)
+}
+
+// RemoveState: remove the consensus state from the storage path, such as the state of another consensus protocol
+// return:
+// - error, nil if there is no state
+func (bs *BlockStore) RemoveState() error {
+	err := os.Remove(filepath.Join(bs.Path, StateFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package blockchain_test
+
+import (
+	bc "blockchain"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// TestBlockStoreRecover: test the block store reloads the tip and the persisted state after restart
+func TestBlockStoreRecover(t *testing.T) {
+	dir := t.TempDir()
+	opts := bc.StorageOptions{Type: bc.SEGMENT_STORAGE}
+	storage, err := bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBS := bc.BlockStore{Path: dir}
+	testBS.SetStorage(storage)
+	for i := 0; i < 3; i++ {
+		testBS.StoreBlock(genTestBlock(testBS.Height))
+	}
+	if err := testBS.SaveState(testBS.GetStoreState()); err != nil {
+		t.Fatal(err)
+	}
+	testBS.Storage.Close()
+
+	// restart with an empty block store in the same path
+	storage, err = bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoverBS := bc.BlockStore{Path: dir}
+	recoverBS.SetStorage(storage)
+	defer recoverBS.Storage.Close()
+	tip, err := recoverBS.Recover()
+	if err != nil || tip == nil || tip.BlkHdr.Height != 2 {
+		t.Fatal("recover tip error", tip, err)
+	}
+	if recoverBS.Height != 3 || !bytes.Equal(recoverBS.PreBlkHash, tip.Hash()) {
+		t.Fatal("wrong height or previous hash after recover", recoverBS.Height)
+	}
+
+	var state bc.StoreState
+	ok, err := recoverBS.LoadState(&state)
+	if err != nil || !ok || state.Height != testBS.Height || !bytes.Equal(state.PreBlkHash, testBS.PreBlkHash) {
+		t.Fatal("load state error", ok, err)
+	}
+	fmt.Println("recovered height:", recoverBS.Height)
+
+	// the halted block store drops the committed blocks and the state, and the state of the other consensus is removed
+	recoverBS.Halt()
+	recoverBS.StoreBlock(genTestBlock(recoverBS.Height))
+	if height, err := recoverBS.Storage.GetBlockHeight(); !recoverBS.Halted() || recoverBS.Height != 3 || height != 2 || err != nil {
+		t.Fatal("the halted block store stores the block", recoverBS.Height, height, err)
+	}
+	if err := recoverBS.RemoveState(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := recoverBS.LoadState(&state); ok || err != nil {
+		t.Fatal("load the removed state", ok, err)
+	}
+	if err := recoverBS.RemoveState(); err != nil {
+		t.Fatal("remove the state twice", err)
+	}
+	if err := recoverBS.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := recoverBS.LoadState(&state); ok || err != nil {
+		t.Fatal("the halted block store saves the state", ok, err)
+	}
+
+	// there is nothing to recover in an empty path
+	emptyBS := bc.BlockStore{Path: t.TempDir()}
+	if tip, err := emptyBS.Recover(); tip != nil || err != nil {
+		t.Fatal("recover from empty path", tip, err)
+	}
+	if ok, err := emptyBS.LoadState(&state); ok || err != nil {
+		t.Fatal("load state from empty path", ok, err)
+	}
+}
@@ -0,0 +1,423 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the layout of segment storage in the directory:
+// - <id>.seg:   the segments, each is a sequence of records | length(4) | crc32(4) | json of block(length) |
+// - height.idx: the index, each entry is | height(8) | segment id(4) | offset of record(8) |
+// both of them are append-only, the segment is the source of truth and the index can be rebuilt from segments
+const (
+	recordHeaderSize = 8
+	indexEntrySize   = 20
+	maxRecordSize    = 1 << 30
+	segmentExt       = ".seg"
+	indexFileName    = "height.idx"
+)
+
+// errTornRecord: the record is incomplete or its checksum is mismatched, which happens when crashing during writing
+var errTornRecord = errors.New("torn record")
+
+// recordPos: the position of a record
+type recordPos struct {
+	Segment uint32 // the id of segment
+	Offset  int64  // the offset of record in the segment
+}
+
+// indexEntry: an entry of the height index
+type indexEntry struct {
+	Height int
+	Pos    recordPos
+}
+
+// SegmentStorage: the block storage of append-only segment log with a persistent height index
+type SegmentStorage struct {
+	Dir  string         // the directory of segments and index
+	Opts StorageOptions // the storage options
+
+	index     map[int]recordPos   // the height -> position of record
+	height    int                 // the height of the last block, -1 if there is no block
+	segments  []uint32            // the sorted ids of all segments
+	active    *os.File            // the last segment which blocks are appended to
+	activeId  uint32              // the id of active segment
+	size      int64               // the size of active segment
+	indexFile *os.File            // the index file which entries are appended to
+	readers   map[uint32]*os.File // the opened sealed segments for reading
+	unsynced  int                 // the number of blocks written after last fsync
+	mu        sync.Mutex
+}
+
+// OpenSegmentStorage: open the segment storage in the directory, and recover it if the last run crashed
+// note: the torn record at the tail of last segment is truncated, the index entries pointing to it are dropped,
+// and the records not indexed are indexed again
+// params:
+// - dir:  the directory of segment storage
+// - opts: the storage options
+// return:
+// - the segment storage and error
+func OpenSegmentStorage(dir string, opts StorageOptions) (*SegmentStorage, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.Sync == "" {
+		opts.Sync = SYNC_ALWAYS
+	}
+	if opts.SyncBatch <= 0 {
+		opts.SyncBatch = 64
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	ss := &SegmentStorage{
+		Dir:     dir,
+		Opts:    opts,
+		index:   make(map[int]recordPos),
+		height:  -1,
+		readers: make(map[uint32]*os.File),
+	}
+	if err := ss.recover(); err != nil {
+		ss.Close()
+		return nil, err
+	}
+	return ss, nil
+}
+
+// recover: load the segments and index, truncate the torn tail and rebuild the missing index entries
+func (ss *SegmentStorage) recover() error {
+	// list the segments
+	dirEntries, err := os.ReadDir(ss.Dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range dirEntries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), segmentExt), 10, 32)
+		if err == nil {
+			ss.segments = append(ss.segments, uint32(id))
+		}
+	}
+	sort.Slice(ss.segments, func(i, j int) bool { return ss.segments[i] < ss.segments[j] })
+	if len(ss.segments) == 0 {
+		ss.segments = []uint32{0}
+	}
+	ss.activeId = ss.segments[len(ss.segments)-1]
+	ss.active, err = os.OpenFile(ss.segmentPath(ss.activeId), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	// load the index and drop the torn entry
+	ss.indexFile, err = os.OpenFile(filepath.Join(ss.Dir, indexFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(ss.indexFile)
+	if err != nil {
+		return err
+	}
+	entries := make([]indexEntry, 0, len(content)/indexEntrySize)
+	for i := 0; i+indexEntrySize <= len(content); i += indexEntrySize {
+		entries = append(entries, decodeIndexEntry(content[i:i+indexEntrySize]))
+	}
+
+	// drop the trailing entries which point to the truncated or lost records
+	var scanPos recordPos
+	for len(entries) > 0 {
+		last := entries[len(entries)-1]
+		_, recSize, err := ss.readRecord(last.Pos)
+		if err == nil {
+			scanPos = recordPos{last.Pos.Segment, last.Pos.Offset + recSize}
+			break
+		}
+		entries = entries[:len(entries)-1]
+	}
+	if len(entries) == 0 {
+		scanPos = recordPos{ss.segments[0], 0}
+	}
+	if err := ss.indexFile.Truncate(int64(len(entries) * indexEntrySize)); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		ss.setIndex(e.Height, e.Pos)
+	}
+
+	// scan the records after the last indexed record and index them again
+	for _, id := range ss.segments {
+		if id < scanPos.Segment {
+			continue
+		}
+		offset := int64(0)
+		if id == scanPos.Segment {
+			offset = scanPos.Offset
+		}
+		if err := ss.scanSegment(id, offset); err != nil {
+			return err
+		}
+	}
+
+	info, err := ss.active.Stat()
+	if err != nil {
+		return err
+	}
+	ss.size = info.Size()
+	return ss.sync()
+}
+
+// scanSegment: scan the records of segment from offset and index them
+// if the torn record is found in the last segment, truncate it
+func (ss *SegmentStorage) scanSegment(id uint32, offset int64) error {
+	f, err := ss.getFile(id)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	for offset < info.Size() {
+		pos := recordPos{id, offset}
+		payload, recSize, err := ss.readRecord(pos)
+		if err == errTornRecord {
+			if id != ss.activeId {
+				return fmt.Errorf("segment %d is corrupted at %d", id, offset)
+			}
+			return ss.active.Truncate(offset)
+		} else if err != nil {
+			return err
+		}
+
+		var blk Block
+		if err := json.Unmarshal(payload, &blk); err != nil {
+			return err
+		}
+		if err := ss.appendIndex(blk.BlkHdr.Height, pos); err != nil {
+			return err
+		}
+		offset += recSize
+	}
+	return nil
+}
+
+// WriteBlock: append the block to the active segment and index it, the segment is rotated when it is full
+func (ss *SegmentStorage) WriteBlock(blk Block) error {
+	payload, err := json.Marshal(blk)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.size > 0 && ss.size+int64(len(record)) > ss.Opts.SegmentSize {
+		if err := ss.rotate(); err != nil {
+			return err
+		}
+	}
+
+	pos := recordPos{ss.activeId, ss.size}
+	if _, err := ss.active.Write(record); err != nil {
+		// remove the partial record so that the next write starts from a clean tail
+		ss.active.Truncate(ss.size)
+		return err
+	}
+	ss.size += int64(len(record))
+
+	if err := ss.appendIndex(blk.BlkHdr.Height, pos); err != nil {
+		return err
+	}
+
+	switch ss.Opts.Sync {
+	case SYNC_ALWAYS:
+		return ss.sync()
+	case SYNC_BATCH:
+		ss.unsynced++
+		if ss.unsynced >= ss.Opts.SyncBatch {
+			return ss.sync()
+		}
+	}
+	return nil
+}
+
+// ReadBlock: read the block of the height by the index
+func (ss *SegmentStorage) ReadBlock(height int) (*Block, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	pos, ok := ss.index[height]
+	if !ok {
+		return nil, fmt.Errorf("block %d not found", height)
+	}
+	payload, _, err := ss.readRecord(pos)
+	if err != nil {
+		return nil, err
+	}
+	var blk Block
+	err = json.Unmarshal(payload, &blk)
+	if err != nil {
+		return nil, err
+	}
+	return &blk, nil
+}
+
+// GetBlockHeight: get the height of the last block, -1 if there is no block
+func (ss *SegmentStorage) GetBlockHeight() (int, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.height, nil
+}
+
+// Close: fsync and close all files
+func (ss *SegmentStorage) Close() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var err error
+	if ss.active != nil && ss.indexFile != nil {
+		err = ss.sync()
+	}
+	for id, f := range ss.readers {
+		f.Close()
+		delete(ss.readers, id)
+	}
+	if ss.active != nil {
+		ss.active.Close()
+		ss.active = nil
+	}
+	if ss.indexFile != nil {
+		ss.indexFile.Close()
+		ss.indexFile = nil
+	}
+	return err
+}
+
+// rotate: seal the active segment and create a new one
+func (ss *SegmentStorage) rotate() error {
+	if ss.Opts.Sync != SYNC_NONE {
+		if err := ss.sync(); err != nil {
+			return err
+		}
+	}
+	newId := ss.activeId + 1
+	f, err := os.OpenFile(ss.segmentPath(newId), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	ss.readers[ss.activeId] = ss.active
+	ss.active = f
+	ss.activeId = newId
+	ss.size = 0
+	ss.segments = append(ss.segments, newId)
+	return nil
+}
+
+// sync: fsync the active segment before the index, so that the index never points to a lost record
+func (ss *SegmentStorage) sync() error {
+	ss.unsynced = 0
+	if err := ss.active.Sync(); err != nil {
+		return err
+	}
+	return ss.indexFile.Sync()
+}
+
+// appendIndex: append an entry to the index file and update the index in memory
+func (ss *SegmentStorage) appendIndex(height int, pos recordPos) error {
+	if _, err := ss.indexFile.Write(encodeIndexEntry(indexEntry{height, pos})); err != nil {
+		return err
+	}
+	ss.setIndex(height, pos)
+	return nil
+}
+
+// setIndex: update the index in memory, the later record of the same height overwrites the former
+func (ss *SegmentStorage) setIndex(height int, pos recordPos) {
+	ss.index[height] = pos
+	if height > ss.height {
+		ss.height = height
+	}
+}
+
+// readRecord: read the record at the position and check its checksum
+// return:
+// - the payload, the size of the whole record and error, errTornRecord if the record is incomplete or corrupted
+func (ss *SegmentStorage) readRecord(pos recordPos) ([]byte, int64, error) {
+	f, err := ss.getFile(pos.Segment)
+	if err != nil {
+		return nil, 0, errTornRecord
+	}
+	header := make([]byte, recordHeaderSize)
+	if _, err := f.ReadAt(header, pos.Offset); err != nil {
+		return nil, 0, errTornRecord
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, 0, errTornRecord
+	}
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, pos.Offset+recordHeaderSize); err != nil {
+		return nil, 0, errTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errTornRecord
+	}
+	return payload, recordHeaderSize + int64(length), nil
+}
+
+// getFile: get the opened file of segment
+func (ss *SegmentStorage) getFile(id uint32) (*os.File, error) {
+	if id == ss.activeId && ss.active != nil {
+		return ss.active, nil
+	}
+	if f, ok := ss.readers[id]; ok {
+		return f, nil
+	}
+	f, err := os.Open(ss.segmentPath(id))
+	if err != nil {
+		return nil, err
+	}
+	ss.readers[id] = f
+	return f, nil
+}
+
+// segmentPath: get the file path of segment
+func (ss *SegmentStorage) segmentPath(id uint32) string {
+	return filepath.Join(ss.Dir, fmt.Sprintf("%010d%s", id, segmentExt))
+}
+
+// encodeIndexEntry: encode the index entry to fixed-width bytes
+func encodeIndexEntry(e indexEntry) []byte {
+	b := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint64(b[0:8], uint64(e.Height))
+	binary.BigEndian.PutUint32(b[8:12], e.Pos.Segment)
+	binary.BigEndian.PutUint64(b[12:20], uint64(e.Pos.Offset))
+	return b
+}
+
+// decodeIndexEntry: decode the fixed-width bytes to index entry
+func decodeIndexEntry(b []byte) indexEntry {
+	return indexEntry{
+		Height: int(int64(binary.BigEndian.Uint64(b[0:8]))),
+		Pos: recordPos{
+			Segment: binary.BigEndian.Uint32(b[8:12]),
+			Offset:  int64(binary.BigEndian.Uint64(b[12:20])),
+		},
+	}
+}
@@ -0,0 +1,144 @@
+package blockchain_test
+
+import (
+	bc "blockchain"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// genTestBlock: generate a block of the height for test
+func genTestBlock(height int) bc.Block {
+	return bc.Block{
+		BlkHdr: bc.BlockHeader{
+			Height:     height,
+			RootHash:   []byte{byte(height), byte(height + 1)},
+			Validation: []byte{byte(height * 11)},
+		},
+		BlkData: bc.BlockData{
+			Height: height,
+			Trans:  []string{"put k" + strconv.Itoa(height) + " v", "get k"},
+		},
+	}
+}
+
+// TestSegmentStorage: test write, rotate, reopen and read blocks of segment storage
+func TestSegmentStorage(t *testing.T) {
+	dir := t.TempDir()
+	opts := bc.StorageOptions{Type: bc.SEGMENT_STORAGE, SegmentSize: 512, Sync: bc.SYNC_BATCH, SyncBatch: 4}
+	storage, err := bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := storage.WriteBlock(genTestBlock(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storage.Close()
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	fmt.Println("segments:", len(segs))
+	if len(segs) < 2 {
+		t.Fatal("the segment is not rotated")
+	}
+
+	storage, err = bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	height, _ := storage.GetBlockHeight()
+	if height != 19 {
+		t.Fatal("wrong height after reopen", height)
+	}
+	for i := 0; i < 20; i++ {
+		blk, err := storage.ReadBlock(i)
+		if err != nil || blk.BlkHdr.Height != i || blk.BlkData.Trans[0] != "put k"+strconv.Itoa(i)+" v" {
+			t.Fatal("read block error", i, err)
+		}
+	}
+	if _, err := storage.ReadBlock(20); err == nil {
+		t.Fatal("read a block which is not written")
+	}
+}
+
+// TestSegmentRecovery: test the torn record at tail is truncated and the lost index is rebuilt
+func TestSegmentRecovery(t *testing.T) {
+	dir := t.TempDir()
+	opts := bc.StorageOptions{Type: bc.SEGMENT_STORAGE, SegmentSize: 512, Sync: bc.SYNC_NONE}
+	storage, err := bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		storage.WriteBlock(genTestBlock(i))
+	}
+	storage.Close()
+
+	// simulate a crash during writing: cut the last record and lose the tail of index
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	last := segs[len(segs)-1]
+	info, _ := os.Stat(last)
+	os.Truncate(last, info.Size()-5)
+	idx := filepath.Join(dir, "height.idx")
+	info, _ = os.Stat(idx)
+	os.Truncate(idx, info.Size()-20*3-7)
+
+	storage, err = bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height, _ := storage.GetBlockHeight()
+	fmt.Println("height after recovery:", height)
+	if height != 8 {
+		t.Fatal("wrong height after recovery", height)
+	}
+	for i := 0; i <= height; i++ {
+		if blk, err := storage.ReadBlock(i); err != nil || blk.BlkHdr.Height != i {
+			t.Fatal("read block error after recovery", i, err)
+		}
+	}
+
+	// the next block is appended after the truncated tail
+	if err := storage.WriteBlock(genTestBlock(9)); err != nil {
+		t.Fatal(err)
+	}
+	storage.Close()
+
+	// the index is rebuilt from segments if it is lost
+	os.Remove(idx)
+	storage, err = bc.NewBlockStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	height, _ = storage.GetBlockHeight()
+	if height != 9 {
+		t.Fatal("wrong height after rebuilding index", height)
+	}
+	if blk, err := storage.ReadBlock(9); err != nil || blk.BlkHdr.Height != 9 {
+		t.Fatal("read block error after rebuilding index", err)
+	}
+}
+
+// TestBlockStoreStorage: test the block store writes blocks through the storage
+func TestBlockStoreStorage(t *testing.T) {
+	storage, err := bc.NewBlockStorage(t.TempDir(), bc.StorageOptions{Type: bc.SEGMENT_STORAGE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBS := bc.BlockStore{}
+	testBS.SetStorage(storage)
+	defer testBS.Storage.Close()
+	for i := 0; i < 3; i++ {
+		testBS.StoreBlock(genTestBlock(testBS.Height))
+	}
+	proof, err := testBS.GenBlockProof(2, 0)
+	if err != nil || testBS.Height != 3 {
+		t.Fatal("store block error", testBS.Height, err)
+	}
+	fmt.Println(proof.Cmd)
+}
@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// SnapshotFileName: the file name of the synced snapshot in the storage path
+const SnapshotFileName = "state.snapshot"
+
+// Snapshot: the replicated state at a height, which the joined node syncs instead of the blocks below the height,
+// so the blocks are replayed from the height after restarting, see LoadSnapshot
+type Snapshot struct {
+	Height int    // the height of the last block applied to the state, -1 means no block has been applied
+	State  []byte // the snapshot of the state machine
+	Config []byte // the replicated config of the server, such as the nodes of the epoch
+}
+
+// SaveSnapshot: persist the synced snapshot to the storage path, the snapshot is kept until a later one is synced
+// params:
+// - snapshot: the synced snapshot
+// return:
+// - error
+func (bs *BlockStore) SaveSnapshot(snapshot Snapshot) error {
+	bs.WMu.Lock()
+	defer bs.WMu.Unlock()
+	return bs.writeJson(SnapshotFileName, snapshot)
+}
+
+// LoadSnapshot: load the synced snapshot from the storage path
+// return:
+// - the snapshot, nil if no snapshot has been synced, and error
+func (bs *BlockStore) LoadSnapshot() (*Snapshot, error) {
+	content, err := os.ReadFile(filepath.Join(bs.Path, SnapshotFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(content, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
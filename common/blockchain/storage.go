@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BlockStorage: the storage engine of blocks
+type BlockStorage interface {
+	WriteBlock(blk Block) error           // write the block, the block with the same height is overwritten
+	ReadBlock(height int) (*Block, error) // read the block of the height
+	GetBlockHeight() (int, error)         // get the height of the last block, -1 if there is no block
+	Close() error                         // close the storage and flush the written blocks
+}
+
+// StorageType: the type of block storage engine
+type StorageType string
+
+const (
+	FILE_STORAGE    StorageType = "file"    // one json file per block, named by the height of block
+	SEGMENT_STORAGE StorageType = "segment" // append-only segment log with a height index
+)
+
+// SyncPolicy: the policy of fsync after writing a block
+type SyncPolicy string
+
+const (
+	SYNC_ALWAYS SyncPolicy = "always" // fsync after every block
+	SYNC_BATCH  SyncPolicy = "batch"  // fsync after every SyncBatch blocks
+	SYNC_NONE   SyncPolicy = "none"   // never fsync explicitly, leave it to the operating system
+)
+
+// StorageOptions: the options to create a block storage
+type StorageOptions struct {
+	Type        StorageType // the type of storage engine, file storage by default
+	SegmentSize int64       // the max bytes of a segment, only for segment storage
+	Sync        SyncPolicy  // the fsync policy, only for segment storage
+	SyncBatch   int         // the number of blocks between two fsync with batch policy
+}
+
+// DefaultSegmentSize: the default max bytes of a segment
+const DefaultSegmentSize int64 = 64 << 20
+
+// NewBlockStorage: create a block storage in the directory according to the options
+// params:
+// - dir:  the directory of block storage
+// - opts: the storage options
+// return:
+// - the block storage and error
+func NewBlockStorage(dir string, opts StorageOptions) (BlockStorage, error) {
+	switch opts.Type {
+	case FILE_STORAGE, "":
+		return NewFileStorage(dir), nil
+	case SEGMENT_STORAGE:
+		return OpenSegmentStorage(dir, opts)
+	default:
+		return nil, errors.New("unknown storage type: " + string(opts.Type))
+	}
+}
+
+// FileStorage: the block storage which writes one json file per block, the file name is the height of block
+type FileStorage struct {
+	Dir string // the directory of block files
+}
+
+// NewFileStorage: create a file-per-block storage in the directory
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{Dir: dir}
+}
+
+// WriteBlock: write the block to <height>.txt
+func (fs *FileStorage) WriteBlock(blk Block) error {
+	if err := os.MkdirAll(fs.Dir, 0755); err != nil {
+		return err
+	}
+	blkJson, err := json.Marshal(blk)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(fs.Dir, strconv.Itoa(blk.BlkHdr.Height)+".txt"), blkJson, 0644)
+}
+
+// ReadBlock: read the block from <height>.txt
+func (fs *FileStorage) ReadBlock(height int) (*Block, error) {
+	content, err := os.ReadFile(filepath.Join(fs.Dir, strconv.Itoa(height)+".txt"))
+	if err != nil {
+		return nil, err
+	}
+	var blk Block
+	err = json.Unmarshal(content, &blk)
+	if err != nil {
+		return nil, err
+	}
+	return &blk, nil
+}
+
+// GetBlockHeight: get the max height in the names of block files
+func (fs *FileStorage) GetBlockHeight() (int, error) {
+	entries, err := os.ReadDir(fs.Dir)
+	if os.IsNotExist(err) {
+		return -1, nil
+	} else if err != nil {
+		return -1, err
+	}
+	height := -1
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".txt") {
+			continue
+		}
+		if h, err := strconv.Atoi(strings.TrimSuffix(name, ".txt")); err == nil && h > height {
+			height = h
+		}
+	}
+	return height, nil
+}
+
+// Close: the file storage writes every block at once, so nothing to do
+func (fs *FileStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package blockchain
+
+import "wire"
+
+// EncodeWire: write the block to the binary codec
+func (blk *Block) EncodeWire(w *wire.Writer) {
+	blk.BlkHdr.EncodeWire(w)
+	blk.BlkData.EncodeWire(w)
+}
+
+// DecodeWire: read the block from the binary codec
+func (blk *Block) DecodeWire(r *wire.Reader) {
+	blk.BlkHdr.DecodeWire(r)
+	blk.BlkData.DecodeWire(r)
+}
+
+// EncodeWire: write the block header to the binary codec
+func (bh *BlockHeader) EncodeWire(w *wire.Writer) {
+	w.Int(bh.Version).Int(bh.Height).Int(bh.ViewNumber).Varint(bh.TimeStamp)
+	w.Bytes(bh.PreBlkHash).Bytes(bh.RootHash).Bytes(bh.Validation).Bytes(bh.BlkDataHash).Bytes(bh.ValidationMsg)
+}
+
+// DecodeWire: read the block header from the binary codec
+func (bh *BlockHeader) DecodeWire(r *wire.Reader) {
+	bh.Version, bh.Height, bh.ViewNumber, bh.TimeStamp = r.Int(), r.Int(), r.Int(), r.Varint()
+	bh.PreBlkHash, bh.RootHash, bh.Validation, bh.BlkDataHash, bh.ValidationMsg = r.Bytes(), r.Bytes(), r.Bytes(), r.Bytes(), r.Bytes()
+}
+
+// EncodeWire: write the block data to the binary codec
+func (bd *BlockData) EncodeWire(w *wire.Writer) {
+	w.Int(bd.Height).Bytes(bd.RootHash).Strings(bd.Trans)
+}
+
+// DecodeWire: read the block data from the binary codec
+func (bd *BlockData) DecodeWire(r *wire.Reader) {
+	bd.Height, bd.RootHash, bd.Trans = r.Int(), r.Bytes(), r.Strings()
+}
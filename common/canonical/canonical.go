@@ -0,0 +1,198 @@
+package canonical
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// the domain-separation tags, every signed or hashed object starts with the tag of its kind,
+// so that the bytes of two different kinds of objects never collide
+// note: the votes and the QC combined from them are the same kind, because the QC is verified by the bytes signed by the votes
+const (
+	TAG_BLOCK_HEADER = "dcschain/blockchain/header/v1" // the block header hash
+	TAG_BLOCK_DATA   = "dcschain/blockchain/data/v1"   // the block data hash
+
+	TAG_HOTSTUFF_VOTE     = "dcschain/hotstuff/basic/vote/v1"   // the basic hotstuff message and QC
+	TAG_CHAINED_VOTE      = "dcschain/hotstuff/chained/vote/v1" // the chained hotstuff message and QC
+	TAG_HOTSTUFF_PROPOSAL = "dcschain/hotstuff/proposal/v1"     // the proposal hash of basic and chained hotstuff
+
+	TAG_HOTSTUFF2_VOTE     = "dcschain/hotstuff2/vote/v1"     // the hotstuff-2 message and QC
+	TAG_HOTSTUFF2_PROPOSAL = "dcschain/hotstuff2/proposal/v1" // the proposal hash of hotstuff-2
+
+	TAG_FAST_HOTSTUFF_VOTE    = "dcschain/fasthotstuff/vote/v1"    // the fast-hotstuff vote and QC
+	TAG_FAST_HOTSTUFF_TIMEOUT = "dcschain/fasthotstuff/timeout/v1" // the fast-hotstuff timeout message and the aggregated QC of them
+
+	TAG_BULLSHARK_BATCH  = "dcschain/bullshark/batch/v1"  // the batch digest of bullshark
+	TAG_BULLSHARK_ACK    = "dcschain/bullshark/ack/v1"    // the bullshark batch acknowledgement and the availability certificate of the batch
+	TAG_BULLSHARK_HEADER = "dcschain/bullshark/header/v1" // the header digest of bullshark, which is the digest of its certificate
+	TAG_BULLSHARK_VOTE   = "dcschain/bullshark/vote/v1"   // the bullshark header vote and the certificate of the header
+	TAG_BULLSHARK_BLOCK  = "dcschain/bullshark/block/v1"  // the bullshark signature of the ordered block and the validation of the block
+
+	TAG_PBFT_DIGEST      = "dcschain/pbft/digest/v1"      // the pbft message without the sender, such as pre-prepare
+	TAG_PBFT_SIGNED      = "dcschain/pbft/signed/v1"      // the pbft message with the sender, such as prepare, commit and checkpoint
+	TAG_PBFT_VIEW_CHANGE = "dcschain/pbft/view-change/v1" // the pbft view-change message with the checkpoints and prepared sets
+	TAG_PBFT_NEW_VIEW    = "dcschain/pbft/new-view/v1"    // the pbft new-view message with the view-change and pre-prepare sets
+	TAG_PBFT_HEADER      = "dcschain/pbft/header/v1"      // the pbft message type and view number only
+	TAG_PBFT_PM          = "dcschain/pbft/pm/v1"          // the pre-prepare message and its prepare messages in the view-change message
+)
+
+// Encoder: the canonical binary encoder of the signed and hashed bytes
+// - the tag is written first as a length-prefixed string
+// - the integers are fixed-width big-endian, int is written as int64
+// - the byte slices and strings are prefixed with their uint32 length
+// - the lists are prefixed with their uint32 count, and each item is length-prefixed
+// so the encoding is injective, two different objects of the same kind never get the same bytes
+type Encoder struct {
+	buf []byte
+}
+
+// NewEncoder: create an encoder of the objects of the kind
+// params:
+// - tag: the domain-separation tag of the kind
+func NewEncoder(tag string) *Encoder {
+	e := &Encoder{buf: make([]byte, 0, 64)}
+	return e.String(tag)
+}
+
+// Uint8: write a byte, such as the message type
+func (e *Encoder) Uint8(v uint8) *Encoder {
+	e.buf = append(e.buf, v)
+	return e
+}
+
+// Uint64: write an 8-byte big-endian unsigned integer
+func (e *Encoder) Uint64(v uint64) *Encoder {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+	return e
+}
+
+// Int64: write an 8-byte big-endian integer
+func (e *Encoder) Int64(v int64) *Encoder {
+	return e.Uint64(uint64(v))
+}
+
+// Int: write an int as an 8-byte big-endian integer, such as the view number and the height
+func (e *Encoder) Int(v int) *Encoder {
+	return e.Int64(int64(v))
+}
+
+// Bytes: write the uint32 length and the content of byte slice, nil and empty slices are the same
+func (e *Encoder) Bytes(b []byte) *Encoder {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(b)))
+	e.buf = append(e.buf, b...)
+	return e
+}
+
+// String: write the uint32 length and the content of string
+func (e *Encoder) String(s string) *Encoder {
+	return e.Bytes([]byte(s))
+}
+
+// BytesList: write the uint32 count and each length-prefixed byte slice
+func (e *Encoder) BytesList(bs [][]byte) *Encoder {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(bs)))
+	for _, b := range bs {
+		e.Bytes(b)
+	}
+	return e
+}
+
+// Strings: write the uint32 count and each length-prefixed string
+func (e *Encoder) Strings(ss []string) *Encoder {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(ss)))
+	for _, s := range ss {
+		e.String(s)
+	}
+	return e
+}
+
+// Encoded: get the encoded bytes
+func (e *Encoder) Encoded() []byte {
+	return e.buf
+}
+
+// Decoder: the decoder of the canonical bytes, which reads the fields in the order they are written by the Encoder,
+// such as to get the block hash from the message signed by the validation of block
+// note: the first error is kept and the later reads return the zero values, so it is checked once by Finish
+type Decoder struct {
+	buf []byte
+	err error
+}
+
+// NewDecoder: create a decoder of the encoded object of the kind
+// params:
+// - tag: the domain-separation tag of the kind, the bytes of the other kinds fail to decode
+// - b:   the encoded bytes
+func NewDecoder(tag string, b []byte) *Decoder {
+	d := &Decoder{buf: b}
+	if got := d.String(); d.err == nil && got != tag {
+		d.err = errors.New("canonical: the tag " + got + " is mismatched")
+	}
+	return d
+}
+
+// next: read the next n bytes
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errors.New("canonical: unexpected end of bytes")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// Uint8: read a byte
+func (d *Decoder) Uint8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// Uint64: read an 8-byte big-endian unsigned integer
+func (d *Decoder) Uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// Int64: read an 8-byte big-endian integer
+func (d *Decoder) Int64() int64 {
+	return int64(d.Uint64())
+}
+
+// Int: read an int written as an 8-byte big-endian integer
+func (d *Decoder) Int() int {
+	return int(d.Int64())
+}
+
+// Bytes: read a length-prefixed byte slice, the empty slice is read as nil
+func (d *Decoder) Bytes() []byte {
+	b := d.next(4)
+	if b == nil {
+		return nil
+	}
+	content := d.next(int(binary.BigEndian.Uint32(b)))
+	if len(content) == 0 {
+		return nil
+	}
+	return append([]byte(nil), content...)
+}
+
+// String: read a length-prefixed string
+func (d *Decoder) String() string {
+	return string(d.Bytes())
+}
+
+// Finish: get the error of decoding, the bytes left after the last field are an error as well
+func (d *Decoder) Finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = errors.New("canonical: trailing bytes")
+	}
+	return d.err
+}
@@ -0,0 +1,80 @@
+package canonical_test
+
+import (
+	"bytes"
+	"canonical"
+	"encoding/hex"
+	"testing"
+)
+
+// TestEncoder: test the golden vectors of the canonical encoding, the signed bytes of stored blocks and messages depend on them,
+// so they must never change
+func TestEncoder(t *testing.T) {
+	cases := []struct {
+		name string
+		enc  *canonical.Encoder
+		want string
+	}{
+		{"tag", canonical.NewEncoder("t"), "0000000174"},
+		{"uint8", canonical.NewEncoder("t").Uint8(7), "000000017407"},
+		{"int", canonical.NewEncoder("t").Int(256), "00000001740000000000000100"},
+		{"negative", canonical.NewEncoder("t").Int64(-1), "0000000174ffffffffffffffff"},
+		{"bytes", canonical.NewEncoder("t").Bytes([]byte{0xab, 0xcd}).Bytes(nil), "000000017400000002abcd00000000"},
+		{"list", canonical.NewEncoder("t").BytesList([][]byte{{1}, {}}).Strings([]string{"ab"}), "00000001740000000200000001010000000000000001000000026162"},
+	}
+	for _, c := range cases {
+		want, err := hex.DecodeString(c.want)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if !bytes.Equal(c.enc.Encoded(), want) {
+			t.Fatalf("%s: expected %x, got %x", c.name, want, c.enc.Encoded())
+		}
+	}
+}
+
+// TestNoCollision: test the values which collide in the byte-truncated encoding get different bytes
+func TestNoCollision(t *testing.T) {
+	// the view numbers wrap every 256 when they are truncated to a byte
+	if bytes.Equal(canonical.NewEncoder("t").Int(1).Encoded(), canonical.NewEncoder("t").Int(257).Encoded()) {
+		t.Fatal("view number collision")
+	}
+
+	// the boundary between two byte slices is kept by the length prefix
+	a := canonical.NewEncoder("t").Bytes([]byte("ab")).Bytes([]byte("c")).Encoded()
+	b := canonical.NewEncoder("t").Bytes([]byte("a")).Bytes([]byte("bc")).Encoded()
+	if bytes.Equal(a, b) {
+		t.Fatal("byte slice boundary collision")
+	}
+
+	// the same fields of different kinds are separated by the tag
+	a = canonical.NewEncoder(canonical.TAG_HOTSTUFF_VOTE).Uint8(1).Int(1).Encoded()
+	b = canonical.NewEncoder(canonical.TAG_HOTSTUFF2_VOTE).Uint8(1).Int(1).Encoded()
+	if bytes.Equal(a, b) {
+		t.Fatal("domain collision")
+	}
+}
+
+// TestDecoder: test the decoder reads the fields written by the encoder, and fails on the bytes of another kind,
+// the truncated bytes and the trailing bytes
+func TestDecoder(t *testing.T) {
+	encoded := canonical.NewEncoder("t").Uint8(7).Int(-2).Bytes([]byte{0xab}).Bytes(nil).Encoded()
+	d := canonical.NewDecoder("t", encoded)
+	if d.Uint8() != 7 || d.Int() != -2 || !bytes.Equal(d.Bytes(), []byte{0xab}) || d.Bytes() != nil || d.Finish() != nil {
+		t.Fatal("decode error")
+	}
+
+	if canonical.NewDecoder("u", encoded).Finish() == nil {
+		t.Fatal("the bytes of another kind are decoded")
+	}
+	d = canonical.NewDecoder("t", encoded[:len(encoded)-1])
+	d.Uint8()
+	d.Int()
+	d.Bytes()
+	if d.Bytes(); d.Finish() == nil {
+		t.Fatal("the truncated bytes are decoded")
+	}
+	if d = canonical.NewDecoder("t", encoded); d.Uint8() != 7 || d.Finish() == nil {
+		t.Fatal("the trailing bytes are decoded")
+	}
+}
@@ -4,20 +4,120 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"strconv"
 )
 
 // BatchSize is default size
 const BatchSize = 128
 
+// MempoolSize: the default max number of requests kept in the mempool of each replica
+const MempoolSize = 10000
+
+// the default storage config, see blockchain.StorageOptions
+const (
+	Storage     = "file"   // the storage engine of blocks, "file" or "segment"
+	SegmentSize = 64 << 20 // the max bytes of a segment
+	SyncPolicy  = "always" // the fsync policy of segment storage, "always", "batch" or "none"
+	SyncBatch   = 64       // the number of blocks between two fsync with "batch" policy
+)
+
+// the default transport config
+const (
+	Transport = "channel" // the transport between replicas, "channel" or "tcp"
+	PeerPort  = 21000     // the first port of replicas on localhost for tcp transport, r_i listens on PeerPort+i
+	Codec     = "binary"  // the encoding of the messages between replicas, "binary" or "json"
+)
+
+// LeaderElection: the default policy to elect the leader of each view, "round-robin", "reputation" or "hash"
+const LeaderElection = "round-robin"
+
+// PipelineWindow: the default max number of proposals in flight, the proposals are not pipelined
+const PipelineWindow = 1
+
+// NodeManager: the default node manager, which applies the joins and exits of any operator
+const NodeManager = "basic"
+
+// TimeoutMultiplier: the default multiplier of view timeout on each consecutive expiry,
+// the zero timeouts of the pacemaker config take the defaults of each protocol
+const TimeoutMultiplier = 2.0
+
 // Config: the config of system
 type Config struct {
-	BatchSize int    `json:"batchSize"`
-	Payload   string `json:"payload"`
+	BatchSize   int    `json:"batchSize"`
+	MempoolSize int    `json:"mempoolSize"` // the max number of requests kept in the mempool
+	Payload     string `json:"payload"`
+
+	Storage     string `json:"storage"`     // the storage engine of blocks
+	SegmentSize int64  `json:"segmentSize"` // the max bytes of a segment, only for segment storage
+	SyncPolicy  string `json:"syncPolicy"`  // the fsync policy, only for segment storage
+	SyncBatch   int    `json:"syncBatch"`   // the number of blocks between two fsync with batch policy
+
+	Recover bool `json:"recover"` // restart from the local data instead of clearing it
+
+	Transport string            `json:"transport"`         // the transport between replicas
+	Peers     map[string]string `json:"peers,omitempty"`   // the addresses of replicas for tcp transport, such as "r_0": "127.0.0.1:21000"
+	Codec     string            `json:"codec"`             // the preferred encoding of the messages between replicas, json is readable for debugging
+	TLSCert   string            `json:"tlsCert,omitempty"` // the certificate of the replica for tcp transport, the connections are plain TCP if it is empty
+	TLSKey    string            `json:"tlsKey,omitempty"`  // the private key of the certificate
+	TLSCA     string            `json:"tlsCA,omitempty"`   // the certificate of the cluster CA which signs the certificates of all replicas
+
+	BaseTimeout       int     `json:"baseTimeout"`       // the view timeout without backoff in milliseconds, 0 is the default of the protocol
+	TimeoutMultiplier float64 `json:"timeoutMultiplier"` // the view timeout is multiplied by it on each consecutive expiry
+	MaxTimeout        int     `json:"maxTimeout"`        // the cap of view timeout in milliseconds, 0 is 32 times the base timeout
+	MinTimeout        int     `json:"minTimeout"`        // the floor of view timeout in adaptive mode in milliseconds, 0 is 100ms
+	AdaptiveTimeout   bool    `json:"adaptiveTimeout"`   // set the view timeout by the observed commit latency
+
+	LeaderElection string `json:"leaderElection"` // the policy to elect the leader of each view
+	PipelineWindow int    `json:"pipelineWindow"` // the max number of proposals in flight of basic hotstuff and PBFT, at most the max window of the protocol
+
+	Coordinator      int        `json:"coordinator"`                // the interval in milliseconds to retune the system by the DCS strategy coordinator, 0 disables it
+	DcsTarget        [3]float64 `json:"dcsTarget"`                  // the target weighting of decentralization, consistency and scalability, equal if all are 0
+	DcsFastProtocol  string     `json:"dcsFastProtocol,omitempty"`  // the protocol switched to for consistency, never switched if it is empty
+	DcsScaleProtocol string     `json:"dcsScaleProtocol,omitempty"` // the protocol switched to for scalability, never switched if it is empty
+	DcsCandidates    []string   `json:"dcsCandidates,omitempty"`    // the nodes which may be admitted for decentralization in order
+	Admission        bool       `json:"admission"`                  // the node can join only after it is admitted by a committed reconfiguration
+	RotateKey        bool       `json:"rotateKey"`                  // the nodes generate a new group key when the nodes join or exit instead of resharing the current one
+
+	OperatorKey     []byte `json:"operatorKey,omitempty"`    // the SM2 public key of the operator, the default client whose reconfigurations are accepted, no operator if it is empty
+	NodeManager     string `json:"nodeManager"`              // the node manager of the replica started by its config, "basic", "bftsmart" or "basedhistory"
+	ViewManager     string `json:"viewManager"`              // the client id of the view manager of the bftsmart node manager, no join or exit is applied if it is empty
+	ViewManagerKey  []byte `json:"viewManagerKey,omitempty"` // the SM2 public key of the view manager, which is an operator, empty if it is the default client
+	HistoryInterval int    `json:"historyInterval"`          // the interval in milliseconds to evict the inactive nodes by the basedhistory node manager, 0 disables it
+	HistoryWindow   int    `json:"historyWindow"`            // the number of the latest consensus messages which the participation is measured in, 0 is the default
+}
+
+// DefaultConfig: get the config with default values
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:   BatchSize,
+		MempoolSize: MempoolSize,
+		Storage:     Storage,
+		SegmentSize: SegmentSize,
+		SyncPolicy:  SyncPolicy,
+		SyncBatch:   SyncBatch,
+		Transport:   Transport,
+		Codec:       Codec,
+
+		TimeoutMultiplier: TimeoutMultiplier,
+		LeaderElection:    LeaderElection,
+		PipelineWindow:    PipelineWindow,
+		NodeManager:       NodeManager,
+	}
+}
+
+// LocalPeers: get the addresses of nodeNum replicas on localhost
+func LocalPeers(nodeNum int) map[string]string {
+	peers := make(map[string]string)
+	for i := 0; i < nodeNum; i++ {
+		peers["r_"+strconv.Itoa(i)] = "127.0.0.1:" + strconv.Itoa(PeerPort+i)
+	}
+	return peers
 }
 
 // ReadConfig: read config file
+// the missing fields are filled with default values
 func ReadConfig(filename string) (Config, error) {
-	var config Config
+	config := DefaultConfig()
 
 	// open config file
 	file, err := os.Open(filename)
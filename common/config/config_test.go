@@ -7,7 +7,7 @@ import (
 )
 
 func TestConfig(t *testing.T) {
-	conf := config.Config{1, "2"}
+	conf := config.Config{BatchSize: 1, Payload: "2", Storage: "segment"}
 	config.WriteConfig("testconfig.config", conf)
 
 	conf2, err := config.ReadConfig("testconfig.config")
@@ -16,4 +16,29 @@ func TestConfig(t *testing.T) {
 	}
 	fmt.Println(conf2.BatchSize)
 	fmt.Println(conf2.Payload)
+	fmt.Println(conf2.Storage, conf2.SegmentSize, conf2.SyncPolicy)
+}
+
+// TestNodeConfig: test the node config keeps the cluster and the embedded system config
+func TestNodeConfig(t *testing.T) {
+	nc := config.DefaultNodeConfig()
+	nc.ID = 1
+	nc.BatchSize = 16
+	nc.Cluster = []config.PeerConfig{
+		{Name: "r_0", Addr: "127.0.0.1:21000", PubKey: []byte{1, 2}},
+		{Name: "r_1", Addr: "127.0.0.1:21001", PubKey: []byte{3, 4}},
+	}
+	filename := t.TempDir() + "/r_1.json"
+	if err := config.WriteNodeConfig(filename, nc); err != nil {
+		t.Fatal(err)
+	}
+
+	nc2, err := config.ReadNodeConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc2.Name() != "r_1" || nc2.BatchSize != 16 || nc2.Transport != "tcp" || nc2.Peers["r_0"] != "127.0.0.1:21000" {
+		t.Fatal("wrong node config", nc2)
+	}
+	fmt.Println(nc2.Name(), nc2.Peers, nc2.Cluster[1].PubKey)
 }
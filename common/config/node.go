@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+)
+
+// PeerConfig: the information of a replica in the cluster
+type PeerConfig struct {
+	Name      string `json:"name"`                // the name of replica, such as "r_0"
+	Addr      string `json:"addr"`                // the address of replica for the transport between replicas
+	PubKey    []byte `json:"pubKey"`              // the SM2 public key of replica, which is used to verify the server messages
+	DkgPubKey []byte `json:"dkgPubKey,omitempty"` // the public key of the distributed key generation of replica, which is derived from its SM2 key
+}
+
+// NodeConfig: the config of a single replica, which is started as its own process
+// the system config is embedded, so the batch size, the storage and so on are given in the same file
+type NodeConfig struct {
+	ID         int          `json:"id"`                 // the id of replica, the name is "r_<id>"
+	Protocol   string       `json:"protocol"`           // the consensus protocol, "bh", "ch", "h2", "fh", "bs" or "pbft"
+	Path       string       `json:"path"`               // the path of block storage
+	KeyFile    string       `json:"keyFile"`            // the file of the SM2 private key of replica
+	SignerFile string       `json:"signerFile"`         // the file of the consensus signer, the threshold signer or the SM2 signer for pbft
+	Listen     string       `json:"listen"`             // the address listened for the client commands
+	ClientAddr string       `json:"clientAddr"`         // the address of client to send the replies
+	Operator   string       `json:"operator,omitempty"` // the directory of the key files of the operator, only on the replica signing the console requests and the reconfigurations
+	Cluster    []PeerConfig `json:"cluster"`            // all replicas in the cluster include itself
+
+	Config
+}
+
+// DefaultNodeConfig: get the node config with default values
+func DefaultNodeConfig() NodeConfig {
+	conf := DefaultConfig()
+	conf.Transport = "tcp"
+	return NodeConfig{
+		Protocol:   "bh",
+		Path:       "./BCData",
+		ClientAddr: "127.0.0.1:30000",
+		Config:     conf,
+	}
+}
+
+// Name: get the name of replica
+func (nc *NodeConfig) Name() string {
+	return "r_" + strconv.Itoa(nc.ID)
+}
+
+// PeerAddrs: get the addresses of all replicas in the cluster
+func (nc *NodeConfig) PeerAddrs() map[string]string {
+	peers := make(map[string]string)
+	for _, p := range nc.Cluster {
+		peers[p.Name] = p.Addr
+	}
+	return peers
+}
+
+// ReadNodeConfig: read the node config file
+// the missing fields are filled with default values
+func ReadNodeConfig(filename string) (NodeConfig, error) {
+	conf := DefaultNodeConfig()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return conf, err
+	}
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return conf, err
+	}
+
+	// the addresses of the cluster are used by the transport
+	conf.Peers = conf.PeerAddrs()
+	return conf, nil
+}
+
+// WriteNodeConfig: write the node config file
+func WriteNodeConfig(filename string, conf NodeConfig) error {
+	data, err := json.MarshalIndent(conf, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
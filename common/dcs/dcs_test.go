@@ -4,6 +4,7 @@ import (
 	"deltachain/common/dcs"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestDCS(t *testing.T) {
@@ -16,3 +17,43 @@ func TestDCS(t *testing.T) {
 	fmt.Println(dcs.GetConsistency(l))
 	fmt.Println(dcs.GetScalability(th))
 }
+
+// TestStrategy: test the strategy improves the dimension which falls shortest of the target by one step
+func TestStrategy(t *testing.T) {
+	// the shares of the point are about 0.34, 0.39 and 0.27
+	m := dcs.Metrics{Nodes: 4, Latency: 0.131, Throughput: 300}
+	k := dcs.Knobs{BatchSize: 128, Timeout: time.Second, Protocol: "bh", Nodes: []string{"r_0", "r_1", "r_2", "r_3"}}
+	fmt.Println(dcs.Measure(m), dcs.Deficit(dcs.Measure(m), dcs.Weights{}))
+
+	s := dcs.NewStrategy(dcs.Weights{D: 1, C: 1, S: 3})
+	if actions := s.Decide(m, k); len(actions) != 1 || actions[0].BatchSize != 256 {
+		t.Fatal("batch size is not doubled for scalability", actions)
+	}
+	s.Target = dcs.Weights{D: 1, C: 8, S: 1}
+	if actions := s.Decide(m, k); len(actions) != 1 || actions[0].BatchSize != 64 {
+		t.Fatal("batch size is not halved for consistency", actions)
+	}
+	s.FastProtocol = "h2"
+	k.BatchSize = s.MinBatch
+	if actions := s.Decide(m, k); len(actions) != 1 || actions[0].Protocol != "h2" {
+		t.Fatal("protocol is not switched for consistency", actions)
+	}
+	s.Target = dcs.Weights{D: 8, C: 1, S: 1}
+	s.Candidates = []string{"r_3", "r_4", "r_5"}
+	if actions := s.Decide(m, k); len(actions) != 1 || actions[0].Admit != "r_4" {
+		t.Fatal("candidate is not admitted for decentralization", actions)
+	}
+
+	// the system at the target is not reconfigured unless the timeout is far from the latency
+	s.Target = dcs.Weights{D: 0.34, C: 0.39, S: 0.27}
+	if actions := s.Decide(m, k); actions != nil {
+		t.Fatal("system at the target is reconfigured", actions)
+	}
+	k.Timeout = 10 * time.Second
+	if actions := s.Decide(m, k); len(actions) != 1 || actions[0].Timeout != time.Duration(8*0.131*float64(time.Second)) {
+		t.Fatal("timeout is not retuned", actions)
+	}
+	if actions := s.Decide(dcs.Metrics{Nodes: 4}, k); actions != nil {
+		t.Fatal("system is reconfigured without measurement", actions)
+	}
+}
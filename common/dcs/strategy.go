@@ -0,0 +1,186 @@
+package dcs
+
+import (
+	"math"
+	"time"
+)
+
+// the default bounds of strategy
+const (
+	Tolerance   = 0.05                   // the max deficit of a dimension which is kept without reconfiguration
+	MinBatch    = 16                     // the min batch size
+	MaxBatch    = 4096                   // the max batch size
+	TimeoutGain = 8                      // the base view timeout is retuned to TimeoutGain times the commit latency
+	MinTimeout  = 500 * time.Millisecond // the min base view timeout
+	MaxTimeout  = 10 * time.Second       // the max base view timeout
+)
+
+// Weights: the target weighting of decentralization, consistency and scalability, which is the target point on the DCS triangle
+type Weights struct {
+	D float64 `json:"d"`
+	C float64 `json:"c"`
+	S float64 `json:"s"`
+}
+
+// Normalize: scale the weights to sum 1, the negative weights are taken as 0, and the weights are equal if none is positive
+func (w Weights) Normalize() Weights {
+	w.D, w.C, w.S = math.Max(w.D, 0), math.Max(w.C, 0), math.Max(w.S, 0)
+	sum := w.D + w.C + w.S
+	if sum == 0 {
+		return Weights{D: 1.0 / 3, C: 1.0 / 3, S: 1.0 / 3}
+	}
+	return Weights{D: w.D / sum, C: w.C / sum, S: w.S / sum}
+}
+
+// Metrics: the measurement of the running system
+type Metrics struct {
+	Nodes      int     // the number of nodes in system
+	Latency    float64 // the commit latency, U. second
+	Throughput float64 // the committed requests per second
+}
+
+// Point: the decentralization, consistency and scalability of the system
+type Point struct {
+	D float64
+	C float64
+	S float64
+}
+
+// Measure: score the system on the DCS triangle, each score is in [0, 1]
+// params:
+// - m: the measurement of the system
+func Measure(m Metrics) Point {
+	d, c, s := GetDCS(m.Nodes, m.Latency, m.Throughput)
+	return Point{D: clamp(d), C: clamp(c), S: clamp(s)}
+}
+
+// clamp: clamp the score to [0, 1], the scalability of the throughput under 10 is negative
+func clamp(score float64) float64 {
+	return math.Min(math.Max(score, 0), 1)
+}
+
+// Deficit: get how much each dimension falls short of the target weighting,
+// which is the target weight minus the share of the score, the negative one means the dimension exceeds the target
+// params:
+// - p:      the point of the system
+// - target: the target weighting
+func Deficit(p Point, target Weights) Point {
+	target = target.Normalize()
+	sum := p.D + p.C + p.S
+	if sum == 0 {
+		return Point{D: target.D, C: target.C, S: target.S}
+	}
+	return Point{D: target.D - p.D/sum, C: target.C - p.C/sum, S: target.S - p.S/sum}
+}
+
+// Knobs: the tunable parameters of the running system
+type Knobs struct {
+	BatchSize int           // the number of requests within a block
+	Timeout   time.Duration // the base view timeout
+	Protocol  string        // the consensus protocol
+	Nodes     []string      // the names of nodes in system
+}
+
+// Action: the reconfiguration proposed by the strategy, only one of the fields is set
+type Action struct {
+	BatchSize int           // set the batch size
+	Timeout   time.Duration // set the base view timeout
+	Protocol  string        // switch the consensus protocol
+	Admit     string        // admit the node to join the system
+}
+
+// Strategy: the strategy which moves the system toward the target point on the DCS triangle
+// the dimension which falls shortest of the target is improved by one step in each decision:
+// - decentralization: admit the next candidate node
+// - consistency: halve the batch size, or switch to the protocol with low latency if the batch can't shrink
+// - scalability: double the batch size, or switch to the protocol with high throughput if the batch can't grow
+// and the base view timeout follows the commit latency, so that a failed leader is replaced in time
+type Strategy struct {
+	Target        Weights       // the target weighting
+	Tolerance     float64       // the max deficit of a dimension which is kept without reconfiguration
+	MinBatch      int           // the min batch size
+	MaxBatch      int           // the max batch size
+	TimeoutGain   float64       // the base view timeout is retuned to TimeoutGain times the commit latency, 0 never retunes it
+	MinTimeout    time.Duration // the min base view timeout
+	MaxTimeout    time.Duration // the max base view timeout
+	FastProtocol  string        // the protocol switched to for consistency, never switched if it is empty
+	ScaleProtocol string        // the protocol switched to for scalability, never switched if it is empty
+	Candidates    []string      // the nodes which may be admitted for decentralization in order
+}
+
+// NewStrategy: create the strategy with the default bounds, which never switches the protocol or admits nodes
+// params:
+// - target: the target weighting
+func NewStrategy(target Weights) Strategy {
+	return Strategy{
+		Target:      target,
+		Tolerance:   Tolerance,
+		MinBatch:    MinBatch,
+		MaxBatch:    MaxBatch,
+		TimeoutGain: TimeoutGain,
+		MinTimeout:  MinTimeout,
+		MaxTimeout:  MaxTimeout,
+	}
+}
+
+// Decide: propose the reconfigurations to move the system toward the target
+// note: the actions set the values instead of changing them, so the same action proposed twice is harmless
+// params:
+// - m: the measurement of the system
+// - k: the current parameters of the system
+// return:
+// - the actions, nil if nothing is measured or the system is at the target
+func (s Strategy) Decide(m Metrics, k Knobs) []Action {
+	if m.Latency <= 0 || m.Throughput <= 0 {
+		return nil
+	}
+	actions := make([]Action, 0)
+
+	// the timeout is retuned if it is more than twice as long or short as the expected one
+	if s.TimeoutGain > 0 {
+		timeout := time.Duration(s.TimeoutGain * m.Latency * float64(time.Second))
+		timeout = max(min(timeout, s.MaxTimeout), s.MinTimeout)
+		if k.Timeout > 2*timeout || 2*k.Timeout < timeout {
+			actions = append(actions, Action{Timeout: timeout})
+		}
+	}
+
+	deficit := Deficit(Measure(m), s.Target)
+	switch {
+	case deficit.D >= deficit.C && deficit.D >= deficit.S && deficit.D > s.Tolerance:
+		if node := s.nextCandidate(k.Nodes); node != "" {
+			actions = append(actions, Action{Admit: node})
+		}
+	case deficit.C >= deficit.S && deficit.C > s.Tolerance:
+		if k.BatchSize > s.MinBatch {
+			actions = append(actions, Action{BatchSize: max(k.BatchSize/2, s.MinBatch)})
+		} else if s.FastProtocol != "" && k.Protocol != s.FastProtocol {
+			actions = append(actions, Action{Protocol: s.FastProtocol})
+		}
+	case deficit.S > s.Tolerance:
+		if k.BatchSize < s.MaxBatch {
+			actions = append(actions, Action{BatchSize: min(k.BatchSize*2, s.MaxBatch)})
+		} else if s.ScaleProtocol != "" && k.Protocol != s.ScaleProtocol {
+			actions = append(actions, Action{Protocol: s.ScaleProtocol})
+		}
+	}
+
+	if len(actions) == 0 {
+		return nil
+	}
+	return actions
+}
+
+// nextCandidate: get the first candidate which is not in system, empty if all of them have joined
+func (s Strategy) nextCandidate(nodes []string) string {
+	joined := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		joined[node] = true
+	}
+	for _, node := range s.Candidates {
+		if !joined[node] {
+			return node
+		}
+	}
+	return ""
+}
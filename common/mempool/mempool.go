@@ -0,0 +1,226 @@
+package mempool
+
+import (
+	"bcrequest"
+	"config"
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PENDING_TIMEOUT: the default time a pulled request waits for commit, it is pulled again after that
+const PENDING_TIMEOUT = 5 * time.Second
+
+// the priorities of requests, the one with higher priority is pulled first and the ones with the same priority are pulled by arrival
+const (
+	PRIORITY_NORMAL = 0
+	PRIORITY_HIGH   = 1 // the commands of the client registry
+)
+
+var (
+	ErrPoolFull  = errors.New("mempool is full")
+	ErrDuplicate = errors.New("request is already in mempool")
+)
+
+// entry: the request in the mempool
+type entry struct {
+	req      bcrequest.BCRequest
+	hash     string
+	priority int
+	arrival  uint64    // the arrival order
+	index    int       // the index in the queue, -1 if it has been pulled
+	pulled   time.Time // the time it is pulled
+}
+
+// queue: the requests waiting to be pulled, which is a heap ordered by priority and arrival
+type queue []*entry
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].arrival < q[j].arrival
+}
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *queue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Mempool: the requests recieved by the replica and not committed yet
+// the requests are deduplicated by hash, and kept until they are committed in any block,
+// the pulled ones wait for commit and are pulled again if they are not committed in time
+type Mempool struct {
+	entries map[string]*entry // all requests in the mempool by hash, including the pulled ones
+	queue   queue             // the requests waiting to be pulled
+	size    int               // the max number of requests
+	timeout time.Duration     // the time a pulled request waits for commit
+	arrival uint64
+	lock    sync.Mutex
+}
+
+// NewMempool: create an empty mempool
+// params:
+// - size: the max number of requests, config.MempoolSize is used if it is not positive
+func NewMempool(size int) *Mempool {
+	if size <= 0 {
+		size = config.MempoolSize
+	}
+	return &Mempool{
+		entries: make(map[string]*entry),
+		queue:   make(queue, 0),
+		size:    size,
+		timeout: PENDING_TIMEOUT,
+	}
+}
+
+// SetPendingTimeout: set the time a pulled request waits for commit
+func (mp *Mempool) SetPendingTimeout(timeout time.Duration) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	mp.timeout = timeout
+}
+
+// Priority: get the priority of request, the commands of the client registry are pulled first
+func Priority(req *bcrequest.BCRequest) int {
+	if bcrequest.IsClientCmd(req.Cmd) {
+		return PRIORITY_HIGH
+	}
+	return PRIORITY_NORMAL
+}
+
+// Add: add the request to the mempool
+// params:
+// - req:      the request
+// - priority: the priority of request
+// return:
+// - ErrDuplicate if the request is in the mempool, ErrPoolFull if the mempool is full
+func (mp *Mempool) Add(req bcrequest.BCRequest, priority int) error {
+	hash := req.Hash()
+
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	if _, ok := mp.entries[hash]; ok {
+		return ErrDuplicate
+	}
+	if len(mp.entries) >= mp.size {
+		return ErrPoolFull
+	}
+	mp.arrival++
+	e := &entry{
+		req:      req,
+		hash:     hash,
+		priority: priority,
+		arrival:  mp.arrival,
+	}
+	mp.entries[hash] = e
+	heap.Push(&mp.queue, e)
+	return nil
+}
+
+// Pull: take the requests to propose, the pulled requests are kept until they are committed or removed
+// params:
+// - n: the max number of requests
+// return:
+// - the requests by priority and arrival
+func (mp *Mempool) Pull(n int) []bcrequest.BCRequest {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	// the requests which are not committed in time are pulled again
+	now := time.Now()
+	for _, e := range mp.entries {
+		if e.index < 0 && now.Sub(e.pulled) > mp.timeout {
+			heap.Push(&mp.queue, e)
+		}
+	}
+
+	reqs := make([]bcrequest.BCRequest, 0)
+	for len(reqs) < n && mp.queue.Len() > 0 {
+		e := heap.Pop(&mp.queue).(*entry)
+		e.pulled = now
+		reqs = append(reqs, e.req)
+	}
+	return reqs
+}
+
+// Requeue: put the pulled requests back to be pulled at once, such as the proposals in flight are abandoned
+// as the consensus is switched, the requests are pulled by priority and arrival again
+func (mp *Mempool) Requeue() {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	for _, e := range mp.entries {
+		if e.index < 0 {
+			heap.Push(&mp.queue, e)
+		}
+	}
+}
+
+// Remove: remove the requests from the mempool, such as the invalid ones
+func (mp *Mempool) Remove(reqs []bcrequest.BCRequest) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	for i := range reqs {
+		mp.remove(reqs[i].Hash())
+	}
+}
+
+// Evict: remove the requests committed in a block
+// params:
+// - txs: the transactions of the committed block
+func (mp *Mempool) Evict(txs []string) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	for _, tx := range txs {
+		req, err := bcrequest.DecodeTx([]byte(tx))
+		if err != nil {
+			continue
+		}
+		mp.remove(req.Hash())
+	}
+}
+
+// remove: remove the request by hash, the lock must be held by the caller
+func (mp *Mempool) remove(hash string) {
+	e, ok := mp.entries[hash]
+	if !ok {
+		return
+	}
+	if e.index >= 0 {
+		heap.Remove(&mp.queue, e.index)
+	}
+	delete(mp.entries, hash)
+}
+
+// Len: get the number of requests in the mempool, including the pulled ones
+func (mp *Mempool) Len() int {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	return len(mp.entries)
+}
+
+// Queued: get the number of requests waiting to be pulled
+func (mp *Mempool) Queued() int {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	return mp.queue.Len()
+}
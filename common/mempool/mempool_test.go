@@ -0,0 +1,83 @@
+package mempool_test
+
+import (
+	"bcrequest"
+	"mempool"
+	"testing"
+	"time"
+)
+
+// newReq: generate a request of the default client, the signature is not checked by the mempool
+func newReq(seq uint64, cmd []byte) bcrequest.BCRequest {
+	return bcrequest.BCRequest{Id: "c_0", Seq: seq, Cmd: cmd}
+}
+
+// TestMempool: test the mempool deduplicates the requests, rejects the requests when it is full,
+// pulls the requests by priority and arrival, and evicts the committed ones
+func TestMempool(t *testing.T) {
+	mp := mempool.NewMempool(3)
+
+	a := newReq(1, []byte("put a 1"))
+	b := newReq(2, []byte("put b 1"))
+	reg := newReq(3, bcrequest.RevokeCmd())
+	if mp.Add(a, mempool.Priority(&a)) != nil || mp.Add(b, mempool.Priority(&b)) != nil {
+		t.Fatal("request is rejected")
+	}
+
+	// the same request signed again is a duplicate
+	dup := a
+	dup.Sign = []byte("another signature")
+	if err := mp.Add(dup, mempool.PRIORITY_NORMAL); err != mempool.ErrDuplicate {
+		t.Fatal("duplicate request is accepted", err)
+	}
+	if mp.Add(reg, mempool.Priority(&reg)) != nil {
+		t.Fatal("request is rejected")
+	}
+	c := newReq(4, []byte("put c 1"))
+	if err := mp.Add(c, mempool.PRIORITY_NORMAL); err != mempool.ErrPoolFull {
+		t.Fatal("request is accepted by the full mempool", err)
+	}
+
+	// the command of client registry is pulled first
+	reqs := mp.Pull(2)
+	if len(reqs) != 2 || reqs[0].Seq != 3 || reqs[1].Seq != 1 {
+		t.Fatal("pull order error", reqs)
+	}
+	if mp.Len() != 3 || mp.Queued() != 1 {
+		t.Fatal("pulled requests are not kept", mp.Len(), mp.Queued())
+	}
+
+	// the committed requests are evicted, and the slot is available again
+	mp.Evict([]string{string(reqs[0].Encode()), string(b.Encode()), "raw command"})
+	if mp.Len() != 1 || mp.Queued() != 0 {
+		t.Fatal("committed requests are not evicted", mp.Len(), mp.Queued())
+	}
+	if mp.Add(c, mempool.PRIORITY_NORMAL) != nil {
+		t.Fatal("request is rejected")
+	}
+
+	// the pulled request which is not committed in time is pulled again
+	mp.SetPendingTimeout(10 * time.Millisecond)
+	if reqs = mp.Pull(2); len(reqs) != 1 || reqs[0].Seq != 4 {
+		t.Fatal("pull error", reqs)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if reqs = mp.Pull(2); len(reqs) != 2 || reqs[0].Seq != 1 || reqs[1].Seq != 4 {
+		t.Fatal("timeout requests are not pulled again", reqs)
+	}
+
+	// the pulled requests are pulled again at once after requeued
+	mp.SetPendingTimeout(time.Minute)
+	mp.Requeue()
+	if mp.Queued() != 2 {
+		t.Fatal("pulled requests are not requeued", mp.Queued())
+	}
+	if reqs = mp.Pull(2); len(reqs) != 2 || reqs[0].Seq != 1 || reqs[1].Seq != 4 {
+		t.Fatal("requeued requests are not pulled again", reqs)
+	}
+
+	mp.Remove(reqs)
+	if mp.Len() != 0 {
+		t.Fatal("remove error", mp.Len())
+	}
+}
@@ -1,7 +1,8 @@
 package message
 
 import (
-	"encoding/json"
+	"encoding/binary"
+	"wire"
 )
 
 // ServerMsg: the message between two servers
@@ -9,6 +10,7 @@ type ServerMsg struct {
 	SType      MsgType // the type of message, REQUEST/NODEMGMT/ORDER
 	SendServer string  // the server that sends the message
 	ReciServer string  // the server that recieves the message
+	Epoch      int     // the epoch of nodes of the consensus which sends the message, the ORDER messages of earlier epochs are dropped
 	Sign       []byte
 	Payload    []byte // the payload that this message carries, such as a consensus message
 }
@@ -20,17 +22,48 @@ const (
 	REQUEST  MsgType = iota // client request message
 	NODEMGMT                // message indicating that a node applies for joining or exiting
 	ORDER                   // consensus message for orderer
+	PROOF                   // the proof of a request in a committed block which replies to the client
+	SWITCH                  // the committed block of the protocol switch, which the replicas still running the old protocol catch up with
 )
 
+// SignedBytes: get the bytes covered by the signature of message,
+// which bind the type, the sender, the reciever and the epoch to the payload, so a signed message can't be replayed with another header
+func (sMsg *ServerMsg) SignedBytes() []byte {
+	buf := make([]byte, 0, 1+8+3*4+len(sMsg.SendServer)+len(sMsg.ReciServer)+len(sMsg.Payload))
+	buf = append(buf, byte(sMsg.SType))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(sMsg.Epoch))
+	for _, field := range [][]byte{[]byte(sMsg.SendServer), []byte(sMsg.ReciServer), sMsg.Payload} {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(field)))
+		buf = append(buf, field...)
+	}
+	return buf
+}
+
+// EncodeWire: write the serverMsg to the binary codec, the payload is written as it is
+func (sMsg *ServerMsg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(sMsg.SType)).String(sMsg.SendServer).String(sMsg.ReciServer).Int(sMsg.Epoch).Bytes(sMsg.Sign).Bytes(sMsg.Payload)
+}
+
+// DecodeWire: read the serverMsg from the binary codec
+func (sMsg *ServerMsg) DecodeWire(r *wire.Reader) {
+	sMsg.SType, sMsg.SendServer, sMsg.ReciServer, sMsg.Epoch = MsgType(r.Uint8()), r.String(), r.String(), r.Int()
+	sMsg.Sign, sMsg.Payload = r.Bytes(), r.Bytes()
+}
+
 // EncodeMsg: encode the serverMsg
-func EncodeMsg(sMsg ServerMsg) ([]byte, error) {
-	return json.Marshal(sMsg)
+// params:
+// - sMsg: the serverMsg
+// - codec: the codec of the message, the payload is encoded by the consensus before
+// return:
+// - the encoded message and error
+func EncodeMsg(sMsg ServerMsg, codec wire.Codec) ([]byte, error) {
+	return wire.Marshal(&sMsg, codec)
 }
 
-// DecodeMsg: decode the serverMsg
+// DecodeMsg: decode the serverMsg encoded by either codec
 func DecodeMsg(msgJson []byte) *ServerMsg {
 	res := &ServerMsg{}
-	err := json.Unmarshal(msgJson, res)
+	err := wire.Unmarshal(msgJson, res)
 	if err == nil {
 		return res
 	}
@@ -0,0 +1,3 @@
+module statemachine
+
+go 1.21.5
@@ -0,0 +1,146 @@
+package statemachine
+
+import (
+	"bcrequest"
+	"blockchain"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// the commands supported by the key/value application
+const (
+	KV_PUT = "put" // put k v: set the value of key k to v
+	KV_GET = "get" // get k: query the value of key k
+	KV_DEL = "del" // del k: delete the key k
+)
+
+// the results of the key/value application
+const (
+	KV_OK        = "OK"
+	KV_NOT_FOUND = "NOT_FOUND"
+	KV_ERROR     = "ERROR"
+)
+
+// KVStore: the built-in key/value application
+type KVStore struct {
+	Data   map[string]string // the replicated key/value state
+	Height int               // the height of the last applied block, -1 means nothing has been applied
+	Lock   sync.RWMutex      // the lock of the state
+}
+
+// kvSnapshot: the content of the key/value snapshot
+type kvSnapshot struct {
+	Data   map[string]string
+	Height int
+}
+
+// NewKVStore: return a new empty key/value application
+func NewKVStore() *KVStore {
+	return &KVStore{
+		Data:   make(map[string]string),
+		Height: -1,
+	}
+}
+
+// Apply: execute the commands of the committed block in order, the command is taken from the encoded client request
+// note: the block whose height has been applied is ignored, so that a block submitted repeatedly is executed only once
+// params:
+// - blk: the committed block
+// return:
+// - the result of each command, nil if the block has been applied
+func (kv *KVStore) Apply(blk blockchain.Block) []string {
+	kv.Lock.Lock()
+	defer kv.Lock.Unlock()
+
+	if blk.BlkHdr.Height <= kv.Height {
+		return nil
+	}
+	kv.Height = blk.BlkHdr.Height
+
+	results := make([]string, len(blk.BlkData.Trans))
+	for i, tx := range blk.BlkData.Trans {
+		results[i] = kv.execute(bcrequest.CmdOf(tx))
+	}
+	return results
+}
+
+// execute: execute a single command, the command which is not a key/value command gets an error result
+// params:
+// - cmd: the command such as "put k v", "get k" or "del k"
+// return:
+// - the result of the command
+func (kv *KVStore) execute(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) < 2 {
+		return KV_ERROR + ": unknown command"
+	}
+
+	switch fields[0] {
+	case KV_PUT:
+		if len(fields) < 3 {
+			return KV_ERROR + ": put need key and value"
+		}
+		kv.Data[fields[1]] = strings.Join(fields[2:], " ")
+		return KV_OK
+	case KV_GET:
+		if val, ok := kv.Data[fields[1]]; ok {
+			return val
+		}
+		return KV_NOT_FOUND
+	case KV_DEL:
+		if _, ok := kv.Data[fields[1]]; !ok {
+			return KV_NOT_FOUND
+		}
+		delete(kv.Data, fields[1])
+		return KV_OK
+	default:
+		return KV_ERROR + ": unknown command"
+	}
+}
+
+// Get: query the value of key locally without consensus
+// params:
+// - key: the key to query
+// return:
+// - the value and whether the key exists
+func (kv *KVStore) Get(key string) (string, bool) {
+	kv.Lock.RLock()
+	defer kv.Lock.RUnlock()
+	val, ok := kv.Data[key]
+	return val, ok
+}
+
+// Applied: get the height of the last applied block
+func (kv *KVStore) Applied() int {
+	kv.Lock.RLock()
+	defer kv.Lock.RUnlock()
+	return kv.Height
+}
+
+// Snapshot: get the json of the current data and applied height
+func (kv *KVStore) Snapshot() ([]byte, error) {
+	kv.Lock.RLock()
+	defer kv.Lock.RUnlock()
+	return json.Marshal(kvSnapshot{Data: kv.Data, Height: kv.Height})
+}
+
+// Restore: replace the current data and applied height with the snapshot
+// params:
+// - snapshot: the json generated by Snapshot
+func (kv *KVStore) Restore(snapshot []byte) error {
+	var s kvSnapshot
+	err := json.Unmarshal(snapshot, &s)
+	if err != nil {
+		return err
+	}
+	if s.Data == nil {
+		s.Data = make(map[string]string)
+	}
+
+	kv.Lock.Lock()
+	defer kv.Lock.Unlock()
+	kv.Data = s.Data
+	kv.Height = s.Height
+	return nil
+}
@@ -0,0 +1,134 @@
+package statemachine_test
+
+import (
+	"bcrequest"
+	"blockchain"
+	"fmt"
+	"ssm2"
+	"statemachine"
+	"testing"
+)
+
+// TestKVStore: test the key/value application apply, snapshot and restore
+func TestKVStore(t *testing.T) {
+	kv := statemachine.NewKVStore()
+
+	blk := blockchain.Block{
+		BlkHdr:  blockchain.BlockHeader{Height: 0},
+		BlkData: blockchain.BlockData{Trans: []string{"put a 1", "get a", "get b", "put b hello world", "del a", "get a", "foo"}},
+	}
+	results := kv.Apply(blk)
+	fmt.Println(results)
+	expected := []string{"OK", "1", "NOT_FOUND", "OK", "OK", "NOT_FOUND", "ERROR: unknown command"}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("command %d: expected %s, got %s", i, expected[i], results[i])
+		}
+	}
+
+	// the applied block should be ignored
+	if kv.Apply(blk) != nil {
+		t.Fatal("the block has been applied twice")
+	}
+
+	snapshot, err := kv.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv2 := statemachine.NewKVStore()
+	if err := kv2.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if val, ok := kv2.Get("b"); !ok || val != "hello world" || kv2.Height != 0 {
+		t.Fatal("restore error", val, ok, kv2.Height)
+	}
+}
+
+// TestReplayedApply: test the request committed before is not executed again by the state machine with validator
+func TestReplayedApply(t *testing.T) {
+	signer := ssm2.NewSigners(1)[0]
+	req := bcrequest.BCRequest{Id: "c_0", Seq: 1, Cmd: []byte("put a 1")}
+	req.Sign = signer.Sign(req.SignedBytes())
+	v := bcrequest.NewValidator(0)
+	v.AddClient(bcrequest.ClientEntry{Id: "c_0", Pk: signer.Pk})
+	bs := &blockchain.BlockStore{}
+	sm := statemachine.WithValidator(statemachine.NewKVStore(), v, bs)
+
+	tx := string(req.Encode())
+	results := sm.Apply(blockchain.Block{
+		BlkHdr:  blockchain.BlockHeader{Height: 0},
+		BlkData: blockchain.BlockData{Trans: []string{tx, "put b 2"}},
+	})
+	fmt.Println(results)
+	if results[0] != statemachine.KV_OK || results[1] != statemachine.KV_OK {
+		t.Fatal("apply error", results)
+	}
+
+	// the request is proposed again before it was committed, such as in the pipelined protocols
+	results = sm.Apply(blockchain.Block{
+		BlkHdr:  blockchain.BlockHeader{Height: 1},
+		BlkData: blockchain.BlockData{Trans: []string{"del a", tx, "get a"}},
+	})
+	fmt.Println(results)
+	if results[0] != statemachine.KV_OK || results[1] != statemachine.REJECTED+bcrequest.ErrReplayed.Error() || results[2] != statemachine.KV_NOT_FOUND {
+		t.Fatal("replayed request is executed", results)
+	}
+
+	// the block committed after the block store is halted is not executed
+	bs.Halt()
+	if results = sm.Apply(blockchain.Block{
+		BlkHdr:  blockchain.BlockHeader{Height: 2},
+		BlkData: blockchain.BlockData{Trans: []string{"put c 3"}},
+	}); results != nil {
+		t.Fatal("the block is executed after halting", results)
+	}
+}
+
+// TestReplaySnapshot: test the state machine of the joined node restores the synced snapshot with the committed requests,
+// and replays only the blocks after it, since the blocks below it are not stored
+func TestReplaySnapshot(t *testing.T) {
+	signer := ssm2.NewSigners(1)[0]
+	req := bcrequest.BCRequest{Id: "c_0", Seq: 1, Cmd: []byte("put a 1")}
+	req.Sign = signer.Sign(req.SignedBytes())
+	newSM := func(bs *blockchain.BlockStore) (statemachine.StateMachine, *bcrequest.Validator) {
+		v := bcrequest.NewValidator(0)
+		v.AddClient(bcrequest.ClientEntry{Id: "c_0", Pk: signer.Pk})
+		return statemachine.WithValidator(statemachine.NewKVStore(), v, bs), v
+	}
+	blks := []blockchain.Block{
+		{BlkHdr: blockchain.BlockHeader{Height: 0}, BlkData: blockchain.BlockData{Trans: []string{string(req.Encode())}}},
+		{BlkHdr: blockchain.BlockHeader{Height: 1}, BlkData: blockchain.BlockData{Trans: []string{"put b 2"}}},
+		{BlkHdr: blockchain.BlockHeader{Height: 2}, BlkData: blockchain.BlockData{Trans: []string{"put c 3"}}},
+	}
+	sm, _ := newSM(nil)
+	sm.Apply(blks[0])
+	sm.Apply(blks[1])
+	state, err := sm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the joined node stores the snapshot at height 1 and the block after it
+	bs := &blockchain.BlockStore{Path: t.TempDir()}
+	if err := bs.GetStorage().WriteBlock(blks[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.SaveSnapshot(blockchain.Snapshot{Height: sm.Applied(), State: state}); err != nil {
+		t.Fatal(err)
+	}
+	joined, v := newSM(bs)
+	if err := statemachine.Replay(joined, bs); err != nil {
+		t.Fatal(err)
+	}
+	if joined.Applied() != 2 || v.Check(&req) != bcrequest.ErrReplayed {
+		t.Fatal("the snapshot is not restored", joined.Applied(), v.Check(&req))
+	}
+
+	// the state machine taken over by the consensus of the next epoch replays nothing applied before
+	if err := statemachine.Replay(joined, bs); err != nil || joined.Applied() != 2 {
+		t.Fatal("the applied blocks are replayed", joined.Applied(), err)
+	}
+	if results := joined.Apply(blockchain.Block{BlkHdr: blockchain.BlockHeader{Height: 3}, BlkData: blockchain.BlockData{Trans: []string{"get a", "get c"}}}); results[0] != "1" || results[1] != "3" {
+		t.Fatal("wrong state after replaying", results)
+	}
+}
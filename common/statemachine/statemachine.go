@@ -0,0 +1,168 @@
+package statemachine
+
+import (
+	"bcrequest"
+	"blockchain"
+	"encoding/json"
+)
+
+// StateMachine: the replicated application behind the consensus, every orderer submits the committed block to it
+// note: the state machine must be deterministic, that is,
+// all honest replicas apply the same blocks in the same order and reach the same state and results
+type StateMachine interface {
+	// Apply: execute the commands of the committed block in order
+	// return the result of each command, the i-th result corresponds to the i-th command of the block
+	Apply(blk blockchain.Block) []string
+
+	// Snapshot: get the byte slice of the current state
+	Snapshot() ([]byte, error)
+
+	// Restore: replace the current state with the snapshot
+	Restore(snapshot []byte) error
+
+	// Applied: get the height of the last applied block, -1 means no block has been applied
+	Applied() int
+}
+
+// NewStateMachine: return the default state machine of the system, that is, the key/value application
+func NewStateMachine() StateMachine {
+	return NewKVStore()
+}
+
+// Replay: apply the blocks in the storage after the last applied block to the tip to the state machine,
+// which rebuilds the state after restarting, or catches up with the blocks stored but not executed yet,
+// the empty state machine restores the snapshot synced by the joined node first, since the blocks below it are not stored
+// params:
+// - sm:		the state machine
+// - bs: 		the block store with the storage
+// return:
+// - error
+func Replay(sm StateMachine, bs *blockchain.BlockStore) error {
+	if sm.Applied() < 0 {
+		snapshot, err := bs.LoadSnapshot()
+		if err != nil {
+			return err
+		}
+		if snapshot != nil {
+			if err := sm.Restore(snapshot.State); err != nil {
+				return err
+			}
+		}
+	}
+	storage := bs.GetStorage()
+	height, err := storage.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+	for i := sm.Applied() + 1; i <= height; i++ {
+		blk, err := storage.ReadBlock(i)
+		if err != nil {
+			return err
+		}
+		sm.Apply(*blk)
+	}
+	return nil
+}
+
+// the results of the requests handled by the request validator instead of the application
+const (
+	REJECTED  = "ERROR: " // the prefix of the result of the request which is not executed, followed by the reason
+	CLIENT_OK = "OK"      // the result of the committed command of the client registry or reconfiguration
+)
+
+// reqStateMachine: the state machine which records the requests of the committed block in the request validator,
+// so that the replayed requests are rejected, the clients are registered and revoked in order,
+// and all of them are rebuilt when the blocks are replayed after restarting
+type reqStateMachine struct {
+	StateMachine
+	validator *bcrequest.Validator
+	blkStore  *blockchain.BlockStore
+}
+
+// WithValidator: wrap the state machine to record the committed requests in the validator
+// params:
+// - sm:        the state machine
+// - validator: the request validator
+// - bs:        the block store of the consensus, the blocks committed after it is halted are not executed, it may be nil
+// note: the state machine wrapped before is unwrapped first, so the requests are recorded once
+// return:
+// - the wrapped state machine
+func WithValidator(sm StateMachine, validator *bcrequest.Validator, bs *blockchain.BlockStore) StateMachine {
+	// the state machine taken over by the consensus of the next epoch is wrapped again with its block store
+	if r, ok := sm.(*reqStateMachine); ok {
+		sm = r.StateMachine
+	}
+	return &reqStateMachine{StateMachine: sm, validator: validator, blkStore: bs}
+}
+
+// Apply: record the requests of the committed block and then execute the others by the application,
+// the request rejected by the validator, such as the one committed before, is not executed and gets REJECTED with the reason as result,
+// and the command of the client registry or reconfiguration gets CLIENT_OK
+// note: the block committed after the block store is halted is dropped without results, and its requests are kept in the mempool
+func (r *reqStateMachine) Apply(blk blockchain.Block) []string {
+	if r.blkStore != nil && r.blkStore.Halted() {
+		return nil
+	}
+	errs := r.validator.CommitBlock(blk.BlkHdr.Height, blk.BlkData.Trans)
+
+	trans := make([]string, len(blk.BlkData.Trans))
+	skipped := make([]string, len(blk.BlkData.Trans))
+	skip := false
+	for i, tx := range blk.BlkData.Trans {
+		if errs[i] != nil {
+			skipped[i] = REJECTED + errs[i].Error()
+		} else if req, err := bcrequest.DecodeTx([]byte(tx)); err == nil && (bcrequest.IsClientCmd(req.Cmd) || bcrequest.IsReconfigCmd(req.Cmd)) {
+			skipped[i] = CLIENT_OK
+		} else {
+			trans[i] = tx
+			continue
+		}
+		skip = true
+	}
+	if !skip {
+		return r.StateMachine.Apply(blk)
+	}
+
+	blk.BlkData.Trans = trans
+	results := r.StateMachine.Apply(blk)
+	for i := range results {
+		if skipped[i] != "" {
+			results[i] = skipped[i]
+		}
+	}
+	return results
+}
+
+// reqSnapshot: the content of the snapshot of the state machine with the request validator
+type reqSnapshot struct {
+	App  []byte // the snapshot of the application
+	Reqs []byte // the snapshot of the request validator
+}
+
+// Snapshot: get the snapshot of the application together with the clients and the committed requests,
+// so the state machine restored by it rejects the replayed requests as the one which applies the blocks
+func (r *reqStateMachine) Snapshot() ([]byte, error) {
+	app, err := r.StateMachine.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	reqs, err := r.validator.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(reqSnapshot{App: app, Reqs: reqs})
+}
+
+// Restore: replace the state of the application and the request validator with the snapshot
+// params:
+// - snapshot: the json generated by Snapshot
+func (r *reqStateMachine) Restore(snapshot []byte) error {
+	var s reqSnapshot
+	if err := json.Unmarshal(snapshot, &s); err != nil {
+		return err
+	}
+	if err := r.validator.Restore(s.Reqs); err != nil {
+		return err
+	}
+	return r.StateMachine.Restore(s.App)
+}
@@ -0,0 +1,395 @@
+package wire
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Codec: the encoding of the messages between replicas
+type Codec string
+
+const (
+	JSON   Codec = "json"   // the readable encoding for debugging, and the encoding of the nodes before the binary codec
+	BINARY Codec = "binary" // the compact varint encoding
+)
+
+// the header of binary encoding, a JSON document never starts with MAGIC,
+// so the decoder can tell the two encodings apart by the first byte
+const (
+	MAGIC   = 0xdc // the first byte of binary encoding
+	VERSION = 1    // the version of binary encoding, the decoder rejects the versions it doesn't know
+
+	MaxDepth = 16 // the max nesting depth of the values which contain the values of their own type
+)
+
+var (
+	ErrVersion     = errors.New("unknown wire version")            // the binary encoding of an unknown version
+	ErrTruncated   = errors.New("wire data truncated")             // the data ends before the value
+	ErrTrailing    = errors.New("trailing bytes after wire value") // the data has bytes after the value
+	ErrNotEncoding = errors.New("value has no wire encoding")      // the value doesn't implement Marshaler or Unmarshaler
+	ErrTooDeep     = errors.New("wire value nested too deep")      // the nesting depth exceeds MaxDepth
+)
+
+// Marshaler: the value which can be written by the binary codec
+type Marshaler interface {
+	EncodeWire(w *Writer)
+}
+
+// Unmarshaler: the value which can be read by the binary codec
+type Unmarshaler interface {
+	DecodeWire(r *Reader)
+}
+
+// ParseCodec: parse the codec in config, the empty codec is BINARY
+// params:
+// - s: the name of codec, "json" or "binary"
+// return:
+// - the codec and error
+func ParseCodec(s string) (Codec, error) {
+	switch Codec(s) {
+	case "", BINARY:
+		return BINARY, nil
+	case JSON:
+		return JSON, nil
+	default:
+		return "", fmt.Errorf("unknown codec %q", s)
+	}
+}
+
+// Marshal: encode the value by the codec, the value is encoded by JSON unless the codec is BINARY
+// params:
+// - v: the value, which must implement Marshaler for BINARY
+// - codec: the codec
+// return:
+// - the encoded bytes and error
+func Marshal(v interface{}, codec Codec) ([]byte, error) {
+	if codec != BINARY {
+		return json.Marshal(v)
+	}
+	m, ok := v.(Marshaler)
+	if !ok {
+		return nil, ErrNotEncoding
+	}
+	w := NewWriter()
+	m.EncodeWire(w)
+	return w.Encoded(), nil
+}
+
+// Unmarshal: decode the value encoded by either codec, which is detected by the first byte
+// params:
+// - data: the encoded bytes
+// - v: the pointer of value, which must implement Unmarshaler for BINARY
+// return:
+// - error
+func Unmarshal(data []byte, v interface{}) error {
+	if !IsBinary(data) {
+		return json.Unmarshal(data, v)
+	}
+	u, ok := v.(Unmarshaler)
+	if !ok {
+		return ErrNotEncoding
+	}
+	r, err := NewReader(data)
+	if err != nil {
+		return err
+	}
+	u.DecodeWire(r)
+	return r.Close()
+}
+
+// IsBinary: check whether the data is encoded by the binary codec
+func IsBinary(data []byte) bool {
+	return len(data) > 0 && data[0] == MAGIC
+}
+
+// Writer: the binary encoder
+// - the integers are varints, the unsigned ones are uvarints
+// - the byte slices and lists are prefixed with their length plus one, and 0 is nil,
+// so the nil and empty values survive the round trip like JSON null and []
+// - the strings are prefixed with their length
+type Writer struct {
+	buf []byte
+}
+
+// NewWriter: create a writer with the binary header
+func NewWriter() *Writer {
+	return &Writer{buf: append(make([]byte, 0, 256), MAGIC, VERSION)}
+}
+
+// Uvarint: write an unsigned varint
+func (w *Writer) Uvarint(v uint64) *Writer {
+	w.buf = binary.AppendUvarint(w.buf, v)
+	return w
+}
+
+// Varint: write a zigzag varint
+func (w *Writer) Varint(v int64) *Writer {
+	w.buf = binary.AppendVarint(w.buf, v)
+	return w
+}
+
+// Int: write an int as a varint, such as the view number and the height
+func (w *Writer) Int(v int) *Writer {
+	return w.Varint(int64(v))
+}
+
+// Uint8: write a byte, such as the message type
+func (w *Writer) Uint8(v uint8) *Writer {
+	w.buf = append(w.buf, v)
+	return w
+}
+
+// Bool: write a byte of 1 or 0, such as the presence of a pointer
+func (w *Writer) Bool(v bool) *Writer {
+	if v {
+		return w.Uint8(1)
+	}
+	return w.Uint8(0)
+}
+
+// Count: write the length of a list, which is followed by its items
+// params:
+// - n: the length of list
+// - null: whether the list is nil
+func (w *Writer) Count(n int, null bool) *Writer {
+	if null {
+		return w.Uvarint(0)
+	}
+	return w.Uvarint(uint64(n) + 1)
+}
+
+// Bytes: write the length and the content of byte slice
+func (w *Writer) Bytes(b []byte) *Writer {
+	w.Count(len(b), b == nil)
+	w.buf = append(w.buf, b...)
+	return w
+}
+
+// String: write the length and the content of string
+func (w *Writer) String(s string) *Writer {
+	w.Uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+	return w
+}
+
+// BytesList: write the length and each byte slice of list
+func (w *Writer) BytesList(bs [][]byte) *Writer {
+	w.Count(len(bs), bs == nil)
+	for _, b := range bs {
+		w.Bytes(b)
+	}
+	return w
+}
+
+// Strings: write the length and each string of list
+func (w *Writer) Strings(ss []string) *Writer {
+	w.Count(len(ss), ss == nil)
+	for _, s := range ss {
+		w.String(s)
+	}
+	return w
+}
+
+// Encoded: get the encoded bytes
+func (w *Writer) Encoded() []byte {
+	return w.buf
+}
+
+// Reader: the binary decoder, the first error is kept and the later reads return zero values,
+// so the decoders read all fields and check Err once
+// note: the byte slices share the memory of data, their capacity is cut so appending to them never overwrites data
+type Reader struct {
+	data  []byte
+	off   int
+	depth int
+	err   error
+}
+
+// NewReader: create a reader of the binary data and check its header
+// params:
+// - data: the bytes written by Writer
+// return:
+// - the reader and error
+func NewReader(data []byte) (*Reader, error) {
+	if len(data) < 2 || data[0] != MAGIC {
+		return nil, ErrTruncated
+	}
+	if data[1] != VERSION {
+		return nil, ErrVersion
+	}
+	return &Reader{data: data, off: 2}, nil
+}
+
+// Err: get the first error of reading
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Close: check that the data is read without error and entirely
+func (r *Reader) Close() error {
+	if r.err == nil && r.off != len(r.data) {
+		r.err = ErrTrailing
+	}
+	return r.err
+}
+
+// Enter: enter a nested value, it fails when the depth exceeds MaxDepth,
+// so a forged message can't exhaust the stack by the recursive decoders
+// return:
+// - whether the nested value can be read, Leave must be called if it is true
+func (r *Reader) Enter() bool {
+	if r.depth >= MaxDepth {
+		r.fail(ErrTooDeep)
+		return false
+	}
+	r.depth++
+	return true
+}
+
+// Leave: leave the nested value entered by Enter
+func (r *Reader) Leave() {
+	r.depth--
+}
+
+// fail: keep the first error
+func (r *Reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Uvarint: read an unsigned varint
+func (r *Reader) Uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 {
+		r.fail(ErrTruncated)
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+// Varint: read a zigzag varint
+func (r *Reader) Varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.off:])
+	if n <= 0 {
+		r.fail(ErrTruncated)
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+// Int: read a varint as an int
+func (r *Reader) Int() int {
+	v := r.Varint()
+	if v > math.MaxInt || v < math.MinInt {
+		r.fail(fmt.Errorf("wire int %d overflows", v))
+		return 0
+	}
+	return int(v)
+}
+
+// Uint8: read a byte
+func (r *Reader) Uint8() uint8 {
+	if r.err != nil {
+		return 0
+	}
+	if r.off >= len(r.data) {
+		r.fail(ErrTruncated)
+		return 0
+	}
+	v := r.data[r.off]
+	r.off++
+	return v
+}
+
+// Bool: read a byte of 1 or 0
+func (r *Reader) Bool() bool {
+	return r.Uint8() != 0
+}
+
+// Count: read the length of a list
+// the length is bounded by the remaining bytes, because every item takes a byte at least,
+// so a forged length never allocates more memory than the data
+// return:
+// - the length and whether the list is nil
+func (r *Reader) Count() (int, bool) {
+	v := r.Uvarint()
+	if v == 0 {
+		return 0, true
+	}
+	if v-1 > uint64(len(r.data)-r.off) {
+		r.fail(ErrTruncated)
+		return 0, true
+	}
+	return int(v - 1), false
+}
+
+// next: read n bytes
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data)-r.off {
+		r.fail(ErrTruncated)
+		return nil
+	}
+	b := r.data[r.off : r.off+n : r.off+n]
+	r.off += n
+	return b
+}
+
+// Bytes: read a byte slice
+func (r *Reader) Bytes() []byte {
+	n, null := r.Count()
+	if null {
+		return nil
+	}
+	return r.next(n)
+}
+
+// String: read a string
+func (r *Reader) String() string {
+	v := r.Uvarint()
+	if v > uint64(len(r.data)-r.off) {
+		r.fail(ErrTruncated)
+		return ""
+	}
+	return string(r.next(int(v)))
+}
+
+// BytesList: read a list of byte slices
+func (r *Reader) BytesList() [][]byte {
+	n, null := r.Count()
+	if null {
+		return nil
+	}
+	bs := make([][]byte, n)
+	for i := range bs {
+		bs[i] = r.Bytes()
+	}
+	return bs
+}
+
+// Strings: read a list of strings
+func (r *Reader) Strings() []string {
+	n, null := r.Count()
+	if null {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = r.String()
+	}
+	return ss
+}
@@ -0,0 +1,81 @@
+package wire_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"wire"
+)
+
+// sample: a value with the fields of every kind
+type sample struct {
+	N     int
+	T     uint8
+	B     []byte
+	S     string
+	BList [][]byte
+	SList []string
+}
+
+func (s *sample) EncodeWire(w *wire.Writer) {
+	w.Int(s.N).Uint8(s.T).Bytes(s.B).String(s.S).BytesList(s.BList).Strings(s.SList)
+}
+
+func (s *sample) DecodeWire(r *wire.Reader) {
+	s.N, s.T, s.B, s.S, s.BList, s.SList = r.Int(), r.Uint8(), r.Bytes(), r.String(), r.BytesList(), r.Strings()
+}
+
+// TestWire: test the golden vector of the binary encoding, and the round trip of both codecs
+func TestWire(t *testing.T) {
+	s := &sample{N: -2, T: 3, B: []byte{}, S: "ab", BList: [][]byte{nil, {1}}}
+
+	data, err := wire.Marshal(s, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hex.DecodeString("dc0103030102616203000201" + "00")
+	if !bytes.Equal(data, want) {
+		t.Fatalf("expected %x, got %x", want, data)
+	}
+
+	for _, codec := range []wire.Codec{wire.BINARY, wire.JSON} {
+		data, err := wire.Marshal(s, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wire.IsBinary(data) != (codec == wire.BINARY) {
+			t.Fatal(codec, "is not detected")
+		}
+		got := &sample{}
+		if err := wire.Unmarshal(data, got); err != nil {
+			t.Fatal(codec, err)
+		}
+		if !reflect.DeepEqual(s, got) {
+			t.Fatalf("%s: expected %+v, got %+v", codec, s, got)
+		}
+	}
+}
+
+// TestWireMalformed: test the truncated, trailing and unknown version data are rejected
+func TestWireMalformed(t *testing.T) {
+	data, _ := wire.Marshal(&sample{BList: [][]byte{{1, 2, 3}}}, wire.BINARY)
+
+	for i := 1; i < len(data); i++ {
+		if err := wire.Unmarshal(data[:i], &sample{}); err == nil {
+			t.Fatal("truncated data is accepted", i)
+		}
+	}
+	if err := wire.Unmarshal(append(data, 0), &sample{}); err != wire.ErrTrailing {
+		t.Fatal("trailing data is accepted", err)
+	}
+	data[1] = wire.VERSION + 1
+	if err := wire.Unmarshal(data, &sample{}); err != wire.ErrVersion {
+		t.Fatal("unknown version is accepted", err)
+	}
+
+	// the forged length larger than the data is rejected before allocating
+	if err := wire.Unmarshal([]byte{wire.MAGIC, wire.VERSION, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0x0f}, &sample{}); err != wire.ErrTruncated {
+		t.Fatal("forged length is accepted", err)
+	}
+}
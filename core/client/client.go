@@ -1,6 +1,7 @@
 package client
 
 import (
+	"blockchain"
 	"bufio"
 	"crypto/rand"
 	"deltachain/common/dcs"
@@ -12,6 +13,7 @@ import (
 	"log"
 	"message"
 	"net"
+	"orderer"
 	"os"
 	"strconv"
 	"strings"
@@ -43,6 +45,8 @@ type Client struct {
 	endView    int   // the view number at the end of the test
 	showedView int   // the latest recieved view number
 	nodes      int   // the nodes number in system
+
+	proofPk []byte // the public key given out of band to verify the validation of blocks, the proofs are rejected without it
 }
 
 // NewClient: create a new client
@@ -73,6 +77,7 @@ func NewClient(addr string, port string) *Client {
 		*log.New(os.Stdout, "", 0),
 		sync.Mutex{},
 		0, 0, 1, 0, 0, -1, 0, 0, 0,
+		nil,
 	}
 
 	client.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
@@ -172,11 +177,11 @@ func (c *Client) StartListenTcp() {
 func (c *Client) handleConn(conn net.Conn) {
 	// c.Logger.Println("Client connected:", conn.RemoteAddr())
 	defer conn.Close()
+	reader := bufio.NewReader(conn)
 	for {
 
-		// message length < 2048
-		buf := make([]byte, 2048)
-		n, err := conn.Read(buf)
+		// each message ends with '\n', and the reply with results may be longer than a single read
+		buf, err := reader.ReadBytes('\n')
 		if err != nil {
 			if err != io.EOF {
 				c.Logger.Println("Error reading:", err)
@@ -185,7 +190,7 @@ func (c *Client) handleConn(conn net.Conn) {
 		}
 
 		msg := &message.ServerMsg{}
-		err = json.Unmarshal(buf[:n], msg)
+		err = json.Unmarshal(buf, msg)
 
 		if err != nil {
 			c.Logger.Println("Error Json Unmarshal in handleConn", err.Error())
@@ -203,6 +208,10 @@ func (c *Client) handleReply(msg *message.ServerMsg) {
 		c.nodes = int(msg.Payload[0])
 		return
 	}
+	if msg.SType == message.PROOF {
+		c.handleProof(msg)
+		return
+	}
 	hsMsg := &hstypes.Msg{}
 	err := json.Unmarshal(msg.Payload, hsMsg)
 	if err != nil {
@@ -220,7 +229,47 @@ func (c *Client) handleReply(msg *message.ServerMsg) {
 		d, co, s := dcs.GetDCS(c.nodes, float64(c.endTime-c.startTime)/(1000*float64(c.endView-c.startView+1)), float64(c.batchSize*(c.endView-c.startView+1)*1000)/float64(c.endTime-c.startTime))
 		fmt.Printf("Decentralization: %.4f, Consistency: %.4f, Scalability: %.4f \n", d, co, s)
 		c.showedView = hsMsg.ViewNumber
+
+		// show the result of each executed command
+		if len(hsMsg.Results) != 0 {
+			c.Logger.Println("[RESULT]:", hsMsg.SendNode, "View:", hsMsg.ViewNumber, hsMsg.Results)
+		}
+	}
+}
+
+// SetProofKey: set the public key to verify the validation of blocks, which is given out of band instead of by the servers,
+// since a proof is trusted only if the key is not chosen by the server which sends it
+// params:
+// - pk: the public key, see orderer.Orderer.PublicKey
+func (c *Client) SetProofKey(pk []byte) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.proofPk = pk
+}
+
+// handleProof: verify the proof of the request from the server by the public key given out of band, see SetProofKey
+func (c *Client) handleProof(msg *message.ServerMsg) {
+	proof := &blockchain.BlockProof{}
+	err := json.Unmarshal(msg.Payload, proof)
+	if err != nil {
+		c.Logger.Println("Error Json Unmarshal in handleProof", err.Error())
+		return
+	}
+
+	c.Mu.Lock()
+	pk := c.proofPk
+	c.Mu.Unlock()
+
+	if len(pk) == 0 {
+		c.Logger.Println("[PROOF]:", msg.SendServer, "no public key is set to verify the proof")
+		return
+	}
+	err = orderer.VerifyBlockProof(proof, pk)
+	if err != nil {
+		c.Logger.Println("[PROOF]:", msg.SendServer, "Height:", proof.Height, "Index:", proof.Index, "verify failed:", err)
+		return
 	}
+	c.Logger.Println("[PROOF]:", msg.SendServer, "Height:", proof.Height, "Index:", proof.Index, "Cmd:", proof.Cmd, "verify success")
 }
 
 // LogResult: log the six result
@@ -1,7 +1,6 @@
 package factory
 
 import (
-	"blockchain"
 	"common"
 	"fmt"
 	"server"
@@ -9,14 +8,19 @@ import (
 
 // CheckBlkInfo: counts the number of all commands in the block
 func CheckBlkInfo(simulateNodes []*server.Server) int {
-	height, err := blockchain.GetBlockHeight("./BCData/" + simulateNodes[0].ServerID.ID.Name + "/")
+	storage := simulateNodes[0].Orderer.GetBlockStore().GetStorage()
+	height, err := storage.GetBlockHeight()
 	if err != nil {
 		fmt.Println(err)
 	}
 	fmt.Println("block height is", height)
 	count := 0
-	for i := 0; i <= int(height); i++ {
-		blk, _ := simulateNodes[0].BlkStore.ReadBlock("./BCData/"+simulateNodes[0].ServerID.ID.Name+"/", i)
+	for i := 0; i <= height; i++ {
+		blk, err := storage.ReadBlock(i)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
 		// fmt.Println("Height " + strconv.Itoa(i))
 		// fmt.Println("PreBlock", blk.BlkHdr.PreBlkHash)
 		// fmt.Println("CurBlock", blk.Hash())
@@ -0,0 +1,185 @@
+package factory
+
+import (
+	common "common"
+	"config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"ssm2"
+	"strconv"
+	"strings"
+	"transport"
+	"tss"
+)
+
+// ParseProtocol: get the consensus type by the short name of protocol
+// params:
+// - protocol: "bh", "ch", "h2", "fh", "bs" or "pbft"
+// return:
+// - the consensus type and error
+func ParseProtocol(protocol string) (common.ConsensusType, error) {
+	switch protocol {
+	case "bh":
+		return common.HOTSTUFF_PROTOCOL_BASIC, nil
+	case "ch":
+		return common.HOTSTUFF_PROTOCOL_CHAINED, nil
+	case "h2":
+		return common.HOTSTUFF_2_PROTOCOL, nil
+	case "fh":
+		return common.FAST_HOTSTUFF_PROTOCOL, nil
+	case "bs":
+		return common.BULLSHARK, nil
+	case "pbft":
+		return common.PBFT, nil
+	}
+	return "", fmt.Errorf("unknown protocol %s", protocol)
+}
+
+// GenClusterConfigs: generate the configs and the key files of a cluster whose replicas listen on localhost
+// every replica r_i gets r_i.json, r_i.key and r_i.signer in dir, and listens on port basePort+i for replicas
+// and port basePort+100+i for the client commands, the key of the operator is generated in dir/operator,
+// whose public key is given to all replicas, and only r_0 is given the directory to sign the console requests
+// and the reconfigurations, the other replicas don't hold the private key of the operator,
+// the TLS certificates of replicas are generated in dir/tls, and the cluster CA which issues them in caDir,
+// which is outside dir and referred by no node config, so its private key is never shipped with the replicas
+// params:
+// - nodeNum:  the number of replicas
+// - protocol: the short name of consensus protocol
+// - dir:      the directory to write the files
+// - caDir:    the directory to write the certificate and the private key of the cluster CA, which can't be in dir
+// - basePort: the first port of replicas
+// return:
+// - the node configs and error
+func GenClusterConfigs(nodeNum int, protocol string, dir string, caDir string, basePort int) ([]config.NodeConfig, error) {
+	consType, err := ParseProtocol(protocol)
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	absCADir, err := filepath.Abs(caDir)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(absDir, absCADir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("the CA directory %s is in the cluster directory %s", caDir, dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// the SM2 keys of replicas, which sign the server messages
+	keys := ssm2.NewSigners(nodeNum)
+	cluster := make([]config.PeerConfig, nodeNum)
+	for i := 0; i < nodeNum; i++ {
+		cluster[i] = config.PeerConfig{
+			Name:      "r_" + strconv.Itoa(i),
+			Addr:      "127.0.0.1:" + strconv.Itoa(basePort+i),
+			PubKey:    keys[i].Pk,
+			DkgPubKey: tss.DeriveDKGKey(keys[i].Sk).PublicBytes(),
+		}
+	}
+
+	// the key of the operator is generated for each cluster instead of being kept in the repository
+	op := ssm2.NewSigners(1)[0]
+	opDir := filepath.Join(dir, "operator")
+	if err := os.MkdirAll(opDir, 0700); err != nil {
+		return nil, err
+	}
+	if !ssm2.WriteKey(op.Sk, filepath.Join(opDir, "private.pem")) || !ssm2.WriteKey(op.Pk, filepath.Join(opDir, "public.pem")) {
+		return nil, errors.New("write key file of operator error")
+	}
+
+	// the certificates of replicas, which authenticate the connections between replicas
+	tlsDir := filepath.Join(dir, "tls")
+	names := make([]string, nodeNum)
+	for i := range cluster {
+		names[i] = cluster[i].Name
+	}
+	if err := transport.GenTLSFiles(tlsDir, caDir, names); err != nil {
+		return nil, err
+	}
+
+	signers := GenSigners(consType, nodeNum)
+	confs := make([]config.NodeConfig, nodeNum)
+	for i := 0; i < nodeNum; i++ {
+		name := cluster[i].Name
+		nc := config.DefaultNodeConfig()
+		nc.ID = i
+		nc.Protocol = protocol
+		nc.Path = filepath.Join(dir, "data")
+		nc.KeyFile = filepath.Join(dir, name+".key")
+		nc.SignerFile = filepath.Join(dir, name+".signer")
+		nc.Listen = "127.0.0.1:" + strconv.Itoa(basePort+100+i)
+		nc.Cluster = cluster
+		nc.OperatorKey = op.Pk
+		nc.TLSCert = filepath.Join(tlsDir, name+transport.CertSuffix)
+		nc.TLSKey = filepath.Join(tlsDir, name+transport.KeySuffix)
+		nc.TLSCA = filepath.Join(tlsDir, transport.CACertFile)
+		if i == 0 {
+			nc.Operator = opDir
+		}
+
+		if !ssm2.WriteKey(keys[i].Sk, nc.KeyFile) {
+			return nil, errors.New("write key file error")
+		}
+		if err := StoreSigner(signers[i], nc.SignerFile); err != nil {
+			return nil, err
+		}
+		if err := config.WriteNodeConfig(filepath.Join(dir, name+".json"), nc); err != nil {
+			return nil, err
+		}
+		confs[i] = nc
+	}
+	return confs, nil
+}
+
+// StoreSigner: write the consensus signer to file
+// params:
+// - signer: the threshold signer or the SM2 signer for pbft
+// - path:   the file path
+// return:
+// - error
+func StoreSigner(signer interface{}, path string) error {
+	var data []byte
+	switch s := signer.(type) {
+	case *tss.Signer:
+		data = s.Encode()
+	case *ssm2.Signer:
+		data, _ = json.Marshal(s)
+	}
+	if data == nil {
+		return errors.New("encode signer error")
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// LoadSigner: read the consensus signer from file
+// params:
+// - consType: the consensus protocol type, pbft uses the SM2 signer and others use the threshold signer
+// - path:     the file path
+// return:
+// - the signer and error
+func LoadSigner(consType common.ConsensusType, path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if consType == common.PBFT {
+		signer := &ssm2.Signer{}
+		if err := json.Unmarshal(data, signer); err != nil {
+			return nil, err
+		}
+		return signer, nil
+	}
+	signer := &tss.Signer{}
+	if err := signer.Decode(data); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
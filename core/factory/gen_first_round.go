@@ -1,10 +1,8 @@
 package factory
 
 import (
-	"bcrequest"
 	common "common"
 	"server"
-	"ssm2"
 )
 
 // GenChainedFirstRound: generate the first request with command 'Genesis block'
@@ -13,25 +11,23 @@ import (
 // - simulateServers: the slice of nodes in system
 // - path:			  the path of block storage
 func GenFirstRound(simulateNodes []*server.Server, path string) {
+	// the recovered servers continue from the local data instead of the genesis block
+	if RejoinServers(simulateNodes) {
+		return
+	}
+
 	dirPath := path + "/"
 	for i := 0; i < len(simulateNodes); i++ {
 
 		// remove self past files, and choose not to delete it as required
+		// the storage is closed before removing and reopened after that
+		simulateNodes[i].CloseStorage()
 		common.RemoveAllFilesAndDirs(dirPath + simulateNodes[i].ServerID.ID.Name + "/")
+		simulateNodes[i].InitStorage()
 	}
 
-	signer := ssm2.Signer{}
-	signer.Sk = signer.GetSKFromFile()
-	signer.Pk = signer.GetPKFromFile()
-	cmd := []byte("Genesis block")
-	sign := signer.Sign(cmd)
-	// update the first leader's request
-	simulateNodes[0].Requests = []bcrequest.BCRequest{{
-		Id:   "Client",
-		Cmd:  cmd,
-		Sign: sign,
-	},
-	}
+	// update the first leader's request, which is signed by the client as others
+	simulateNodes[0].AddReq(SignCmd([][]byte{[]byte("Genesis block")})[0])
 	simulateNodes[0].Orderer.ReqFlagChan <- true
 }
 
@@ -44,6 +40,28 @@ func ClearBlockInPath(simulateNodes []*server.Server, path string) {
 	for i := 0; i < len(simulateNodes); i++ {
 
 		// remove self past files, and choose not to delete it as required
+		// the data of recovered servers is kept
+		if simulateNodes[i].Recovered {
+			continue
+		}
+		simulateNodes[i].CloseStorage()
 		common.RemoveAllFilesAndDirs(dirPath + simulateNodes[i].ServerID.ID.Name + "/")
+		simulateNodes[i].InitStorage()
+	}
+}
+
+// RejoinServers: the recovered servers rejoin the system
+// params:
+// - simulateServers: the slice of nodes in system
+// return:
+// - true if any server is recovered
+func RejoinServers(simulateNodes []*server.Server) bool {
+	recovered := false
+	for _, s := range simulateNodes {
+		if s.Recovered {
+			recovered = true
+			s.Orderer.Rejoin()
+		}
 	}
+	return recovered
 }
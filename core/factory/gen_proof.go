@@ -0,0 +1,40 @@
+package factory
+
+import (
+	"fmt"
+	"server"
+	"strconv"
+)
+
+// GenProof: ask a server for the proof of the request in the committed block, and the server sends the proof to the client
+// params:
+// - simulateServers: the slice of nodes in system
+// - params[]:
+// -- 1.height: the height of block
+// -- 2.index:  the index of the request in the block
+// -- 3.server: optional, the index of the server asked, default 0
+func GenProof(simulateServers []*server.Server, params []string) {
+	if len(params) < 2 {
+		fmt.Println("proof need height and index")
+		return
+	}
+	height, err := strconv.Atoi(params[0])
+	if err != nil {
+		fmt.Println("height is invalid:", params[0])
+		return
+	}
+	index, err := strconv.Atoi(params[1])
+	if err != nil {
+		fmt.Println("index is invalid:", params[1])
+		return
+	}
+	serverIndex := 0
+	if len(params) > 2 {
+		serverIndex, err = strconv.Atoi(params[2])
+		if err != nil || serverIndex < 0 || serverIndex >= len(simulateServers) {
+			fmt.Println("server is invalid:", params[2])
+			return
+		}
+	}
+	simulateServers[serverIndex].SendProof(height, index)
+}
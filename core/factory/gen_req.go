@@ -4,18 +4,24 @@ import (
 	"bcrequest"
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mempool"
 	"message"
 	"os"
-	"p2p"
 	"server"
 	"ssm2"
 	"strconv"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// GenNewReq: generate new request
-// note: if the view leader is in new-view phase, send the request to the leader, or send it to next view leader
+// GenNewReq: submit new requests to the leader, which adds them to its mempool and gossips them to other replicas
+// note: the requests rejected because the mempool is full are submitted again after a while, so it blocks until all requests are accepted
 // params:
 // simulateServers: the slice of nodes in system
 // input:			the new req
@@ -30,34 +36,28 @@ func GenNewReq(simulateServers []*server.Server, reqs []bcrequest.BCRequest) {
 	}
 
 	for {
-		for i, s := range simulateServers {
-			if s.Orderer.IsLeader() {
-				// fmt.Println(s.ServerID.ID.Name, s.Orderer.PBFTConsensus.View, s.Orderer.IsWaitingReq(), len(s.Requests)+len(reqs) <= s.BatchSize)
-				// check whether the leader is waiting request
-				if s.RequestsLock.TryLock() {
-					if s.Orderer.IsWaitingReq() {
-						if len(s.Requests)+len(reqs) <= s.BatchSize {
-							// s.Logger.Println("push leader", s.ServerID.ID.Name, s.Orderer.PBFTConsensus.CurPhase, s.Orderer.PBFTConsensus.View.ViewNumber)
-							// 	s.ServerID.ID.Name,
-							// 	s.Orderer.PBFTConsensus.View.ViewNumber,
-							// 	s.Orderer.PBFTConsensus.View.Leader,
-							// 	s.Orderer.IsWaitingReq(),
-							// 	reqs[0].Cmd[:5])
-
-							simulateServers[i].Requests = append(simulateServers[i].Requests, reqs...)
-							s.RequestsLock.Unlock()
-
-							// send the flag of handle request
-							simulateServers[i].Orderer.ReqFlagChan <- true
-							return
-						}
-					}
-					s.RequestsLock.Unlock()
-				}
+		// submit the requests to the leader, or any server if the leader is unknown
+		s := simulateServers[0]
+		for _, ss := range simulateServers {
+			if ss.Orderer.IsLeader() {
+				s = ss
+				break
 			}
+		}
 
+		full := make([]bcrequest.BCRequest, 0)
+		for i, err := range s.SubmitReqs(reqs) {
+			if err == mempool.ErrPoolFull {
+				full = append(full, reqs[i])
+			} else if err != nil {
+				s.Logger.Println("[Error]:", s.ServerID.ID.Name, "reject request", err)
+			}
+		}
+		if len(full) == 0 {
+			return
 		}
-		// time.Sleep(40 * time.Millisecond)
+		reqs = full
+		time.Sleep(10 * time.Millisecond)
 	}
 }
 
@@ -87,24 +87,21 @@ func AutoGenNewReq(simulateServers []*server.Server, params []string) {
 	}
 
 	for _, s := range simulateServers {
-		s.BatchSize = paramInt[1]
+		s.SetBatchSize(paramInt[1])
 	}
 
 	count := 0
 	// reqs := ReadReq(paramInt[1]*paramInt[0], paramInt[2])
-	reqs := ReadReq(paramInt[1], paramInt[2])
+	cmds := ReadCmds(paramInt[1], paramInt[2])
 	startMsg := &message.ServerMsg{SendServer: "start", Payload: []byte{byte(len(simulateServers))}}
 	msgJson, _ := json.Marshal(startMsg)
-	conn := p2p.Send(simulateServers[0].Clients["c_0"].Conn, simulateServers[0].Clients["c_0"].Addr, append(msgJson, []byte("\n")...))
-	if conn != nil {
-		simulateServers[0].Clients["c_0"].Conn = conn
-	}
+	simulateServers[0].SendClient(server.DEFAULT_CLIENT, msgJson)
 
 	// generate chained request according to the parameters
 	for i := 0; i < paramInt[0]; i++ {
 		fmt.Println(i)
-		// reqs[0].Cmd[0] = byte(i)
-		GenNewReq(simulateServers, reqs)
+		// the same commands are signed as new requests in every round, or they are rejected as the replayed ones
+		GenNewReq(simulateServers, SignCmd(cmds))
 		// time.Sleep(30 * time.Millisecond)
 		count += paramInt[1]
 		// reqs = ReadReq(paramInt[1], paramInt[2])
@@ -113,11 +110,20 @@ func AutoGenNewReq(simulateServers []*server.Server, params []string) {
 }
 
 // ReadReq: read request from file
+// note: the signatures in file only sign the commands, so the commands are signed again as new requests
 // params:
 // - count:  the count of the request want to read
 // - length: the length of the request want to read
 func ReadReq(count int, length int) []bcrequest.BCRequest {
-	reqs := make([]bcrequest.BCRequest, count)
+	return SignCmd(ReadCmds(count, length))
+}
+
+// ReadCmds: read the commands of requests from file, each command is followed by its signature in file
+// params:
+// - count:  the count of the request want to read
+// - length: the length of the request want to read
+func ReadCmds(count int, length int) [][]byte {
+	cmds := make([][]byte, count)
 	file, err := os.Open("../../config/request/request" + strconv.Itoa(length))
 	if err != nil {
 		file, err = os.Open("./config/request/request" + strconv.Itoa(length))
@@ -137,16 +143,7 @@ func ReadReq(count int, length int) []bcrequest.BCRequest {
 			cmd := []byte{}
 			json.Unmarshal(scanner.Bytes(), &cmd)
 			if scanner.Scan() {
-				sign := []byte{}
-				json.Unmarshal(scanner.Bytes(), &sign)
-				reqs[i] = bcrequest.BCRequest{
-					Id:   "c_0",
-					Cmd:  cmd,
-					Sign: sign,
-				}
-				// reqs[i] = req
-				// signs[i] = sign
-
+				cmds[i] = cmd
 			} else {
 				log.Fatalf("Failed to read signature to file: %v", err)
 				i--
@@ -159,25 +156,120 @@ func ReadReq(count int, length int) []bcrequest.BCRequest {
 		}
 	}
 
-	return reqs
+	return cmds
 }
 
-// SignCmd: generate the signature for the command
+// ParseCmds: parse the input words to commands, the commands are separated by ';'
+// e.g. "put a 1; get a" is parsed to two commands "put a 1" and "get a"
+// params:
+// - input: the words of the input after the operation
+// return:
+// - the byte slice of each command
+func ParseCmds(input []string) [][]byte {
+	cmds := make([][]byte, 0)
+	for _, cmd := range strings.Split(strings.Join(input, " "), ";") {
+		cmd = strings.TrimSpace(cmd)
+		if len(cmd) != 0 {
+			cmds = append(cmds, []byte(cmd))
+		}
+	}
+	return cmds
+}
+
+// reqSeq: the sequence number of the last signed request of client
+// it starts from the current time, so that the sequence numbers keep increasing after the client restarts
+var reqSeq atomic.Uint64
+
+// nextSeq: get a new sequence number of client, which is larger than all given ones
+func nextSeq() uint64 {
+	for {
+		last := reqSeq.Load()
+		seq := uint64(time.Now().UnixNano())
+		if seq <= last {
+			seq = last + 1
+		}
+		if reqSeq.CompareAndSwap(last, seq) {
+			return seq
+		}
+	}
+}
+
+var (
+	operator     *ssm2.Signer // the key of the default client, see Operator
+	operatorLock sync.Mutex
+)
+
+// Operator: get the key of the default client, which is the operator of the system, the key is generated in the process
+// unless it is loaded by LoadOperator, so no key of the operator is kept in the repository
+// note: the simulated servers are given its public key by GenServers
+func Operator() *ssm2.Signer {
+	operatorLock.Lock()
+	defer operatorLock.Unlock()
+	if operator == nil {
+		operator = ssm2.NewSigners(1)[0]
+		operator.ID = server.DEFAULT_CLIENT
+	}
+	return operator
+}
+
+// LoadOperator: load the key of the operator from the directory written by GenClusterConfigs
+// params:
+// - dir: the directory of private.pem and public.pem
+// return:
+// - error if the key files are not found
+func LoadOperator(dir string) error {
+	sk := ssm2.ReadKey(filepath.Join(dir, "private.pem"))
+	pk := ssm2.ReadKey(filepath.Join(dir, "public.pem"))
+	if len(sk) == 0 || len(pk) == 0 {
+		return errors.New("key files of the operator are not found in " + dir)
+	}
+	operatorLock.Lock()
+	defer operatorLock.Unlock()
+	operator = &ssm2.Signer{ID: server.DEFAULT_CLIENT, Sk: sk, Pk: pk, Pks: make(map[string][]byte)}
+	return nil
+}
+
+// SignCmd: generate the requests of the default client for the commands, each request gets a new sequence number
+// and is signed with its client id and sequence number by the key of the operator
 // params:
 // - cmds: the command to be signed
 func SignCmd(cmds [][]byte) []bcrequest.BCRequest {
-	signer := ssm2.Signer{}
-	signer.Sk = signer.GetSKFromFile()
-	signer.Pk = signer.GetPKFromFile()
+	return SignClientCmd(server.DEFAULT_CLIENT, Operator(), cmds)
+}
+
+// SignClientCmd: generate the requests of the client for the commands
+// params:
+// - id:     the client id
+// - signer: the signer with the key of client
+// - cmds:   the command to be signed
+func SignClientCmd(id string, signer *ssm2.Signer, cmds [][]byte) []bcrequest.BCRequest {
 	count := len(cmds)
 	reqs := make([]bcrequest.BCRequest, len(cmds))
 	for i := 0; i < count; i++ {
 		reqs[i] = bcrequest.BCRequest{
-			Id:   "c_0",
-			Cmd:  cmds[i],
-			Sign: signer.Sign(cmds[i]),
+			Id:  id,
+			Seq: nextSeq(),
+			Cmd: cmds[i],
 		}
+		reqs[i].Sign = signer.Sign(reqs[i].SignedBytes())
 	}
 
 	return reqs
 }
+
+// RegisterClient: generate the request to register the client with the key of signer
+// params:
+// - id:     the client id, which must start with bcrequest.CLIENT_PREFIX
+// - signer: the signer with the key of client
+// - addr:   the address of client to recieve the replies
+func RegisterClient(id string, signer *ssm2.Signer, addr string) bcrequest.BCRequest {
+	return SignClientCmd(id, signer, [][]byte{bcrequest.RegisterCmd(signer.Pk, addr)})[0]
+}
+
+// RevokeClient: generate the request to revoke the key of client
+// params:
+// - id:     the client id
+// - signer: the signer with the key of client
+func RevokeClient(id string, signer *ssm2.Signer) bcrequest.BCRequest {
+	return SignClientCmd(id, signer, [][]byte{bcrequest.RevokeCmd()})[0]
+}
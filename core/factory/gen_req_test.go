@@ -1,18 +1,28 @@
 package factory_test
 
 import (
+	"bcrequest"
+	"bufio"
+	"bytes"
+	common "common"
+	"config"
+	"encoding/json"
 	"factory"
 	"fmt"
+	"message"
+	"mgmt"
+	"net"
+	"server"
+	"slices"
 	"ssm2"
 	"testing"
 	"time"
-
-	"github.com/xlcetc/cryptogm/sm/sm2"
+	"transport"
 )
 
 // TestReadReq: read the request and verify the signature
 func TestReadReq(t *testing.T) {
-	pk := ssm2.ReadKey("../../config/client/public.pem")
+	pk := factory.Operator().Pk
 	length := 128
 	count := 1000
 
@@ -21,7 +31,7 @@ func TestReadReq(t *testing.T) {
 	start := time.Now()
 	for j := 0; j < count; j++ {
 		for i := 0; i < count; i++ {
-			if !sm2.Sm2Verify(req[i].Sign, pk, req[i].Cmd) {
+			if !req[i].Verify(pk) {
 				fmt.Println("error", i)
 				return
 			}
@@ -29,3 +39,569 @@ func TestReadReq(t *testing.T) {
 	}
 	fmt.Println("all true", time.Since(start)/time.Duration(count*1000))
 }
+
+// TestReplayedReqs: test the committed request sent again and the request changed after signing are dropped,
+// and the new request is still committed
+func TestReplayedReqs(t *testing.T) {
+	path := t.TempDir()
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC)
+	defer factory.StopAll(testServers)
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+
+	reqs := factory.SignCmd(factory.ParseCmds([]string{"put a 1"}))
+	factory.GenNewReq(testServers, reqs)
+	time.Sleep(time.Second)
+	height := testServers[0].Orderer.GetBlockStore().Height
+
+	// the committed request is replayed
+	factory.GenNewReq(testServers, reqs)
+	time.Sleep(time.Second)
+
+	// the command is changed but the signature is kept
+	changed := factory.SignCmd(factory.ParseCmds([]string{"put a 2"}))
+	changed[0].Cmd = []byte("put a 3")
+	factory.GenNewReq(testServers, changed)
+	time.Sleep(time.Second)
+
+	for _, s := range testServers {
+		fmt.Println(s.ServerID.ID.Name, "height:", s.Orderer.GetBlockStore().Height)
+		if s.Orderer.GetBlockStore().Height != height {
+			t.Fatal("invalid request is committed by", s.ServerID.ID.Name)
+		}
+	}
+
+	factory.GenNewReq(testServers, factory.SignCmd(factory.ParseCmds([]string{"put a 4"})))
+	time.Sleep(time.Second)
+	for _, s := range testServers {
+		if s.Orderer.GetBlockStore().Height != height+1 {
+			t.Fatal("request is not committed by", s.ServerID.ID.Name, s.Orderer.GetBlockStore().Height)
+		}
+	}
+}
+
+// TestClientRegistry: test a client registers its key by consensus and recieves the results of its own requests,
+// and its requests are rejected after the key is revoked
+func TestClientRegistry(t *testing.T) {
+	path := t.TempDir()
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC)
+	defer factory.StopAll(testServers)
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+
+	// the client listens for the replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	replies := make(chan *message.ServerMsg, 64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+				for scanner.Scan() {
+					if msg := message.DecodeMsg(scanner.Bytes()); msg != nil {
+						replies <- msg
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	signer := ssm2.NewSigners(1)[0]
+	factory.GenNewReq(testServers, []bcrequest.BCRequest{factory.RegisterClient("c_1", signer, ln.Addr().String())})
+	time.Sleep(time.Second)
+	for _, s := range testServers {
+		if _, err := s.GetClient("c_1"); err != nil {
+			t.Fatal("client is not registered by", s.ServerID.ID.Name)
+		}
+	}
+
+	factory.GenNewReq(testServers, factory.SignClientCmd("c_1", signer, factory.ParseCmds([]string{"put x 1"})))
+	time.Sleep(time.Second)
+	got := 0
+	for len(replies) > 0 {
+		msg := <-replies
+		if msg.ReciServer != "c_1" {
+			t.Fatal("reply to", msg.ReciServer, "is sent to c_1")
+		}
+		var reply struct{ Results []string }
+		json.Unmarshal(msg.Payload, &reply)
+		fmt.Println(msg.SendServer, reply.Results)
+		if len(reply.Results) == 1 {
+			got++
+		}
+	}
+	if got == 0 {
+		t.Fatal("no reply is recieved by c_1")
+	}
+
+	factory.GenNewReq(testServers, []bcrequest.BCRequest{factory.RevokeClient("c_1", signer)})
+	time.Sleep(time.Second)
+	height := testServers[0].Orderer.GetBlockStore().Height
+
+	// the revoked client can't commit requests
+	factory.GenNewReq(testServers, factory.SignClientCmd("c_1", signer, factory.ParseCmds([]string{"put x 2"})))
+	time.Sleep(time.Second)
+	for _, s := range testServers {
+		if _, err := s.GetClient("c_1"); err != bcrequest.ErrUnknownClient {
+			t.Fatal("client is not revoked by", s.ServerID.ID.Name)
+		}
+		if s.Orderer.GetBlockStore().Height != height {
+			t.Fatal("request of revoked client is committed by", s.ServerID.ID.Name)
+		}
+	}
+}
+
+// TestMempoolReqs: test the requests more than a batch are gossiped to all replicas and committed in several blocks,
+// and they are evicted from the mempools of all replicas after commit
+func TestMempoolReqs(t *testing.T) {
+	path := t.TempDir()
+	conf := config.DefaultConfig()
+	conf.BatchSize = 4
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC, conf)
+	defer factory.StopAll(testServers)
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+	height := testServers[0].Orderer.GetBlockStore().Height
+
+	factory.GenNewReq(testServers, factory.SignCmd(factory.ParseCmds([]string{"put a 1; put b 2; put c 3; put d 4; put e 5; put f 6; put g 7; put h 8; put i 9; put j 10"})))
+	time.Sleep(3 * time.Second)
+	for _, s := range testServers {
+		if s.Orderer.GetBlockStore().Height < height+3 {
+			t.Fatal("requests are not committed by", s.ServerID.ID.Name)
+		}
+		if s.Mempool.Len() != 0 {
+			t.Fatal("committed requests are not evicted by", s.ServerID.ID.Name)
+		}
+	}
+}
+
+// TestCoordinator: test the reconfigurations from an operator are committed and applied by all replicas,
+// and the coordinator retunes the batch size toward the target weighting
+func TestCoordinator(t *testing.T) {
+	path := t.TempDir()
+	conf := config.DefaultConfig()
+	conf.BatchSize = 8
+	conf.Admission = true
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC, conf)
+	defer factory.StopAll(testServers)
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+
+	factory.GenNewReq(testServers, factory.SignCmd([][]byte{
+		bcrequest.ReconfigCommand(bcrequest.RECONFIG_BATCH, "32"),
+		bcrequest.ReconfigCommand(bcrequest.RECONFIG_TIMEOUT, "3000"),
+		bcrequest.ReconfigCommand(bcrequest.RECONFIG_ADMIT, "r_4"),
+		bcrequest.ReconfigCommand(bcrequest.RECONFIG_PROTOCOL, string(common.PBFT)),
+	}))
+	time.Sleep(time.Second)
+	for _, s := range testServers {
+		switchTo, ok := s.ProtocolSwitch()
+		if s.BatchSize() != 32 || s.Knobs().Timeout != 3*time.Second || !s.Admitted("r_4") || !ok || switchTo != common.PBFT {
+			t.Fatal("reconfiguration is not applied by", s.ServerID.ID.Name, s.Knobs())
+		}
+	}
+
+	// the coordinator measures the committed requests, and doubles the batch size for scalability
+	c := testServers[0].NewCoordinator(server.NewStrategy(config.Config{DcsTarget: [3]float64{0, 0, 1}}), factory.SignCmd)
+	factory.GenNewReq(testServers, factory.SignCmd(factory.ParseCmds([]string{"put a 1; put b 2; put c 3"})))
+	time.Sleep(time.Second)
+	actions := c.Step()
+	fmt.Println(c.Point, actions)
+	time.Sleep(time.Second)
+	for _, s := range testServers {
+		if s.BatchSize() != 64 {
+			t.Fatal("batch size is not retuned by", s.ServerID.ID.Name, s.BatchSize())
+		}
+	}
+}
+
+// TestProtocolSwitch: test the committed switch halts all replicas at the same block and the consensus of another protocol
+// continues from it, the requests in flight with the switch and the later ones are all committed
+func TestProtocolSwitch(t *testing.T) {
+	cases := []struct{ from, to common.ConsensusType }{
+		{common.HOTSTUFF_PROTOCOL_BASIC, common.PBFT},
+		{common.PBFT, common.HOTSTUFF_2_PROTOCOL},
+		{common.HOTSTUFF_2_PROTOCOL, common.FAST_HOTSTUFF_PROTOCOL},
+		{common.FAST_HOTSTUFF_PROTOCOL, common.BULLSHARK},
+		{common.BULLSHARK, common.HOTSTUFF_PROTOCOL_CHAINED},
+		{common.HOTSTUFF_PROTOCOL_CHAINED, common.HOTSTUFF_PROTOCOL_BASIC},
+	}
+	for _, c := range cases {
+		t.Run(string(c.from)+"_"+string(c.to), func(t *testing.T) {
+			path := t.TempDir()
+			conf := config.DefaultConfig()
+			conf.BatchSize = 4
+			testServers := factory.GenServers(4, path, c.from, mgmt.BASIC, conf)
+			defer factory.StopAll(testServers)
+			factory.AddSigners(testServers, c.to)
+			factory.GenFirstRound(testServers, path)
+			time.Sleep(time.Second)
+
+			cmds := [][]byte{bcrequest.ReconfigCommand(bcrequest.RECONFIG_PROTOCOL, string(c.to))}
+			cmds = append(cmds, factory.ParseCmds([]string{"put a 1; put b 2; put c 3; put d 4; put e 5; put f 6; put g 7"})...)
+			reqs := factory.SignCmd(cmds)
+			factory.GenNewReq(testServers, reqs)
+			switched := func() bool {
+				for _, s := range testServers {
+					if s.Orderer.ConsType != c.to {
+						return false
+					}
+				}
+				return true
+			}
+			for deadline := time.Now().Add(5 * time.Second); !switched(); time.Sleep(100 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("consensus is not switched to", c.to)
+				}
+			}
+
+			// the pipelined consensus commits a block once the later ones are proposed, so the requests are submitted until all are committed
+			reqs = append(reqs, factory.SignCmd(factory.ParseCmds([]string{"put x 1; put y 2"}))...)
+			factory.GenNewReq(testServers, reqs[len(reqs)-2:])
+			committed := func() bool {
+				for _, s := range testServers {
+					for i := range reqs {
+						if s.Orderer.ReqValidator.Check(&reqs[i]) != bcrequest.ErrReplayed {
+							return false
+						}
+					}
+				}
+				return true
+			}
+			for deadline, i := time.Now().Add(10*time.Second), 0; !committed(); i++ {
+				if time.Now().After(deadline) {
+					t.Fatal("requests are not committed after switching to", c.to)
+				}
+				factory.GenNewReq(testServers, factory.SignCmd(factory.ParseCmds([]string{fmt.Sprintf("put z %d", i)})))
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			// the replicas commit the same chain, and the requests in flight with the switch are committed by the new consensus,
+			// the height of block store is not comparable between protocols, so the committed blocks are read from the storage
+			tips := make([]int, len(testServers))
+			for i, s := range testServers {
+				tip, err := s.Orderer.GetBlockStore().GetStorage().GetBlockHeight()
+				if err != nil {
+					t.Fatal(err)
+				}
+				tips[i] = tip
+			}
+			var hash []byte
+			for _, s := range testServers {
+				blk, err := s.Orderer.GetBlockStore().GetStorage().ReadBlock(slices.Min(tips))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if hash == nil {
+					hash = blk.Hash()
+				} else if !bytes.Equal(hash, blk.Hash()) {
+					t.Fatal("the chain forks at", s.ServerID.ID.Name, slices.Min(tips))
+				}
+			}
+			txs := make(map[string]bool)
+			for i := 0; i <= tips[0]; i++ {
+				blk, err := testServers[0].Orderer.GetBlockStore().GetStorage().ReadBlock(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, tx := range blk.BlkData.Trans {
+					txs[tx] = true
+				}
+			}
+			for _, req := range reqs {
+				if !txs[string(req.Encode())] {
+					t.Fatal("request", string(req.Cmd), "is not in the chain")
+				}
+			}
+		})
+	}
+}
+
+// TestNodeJoinExit: test the join and exit committed as reconfigurations take effect at the same height on all replicas,
+// and the nodes of each epoch commit the later requests, the threshold signers of each epoch are generated by the nodes,
+// which keep the group key by resharing or share a new one if the key is rotated, the changes are applied by each node manager
+func TestNodeJoinExit(t *testing.T) {
+	for _, tc := range []struct {
+		consType common.ConsensusType
+		nmType   mgmt.NodeManagerType
+		rotate   bool
+	}{
+		{common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC, false},
+		{common.HOTSTUFF_PROTOCOL_CHAINED, mgmt.BASIC, false},
+		{common.HOTSTUFF_2_PROTOCOL, mgmt.BASIC, false},
+		{common.FAST_HOTSTUFF_PROTOCOL, mgmt.BASIC, false},
+		{common.PBFT, mgmt.BASIC, false},
+		{common.BULLSHARK, mgmt.BASIC, false},
+		{common.HOTSTUFF_2_PROTOCOL, mgmt.BASIC, true},
+		{common.HOTSTUFF_2_PROTOCOL, mgmt.BFT_SMART, false},
+		{common.HOTSTUFF_2_PROTOCOL, mgmt.BASED_HISTORY, false},
+	} {
+		name := string(tc.consType)
+		if tc.nmType != mgmt.BASIC {
+			name += "/" + string(tc.nmType)
+		}
+		if tc.rotate {
+			name += "/rotate"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := t.TempDir()
+			conf := config.DefaultConfig()
+			conf.BatchSize = 4
+			conf.RotateKey = tc.rotate
+			if tc.nmType == mgmt.BFT_SMART {
+				conf.ViewManager = server.DEFAULT_CLIENT
+			}
+			testServers := factory.GenServers(4, path, tc.consType, tc.nmType, conf)
+			defer func() { factory.StopAll(testServers) }()
+			factory.GenFirstRound(testServers, path)
+			time.Sleep(time.Second)
+			groupKey := testServers[0].Orderer.PublicKey()
+
+			// the nodes of the epoch share the epoch, and commit the requests submitted to them
+			checkEpoch := func(number int) {
+				synced := func() bool {
+					for _, s := range testServers {
+						epoch := s.NodeManager.Epoch
+						if epoch.Number != number || epoch.Height != testServers[0].NodeManager.Epoch.Height || len(epoch.Nodes) != len(testServers) {
+							return false
+						}
+					}
+					return true
+				}
+				for deadline := time.Now().Add(5 * time.Second); !synced(); time.Sleep(100 * time.Millisecond) {
+					if time.Now().After(deadline) {
+						t.Fatal("the nodes are not in epoch", number)
+					}
+				}
+
+				reqs := factory.SignCmd(factory.ParseCmds([]string{fmt.Sprintf("put epoch %d", number)}))
+				committed := func() bool {
+					for _, s := range testServers {
+						if s.Orderer.ReqValidator.Check(&reqs[0]) != bcrequest.ErrReplayed {
+							return false
+						}
+					}
+					return true
+				}
+				for deadline, i := time.Now().Add(10*time.Second), 0; !committed(); i++ {
+					if time.Now().After(deadline) {
+						t.Fatal("requests are not committed in epoch", number)
+					}
+					factory.GenNewReq(testServers, append(reqs, factory.SignCmd(factory.ParseCmds([]string{fmt.Sprintf("put z %d", i)}))...))
+					time.Sleep(200 * time.Millisecond)
+				}
+
+				// the nodes share the group key, which is kept unless it is rotated, the signers of pbft are not threshold signers
+				if tc.consType == common.PBFT {
+					return
+				}
+				for _, s := range testServers {
+					if key := s.Orderer.PublicKey(); !bytes.Equal(key, testServers[0].Orderer.PublicKey()) || bytes.Equal(key, groupKey) == tc.rotate {
+						t.Fatal("the group key is not generated in epoch", number)
+					}
+				}
+			}
+
+			factory.NewBHServerJoin(&testServers)
+			if len(testServers) != 5 {
+				t.Fatal("the node is not created")
+			}
+			checkEpoch(1)
+
+			exited := testServers[4]
+			if err := factory.ServerExit(&testServers, "r_4"); err != nil {
+				t.Fatal(err)
+			}
+			defer exited.Orderer.Stop()
+			checkEpoch(2)
+
+			// the exited node stops at the block of exit, which is sent by the nodes of the epoch if it falls behind
+			for deadline := time.Now().Add(5 * time.Second); exited.NodeManager.Epoch.Number != 2 || exited.IsMember(); time.Sleep(100 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the exit is not applied by the exited node")
+				}
+			}
+		})
+	}
+}
+
+// lossyTransport: the in-process transport which loses the messages to a node matched by lost
+type lossyTransport struct {
+	*transport.ChanTransport
+	reci string                // the node the messages are lost to
+	lost func(msg []byte) bool // whether the encoded server message is lost
+}
+
+// Unicast: send the message unless it is lost
+func (lt *lossyTransport) Unicast(msg []byte, reciName string, sendName string) {
+	if reciName == lt.reci && lt.lost(msg) {
+		return
+	}
+	lt.ChanTransport.Unicast(msg, reciName, sendName)
+}
+
+// TestRekeyLostDeal: test the messages of the generation of the signers from r_3 are lost to r_2 after r_4 joins,
+// so r_2 certifies the deals without the one of r_3 at the timeout while the other nodes certify all deals,
+// and the nodes agree on the dealers, so that all nodes generate the signers of the same new group key and commit the requests
+func TestRekeyLostDeal(t *testing.T) {
+	path := t.TempDir()
+	conf := config.DefaultConfig()
+	conf.BatchSize = 4
+	conf.RotateKey = true
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_2_PROTOCOL, mgmt.BASIC, conf)
+	defer func() { factory.StopAll(testServers) }()
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+	groupKey := testServers[0].Orderer.PublicKey()
+
+	ct, ok := testServers[3].Transport.(*transport.ChanTransport)
+	if !ok {
+		t.Fatal("the transport isn't in-process")
+	}
+	testServers[3].Transport = &lossyTransport{ChanTransport: ct, reci: "r_2", lost: func(msg []byte) bool {
+		serMsg := message.DecodeMsg(msg)
+		if serMsg == nil || serMsg.SType != message.NODEMGMT {
+			return false
+		}
+		nmMsg := mgmt.NodeMgmtMsg{}
+		return json.Unmarshal(serMsg.Payload, &nmMsg) == nil && nmMsg.NMType == mgmt.NM_DKG
+	}}
+
+	factory.NewBHServerJoin(&testServers)
+	if len(testServers) != 5 {
+		t.Fatal("the node is not created")
+	}
+	shared := func() bool {
+		for _, s := range testServers {
+			key := s.Orderer.PublicKey()
+			if bytes.Equal(key, groupKey) || !bytes.Equal(key, testServers[0].Orderer.PublicKey()) {
+				return false
+			}
+		}
+		return true
+	}
+	for deadline := time.Now().Add(3 * server.DKG_TIMEOUT); !shared(); time.Sleep(100 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the nodes don't share the new group key")
+		}
+	}
+
+	reqs := factory.SignCmd(factory.ParseCmds([]string{"put lost deal"}))
+	committed := func() bool {
+		for _, s := range testServers {
+			if s.Orderer.ReqValidator.Check(&reqs[0]) != bcrequest.ErrReplayed {
+				return false
+			}
+		}
+		return true
+	}
+	for deadline, i := time.Now().Add(10*time.Second), 0; !committed(); i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("requests are not committed with the new group key")
+		}
+		factory.GenNewReq(testServers, append(reqs, factory.SignCmd(factory.ParseCmds([]string{fmt.Sprintf("put z %d", i)}))...))
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// TestViewManager: test the replicas of bftsmart only apply the joins and exits sent by the view manager of config
+func TestViewManager(t *testing.T) {
+	path := t.TempDir()
+	conf := config.DefaultConfig()
+	conf.BatchSize = 4
+	conf.ViewManager = "c_9"
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_2_PROTOCOL, mgmt.BFT_SMART, conf)
+	defer func() { factory.StopAll(testServers) }()
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+
+	// the join signed by the default client is committed, but it isn't applied
+	factory.NewBHServerJoin(&testServers)
+	defer testServers[4].Orderer.Stop()
+	reqs := factory.SignCmd(factory.ParseCmds([]string{"put view 1"}))
+	committed := func() bool {
+		for _, s := range testServers[:4] {
+			if s.Orderer.ReqValidator.Check(&reqs[0]) != bcrequest.ErrReplayed {
+				return false
+			}
+		}
+		return true
+	}
+	for deadline, i := time.Now().Add(10*time.Second), 0; !committed(); i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("requests are not committed")
+		}
+		factory.GenNewReq(testServers[:4], append(reqs, factory.SignCmd(factory.ParseCmds([]string{fmt.Sprintf("put z %d", i)}))...))
+		time.Sleep(200 * time.Millisecond)
+	}
+	for _, s := range testServers[:4] {
+		if epoch := s.NodeManager.Epoch; epoch.Number != 0 || len(s.GetNodeNames()) != 4 {
+			t.Fatal("the join which is not sent by the view manager is applied", epoch)
+		}
+	}
+}
+
+// TestHistoryVotes: test the admission of basedhistory is committed only with the votes of a quorum of nodes,
+// the votes which are too few, repeated or signed by another node can't certify it
+func TestHistoryVotes(t *testing.T) {
+	path := t.TempDir()
+	conf := config.DefaultConfig()
+	conf.BatchSize = 4
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_2_PROTOCOL, mgmt.BASED_HISTORY, conf)
+	defer func() { factory.StopAll(testServers) }()
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+
+	votes := make([]mgmt.Vote, 0)
+	for _, s := range testServers[:3] {
+		vote, err := s.SignVote(bcrequest.RECONFIG_ADMIT, "r_7")
+		if err != nil {
+			t.Fatal(err)
+		}
+		votes = append(votes, vote)
+	}
+	forged := votes[0]
+	forged.Voter = "r_3"
+	for i, vs := range [][]mgmt.Vote{
+		votes[:2],
+		{votes[0], votes[0], votes[1]},
+		{votes[0], votes[1], forged},
+	} {
+		req, err := testServers[0].CertifiedReq(slices.Clone(vs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range testServers {
+			if err := s.Orderer.ReqValidator.Check(&req); err != bcrequest.ErrNotCertified {
+				t.Fatal("the admission without the votes of a quorum is accepted", i, err)
+			}
+		}
+	}
+
+	req, err := testServers[1].CertifiedReq(votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory.GenNewReq(testServers, []bcrequest.BCRequest{req})
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		admitted := true
+		for _, s := range testServers {
+			admitted = admitted && s.Admitted("r_7")
+		}
+		if admitted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the admission certified by a quorum is not applied")
+		}
+	}
+}
@@ -3,31 +3,51 @@ package factory
 import (
 	mysm4 "bccrypto/encrypt_sm4"
 	common "common"
+	"config"
 	"fmt"
 	"mgmt"
 	"server"
 	"strconv"
+	"time"
+	"transport"
 )
 
+// WATCH_INTERVAL: the interval of checking whether the leader can propose the requests left in the mempool
+const WATCH_INTERVAL = 20 * time.Millisecond
+
 // GenServers: generate servers
 // params:
 // nodeNum: 	the number of nodes in the system
 // pathe: 		the path of block storage
 // consType: 	the consensus protocol type selected by the server
 // nmType: 	the node manager type selected by the server
+// confs: 	the optional system config, the operator is the key of Operator if its public key is not given
 // return a slice of nodeNum server instances
-func GenServers(nodeNum int, path string, consType common.ConsensusType, nmType mgmt.NodeManagerType) []*server.Server {
+func GenServers(nodeNum int, path string, consType common.ConsensusType, nmType mgmt.NodeManagerType, confs ...config.Config) []*server.Server {
 
 	// declare simulate nodes and channel belong to node
 	// the initial generated nodes all use the same nodesChannel
 	var simulateNodes []*server.Server
 	nodesChannel := make(map[string]chan []byte)
 
+	// the simulated system is operated by the key generated in the process
+	if len(confs) == 0 {
+		confs = []config.Config{config.DefaultConfig()}
+	}
+	if len(confs[0].OperatorKey) == 0 {
+		confs[0].OperatorKey = Operator().Pk
+	}
+
+	// the replicas listen on localhost if the addresses of tcp transport are not given
+	if confs[0].Transport == string(transport.TCP) && len(confs[0].Peers) == 0 {
+		confs[0].Peers = config.LocalPeers(nodeNum)
+	}
+
 	// generate n signers that satisfy the condition of threshold 2f+1 or the sm2 signer for pbft
 	newSigners := GenSigners(consType, nodeNum)
 	for i := 0; i < nodeNum; i++ {
 		nodeName := "r_" + strconv.Itoa(i)
-		newNode, err := server.NewServer(i, nodeNum, path, consType, mgmt.BASIC, newSigners[i], nodesChannel)
+		newNode, err := server.NewServer(i, nodeNum, path, consType, nmType, newSigners[i], nodesChannel, confs...)
 		if err != nil {
 			fmt.Println("error:", err)
 		} else {
@@ -35,9 +55,10 @@ func GenServers(nodeNum int, path string, consType common.ConsensusType, nmType
 			nodesChannel[nodeName] = newNode.ServerID.Address
 		}
 
-		// start two process to handle the message and handle requests
+		// start three process to handle the message, handle requests and propose the requests left in the mempool
 		go simulateNodes[i].RouteServerMsg(simulateNodes[i].NodeManager.NodesChannel[nodeName])
 		go simulateNodes[i].HandleReq()
+		go simulateNodes[i].WatchReqs(WATCH_INTERVAL)
 		// go simulateNodes[i].StartServer()
 	}
 
@@ -48,6 +69,7 @@ func GenServers(nodeNum int, path string, consType common.ConsensusType, nmType
 				simulateNodes[i].NodeManager.NodesTable[simulateNodes[j].ServerID.ID.Name] = mgmt.NodeKey{
 					Name:      simulateNodes[j].ServerID.ID.Name,
 					Sm2PubKey: simulateNodes[j].ServerID.ID.PubKey,
+					DkgPubKey: simulateNodes[j].DKGPublicKey(),
 				}
 				if j > i {
 					sm4PK := mysm4.GenerateKey()
@@ -58,5 +80,10 @@ func GenServers(nodeNum int, path string, consType common.ConsensusType, nmType
 		}
 	}
 
+	// the node manager based on history votes for its admissions and evictions by the key of each node
+	for _, s := range simulateNodes {
+		s.StartHistory()
+	}
+
 	return simulateNodes
 }
@@ -1,14 +1,25 @@
 package factory_test
 
 import (
+	"bufio"
+	"bytes"
 	common "common"
+	"config"
 	"encoding/json"
 	"factory"
+	"fmt"
 	hstypes "hotstuff/types"
 	"message"
 	"mgmt"
+	"net"
+	"server"
+	"ssm2"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
+	"transport"
+	"wire"
 )
 
 // TestGenServer: test func GenServer
@@ -27,7 +38,7 @@ func TestGenServer(t *testing.T) {
 		Payload:    testPayload,
 	}
 
-	testMJson, _ := message.EncodeMsg(testMsg)
+	testMJson, _ := message.EncodeMsg(testMsg, wire.JSON)
 
 	for _, s := range testServers {
 		s.NodeManager.NodesChannel[s.ServerID.ID.Name] <- testMJson
@@ -35,3 +46,157 @@ func TestGenServer(t *testing.T) {
 
 	time.Sleep(5 * time.Second)
 }
+
+// TestForgedMsgs: test the forged messages injected into a running cluster are dropped and counted,
+// and the cluster still commits requests after that
+func TestForgedMsgs(t *testing.T) {
+	path := t.TempDir()
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC)
+	defer factory.StopAll(testServers)
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+
+	target := testServers[0]
+	inject := func(msg message.ServerMsg) {
+		msgJson, _ := message.EncodeMsg(msg, wire.BINARY)
+		target.NodeManager.NodesChannel[target.ServerID.ID.Name] <- msgJson
+	}
+	payload, _ := json.Marshal(hstypes.Msg{MType: hstypes.NEW_VIEW, SendNode: "r_1", ReciNode: "r_0"})
+
+	// 1. signed by a key which doesn't belong to the sender
+	key := ssm2.NewSigners(1)[0]
+	forger := &server.Server{}
+	forger.ServerID.PrivateKey, forger.ServerID.ID.PubKey = key.Sk, key.Pk
+	forged := message.ServerMsg{SType: message.ORDER, SendServer: "r_1", ReciServer: "r_0", Payload: payload}
+	forger.SignMsg(&forged)
+	inject(forged)
+
+	// 2. unknown sender and no signature
+	inject(message.ServerMsg{SType: message.ORDER, SendServer: "r_9", ReciServer: "Broadcast", Payload: payload})
+
+	// 3. the header of a valid message is changed
+	valid := message.ServerMsg{SType: message.NODEMGMT, SendServer: "r_2", ReciServer: "r_0", Payload: payload}
+	testServers[2].SignMsg(&valid)
+	changed := valid
+	changed.SType = message.ORDER
+	inject(changed)
+
+	// 4. a valid message to another server is replayed
+	replayed := message.ServerMsg{SType: message.ORDER, SendServer: "r_3", ReciServer: "r_1", Payload: payload}
+	testServers[3].SignMsg(&replayed)
+	inject(replayed)
+
+	// 5. the bytes can't be decoded
+	target.NodeManager.NodesChannel[target.ServerID.ID.Name] <- []byte("forged")
+
+	time.Sleep(500 * time.Millisecond)
+	rejected := target.GetRejectedMsgs()
+	fmt.Println("rejected:", rejected)
+	if rejected["r_1"] != 1 || rejected["r_2"] != 1 || rejected["r_3"] != 1 || rejected[server.UNKNOWN_SENDER] != 2 {
+		t.Fatal("wrong rejected counters", rejected)
+	}
+
+	// the honest messages are still accepted
+	factory.GenNewReq(testServers, factory.SignCmd(factory.ParseCmds([]string{"put a 1"})))
+	time.Sleep(2 * time.Second)
+	for _, s := range testServers {
+		if s.Orderer.GetBlockStore().Height < 2 {
+			t.Fatal("request is not committed by", s.ServerID.ID.Name, s.Orderer.GetBlockStore().Height)
+		}
+		for name, count := range s.GetRejectedMsgs() {
+			if s != target && count != 0 {
+				t.Fatal("honest message is rejected", s.ServerID.ID.Name, name)
+			}
+		}
+	}
+}
+
+// TestJSONOnlyPeer: test the cluster on the tcp transport with a JSON-only replica, r_3 is listened by the reader of an old replica,
+// which never replies the hello frame and can't read the binary frames, so the other replicas encode their messages to it by JSON,
+// and r_3 commits the requests as the others
+func TestJSONOnlyPeer(t *testing.T) {
+	path := t.TempDir()
+	conf := config.DefaultConfig()
+	conf.Transport = string(transport.TCP)
+	conf.Peers = make(map[string]string)
+	for i := 0; i < 5; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.Peers["r_"+strconv.Itoa(i)] = ln.Addr().String()
+		ln.Close()
+	}
+	spare := conf.Peers["r_4"]
+	delete(conf.Peers, "r_4")
+	testServers := factory.GenServers(4, path, common.HOTSTUFF_PROTOCOL_BASIC, mgmt.BASIC, conf)
+	defer func() {
+		factory.StopAll(testServers)
+		for _, s := range testServers {
+			s.CloseTransport()
+		}
+	}()
+
+	// r_3 sends by its own transport listening on the spare address, and the old reader takes over its address
+	old := testServers[3]
+	old.CloseTransport()
+	peers := make(map[string]string)
+	for name, addr := range conf.Peers {
+		peers[name] = addr
+	}
+	peers["r_3"] = spare
+	tt, err := transport.NewTCPTransport("r_3", peers, old.ServerID.Address, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.Transcode = old.TranscodeMsg
+	old.Transport = tt
+
+	ln, err := net.Listen("tcp", conf.Peers["r_3"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var binary atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					msg, err := transport.ReadFrame(reader)
+					if err != nil {
+						return
+					}
+					switch {
+					case bytes.HasPrefix(msg, []byte(transport.HelloMagic)):
+					case wire.IsBinary(msg):
+						binary.Add(1)
+					default:
+						old.ServerID.Address <- msg
+					}
+				}
+			}()
+		}
+	}()
+
+	factory.GenFirstRound(testServers, path)
+	time.Sleep(time.Second)
+	factory.GenNewReq(testServers, factory.SignCmd(factory.ParseCmds([]string{"put a 1"})))
+	deadline := time.Now().Add(15 * time.Second)
+	for _, s := range testServers {
+		for s.Orderer.GetBlockStore().Height < 2 {
+			if time.Now().After(deadline) {
+				t.Fatal("request is not committed by", s.ServerID.ID.Name, s.Orderer.GetBlockStore().Height)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if n := binary.Load(); n != 0 {
+		t.Fatal("the JSON-only replica is sent", n, "binary messages")
+	}
+}
@@ -2,29 +2,34 @@ package factory
 
 import (
 	common "common"
-	"ssm2"
-	"tss"
+	"orderer"
+	"server"
 )
 
-// GenSigners: generate n signers that satisfy the condition of threshold 2f+1
-// or the sm2 signer for pbft
+// GenSigners: generate n signers by the protocol registered for the consensus type,
+// such as the signers that satisfy the condition of threshold 2f+1 or the sm2 signers for pbft
 // params:
 // - consType:the consensus protocol type
 // - nodeNum: the node number
+// return:
+// - the signers, which is empty if the consensus type is unknown
 func GenSigners(consType common.ConsensusType, nodeNum int) []interface{} {
-	newSignes := make([]interface{}, 0)
-	if consType == common.PBFT {
-		// pbft protocol use ssm2
-		ssm2Signers := ssm2.NewSigners(nodeNum)
-		for _, v := range ssm2Signers {
-			newSignes = append(newSignes, v)
-		}
-	} else {
-		// other protocol use BLS Threshold signature
-		tssSigners := tss.NewSigners(nodeNum, (nodeNum-1)/3*2+1)
-		for _, v := range tssSigners {
-			newSignes = append(newSignes, v)
+	p, err := orderer.LookupProtocol(consType)
+	if err != nil {
+		return make([]interface{}, 0)
+	}
+	return p.NewSigners(nodeNum)
+}
+
+// AddSigners: generate the signers of the protocols which the servers may switch to, and provide them to the servers
+// params:
+// - servers:   the servers in the system
+// - consTypes: the consensus protocol types
+func AddSigners(servers []*server.Server, consTypes ...common.ConsensusType) {
+	for _, consType := range consTypes {
+		signers := GenSigners(consType, len(servers))
+		for i := range signers {
+			servers[i].AddSigner(consType, signers[i])
 		}
 	}
-	return newSignes
 }
@@ -34,3 +34,44 @@ func TestSigners(t *testing.T) {
 		}
 	}
 }
+
+// TestStoreAndLoadSigner: test the signers loaded from files sign and verify as the generated ones
+func TestStoreAndLoadSigner(t *testing.T) {
+	msg := []byte("hello signer")
+	dir := t.TempDir()
+
+	tssSigners := factory.GenSigners(common.HOTSTUFF_PROTOCOL_BASIC, 4)
+	for i, s := range tssSigners {
+		if err := factory.StoreSigner(s, fmt.Sprint(dir, "/tss", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sigs := make([][]byte, 0)
+	for i := 0; i < 3; i++ {
+		s, err := factory.LoadSigner(common.HOTSTUFF_PROTOCOL_BASIC, fmt.Sprint(dir, "/tss", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := s.(*tss.Signer).ThresholdSign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, sig)
+	}
+	comSig, err := tssSigners[3].(*tss.Signer).CombineSig(msg, sigs)
+	if err != nil || !tssSigners[3].(*tss.Signer).ThresholdSignVerify(msg, comSig) {
+		t.Fatal("verify the signature of loaded threshold signers failed", err)
+	}
+
+	sm2Signers := factory.GenSigners(common.PBFT, 4)
+	if err := factory.StoreSigner(sm2Signers[0], dir+"/sm2"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := factory.LoadSigner(common.PBFT, dir+"/sm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sm2Signers[1].(*ssm2.Signer).VerifySign("r_0", s.(*ssm2.Signer).Sign(msg), msg) {
+		t.Fatal("verify the signature of loaded sm2 signer failed")
+	}
+}
@@ -2,40 +2,59 @@ package factory
 
 import (
 	mysm4 "bccrypto/encrypt_sm4"
-	common "common"
+	"bcrequest"
+	"bftsmart"
+	"errors"
 	"mgmt"
+	"orderer"
 	"server"
 	"strconv"
 	"time"
-	"tss"
 )
 
-// NewServerJoin: create a new node and have it initiate a join request to the system
+// ADMIT_TIMEOUT: the time to wait for the admission of the node applying to join by the node manager based on history
+const ADMIT_TIMEOUT = 5 * time.Second
+
+// NewBHServerJoin: create a new node storing blocks in the path of the system and have it initiate a join request to the system,
+// the node joins when the reconfiguration "dcs join <node>" submitted after its application is committed,
+// which is signed by the view manager in bftsmart, or submitted after the node is admitted by its history in basedhistory
 // params:
 // simulateServers: the slice of nodes in system
 func NewBHServerJoin(simulateServers *[]*server.Server) {
 
 	// create new node
 	nodeName := "r_" + strconv.Itoa(len(*simulateServers))
-	tSigner := tss.NewSigners(1, 1)
+	consType := (*simulateServers)[0].Orderer.ConsType
+	nmType := (*simulateServers)[0].NMType
 	newServer, err := server.NewServer(
 		len(*simulateServers),
 		len(*simulateServers),
-		"./BCData",
-		(*simulateServers)[0].Orderer.ConsType,
-		mgmt.BASIC,
-		tSigner[0],
+		(*simulateServers)[0].Orderer.Consensus.Options().Path,
+		consType,
+		nmType,
+		GenSigners(consType, 1)[0],
 		make(map[string]chan []byte),
+		(*simulateServers)[0].Config,
 	)
 	if err != nil {
 		return
 	}
 
+	// in the pbft consensus, the new node synchronize the public keys of nodes in the original system
+	if newPBFT, ok := newServer.Orderer.Consensus.(*orderer.PBFT); ok {
+		for _, s := range *simulateServers {
+			p := s.Orderer.Consensus.(*orderer.PBFT)
+			newPBFT.Signer.Pks[s.ServerID.ID.Name] = p.Signer.Pk
+			p.Signer.Pks[newServer.ServerID.ID.Name] = newPBFT.Signer.Pk
+		}
+	}
+
 	// update new node information
 	newServer.NodeManager.NodesChannel[nodeName] = newServer.ServerID.Address
 
 	newServer.NodeManager.NewNode.Name = newServer.ServerID.ID.Name
 	newServer.NodeManager.NewNode.NodeKey.Sm2PubKey = newServer.ServerID.ID.PubKey
+	newServer.NodeManager.NewNode.NodeKey.DkgPubKey = newServer.DKGPublicKey()
 	newServer.NodeManager.NewNode.Chan = newServer.ServerID.Address
 
 	// add PubKey of nodes in system
@@ -46,54 +65,98 @@ func NewBHServerJoin(simulateServers *[]*server.Server) {
 			Name:      node.ServerID.ID.Name,
 			Sm2PubKey: node.ServerID.ID.PubKey,
 			Sm4Key:    sm4PK,
+			DkgPubKey: node.DKGPublicKey(),
 		}
 	}
 
-	// start two process to handle the message and handle requests
+	// start three process to handle the message, handle requests and propose the requests left in the mempool
 	go newServer.RouteServerMsg(newServer.NodeManager.NodesChannel[nodeName])
 	go newServer.HandleReq()
+	go newServer.WatchReqs(WATCH_INTERVAL)
+
+	newServer.StartNodeJoin(*simulateServers)
 
-	go newServer.StartNodeJoin(*simulateServers)
-	// joinMsg := hstypes.Msg{}
+	// the join is committed by the nodes in system, then the nodes generate the signers of the next epoch with the new node
+	switch nmType {
+	case mgmt.BFT_SMART:
+		GenNewReq(*simulateServers, executeUpdates(*simulateServers, func(vm *bftsmart.ViewManager) error { return vm.AddServer(nodeName) }))
+	case mgmt.BASED_HISTORY:
+		waitAdmitted(*simulateServers, nodeName)
+		GenNewReq(*simulateServers, SignCmd([][]byte{bcrequest.ReconfigCommand(bcrequest.RECONFIG_JOIN, nodeName)}))
+	default:
+		GenNewReq(*simulateServers, SignCmd([][]byte{bcrequest.ReconfigCommand(bcrequest.RECONFIG_JOIN, nodeName)}))
+	}
 
 	// add new node to the slice of simulated nodes
 	*simulateServers = append(*simulateServers, newServer)
-	// fmt.Println("In", len(newServer.NodeManager.NodesTable))
-	go func(t int) {
-		time.Sleep(time.Duration(t) * time.Millisecond)
-		UpdateSigners(*simulateServers)
-	}(100)
 }
 
-// UpdateSigners: update simulateServers' orderer signer
+// ServerExit: commit the exit of the node, then the exited node deals its share of the threshold key to the other nodes
+// note: the leader is elected by the number of nodes, so the node with the highest number exits to keep the names contiguous
 // params:
 // simulateServers: the slice of nodes in system
-func UpdateSigners(simulateServers []*server.Server) {
-	nodeNum := len(simulateServers)
-	newsigners := tss.NewSigners(nodeNum, (nodeNum-1)/3*2+1)
-
-	switch simulateServers[0].Orderer.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		for i := 0; i < nodeNum; i++ {
-			simulateServers[i].Orderer.BasicHotstuff.ThresholdSigner = newsigners[i]
-			simulateServers[i].Orderer.BasicHotstuff.Logger.Println("[SIGNER_UPDATE]:", (simulateServers)[i].ServerID.ID.Name, "succeed")
-		}
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		for i := 0; i < nodeNum; i++ {
-			simulateServers[i].Orderer.ChainedHotstuff.ThresholdSigner = newsigners[i]
-			simulateServers[i].Orderer.ChainedHotstuff.Logger.Println("[SIGNER_UPDATE]:", (simulateServers)[i].ServerID.ID.Name, "succeed")
+// name: 			the name of exit node
+// return:
+// - error if the node is not in the system
+func ServerExit(simulateServers *[]*server.Server, name string) error {
+	servers := make([]*server.Server, 0, len(*simulateServers))
+	for _, s := range *simulateServers {
+		if s.ServerID.ID.Name != name {
+			servers = append(servers, s)
 		}
-	case common.HOTSTUFF_2_PROTOCOL:
-		for i := 0; i < nodeNum; i++ {
-			simulateServers[i].Orderer.Hotstuff2.ThresholdSigner = newsigners[i]
-			simulateServers[i].Orderer.Hotstuff2.Logger.Println("[SIGNER_UPDATE]:", (simulateServers)[i].ServerID.ID.Name, "succeed")
+	}
+	if len(servers) == len(*simulateServers) {
+		return errors.New("unknown node " + name)
+	}
+
+	if servers[0].NMType == mgmt.BFT_SMART {
+		reqs := executeUpdates(*simulateServers, func(vm *bftsmart.ViewManager) error { return vm.RemoveServer(name) })
+		if len(reqs) == 0 {
+			return errors.New("the view manager refuses to remove node " + name)
 		}
-	case common.PBFT:
-	// for i := 0; i < nodeNum; i++ {
-	// 	simulateServers[i].Orderer.PBFTConsensus.ThresholdSigner = newsigners[i]
-	// 	simulateServers[i].Orderer.PBFTConsensus.Logger.Println("[SIGNER_UPDATE]:", (simulateServers)[i].ServerID.ID.Name, "succeed")
-	// }
-	default:
+		GenNewReq(servers, reqs)
+	} else {
+		GenNewReq(servers, SignCmd([][]byte{bcrequest.ReconfigCommand(bcrequest.RECONFIG_EXIT, name)}))
+	}
+	*simulateServers = servers
+	return nil
+}
 
+// executeUpdates: update the view of the nodes by the view manager of bftsmart, which signs the joins and exits by the default client
+// params:
+// - simulateServers: the nodes of the current view
+// - update:          add or remove the servers of the next view
+// return:
+// - the signed joins and exits, empty if the view is not updated
+func executeUpdates(simulateServers []*server.Server, update func(vm *bftsmart.ViewManager) error) []bcrequest.BCRequest {
+	s := simulateServers[0]
+	vm := bftsmart.NewViewManager(s.NodeManager.Epoch.Number, s.GetNodeNames(), SignCmd)
+	if err := update(vm); err != nil {
+		s.Logger.Println("[Error]: the view manager refuses the update", err)
+		return nil
+	}
+	reqs, err := vm.ExecuteUpdates()
+	if err != nil {
+		s.Logger.Println("[Error]: the view manager refuses the update", err)
+		return nil
+	}
+	return reqs
+}
+
+// waitAdmitted: wait until the node applying to join is admitted by the nodes, or ADMIT_TIMEOUT passes
+// params:
+// - simulateServers: the nodes in system
+// - name:            the node applying to join
+func waitAdmitted(simulateServers []*server.Server, name string) {
+	admitted := func() bool {
+		for _, s := range simulateServers {
+			if !s.Admitted(name) {
+				return false
+			}
+		}
+		return true
+	}
+	for deadline := time.Now().Add(ADMIT_TIMEOUT); !admitted() && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
 	}
 }
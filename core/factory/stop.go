@@ -6,8 +6,9 @@ import "server"
 func StopAll(servers []*server.Server) {
 	for _, s := range servers {
 		s.Orderer.Stop()
-		if s.Clients["c_0"].Conn != nil {
-			(*s.Clients["c_0"].Conn).Close()
-		}
+		s.StopCoordinator()
+		s.StopHistory()
+		s.StopWatchReqs()
+		s.CloseClients()
 	}
 }
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"message"
+	"mgmt"
+
+	"github.com/xlcetc/cryptogm/sm/sm2"
+	"github.com/xlcetc/cryptogm/sm/sm3"
+)
+
+// UNKNOWN_SENDER: the counter name of the rejected messages whose sender is unknown or which can't be decoded
+const UNKNOWN_SENDER = "unknown"
+
+// MAX_LATER_MSGS: the max number of the kept consensus messages of later epochs, see keepLater
+const MAX_LATER_MSGS = 4096
+
+var (
+	ErrUnknownSender = errors.New("unknown sender")
+	ErrBadSignature  = errors.New("signature verification failed")
+	ErrWrongReciever = errors.New("message is not sent to this server")
+)
+
+// SignMsg: sign the type, the sender, the reciever and the payload of message by the private key of server
+// params:
+// - msg: the message to be signed, the signature is set to msg.Sign
+// return:
+// - error
+func (s *Server) SignMsg(msg *message.ServerMsg) error {
+	h := sm3.SumSM3(msg.SignedBytes())
+	sign, err := sm2.Sm2Sign(s.ServerID.PrivateKey, s.ServerID.ID.PubKey, h[:])
+	if err != nil {
+		return err
+	}
+	msg.Sign = sign
+	return nil
+}
+
+// VerifyMsg: check the message is sent to this server and signed by its sender
+// params:
+// - msg: the recieved message
+// return:
+// - nil if the message is authenticated, or the reason to reject it
+func (s *Server) VerifyMsg(msg *message.ServerMsg) error {
+	switch msg.ReciServer {
+	case s.ServerID.ID.Name, "Broadcast", "Gossip":
+	default:
+		return ErrWrongReciever
+	}
+
+	pk := s.senderKey(msg)
+	if len(pk) == 0 {
+		return ErrUnknownSender
+	}
+	h := sm3.SumSM3(msg.SignedBytes())
+	if !sm2.Sm2Verify(msg.Sign, pk, h[:]) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// senderKey: get the SM2 public key of the sender of message
+// the node applying to join is not in the nodes table yet, its key is taken from the join message,
+// and the node exited by the last change of nodes is kept to deal its share of the threshold key
+func (s *Server) senderKey(msg *message.ServerMsg) []byte {
+	if nk, ok := s.NodeManager.NodesTable[msg.SendServer]; ok && len(nk.Sm2PubKey) != 0 {
+		return nk.Sm2PubKey
+	}
+	if msg.SType == message.NODEMGMT {
+		s.reconfLock.Lock()
+		nk, ok := s.dealers[msg.SendServer]
+		s.reconfLock.Unlock()
+		if ok && len(nk.Sm2PubKey) != 0 {
+			return nk.Sm2PubKey
+		}
+	}
+	if msg.SendServer == s.NodeManager.NewNode.Name {
+		return s.NodeManager.NewNode.NodeKey.Sm2PubKey
+	}
+	if msg.SType == message.NODEMGMT {
+		nmMsg := &mgmt.NodeMgmtMsg{}
+		if json.Unmarshal(msg.Payload, nmMsg) == nil && nmMsg.Type == mgmt.JOIN && nmMsg.NMType == mgmt.NM_APPLY && nmMsg.SendNode == msg.SendServer {
+			return nmMsg.NodeKey.Sm2PubKey
+		}
+	}
+	return nil
+}
+
+// RejectMsg: count and log a rejected message
+// params:
+// - sender: the claimed sender of message, the messages of unknown senders are counted together
+// - err:    the reason to reject the message
+func (s *Server) RejectMsg(sender string, err error) {
+	if _, ok := s.NodeManager.NodesTable[sender]; !ok {
+		sender = UNKNOWN_SENDER
+	}
+
+	s.rejectLock.Lock()
+	if s.rejected == nil {
+		s.rejected = make(map[string]int)
+	}
+	s.rejected[sender]++
+	s.rejectLock.Unlock()
+
+	s.Logger.Println("[REJECT]:", s.ServerID.ID.Name, "drop message from", sender, err)
+}
+
+// GetRejectedMsgs: get the number of rejected messages of each peer
+func (s *Server) GetRejectedMsgs() map[string]int {
+	s.rejectLock.Lock()
+	defer s.rejectLock.Unlock()
+
+	rejected := make(map[string]int, len(s.rejected))
+	for name, count := range s.rejected {
+		rejected[name] = count
+	}
+	return rejected
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bcrequest"
+	ci "clientinfo"
+	"p2p"
+)
+
+// DEFAULT_CLIENT: the operator whose public key is given by config.OperatorKey, which is registered at startup
+// and signs the commands from the console
+const DEFAULT_CLIENT = "c_0"
+
+// GetClient: get the info of a registered client, the client registered by consensus is added when it is used firstly,
+// and the revoked one is removed
+// params:
+// - id: the client id
+// return:
+// - the client info, and bcrequest.ErrUnknownClient if the client is not registered or has been revoked,
+// or the server has no request validator
+func (s *Server) GetClient(id string) (*ci.ClientInfo, error) {
+	if s.Orderer.ReqValidator == nil {
+		return nil, bcrequest.ErrUnknownClient
+	}
+	var entry, registered = s.Orderer.ReqValidator.Client(id)
+
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	c, ok := s.Clients[id]
+	if !registered {
+		if ok {
+			if c.Conn != nil {
+				(*c.Conn).Close()
+			}
+			delete(s.Clients, id)
+		}
+		return nil, bcrequest.ErrUnknownClient
+	}
+	if !ok {
+		c = &ci.ClientInfo{
+			Name: id,
+			Addr: entry.Addr,
+			Pk:   entry.Pk,
+		}
+		s.Clients[id] = c
+	}
+	return c, nil
+}
+
+// SendClient: send the message to the client
+// params:
+// - id:      the client id
+// - msgJson: the encoded message
+// return:
+// - false if the client is not registered
+func (s *Server) SendClient(id string, msgJson []byte) bool {
+	c, err := s.GetClient(id)
+	if err != nil {
+		return false
+	}
+	if c.Addr == "" {
+		return true
+	}
+	conn := p2p.Send(c.Conn, c.Addr, append(msgJson, []byte("\n")...))
+	if conn != nil {
+		s.clientLock.Lock()
+		c.Conn = conn
+		s.clientLock.Unlock()
+	}
+	return true
+}
+
+// CloseClients: close the connections to all clients
+func (s *Server) CloseClients() {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	for _, c := range s.Clients {
+		if c.Conn != nil {
+			(*c.Conn).Close()
+			c.Conn = nil
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bcrequest"
+	"common"
+	"config"
+	"deltachain/common/dcs"
+	"orderer"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ApplyReconfig: retune the replica by the committed reconfiguration, which is called by the request validator
+// in the order of commit, so all replicas are retuned at the same height
+// note: the reconfigurations are applied again when the blocks are replayed after restarting
+// - batch:    the leader pulls the new number of requests from the mempool for each block
+// - timeout:  the pacemaker takes the new base timeout from the next view, and keeps it when the consensus is rebuilt
+// - protocol: the consensus halts at the committed block and is switched by the message router, if the signer of the protocol is given
+// - admit:    the node is admitted to join the system, which is required if Config.Admission is set
+// - join:     the nodes of the next epoch include the node from the next block, and the halted consensus continues with them
+// - exit:     the nodes of the next epoch exclude the node from the next block, and the exited node stops its consensus
+func (s *Server) ApplyReconfig(rc *bcrequest.ReconfigCmd) {
+	// the last retuned knobs are synced to the joined node by the snapshot
+	if rc.Op == bcrequest.RECONFIG_BATCH || rc.Op == bcrequest.RECONFIG_TIMEOUT || rc.Op == bcrequest.RECONFIG_PROTOCOL {
+		s.reconfLock.Lock()
+		s.retuned[rc.Op] = rc.Value
+		s.reconfLock.Unlock()
+	}
+	switch rc.Op {
+	case bcrequest.RECONFIG_BATCH:
+		s.SetBatchSize(rc.Int())
+	case bcrequest.RECONFIG_TIMEOUT:
+		s.Orderer.SetBaseTimeout(time.Duration(rc.Int()) * time.Millisecond)
+	case bcrequest.RECONFIG_PROTOCOL:
+		// the switch to the protocol whose max window is below the pipeline window is not applied by any replica
+		consType := common.ConsensusType(rc.Value)
+		if err := orderer.CheckWindow(consType, s.Orderer.Window); err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "reconfigure", err)
+			return
+		}
+		s.reconfLock.Lock()
+		s.switchTo = consType
+		_, ok := s.signers[consType]
+		s.reconfLock.Unlock()
+
+		// all replicas halt at the committed block and switch, and the switch replayed in recovery is only recorded
+		if ok && consType != s.Orderer.ConsType && !s.recovering.Load() {
+			s.Orderer.Halt()
+			s.reconfLock.Lock()
+			s.switching = consType
+			s.reconfLock.Unlock()
+		}
+	case bcrequest.RECONFIG_ADMIT:
+		s.reconfLock.Lock()
+		s.admitted[rc.Value] = true
+		s.reconfLock.Unlock()
+	case bcrequest.RECONFIG_JOIN, bcrequest.RECONFIG_EXIT:
+		s.applyNodes(rc)
+	}
+	s.Logger.Println("[RECONFIG]:", s.ServerID.ID.Name, rc.Op, rc.Value)
+}
+
+// ProtocolSwitch: get the consensus protocol switched to by the committed reconfiguration
+// return:
+// - the protocol, and false if no switch is committed or the protocol is running
+func (s *Server) ProtocolSwitch() (common.ConsensusType, bool) {
+	s.reconfLock.Lock()
+	defer s.reconfLock.Unlock()
+	return s.switchTo, s.switchTo != "" && s.switchTo != s.Orderer.ConsType
+}
+
+// Admitted: check whether the node has been admitted to join the system by the committed reconfiguration
+func (s *Server) Admitted(name string) bool {
+	s.reconfLock.Lock()
+	defer s.reconfLock.Unlock()
+	return s.admitted[name]
+}
+
+// Knobs: get the current parameters of the replica, which are tuned by the coordinator
+func (s *Server) Knobs() dcs.Knobs {
+	protocol := s.Orderer.ConsType
+	if switchTo, ok := s.ProtocolSwitch(); ok {
+		protocol = switchTo
+	}
+	return dcs.Knobs{
+		BatchSize: s.BatchSize(),
+		Timeout:   s.Orderer.Consensus.Pacemaker().BaseTimeout(),
+		Protocol:  string(protocol),
+		Nodes:     s.GetNodeNames(),
+	}
+}
+
+// NewStrategy: create the strategy of coordinator by the system config
+func NewStrategy(conf config.Config) dcs.Strategy {
+	strategy := dcs.NewStrategy(dcs.Weights{D: conf.DcsTarget[0], C: conf.DcsTarget[1], S: conf.DcsTarget[2]})
+	strategy.FastProtocol = conf.DcsFastProtocol
+	strategy.ScaleProtocol = conf.DcsScaleProtocol
+	strategy.Candidates = conf.DcsCandidates
+	return strategy
+}
+
+// Coordinator: the DCS strategy coordinator, which measures the running system periodically, scores it on the DCS triangle
+// and submits the reconfigurations proposed by the strategy to move toward the target,
+// the reconfigurations are ordered by consensus and applied by every replica on commit, see Server.ApplyReconfig
+// note: only one replica of the system needs to run the coordinator
+type Coordinator struct {
+	Strategy dcs.Strategy                              // the strategy which decides the reconfigurations
+	Point    dcs.Point                                 // the point of the system measured last time
+	server   *Server                                   // the replica which measures the system and submits the reconfigurations
+	sign     func(cmds [][]byte) []bcrequest.BCRequest // sign the reconfigurations by an operator, that is, a client given at startup
+	txs      atomic.Uint64                             // the number of committed transactions
+	lastTxs  uint64                                    // the number of committed transactions at the last measurement
+	lastTime time.Time                                 // the time of the last measurement
+	quit     chan struct{}                             // closed to stop the coordinator
+}
+
+// NewCoordinator: create the coordinator on the replica
+// params:
+// - strategy: the strategy which decides the reconfigurations
+// - sign:     sign the reconfigurations by an operator
+// return:
+// - the coordinator
+func (s *Server) NewCoordinator(strategy dcs.Strategy, sign func(cmds [][]byte) []bcrequest.BCRequest) *Coordinator {
+	c := &Coordinator{
+		Strategy: strategy,
+		server:   s,
+		sign:     sign,
+		lastTime: time.Now(),
+		quit:     make(chan struct{}),
+	}
+	s.Orderer.ReqValidator.OnCommit(func(txs []string) {
+		c.txs.Add(uint64(len(txs)))
+	})
+	return c
+}
+
+// Measure: measure the number of nodes, the commit latency observed by the pacemaker
+// and the throughput since the last measurement
+func (c *Coordinator) Measure() dcs.Metrics {
+	now := time.Now()
+	txs := c.txs.Load()
+	m := dcs.Metrics{
+		Nodes:   len(c.server.GetNodeNames()),
+		Latency: c.server.GetPacemakerMetrics().SmoothedLatency.Seconds(),
+	}
+	if elapsed := now.Sub(c.lastTime).Seconds(); elapsed > 0 {
+		m.Throughput = float64(txs-c.lastTxs) / elapsed
+	}
+	c.lastTime, c.lastTxs = now, txs
+	return m
+}
+
+// Step: measure the system, and submit the reconfigurations decided by the strategy,
+// the ones which have been committed are not submitted again
+// return:
+// - the submitted reconfigurations
+func (c *Coordinator) Step() []dcs.Action {
+	m := c.Measure()
+	c.Point = dcs.Measure(m)
+
+	actions := make([]dcs.Action, 0)
+	cmds := make([][]byte, 0)
+	for _, a := range c.Strategy.Decide(m, c.server.Knobs()) {
+		if a.Admit != "" && c.server.Admitted(a.Admit) {
+			continue
+		}
+		actions = append(actions, a)
+		cmds = append(cmds, ReconfigCmdOf(a))
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	c.server.Logger.Printf("[DCS]: %s D: %.4f, C: %.4f, S: %.4f, reconfigure %q\n", c.server.ServerID.ID.Name, c.Point.D, c.Point.C, c.Point.S, cmds)
+	for _, err := range c.server.SubmitReqs(c.sign(cmds)) {
+		if err != nil {
+			c.server.Logger.Println("[Error]:", c.server.ServerID.ID.Name, "reconfiguration is rejected", err)
+		}
+	}
+	return actions
+}
+
+// StartCoordinator: run the coordinator with the strategy of the system config, if the interval of config is positive
+// params:
+// - sign: sign the reconfigurations by an operator
+func (s *Server) StartCoordinator(sign func(cmds [][]byte) []bcrequest.BCRequest) {
+	if s.Config.Coordinator <= 0 || s.Coordinator != nil {
+		return
+	}
+	s.Coordinator = s.NewCoordinator(NewStrategy(s.Config), sign)
+	go s.Coordinator.Run(time.Duration(s.Config.Coordinator) * time.Millisecond)
+}
+
+// StopCoordinator: stop the coordinator run by the server
+func (s *Server) StopCoordinator() {
+	if s.Coordinator != nil {
+		s.Coordinator.Stop()
+	}
+}
+
+// Run: retune the system periodically until the coordinator is stopped
+// params:
+// - interval: the time between two measurements
+func (c *Coordinator) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Step()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Stop: stop the coordinator
+func (c *Coordinator) Stop() {
+	select {
+	case <-c.quit:
+	default:
+		close(c.quit)
+	}
+}
+
+// ReconfigCmdOf: get the command of reconfiguration for the action of strategy
+func ReconfigCmdOf(a dcs.Action) []byte {
+	switch {
+	case a.BatchSize > 0:
+		return bcrequest.ReconfigCommand(bcrequest.RECONFIG_BATCH, strconv.Itoa(a.BatchSize))
+	case a.Timeout > 0:
+		return bcrequest.ReconfigCommand(bcrequest.RECONFIG_TIMEOUT, strconv.FormatInt(a.Timeout.Milliseconds(), 10))
+	case a.Protocol != "":
+		return bcrequest.ReconfigCommand(bcrequest.RECONFIG_PROTOCOL, a.Protocol)
+	}
+	return bcrequest.ReconfigCommand(bcrequest.RECONFIG_ADMIT, a.Admit)
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bcrequest"
+	"encoding/json"
+	"fmt"
+	"message"
+	"mgmt"
+	"orderer"
+)
+
+// AddEpochSigner: provide the signer of the running protocol for the epoch of nodes, the consensus continues with it
+// when the join or exit starting the epoch is committed, see ChangeNodes
+// note: the signer must fit the nodes of the epoch, such as the threshold signer of the number of nodes,
+// and the signer of the protocol given by AddSigner is used instead if the protocol is switched at the same block
+// params:
+// - epoch:  the number of the epoch
+// - signer: the signer of the server in the epoch
+func (s *Server) AddEpochSigner(epoch int, signer interface{}) {
+	s.reconfLock.Lock()
+	defer s.reconfLock.Unlock()
+	s.epochSigners[epoch] = signer
+}
+
+// applyNodes: change the nodes by the committed join or exit, all replicas go to the next epoch from the next block,
+// then the halted consensus continues with the nodes of the epoch by the message router, see switchHalted,
+// and the joined node is synced by the replicas after the nodes are changed
+// note: the change refused by the node manager is skipped, see checkChange,
+// and the nodes before the first change of the halted block are kept as the dealers of the signers of the epoch
+// note: the change replayed in recovery is skipped if it is committed before the current epoch,
+// otherwise only the number of nodes and the signer of the recovering consensus are changed
+// params:
+// - rc: the committed join or exit
+func (s *Server) applyNodes(rc *bcrequest.ReconfigCmd) {
+	if err := s.checkChange(rc); err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "refuse the", rc.Op, "of node", rc.Value, err)
+		return
+	}
+	before := s.NodeManager.NodesTable
+	var changed bool
+	if rc.Op == bcrequest.RECONFIG_JOIN {
+		changed = s.NodeManager.ApplyJoin(rc.Value, rc.Height+1)
+	} else {
+		changed = s.NodeManager.ApplyExit(rc.Value, rc.Height+1)
+	}
+	if !changed {
+		return
+	}
+
+	// the participation is measured again with the nodes of the epoch, and the exited node waits for the cooldown to join again,
+	// the votes of the last epoch are dropped since they can't certify a change any more
+	epoch := s.NodeManager.Epoch
+	if s.History != nil {
+		if rc.Op == bcrequest.RECONFIG_EXIT {
+			s.History.Exit(rc.Value, epoch.Number)
+		}
+		s.History.Reset()
+		s.reconfLock.Lock()
+		s.votes = make(map[string]map[string]mgmt.Vote)
+		s.certified = make(map[string]bool)
+		s.reconfLock.Unlock()
+	}
+	if s.recovering.Load() {
+		s.applyEpoch()
+		return
+	}
+	s.Orderer.Halt()
+	s.reconfLock.Lock()
+	if !s.changing {
+		s.dealers = before
+	}
+	s.changing = true
+	if rc.Op == bcrequest.RECONFIG_JOIN {
+		s.joiners = append(s.joiners, rc.Value)
+	} else {
+		s.exits = append(s.exits, rc.Value)
+	}
+	s.reconfLock.Unlock()
+}
+
+// applyEpoch: change the number of nodes and the signer of the recovering consensus to the ones of the current epoch
+func (s *Server) applyEpoch() {
+	s.updateTransport()
+	s.Orderer.UpdateNodesNum(len(s.NodeManager.Epoch.Nodes))
+	if signer, err := s.epochSigner(s.NodeManager.Epoch.Number); err == nil {
+		s.Orderer.SetSigner(signer)
+	}
+}
+
+// updateTransport: provide the channels of the nodes of the current epoch to the in-process transport, such as transport.ChanTransport
+// or the one wrapping it, the transport keeps the channels of the last epoch until the halted consensus sends its last messages
+func (s *Server) updateTransport() {
+	if ct, ok := s.Transport.(interface{ SetNodes(map[string]chan []byte) }); ok {
+		ct.SetNodes(s.NodeManager.NodesChannel)
+	}
+}
+
+// epochSendChan: create the channel of the messages sent by the consensus of the epoch, the messages are stamped with the epoch
+// and forwarded to the send channel of server, so the ones sent by the old consensus after the change keep the old epoch
+// params:
+// - epoch: the epoch of the consensus
+// return:
+// - the channel passed to the consensus
+func (s *Server) epochSendChan(epoch int) chan message.ServerMsg {
+	ch := make(chan message.ServerMsg, cap(s.SendChan))
+	go func() {
+		for msg := range ch {
+			msg.Epoch = epoch
+			s.SendChan <- msg
+		}
+	}()
+	return ch
+}
+
+// keepLater: keep the consensus message of a later epoch, which is sent by the replica changed before this one,
+// the messages beyond MAX_LATER_MSGS are dropped
+func (s *Server) keepLater(msg *message.ServerMsg) {
+	if len(s.later) < MAX_LATER_MSGS {
+		s.later = append(s.later, msg)
+	}
+}
+
+// handleLater: handle the kept messages of the epoch of the running consensus in order of arrival,
+// the ones of the later epochs are still kept and the ones of the earlier epochs are dropped
+func (s *Server) handleLater() {
+	later := s.later
+	s.later = nil
+	for _, msg := range later {
+		if epoch := int(s.epoch.Load()); msg.Epoch == epoch {
+			s.SubmitMsg2Consensus(msg.Payload)
+		} else if msg.Epoch > epoch {
+			s.keepLater(msg)
+		}
+	}
+}
+
+// IsMember: check whether the server is one of the nodes of the current epoch
+func (s *Server) IsMember() bool {
+	_, ok := s.NodeManager.NodesTable[s.ServerID.ID.Name]
+	return ok
+}
+
+// nodesNum: get the number of nodes the consensus is rebuilt with, such as by a switch of protocol, which is kept until the nodes are changed
+func (s *Server) nodesNum() int {
+	if s.NodeManager.Epoch.Number == 0 {
+		return s.Orderer.Consensus.Options().NodeNum
+	}
+	return len(s.NodeManager.Epoch.Nodes)
+}
+
+// epochSigner: get the signer of the running protocol for the epoch, the signer isn't changed
+// if it doesn't depend on the number of nodes
+// return:
+// - the signer, and error if the protocol needs a new signer which isn't given
+func (s *Server) epochSigner(epoch int) (interface{}, error) {
+	s.reconfLock.Lock()
+	signer, ok := s.epochSigners[epoch]
+	s.reconfLock.Unlock()
+	if ok {
+		return signer, nil
+	}
+	p, err := orderer.LookupProtocol(s.Orderer.ConsType)
+	if err != nil {
+		return nil, err
+	}
+	if p.Rekey {
+		return nil, fmt.Errorf("no signer for epoch %d", epoch)
+	}
+	return s.Orderer.Consensus.Options().Signer, nil
+}
+
+// ChangeNodes: continue the halted consensus of the running protocol with the nodes and the signer of the current epoch,
+// the consensus of the epoch takes over the block storage and the state machine, and starts on the tip without replaying the blocks,
+// see Orderer.NextEpoch, and the requests proposed but not committed by the last epoch are proposed again
+// return:
+// - error, and the server keeps the old consensus if the signer of the epoch isn't given
+func (s *Server) ChangeNodes() error {
+	s.switchLock.Lock()
+	defer s.switchLock.Unlock()
+
+	epoch := s.NodeManager.Epoch
+	signer, err := s.epochSigner(epoch.Number)
+	if err != nil {
+		return err
+	}
+	s.Orderer.SendChan = s.epochSendChan(epoch.Number)
+	if err := s.Orderer.NextEpoch(len(epoch.Nodes), signer); err != nil {
+		return err
+	}
+	s.Mempool.Requeue()
+	s.Recovered, err = s.recover()
+	if err != nil {
+		return err
+	}
+	s.Orderer.Handover()
+	s.Logger.Println("[EPOCH]:", s.ServerID.ID.Name, "epoch", epoch.Number, "nodes", epoch.Nodes, "Height:", epoch.Height)
+	s.NotifyReq()
+	return nil
+}
+
+// SyncJoiner: send the snapshot of the replicated state, the latest committed blocks and the epoch to the joined node,
+// the blocks are sent in chunks of SYNC_CHUNK_BLOCKS, and the joined node starts the consensus
+// once f+1 replicas of the epoch send the same ones, see HandleEpochSync
+// params:
+// - name: the name of the joined node
+// - rk:   the generation of the signers of the epoch which the joined node takes part in, empty if the signers are given
+func (s *Server) SyncJoiner(name string, rk mgmt.Rekey) {
+	snapshot, blks, err := s.syncState()
+	if err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "sync the joined node", name, err)
+		return
+	}
+	chunks := (len(blks) + mgmt.SYNC_CHUNK_BLOCKS - 1) / mgmt.SYNC_CHUNK_BLOCKS
+	for i := 0; i < chunks; i++ {
+		msg := mgmt.NodeMgmtMsg{
+			Type:     mgmt.JOIN,
+			NMType:   mgmt.NM_SYNC,
+			Epoch:    s.NodeManager.Epoch,
+			Rekey:    rk,
+			Block:    blks[i*mgmt.SYNC_CHUNK_BLOCKS : min((i+1)*mgmt.SYNC_CHUNK_BLOCKS, len(blks))],
+			Chunk:    i,
+			Chunks:   chunks,
+			SendNode: s.ServerID.ID.Name,
+			ReciNode: name,
+		}
+		if i == 0 {
+			msg.Snapshot = snapshot
+		}
+		msgJson, err := json.Marshal(msg)
+		if err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "sync the joined node", name, err)
+			return
+		}
+		s.SendMsg(message.ServerMsg{
+			SType:      message.NODEMGMT,
+			SendServer: s.ServerID.ID.Name,
+			ReciServer: name,
+			Payload:    msgJson,
+		})
+	}
+}
+
+// syncEpoch: the joined node restores the snapshot selected from the sync messages and stores the committed blocks,
+// the snapshot is persisted so the blocks are replayed from it after restarting, then the node starts the consensus of the epoch
+// from the tip as the replicas, and the consensus messages of the epoch recieved before are handled
+// note: the joined node takes part in the generation of the signers of the epoch first if the replicas generate them
+// params:
+// - msg: the selected sync message
+// return:
+// - error if the blocks are broken or the consensus can't continue
+func (s *Server) syncEpoch(msg *mgmt.NodeMgmtMsg) error {
+	// the blocks are the same as sent by f+1 replicas, so only the block data is checked against the header
+	for i := range msg.Block {
+		blk := &msg.Block[i]
+		if err := blk.VerifyBlockData(); err != nil {
+			return fmt.Errorf("the synced block %d is broken: %v", blk.BlkHdr.Height, err)
+		}
+	}
+	bs := s.Orderer.GetBlockStore()
+	storage := bs.GetStorage()
+	tip, err := storage.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+	for _, blk := range msg.Block {
+		if blk.BlkHdr.Height <= tip {
+			continue
+		}
+		if err := storage.WriteBlock(blk); err != nil {
+			return err
+		}
+	}
+
+	// the state machine is replaced by the snapshot, and the blocks after it are replayed as the consensus continues
+	if err := s.Orderer.Consensus.Options().StateMachine.Restore(msg.Snapshot.State); err != nil {
+		return err
+	}
+	if err := bs.SaveSnapshot(msg.Snapshot); err != nil {
+		return err
+	}
+	if err := s.restoreConfig(msg.Snapshot.Config); err != nil {
+		return err
+	}
+	s.NodeManager.SetEpoch(msg.Epoch)
+	s.updateTransport()
+	if msg.Rekey.Epoch == msg.Epoch.Number && s.needRekey(msg.Epoch.Number) {
+		return s.startRekey(msg.Rekey)
+	}
+	if err := s.ChangeNodes(); err != nil {
+		return err
+	}
+	s.handleLater()
+	return nil
+}
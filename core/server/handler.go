@@ -1,44 +1,47 @@
 package server
 
 import (
-	"bcrequest"
 	"encoding/json"
-	"message"
 	"mgmt"
-	"time"
 )
 
-// HandleReq: the node recieve request and submit or transmit it
+// HandleReq: the leader pulls the requests from the mempool and proposes them when it is waked up
 func (s *Server) HandleReq() {
 	for s.Orderer.ReqState {
 
 		// recieve the flag of submitting the request in a blocking manner
 		<-s.Orderer.ReqFlagChan
 
-		// this lock is required instead of TryLock because a commit must be made to maintain the viability of the system when a commit request message is received.
-		s.RequestsLock.Lock()
+		// the requests are not proposed to the consensus being switched, which hasn't recovered from the block store yet
+		s.switchLock.Lock()
+		s.proposeReqs()
+		s.switchLock.Unlock()
+	}
+}
 
-		// in the basic hotstuff, only the leader put forward a proposal
-		if len(s.Requests) != 0 && len(s.Requests) <= s.BatchSize && s.ServerID.ID.Name == s.Orderer.GetLeaderName() {
-			if s.VerifyReqs() {
-				// fmt.Println("Verify succeed", s.ServerID.ID.Name, s.Orderer.BasicHotstuff.View.ViewNumber)
-				s.Orderer.HandleReq(s.BlkStore.Height, s.BlkStore.PreBlkHash, s.BlkStore.CurBlkHash, s.Requests)
-				s.Requests = make([]bcrequest.BCRequest, 0)
-			} else {
-				// fmt.Println("Verify failed", s.ServerID.ID.Name, s.Orderer.BasicHotstuff.View.ViewNumber)
-				s.Requests = make([]bcrequest.BCRequest, 0)
-			}
-		}
-		s.RequestsLock.Unlock()
+// proposeReqs: pull the requests from the mempool and propose them, if the server is the proposer waiting for the requests
+func (s *Server) proposeReqs() {
+	// only the leader put forward a proposal, or the leader of the next view if the proposals are pipelined,
+	// and the flag set before the leader proposes or the consensus is switched is dropped
+	if s.ServerID.ID.Name != s.Orderer.GetProposerName() || !s.Orderer.IsWaitingReq() {
+		return
+	}
+
+	// the pulled requests are kept in the mempool until they are committed, and pulled again if they are not committed in time
+	reqs := s.VerifyReqs(s.Mempool.Pull(s.BatchSize()))
+	if len(reqs) != 0 {
+		s.Orderer.HandleReq(s.BlkStore.Height, s.BlkStore.PreBlkHash, s.BlkStore.CurBlkHash, reqs)
 	}
 }
 
-// HandleNodeManagerMsg: handle the message to node manager
+// HandleNodeManagerMsg: handle the message to node manager, the nodes are changed by the committed join or exit
+// instead of the messages, which only carry the key of the node applying to join, the state synced to the joined node
+// and the generation of the signers of the epoch
 // params:
 // - payload: the payload of the server message is the encoded ndoe-manager message
 func (s *Server) HandleNodeManagerMsg(payload []byte) {
 	switch s.NMType {
-	case mgmt.BASIC:
+	case mgmt.BASIC, mgmt.BFT_SMART, mgmt.BASED_HISTORY:
 
 		// decode the message
 		msg := &mgmt.NodeMgmtMsg{}
@@ -47,122 +50,41 @@ func (s *Server) HandleNodeManagerMsg(payload []byte) {
 			return
 		}
 
-		// handle the message
-		if msg.Type == mgmt.JOIN {
-			if msg.NMType == mgmt.NM_APPLY {
-
-				// the original node stop and send sync message
-				s.StopOrderer()
-				msgReturn := s.NodeManager.HandleJoin(msg)
-
-				// update orderer and node manager
-				s.Orderer.AddSyncInfo(msgReturn)
-				// fmt.Println(msgReturn.Block[0].BlkData.Trans)
-				s.UpdateNodeInfo(-1)
-
-				// send join message
-				msgJson, err := json.Marshal(msgReturn)
-				if err == nil {
-					go s.SendMsg(message.ServerMsg{
-						SType:      message.NODEMGMT,
-						SendServer: s.ServerID.ID.Name,
-						ReciServer: msgReturn.ReciNode,
-						Payload:    msgJson,
-					})
-				}
-			} else if msg.NMType == mgmt.NM_SYNC {
-
-				// if recieve sync message, the new node sync
-				msgSync, msgReturn := s.NodeManager.HandleSync(msg)
-				if msgSync != -1 && msgReturn != nil && s.NodeManager.State == mgmt.NM_SYNC {
-
-					s.UpdateNodeInfo(msgSync)
-
-					// send join message
-					msgJson, err := json.Marshal(msgReturn)
-					if err == nil {
-						go s.SendMsg(message.ServerMsg{
-							SType:      message.NODEMGMT,
-							SendServer: s.ServerID.ID.Name,
-							ReciServer: msgReturn.ReciNode,
-							Payload:    msgJson,
-						})
-					}
-				}
-			} else if msg.NMType == mgmt.NM_RESTART {
-
-				// recieve the RESTART message, restart the orderer after waiting the signers update
-				for !s.Orderer.IsReady() {
-
-					// for s.Orderer.BasicHotstuff.View.NodesNum!= s.Orderer.BasicHotstuff.ThresholdSigner.SignNum{
-					time.Sleep(10 * time.Millisecond)
-				}
-				s.RestartOrderer()
+		// the signers of the epoch are generated by the nodes after the join or exit is committed
+		if msg.NMType == mgmt.NM_DKG || msg.NMType == mgmt.NM_QUAL {
+			s.HandleDKG(msg)
+			return
+		}
 
-				// if the new node causes the threshold f to change, add an additional empty new view message
-				if s.ServerID.ID.Name == s.Orderer.GetLeaderName() {
-					// n.BasicHotstuff.IgnoreCheckQC = true
+		// the admissions and the evictions of the basedhistory node manager are voted by the nodes
+		if msg.NMType == mgmt.NM_VOTE {
+			s.HandleVote(msg)
+			return
+		}
+		if msg.Type != mgmt.JOIN {
+			return
+		}
 
-					// refresh the leader
-					s.Orderer.FixLeader()
-				}
+		// handle the message
+		if msg.NMType == mgmt.NM_APPLY {
+
+			// the node manager based on history admits the node by its history, and its join is refused until the admission is committed,
+			// otherwise the node which is not admitted by the committed reconfiguration can't join if the admission is required
+			if s.NMType == mgmt.BASED_HISTORY {
+				s.admitByHistory(msg.SendNode)
+			} else if s.Config.Admission && !s.Admitted(msg.SendNode) {
+				s.Logger.Println("[Error]:", s.ServerID.ID.Name, "refuse the join of node", msg.SendNode, "which is not admitted")
+				return
 			}
-		} else if msg.Type == mgmt.EXIT {
-			if msg.NMType == mgmt.NM_APPLY {
-
-				// the original node stop and send agree message
-				s.StopOrderer()
-
-				msgReturn := s.NodeManager.HandleExit(msg)
-
-				// send agree message
-				msgJson, err := json.Marshal(msgReturn)
-				if err == nil {
-					s.SendMsg(message.ServerMsg{
-						SType:      message.NODEMGMT,
-						SendServer: s.ServerID.ID.Name,
-						ReciServer: msgReturn.ReciNode,
-						Payload:    msgJson,
-					})
-				}
-				s.UpdateNodeInfo(-1)
-			} else if msg.NMType == mgmt.NM_AGREE {
-				// the exit node handle the AGREE message
-				msgReturn := s.NodeManager.HandleAgree(msg)
-
-				// send the RESTART message to the rest nodes
-				if msgReturn != nil {
-					msgJson, err := json.Marshal(msgReturn)
-					if err == nil {
-						go s.SendMsg(message.ServerMsg{
-							SType:      message.NODEMGMT,
-							SendServer: s.ServerID.ID.Name,
-							ReciServer: msgReturn.ReciNode,
-							Payload:    msgJson,
-						})
-					}
-				}
-			} else if msg.NMType == mgmt.NM_RESTART {
-
-				// recieve the RESTART message, restart the orderer after waiting the signers update
-				// wait new signer or the new threshold signer
-				for !s.Orderer.IsReady() {
-					time.Sleep(10 * time.Millisecond)
-				}
-
-				// restart the orderer
-				s.RestartOrderer()
-
-				// if the exit node is the leader of current view, need to refresh the leader after updating the node number
-				if msg.SendNode == s.Orderer.GetLeaderName() {
 
-					// refresh the leader
-					s.Orderer.RefreshLeader()
+			// the key of the applying node is kept until its join is committed, and the orderer keeps running
+			s.NodeManager.HandleJoin(msg)
+		} else if msg.NMType == mgmt.NM_SYNC {
 
-					// the leader after refreshing init self for the new proposal
-					if s.ServerID.ID.Name == s.Orderer.GetLeaderName() {
-						s.Orderer.InitLeader()
-					}
+			// the joined node starts the consensus of the epoch once enough replicas send the same state
+			if synced := s.NodeManager.HandleEpochSync(msg); synced != nil {
+				if err := s.syncEpoch(synced); err != nil {
+					s.Logger.Println("[Error]:", s.ServerID.ID.Name, "sync the epoch", synced.Epoch.Number, err)
 				}
 			}
 		}
@@ -11,15 +11,20 @@ func (s *Server) StartNodeJoin(simulateServers []*Server) {
 	s.Logger.Println("Start Node Join", len(s.NodeManager.NodesTable))
 
 	switch s.NMType {
-	case mgmt.BASIC:
+	case mgmt.BASIC, mgmt.BFT_SMART, mgmt.BASED_HISTORY:
 		s.StartBCNodeJoin(simulateServers)
 	}
 }
 
-// StartBCNodeJoin: start a new node join the system by basic method, simulate new node get all orignal node information in system
+// StartBCNodeJoin: start a new node join the system by basic method, simulate new node get all orignal node information in system,
+// the node applies to the nodes with its key, and joins when the reconfiguration "dcs join <node>" is committed
 // params:
 // - simulateServers: the node in system
 func (s *Server) StartBCNodeJoin(simulateServers []*Server) {
+	// the new node doesn't take part in the consensus until it is synced after its join is committed
+	s.Orderer.Halt()
+	s.Orderer.Consensus.Stop()
+
 	// set the node manager mode to JOIN
 	s.NodeManager.Mode = mgmt.JOIN
 	for _, node := range simulateServers {
@@ -37,6 +42,7 @@ func (s *Server) StartBCNodeJoin(simulateServers []*Server) {
 			Name:      s.NodeManager.NewNode.Name,
 			Sm2PubKey: s.ServerID.ID.PubKey,
 			Sm4Key:    nodeKey.Sm4Key,
+			DkgPubKey: s.DKGPublicKey(),
 		}
 		joinMsg := mgmt.NodeMgmtMsg{
 			Type:     mgmt.JOIN,
@@ -46,10 +52,11 @@ func (s *Server) StartBCNodeJoin(simulateServers []*Server) {
 			ReciNode: nodeKey.Name,
 		}
 
-		// send join message
+		// send join message, which is recieved before the join is submitted,
+		// so the nodes know the key of the new node when the join is committed
 		msgJson, err := json.Marshal(joinMsg)
 		if err == nil {
-			go s.SendMsg(message.ServerMsg{
+			s.SendMsg(message.ServerMsg{
 				SType:      message.NODEMGMT,
 				SendServer: s.ServerID.ID.Name,
 				ReciServer: nodeKey.Name,
@@ -1,28 +1,41 @@
 package server
 
 import (
+	"bcrequest"
+	"errors"
 	"fmt"
 	"local"
 	"message"
-	"p2p"
-
-	"github.com/xlcetc/cryptogm/sm/sm2"
-	"github.com/xlcetc/cryptogm/sm/sm3"
+	"strings"
+	"wire"
 )
 
-// SendMsg: convert message to json and send it
+// SendMsg: encode message by the codec of server and send it, the message to client is encoded by JSON
 func (s *Server) SendMsg(msg message.ServerMsg) {
 
+	// the clients read the replies by JSON
+	codec := s.Codec
+	toClient := strings.HasPrefix(msg.ReciServer, bcrequest.CLIENT_PREFIX)
+	if toClient {
+		codec = wire.JSON
+		if msg.SType == message.ORDER {
+			payload, err := s.Orderer.TranscodePayload(msg.Payload, codec)
+			if err != nil {
+				s.Logger.Println("Server transcode payload error", err)
+				return
+			}
+			msg.Payload = payload
+		}
+	}
+
 	// sign the message
-	h := sm3.SumSM3(msg.Payload)
-	sign, err := sm2.Sm2Sign(s.ServerID.PrivateKey, s.ServerID.ID.PubKey, h[:])
+	err := s.SignMsg(&msg)
 	if err != nil {
 		s.Logger.Println("Server sign message error", err)
 		return
 	}
 
-	msg.Sign = sign
-	msgJson, err := message.EncodeMsg(msg)
+	msgJson, err := message.EncodeMsg(msg, codec)
 	if err == nil {
 
 		// simulate network delay
@@ -30,31 +43,54 @@ func (s *Server) SendMsg(msg message.ServerMsg) {
 
 		switch msg.ReciServer {
 		case "Broadcast":
-			local.Broadcast(s.NodeManager.NodesChannel, msgJson, s.ServerID.ID.Name)
+			s.Transport.Broadcast(msgJson, s.ServerID.ID.Name)
 			// s.Logger.Println("[Broadcast]", s.ServerID.ID.Name+" ->", s.NodeManager.GetNodeNames())
 
 		case "Gossip":
-			local.Gossip(s.NodeManager.NodesChannel, msgJson, msg.SendServer)
+			s.Transport.Gossip(msgJson, msg.SendServer)
 			// s.Logger.Println("[Gossip]", s.ServerID.ID.Name+" ->", s.NodeManager.GetOtherNodeNames())
 
-		case "Client":
-			// p2p.SendUdp(s.ClientAddr, append(msgJson, []byte("\n")...))
-			conn := p2p.Send(s.Clients["c_0"].Conn, s.Clients["c_0"].Addr, append(msgJson, []byte("\n")...))
-			if conn != nil {
-				s.Clients["c_0"].Conn = conn
-			}
-			// s.Logger.Println("[SendClient]", s.ServerID.ID.Name+" ->", "Client", len(msgJson))
-
 		case s.NodeManager.NewNode.Name:
 
 			local.Fixedcast(s.NodeManager.NewNode.Chan, msgJson)
 			// s.Logger.Println("[Fixedcast]", s.ServerID.ID.Name+" ->", msg.ReciServer)
 
 		default:
-			local.Unicast(s.NodeManager.NodesChannel, msgJson, msg.ReciServer, s.ServerID.ID.Name)
+			// the replies are routed to the client by its id, and dropped if the client is not registered or has been revoked
+			if toClient {
+				if !s.SendClient(msg.ReciServer, msgJson) {
+					s.Logger.Println("[SendClient]", s.ServerID.ID.Name, "drop the message to unregistered client", msg.ReciServer)
+				}
+				break
+			}
+			s.Transport.Unicast(msgJson, msg.ReciServer, s.ServerID.ID.Name)
 			// s.Logger.Println("[Unicast]", s.ServerID.ID.Name+" ->", msg.ReciServer)
 		}
 	} else {
 		fmt.Println(err)
 	}
 }
+
+// TranscodeMsg: encode the binary message sent by the server again by JSON for a JSON-only replica,
+// the consensus message carried by it is transcoded and the message is signed again, since the signature covers the encoded payload
+// params:
+// - msgBin: the binary message encoded by SendMsg
+// return:
+// - the message encoded by JSON and error
+func (s *Server) TranscodeMsg(msgBin []byte) ([]byte, error) {
+	msg := message.DecodeMsg(msgBin)
+	if msg == nil {
+		return nil, errors.New("can't decode the message")
+	}
+	if msg.SType == message.ORDER {
+		payload, err := s.Orderer.TranscodePayload(msg.Payload, wire.JSON)
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload = payload
+	}
+	if err := s.SignMsg(msg); err != nil {
+		return nil, err
+	}
+	return message.EncodeMsg(*msg, wire.JSON)
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"bcrequest"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"message"
+	"mgmt"
+	"sort"
+	"time"
+
+	"github.com/xlcetc/cryptogm/sm/sm2"
+	"github.com/xlcetc/cryptogm/sm/sm3"
+)
+
+// ViewManager: get the operator whose key is the trusted admin key of the bftsmart node manager, see bftsmart.ViewManager
+// return:
+// - the client id of config.ViewManager, empty if no view manager is given
+func (s *Server) ViewManager() string {
+	return s.Config.ViewManager
+}
+
+// checkChange: check whether the committed join or exit is applied by the node manager, which only depends on the committed requests,
+// so all replicas apply the same changes
+// - bftsmart:     the join or exit must be sent by the view manager
+// - basedhistory: the node must be admitted by the committed reconfiguration to join, which is certified by the votes of the nodes
+// - basic:        the node must be admitted to join if the admission is required by config
+// params:
+// - rc: the committed join or exit
+// return:
+// - nil if the change is applied, or the reason to refuse it
+func (s *Server) checkChange(rc *bcrequest.ReconfigCmd) error {
+	if s.NMType == mgmt.BFT_SMART && (s.ViewManager() == "" || rc.Client != s.ViewManager()) {
+		return fmt.Errorf("it is sent by %s instead of the view manager", rc.Client)
+	}
+	if rc.Op == bcrequest.RECONFIG_JOIN && (s.Config.Admission || s.NMType == mgmt.BASED_HISTORY) && !s.Admitted(rc.Value) {
+		return fmt.Errorf("node %s is not admitted", rc.Value)
+	}
+	return nil
+}
+
+// logParticipation: log the consensus message of the current epoch as the participation of its sender by the basedhistory node manager
+func (s *Server) logParticipation(msg *message.ServerMsg) {
+	if s.History != nil {
+		s.History.Record(msg.SendServer, s.Orderer.Participation(msg.Payload))
+	}
+}
+
+// StartHistory: the basedhistory node manager admits the nodes applying to join by their history,
+// and evicts the inactive nodes periodically if the interval of config is positive,
+// each node votes for the admissions and the evictions by its own key, and they are committed only with the votes of a quorum of nodes,
+// so all replicas apply them at the same height and a single node can't admit or evict nodes, see certify
+func (s *Server) StartHistory() {
+	s.reconfLock.Lock()
+	started := s.historyQuit != nil
+	if s.History != nil && !started {
+		s.historyQuit = make(chan struct{})
+	}
+	s.reconfLock.Unlock()
+	if s.History == nil || started || s.Config.HistoryInterval <= 0 {
+		return
+	}
+	go s.runHistory(time.Duration(s.Config.HistoryInterval) * time.Millisecond)
+}
+
+// StopHistory: stop evicting the inactive nodes
+func (s *Server) StopHistory() {
+	s.reconfLock.Lock()
+	defer s.reconfLock.Unlock()
+	if s.historyQuit == nil {
+		return
+	}
+	select {
+	case <-s.historyQuit:
+	default:
+		close(s.historyQuit)
+	}
+}
+
+// historyStarted: check whether the basedhistory node manager is started, see StartHistory
+func (s *Server) historyStarted() bool {
+	s.reconfLock.Lock()
+	defer s.reconfLock.Unlock()
+	return s.History != nil && s.historyQuit != nil
+}
+
+// runHistory: evict the inactive nodes periodically until it is stopped
+// params:
+// - interval: the time between two checks
+func (s *Server) runHistory(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.EvictInactive()
+		case <-s.historyQuit:
+			return
+		}
+	}
+}
+
+// EvictInactive: vote for the exits of the inactive nodes in the log of participation, the replica doesn't evict itself,
+// the vote is cast again in each check until the exit is certified, in case it is lost
+// return:
+// - the nodes voted to evict
+func (s *Server) EvictInactive() []string {
+	if !s.historyStarted() || !s.IsMember() {
+		return nil
+	}
+	nodes := s.GetNodeNames()
+	inactive := s.History.Inactive(nodes, s.GetOtherNodeNames())
+	for _, name := range inactive {
+		s.Logger.Printf("[HISTORY]: %s vote to evict node %s, record %+v\n", s.ServerID.ID.Name, name, s.History.Get(name))
+		s.castVote(bcrequest.RECONFIG_EXIT, name)
+	}
+	return inactive
+}
+
+// admitByHistory: vote for the admission of the node applying to join if its history admits it,
+// the node which exited recently is refused until the cooldown passes, see history.Log.Admit
+// params:
+// - name: the node applying to join
+func (s *Server) admitByHistory(name string) {
+	if !s.historyStarted() || !s.IsMember() || s.Admitted(name) {
+		return
+	}
+	if !s.History.Admit(name, s.NodeManager.Epoch.Number) {
+		s.Logger.Println("[HISTORY]:", s.ServerID.ID.Name, "refuse to admit node", name, "which exited recently")
+		return
+	}
+	s.Logger.Println("[HISTORY]:", s.ServerID.ID.Name, "vote to admit node", name)
+	s.castVote(bcrequest.RECONFIG_ADMIT, name)
+}
+
+// quorum: get the number of votes certifying a change of nodes, that is, 2f+1 of the nodes of the current epoch
+func (s *Server) quorum() int {
+	n := len(s.NodeManager.NodesTable)
+	return 2*((n-1)/3) + 1
+}
+
+// SignVote: sign the vote for the admission or the exit of the node in the current epoch by the key of server
+// params:
+// - op:   bcrequest.RECONFIG_ADMIT or bcrequest.RECONFIG_EXIT
+// - node: the node admitted or evicted
+// return:
+// - the signed vote and error
+func (s *Server) SignVote(op string, node string) (mgmt.Vote, error) {
+	vote := mgmt.Vote{Op: op, Node: node, Epoch: s.NodeManager.Epoch.Number, Voter: s.ServerID.ID.Name}
+	h := sm3.SumSM3(vote.SignedBytes())
+	sign, err := sm2.Sm2Sign(s.ServerID.PrivateKey, s.ServerID.ID.PubKey, h[:])
+	if err != nil {
+		return vote, err
+	}
+	vote.Sign = sign
+	return vote, nil
+}
+
+// verifyVote: check the vote is cast in the current epoch and signed by a node of the epoch
+func (s *Server) verifyVote(vote *mgmt.Vote) error {
+	if vote.Epoch != s.NodeManager.Epoch.Number {
+		return fmt.Errorf("the vote of %s is cast in epoch %d", vote.Voter, vote.Epoch)
+	}
+	nk, ok := s.NodeManager.NodesTable[vote.Voter]
+	if !ok || len(nk.Sm2PubKey) == 0 {
+		return ErrUnknownSender
+	}
+	h := sm3.SumSM3(vote.SignedBytes())
+	if !sm2.Sm2Verify(vote.Sign, nk.Sm2PubKey, h[:]) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// castVote: sign the vote for the admission or the exit of the node, and send it to the other nodes of the epoch
+func (s *Server) castVote(op string, node string) {
+	vote, err := s.SignVote(op, node)
+	if err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "vote for the", op, "of node", node, err)
+		return
+	}
+	for _, name := range s.GetOtherNodeNames() {
+		msgJson, err := json.Marshal(mgmt.NodeMgmtMsg{
+			NMType:   mgmt.NM_VOTE,
+			Vote:     vote,
+			SendNode: s.ServerID.ID.Name,
+			ReciNode: name,
+		})
+		if err != nil {
+			continue
+		}
+		s.SendMsg(message.ServerMsg{
+			SType:      message.NODEMGMT,
+			SendServer: s.ServerID.ID.Name,
+			ReciServer: name,
+			Payload:    msgJson,
+		})
+	}
+	s.recordVote(vote)
+}
+
+// HandleVote: record the vote of another node for the admission or the exit of a node
+// params:
+// - msg: the message of vote, whose sender must be the voter
+func (s *Server) HandleVote(msg *mgmt.NodeMgmtMsg) {
+	if s.History == nil || msg.Vote.Voter != msg.SendNode {
+		return
+	}
+	if err := s.verifyVote(&msg.Vote); err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "drop the vote of", msg.SendNode, err)
+		return
+	}
+	s.recordVote(msg.Vote)
+}
+
+// recordVote: record the verified vote, and submit the change of nodes with the certificate of the votes
+// once a quorum of nodes including this one vote for it, each change is submitted once by the node
+func (s *Server) recordVote(vote mgmt.Vote) {
+	key := fmt.Sprintf("%s %s %d", vote.Op, vote.Node, vote.Epoch)
+	s.reconfLock.Lock()
+	if s.votes[key] == nil {
+		s.votes[key] = make(map[string]mgmt.Vote)
+	}
+	s.votes[key][vote.Voter] = vote
+	_, voted := s.votes[key][s.ServerID.ID.Name]
+	votes := make([]mgmt.Vote, 0, len(s.votes[key]))
+	if voted && !s.certified[key] && len(s.votes[key]) >= s.quorum() {
+		s.certified[key] = true
+		for _, v := range s.votes[key] {
+			votes = append(votes, v)
+		}
+	}
+	s.reconfLock.Unlock()
+	if len(votes) == 0 {
+		return
+	}
+
+	req, err := s.CertifiedReq(votes)
+	if err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "certify the", vote.Op, "of node", vote.Node, err)
+		return
+	}
+	s.Logger.Println("[HISTORY]:", s.ServerID.ID.Name, "submit the", vote.Op, "of node", vote.Node, "voted by", len(votes), "nodes")
+	go s.submitHistory([]bcrequest.BCRequest{req})
+}
+
+// CertifiedReq: get the request of the change of nodes with the certificate of the votes, which is sent and signed by the server
+// params:
+// - votes: the votes of the nodes for the same change
+// return:
+// - the request and error
+func (s *Server) CertifiedReq(votes []mgmt.Vote) (bcrequest.BCRequest, error) {
+	if len(votes) == 0 {
+		return bcrequest.BCRequest{}, bcrequest.ErrNotCertified
+	}
+	sort.Slice(votes, func(i, j int) bool { return votes[i].Voter < votes[j].Voter })
+	votesJson, err := json.Marshal(votes)
+	if err != nil {
+		return bcrequest.BCRequest{}, err
+	}
+	req := bcrequest.BCRequest{
+		Id:  s.ServerID.ID.Name,
+		Seq: uint64(time.Now().UnixNano()),
+		Cmd: bcrequest.CertifiedCommand(votes[0].Op, votes[0].Node, base64.StdEncoding.EncodeToString(votesJson)),
+	}
+	err = req.SignWith(s.ServerID.PrivateKey, s.ServerID.ID.PubKey)
+	return req, err
+}
+
+// certify: verify the change of nodes certified by the votes, which is set to the request validator,
+// the request must be signed by a node of the epoch, and the votes of a quorum of the nodes of the epoch must be for the same change
+// note: it only depends on the nodes of the current epoch, which are changed by the committed blocks, so all replicas get the same result
+// return:
+// - nil if the change is certified, or the reason to reject it
+func (s *Server) certify(req *bcrequest.BCRequest, rc *bcrequest.ReconfigCmd) error {
+	if s.NMType != mgmt.BASED_HISTORY {
+		return bcrequest.ErrNotCertified
+	}
+	nk, ok := s.NodeManager.NodesTable[req.Id]
+	if !ok {
+		return bcrequest.ErrUnknownClient
+	}
+	if !req.Verify(nk.Sm2PubKey) {
+		return bcrequest.ErrBadSignature
+	}
+	votesJson, err := base64.StdEncoding.DecodeString(rc.Cert)
+	if err != nil {
+		return bcrequest.ErrBadRequest
+	}
+	votes := make([]mgmt.Vote, 0)
+	if err := json.Unmarshal(votesJson, &votes); err != nil {
+		return bcrequest.ErrBadRequest
+	}
+
+	voters := make(map[string]bool, len(votes))
+	for i := range votes {
+		if votes[i].Op != rc.Op || votes[i].Node != rc.Value || voters[votes[i].Voter] || s.verifyVote(&votes[i]) != nil {
+			return bcrequest.ErrNotCertified
+		}
+		voters[votes[i].Voter] = true
+	}
+	if len(voters) < s.quorum() {
+		return bcrequest.ErrNotCertified
+	}
+	return nil
+}
+
+// submitHistory: submit the changes of nodes certified by the votes, and log the rejected ones
+func (s *Server) submitHistory(reqs []bcrequest.BCRequest) {
+	for _, err := range s.SubmitReqs(reqs) {
+		if err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "reconfiguration is rejected", err)
+		}
+	}
+}
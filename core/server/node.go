@@ -0,0 +1,68 @@
+package server
+
+import (
+	common "common"
+	"config"
+	"errors"
+	"mgmt"
+	"ssm2"
+	"tss"
+)
+
+// NewNodeServer: create a single replica by the node config, which runs as its own process
+// and talks to the other replicas of the cluster by the transport in config
+// params:
+// - nc:       the node config
+// - consType: the consensus protocol type
+// - signer:   the consensus signer loaded from the signer file
+// return a server instance and error
+func NewNodeServer(nc config.NodeConfig, consType common.ConsensusType, signer interface{}) (*Server, error) {
+	name := nc.Name()
+	sk := ssm2.ReadKey(nc.KeyFile)
+	if len(sk) == 0 {
+		return nil, errors.New("read key file error: " + nc.KeyFile)
+	}
+
+	// the channels of the other replicas only keep their names in the node manager,
+	// the messages to them are sent by the transport
+	nodesChannel := make(map[string]chan []byte)
+	var pk []byte
+	for _, p := range nc.Cluster {
+		nodesChannel[p.Name] = nil
+		if p.Name == name {
+			pk = p.PubKey
+		}
+	}
+	if pk == nil {
+		return nil, errors.New("replica is not in the cluster: " + name)
+	}
+	if len(nc.Peers) == 0 {
+		nc.Peers = nc.PeerAddrs()
+	}
+
+	nmType := mgmt.NodeManagerType(nc.Config.NodeManager)
+	if nmType == "" {
+		nmType = mgmt.BASIC
+	}
+	s, err := NewServer(nc.ID, len(nc.Cluster), nc.Path, consType, nmType, signer, nodesChannel, nc.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// use the identity in the key file instead of the generated one
+	s.ServerID.PrivateKey = sk
+	s.ServerID.ID.PubKey = pk
+	s.dkgKey = tss.DeriveDKGKey(sk)
+	s.NodeManager.NodesChannel[name] = s.ServerID.Address
+	for _, p := range nc.Cluster {
+		s.NodeManager.NodesTable[p.Name] = mgmt.NodeKey{
+			Name:      p.Name,
+			Sm2PubKey: p.PubKey,
+			DkgPubKey: p.DkgPubKey,
+		}
+	}
+	if c, ok := s.Clients[DEFAULT_CLIENT]; ok && nc.ClientAddr != "" {
+		c.Addr = nc.ClientAddr
+	}
+	return s, nil
+}
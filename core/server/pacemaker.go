@@ -0,0 +1,23 @@
+package server
+
+import (
+	"common"
+	"config"
+	"time"
+)
+
+// pacemakerConfig: convert the timeouts in milliseconds of the system config to the pacemaker config
+func pacemakerConfig(conf config.Config) common.PacemakerConfig {
+	return common.PacemakerConfig{
+		BaseTimeout: time.Duration(conf.BaseTimeout) * time.Millisecond,
+		Multiplier:  conf.TimeoutMultiplier,
+		MaxTimeout:  time.Duration(conf.MaxTimeout) * time.Millisecond,
+		MinTimeout:  time.Duration(conf.MinTimeout) * time.Millisecond,
+		Adaptive:    conf.AdaptiveTimeout,
+	}
+}
+
+// GetPacemakerMetrics: get the decisions of the pacemaker of consensus, such as the view timeout and the commit latency
+func (s *Server) GetPacemakerMetrics() common.PacemakerMetrics {
+	return s.Orderer.PacemakerMetrics()
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/json"
+	"message"
+)
+
+// SendProof: generate the proof of the request in the local committed block and send it to the default client
+// params:
+// - height: the height of block
+// - index:  the index of the request in the block
+func (s *Server) SendProof(height int, index int) {
+	proof, err := s.Orderer.GenBlockProof(height, index)
+	if err != nil {
+		s.Logger.Println("[PROOF]:", s.ServerID.ID.Name, err)
+		return
+	}
+	proofJson, err := json.Marshal(proof)
+	if err != nil {
+		s.Logger.Println("[PROOF]:", s.ServerID.ID.Name, err)
+		return
+	}
+	s.SendChan <- message.ServerMsg{
+		SType:      message.PROOF,
+		SendServer: s.ServerID.ID.Name,
+		ReciServer: DEFAULT_CLIENT,
+		Payload:    proofJson,
+	}
+}
@@ -0,0 +1,454 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"message"
+	"mgmt"
+	"orderer"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tss"
+
+	"github.com/xlcetc/cryptogm/sm/sm2"
+	"github.com/xlcetc/cryptogm/sm/sm3"
+)
+
+// DKG_TIMEOUT: the time the generation of the signers waits for the responses of all nodes, after it the deals certified by the threshold
+// of nodes are qualified, and the nodes which haven't responded are not, and then the time of each round of the agreement on the qualified dealers
+const DKG_TIMEOUT = 5 * time.Second
+
+// rekeyRun: the running generation of the threshold signers of an epoch
+type rekeyRun struct {
+	mgmt.Rekey
+	nodes    []string         // the nodes of the epoch in order of the index of their new shares
+	run      *tss.DKG         // the run of the distributed key generation or the resharing
+	timedOut bool             // whether the generation timed out, then each timeout starts the next round of the agreement on the dealers
+	round    int              // the round of the agreement on the dealers, whose proposer is the node at the index of the round in nodes
+	proposed int              // the last round proposed by this node, -1 if it hasn't proposed
+	reports  map[string][]int // the dealers reported by the nodes, whose deals they certified
+	proposal *mgmt.Qual       // the proposal of the latest round, which the node votes for once it certifies the deals
+	votes    map[string][]int // the dealers voted by the nodes, each node votes once
+}
+
+// quorum: the number of the nodes of the epoch voting for the same dealers, any two quorums share an honest node
+func (rk *rekeyRun) quorum() int {
+	return 2*((len(rk.nodes)-1)/3) + 1
+}
+
+// proposer: the proposer of the round of the agreement on the dealers
+func (rk *rekeyRun) proposer(round int) string {
+	return rk.nodes[round%len(rk.nodes)]
+}
+
+// agreed: get the dealers voted by a quorum of the nodes, or nil if there are none
+func (rk *rekeyRun) agreed() []int {
+	for _, dealers := range rk.votes {
+		n := 0
+		for _, other := range rk.votes {
+			if slices.Equal(dealers, other) {
+				n++
+			}
+		}
+		if n >= rk.quorum() {
+			return dealers
+		}
+	}
+	return nil
+}
+
+// DKGPublicKey: get the public key of the long-term key of the distributed key generation, which is given to the other nodes
+func (s *Server) DKGPublicKey() []byte {
+	return s.dkgKey.PublicBytes()
+}
+
+// needRekey: check whether the signers of the epoch are generated by the nodes, which is required by the protocols whose signers
+// depend on the number of nodes unless the signer of the epoch is given by AddEpochSigner
+func (s *Server) needRekey(epoch int) bool {
+	s.reconfLock.Lock()
+	_, ok := s.epochSigners[epoch]
+	s.reconfLock.Unlock()
+	if ok {
+		return false
+	}
+	p, err := orderer.LookupProtocol(s.Orderer.ConsType)
+	return err == nil && p.Rekey
+}
+
+// newRekey: get the generation of the signers of the current epoch, the shares of the nodes of the last epoch are reshared,
+// so the group public key is kept, or a new group key is generated by the nodes of the epoch if the config rotates the key
+// params:
+// - dealers: the nodes of the last epoch
+// return:
+// - the generation, and error if the running signer isn't a threshold signer
+func (s *Server) newRekey(dealers map[string]mgmt.NodeKey) (mgmt.Rekey, error) {
+	rk := mgmt.Rekey{Epoch: s.NodeManager.Epoch.Number}
+	if s.Config.RotateKey {
+		return rk, nil
+	}
+	signer, ok := s.Orderer.Consensus.Options().Signer.(*tss.Signer)
+	if !ok {
+		return rk, errors.New("the running signer isn't a threshold signer")
+	}
+	names := make([]string, 0, len(dealers))
+	for name := range dealers {
+		names = append(names, name)
+	}
+	rk.Dealers = shareOrder(names)
+	rk.Commits = signer.Commits()
+	return rk, nil
+}
+
+// startRekey: start the generation of the signers of the epoch, the node deals its share if it is a dealer,
+// then the messages of the generation recieved before are handled, and the consensus continues with the nodes of the epoch once the signer is generated
+// note: the dealer which isn't a node of the epoch only deals its share and gets no signer
+// params:
+// - rk: the generation of the signers, which is the same on all nodes
+// return:
+// - error if the generation can't be started, such as a node without the long-term key
+func (s *Server) startRekey(rk mgmt.Rekey) error {
+	nodes := shareOrder(s.NodeManager.Epoch.Nodes)
+	pubs, err := s.dkgPubKeys(nodes)
+	if err != nil {
+		return err
+	}
+	threshold := (len(nodes)-1)/3*2 + 1
+
+	var run *tss.DKG
+	if len(rk.Dealers) == 0 {
+		run, err = tss.NewDKG(s.dkgKey, pubs, threshold)
+	} else {
+		var olds [][]byte
+		if olds, err = s.dkgPubKeys(rk.Dealers); err != nil {
+			return err
+		}
+
+		// the share of the dealer is reshared at the index of the dealer, which is the index of its share
+		var signer *tss.Signer
+		if index := slices.Index(rk.Dealers, s.ServerID.ID.Name); index >= 0 {
+			signer, _ = s.Orderer.Consensus.Options().Signer.(*tss.Signer)
+			if signer == nil || signer.PrivateKey.I != index {
+				return errors.New("the share of the dealer doesn't match its index")
+			}
+		}
+		run, err = tss.NewReshare(s.dkgKey, signer, rk.Commits, olds, pubs, threshold)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.rekey = &rekeyRun{
+		Rekey:    rk,
+		nodes:    nodes,
+		run:      run,
+		proposed: -1,
+		reports:  make(map[string][]int),
+		votes:    make(map[string][]int),
+	}
+	s.rekeyed = rk.Epoch
+	msgs, err := run.Start()
+	if err != nil {
+		s.rekey = nil
+		return err
+	}
+	s.sendDKG(msgs)
+	s.Logger.Println("[DKG]:", s.ServerID.ID.Name, "start the generation of signers of epoch", rk.Epoch, "dealers", rk.Dealers, "nodes", nodes)
+
+	s.startDKGTimer(rk.Epoch)
+	early := s.dkgMsgs
+	s.dkgMsgs = nil
+	for _, msg := range early {
+		s.HandleDKG(msg)
+	}
+	s.endRekey(false)
+	return nil
+}
+
+// HandleDKG: handle the message of the generation of the signers or of the agreement on its dealers, the messages of a later epoch
+// are kept until the generation of the epoch starts, and the ones of the other epochs are dropped
+// params:
+// - msg: the message of the generation
+func (s *Server) HandleDKG(msg *mgmt.NodeMgmtMsg) {
+	rk := s.rekey
+	if rk == nil || msg.Rekey.Epoch > rk.Epoch {
+		if msg.Rekey.Epoch > s.rekeyed && len(s.dkgMsgs) < MAX_LATER_MSGS {
+			s.dkgMsgs = append(s.dkgMsgs, msg)
+		}
+		return
+	}
+	if msg.Rekey.Epoch != rk.Epoch || (!slices.Contains(rk.nodes, msg.SendNode) && !slices.Contains(rk.Dealers, msg.SendNode)) {
+		return
+	}
+
+	if msg.NMType == mgmt.NM_QUAL {
+		if err := s.handleQual(msg); err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "drop the qual message from", msg.SendNode, err)
+			return
+		}
+	} else {
+		msgs, err := rk.run.Process(msg.DKG)
+		if err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "drop the dkg message from", msg.SendNode, err)
+			return
+		}
+		s.sendDKG(msgs)
+	}
+	s.endRekey(false)
+}
+
+// endRekey: end the generation once the nodes of the epoch agree on the qualified dealers, since the nodes may certify different deals
+// by the responses recieved before the timeout. The node reports the dealers whose deals it certified once all deals are certified
+// or at the timeout, the proposer of each round proposes the dealers certified by all reporting nodes, see proposeQual, and the node
+// votes for the proposed dealers once it certifies their deals, then the node of the epoch continues the consensus with the signer
+// generated from the dealers voted by a quorum, and the consensus messages of the epoch recieved before are handled
+// note: each node votes for one set of dealers only, so at most one set is voted by a quorum, and the signers share the group key
+// params:
+// - timeout: whether the generation or the round of the agreement times out
+func (s *Server) endRekey(timeout bool) {
+	rk := s.rekey
+	if rk == nil {
+		return
+	}
+	if timeout {
+		if rk.timedOut {
+			rk.round++
+		}
+		rk.timedOut = true
+		rk.run.SetTimeout()
+	}
+	ended := rk.timedOut || rk.run.Certified()
+	name := s.ServerID.ID.Name
+	if !slices.Contains(rk.nodes, name) {
+		if ended {
+			s.rekey = nil
+		}
+		return
+	}
+	if timeout {
+		s.startDKGTimer(rk.Epoch)
+	}
+
+	if _, ok := rk.reports[name]; ended && !ok {
+		rk.reports[name] = rk.run.QUAL()
+		s.sendQual(mgmt.Qual{Dealers: rk.reports[name]}, nil)
+	}
+	s.proposeQual()
+	if rk.proposal != nil && rk.votes[name] == nil && rk.run.Qualified(rk.proposal.Dealers) == nil {
+		s.voteQual(rk.proposal.Round, rk.proposal.Dealers, nil)
+	}
+	dealers := rk.agreed()
+	if dealers == nil {
+		return
+	}
+
+	// the node which hasn't certified the agreed deals waits for their responses or the timeout
+	signer, err := rk.run.SignerOf(dealers)
+	if err != nil {
+		if timeout {
+			s.Logger.Println("[Error]:", name, "generate the signer of epoch", rk.Epoch, "dealers", dealers, err)
+		}
+		return
+	}
+	s.rekey = nil
+	s.Logger.Println("[DKG]:", name, "generate the signer of epoch", rk.Epoch, "dealers", dealers, "group key", fmt.Sprintf("%x", signer.PublicKeyBytes()[:8]))
+	s.AddEpochSigner(rk.Epoch, signer)
+	if err := s.ChangeNodes(); err != nil {
+		s.Logger.Println("[Error]:", name, "change the nodes of epoch", rk.Epoch, err)
+		return
+	}
+	s.handleLater()
+}
+
+// proposeQual: the proposer of the round proposes the dealers it voted for, otherwise the dealers certified by all nodes
+// in the first round, or by a quorum of nodes in the later ones, which are the dealers reported by all of them,
+// and the responses of the dealers are sent with the proposal, so the nodes which missed some of them certify the deals as well
+func (s *Server) proposeQual() {
+	rk := s.rekey
+	if rk.proposer(rk.round) != s.ServerID.ID.Name || rk.proposed >= rk.round {
+		return
+	}
+	dealers := rk.votes[s.ServerID.ID.Name]
+	if dealers == nil {
+		if len(rk.reports) < len(rk.nodes) && (rk.round == 0 || len(rk.reports) < rk.quorum()) {
+			return
+		}
+		dealers = commonDealers(rk.reports)
+	}
+	if rk.run.Qualified(dealers) != nil {
+		return
+	}
+	rk.proposed = rk.round
+	s.voteQual(rk.round, dealers, rk.run.Responses(dealers))
+}
+
+// voteQual: vote for the dealers, the vote of the proposer of the round is the proposal
+// params:
+// - round:   the round of the proposal
+// - dealers: the dealers voted for
+// - dkgs:    the responses of the dealers sent with the proposal, nil for the vote of the other nodes
+func (s *Server) voteQual(round int, dealers []int, dkgs []tss.DKGMsg) {
+	s.rekey.votes[s.ServerID.ID.Name] = dealers
+	s.sendQual(mgmt.Qual{Round: round, Dealers: dealers, Vote: true}, dkgs)
+}
+
+// handleQual: handle the report or the vote of the dealers from a node of the epoch, the vote of the proposer of its round
+// is the proposal of the round, and the responses sent with it are processed before the node votes for it
+// return:
+// - error if the message isn't signed by a node of the epoch
+func (s *Server) handleQual(msg *mgmt.NodeMgmtMsg) error {
+	rk := s.rekey
+	q := msg.Qual
+	if q.Node != msg.SendNode || q.Epoch != rk.Epoch || q.Round < 0 || !slices.Contains(rk.nodes, q.Node) {
+		return ErrUnknownSender
+	}
+	nk, ok := s.NodeManager.NodesTable[q.Node]
+	if !ok || len(nk.Sm2PubKey) == 0 {
+		return ErrUnknownSender
+	}
+	h := sm3.SumSM3(q.SignedBytes())
+	if !sm2.Sm2Verify(q.Sign, nk.Sm2PubKey, h[:]) {
+		return ErrBadSignature
+	}
+
+	if !q.Vote {
+		if _, ok := rk.reports[q.Node]; !ok {
+			rk.reports[q.Node] = q.Dealers
+		}
+		return nil
+	}
+	if _, ok := rk.votes[q.Node]; !ok {
+		rk.votes[q.Node] = q.Dealers
+	}
+	if q.Node != rk.proposer(q.Round) || (rk.proposal != nil && rk.proposal.Round >= q.Round) {
+		return nil
+	}
+	rk.proposal = &q
+	for _, dm := range msg.DKGs {
+		if dm.Type != tss.DKG_RESPONSE {
+			continue
+		}
+		if msgs, err := rk.run.Process(dm); err == nil {
+			s.sendDKG(msgs)
+		}
+	}
+	return nil
+}
+
+// sendQual: sign the report or the vote of the dealers by the key of server, and send it to the other nodes of the epoch
+// params:
+// - q:    the report or the vote, whose epoch, node and signature are set here
+// - dkgs: the responses sent with the proposal
+func (s *Server) sendQual(q mgmt.Qual, dkgs []tss.DKGMsg) {
+	rk := s.rekey
+	q.Epoch, q.Node = rk.Epoch, s.ServerID.ID.Name
+	h := sm3.SumSM3(q.SignedBytes())
+	sign, err := sm2.Sm2Sign(s.ServerID.PrivateKey, s.ServerID.ID.PubKey, h[:])
+	if err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "sign the dealers of epoch", rk.Epoch, err)
+		return
+	}
+	q.Sign = sign
+	s.sendRekey(mgmt.NodeMgmtMsg{NMType: mgmt.NM_QUAL, Qual: q, DKGs: dkgs}, rk.nodes)
+}
+
+// commonDealers: get the dealers in all reports in order
+func commonDealers(reports map[string][]int) []int {
+	dealers := make([]int, 0)
+	for _, report := range reports {
+		for _, i := range report {
+			in := true
+			for _, other := range reports {
+				in = in && slices.Contains(other, i)
+			}
+			if in && !slices.Contains(dealers, i) {
+				dealers = append(dealers, i)
+			}
+		}
+	}
+	slices.Sort(dealers)
+	return dealers
+}
+
+// startDKGTimer: notify the message router at the timeout of the generation of the epoch, or of the round of the agreement on the dealers
+func (s *Server) startDKGTimer(epoch int) {
+	time.AfterFunc(DKG_TIMEOUT, func() {
+		select {
+		case s.dkgTimeout <- epoch:
+		default:
+		}
+	})
+}
+
+// sendDKG: send the messages of the generation, the deal is sent to its node and the others are sent to all other participants
+func (s *Server) sendDKG(msgs []tss.DKGMsg) {
+	rk := s.rekey
+	for _, dm := range msgs {
+		var recievers []string
+		if dm.To >= 0 {
+			recievers = rk.nodes[dm.To : dm.To+1]
+		} else {
+			recievers = append(slices.Clone(rk.Dealers), rk.nodes...)
+			slices.Sort(recievers)
+			recievers = slices.Compact(recievers)
+		}
+		s.sendRekey(mgmt.NodeMgmtMsg{NMType: mgmt.NM_DKG, DKG: dm}, recievers)
+	}
+}
+
+// sendRekey: send the message of the generation of the epoch to the other nodes in recievers
+func (s *Server) sendRekey(msg mgmt.NodeMgmtMsg, recievers []string) {
+	msg.Rekey = mgmt.Rekey{Epoch: s.rekey.Epoch}
+	msg.SendNode = s.ServerID.ID.Name
+	for _, name := range recievers {
+		if name == s.ServerID.ID.Name {
+			continue
+		}
+		msg.ReciNode = name
+		msgJson, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		s.SendMsg(message.ServerMsg{
+			SType:      message.NODEMGMT,
+			SendServer: s.ServerID.ID.Name,
+			ReciServer: name,
+			Payload:    msgJson,
+		})
+	}
+}
+
+// dkgPubKeys: get the public keys of the long-term keys of the nodes from the nodes table,
+// or from the nodes of the last epoch for the exited dealers
+func (s *Server) dkgPubKeys(names []string) ([][]byte, error) {
+	s.reconfLock.Lock()
+	dealers := s.dealers
+	s.reconfLock.Unlock()
+	pubs := make([][]byte, len(names))
+	for i, name := range names {
+		nk, ok := s.NodeManager.NodesTable[name]
+		if !ok {
+			nk, ok = dealers[name]
+		}
+		if !ok || len(nk.DkgPubKey) == 0 {
+			return nil, fmt.Errorf("no dkg key of node %s", name)
+		}
+		pubs[i] = nk.DkgPubKey
+	}
+	return pubs, nil
+}
+
+// shareOrder: sort the names of nodes by their numbers, which is the order of the index of their shares,
+// since the node r_i gets the share of index i from the signers generated for all nodes together
+func shareOrder(names []string) []string {
+	sorted := slices.Clone(names)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(sorted[i], "r_"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(sorted[j], "r_"))
+		return a < b
+	})
+	return sorted
+}
@@ -9,38 +9,78 @@ import (
 	"config"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"history"
 	"identity"
 	"log"
+	"mempool"
 	"message"
 	"mgmt"
 	"orderer"
 	"os"
-	"ssm2"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+	"transport"
+	"tss"
+	"wire"
 
 	"github.com/xlcetc/cryptogm/sm/sm2"
-	"github.com/xlcetc/cryptogm/sm/sm3"
 )
 
 // Server is the system node which is the main unit
 type Server struct {
 	ServerID identity.PrivID           // the only identity the node in system
 	Port     string                    // open port monitored by the server
-	Clients  map[string]*ci.ClientInfo // the client info
+	Clients  map[string]*ci.ClientInfo // the info of clients which have been replied, the registered clients are kept by the request validator
 
 	Orderer orderer.Orderer // the orderer unit for consistence by consensus
 
-	NMType      mgmt.NodeManagerType  // the node manager type, now is basic
+	NMType      mgmt.NodeManagerType  // the node manager type, see InitNodeManager
 	NodeManager bcmanager.NodeManager // the node manager
-
-	SendChan     chan message.ServerMsg // the channel within the server that receives all messages that need to be sent
-	Requests     []bcrequest.BCRequest  // the server recieved requests with signatures
-	RequestsLock sync.Mutex
-	BatchSize    int                   // the number of request within a block
-	BlkStore     blockchain.BlockStore // the blockchain storage, which is responsible for blockchain-related storage queries, etc
-	Logger       log.Logger            `json:"logger"` // logger responsible for logging
+	History     *history.Log          // the log of the participation of the nodes kept by the basedhistory node manager, nil for the others
+
+	SendChan   chan message.ServerMsg // the channel within the server that receives all messages that need to be sent
+	Mempool    *mempool.Mempool       // the server recieved requests with signatures which are not committed yet
+	batchSize  atomic.Int64           // the number of request within a block, which is retuned by the committed reconfiguration, see BatchSize
+	BlkStore   blockchain.BlockStore  // the blockchain storage, which is responsible for blockchain-related storage queries, etc
+	Config     config.Config          // the system config
+	Recovered  bool                   // whether the server is recovered from the local data
+	Transport  transport.Transport    // the transport between replicas
+	Codec      wire.Codec             // the codec of the messages sent to the replicas, the messages to clients are always JSON
+	rejected   map[string]int         // the number of rejected messages of each peer
+	rejectLock sync.Mutex
+	clientLock sync.Mutex
+	watchQuit  chan struct{} // closed to stop watching the mempool
+
+	Coordinator  *Coordinator                         // the DCS strategy coordinator run by the server, nil if it is not run
+	signers      map[common.ConsensusType]interface{} // the signers of the protocols the server may switch to, see SwitchProtocol
+	switchTo     common.ConsensusType                 // the consensus protocol switched to by the committed reconfiguration
+	switching    common.ConsensusType                 // the consensus protocol which the halted consensus is switched to, see switchHalted
+	admitted     map[string]bool                      // the nodes admitted to join by the committed reconfigurations
+	retuned      map[string]string                    // the last committed value of the batch size, the view timeout and the protocol, see snapshot
+	epochSigners map[int]interface{}                  // the signers of the running protocol for the epochs of nodes, see AddEpochSigner
+	changing     bool                                 // whether the halted consensus continues with the nodes of the new epoch, see switchHalted
+	joiners      []string                             // the nodes joined at the halted block, which are synced after the nodes are changed
+	exits        []string                             // the nodes exited at the halted block, which are sent the block before the nodes are changed
+	dealers      map[string]mgmt.NodeKey              // the nodes of the last epoch, which deal their shares to the nodes of the epoch, see startRekey
+	dkgKey       *tss.DKGKey                          // the long-term key of the distributed key generation of the signers
+	rekey        *rekeyRun                            // the running generation of the signers of the epoch, nil if it isn't running
+	rekeyed      int                                  // the last epoch whose generation of signers has started
+	dkgMsgs      []*mgmt.NodeMgmtMsg                  // the messages of the generation of signers recieved before it starts
+	dkgTimeout   chan int                             // the epochs whose generation of signers times out, which is handled by the message router
+	epoch        atomic.Int64                         // the epoch of nodes of the running consensus, the consensus messages of earlier epochs are dropped
+	later        []*message.ServerMsg                 // the consensus messages of later epochs, which are handled after the nodes are changed
+	recovering   atomic.Bool                          // whether the blocks are replayed by the recovering consensus
+	reconfLock   sync.Mutex
+	switchLock   sync.Mutex
+	Logger       log.Logger `json:"logger"` // logger responsible for logging
+
+	historyQuit chan struct{}                   // closed to stop evicting the inactive nodes, nil if the basedhistory node manager isn't started
+	votes       map[string]map[string]mgmt.Vote // the votes of the nodes for each change of nodes in the current epoch, see recordVote
+	certified   map[string]bool                 // the changes of nodes submitted with the certificate of votes by the server
 }
 
 // NewServer: create a new server according to different parameters
@@ -52,8 +92,39 @@ type Server struct {
 // nmType: 		the node manager type selected by the server
 // signer:
 // nodesChannel:
+// confs: 		the optional system config, the default config is used if it is not given
 // return a server instance and error
-func NewServer(id int, nodeNum int, path string, consType common.ConsensusType, nmType mgmt.NodeManagerType, signer interface{}, nodesChannel map[string]chan []byte) (*Server, error) {
+func NewServer(id int, nodeNum int, path string, consType common.ConsensusType, nmType mgmt.NodeManagerType, signer interface{}, nodesChannel map[string]chan []byte, confs ...config.Config) (*Server, error) {
+
+	conf := config.DefaultConfig()
+	if len(confs) > 0 {
+		conf = confs[0]
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = config.BatchSize
+	}
+	codec, err := wire.ParseCodec(conf.Codec)
+	if err != nil {
+		return nil, err
+	}
+	election := common.ElectionPolicy(conf.LeaderElection)
+	if _, err := common.NewLeaderElector(election); err != nil {
+		return nil, err
+	}
+	switch nmType {
+	case mgmt.BASIC, mgmt.BFT_SMART, mgmt.BASED_HISTORY:
+	default:
+		return nil, fmt.Errorf("unknown node manager type %q", nmType)
+	}
+	// the pipeline window is checked for the protocols which the coordinator may switch to as well
+	for _, t := range []string{string(consType), conf.DcsFastProtocol, conf.DcsScaleProtocol} {
+		if t == "" {
+			continue
+		}
+		if err := orderer.CheckWindow(common.ConsensusType(t), conf.PipelineWindow); err != nil {
+			return nil, err
+		}
+	}
 
 	// get the server name
 	name := "r_" + strconv.Itoa(id)
@@ -64,28 +135,30 @@ func NewServer(id int, nodeNum int, path string, consType common.ConsensusType,
 		return nil, err
 	}
 
+	// the key of the distributed key generation is derived from the private key, so the replica started by its key file keeps it
+	dkgKey := tss.DeriveDKGKey(sk)
+
 	// init nodesTable and add self
 	nodesTable := map[string]mgmt.NodeKey{
 		name: {
 			Name:      name,
 			Sm2PubKey: pk,
+			DkgPubKey: dkgKey.PublicBytes(),
 		},
 	}
 
-	// read client key from file only for test
-	cpk := ssm2.ReadKey("./config/client/public.pem")
-
-	if len(cpk) == 0 {
-		cpk = ssm2.ReadKey("../../config/client/public.pem")
-	}
-
-	clientInfo := map[string]*ci.ClientInfo{
-		"c_0": {
-			Name: "c_0",
+	// the operators are the clients given by their public keys in config, no key of client is read from the repository
+	clientInfo := map[string]*ci.ClientInfo{}
+	if len(conf.OperatorKey) != 0 {
+		clientInfo[DEFAULT_CLIENT] = &ci.ClientInfo{
+			Name: DEFAULT_CLIENT,
 			Addr: "127.0.0.1:30000",
-			Pk:   cpk,
+			Pk:   conf.OperatorKey,
 			Conn: nil,
-		},
+		}
+	}
+	if conf.ViewManager != "" && conf.ViewManager != DEFAULT_CLIENT && len(conf.ViewManagerKey) != 0 {
+		clientInfo[conf.ViewManager] = &ci.ClientInfo{Name: conf.ViewManager, Pk: conf.ViewManagerKey}
 	}
 
 	// create the new server instance
@@ -100,20 +173,55 @@ func NewServer(id int, nodeNum int, path string, consType common.ConsensusType,
 		},
 		Port:      strconv.Itoa(id + 20001),
 		Clients:   clientInfo,
+		Orderer:   orderer.Orderer{Codec: codec, Pacemaker: pacemakerConfig(conf), Election: election, Window: conf.PipelineWindow},
 		NMType:    nmType,
 		SendChan:  make(chan message.ServerMsg, 128),
 		Logger:    *log.New(os.Stdout, "", 0),
-		Requests:  make([]bcrequest.BCRequest, 0),
-		BatchSize: config.BatchSize,
+		Mempool:   mempool.NewMempool(conf.MempoolSize),
+		Config:    conf,
+		Codec:     codec,
+		watchQuit: make(chan struct{}),
+		admitted:  make(map[string]bool),
+		retuned:   make(map[string]string),
+		votes:     make(map[string]map[string]mgmt.Vote),
+		certified: make(map[string]bool),
+		signers:   make(map[common.ConsensusType]interface{}),
+
+		epochSigners: make(map[int]interface{}),
+		dkgKey:       dkgKey,
+		dkgTimeout:   make(chan int, 1),
 	}
+	newServer.batchSize.Store(int64(conf.BatchSize))
 
 	// init node manager
 	newServer.InitNodeManager(nmType, id, nodesTable, nodesChannel)
 
 	// init consensus
 	newServer.InitConsensus(consType, id, nodeNum, path, newServer.SendChan, signer)
+	newServer.InitReqValidator()
 	// newServer.BlkStore = newServer.Orderer.BasicHotstuff.BlkStore
 
+	// init the block storage of consensus
+	err = newServer.InitStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	// restart the consensus from the local data if required
+	if conf.Recover {
+		newServer.Recovered, err = newServer.recover()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// init the transport between replicas
+	err = newServer.InitTransport(nodesChannel)
+	if err != nil {
+		newServer.CloseStorage()
+		return nil, err
+	}
+
 	// set the log format
 	newServer.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 	return newServer, nil
@@ -129,13 +237,14 @@ func (s *Server) RouteServerMsg(ch chan []byte) {
 
 			msg := message.DecodeMsg(msgJson)
 			if msg == nil {
+				s.RejectMsg(UNKNOWN_SENDER, errors.New("decode message error"))
 				continue
 			}
 
-			// verify the message signature
-			h := sm3.SumSM3(msg.Payload)
-			if !sm2.Sm2Verify(msg.Sign, s.NodeManager.NodesTable[msg.SendServer].Sm2PubKey, h[:]) {
-				s.Logger.Println("Message verify sign error", msg.SendServer)
+			// drop the message which is not sent to this server or not signed by its sender
+			if err := s.VerifyMsg(msg); err != nil {
+				s.RejectMsg(msg.SendServer, err)
+				continue
 			}
 
 			switch msg.SType {
@@ -144,7 +253,19 @@ func (s *Server) RouteServerMsg(ch chan []byte) {
 			case message.NODEMGMT:
 				s.SubmitMsg2NodeManager(msg.Payload)
 			case message.ORDER:
+				// the messages of the consensus of an earlier epoch are sent by the replica before it changes the nodes, see switchHalted,
+				// and the ones of a later epoch are kept until this replica changes them, so the halted consensus goes on before checking
+				s.switchHalted()
+				if epoch := int(s.epoch.Load()); msg.Epoch < epoch {
+					continue
+				} else if msg.Epoch > epoch {
+					s.keepLater(msg)
+					continue
+				}
+				s.logParticipation(msg)
 				s.SubmitMsg2Consensus(msg.Payload)
+			case message.SWITCH:
+				s.CatchUpSwitch(msg.Payload)
 			default:
 				fmt.Println("Server message type is unknown type!")
 			}
@@ -152,28 +273,118 @@ func (s *Server) RouteServerMsg(ch chan []byte) {
 
 			// sendChan is internal channel, which is messages submitted by other components to the server to be sent
 			s.SendMsg(serMsg)
+		case epoch := <-s.dkgTimeout:
+			if s.rekey != nil && s.rekey.Epoch == epoch {
+				s.endRekey(true)
+			}
 		}
 	}
 }
 
-// ValidateAndHandleReq: the server handle requests to order if the order is leader and waiting for new request
-// the func maybe is to validate the validation of requests, but now is directly submit the request to orderer for handle it
+// ValidateAndHandleReq: the server adds the request gossiped by other replicas to its mempool,
+// the leader pulls the requests from the mempool when it proposes
 // params:
 // req: requests recieved
 func (s *Server) ValidateAndHandleReq(payload []byte) {
 	req := bcrequest.BCRequest{}
-	json.Unmarshal(payload, &req)
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		return
+	}
 
-	// validate the validation of requests here, but now is none and directly append
-	s.Requests = append(s.Requests, req)
+	// the request is gossiped by the replica which recieved it from the client, so it is not gossiped again
+	if err := s.AddReq(req); err != nil && err != mempool.ErrDuplicate {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "drop gossiped request", err)
+		return
+	}
 
 	// if the server is waiting requests and submit
-	if s.Orderer.IsWaitingReq() {
-		s.Orderer.HandleReq(s.BlkStore.Height, s.BlkStore.PreBlkHash, s.BlkStore.CurBlkHash, s.Requests)
+	s.NotifyReq()
+}
+
+// AddReq: check the request is signed by its client and has not been committed, and add it to the mempool
+// note: the request of a client whose registration is not committed yet is rejected
+// return:
+// - nil if the request is added, or the reason to reject it, such as mempool.ErrPoolFull
+func (s *Server) AddReq(req bcrequest.BCRequest) error {
+	if s.Orderer.ReqValidator != nil {
+		if err := s.Orderer.ReqValidator.Check(&req); err != nil {
+			return err
+		}
+	}
+	return s.Mempool.Add(req, mempool.Priority(&req))
+}
+
+// NotifyReq: wake up the request handler if the server is the leader waiting for requests and the mempool is not empty
+func (s *Server) NotifyReq() {
+	if s.ServerID.ID.Name == s.Orderer.GetProposerName() && s.Orderer.IsWaitingReq() && s.Mempool.Queued() > 0 {
+		select {
+		case s.Orderer.ReqFlagChan <- true:
+		default:
+		}
+	}
+}
+
+// WatchReqs: wake up the request handler periodically, so that the requests left in the mempool
+// are proposed once the leader is ready for the next proposal
+// params:
+// - interval: the time between two checks
+func (s *Server) WatchReqs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.NotifyReq()
+		case <-s.watchQuit:
+			return
+		}
+	}
+}
+
+// StopWatchReqs: stop watching the mempool
+func (s *Server) StopWatchReqs() {
+	select {
+	case <-s.watchQuit:
+	default:
+		close(s.watchQuit)
 	}
 }
 
-// InitNodeManager: init consensus, until now only basic node-manager
+// SubmitReqs: add the requests recieved from the client to the mempool and gossip them to all other replicas
+// params:
+// - reqs: the requests with signatures
+// return:
+// - nil for each accepted request, or the reason to reject it, mempool.ErrPoolFull means the client should retry later
+func (s *Server) SubmitReqs(reqs []bcrequest.BCRequest) []error {
+	errs := make([]error, len(reqs))
+	for i, req := range reqs {
+		errs[i] = s.AddReq(req)
+		if errs[i] != nil {
+			continue
+		}
+		reqJson, err := json.Marshal(req)
+		if err != nil {
+			continue
+		}
+		for _, name := range s.GetOtherNodeNames() {
+			s.SendChan <- message.ServerMsg{
+				SType:      message.REQUEST,
+				SendServer: s.ServerID.ID.Name,
+				ReciServer: name,
+				Payload:    reqJson,
+			}
+		}
+	}
+	s.NotifyReq()
+	return errs
+}
+
+// InitNodeManager: init the node manager, all node managers keep the nodes table and the epoch of nodes changed by the committed joins and exits,
+// and they decide which committed joins and exits are applied, see checkChange
+// - basic:        the joins and exits of any operator are applied
+// - bftsmart:     the joins and exits are applied only if they are sent by the view manager, whose key is the trusted admin key
+// - basedhistory: the participation of the nodes is logged, the inactive nodes are evicted and the nodes are admitted by their history
 // params:
 // nmType:			the node manager type selected by the server
 // id: 				the unique identification of the server
@@ -181,8 +392,11 @@ func (s *Server) ValidateAndHandleReq(payload []byte) {
 // nodesChannel: 	the channels table of all nodes
 func (s *Server) InitNodeManager(nmType mgmt.NodeManagerType, id int, nodesTable map[string]mgmt.NodeKey, nodesChannel map[string]chan []byte) {
 	switch nmType {
-	case mgmt.BASIC:
+	case mgmt.BASIC, mgmt.BFT_SMART:
+		s.NodeManager = *bcmanager.NewNodeManager(id, nodesTable, nodesChannel)
+	case mgmt.BASED_HISTORY:
 		s.NodeManager = *bcmanager.NewNodeManager(id, nodesTable, nodesChannel)
+		s.History = history.NewLog(s.Config.HistoryWindow)
 	default:
 		fmt.Println("NodeManager type is unknown type!")
 	}
@@ -203,14 +417,28 @@ func (s *Server) InitConsensus(consType common.ConsensusType, id int, nodeNum in
 // SubmitMsg2NodeManager: submit message to node manager
 func (s *Server) SubmitMsg2NodeManager(msg []byte) {
 	switch s.NMType {
-	case mgmt.BASIC:
+	case mgmt.BASIC, mgmt.BFT_SMART, mgmt.BASED_HISTORY:
 		s.HandleNodeManagerMsg(msg)
 	}
 }
 
-// SubmitMsg2Consensus: submit message to consensus
+// SubmitMsg2Consensus: submit message to consensus, the consensus halted by the committed switch or change of nodes
+// is rebuilt before and after it
 func (s *Server) SubmitMsg2Consensus(msg []byte) {
-	s.Orderer.HandleMsg(msg, s.Clients["c_0"].Pk)
+	s.switchHalted()
+	s.Orderer.HandleMsg(msg)
+	s.switchHalted()
+}
+
+// BatchSize: get the max number of requests proposed in a block
+func (s *Server) BatchSize() int {
+	return int(s.batchSize.Load())
+}
+
+// SetBatchSize: retune the max number of requests proposed in a block, it is called by the commit of blocks
+// while the requests are proposed by another routine
+func (s *Server) SetBatchSize(size int) {
+	s.batchSize.Store(int64(size))
 }
 
 // GetNodeNames: get node names from NodesChannel
@@ -225,20 +453,44 @@ func (s *Server) GetOtherNodeNames() []string {
 	return s.NodeManager.GetOtherNodeNames()
 }
 
-// Server verify reqests form client
-func (s *Server) VerifyReqs() bool {
-	length := len(s.Requests)
-	if length == 0 {
-		s.Logger.Println("[Error]: requests length is zero")
-		return false
+// InitReqValidator: create the validator of client requests with the clients given at startup, and set it to the orderer,
+// the committed requests are evicted from the mempool by it, and the committed reconfigurations retune the server
+// note: it is called before the consensus recovers, so that the replayed blocks rebuild the client registry and the deduplication window
+func (s *Server) InitReqValidator() {
+	v := bcrequest.NewValidator(bcrequest.WINDOW_SIZE)
+	for id, c := range s.Clients {
+		v.AddClient(bcrequest.ClientEntry{Id: id, Pk: c.Pk, Addr: c.Addr})
 	}
+	v.OnCommit(s.Mempool.Evict)
+	v.OnReconfig(s.ApplyReconfig)
+	v.SetCertifier(s.certify)
+	s.Orderer.SetReqValidator(v)
+}
 
-	// for i := 0; i < length; i++ {
-	// 	if !sm2.Sm2Verify(s.Requests[i].Sign, s.Clients["c_0"].Pk, s.Requests[i].Cmd) {
-	// 		s.Logger.Println("[Error]: requests sign verify error")
-	// 		return false
-	// 	}
-	// }
-
-	return true
+// VerifyReqs: the leader verifies the reqests pulled from the mempool, the requests with wrong signature,
+// from unknown client or committed before are dropped and removed from the mempool
+// return:
+// - the valid requests to propose
+func (s *Server) VerifyReqs(reqs []bcrequest.BCRequest) []bcrequest.BCRequest {
+	if len(reqs) == 0 || s.Orderer.ReqValidator == nil {
+		return reqs
+	}
+	valid, errs := s.Orderer.ReqValidator.Filter(reqs)
+	for _, err := range errs {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "drop request", err)
+	}
+	if len(errs) != 0 {
+		kept := make(map[string]bool)
+		for i := range valid {
+			kept[valid[i].Hash()] = true
+		}
+		dropped := make([]bcrequest.BCRequest, 0, len(errs))
+		for i := range reqs {
+			if !kept[reqs[i].Hash()] {
+				dropped = append(dropped, reqs[i])
+			}
+		}
+		s.Mempool.Remove(dropped)
+	}
+	return valid
 }
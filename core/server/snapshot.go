@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bcrequest"
+	"blockchain"
+	"encoding/json"
+	"mgmt"
+	"sort"
+)
+
+// configSnapshot: the replicated config of the server set by the committed reconfigurations,
+// which the joined node restores from the snapshot instead of replaying the blocks below it
+type configSnapshot struct {
+	Epoch     mgmt.Epoch              // the epoch of nodes
+	Reconfigs []bcrequest.ReconfigCmd // the reconfigurations applied again in order, that is, the last retuned knobs and the admissions
+}
+
+// snapshot: get the snapshot of the state machine and the replicated config at the last applied block
+// return:
+// - the snapshot and error
+func (s *Server) snapshot() (blockchain.Snapshot, error) {
+	sm := s.Orderer.Consensus.Options().StateMachine
+	height := sm.Applied()
+	state, err := sm.Snapshot()
+	if err != nil {
+		return blockchain.Snapshot{}, err
+	}
+
+	config := configSnapshot{Epoch: s.NodeManager.Epoch, Reconfigs: make([]bcrequest.ReconfigCmd, 0)}
+	s.reconfLock.Lock()
+	for _, op := range []string{bcrequest.RECONFIG_BATCH, bcrequest.RECONFIG_TIMEOUT, bcrequest.RECONFIG_PROTOCOL} {
+		if value, ok := s.retuned[op]; ok {
+			config.Reconfigs = append(config.Reconfigs, bcrequest.ReconfigCmd{Op: op, Value: value})
+		}
+	}
+	admitted := make([]string, 0, len(s.admitted))
+	for name := range s.admitted {
+		admitted = append(admitted, name)
+	}
+	s.reconfLock.Unlock()
+	sort.Strings(admitted)
+	for _, name := range admitted {
+		config.Reconfigs = append(config.Reconfigs, bcrequest.ReconfigCmd{Op: bcrequest.RECONFIG_ADMIT, Value: name})
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return blockchain.Snapshot{}, err
+	}
+	return blockchain.Snapshot{Height: height, State: state, Config: content}, nil
+}
+
+// syncState: get the snapshot and the latest committed blocks synced to the joined node, which replays the blocks after the snapshot,
+// and the blocks below it are the ones observed by the leader election, see replayElection, or the tip which the next block extends
+// return:
+// - the snapshot, the blocks in order of height and error
+func (s *Server) syncState() (blockchain.Snapshot, []blockchain.Block, error) {
+	snapshot, err := s.snapshot()
+	if err != nil {
+		return snapshot, nil, err
+	}
+	storage := s.Orderer.GetBlockStore().GetStorage()
+	tip, err := storage.GetBlockHeight()
+	if err != nil {
+		return snapshot, nil, err
+	}
+	from := snapshot.Height + 1
+	if elector := s.Orderer.Consensus.Options().Elector; elector != nil && tip-elector.HistorySize()+1 < from {
+		from = tip - elector.HistorySize() + 1
+	}
+	from = max(min(from, tip), 0)
+
+	blks := make([]blockchain.Block, 0, tip-from+1)
+	for height := from; height <= tip; height++ {
+		blk, err := storage.ReadBlock(height)
+		if err != nil {
+			return snapshot, nil, err
+		}
+		blks = append(blks, *blk)
+	}
+	return snapshot, blks, nil
+}
+
+// restoreConfig: restore the replicated config of the snapshot, the epoch is set if it is later than the current one,
+// and the reconfigurations are applied as they are replayed in recovery
+// params:
+// - content: the json of the replicated config in the snapshot
+// return:
+// - error if the config can't be decoded
+func (s *Server) restoreConfig(content []byte) error {
+	var config configSnapshot
+	if err := json.Unmarshal(content, &config); err != nil {
+		return err
+	}
+	recovering := s.recovering.Swap(true)
+	defer s.recovering.Store(recovering)
+	if config.Epoch.Number > s.NodeManager.Epoch.Number {
+		s.NodeManager.SetEpoch(config.Epoch)
+		s.applyEpoch()
+	}
+	for i := range config.Reconfigs {
+		s.ApplyReconfig(&config.Reconfigs[i])
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"blockchain"
+	"errors"
+)
+
+// InitStorage: open the block storage of consensus according to the config
+// return:
+// - error
+func (s *Server) InitStorage() error {
+	bs := s.Orderer.GetBlockStore()
+	if bs == nil {
+		return errors.New("consensus type is unknown type")
+	}
+	storage, err := blockchain.NewBlockStorage(bs.Path, blockchain.StorageOptions{
+		Type:        blockchain.StorageType(s.Config.Storage),
+		SegmentSize: s.Config.SegmentSize,
+		Sync:        blockchain.SyncPolicy(s.Config.SyncPolicy),
+		SyncBatch:   s.Config.SyncBatch,
+	})
+	if err != nil {
+		return err
+	}
+	bs.SetStorage(storage)
+	return nil
+}
+
+// CloseStorage: flush and close the block storage of consensus
+func (s *Server) CloseStorage() error {
+	bs := s.Orderer.GetBlockStore()
+	if bs == nil || bs.Storage == nil {
+		return nil
+	}
+	err := bs.Storage.Close()
+	bs.Storage = nil
+	return err
+}
+
+// Restart: restart the server as it crashes and reboots, the consensus is rebuilt
+// and recovered from the local block store, then rejoins the running system
+// return:
+// - error
+func (s *Server) Restart() error {
+	s.Orderer.Stop()
+	if err := s.CloseStorage(); err != nil {
+		return err
+	}
+	s.Orderer.Reset()
+	if err := s.InitStorage(); err != nil {
+		return err
+	}
+
+	var err error
+	s.Recovered, err = s.recover()
+	if err != nil {
+		return err
+	}
+	s.Orderer.Rejoin()
+	return nil
+}
+
+// recover: recover the consensus from the local block store,
+// the reconfigurations of the replayed blocks are applied again, but the replayed switch of protocol is only recorded
+// note: the node joined by a snapshot doesn't store the blocks below it, so the replicated config of the snapshot is restored
+// before the later blocks are replayed, unless the state machine taken over by the consensus has applied them
+// return:
+// - true if there is local data to recover from, and error
+func (s *Server) recover() (bool, error) {
+	s.recovering.Store(true)
+	defer s.recovering.Store(false)
+	if s.Orderer.Consensus.Options().StateMachine.Applied() < 0 {
+		snapshot, err := s.Orderer.GetBlockStore().LoadSnapshot()
+		if err != nil {
+			return false, err
+		}
+		if snapshot != nil {
+			if err := s.restoreConfig(snapshot.Config); err != nil {
+				return false, err
+			}
+		}
+	}
+	recovered, err := s.Orderer.Recover()
+	s.epoch.Store(int64(s.NodeManager.Epoch.Number))
+	return recovered, err
+}
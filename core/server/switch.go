@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	common "common"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"message"
+	"mgmt"
+	"orderer"
+)
+
+// AddSigner: provide the signer of the protocol which the server may switch to,
+// the committed switch to a protocol without signer is only recorded, see ApplyReconfig
+// note: the threshold signers depend on the number of nodes, so the signers of the nodes after a join or exit are generated by the nodes, see startRekey
+// params:
+// - consType: the consensus protocol type
+// - signer:   the signer of the server for the protocol
+func (s *Server) AddSigner(consType common.ConsensusType, signer interface{}) {
+	s.reconfLock.Lock()
+	defer s.reconfLock.Unlock()
+	s.signers[consType] = signer
+}
+
+// SwitchProtocol: switch the consensus protocol online, the running consensus is stopped, and the consensus of the new protocol
+// continues from the tip and the view of the local block store with the same nodes,
+// the requests proposed but not committed by the old consensus are proposed again from the mempool,
+// and the committed ones are rejected by the request validator, so no request is lost or committed twice
+// note: the switch committed by consensus halts all replicas at the same block before switching, see switchHalted
+// params:
+// - consType: the consensus protocol type switched to, whose signer is provided by AddSigner
+// return:
+// - error, and the server restarts with the old protocol if the new one can't be created
+func (s *Server) SwitchProtocol(consType common.ConsensusType) error {
+	s.switchLock.Lock()
+	defer s.switchLock.Unlock()
+
+	s.reconfLock.Lock()
+	signer, ok := s.signers[consType]
+	s.reconfLock.Unlock()
+	if !ok {
+		return fmt.Errorf("no signer for consensus type %q", consType)
+	}
+	from := s.Orderer.ConsType
+	if err := s.rebuild(consType, s.nodesNum(), signer); err != nil {
+		return err
+	}
+	s.Logger.Println("[SWITCH]:", s.ServerID.ID.Name, from, "->", consType, "Height:", s.Orderer.GetBlockStore().Height)
+	s.NotifyReq()
+	return nil
+}
+
+// rebuild: rebuild the consensus by the protocol with the number of nodes, and recover it from the local block store,
+// the lock of switch must be held by the caller
+// return:
+// - error, and the server restarts with the old consensus if the new one can't be created
+func (s *Server) rebuild(consType common.ConsensusType, nodeNum int, signer interface{}) error {
+	// the request handler keeps waiting for the new consensus, so only the old consensus is stopped
+	s.Orderer.Consensus.Stop()
+	if err := s.CloseStorage(); err != nil {
+		return err
+	}
+	s.Orderer.SendChan = s.epochSendChan(s.NodeManager.Epoch.Number)
+	if err := s.Orderer.Reconfigure(consType, nodeNum, signer); err != nil {
+		if restartErr := s.Restart(); restartErr != nil {
+			return restartErr
+		}
+		return err
+	}
+	if err := s.InitStorage(); err != nil {
+		return err
+	}
+
+	var err error
+	s.Mempool.Requeue()
+	s.Recovered, err = s.recover()
+	if err != nil {
+		return err
+	}
+	s.Orderer.Handover()
+	return nil
+}
+
+// switchHalted: rebuild the consensus halted by the committed switch, or continue it with the nodes of the epoch started by the committed change,
+// the messages of the old consensus are sent before, such as the replies of the last block, and the node which has exited is stopped,
+// it is called by the message router, so no message is handled meanwhile,
+// and the messages of the new consensus recieved from the replicas switched before are handled after it
+func (s *Server) switchHalted() {
+	s.reconfLock.Lock()
+	consType, changing, joiners, exits, dealers := s.switching, s.changing, s.joiners, s.exits, s.dealers
+	s.switching, s.changing, s.joiners, s.exits = "", false, nil, nil
+	s.reconfLock.Unlock()
+	if consType == "" && !changing {
+		return
+	}
+
+	for len(s.SendChan) > 0 {
+		s.SendMsg(<-s.SendChan)
+	}
+	blk, err := s.switchBlock()
+	if err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "rebuild the halted consensus", err)
+		return
+	}
+	// the exited node deals its share to the nodes of the epoch before it stops
+	rekey := consType == "" && s.needRekey(s.NodeManager.Epoch.Number)
+	if !s.IsMember() {
+		s.updateTransport()
+		s.Orderer.Stop()
+		s.Logger.Println("[EXIT]:", s.ServerID.ID.Name, "exit at height", blk.BlkHdr.Height)
+		if rekey && !s.Config.RotateKey {
+			rk, err := s.newRekey(dealers)
+			if err == nil {
+				err = s.startRekey(rk)
+			}
+			if err != nil {
+				s.Logger.Println("[Error]:", s.ServerID.ID.Name, "deal the share of epoch", rk.Epoch, err)
+			}
+		}
+		return
+	}
+
+	// the pipelined protocols commit a block once the later ones are certified, and the replicas commit the block
+	// of the switch at different times, so the block is sent to the other replicas before any message of the new consensus,
+	// then the replicas which miss it or haven't committed it yet catch up and switch before handling the new messages,
+	// and the exited nodes are sent the block too, so they stop at the same block
+	if payload, err := json.Marshal(blk); err == nil {
+		for _, name := range append(s.GetOtherNodeNames(), exits...) {
+			s.SendMsg(message.ServerMsg{
+				SType:      message.SWITCH,
+				SendServer: s.ServerID.ID.Name,
+				ReciServer: name,
+				Payload:    payload,
+			})
+		}
+	}
+	s.updateTransport()
+
+	// the consensus continues after the nodes of the epoch generate the signers, see endRekey
+	if rekey {
+		rk, err := s.newRekey(dealers)
+		if err == nil {
+			err = s.startRekey(rk)
+		}
+		if err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "generate the signers of epoch", rk.Epoch, err)
+			return
+		}
+		for _, name := range joiners {
+			s.SyncJoiner(name, rk)
+		}
+		return
+	}
+
+	// the joined nodes are synced with the state of the halted block before the consensus goes on, which is the same on all replicas
+	for _, name := range joiners {
+		s.SyncJoiner(name, mgmt.Rekey{})
+	}
+	if consType != "" {
+		err = s.SwitchProtocol(consType)
+	} else {
+		err = s.ChangeNodes()
+	}
+	if err != nil {
+		s.Logger.Println("[Error]:", s.ServerID.ID.Name, "rebuild the halted consensus", err)
+		return
+	}
+	s.handleLater()
+}
+
+// switchBlock: get the committed block of the switch, which is the tip of the halted block store
+func (s *Server) switchBlock() (*blockchain.Block, error) {
+	storage := s.Orderer.GetBlockStore().GetStorage()
+	height, err := storage.GetBlockHeight()
+	if err != nil {
+		return nil, err
+	}
+	return storage.ReadBlock(height)
+}
+
+// CatchUpSwitch: the replica which misses the committed block of the switch or change of nodes commits the block
+// sent by a rebuilt replica and is rebuilt too, the block must extend the local tip and be validated by the running protocol,
+// or be the local tip which is stored but not executed yet
+// note: only the replica falling one block behind catches up, such as the followers of the pipelined protocols
+// and the replicas which receive the block before committing it
+// params:
+// - payload: the encoded block of the switch
+func (s *Server) CatchUpSwitch(payload []byte) {
+	blk := blockchain.Block{}
+	if err := json.Unmarshal(payload, &blk); err != nil {
+		return
+	}
+	bs := s.Orderer.GetBlockStore()
+	if bs == nil || bs.Halted() {
+		return
+	}
+	tip, err := s.switchBlock()
+	if err != nil {
+		return
+	}
+
+	// the block is the tip if it is stored but not executed yet, such as by the pipelined protocols which execute it later
+	stored := blk.BlkHdr.Height == tip.BlkHdr.Height && bytes.Equal(blk.Hash(), tip.Hash())
+	if !stored {
+		if blk.BlkHdr.Height != tip.BlkHdr.Height+1 {
+			return
+		}
+		if err := s.verifySwitchBlock(&blk, tip); err != nil {
+			s.Logger.Println("[Error]:", s.ServerID.ID.Name, "drop the block of switch", err)
+			return
+		}
+	}
+
+	// the block switches to the protocol of the last reconfiguration in it, as it is applied in order of commit,
+	// and changes the nodes by the joins and exits in it unless the epoch started by it has been applied
+	var consType common.ConsensusType
+	changes := make([]*bcrequest.ReconfigCmd, 0)
+	for _, tx := range blk.BlkData.Trans {
+		req, err := bcrequest.DecodeTx([]byte(tx))
+		if err != nil {
+			continue
+		}
+		rc, _ := bcrequest.ParseReconfigCmd(req.Cmd)
+		if rc == nil || (s.Orderer.ReqValidator != nil && s.Orderer.ReqValidator.Check(req) != nil) {
+			continue
+		}
+		switch rc.Op {
+		case bcrequest.RECONFIG_PROTOCOL:
+			consType = common.ConsensusType(rc.Value)
+		case bcrequest.RECONFIG_JOIN, bcrequest.RECONFIG_EXIT:
+			if s.NodeManager.Epoch.Height <= blk.BlkHdr.Height {
+				rc.Height, rc.Client = blk.BlkHdr.Height, req.Id
+				changes = append(changes, rc)
+			}
+		}
+	}
+	s.reconfLock.Lock()
+	_, ok := s.signers[consType]
+	s.reconfLock.Unlock()
+	if (!ok || consType == s.Orderer.ConsType) && len(changes) == 0 {
+		return
+	}
+
+	// the block is stored but not executed, it is replayed by the new consensus which recovers from the block store
+	s.Orderer.Consensus.Stop()
+	if !stored {
+		bs.CurBlkHash = blk.Hash()
+		bs.StoreBlock(blk)
+	}
+	s.Orderer.Halt()
+	s.Logger.Println("[SWITCH]:", s.ServerID.ID.Name, "catch up with the block of switch", "Height:", blk.BlkHdr.Height)
+
+	for _, rc := range changes {
+		s.applyNodes(rc)
+	}
+	if ok && consType != s.Orderer.ConsType {
+		s.reconfLock.Lock()
+		s.switching = consType
+		s.reconfLock.Unlock()
+	}
+	s.switchHalted()
+}
+
+// verifySwitchBlock: check the block of switch extends the tip and is validated by the running protocol
+func (s *Server) verifySwitchBlock(blk *blockchain.Block, tip *blockchain.Block) error {
+	if !bytes.Equal(blk.BlkHdr.PreBlkHash, tip.Hash()) {
+		return errors.New("the block doesn't extend the tip")
+	}
+	if err := blk.VerifyBlockData(); err != nil {
+		return err
+	}
+	p, err := orderer.LookupProtocol(s.Orderer.ConsType)
+	if err != nil {
+		return err
+	}
+	return p.VerifyBlock(&blk.BlkHdr, s.Orderer.PublicKey())
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"crypto/tls"
+	"transport"
+)
+
+// InitTransport: init the transport between replicas according to the config,
+// the tcp connections are secured by TLS if the certificate of the replica is given,
+// and the binary messages to the JSON-only replicas are encoded by JSON again, see TranscodeMsg
+// params:
+// - nodesChannel: the channels table of all nodes, used by the channel transport
+// return:
+// - error
+func (s *Server) InitTransport(nodesChannel map[string]chan []byte) error {
+	switch transport.TransportType(s.Config.Transport) {
+	case transport.TCP:
+		var conf *tls.Config
+		if s.Config.TLSCert != "" {
+			var err error
+			conf, err = transport.LoadTLSConfig(s.Config.TLSCert, s.Config.TLSKey, s.Config.TLSCA)
+			if err != nil {
+				return err
+			}
+		}
+		tt, err := transport.NewTLSTransport(s.ServerID.ID.Name, s.Config.Peers, s.ServerID.Address, s.Codec, conf)
+		if err != nil {
+			return err
+		}
+		tt.Transcode = s.TranscodeMsg
+		s.Transport = tt
+	default:
+		s.Transport = transport.NewChanTransport(nodesChannel)
+	}
+	return nil
+}
+
+// CloseTransport: close the transport between replicas
+func (s *Server) CloseTransport() error {
+	if s.Transport == nil {
+		return nil
+	}
+	return s.Transport.Close()
+}
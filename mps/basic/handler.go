@@ -1,7 +1,9 @@
 package bcmanager
 
 import (
+	"bytes"
 	"mgmt"
+	"slices"
 )
 
 // HanleJoin: the nodes in original system handle the join message
@@ -134,3 +136,89 @@ func (nm *NodeManager) GetLeaderFromSyncMsgs(syncMsgs []*mgmt.NodeMgmtMsg) int {
 	}
 	return -1
 }
+
+// HandleEpochSync: the joined node handles the sync message sent by the replicas after its join is committed,
+// the message is selected once f+1 replicas of the epoch send the same epoch, snapshot, blocks and generation of signers, so at least one of them is honest,
+// instead of trusting the one which claims the highest QC
+// note: the blocks of a replica are sent in chunks, and its sync message is counted once all the chunks are recieved in order
+// params:
+// - msg: the chunk of the sync message with the epoch, the snapshot and the latest committed blocks
+// return:
+// - the selected sync message, nil if not enough replicas agree or the epoch has been synced
+func (nm *NodeManager) HandleEpochSync(msg *mgmt.NodeMgmtMsg) *mgmt.NodeMgmtMsg {
+	if msg.Epoch.Number <= nm.Epoch.Number || len(msg.Block) == 0 || msg.SendNode == nm.GetName() ||
+		!slices.Contains(msg.Epoch.Nodes, msg.SendNode) || !slices.Contains(msg.Epoch.Nodes, nm.GetName()) {
+		return nil
+	}
+	if msg = nm.assembleSync(msg); msg == nil {
+		return nil
+	}
+	for _, m := range nm.SyncMsgs {
+		if m.SendNode == msg.SendNode && m.Epoch.Number == msg.Epoch.Number {
+			return nil
+		}
+	}
+	nm.SyncMsgs = append(nm.SyncMsgs, msg)
+
+	// check the threshold, (m > f)
+	matched := 0
+	for _, m := range nm.SyncMsgs {
+		if sameSync(m, msg) {
+			matched++
+		}
+	}
+	if matched <= (len(msg.Epoch.Nodes)-1)/3 {
+		return nil
+	}
+	nm.SyncMsgs = make([]*mgmt.NodeMgmtMsg, 0)
+
+	// log
+	nm.Logger.Println("[SYNC]:", nm.GetName(), "sync succeed in epoch", msg.Epoch.Number)
+	return msg
+}
+
+// assembleSync: append the chunk to the sync message of its sender, the chunk out of order drops the assembled chunks
+// return:
+// - the assembled sync message once its last chunk is recieved, or nil
+func (nm *NodeManager) assembleSync(msg *mgmt.NodeMgmtMsg) *mgmt.NodeMgmtMsg {
+	if msg.Chunks <= 1 {
+		return msg
+	}
+	if msg.Chunk == 0 {
+		assembled := *msg
+		assembled.Block = slices.Clone(msg.Block)
+		nm.SyncChunks[msg.SendNode] = &assembled
+		return nil
+	}
+	assembled, ok := nm.SyncChunks[msg.SendNode]
+	if !ok || assembled.Epoch.Number != msg.Epoch.Number || assembled.Chunks != msg.Chunks || assembled.Chunk+1 != msg.Chunk {
+		delete(nm.SyncChunks, msg.SendNode)
+		return nil
+	}
+	assembled.Block = append(assembled.Block, msg.Block...)
+	assembled.Chunk = msg.Chunk
+	if assembled.Chunk+1 < assembled.Chunks {
+		return nil
+	}
+	delete(nm.SyncChunks, msg.SendNode)
+	return assembled
+}
+
+// sameSync: check whether the sync messages are sent in the same epoch with the same snapshot, blocks and generation of signers
+func sameSync(a *mgmt.NodeMgmtMsg, b *mgmt.NodeMgmtMsg) bool {
+	if a.Epoch.Number != b.Epoch.Number || a.Epoch.Height != b.Epoch.Height || !slices.Equal(a.Epoch.Nodes, b.Epoch.Nodes) || len(a.Block) != len(b.Block) {
+		return false
+	}
+	if a.Snapshot.Height != b.Snapshot.Height || !bytes.Equal(a.Snapshot.State, b.Snapshot.State) || !bytes.Equal(a.Snapshot.Config, b.Snapshot.Config) {
+		return false
+	}
+	if a.Rekey.Epoch != b.Rekey.Epoch || !slices.Equal(a.Rekey.Dealers, b.Rekey.Dealers) || !slices.EqualFunc(a.Rekey.Commits, b.Rekey.Commits, bytes.Equal) {
+		return false
+	}
+	for i := range a.Block {
+		if !bytes.Equal(a.Block[i].Hash(), b.Block[i].Hash()) {
+			return false
+		}
+	}
+	return true
+}
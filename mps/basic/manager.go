@@ -6,8 +6,9 @@ import (
 
 // NodeManager: the basic node manager extend the orignal node manager
 type NodeManager struct {
-	mgmt.NodeManager                     // extend the orignal node manager
-	SyncMsgs         []*mgmt.NodeMgmtMsg //the slice of recieved sync message
+	mgmt.NodeManager                              // extend the orignal node manager
+	SyncMsgs         []*mgmt.NodeMgmtMsg          //the slice of recieved sync message
+	SyncChunks       map[string]*mgmt.NodeMgmtMsg // the sync message of each sender assembled from the recieved chunks
 }
 
 // NewNodeManager: generate a new node manager
@@ -19,6 +20,7 @@ func NewNodeManager(id int, nodesTable map[string]mgmt.NodeKey, nodesChannel map
 	newNodeManager := &NodeManager{
 		*mgmt.NewNodeManager(id, nodesTable, nodesChannel),
 		make([]*mgmt.NodeMgmtMsg, 0),
+		make(map[string]*mgmt.NodeMgmtMsg),
 	}
 
 	return newNodeManager
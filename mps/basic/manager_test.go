@@ -2,6 +2,7 @@ package bcmanager_test
 
 import (
 	"bcmanager"
+	"blockchain"
 	"crypto/rand"
 	"fmt"
 	"mgmt"
@@ -27,3 +28,76 @@ func TestEmbedding(t *testing.T) {
 	tt := []string{"123", "213"}
 	fmt.Println(tt, tt[:1], tt[2:])
 }
+
+// TestEpochSync: test the joined node selects the sync message once f+1 nodes of the epoch send the same blocks
+func TestEpochSync(t *testing.T) {
+	nm := bcmanager.NewNodeManager(4, map[string]mgmt.NodeKey{}, nil)
+	epoch := mgmt.Epoch{Number: 1, Height: 3, Nodes: []string{"r_0", "r_1", "r_2", "r_3", "r_4"}}
+	blocks := func(tx string) []blockchain.Block {
+		blks := make([]blockchain.Block, 3)
+		for i := range blks {
+			blks[i].BlkHdr.Height = i
+			blks[i].BlkData.Trans = []string{fmt.Sprintf("%s %d", tx, i)}
+			blks[i].BlkHdr.BlkDataHash = blks[i].BlkData.Hash()
+		}
+		return blks
+	}
+	syncMsg := func(sender string, tx string) *mgmt.NodeMgmtMsg {
+		return &mgmt.NodeMgmtMsg{Type: mgmt.JOIN, NMType: mgmt.NM_SYNC, Epoch: epoch, Block: blocks(tx), SendNode: sender, ReciNode: "r_4"}
+	}
+
+	// the forged blocks, the sender out of the epoch and the message sent again are not counted
+	for _, msg := range []*mgmt.NodeMgmtMsg{syncMsg("r_0", "forged"), syncMsg("r_9", "put"), syncMsg("r_1", "put"), syncMsg("r_1", "put")} {
+		if nm.HandleEpochSync(msg) != nil {
+			t.Fatal("the sync message is selected by", msg.SendNode)
+		}
+	}
+	synced := nm.HandleEpochSync(syncMsg("r_2", "put"))
+	if synced == nil || synced.Block[2].BlkData.Trans[0] != "put 2" {
+		t.Fatal("the sync message sent by f+1 nodes is not selected")
+	}
+}
+
+// TestEpochSyncChunks: test the joined node assembles the chunks of each replica in order before counting its sync message
+func TestEpochSyncChunks(t *testing.T) {
+	nm := bcmanager.NewNodeManager(4, map[string]mgmt.NodeKey{}, nil)
+	epoch := mgmt.Epoch{Number: 1, Height: 40, Nodes: []string{"r_0", "r_1", "r_2", "r_3", "r_4"}}
+	blks := make([]blockchain.Block, 2*mgmt.SYNC_CHUNK_BLOCKS+1)
+	for i := range blks {
+		blks[i].BlkHdr.Height = i
+		blks[i].BlkHdr.BlkDataHash = blks[i].BlkData.Hash()
+	}
+	chunks := func(sender string) []*mgmt.NodeMgmtMsg {
+		msgs := make([]*mgmt.NodeMgmtMsg, 0, 3)
+		for i := 0; i < 3; i++ {
+			msg := &mgmt.NodeMgmtMsg{Type: mgmt.JOIN, NMType: mgmt.NM_SYNC, Epoch: epoch, Chunk: i, Chunks: 3, SendNode: sender, ReciNode: "r_4",
+				Block: blks[i*mgmt.SYNC_CHUNK_BLOCKS : min((i+1)*mgmt.SYNC_CHUNK_BLOCKS, len(blks))]}
+			if i == 0 {
+				msg.Snapshot = blockchain.Snapshot{Height: len(blks) - 1, State: []byte("state")}
+			}
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+
+	// the chunks out of order are dropped, and the sync message isn't counted until its last chunk
+	r0, r1 := chunks("r_0"), chunks("r_1")
+	for _, msg := range []*mgmt.NodeMgmtMsg{r0[0], r0[2], r0[1], r1[0], r1[1]} {
+		if nm.HandleEpochSync(msg) != nil {
+			t.Fatal("the sync message is selected by chunk", msg.Chunk, "of", msg.SendNode)
+		}
+	}
+	if nm.HandleEpochSync(r0[2]) != nil {
+		t.Fatal("the sync message is selected by the dropped chunks")
+	}
+	synced := nm.HandleEpochSync(r1[2])
+	if synced != nil {
+		t.Fatal("the sync message is selected by a single replica")
+	}
+	for _, msg := range chunks("r_2") {
+		synced = nm.HandleEpochSync(msg)
+	}
+	if synced == nil || len(synced.Block) != len(blks) || synced.Snapshot.Height != len(blks)-1 || string(synced.Snapshot.State) != "state" {
+		t.Fatal("the assembled sync message sent by f+1 nodes is not selected")
+	}
+}
@@ -0,0 +1,3 @@
+module bftsmart
+
+go 1.21.5
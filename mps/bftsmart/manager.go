@@ -0,0 +1,105 @@
+package bftsmart
+
+import (
+	"bcrequest"
+	"errors"
+	"slices"
+)
+
+// MIN_NODES: the min number of nodes of a view, which tolerates one faulty node
+const MIN_NODES = 4
+
+var (
+	ErrMember      = errors.New("the node is in the view")
+	ErrNotMember   = errors.New("the node is not in the view")
+	ErrTooFewNodes = errors.New("the view has too few nodes")
+	ErrNoUpdates   = errors.New("no update of the view")
+)
+
+// View: the view of nodes installed by the view manager, which is the epoch of nodes of the replicas,
+// each join or exit is committed as a change of nodes, so the id of view follows the number of epoch
+type View struct {
+	ID        int      // the number of the committed changes of nodes
+	Processes []string // the sorted names of the nodes
+}
+
+// F: get the number of faulty nodes tolerated by the view
+func (v View) F() int {
+	return (len(v.Processes) - 1) / 3
+}
+
+// ViewManager: the trusted administrator of the nodes like the view manager of BFT-SMaRt, which collects the servers to add and remove,
+// and executes the updates as the joins and exits signed by its key, the replicas of the bftsmart node manager only apply
+// the joins and exits sent by it, see Config.ViewManager
+type ViewManager struct {
+	view  View
+	joins []string
+	exits []string
+	sign  func(cmds [][]byte) []bcrequest.BCRequest // sign the reconfigurations by the key of the view manager
+}
+
+// NewViewManager: create the view manager of the current view
+// params:
+// - id:    the id of the current view, that is, the number of epoch of the replicas
+// - nodes: the nodes of the current view
+// - sign:  sign the reconfigurations by the key of the view manager, which is an operator of the replicas
+func NewViewManager(id int, nodes []string, sign func(cmds [][]byte) []bcrequest.BCRequest) *ViewManager {
+	processes := slices.Clone(nodes)
+	slices.Sort(processes)
+	return &ViewManager{view: View{ID: id, Processes: processes}, sign: sign}
+}
+
+// View: get the view installed by the last executed updates
+func (vm *ViewManager) View() View {
+	return vm.view
+}
+
+// AddServer: add the node to the next view, the node must have applied to join the replicas with its key
+// return:
+// - ErrMember if the node is in the view or has been added
+func (vm *ViewManager) AddServer(name string) error {
+	if slices.Contains(vm.view.Processes, name) || slices.Contains(vm.joins, name) {
+		return ErrMember
+	}
+	vm.joins = append(vm.joins, name)
+	return nil
+}
+
+// RemoveServer: remove the node from the next view
+// return:
+// - ErrNotMember if the node is not in the view or has been removed, ErrTooFewNodes if the next view has less than MIN_NODES nodes
+func (vm *ViewManager) RemoveServer(name string) error {
+	if !slices.Contains(vm.view.Processes, name) || slices.Contains(vm.exits, name) {
+		return ErrNotMember
+	}
+	if len(vm.view.Processes)+len(vm.joins)-len(vm.exits)-1 < MIN_NODES {
+		return ErrTooFewNodes
+	}
+	vm.exits = append(vm.exits, name)
+	return nil
+}
+
+// ExecuteUpdates: sign the joins and the exits of the added and removed servers, and install the next view,
+// the joins are committed before the exits, so the number of nodes never falls below MIN_NODES
+// return:
+// - the signed reconfigurations to submit to the replicas, and ErrNoUpdates if no server is added or removed
+func (vm *ViewManager) ExecuteUpdates() ([]bcrequest.BCRequest, error) {
+	if len(vm.joins) == 0 && len(vm.exits) == 0 {
+		return nil, ErrNoUpdates
+	}
+	cmds := make([][]byte, 0, len(vm.joins)+len(vm.exits))
+	processes := slices.Clone(vm.view.Processes)
+	for _, name := range vm.joins {
+		cmds = append(cmds, bcrequest.ReconfigCommand(bcrequest.RECONFIG_JOIN, name))
+		processes = append(processes, name)
+	}
+	for _, name := range vm.exits {
+		cmds = append(cmds, bcrequest.ReconfigCommand(bcrequest.RECONFIG_EXIT, name))
+		processes = slices.DeleteFunc(processes, func(p string) bool { return p == name })
+	}
+	slices.Sort(processes)
+
+	vm.view = View{ID: vm.view.ID + len(cmds), Processes: processes}
+	vm.joins, vm.exits = nil, nil
+	return vm.sign(cmds), nil
+}
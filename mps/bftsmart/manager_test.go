@@ -0,0 +1,52 @@
+package bftsmart_test
+
+import (
+	"bcrequest"
+	"bftsmart"
+	"slices"
+	"testing"
+)
+
+// TestViewManager: test the view manager signs the joins before the exits and installs the next view
+func TestViewManager(t *testing.T) {
+	sign := func(cmds [][]byte) []bcrequest.BCRequest {
+		reqs := make([]bcrequest.BCRequest, len(cmds))
+		for i, cmd := range cmds {
+			reqs[i] = bcrequest.BCRequest{Id: "c_0", Seq: uint64(i + 1), Cmd: cmd}
+		}
+		return reqs
+	}
+	vm := bftsmart.NewViewManager(0, []string{"r_3", "r_1", "r_0", "r_2"}, sign)
+	if _, err := vm.ExecuteUpdates(); err != bftsmart.ErrNoUpdates {
+		t.Fatal("the empty updates are executed")
+	}
+
+	// the view of 4 nodes can't remove a node until a node is added
+	if err := vm.RemoveServer("r_3"); err != bftsmart.ErrTooFewNodes {
+		t.Fatal("the view falls below the min number of nodes")
+	}
+	if err := vm.AddServer("r_1"); err != bftsmart.ErrMember {
+		t.Fatal("the member is added")
+	}
+	if err := vm.AddServer("r_4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.RemoveServer("r_3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.RemoveServer("r_3"); err != bftsmart.ErrNotMember {
+		t.Fatal("the node is removed twice")
+	}
+
+	reqs, err := vm.ExecuteUpdates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 || string(reqs[0].Cmd) != "dcs join r_4" || string(reqs[1].Cmd) != "dcs exit r_3" {
+		t.Fatal("the updates are not signed in order", reqs)
+	}
+	view := vm.View()
+	if view.ID != 2 || !slices.Equal(view.Processes, []string{"r_0", "r_1", "r_2", "r_4"}) || view.F() != 1 {
+		t.Fatal("the next view is not installed", view)
+	}
+}
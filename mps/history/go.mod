@@ -0,0 +1,3 @@
+module history
+
+go 1.21.5
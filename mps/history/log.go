@@ -0,0 +1,195 @@
+package history
+
+import (
+	"mgmt"
+	"sort"
+	"sync"
+)
+
+// the default config of the node manager based on history
+const (
+	WINDOW    = 1000 // the number of the latest logged consensus messages which the participation is measured in
+	THRESHOLD = 0.2  // the node whose score is below the fraction of the median score of the nodes is inactive
+	COOLDOWN  = 2    // the number of epochs after the exit of a node before it is admitted again
+)
+
+// Record: the participation of a node logged in the window
+type Record struct {
+	Votes     int // the number of votes
+	Proposals int // the number of proposals
+	Timeouts  int // the number of messages sent after the views time out
+}
+
+// Score: get the score of participation, the votes and the proposals count for the node and the timeouts against it
+func (r Record) Score() int {
+	return r.Votes + r.Proposals - r.Timeouts
+}
+
+// entry: a logged consensus message
+type entry struct {
+	name string
+	kind mgmt.Participation
+}
+
+// Log: the log of the participation of the nodes, which is measured in the window of the latest logged consensus messages,
+// the inactive nodes are evicted and the exited nodes are admitted again after the cooldown by the reconfigurations ordered by consensus,
+// since the log of each replica depends on the messages it recieves
+type Log struct {
+	Threshold float64 // the node whose score is below the fraction of the median score is inactive
+	Cooldown  int     // the number of epochs after the exit of a node before it is admitted again
+
+	mu       sync.Mutex
+	window   []entry            // the ring of the logged messages
+	next     int                // the index of the next logged message in the ring
+	full     bool               // whether the ring is full, the nodes are not judged before it
+	records  map[string]*Record // the participation of each node in the window
+	exited   map[string]int     // the epoch in which each node exited
+	reported map[string]bool    // the inactive nodes reported in the window, which are not reported again until the log is reset
+}
+
+// NewLog: create the log of participation with the default threshold and cooldown
+// params:
+// - window: the number of the latest logged messages, WINDOW is used if it is not positive
+func NewLog(window int) *Log {
+	if window <= 0 {
+		window = WINDOW
+	}
+	return &Log{
+		Threshold: THRESHOLD,
+		Cooldown:  COOLDOWN,
+		window:    make([]entry, window),
+		records:   make(map[string]*Record),
+		exited:    make(map[string]int),
+		reported:  make(map[string]bool),
+	}
+}
+
+// Record: log the consensus message as the participation of its sender, the oldest message leaves the window
+// params:
+// - name: the sender of the message
+// - kind: the kind of participation, the message of mgmt.PART_NONE isn't logged
+func (l *Log) Record(name string, kind mgmt.Participation) {
+	if kind == mgmt.PART_NONE {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.full {
+		l.count(l.window[l.next], -1)
+	}
+	l.window[l.next] = entry{name, kind}
+	l.count(l.window[l.next], 1)
+	l.next = (l.next + 1) % len(l.window)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// count: add the logged message to the record of its sender, the lock must be held by the caller
+func (l *Log) count(e entry, delta int) {
+	r, ok := l.records[e.name]
+	if !ok {
+		r = &Record{}
+		l.records[e.name] = r
+	}
+	switch e.kind {
+	case mgmt.PART_VOTE:
+		r.Votes += delta
+	case mgmt.PART_PROPOSAL:
+		r.Proposals += delta
+	case mgmt.PART_TIMEOUT:
+		r.Timeouts += delta
+	}
+}
+
+// Get: get the participation of the node in the window
+func (l *Log) Get(name string) Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.records[name]; ok {
+		return *r
+	}
+	return Record{}
+}
+
+// Reset: clear the window when the nodes are changed, so the nodes of the new epoch are judged by the messages of the epoch
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.window = make([]entry, len(l.window))
+	l.next, l.full = 0, false
+	l.records = make(map[string]*Record)
+	l.reported = make(map[string]bool)
+}
+
+// Inactive: get the inactive nodes once the window is full, whose score is below the threshold of the median score of the nodes,
+// the least active ones are reported first, and at most f of n nodes are reported without leaving less than 4 nodes
+// note: the node reported once isn't reported again until the log is reset
+// params:
+// - nodes:      the nodes of the epoch, whose median score is the base of the threshold
+// - candidates: the nodes which may be reported, such as the nodes of the epoch except the replica itself
+// return:
+// - the inactive nodes to evict
+func (l *Log) Inactive(nodes []string, candidates []string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full || len(nodes) == 0 {
+		return nil
+	}
+	scores := make(map[string]int, len(nodes))
+	sorted := make([]int, 0, len(nodes))
+	for _, name := range nodes {
+		score := 0
+		if r, ok := l.records[name]; ok {
+			score = r.Score()
+		}
+		scores[name] = score
+		sorted = append(sorted, score)
+	}
+	sort.Ints(sorted)
+	median := sorted[len(sorted)/2]
+	if median <= 0 {
+		return nil
+	}
+
+	inactive := make([]string, 0)
+	for _, name := range candidates {
+		if score, ok := scores[name]; ok && !l.reported[name] && float64(score) < l.Threshold*float64(median) {
+			inactive = append(inactive, name)
+		}
+	}
+	sort.SliceStable(inactive, func(i, j int) bool { return scores[inactive[i]] < scores[inactive[j]] })
+	limit := min((len(nodes)-1)/3, len(nodes)-4)
+	if limit <= 0 {
+		return nil
+	}
+	if len(inactive) > limit {
+		inactive = inactive[:limit]
+	}
+	for _, name := range inactive {
+		l.reported[name] = true
+	}
+	return inactive
+}
+
+// Exit: record the committed exit of the node, which is admitted again after the cooldown
+// params:
+// - name:  the exited node
+// - epoch: the epoch started by the exit
+func (l *Log) Exit(name string, epoch int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exited[name] = epoch
+}
+
+// Admit: check whether the node applying to join is admitted, the node which never exited is admitted,
+// and the exited node is admitted after the cooldown
+// params:
+// - name:  the node applying to join
+// - epoch: the current epoch
+func (l *Log) Admit(name string, epoch int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	exited, ok := l.exited[name]
+	return !ok || epoch >= exited+l.Cooldown
+}
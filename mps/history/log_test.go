@@ -0,0 +1,59 @@
+package history_test
+
+import (
+	"history"
+	"mgmt"
+	"slices"
+	"testing"
+)
+
+// TestInactive: test the silent node and the node timing out are reported once the window is full, at most f of n nodes
+func TestInactive(t *testing.T) {
+	nodes := []string{"r_0", "r_1", "r_2", "r_3", "r_4"}
+	log := history.NewLog(40)
+	round := func(active []string) {
+		log.Record(active[0], mgmt.PART_PROPOSAL)
+		for _, name := range active {
+			log.Record(name, mgmt.PART_VOTE)
+		}
+	}
+
+	// r_4 is silent and r_3 times out in every view
+	for i := 0; i < 6; i++ {
+		round([]string{"r_0", "r_1", "r_2"})
+		log.Record("r_3", mgmt.PART_TIMEOUT)
+		log.Record("r_3", mgmt.PART_VOTE)
+	}
+	if inactive := log.Inactive(nodes, nodes); inactive != nil {
+		t.Fatal("the nodes are reported before the window is full", inactive)
+	}
+	for i := 0; i < 4; i++ {
+		round([]string{"r_0", "r_1", "r_2"})
+		log.Record("r_3", mgmt.PART_TIMEOUT)
+		log.Record("r_3", mgmt.PART_VOTE)
+	}
+	if r := log.Get("r_3"); r.Votes == 0 || r.Timeouts == 0 || r.Score() != 0 {
+		t.Fatal("the participation is not logged", r)
+	}
+
+	// one of 5 nodes is reported, and the reported node isn't reported again
+	if inactive := log.Inactive(nodes, nodes[1:]); !slices.Equal(inactive, []string{"r_3"}) && !slices.Equal(inactive, []string{"r_4"}) {
+		t.Fatal("the inactive node is not reported", inactive)
+	}
+	if inactive := log.Inactive(nodes, nodes[1:]); len(inactive) != 1 {
+		t.Fatal("the other inactive node is not reported", inactive)
+	}
+	if inactive := log.Inactive(nodes[:4], nodes[1:4]); inactive != nil {
+		t.Fatal("the node is reported from 4 nodes", inactive)
+	}
+
+	// the exited node is admitted again after the cooldown
+	log.Exit("r_4", 1)
+	if log.Admit("r_4", 2) || !log.Admit("r_4", 3) || !log.Admit("r_5", 1) {
+		t.Fatal("the admission doesn't follow the cooldown")
+	}
+	log.Reset()
+	if inactive := log.Inactive(nodes, nodes); inactive != nil || log.Get("r_0").Votes != 0 {
+		t.Fatal("the window is not reset")
+	}
+}
@@ -3,6 +3,7 @@ package mgmt
 import (
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
 )
@@ -14,6 +15,7 @@ type NodeManager struct {
 	NewNode NodeInfo        // the new node information
 	State   StateType       // the state of the join or exit process
 	Mode    NodeManagerMode // the mode of node manager, include INACTIVE/JOIN/EXIT
+	Epoch   Epoch           // the epoch of nodes changed by the committed join or exit
 
 	Logger       log.Logger             `json:"logger"`       // the logger
 	NodesTable   map[string]NodeKey     `json:"NodesTable"`   // the all known node PubKey table in system
@@ -103,3 +105,95 @@ func (nm *NodeManager) GetOtherNodeNames() []string {
 	}
 	return keys
 }
+
+// ApplyJoin: add the node to the nodes table by the committed join, and go to the next epoch from the height,
+// the key and the channel of the node are taken from its join message if it has applied
+// note: the change committed before the current epoch is replayed in recovery and skipped
+// params:
+// - name:   the name of the joined node
+// - height: the height of the first block ordered with the node
+// return:
+// - true if the nodes are changed
+func (nm *NodeManager) ApplyJoin(name string, height int) bool {
+	if _, ok := nm.NodesTable[name]; ok || height < nm.Epoch.Height {
+		return false
+	}
+	nk, ch := NodeKey{Name: name}, nm.NodesChannel[name]
+	if nm.NewNode.Name == name {
+		nk, ch = nm.NewNode.NodeKey, nm.NewNode.Chan
+		nk.Name = name
+		nm.ResetNodeManager()
+	}
+	table, channels := nm.copyTables()
+	table[name] = nk
+	channels[name] = ch
+	nm.NodesTable, nm.NodesChannel = table, channels
+	nm.nextEpoch(height)
+	return true
+}
+
+// ApplyExit: remove the node from the nodes table by the committed exit, and go to the next epoch from the height
+// note: the change committed before the current epoch is replayed in recovery and skipped
+// params:
+// - name:   the name of the exited node
+// - height: the height of the first block ordered without the node
+// return:
+// - true if the nodes are changed
+func (nm *NodeManager) ApplyExit(name string, height int) bool {
+	if _, ok := nm.NodesTable[name]; !ok || height < nm.Epoch.Height {
+		return false
+	}
+	table, channels := nm.copyTables()
+	delete(table, name)
+	delete(channels, name)
+	nm.NodesTable, nm.NodesChannel = table, channels
+	nm.nextEpoch(height)
+	return true
+}
+
+// nextEpoch: go to the next epoch of the nodes in the nodes table from the height
+func (nm *NodeManager) nextEpoch(height int) {
+	nodes := make([]string, 0, len(nm.NodesTable))
+	for name := range nm.NodesTable {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	nm.Epoch = Epoch{Number: nm.Epoch.Number + 1, Height: height, Nodes: nodes}
+	nm.Logger.Println("[EPOCH]:", nm.GetName(), "epoch", nm.Epoch.Number, "from height", height, "nodes", nodes)
+}
+
+// SetEpoch: set the epoch synced from the replicas, the nodes table keeps the nodes of the epoch
+// params:
+// - epoch: the synced epoch
+func (nm *NodeManager) SetEpoch(epoch Epoch) {
+	table, channels := nm.copyTables()
+	nodes := make(map[string]bool, len(epoch.Nodes))
+	for _, name := range epoch.Nodes {
+		nodes[name] = true
+		if _, ok := table[name]; !ok {
+			table[name] = NodeKey{Name: name}
+		}
+	}
+	for name := range table {
+		if !nodes[name] {
+			delete(table, name)
+			delete(channels, name)
+		}
+	}
+	nm.NodesTable, nm.NodesChannel = table, channels
+	nm.Epoch = epoch
+}
+
+// copyTables: copy the nodes table and the channels table to be changed, since the tables are read by the other routines
+// and the initial simulated nodes share the channels table
+func (nm *NodeManager) copyTables() (map[string]NodeKey, map[string]chan []byte) {
+	table := make(map[string]NodeKey, len(nm.NodesTable)+1)
+	for name, nk := range nm.NodesTable {
+		table[name] = nk
+	}
+	channels := make(map[string]chan []byte, len(nm.NodesChannel)+1)
+	for name, ch := range nm.NodesChannel {
+		channels[name] = ch
+	}
+	return table, channels
+}
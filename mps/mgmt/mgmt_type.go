@@ -2,9 +2,13 @@ package mgmt
 
 import (
 	"blockchain"
+	bstypes "bullshark/types"
 	"common"
+	fhstypes "fasthotstuff/types"
+	"fmt"
 	hstypes "hotstuff/types"
 	hs2types "hotstuff2/types"
+	"tss"
 )
 
 // node manager type
@@ -16,6 +20,16 @@ const (
 	BASED_HISTORY NodeManagerType = "basedhistory"
 )
 
+// Participation: the kind of the consensus message logged as the participation of its sender, see the basedhistory node manager
+type Participation uint8
+
+const (
+	PART_NONE     Participation = iota // the message which isn't logged, such as the new view of hotstuff sent in every view
+	PART_VOTE                          // the vote for a proposal
+	PART_PROPOSAL                      // the proposal of the leader, or the header proposed by every node of the DAG
+	PART_TIMEOUT                       // the message sent after the view times out
+)
+
 // NodeInfo: a node information applying to join or exit
 // NodeInfo contents:
 // Sm2Pubkey: used to encrypt and decrypt messages
@@ -29,6 +43,7 @@ type NodeKey struct {
 	Name      string
 	Sm2PubKey []byte
 	Sm4Key    []byte
+	DkgPubKey []byte // the public key of the long-term key of the distributed key generation, see tss.DKGKey
 }
 
 type StateType uint8
@@ -44,6 +59,9 @@ const (
 	NM_SYNC_FLAG
 	NM_AGREE
 	NM_RESTART
+	NM_DKG
+	NM_VOTE
+	NM_QUAL
 )
 
 func (st StateType) String() string {
@@ -68,11 +86,68 @@ func (st StateType) String() string {
 		return "NM_AGREE"
 	case 9:
 		return "NM_RESTART"
+	case 10:
+		return "NM_DKG"
+	case 11:
+		return "NM_VOTE"
+	case 12:
+		return "NM_QUAL"
 	default:
 		return ""
 	}
 }
 
+// Epoch: the epoch of nodes, which is changed by each committed join or exit,
+// so all replicas change the nodes at the same height
+type Epoch struct {
+	Number int      // the number of the committed changes of nodes
+	Height int      // the height of the first block ordered by the nodes of the epoch
+	Nodes  []string // the sorted names of the nodes
+}
+
+// SYNC_CHUNK_BLOCKS: the max number of blocks in a sync message, the blocks synced to the joined node are sent in chunks
+const SYNC_CHUNK_BLOCKS = 16
+
+// Rekey: the generation of the threshold signers of an epoch by the nodes, the shares of the nodes of the last epoch
+// are reshared to the nodes of the epoch, or a new group key is generated by the nodes of the epoch if there are no dealers
+type Rekey struct {
+	Epoch   int      // the number of the epoch whose signers are generated
+	Dealers []string // the nodes of the last epoch in order of the index of their shares, empty for a fresh generation
+	Commits [][]byte // the commitments of the shared public polynomial of the dealers, see tss.Signer.Commits
+}
+
+// Vote: the vote of a node of the epoch for the admission or the exit decided by its own history, the change is committed
+// only with the votes of a quorum of the nodes of the epoch, so a single node can't admit or evict nodes
+type Vote struct {
+	Op    string // the reconfiguration, "admit" or "exit"
+	Node  string // the node admitted or evicted
+	Epoch int    // the number of the epoch which the vote is cast in
+	Voter string // the node casting the vote
+	Sign  []byte // the SM2 signature of the voter on the bytes of SignedBytes
+}
+
+// SignedBytes: get the bytes signed by the voter, that is, the reconfiguration, the node, the epoch and the voter
+func (v *Vote) SignedBytes() []byte {
+	return []byte(fmt.Sprintf("vote %s %s %d %s", v.Op, v.Node, v.Epoch, v.Voter))
+}
+
+// Qual: the qualified dealers of the generation of the signers reported or voted by a node of the epoch, the nodes may certify
+// different deals by the responses recieved before the timeout, so the signers are generated from the dealers voted by a quorum
+// of the nodes, and each node votes for one set of dealers only
+type Qual struct {
+	Epoch   int    // the number of the epoch whose signers are generated
+	Round   int    // the round of the agreement, whose proposer is the node at the index of the round in the nodes of the epoch
+	Dealers []int  // the indexes of the qualified dealers in order
+	Vote    bool   // whether the node votes for the dealers, otherwise it reports the dealers whose deals it certified
+	Node    string // the node reporting or voting
+	Sign    []byte // the SM2 signature of the node on the bytes of SignedBytes
+}
+
+// SignedBytes: get the bytes signed by the node, that is, the epoch, the round, the dealers, whether it is a vote and the node
+func (q *Qual) SignedBytes() []byte {
+	return []byte(fmt.Sprintf("qual %d %d %v %t %s", q.Epoch, q.Round, q.Dealers, q.Vote, q.Node))
+}
+
 // NodeManagerMode: the mode indicates whether a node wants to join or exit
 type NodeManagerMode uint8
 
@@ -91,11 +166,22 @@ type NodeMgmtMsg struct {
 	Justify    hstypes.QC      // qurom certificate
 	H2Justify  hs2types.QuromCert
 	CJustify   hstypes.ChainedQC
+	FJustify   fhstypes.QC
+	BSync      bstypes.SyncState // the DAG state of bullshark
+	Epoch      Epoch             // the epoch of nodes which the sync message is sent in
+	Rekey      Rekey             // the generation of the signers of the epoch, which the joined node takes part in
+	DKG        tss.DKGMsg        // the message of the generation of the signers
+	Vote       Vote              // the vote for the admission or the exit of a node
+	Qual       Qual              // the report or the vote of the qualified dealers of the generation of the signers
+	DKGs       []tss.DKGMsg      // the responses of the proposed dealers, so the nodes which missed some of them certify the deals as well
 	// Justify    interface{}      // qurom certificate
 	NodeKey  NodeKey
-	Sign     []byte             // signature
-	Block    []blockchain.Block // the proposed block in the view
-	SendNode string             // the message send node
-	ReciNode string             // the message recieve node
+	Sign     []byte              // signature
+	Block    []blockchain.Block  // the proposed block in the view
+	Snapshot blockchain.Snapshot // the replicated state synced by the joined node, which is sent in the first chunk of the sync message
+	Chunk    int                 // the index of the chunk of the sync message, see SYNC_CHUNK_BLOCKS
+	Chunks   int                 // the number of chunks of the sync message
+	SendNode string              // the message send node
+	ReciNode string              // the message recieve node
 	// Proposal   Proposal            // the new proposal
 }
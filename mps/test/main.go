@@ -43,6 +43,10 @@ func main() {
 		test.Start(node, path, common.HOTSTUFF_PROTOCOL_CHAINED, mgmt.BASIC)
 	case "h2":
 		test.Start(node, path, common.HOTSTUFF_2_PROTOCOL, mgmt.BASIC)
+	case "fh":
+		test.Start(node, path, common.FAST_HOTSTUFF_PROTOCOL, mgmt.BASIC)
+	case "bs":
+		test.Start(node, path, common.BULLSHARK, mgmt.BASIC)
 	case "pbft":
 		test.Start(node, path, common.PBFT, mgmt.BASIC)
 	default:
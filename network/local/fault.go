@@ -0,0 +1,207 @@
+package local
+
+import (
+	"message"
+	"sync"
+)
+
+// Behaviour: the byzantine behaviour injected to the messages of a faulty node
+type Behaviour uint8
+
+const (
+	SILENT     Behaviour = iota // drop all messages sent and recieved by the node, as it crashes
+	WITHHOLD                    // drop the votes of the node, which are the unicast messages unless Fault.IsVote is given
+	EQUIVOCATE                  // send the conflicting message made by Fault.Equivocate to the second half of the receivers
+	REPLAY                      // send a stale message again after each message, such as the old QC
+	FORGE                       // corrupt the signature of each message by Fault.Forge
+)
+
+// STALE_WINDOW: the number of the earliest messages kept to replay
+const STALE_WINDOW = 64
+
+// String: get the name of the behaviour
+func (b Behaviour) String() string {
+	switch b {
+	case SILENT:
+		return "silent"
+	case WITHHOLD:
+		return "withhold"
+	case EQUIVOCATE:
+		return "equivocate"
+	case REPLAY:
+		return "replay"
+	case FORGE:
+		return "forge"
+	}
+	return "unknown"
+}
+
+// Tamper: change the payload of a consensus message, it returns false if the message is not changed,
+// such as the message carries no proposal to equivocate
+type Tamper func(payload []byte) ([]byte, bool)
+
+// Fault: the byzantine behaviours of a node, which wraps the channels of the node as a faulty link,
+// the payloads are decoded by the protocol only in the given functions
+type Fault struct {
+	Behaviours []Behaviour
+	Nodes      []string                  // the names of all nodes, the broadcast is split into the unicasts to them by EQUIVOCATE
+	Equivocate Tamper                    // make the conflicting message of the proposal
+	Forge      Tamper                    // corrupt the signature of the message
+	IsVote     func(payload []byte) bool // check whether the message is a vote withheld by WITHHOLD
+
+	mu       sync.Mutex
+	stale    []message.ServerMsg // the earliest messages sent by the node
+	replay   int                 // the index of the next stale message to replay
+	injected int                 // the number of messages dropped, changed or replayed by the behaviours
+}
+
+// NewFault: create the fault of a node
+// params:
+// - nodes: the names of all nodes
+// - behaviours: the byzantine behaviours, the functions they need are set on the fault
+func NewFault(nodes []string, behaviours ...Behaviour) *Fault {
+	return &Fault{Behaviours: behaviours, Nodes: nodes}
+}
+
+// Has: check whether the fault injects the behaviour
+func (f *Fault) Has(b Behaviour) bool {
+	for _, behaviour := range f.Behaviours {
+		if behaviour == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Injected: get the number of messages dropped, changed or replayed by the behaviours, so that the fault is known to be injected
+func (f *Fault) Injected() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected
+}
+
+// count: count the messages affected by the behaviours
+func (f *Fault) count(n int) {
+	f.mu.Lock()
+	f.injected += n
+	f.mu.Unlock()
+}
+
+// Inject: apply the behaviours to a message sent by the faulty node
+// params:
+// - msg: the message sent by the consensus of the node
+// return:
+// - the messages actually sent, the equivocated broadcast is split into the unicasts
+func (f *Fault) Inject(msg message.ServerMsg) []message.ServerMsg {
+	if f.Has(SILENT) {
+		f.count(1)
+		return nil
+	}
+	if f.Has(WITHHOLD) && f.isVote(msg) {
+		f.count(1)
+		return nil
+	}
+	if f.Has(FORGE) && f.Forge != nil {
+		if payload, ok := f.Forge(msg.Payload); ok {
+			msg.Payload = payload
+			f.count(1)
+		}
+	}
+
+	msgs := []message.ServerMsg{msg}
+	if f.Has(EQUIVOCATE) && f.Equivocate != nil && (msg.ReciServer == "Broadcast" || msg.ReciServer == "Gossip") {
+		if payload, ok := f.Equivocate(msg.Payload); ok {
+			msgs = msgs[:0]
+			for i, name := range f.Nodes {
+				if msg.ReciServer == "Gossip" && name == msg.SendServer {
+					continue
+				}
+				split := msg
+				split.ReciServer = name
+				if i >= len(f.Nodes)/2 {
+					split.Payload = payload
+				}
+				msgs = append(msgs, split)
+			}
+			f.count(1)
+		}
+	}
+
+	if f.Has(REPLAY) {
+		f.mu.Lock()
+		if len(f.stale) < STALE_WINDOW {
+			f.stale = append(f.stale, msg)
+		}
+		msgs = append(msgs, f.stale[f.replay%len(f.stale)])
+		f.replay++
+		f.injected++
+		f.mu.Unlock()
+	}
+	return msgs
+}
+
+// isVote: the unicast messages are the votes to the leader if the protocol doesn't decide them
+func (f *Fault) isVote(msg message.ServerMsg) bool {
+	if f.IsVote != nil {
+		return f.IsVote(msg.Payload)
+	}
+	return msg.ReciServer != "Broadcast" && msg.ReciServer != "Gossip"
+}
+
+// WrapSend: relay the messages sent by the consensus to the returned channel after the behaviours are applied,
+// the returned channel takes the place of SendChan for the server, until quit is closed
+// params:
+// - sendChan: the channel the consensus sends to
+// - quit:     the channel closed to stop relaying
+// return:
+// - the channel of the messages actually sent
+func (f *Fault) WrapSend(sendChan chan message.ServerMsg, quit chan struct{}) chan message.ServerMsg {
+	out := make(chan message.ServerMsg, cap(sendChan))
+	go func() {
+		for {
+			select {
+			case msg := <-sendChan:
+				for _, injected := range f.Inject(msg) {
+					select {
+					case out <- injected:
+					case <-quit:
+						return
+					}
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// WrapRecv: relay the messages recieved by the node from the returned channel to its channel,
+// the silent node drops them, until quit is closed
+// params:
+// - nodeChan: the channel the node reads
+// - quit:     the channel closed to stop relaying
+// return:
+// - the channel the other nodes send to, which takes the place of nodeChan in the channels table
+func (f *Fault) WrapRecv(nodeChan chan []byte, quit chan struct{}) chan []byte {
+	in := make(chan []byte, cap(nodeChan))
+	go func() {
+		for {
+			select {
+			case msg := <-in:
+				if f.Has(SILENT) {
+					f.count(1)
+					continue
+				}
+				select {
+				case nodeChan <- msg:
+				case <-quit:
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return in
+}
@@ -0,0 +1,410 @@
+package local
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// VirtualClock: the clock of the simulated network, the events run one by one in order of their virtual time,
+// and the time never passes while an event is running, so a run is decided by the seed instead of the scheduler
+type VirtualClock struct {
+	mu     sync.Mutex
+	now    time.Duration // the virtual time since the start
+	seq    uint64        // the sequence of the scheduled events, which orders the events at the same time
+	events eventQueue
+}
+
+// event: the function run by the virtual clock at its time
+type event struct {
+	at        time.Duration
+	seq       uint64
+	f         func()
+	cancelled bool
+	done      bool
+}
+
+// eventQueue: the min-heap of events by time and sequence
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// NewVirtualClock: create a virtual clock at time 0
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{}
+}
+
+// Now: get the virtual time since the start
+func (c *VirtualClock) Now() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc: schedule f after the duration of virtual time, it implements the clock of the consensus timers
+// params:
+// - d: the duration, the negative one is taken as 0
+// - f: the function
+// return:
+// - the function which cancels f, it returns false if f has been run or cancelled
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) func() bool {
+	if d < 0 {
+		d = 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	e := &event{at: c.now + d, seq: c.seq, f: f}
+	heap.Push(&c.events, e)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if e.done || e.cancelled {
+			return false
+		}
+		e.cancelled = true
+		return true
+	}
+}
+
+// Step: run the next event, the time moves to it
+// params:
+// - until: the events after this time are not run
+// return:
+// - false if there is no event before the time
+func (c *VirtualClock) Step(until time.Duration) bool {
+	c.mu.Lock()
+	for c.events.Len() > 0 && c.events[0].cancelled {
+		heap.Pop(&c.events)
+	}
+	if c.events.Len() == 0 || c.events[0].at > until {
+		c.mu.Unlock()
+		return false
+	}
+	e := heap.Pop(&c.events).(*event)
+	c.now = e.at
+	e.done = true
+	c.mu.Unlock()
+
+	e.f()
+	return true
+}
+
+// RunUntil: run the events in order until the time, and then the time moves to it
+// params:
+// - until: the virtual time to stop
+// - after: the function run after each event, such as the messages sent by the event are routed by it, it can be nil
+func (c *VirtualClock) RunUntil(until time.Duration, after func()) {
+	for c.Step(until) {
+		if after != nil {
+			after()
+		}
+	}
+	c.mu.Lock()
+	if c.now < until {
+		c.now = until
+	}
+	c.mu.Unlock()
+}
+
+// Latency: the distribution of the latency of a link
+type Latency interface {
+	// Sample: get a latency by the random source of the network
+	Sample(r *rand.Rand) time.Duration
+}
+
+// ConstLatency: the fixed latency
+type ConstLatency time.Duration
+
+// Sample: get the fixed latency
+func (l ConstLatency) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(l)
+}
+
+// UniformLatency: the latency uniformly distributed in [Min, Max]
+type UniformLatency struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Sample: get a latency in [Min, Max]
+func (l UniformLatency) Sample(r *rand.Rand) time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + time.Duration(r.Int63n(int64(l.Max-l.Min)+1))
+}
+
+// NormalLatency: the latency normally distributed, which is truncated at 0
+type NormalLatency struct {
+	Mean   time.Duration
+	StdDev time.Duration
+}
+
+// Sample: get a latency around the mean
+func (l NormalLatency) Sample(r *rand.Rand) time.Duration {
+	d := l.Mean + time.Duration(r.NormFloat64()*float64(l.StdDev))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// LinkConfig: the model of the directed link between two nodes
+type LinkConfig struct {
+	Latency   Latency // the latency distribution, no latency if it is nil
+	Bandwidth int64   // the bytes per second, the messages are transmitted one by one on the link, unlimited if it is 0
+	Loss      float64 // the probability that the message is lost
+	Duplicate float64 // the probability that the message is delivered twice
+	Reorder   float64 // the probability that the message is delayed by another latency, so that the later ones overtake it
+	Ordered   bool    // whether the messages arrive in the order they are sent as over TCP, a message never overtakes the former ones
+}
+
+// SimStats: the counters of the simulated network
+type SimStats struct {
+	Sent        uint64 // the messages sent to each receiver
+	Delivered   uint64 // the messages delivered, including the duplicated ones
+	Lost        uint64 // the messages lost by the link
+	Duplicated  uint64 // the messages duplicated by the link
+	Reordered   uint64 // the messages delayed to be overtaken
+	Partitioned uint64 // the messages dropped by the partitions, when they are sent or arrive
+}
+
+// link: the directed link between two nodes
+type link struct {
+	from string
+	to   string
+}
+
+// SimNetwork: the simulated network between the nodes driven by a virtual clock, the latency, bandwidth, loss,
+// reordering, duplication and partitions of each message are decided by the seeded random source,
+// so the same messages sent in the same order are delivered at the same virtual time on every run.
+// It sends as the transport, and the messages are handed to the deliver function by the events of the clock
+type SimNetwork struct {
+	Clock *VirtualClock
+
+	mu          sync.Mutex
+	rand        *rand.Rand
+	nodes       []string
+	deliver     func(reciName string, msg []byte)
+	defaultLink LinkConfig
+	links       map[link]LinkConfig
+	busy        map[link]time.Duration // the virtual time when the link finishes transmitting its messages
+	arrival     map[link]time.Duration // the virtual time when the last message on the link arrives
+	groups      map[string]int         // the group of each node in the partition, nil if the network is connected
+	stats       SimStats
+}
+
+// NewSimNetwork: create a simulated network, whose links have no latency and never lose messages by default
+// params:
+// - seed:    the seed of the random source
+// - nodes:   the names of all nodes
+// - deliver: the function which hands the message to the receiver, it runs in the events of the clock
+func NewSimNetwork(seed int64, nodes []string, deliver func(reciName string, msg []byte)) *SimNetwork {
+	return &SimNetwork{
+		Clock:   NewVirtualClock(),
+		rand:    rand.New(rand.NewSource(seed)),
+		nodes:   append([]string(nil), nodes...),
+		deliver: deliver,
+		links:   make(map[link]LinkConfig),
+		busy:    make(map[link]time.Duration),
+		arrival: make(map[link]time.Duration),
+	}
+}
+
+// SetDefaultLink: set the model of the links which are not set by SetLink
+func (sn *SimNetwork) SetDefaultLink(config LinkConfig) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.defaultLink = config
+}
+
+// SetLink: set the model of the directed link
+// params:
+// - from:   the sending node
+// - to:     the receiving node
+// - config: the model of the link
+func (sn *SimNetwork) SetLink(from string, to string, config LinkConfig) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.links[link{from, to}] = config
+}
+
+// Partition: split the nodes into the groups at the virtual time, and heal the network after the duration,
+// the nodes in different groups can't reach each other, the nodes not in any group are in one more group
+// params:
+// - at:       the virtual time when the partition starts
+// - duration: the duration of the partition, it is never healed if it is not positive
+// - groups:   the names of the nodes in each group
+func (sn *SimNetwork) Partition(at time.Duration, duration time.Duration, groups ...[]string) {
+	split := make(map[string]int)
+	for _, name := range sn.nodes {
+		split[name] = len(groups)
+	}
+	for i, group := range groups {
+		for _, name := range group {
+			split[name] = i
+		}
+	}
+	now := sn.Clock.Now()
+	sn.Clock.AfterFunc(at-now, func() {
+		sn.mu.Lock()
+		sn.groups = split
+		sn.mu.Unlock()
+	})
+	if duration > 0 {
+		sn.Clock.AfterFunc(at+duration-now, sn.Heal)
+	}
+}
+
+// Heal: connect all nodes at once
+func (sn *SimNetwork) Heal() {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.groups = nil
+}
+
+// Stats: get the snapshot of the counters
+func (sn *SimNetwork) Stats() SimStats {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	return sn.stats
+}
+
+// Broadcast: send message to all nodes include itself
+func (sn *SimNetwork) Broadcast(msg []byte, sendName string) {
+	for _, name := range sn.nodes {
+		sn.send(msg, name, sendName)
+	}
+}
+
+// Gossip: send message to all nodes except the sender
+func (sn *SimNetwork) Gossip(msg []byte, sendName string) {
+	for _, name := range sn.nodes {
+		if name != sendName {
+			sn.send(msg, name, sendName)
+		}
+	}
+}
+
+// Unicast: send message to the node named reciName, the message to an unknown node is dropped
+func (sn *SimNetwork) Unicast(msg []byte, reciName string, sendName string) {
+	for _, name := range sn.nodes {
+		if name == reciName {
+			sn.send(msg, reciName, sendName)
+			return
+		}
+	}
+}
+
+// Close: nothing to release for the simulated network
+func (sn *SimNetwork) Close() error {
+	return nil
+}
+
+// connected: check whether the nodes are in the same group, the caller holds the lock
+func (sn *SimNetwork) connected(from string, to string) bool {
+	return sn.groups == nil || sn.groups[from] == sn.groups[to]
+}
+
+// send: schedule the delivery of the message on the link, a node sends to itself at once without loss
+func (sn *SimNetwork) send(msg []byte, reciName string, sendName string) {
+	payload := make([]byte, len(msg))
+	copy(payload, msg)
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.stats.Sent++
+	if reciName == sendName {
+		sn.schedule(0, payload, reciName, sendName)
+		return
+	}
+	if !sn.connected(sendName, reciName) {
+		sn.stats.Partitioned++
+		return
+	}
+
+	l := link{sendName, reciName}
+	config, ok := sn.links[l]
+	if !ok {
+		config = sn.defaultLink
+	}
+	// the random source is drawn the same times for each message, so a changed probability keeps the other decisions
+	lost := sn.rand.Float64() < config.Loss
+	duplicated := sn.rand.Float64() < config.Duplicate
+	reordered := sn.rand.Float64() < config.Reorder
+	latencies := [3]time.Duration{}
+	if config.Latency != nil {
+		for i := range latencies {
+			latencies[i] = config.Latency.Sample(sn.rand)
+		}
+	}
+	if lost {
+		sn.stats.Lost++
+		return
+	}
+
+	// the message departs after the former ones are transmitted on the link
+	now := sn.Clock.Now()
+	depart := now
+	if sn.busy[l] > depart {
+		depart = sn.busy[l]
+	}
+	if config.Bandwidth > 0 {
+		depart += time.Duration(int64(len(payload)) * int64(time.Second) / config.Bandwidth)
+		sn.busy[l] = depart
+	}
+	delay := depart - now + latencies[0]
+	if reordered {
+		sn.stats.Reordered++
+		delay += latencies[1]
+	}
+	delay = sn.order(l, config, now, delay)
+	sn.schedule(delay, payload, reciName, sendName)
+	if duplicated {
+		sn.stats.Duplicated++
+		sn.schedule(sn.order(l, config, now, depart-now+latencies[2]), payload, reciName, sendName)
+	}
+}
+
+// order: extend the delay of the message on the ordered link so that it arrives after the former ones, the caller holds the lock
+func (sn *SimNetwork) order(l link, config LinkConfig, now time.Duration, delay time.Duration) time.Duration {
+	if !config.Ordered {
+		return delay
+	}
+	if last := sn.arrival[l]; now+delay < last {
+		delay = last - now
+	}
+	sn.arrival[l] = now + delay
+	return delay
+}
+
+// schedule: deliver the message after the delay unless the link is partitioned when it arrives, the caller holds the lock
+func (sn *SimNetwork) schedule(delay time.Duration, payload []byte, reciName string, sendName string) {
+	sn.Clock.AfterFunc(delay, func() {
+		sn.mu.Lock()
+		if !sn.connected(sendName, reciName) {
+			sn.stats.Partitioned++
+			sn.mu.Unlock()
+			return
+		}
+		sn.stats.Delivered++
+		sn.mu.Unlock()
+		sn.deliver(reciName, payload)
+	})
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"local"
+	"sync"
+)
+
+// ChanTransport: the transport by the in-process channels, which is used to simulate the system in one process
+type ChanTransport struct {
+	NodesChannel map[string]chan []byte // the channels of all nodes, shared with the node manager
+	lock         sync.RWMutex
+}
+
+// NewChanTransport: create a transport by the channels table
+// params:
+// - nodesChannel: the channels table of all nodes, which is replaced by SetNodes after the nodes join or exit
+func NewChanTransport(nodesChannel map[string]chan []byte) *ChanTransport {
+	return &ChanTransport{NodesChannel: nodesChannel}
+}
+
+// SetNodes: replace the channels table, such as the one changed by the committed join or exit of node
+// params:
+// - nodesChannel: the channels table of all nodes
+func (ct *ChanTransport) SetNodes(nodesChannel map[string]chan []byte) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	ct.NodesChannel = nodesChannel
+}
+
+// nodes: get the channels table
+func (ct *ChanTransport) nodes() map[string]chan []byte {
+	ct.lock.RLock()
+	defer ct.lock.RUnlock()
+	return ct.NodesChannel
+}
+
+// Broadcast: send message to all nodes include itself
+func (ct *ChanTransport) Broadcast(msg []byte, sendName string) {
+	local.Broadcast(ct.nodes(), msg, sendName)
+}
+
+// Gossip: send message to all nodes except the sender
+func (ct *ChanTransport) Gossip(msg []byte, sendName string) {
+	local.Gossip(ct.nodes(), msg, sendName)
+}
+
+// Unicast: send message to the node named reciName, the message to the node not in the table is dropped,
+// such as the reply to the node which has exited
+func (ct *ChanTransport) Unicast(msg []byte, reciName string, sendName string) {
+	nodes := ct.nodes()
+	if _, ok := nodes[reciName]; !ok {
+		return
+	}
+	local.Unicast(nodes, msg, reciName, sendName)
+}
+
+// Close: nothing to release for channels
+func (ct *ChanTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,3 @@
+module transport
+
+go 1.21.5
@@ -0,0 +1,487 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"wire"
+)
+
+// the default options of TCP transport
+const (
+	QueueSize        = 1024                  // the max number of messages waiting to be sent to a peer
+	MaxFrameSize     = 64 << 20              // the max bytes of a frame
+	DialTimeout      = 2 * time.Second       // the timeout of connecting to a peer
+	HandshakeTimeout = 2 * time.Second       // the timeout of the TLS handshake on both sides, so a peer which never completes it can't hold the connection
+	MinBackoff       = 50 * time.Millisecond // the first wait before reconnecting
+	MaxBackoff       = 2 * time.Second       // the max wait before reconnecting
+	WriteTimeout     = 5 * time.Second       // the timeout of writing a frame
+	frameHdrSize     = 4                     // the bytes of the length prefix
+)
+
+// the codec negotiation of TCP transport
+const (
+	HelloTimeout = 500 * time.Millisecond // the wait for the hello reply, the peer which doesn't reply is a JSON-only peer
+	HelloMagic   = "DCSW"                 // the prefix of the hello frame, which never starts a JSON or binary message
+)
+
+// ErrFrameTooLarge: the length prefix exceeds MaxFrameSize
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// TCPTransport: the transport by persistent TCP connections,
+// every peer has a send queue and a goroutine which connects to it and reconnects with backoff when the connection breaks
+// the codec of each connection is negotiated by the hello frames when it is built:
+// - the dialer sends the hello frame with its wire version and preferred codec, and the acceptor replies with its own
+// - the acceptor which replies with the same wire version decodes either codec, so the connection is binary
+// - the acceptor which doesn't know the hello frame never replies, so the dialer treats it as a JSON-only peer after HelloTimeout
+// the messages are written as they are, except the binary messages to a JSON-only peer, which are encoded by JSON again by Transcode,
+// since the signature covers the payload encoded by the signer, only the signer can re-encode its message,
+// and they are refused if Transcode is not set
+// the connections are plain TCP unless the TLS config is given, see NewTLSTransport
+type TCPTransport struct {
+	Name  string      // the name of the node itself
+	Addr  string      // the listening address of the node itself
+	Codec wire.Codec  // the preferred codec of the connections
+	TLS   *tls.Config // the TLS config of the connections, nil for plain TCP
+
+	// Transcode: encode the binary message by JSON again for the JSON-only peers, it is called by the goroutines of the peers,
+	// and it must be set before the messages are sent
+	Transcode func(msg []byte) ([]byte, error)
+
+	mu    sync.Mutex
+	peers map[string]*tcpPeer // the peers except itself
+	conns map[net.Conn]bool   // the accepted connections
+	inbox chan []byte         // the channel to deliver the recieved messages
+	ln    net.Listener        // the listener of the node itself
+	done  chan struct{}       // closed when the transport is closed
+	wg    sync.WaitGroup      // the goroutines of the transport
+	once  sync.Once           // close only once
+
+	Logger log.Logger `json:"logger"`
+}
+
+// tcpPeer: the send queue of a peer
+type tcpPeer struct {
+	name  string
+	addr  string
+	queue chan []byte
+}
+
+// NewTCPTransport: listen on the address of the node and create the send queues of peers
+// params:
+// - name: the name of the node itself
+// - peers: the addresses of all nodes, the address of the node itself is listened
+// - inbox: the channel to deliver the recieved messages, usually the address channel of the server
+// - codec: the preferred codec of the connections
+// return:
+// - the transport and error
+func NewTCPTransport(name string, peers map[string]string, inbox chan []byte, codec wire.Codec) (*TCPTransport, error) {
+	return NewTLSTransport(name, peers, inbox, codec, nil)
+}
+
+// NewTLSTransport: create the transport whose connections are secured by TLS,
+// the config is usually loaded by LoadTLSConfig, so the peers authenticate each other by the certificates signed by the cluster CA
+// params:
+// - name: the name of the node itself
+// - peers: the addresses of all nodes, the address of the node itself is listened
+// - inbox: the channel to deliver the recieved messages, usually the address channel of the server
+// - codec: the preferred codec of the connections
+// - conf: the TLS config, the connections are plain TCP if it is nil
+// return:
+// - the transport and error
+func NewTLSTransport(name string, peers map[string]string, inbox chan []byte, codec wire.Codec, conf *tls.Config) (*TCPTransport, error) {
+	addr, ok := peers[name]
+	if !ok {
+		return nil, fmt.Errorf("no address of %s", name)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if conf != nil {
+		ln = tls.NewListener(ln, conf)
+	}
+
+	t := &TCPTransport{
+		Name:   name,
+		Addr:   ln.Addr().String(),
+		Codec:  codec,
+		TLS:    conf,
+		peers:  make(map[string]*tcpPeer),
+		conns:  make(map[net.Conn]bool),
+		inbox:  inbox,
+		ln:     ln,
+		done:   make(chan struct{}),
+		Logger: *log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lmicroseconds),
+	}
+	for peerName, peerAddr := range peers {
+		if peerName != name {
+			t.AddPeer(peerName, peerAddr)
+		}
+	}
+
+	t.wg.Add(1)
+	go t.accept()
+	return t, nil
+}
+
+// AddPeer: add a peer and start to send messages to it, the existing peer is kept
+// params:
+// - name: the name of the peer
+// - addr: the address of the peer
+func (t *TCPTransport) AddPeer(name string, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.peers[name]; ok {
+		return
+	}
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	p := &tcpPeer{name: name, addr: addr, queue: make(chan []byte, QueueSize)}
+	t.peers[name] = p
+	t.wg.Add(1)
+	go t.send(p)
+}
+
+// Broadcast: send message to all nodes include itself
+func (t *TCPTransport) Broadcast(msg []byte, sendName string) {
+	t.deliver(msg)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.peers {
+		t.enqueue(p, msg)
+	}
+}
+
+// Gossip: send message to all nodes except the sender
+func (t *TCPTransport) Gossip(msg []byte, sendName string) {
+	if sendName != t.Name {
+		t.deliver(msg)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, p := range t.peers {
+		if name == sendName {
+			continue
+		}
+		t.enqueue(p, msg)
+	}
+}
+
+// Unicast: send message to the node named reciName
+func (t *TCPTransport) Unicast(msg []byte, reciName string, sendName string) {
+	if reciName == t.Name {
+		t.deliver(msg)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.peers[reciName]
+	if !ok {
+		t.Logger.Println("[TCP]:", t.Name, "unknown peer", reciName)
+		return
+	}
+	t.enqueue(p, msg)
+}
+
+// Close: stop listening, close all connections and wait for the goroutines exit
+// the messages still in the send queues are dropped
+func (t *TCPTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		t.mu.Lock()
+		close(t.done)
+		t.mu.Unlock()
+		err = t.ln.Close()
+		t.mu.Lock()
+		for conn := range t.conns {
+			conn.Close()
+		}
+		t.mu.Unlock()
+		t.wg.Wait()
+	})
+	return err
+}
+
+// deliver: deliver a copy of message to the node itself
+func (t *TCPTransport) deliver(msg []byte) {
+	msgCopied := make([]byte, len(msg))
+	copy(msgCopied, msg)
+	select {
+	case t.inbox <- msgCopied:
+	case <-t.done:
+	}
+}
+
+// enqueue: put message into the send queue of peer, the message is dropped if the queue is full,
+// so a crashed peer never blocks the node
+func (t *TCPTransport) enqueue(p *tcpPeer, msg []byte) {
+	select {
+	case p.queue <- msg:
+	default:
+		t.Logger.Println("[TCP]:", t.Name, "send queue of", p.name, "is full, drop message")
+	}
+}
+
+// send: connect to the peer and write the messages in queue,
+// the connection is rebuilt with exponential backoff and the failed message is sent again after reconnecting
+func (t *TCPTransport) send(p *tcpPeer) {
+	defer t.wg.Done()
+
+	var conn net.Conn
+	var codec wire.Codec
+	var pending []byte
+	var refused bool
+	backoff := MinBackoff
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		if pending == nil {
+			select {
+			case pending = <-p.queue:
+			case <-t.done:
+				return
+			}
+		}
+
+		if conn == nil {
+			// the peer which refuses the handshake or the hello frame is retried with backoff like the peer which is down
+			c, err := t.dial(p)
+			if err == nil {
+				if codec, err = t.hello(c); err != nil {
+					t.Logger.Println("[TCP]:", t.Name, "hello to", p.name, "error", err)
+					c.Close()
+				}
+			}
+			if err != nil {
+				select {
+				case <-time.After(backoff):
+				case <-t.done:
+					return
+				}
+				backoff *= 2
+				if backoff > MaxBackoff {
+					backoff = MaxBackoff
+				}
+				continue
+			}
+			conn = c
+			backoff = MinBackoff
+			refused = false
+		}
+
+		// the JSON-only peer can't read the binary message, so it is sent the message encoded by JSON again,
+		// or the message is refused if it can't be transcoded, which is warned once per connection
+		if codec != wire.BINARY && wire.IsBinary(pending) {
+			var err error
+			if t.Transcode == nil {
+				err = errors.New("no transcoder, set the codec to json to work with it")
+			} else {
+				var msg []byte
+				if msg, err = t.Transcode(pending); err == nil {
+					pending = msg
+				}
+			}
+			if err != nil {
+				if !refused {
+					t.Logger.Println("[TCP]:", t.Name, "refuse the binary messages to the JSON-only peer", p.name, "error", err)
+					refused = true
+				}
+				pending = nil
+				continue
+			}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+		if err := WriteFrame(conn, pending); err != nil {
+			t.Logger.Println("[TCP]:", t.Name, "write to", p.name, "error", err)
+			conn.Close()
+			conn = nil
+			continue
+		}
+		pending = nil
+	}
+}
+
+// dial: connect to the peer, the certificate of the peer must be issued to its name if TLS is used
+func (t *TCPTransport) dial(p *tcpPeer) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", p.addr, DialTimeout)
+	if err != nil || t.TLS == nil {
+		return conn, err
+	}
+	conf := t.TLS.Clone()
+	conf.ServerName = p.name
+	tlsConn := tls.Client(conn, conf)
+	tlsConn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		t.Logger.Println("[TCP]:", t.Name, "TLS handshake with", p.name, "error", err)
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// accept: accept the connections from peers
+func (t *TCPTransport) accept() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+			t.Logger.Println("[TCP]:", t.Name, "accept error", err)
+			continue
+		}
+
+		// the connection accepted while closing is not tracked by Close
+		t.mu.Lock()
+		select {
+		case <-t.done:
+			t.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		t.conns[conn] = true
+		t.mu.Unlock()
+		t.wg.Add(1)
+		go t.recieve(conn)
+	}
+}
+
+// recieve: read the frames from a connection and deliver them until the connection breaks
+func (t *TCPTransport) recieve(conn net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		conn.Close()
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+	}()
+
+	// the TLS handshake of the accepted connection is done here under the deadline instead of by the first read,
+	// which would wait forever for the peer which connects and never sends the handshake
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(HandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			t.Logger.Println("[TCP]:", t.Name, "TLS handshake from", conn.RemoteAddr(), "error", err)
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+	}
+
+	reader := bufio.NewReader(conn)
+	for first := true; ; first = false {
+		msg, err := ReadFrame(reader)
+		if err != nil {
+			return
+		}
+
+		// reply the hello frame of the dialer, the connection from the old node has no hello frame
+		if first {
+			if _, _, ok := parseHello(msg); ok {
+				conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+				if err := WriteFrame(conn, helloFrame(t.Codec)); err != nil {
+					return
+				}
+				continue
+			}
+		}
+		select {
+		case t.inbox <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// hello: send the hello frame to the connected peer and negotiate the codec by its reply
+// params:
+// - conn: the connection dialed to the peer
+// return:
+// - the codec of the connection, binary if the peer replies with the same wire version, otherwise JSON, and error
+func (t *TCPTransport) hello(conn net.Conn) (wire.Codec, error) {
+	conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	if err := WriteFrame(conn, helloFrame(t.Codec)); err != nil {
+		return "", err
+	}
+	conn.SetReadDeadline(time.Now().Add(HelloTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	reply, err := ReadFrame(conn)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return wire.JSON, nil
+		}
+		return "", err
+	}
+	if version, _, ok := parseHello(reply); !ok || version != wire.VERSION {
+		return wire.JSON, nil
+	}
+	return wire.BINARY, nil
+}
+
+// helloFrame: the hello frame with the wire version and the preferred codec
+func helloFrame(codec wire.Codec) []byte {
+	frame := append([]byte(HelloMagic), wire.VERSION)
+	return append(frame, codec...)
+}
+
+// parseHello: parse the hello frame
+// return:
+// - the wire version, the preferred codec, and whether the frame is a hello frame
+func parseHello(frame []byte) (byte, wire.Codec, bool) {
+	if len(frame) <= len(HelloMagic) || !bytes.HasPrefix(frame, []byte(HelloMagic)) {
+		return 0, "", false
+	}
+	return frame[len(HelloMagic)], wire.Codec(frame[len(HelloMagic)+1:]), true
+}
+
+// WriteFrame: write message with the 4-byte big-endian length prefix
+func WriteFrame(w io.Writer, msg []byte) error {
+	if len(msg) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	frame := make([]byte, frameHdrSize+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[frameHdrSize:], msg)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame: read a message with the 4-byte big-endian length prefix
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var hdr [frameHdrSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,303 @@
+package transport_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"message"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"transport"
+	"wire"
+)
+
+// freeAddrs: get n free addresses on localhost
+func freeAddrs(t *testing.T, names ...string) map[string]string {
+	addrs := make(map[string]string)
+	for _, name := range names {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[name] = ln.Addr().String()
+		ln.Close()
+	}
+	return addrs
+}
+
+// recv: wait for a message from the inbox
+func recv(t *testing.T, inbox chan []byte, want []byte) {
+	select {
+	case msg := <-inbox:
+		if !bytes.Equal(msg, want) {
+			t.Fatal("recieve wrong message", string(msg))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("recieve timeout", string(want))
+	}
+}
+
+// TestFrame: test the length-prefixed frame
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	msgs := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte("x"), 100000)}
+	for _, msg := range msgs {
+		if err := transport.WriteFrame(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, msg := range msgs {
+		got, err := transport.ReadFrame(&buf)
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Fatal("read frame error", err)
+		}
+	}
+	if _, err := transport.ReadFrame(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})); err != transport.ErrFrameTooLarge {
+		t.Fatal("read too large frame", err)
+	}
+}
+
+// TestTCPTransport: test broadcast, gossip and unicast among three nodes on localhost
+func TestTCPTransport(t *testing.T) {
+	names := []string{"r_0", "r_1", "r_2"}
+	addrs := freeAddrs(t, names...)
+	inboxes := make(map[string]chan []byte)
+	trans := make(map[string]*transport.TCPTransport)
+	for _, name := range names {
+		inboxes[name] = make(chan []byte, 16)
+		tt, err := transport.NewTCPTransport(name, addrs, inboxes[name], wire.BINARY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tt.Close()
+		trans[name] = tt
+	}
+
+	trans["r_0"].Broadcast([]byte("broadcast"), "r_0")
+	for _, name := range names {
+		recv(t, inboxes[name], []byte("broadcast"))
+	}
+
+	trans["r_1"].Gossip([]byte("gossip"), "r_1")
+	recv(t, inboxes["r_0"], []byte("gossip"))
+	recv(t, inboxes["r_2"], []byte("gossip"))
+
+	trans["r_2"].Unicast([]byte("unicast"), "r_0", "r_2")
+	recv(t, inboxes["r_0"], []byte("unicast"))
+
+	// the messages from one peer keep the order
+	for i := 0; i < 100; i++ {
+		trans["r_0"].Unicast([]byte(fmt.Sprint(i)), "r_1", "r_0")
+	}
+	for i := 0; i < 100; i++ {
+		recv(t, inboxes["r_1"], []byte(fmt.Sprint(i)))
+	}
+
+	for _, inbox := range inboxes {
+		if len(inbox) != 0 {
+			t.Fatal("unexpected message", string(<-inbox))
+		}
+	}
+}
+
+// TestTCPReconnect: test the message sent to a restarting peer is delivered after it comes back
+func TestTCPReconnect(t *testing.T) {
+	addrs := freeAddrs(t, "r_0", "r_1")
+	inbox0 := make(chan []byte, 16)
+	inbox1 := make(chan []byte, 16)
+	t0, err := transport.NewTCPTransport("r_0", addrs, inbox0, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer t0.Close()
+
+	// r_1 is not started yet
+	t0.Unicast([]byte("before"), "r_1", "r_0")
+	time.Sleep(200 * time.Millisecond)
+
+	t1, err := transport.NewTCPTransport("r_1", addrs, inbox1, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv(t, inbox1, []byte("before"))
+
+	// restart r_1 on the same address
+	t1.Close()
+	t1, err = transport.NewTCPTransport("r_1", addrs, inbox1, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer t1.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		t0.Unicast([]byte("after"), "r_1", "r_0")
+		select {
+		case msg := <-inbox1:
+			if string(msg) != "after" {
+				t.Fatal("recieve wrong message", string(msg))
+			}
+			fmt.Println("reconnected to", t1.Addr)
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Fatal("not reconnect")
+}
+
+// TestTCPCodec: test the codec negotiated with the binary peer, the JSON peer and the old peer which doesn't know the hello frame
+func TestTCPCodec(t *testing.T) {
+	addrs := freeAddrs(t, "r_0", "r_1", "r_2", "r_3")
+
+	// the old peer reads the frames and never replies
+	ln, err := net.Listen("tcp", addrs["r_3"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	legacy := make(chan []byte, 16)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			msg, err := transport.ReadFrame(reader)
+			if err != nil {
+				return
+			}
+			legacy <- msg
+		}
+	}()
+
+	inboxes := make(map[string]chan []byte)
+	trans := make(map[string]*transport.TCPTransport)
+	for name, codec := range map[string]wire.Codec{"r_0": wire.BINARY, "r_1": wire.JSON, "r_2": wire.BINARY} {
+		inboxes[name] = make(chan []byte, 16)
+		tt, err := transport.NewTCPTransport(name, addrs, inboxes[name], codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tt.Close()
+		trans[name] = tt
+	}
+
+	sMsg := message.ServerMsg{SType: message.ORDER, SendServer: "r_0", ReciServer: "Broadcast", Sign: []byte{1}, Payload: []byte{wire.MAGIC, 2}}
+	msg, err := message.EncodeMsg(sMsg, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans["r_0"].Broadcast(msg, "r_0")
+
+	// the peers which reply the hello frame recieve the message as it is, whichever codec they prefer
+	recv(t, inboxes["r_0"], msg)
+	recv(t, inboxes["r_1"], msg)
+	recv(t, inboxes["r_2"], msg)
+
+	select {
+	case hello := <-legacy:
+		if !bytes.HasPrefix(hello, []byte(transport.HelloMagic)) {
+			t.Fatal("the first frame is not hello", hello)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("recieve hello timeout")
+	}
+
+	// the binary message is refused for the old peer without the transcoder, and the JSON message is sent to it
+	jsonMsg, _ := message.EncodeMsg(sMsg, wire.JSON)
+	trans["r_0"].Unicast(jsonMsg, "r_3", "r_0")
+	recv(t, legacy, jsonMsg)
+
+	// the binary message is encoded by JSON again for the old peer by the transcoder
+	trans["r_0"].Transcode = func(msg []byte) ([]byte, error) {
+		decoded := message.DecodeMsg(msg)
+		if decoded == nil {
+			return nil, fmt.Errorf("can't decode %v", msg)
+		}
+		return message.EncodeMsg(*decoded, wire.JSON)
+	}
+	trans["r_0"].Unicast(msg, "r_3", "r_0")
+	recv(t, legacy, jsonMsg)
+}
+
+// TestTCPTLS: test the connections secured by TLS, the peer whose certificate is not signed by the cluster CA
+// and the plain TCP peer can't send messages to the replicas, and the replicas don't send to the peer whose certificate is issued to another name,
+// the private key of the CA is never written with the certificates of the nodes, and the peer which never completes the handshake is disconnected
+func TestTCPTLS(t *testing.T) {
+	dir, caDir, otherDir, otherCADir := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	if err := transport.GenTLSFiles(dir, dir, []string{"r_0"}); err == nil {
+		t.Fatal("the CA key is written with the node certificates")
+	}
+	if err := transport.GenTLSFiles(dir, caDir, []string{"r_0", "r_1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.GenTLSFiles(otherDir, otherCADir, []string{"r_2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.IssueTLSCert(caDir, dir, "r_x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, transport.CAKeyFile)); !os.IsNotExist(err) {
+		t.Fatal("the CA key is in the directory of the node certificates")
+	}
+
+	// r_3 holds the certificate issued to r_x, and r_4 doesn't use TLS
+	certs := map[string][2]string{"r_0": {dir, "r_0"}, "r_1": {dir, "r_1"}, "r_2": {otherDir, "r_2"}, "r_3": {dir, "r_x"}}
+	addrs := freeAddrs(t, "r_0", "r_1", "r_2", "r_3", "r_4")
+	inboxes := make(map[string]chan []byte)
+	trans := make(map[string]*transport.TCPTransport)
+	for name := range addrs {
+		inboxes[name] = make(chan []byte, 16)
+		var tt *transport.TCPTransport
+		var err error
+		if c, ok := certs[name]; ok {
+			conf, err := transport.LoadTLSConfig(filepath.Join(c[0], c[1]+transport.CertSuffix), filepath.Join(c[0], c[1]+transport.KeySuffix), filepath.Join(c[0], transport.CACertFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt, err = transport.NewTLSTransport(name, addrs, inboxes[name], wire.BINARY, conf)
+		} else {
+			tt, err = transport.NewTCPTransport(name, addrs, inboxes[name], wire.BINARY)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tt.Close()
+		trans[name] = tt
+	}
+
+	trans["r_0"].Broadcast([]byte("broadcast"), "r_0")
+	recv(t, inboxes["r_0"], []byte("broadcast"))
+	recv(t, inboxes["r_1"], []byte("broadcast"))
+	trans["r_1"].Unicast([]byte("unicast"), "r_0", "r_1")
+	recv(t, inboxes["r_0"], []byte("unicast"))
+
+	for _, name := range []string{"r_2", "r_4"} {
+		trans[name].Unicast([]byte("untrusted"), "r_1", name)
+	}
+	trans["r_0"].Unicast([]byte("untrusted"), "r_3", "r_0")
+	time.Sleep(time.Second)
+	for name, inbox := range inboxes {
+		if len(inbox) != 0 {
+			t.Fatal(name, "recieves the untrusted message", string(<-inbox))
+		}
+	}
+
+	// the connection which never sends the handshake is closed by r_0 after the handshake timeout
+	conn, err := net.Dial("tcp", addrs["r_0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(transport.HandshakeTimeout + time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("r_0 sends on the connection without the handshake")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("r_0 keeps the connection without the handshake")
+	}
+}
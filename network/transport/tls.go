@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the files of the cluster CA and the node certificates written by GenTLSFiles
+const (
+	CACertFile = "ca.crt"                  // the certificate of the cluster CA
+	CAKeyFile  = "ca.key"                  // the private key of the cluster CA, which is only written in the CA directory of the operator
+	CertSuffix = ".crt"                    // the certificate of node r_i is r_i.crt
+	KeySuffix  = ".tls.key"                // the private key of node r_i is r_i.tls.key
+	CertValid  = 10 * 365 * 24 * time.Hour // the validity of the generated certificates
+)
+
+// LoadTLSConfig: load the certificate of the node and the cluster CA,
+// the connections are authenticated on both sides, the node accepts only the peers whose certificates are signed by the CA,
+// and the dialer checks that the certificate of the peer is issued to the name of the peer
+// params:
+// - certFile: the PEM certificate of the node, whose DNS name is the name of the node such as "r_0"
+// - keyFile:  the PEM private key of the node
+// - caFile:   the PEM certificate of the cluster CA
+// return:
+// - the TLS config and error
+func LoadTLSConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no certificate in CA file")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// GenTLSFiles: generate the cluster CA and the certificates of nodes,
+// the certificate of each node is issued to its name and signed by the CA, see IssueTLSCert
+// note: the private key of the CA is only written in caDir, which is kept by the operator and never given to the nodes,
+// so a compromised node can't issue the certificate of another node, caDir must not be dir
+// params:
+// - dir:   the directory to write the certificates of nodes, their keys and the certificate of the CA
+// - caDir: the directory to write the certificate and the private key of the CA
+// - names: the names of nodes
+// return:
+// - error
+func GenTLSFiles(dir string, caDir string, names []string) error {
+	if filepath.Clean(dir) == filepath.Clean(caDir) {
+		return errors.New("the CA key must not be written with the node certificates")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(caDir, 0700); err != nil {
+		return err
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	caTmpl := certTemplate("dcschain CA")
+	caTmpl.IsCA = true
+	caTmpl.BasicConstraintsValid = true
+	caTmpl.KeyUsage = x509.KeyUsageCertSign
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	for _, certDir := range []string{dir, caDir} {
+		if err := writePEM(filepath.Join(certDir, CACertFile), "CERTIFICATE", caDER, 0644); err != nil {
+			return err
+		}
+	}
+	if err := writeKey(filepath.Join(caDir, CAKeyFile), caKey); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := IssueTLSCert(caDir, dir, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IssueTLSCert: issue the certificate of a node by the cluster CA, such as the node which joins later
+// params:
+// - caDir: the CA directory written by GenTLSFiles
+// - dir:   the directory to write the certificate of the node and its key
+// - name:  the name of the node
+// return:
+// - error
+func IssueTLSCert(caDir string, dir string, name string) error {
+	caPair, err := tls.LoadX509KeyPair(filepath.Join(caDir, CACertFile), filepath.Join(caDir, CAKeyFile))
+	if err != nil {
+		return err
+	}
+	caCert, err := x509.ParseCertificate(caPair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	tmpl := certTemplate(name)
+	tmpl.DNSNames = []string{name}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caPair.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(dir, name+CertSuffix), "CERTIFICATE", der, 0644); err != nil {
+		return err
+	}
+	return writeKey(filepath.Join(dir, name+KeySuffix), key)
+}
+
+// certTemplate: the certificate template with a random serial number
+func certTemplate(commonName string) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(CertValid),
+	}
+}
+
+// writeKey: write the ECDSA private key by PEM, which is only readable by the owner
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "EC PRIVATE KEY", der, 0600)
+}
+
+// writePEM: write a PEM block to file
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
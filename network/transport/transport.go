@@ -0,0 +1,25 @@
+package transport
+
+// TransportType: the type of transport between replicas
+type TransportType string
+
+const (
+	CHANNEL TransportType = "channel" // the in-process channels, all replicas live in one process
+	TCP     TransportType = "tcp"     // the persistent TCP connections, each replica can run as its own process
+)
+
+// Transport: send the encoded server messages between replicas,
+// the recieved messages are delivered to the channel of the replica itself
+type Transport interface {
+	// Broadcast: send message to all nodes include itself
+	Broadcast(msg []byte, sendName string)
+
+	// Gossip: send message to all nodes except the sender
+	Gossip(msg []byte, sendName string)
+
+	// Unicast: send message to the node named reciName
+	Unicast(msg []byte, reciName string, sendName string)
+
+	// Close: release the resources of the transport
+	Close() error
+}
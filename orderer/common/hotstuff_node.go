@@ -1,5 +1,10 @@
 package common
 
+import (
+	"canonical"
+	"wire"
+)
+
 // HsNode: the hotstuff node
 type HsNode struct {
 	CurHash    []byte // hash of the current block
@@ -7,9 +12,31 @@ type HsNode struct {
 	// Block  *types.Block // named cmd in paper
 }
 
-// Object2Byte: convert hsnode to byte slice, simple link
+// Encode: write the current hash and the parent hash to the canonical encoder, each hash is length-prefixed
+// params:
+// - e: the canonical encoder of the signed message
+// return:
+// - the encoder
+func (h *HsNode) Encode(e *canonical.Encoder) *canonical.Encoder {
+	return e.Bytes(h.CurHash).Bytes(h.ParentHash)
+}
+
+// Decode: read the current hash and the parent hash written by Encode
+// params:
+// - d: the canonical decoder of the signed message
 // return:
-// - byte slice of hotstuff node
-func (h *HsNode) Object2Byte() []byte {
-	return append(h.CurHash, h.ParentHash...)
+// - the decoder
+func (h *HsNode) Decode(d *canonical.Decoder) *canonical.Decoder {
+	h.CurHash, h.ParentHash = d.Bytes(), d.Bytes()
+	return d
+}
+
+// EncodeWire: write the current hash and the parent hash to the binary codec
+func (h *HsNode) EncodeWire(w *wire.Writer) {
+	w.Bytes(h.CurHash).Bytes(h.ParentHash)
+}
+
+// DecodeWire: read the current hash and the parent hash from the binary codec
+func (h *HsNode) DecodeWire(r *wire.Reader) {
+	h.CurHash, h.ParentHash = r.Bytes(), r.Bytes()
 }
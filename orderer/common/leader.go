@@ -0,0 +1,272 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ElectionPolicy: the policy to elect the leader of each view
+type ElectionPolicy string
+
+const (
+	ROUND_ROBIN ElectionPolicy = "round-robin" // rotate the leader in order, the leader of the next view is the next node of the current leader
+	REPUTATION  ElectionPolicy = "reputation"  // rotate the leader by the view number, but skip the leaders which recently failed to certify a block
+	HASH        ElectionPolicy = "hash"        // select the leader randomly by the hash of the view number and the recently certified block
+)
+
+// the default config of the leader election by the certified history
+const (
+	ElectionLag      = 4  // the leader of view v is elected by the blocks certified before view v-ElectionLag, which all replicas have certified
+	ReputationWindow = 20 // the number of views in which the failed leaders are skipped
+)
+
+// LeaderElector: the policy to elect the leader of each view,
+// all replicas which have seen the same certified chain elect the same leader of a view
+type LeaderElector interface {
+	// Policy: get the election policy
+	Policy() ElectionPolicy
+	// ElectLeader: elect the leader of the view
+	// params:
+	// - viewNumber: the view number to elect the leader
+	// - cur: the current view, round-robin rotates from its leader
+	// return:
+	// - the leader number of the view
+	ElectLeader(viewNumber int, cur View) int
+	// Certify: observe a block certified by a QC or committed, the election follows the chain of the highest
+	// certified block, and the views without the certified block on the chain are the failed views
+	// note: every protocol calls it on the commit of each block as well, so the leaders of the later views may be
+	// elected by the committed blocks, whose QCs the replica may never see, such as those of PBFT which has no QC,
+	// or those committed at once while the replica catches up
+	// params:
+	// - viewNumber: the view number of the block
+	// - blkHash: the hash of the block
+	// - parentHash: the hash of the parent block
+	Certify(viewNumber int, blkHash []byte, parentHash []byte)
+	// HistorySize: get the number of the latest certified blocks which the election depends on,
+	// the recovered replica observes the committed ones again before electing
+	HistorySize() int
+}
+
+// NewLeaderElector: create the leader elector of the policy
+// params:
+// - policy: the election policy, round-robin by default
+// return:
+// - the leader elector and error
+func NewLeaderElector(policy ElectionPolicy) (LeaderElector, error) {
+	switch policy {
+	case ROUND_ROBIN, "":
+		return RoundRobin{}, nil
+	case REPUTATION:
+		return NewReputationElector(ReputationWindow), nil
+	case HASH:
+		return NewHashElector(), nil
+	default:
+		return nil, errors.New("unknown leader election policy: " + string(policy))
+	}
+}
+
+// RoundRobin: the leader of the next view is the next node of the current leader, which is the original policy
+type RoundRobin struct{}
+
+// Policy: get the election policy
+func (RoundRobin) Policy() ElectionPolicy {
+	return ROUND_ROBIN
+}
+
+// ElectLeader: rotate from the leader of the current view by the distance of view number
+func (RoundRobin) ElectLeader(viewNumber int, cur View) int {
+	if cur.NodesNum <= 0 {
+		return cur.Leader
+	}
+	return mod(cur.Leader+viewNumber-cur.ViewNumber, cur.NodesNum)
+}
+
+// Certify: round-robin doesn't depend on the certified blocks
+func (RoundRobin) Certify(viewNumber int, blkHash []byte, parentHash []byte) {}
+
+// HistorySize: round-robin doesn't depend on the certified blocks
+func (RoundRobin) HistorySize() int {
+	return 0
+}
+
+// certifiedBlock: a block certified by a QC or by the commit of the block, linked to its parent
+type certifiedBlock struct {
+	view   int    // the view number of the block
+	parent string // the hash of the parent block
+}
+
+// certifiedHistory: the blocks certified by the QCs which the replica has seen, the election follows the chain
+// of the highest certified block, which the proposals of the next views extend, as the leader reputation of DiemBFT,
+// so the replicas which have seen the same QC elect the same leaders, however far each of them has committed,
+// and the certified blocks of the other forks are not in the history
+type certifiedHistory struct {
+	mu     sync.Mutex
+	size   int                       // the max number of blocks of the chain kept behind the highest certified block
+	blocks map[string]certifiedBlock // the certified blocks by hash
+	anchor string                    // the hash of the highest certified block
+	views  []int                     // the view numbers of the blocks on the chain of the anchor in ascending order
+	hashes [][]byte                  // the hashes of the blocks on the chain of the anchor
+}
+
+// newCertifiedHistory: create the history which keeps the size of blocks on the chain
+func newCertifiedHistory(size int) certifiedHistory {
+	return certifiedHistory{size: size, blocks: make(map[string]certifiedBlock)}
+}
+
+// Certify: keep the certified block, and follow its chain if it is the highest certified block,
+// the block whose parent is not certified yet starts the chain, which is linked once the parent is certified
+func (h *certifiedHistory) Certify(viewNumber int, blkHash []byte, parentHash []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.blocks[string(blkHash)]; !ok {
+		h.blocks[string(blkHash)] = certifiedBlock{view: viewNumber, parent: string(parentHash)}
+	}
+	if anchor, ok := h.blocks[h.anchor]; !ok || viewNumber > anchor.view {
+		h.anchor = string(blkHash)
+	}
+	h.follow()
+}
+
+// follow: walk the chain back from the anchor, the view numbers must descend, and drop the blocks before the chain
+func (h *certifiedHistory) follow() {
+	h.views, h.hashes = h.views[:0], h.hashes[:0]
+	for hash, next := h.anchor, -1; len(h.views) < h.size; {
+		blk, ok := h.blocks[hash]
+		if !ok || (next >= 0 && blk.view >= next) {
+			break
+		}
+		h.views = append(h.views, blk.view)
+		h.hashes = append(h.hashes, []byte(hash))
+		hash, next = blk.parent, blk.view
+	}
+	for i, j := 0, len(h.views)-1; i < j; i, j = i+1, j-1 {
+		h.views[i], h.views[j] = h.views[j], h.views[i]
+		h.hashes[i], h.hashes[j] = h.hashes[j], h.hashes[i]
+	}
+	if len(h.views) == h.size {
+		for hash, blk := range h.blocks {
+			if blk.view < h.views[0] {
+				delete(h.blocks, hash)
+			}
+		}
+	}
+}
+
+// HistorySize: get the max number of blocks of the chain kept
+func (h *certifiedHistory) HistorySize() int {
+	return h.size
+}
+
+// latestBefore: get the index of the latest block on the chain before the view, -1 if there is none
+func (h *certifiedHistory) latestBefore(viewNumber int) int {
+	return sort.SearchInts(h.views, viewNumber) - 1
+}
+
+// failed: check whether the view failed to certify a block on the chain, which is known only if a later view has certified one
+func (h *certifiedHistory) failed(viewNumber int) bool {
+	i := h.latestBefore(viewNumber)
+	return i >= 0 && i+1 < len(h.views) && h.views[i+1] != viewNumber
+}
+
+// ReputationElector: rotate the leader by the view number as round-robin, but skip the leaders which failed
+// to certify a block on the chain in the recent window of views, as the leader reputation of DiemBFT,
+// at most f leaders are skipped so that the correct nodes are always elected
+type ReputationElector struct {
+	certifiedHistory
+	Window int // the number of views in which the failed leaders are skipped
+}
+
+// NewReputationElector: create the reputation-based leader elector
+// params:
+// - window: the number of views in which the failed leaders are skipped
+// return:
+// - the leader elector
+func NewReputationElector(window int) *ReputationElector {
+	// the failed leaders of the window are elected by the failed views of the previous window,
+	// so the history covers two windows
+	return &ReputationElector{
+		certifiedHistory: newCertifiedHistory(2*(window+ElectionLag) + 1),
+		Window:           window,
+	}
+}
+
+// Policy: get the election policy
+func (r *ReputationElector) Policy() ElectionPolicy {
+	return REPUTATION
+}
+
+// ElectLeader: the first node from the view number in order which isn't a recently failed leader,
+// the view 0 is always led by r_0
+func (r *ReputationElector) ElectLeader(viewNumber int, cur View) int {
+	if cur.NodesNum <= 0 || viewNumber <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.elect(viewNumber, cur.NodesNum, 2)
+}
+
+// elect: elect the leader of the view, the failed leaders are elected with one less depth,
+// and the depth 0 is round-robin by the view number, so the election doesn't depend on the whole history
+func (r *ReputationElector) elect(viewNumber int, nodesNum int, depth int) int {
+	leader := mod(viewNumber, nodesNum)
+	if depth == 0 {
+		return leader
+	}
+
+	// the latest failed leaders in the window, at most f of them
+	skipped := make(map[int]bool)
+	for v := viewNumber - ElectionLag - 1; v >= viewNumber-ElectionLag-r.Window && len(skipped) < (nodesNum-1)/3; v-- {
+		if v > 0 && r.failed(v) {
+			skipped[r.elect(v, nodesNum, depth-1)] = true
+		}
+	}
+	for skipped[leader] {
+		leader = (leader + 1) % nodesNum
+	}
+	return leader
+}
+
+// HashElector: select the leader by the hash of the view number and the latest certified block before the lag,
+// which is unpredictable before the block is certified like a VRF and is the same on all replicas
+type HashElector struct {
+	certifiedHistory
+}
+
+// NewHashElector: create the hash-based leader elector
+func NewHashElector() *HashElector {
+	// the blocks after the lag are kept for the seed of the next views
+	return &HashElector{newCertifiedHistory(ElectionLag + 1)}
+}
+
+// Policy: get the election policy
+func (h *HashElector) Policy() ElectionPolicy {
+	return HASH
+}
+
+// ElectLeader: the hash of the seed block and the view number modulo the number of nodes,
+// the view 0 is always led by r_0
+func (h *HashElector) ElectLeader(viewNumber int, cur View) int {
+	if cur.NodesNum <= 0 || viewNumber <= 0 {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// the seed is the latest block on the chain certified before the lag, or empty if there is none
+	seed := make([]byte, 0, 40)
+	if i := h.latestBefore(viewNumber - ElectionLag); i >= 0 {
+		seed = append(seed, h.hashes[i]...)
+	}
+	seed = binary.BigEndian.AppendUint64(seed, uint64(viewNumber))
+	sum := sha256.Sum256(seed)
+	return int(binary.BigEndian.Uint64(sum[:8]) % uint64(cur.NodesNum))
+}
+
+// mod: the non-negative remainder
+func mod(a int, b int) int {
+	return ((a % b) + b) % b
+}
@@ -0,0 +1,239 @@
+package common_test
+
+import (
+	"common"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// blockHash: the hash of the test block of the view
+func blockHash(v int) []byte {
+	return []byte("block_" + strconv.Itoa(v))
+}
+
+// certifyViews: certify a block in each of the views except the failed ones, which extends the block
+// of the latest view before it that isn't failed
+func certifyViews(e common.LeaderElector, from int, to int, failed map[int]bool) {
+	for v := from; v <= to; v++ {
+		if !failed[v] {
+			parent := v - 1
+			for parent >= 0 && failed[parent] {
+				parent--
+			}
+			e.Certify(v, blockHash(v), blockHash(parent))
+		}
+	}
+}
+
+// TestRoundRobin: test round-robin keeps the original rotation of the view, with or without the elector
+func TestRoundRobin(t *testing.T) {
+	for _, elector := range []common.LeaderElector{nil, common.RoundRobin{}} {
+		v := common.View{ViewNumber: 0, Leader: 0, NodesNum: 4, Elector: elector}
+		for i := 1; i <= 9; i++ {
+			if v.NextLeaderName() != "r_"+strconv.Itoa(i%4) {
+				t.Fatal("wrong next leader", v.NextLeaderName())
+			}
+			v.NextView()
+			if v.ViewNumber != i || v.Leader != i%4 || v.LastLeaderName() != "r_"+strconv.Itoa((i+3)%4) {
+				t.Fatalf("wrong view %+v", v)
+			}
+		}
+
+		// the leader rotates from the synced leader, and is refreshed after the nodes exit
+		v.UpdateView(20, 3)
+		v.NextView()
+		if v.Leader != 0 {
+			t.Fatal("round-robin doesn't rotate from the synced leader", v.Leader)
+		}
+		v.UpdateView(21, 3)
+		v.UpdateNodesNum(3)
+		v.RefreshLeader()
+		if v.Leader != 0 || v.ViewNumber != 21 {
+			t.Fatalf("wrong refreshed view %+v", v)
+		}
+	}
+}
+
+// TestNewLeaderElector: test the electors of policies are created, and the unknown policy is rejected
+func TestNewLeaderElector(t *testing.T) {
+	for _, policy := range []common.ElectionPolicy{common.ROUND_ROBIN, common.REPUTATION, common.HASH} {
+		e, err := common.NewLeaderElector(policy)
+		if err != nil || e.Policy() != policy {
+			t.Fatal("wrong elector of", policy, err)
+		}
+	}
+	if e, err := common.NewLeaderElector(""); err != nil || e.Policy() != common.ROUND_ROBIN {
+		t.Fatal("default policy is not round-robin", err)
+	}
+	if _, err := common.NewLeaderElector("unknown"); err == nil {
+		t.Fatal("unknown policy is accepted")
+	}
+}
+
+// TestReputationElector: test the leaders which failed to certify a block are skipped in the window
+func TestReputationElector(t *testing.T) {
+	const nodesNum = 4
+	cur := common.View{NodesNum: nodesNum}
+	e := common.NewReputationElector(common.ReputationWindow)
+
+	// without failure, the leader rotates by the view number
+	certifyViews(e, 0, 30, nil)
+	for v := 31; v < 40; v++ {
+		if e.ElectLeader(v, cur) != v%nodesNum {
+			t.Fatal("wrong leader of view", v)
+		}
+	}
+
+	// r_1 crashes and fails in the view 33, then it is skipped after the lag until the failure leaves the window
+	certifyViews(e, 31, 40, map[int]bool{33: true})
+	for v := 33 + common.ElectionLag + 1; v <= 33+common.ElectionLag+common.ReputationWindow; v++ {
+		if leader := e.ElectLeader(v, cur); leader == 1 || (v%nodesNum != 1 && leader != v%nodesNum) {
+			t.Fatal("wrong leader of view", v, leader)
+		}
+	}
+	if e.ElectLeader(33+common.ElectionLag+common.ReputationWindow+4, cur) != 1 {
+		t.Fatal("failed leader is skipped out of the window")
+	}
+
+	// at most f leaders are skipped, so the leaders of other failed views are still elected
+	e = common.NewReputationElector(common.ReputationWindow)
+	certifyViews(e, 0, 40, map[int]bool{33: true, 34: true})
+	skipped := 0
+	for v := 40; v < 44; v++ {
+		if e.ElectLeader(v, cur) != v%nodesNum {
+			skipped++
+		}
+	}
+	if skipped != 1 {
+		t.Fatal("the number of skipped leaders is", skipped)
+	}
+
+	// the view 0 is led by r_0
+	if e.ElectLeader(0, cur) != 0 {
+		t.Fatal("view 0 is not led by r_0")
+	}
+}
+
+// TestElectorHistory: test the replicas elect the same leaders by the same certified blocks,
+// and the recovered replica which only observes the latest committed blocks agrees with them
+func TestElectorHistory(t *testing.T) {
+	cur := common.View{NodesNum: 7}
+	failed := map[int]bool{3: true, 12: true, 40: true, 41: true, 55: true, 70: true, 86: true, 87: true}
+	for _, policy := range []common.ElectionPolicy{common.REPUTATION, common.HASH} {
+		e1, _ := common.NewLeaderElector(policy)
+		e2, _ := common.NewLeaderElector(policy)
+		certifyViews(e1, 0, 90, failed)
+		certifyViews(e2, 0, 90, failed)
+
+		// the recovered replica observes the latest blocks of the history size
+		recovered, _ := common.NewLeaderElector(policy)
+		blocks := make([]int, 0)
+		for v := 0; v <= 90; v++ {
+			if !failed[v] {
+				blocks = append(blocks, v)
+			}
+		}
+		for i := len(blocks) - recovered.HistorySize(); i < len(blocks); i++ {
+			recovered.Certify(blocks[i], blockHash(blocks[i]), blockHash(blocks[i-1]))
+		}
+
+		elected := make(map[int]bool)
+		for v := 91; v <= 91+common.ElectionLag; v++ {
+			leader := e1.ElectLeader(v, cur)
+			if leader != e2.ElectLeader(v, cur) || leader != recovered.ElectLeader(v, cur) {
+				t.Fatal(policy, "replicas elect different leaders of view", v)
+			}
+			elected[leader] = true
+		}
+		if policy == common.HASH {
+			for v := 100; v < 200; v++ {
+				elected[e1.ElectLeader(v, cur)] = true
+			}
+			if len(elected) != cur.NodesNum {
+				t.Fatal("hash election doesn't cover all nodes", elected)
+			}
+		}
+	}
+}
+
+// TestHashElector: test the leader is selected by the latest block certified before the lag
+func TestHashElector(t *testing.T) {
+	cur := common.View{NodesNum: 16}
+	e1, e2 := common.NewHashElector(), common.NewHashElector()
+	certifyViews(e1, 0, 10, nil)
+	certifyViews(e2, 0, 10, nil)
+	e2.Certify(11, []byte("fork"), blockHash(10)) // the block after the lag doesn't change the leader
+
+	view := 10 + common.ElectionLag
+	if e1.ElectLeader(view, cur) != e2.ElectLeader(view, cur) {
+		t.Fatal("the block after the lag changes the leader")
+	}
+	diff := false
+	for v := 11 + common.ElectionLag + 1; v < 11+common.ElectionLag+20; v++ {
+		diff = diff || e1.ElectLeader(v, cur) != e2.ElectLeader(v, cur)
+	}
+	if !diff {
+		t.Fatal("the seed block doesn't change the leaders")
+	}
+}
+
+// TestViewElector: test the elector is kept by the view as the view is restored, and isn't persisted
+func TestViewElector(t *testing.T) {
+	e := common.NewReputationElector(common.ReputationWindow)
+	v := common.View{NodesNum: 4, Elector: e}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var persisted common.View
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		t.Fatal(err)
+	}
+	persisted.ViewNumber, persisted.Leader = 9, 2
+	v.Restore(persisted)
+	if v.ViewNumber != 9 || v.Leader != 2 || v.NodesNum != 4 || v.Elector != e {
+		t.Fatalf("wrong restored view %+v", v)
+	}
+
+	// the view tells the elector the certified blocks, the stale one isn't on the chain, so the view 2 failed and r_2 is skipped
+	v.Certify(1, blockHash(1), blockHash(0))
+	v.Certify(3, blockHash(3), blockHash(1))
+	v.Certify(2, []byte("stale"), blockHash(1))
+	if leader := e.ElectLeader(10, common.View{NodesNum: 4}); leader != 3 {
+		t.Fatal("the leader of failed view is elected", leader)
+	}
+}
+
+// TestCertifiedHistory: test the leaders are elected by the chain of the highest certified block, so the replicas
+// which see the QCs in any order, or also see the certified blocks of a fork, elect the same leaders
+func TestCertifiedHistory(t *testing.T) {
+	cur := common.View{NodesNum: 4}
+	failed := map[int]bool{25: true, 27: true}
+	for _, policy := range []common.ElectionPolicy{common.REPUTATION, common.HASH} {
+		e1, _ := common.NewLeaderElector(policy)
+		certifyViews(e1, 0, 40, failed)
+
+		// the replica sees the QCs from the highest one, the chain is linked as the parents are certified
+		e2, _ := common.NewLeaderElector(policy)
+		for v := 40; v >= 0; v-- {
+			certifyViews(e2, v, v, failed)
+		}
+		// the block of the view 25 is certified on a fork, which the highest certified block doesn't extend
+		e2.Certify(25, []byte("fork"), blockHash(24))
+
+		for v := 30; v <= 40+common.ElectionLag; v++ {
+			if e1.ElectLeader(v, cur) != e2.ElectLeader(v, cur) {
+				t.Fatal(policy, "replicas elect different leaders of view", v)
+			}
+		}
+	}
+
+	// the failed leader of the view 25 is skipped, though its block is certified on the fork
+	e := common.NewReputationElector(common.ReputationWindow)
+	certifyViews(e, 0, 30, map[int]bool{25: true})
+	e.Certify(25, []byte("fork"), blockHash(24))
+	if leader := e.ElectLeader(25+common.ElectionLag+4, cur); leader == 25%4 {
+		t.Fatal("the leader which certified a fork is elected", leader)
+	}
+}
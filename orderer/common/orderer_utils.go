@@ -8,4 +8,6 @@ const (
 	HOTSTUFF_PROTOCOL_CHAINED ConsensusType = "chained"
 	HOTSTUFF_2_PROTOCOL       ConsensusType = "hotstuff2"
 	PBFT                      ConsensusType = "pbft"
+	FAST_HOTSTUFF_PROTOCOL    ConsensusType = "fasthotstuff"
+	BULLSHARK                 ConsensusType = "bullshark"
 )
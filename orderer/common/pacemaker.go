@@ -0,0 +1,192 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// the default pacemaker config
+const (
+	Multiplier  = 2                      // the timeout is doubled on each consecutive expiry
+	MaxBackoff  = 32                     // the default max timeout is MaxBackoff times the base timeout
+	MinTimeout  = 100 * time.Millisecond // the min timeout of adaptive mode
+	LatencyGain = 4                      // the adaptive timeout is the smoothed latency plus LatencyGain times its variation
+)
+
+// PacemakerConfig: the config of pacemaker, the zero fields take the default values, see WithDefaults
+type PacemakerConfig struct {
+	BaseTimeout time.Duration // the timeout without backoff, it is also used before any commit is observed in adaptive mode
+	Multiplier  float64       // the timeout is multiplied by it on each consecutive expiry
+	MaxTimeout  time.Duration // the cap of timeout
+	MinTimeout  time.Duration // the floor of timeout in adaptive mode
+	Adaptive    bool          // whether the base timeout is set by the observed commit latency
+	Clock       Clock         // the clock which measures the timeouts, the real clock if it is nil
+}
+
+// WithDefaults: fill the zero fields with the default values
+// params:
+// - baseTimeout: the default base timeout of the protocol
+// return:
+// - the config
+func (c PacemakerConfig) WithDefaults(baseTimeout time.Duration) PacemakerConfig {
+	if c.BaseTimeout <= 0 {
+		c.BaseTimeout = baseTimeout
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = Multiplier
+	}
+	if c.MaxTimeout <= 0 {
+		c.MaxTimeout = c.BaseTimeout * MaxBackoff
+	}
+	if c.MaxTimeout < c.BaseTimeout {
+		c.MaxTimeout = c.BaseTimeout
+	}
+	if c.MinTimeout <= 0 {
+		c.MinTimeout = MinTimeout
+	}
+	if c.MinTimeout > c.MaxTimeout {
+		c.MinTimeout = c.MaxTimeout
+	}
+	return c
+}
+
+// PacemakerMetrics: the decisions of pacemaker, which are used to tune the liveness
+type PacemakerMetrics struct {
+	Timeout         time.Duration // the timeout of the next view
+	Backoff         int           // the number of consecutive expiries since the last progress
+	Expiries        uint64        // the total number of expiries
+	Capped          uint64        // the number of expiries after which the timeout reaches the max timeout
+	Commits         uint64        // the number of observed commits
+	LastLatency     time.Duration // the latest commit latency
+	SmoothedLatency time.Duration // the smoothed commit latency
+	LatencyVar      time.Duration // the smoothed variation of commit latency
+}
+
+// Pacemaker: decide the timeout of the view, it backs off exponentially on the consecutive expiries up to the cap,
+// and in adaptive mode the base timeout follows the observed commit latency like the retransmission timeout of TCP
+type Pacemaker struct {
+	Config  PacemakerConfig
+	mu      sync.Mutex
+	metrics PacemakerMetrics
+}
+
+// NewPacemaker: create a pacemaker
+// params:
+// - config: the config, whose zero fields take the default values with the base timeout of 5s
+// return:
+// - the pacemaker
+func NewPacemaker(config PacemakerConfig) *Pacemaker {
+	pm := &Pacemaker{Config: config.WithDefaults(5 * time.Second)}
+	pm.metrics.Timeout = pm.timeout()
+	return pm
+}
+
+// Timeout: get the timeout of the next view
+func (pm *Pacemaker) Timeout() time.Duration {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.metrics.Timeout
+}
+
+// Expire: the view times out, the timeout of the next view backs off
+func (pm *Pacemaker) Expire() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.metrics.Expiries++
+	pm.metrics.Backoff++
+	pm.update()
+	if pm.metrics.Timeout == pm.Config.MaxTimeout {
+		pm.metrics.Capped++
+	}
+}
+
+// Progress: the view makes progress before it times out, the backoff is reset
+func (pm *Pacemaker) Progress() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.metrics.Backoff = 0
+	pm.update()
+}
+
+// ObserveCommit: observe the latency from proposing a block to committing it,
+// the negative latency caused by the clock skew between replicas is taken as 0
+// note: every protocol calls it on the commit of each block, and the observed latency only sets the view timeout in adaptive mode
+// params:
+// - latency: the commit latency
+func (pm *Pacemaker) ObserveCommit(latency time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if latency < 0 {
+		latency = 0
+	}
+	m := &pm.metrics
+	if m.Commits == 0 {
+		m.SmoothedLatency, m.LatencyVar = latency, latency/2
+	} else {
+		diff := m.SmoothedLatency - latency
+		if diff < 0 {
+			diff = -diff
+		}
+		m.LatencyVar = (3*m.LatencyVar + diff) / 4
+		m.SmoothedLatency = (7*m.SmoothedLatency + latency) / 8
+	}
+	m.Commits++
+	m.LastLatency = latency
+	pm.update()
+}
+
+// SetBaseTimeout: retune the base timeout of the running pacemaker, such as by a committed reconfiguration,
+// the cap is raised to the base timeout if it is lower
+// params:
+// - base: the new base timeout
+func (pm *Pacemaker) SetBaseTimeout(base time.Duration) {
+	if base <= 0 {
+		return
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.Config.BaseTimeout = base
+	if pm.Config.MaxTimeout < base {
+		pm.Config.MaxTimeout = base
+	}
+	pm.update()
+}
+
+// BaseTimeout: get the base timeout, which may be retuned while running
+func (pm *Pacemaker) BaseTimeout() time.Duration {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.Config.BaseTimeout
+}
+
+// Metrics: get the snapshot of metrics
+func (pm *Pacemaker) Metrics() PacemakerMetrics {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.metrics
+}
+
+// update: decide the timeout of the next view
+func (pm *Pacemaker) update() {
+	pm.metrics.Timeout = pm.timeout()
+}
+
+// timeout: the base timeout multiplied by the backoff, which is capped by the max timeout
+func (pm *Pacemaker) timeout() time.Duration {
+	c := pm.Config
+	base := c.BaseTimeout
+	if c.Adaptive && pm.metrics.Commits > 0 {
+		base = pm.metrics.SmoothedLatency + LatencyGain*pm.metrics.LatencyVar
+		if base < c.MinTimeout {
+			base = c.MinTimeout
+		}
+	}
+	timeout := float64(base)
+	for i := 0; i < pm.metrics.Backoff && timeout < float64(c.MaxTimeout); i++ {
+		timeout *= c.Multiplier
+	}
+	if timeout >= float64(c.MaxTimeout) {
+		return c.MaxTimeout
+	}
+	return time.Duration(timeout)
+}
@@ -0,0 +1,112 @@
+package common_test
+
+import (
+	"common"
+	"testing"
+	"time"
+)
+
+// TestPacemakerDefaults: test the zero fields of config take the default values
+func TestPacemakerDefaults(t *testing.T) {
+	c := common.PacemakerConfig{}.WithDefaults(time.Second)
+	if c.BaseTimeout != time.Second || c.Multiplier != common.Multiplier || c.MaxTimeout != common.MaxBackoff*time.Second || c.MinTimeout != common.MinTimeout {
+		t.Fatalf("wrong defaults %+v", c)
+	}
+
+	// the max timeout is not less than the base timeout, and the min timeout is not more than the max timeout
+	c = common.PacemakerConfig{BaseTimeout: time.Second, MaxTimeout: time.Millisecond, MinTimeout: time.Minute}.WithDefaults(5 * time.Second)
+	if c.BaseTimeout != time.Second || c.MaxTimeout != time.Second || c.MinTimeout != time.Second {
+		t.Fatalf("wrong bounds %+v", c)
+	}
+}
+
+// TestPacemakerBackoff: test the timeout backs off on the consecutive expiries up to the cap, and is reset by the progress
+func TestPacemakerBackoff(t *testing.T) {
+	pm := common.NewPacemaker(common.PacemakerConfig{BaseTimeout: 100 * time.Millisecond, Multiplier: 3, MaxTimeout: time.Second})
+	expected := []time.Duration{300 * time.Millisecond, 900 * time.Millisecond, time.Second, time.Second}
+	for i, timeout := range expected {
+		pm.Expire()
+		if pm.Timeout() != timeout {
+			t.Fatalf("expiry %d: expected timeout %v, got %v", i+1, timeout, pm.Timeout())
+		}
+	}
+	m := pm.Metrics()
+	if m.Expiries != 4 || m.Backoff != 4 || m.Capped != 2 {
+		t.Fatalf("wrong metrics %+v", m)
+	}
+
+	pm.Progress()
+	m = pm.Metrics()
+	if m.Timeout != 100*time.Millisecond || m.Backoff != 0 || m.Expiries != 4 {
+		t.Fatalf("backoff is not reset %+v", m)
+	}
+
+	// the base timeout is retuned while running, and the cap is raised to it
+	pm.SetBaseTimeout(2 * time.Second)
+	if pm.Timeout() != 2*time.Second || pm.Config.MaxTimeout != 2*time.Second {
+		t.Fatalf("base timeout is not retuned %+v", pm.Config)
+	}
+}
+
+// TestPacemakerAdaptive: test the timeout follows the observed commit latency in adaptive mode only
+func TestPacemakerAdaptive(t *testing.T) {
+	fixed := common.NewPacemaker(common.PacemakerConfig{BaseTimeout: time.Second})
+	adaptive := common.NewPacemaker(common.PacemakerConfig{BaseTimeout: time.Second, MinTimeout: 10 * time.Millisecond, Adaptive: true})
+	for i := 0; i < 50; i++ {
+		fixed.ObserveCommit(20 * time.Millisecond)
+		adaptive.ObserveCommit(20 * time.Millisecond)
+	}
+	if fixed.Timeout() != time.Second {
+		t.Fatal("timeout of fixed mode changes to", fixed.Timeout())
+	}
+
+	// the variation decays with the stable latency, so the timeout converges to the latency
+	m := adaptive.Metrics()
+	if m.Commits != 50 || m.LastLatency != 20*time.Millisecond || m.SmoothedLatency != 20*time.Millisecond {
+		t.Fatalf("wrong metrics %+v", m)
+	}
+	if m.Timeout < 20*time.Millisecond || m.Timeout > 25*time.Millisecond {
+		t.Fatal("timeout doesn't converge to the latency", m.Timeout)
+	}
+
+	// the adaptive timeout still backs off, and it is not less than the min timeout
+	adaptive.Expire()
+	if adaptive.Timeout() != 2*m.Timeout {
+		t.Fatal("adaptive timeout doesn't back off", adaptive.Timeout())
+	}
+	adaptive.Progress()
+	for i := 0; i < 50; i++ {
+		adaptive.ObserveCommit(-time.Millisecond)
+	}
+	if adaptive.Timeout() != 10*time.Millisecond {
+		t.Fatal("adaptive timeout is less than the min timeout", adaptive.Timeout())
+	}
+}
+
+// TestPacemakerTimer: test the timer backs off after it expires and resets after it stops
+func TestPacemakerTimer(t *testing.T) {
+	pm := common.NewPacemaker(common.PacemakerConfig{BaseTimeout: 10 * time.Millisecond})
+	timer := common.NewPacemakerTimer(pm)
+	expired := make(chan struct{}, 1)
+	timer.Start(func() { expired <- struct{}{} }, func() {})
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("timer doesn't expire")
+	}
+	if timer.Duration() != 20*time.Millisecond {
+		t.Fatal("timer doesn't back off", timer.Duration())
+	}
+
+	stopped := make(chan struct{}, 1)
+	timer.Start(func() {}, func() { stopped <- struct{}{} })
+	timer.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("timer doesn't stop")
+	}
+	if timer.Duration() != 10*time.Millisecond {
+		t.Fatal("timer doesn't reset", timer.Duration())
+	}
+}
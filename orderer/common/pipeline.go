@@ -0,0 +1,19 @@
+package common
+
+import "fmt"
+
+// PipelineWindow: check the configured number of proposals in flight against the max window of the protocol
+// params:
+// - window:    the configured number, 1 or less means the leader proposes after the previous proposal is committed
+// - maxWindow: the max number of proposals in flight which the protocol supports
+// return:
+// - the number of proposals in flight which is at least 1, and error if it is above the max window
+func PipelineWindow(window int, maxWindow int) (int, error) {
+	if window < 1 {
+		return 1, nil
+	}
+	if window > maxWindow && window > 1 {
+		return 0, fmt.Errorf("pipeline window %d is above the max window %d of the protocol", window, maxWindow)
+	}
+	return window, nil
+}
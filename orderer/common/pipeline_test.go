@@ -0,0 +1,25 @@
+package common_test
+
+import (
+	"common"
+	"testing"
+)
+
+// TestPipelineWindow: test the configured window is at least 1, and the window above the max window of the protocol
+// is rejected instead of being bounded
+func TestPipelineWindow(t *testing.T) {
+	for window, expected := range map[int]int{-1: 1, 0: 1, 1: 1, 3: 3, 10: 10} {
+		got, err := common.PipelineWindow(window, 10)
+		if err != nil || got != expected {
+			t.Fatalf("window %d: expected %d, got %d %v", window, expected, got, err)
+		}
+	}
+	for _, window := range []int{3, 11, 100} {
+		if _, err := common.PipelineWindow(window, 2); window > 2 && err == nil {
+			t.Fatalf("window %d above the max window is accepted", window)
+		}
+	}
+	if got, err := common.PipelineWindow(1, 0); err != nil || got != 1 {
+		t.Fatal("the window 1 of the protocol which doesn't pipeline is rejected", err)
+	}
+}
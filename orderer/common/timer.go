@@ -4,69 +4,110 @@ import (
 	"time"
 )
 
-// MyTimer: a repackaged timer used to trigger ViewChange when a consensus timeout occurs
+// Clock: the clock which runs the function after the duration, the virtual clock of the simulated network
+// makes the timeouts reproducible
+type Clock interface {
+	// AfterFunc: run f in its own goroutine or event after the duration, the returned function cancels it
+	// and returns false if f has been run
+	AfterFunc(d time.Duration, f func()) func() bool
+}
+
+// realClock: the clock by the time library
+type realClock struct{}
+
+// AfterFunc: run f after the duration by the timer of the time library
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// MyTimer: a repackaged timer used to trigger ViewChange when a consensus timeout occurs,
+// its timeout period is decided by the pacemaker, and measured by the clock of the pacemaker config
 type MyTimer struct {
-	duration     time.Duration // timeout period of the timer
-	timer        *time.Timer   // timer in the time library
-	stopChan     chan bool     // the channel in the timer that receives the stop signal
-	IsStopped    bool          // indicate whether the timer is running
-	ExpireAction func()        // a function that runs after the timer expires
-	StopAction   func()        // a function that runs after the timer stops
+	Pacemaker    *Pacemaker  // the pacemaker which decides the timeout period, and is told whether the timer expires or stops
+	cancel       func() bool // cancel the expiry of the current start
+	stopAction   func()      // the stop action of the current start
+	IsStopped    bool        // indicate whether the timer is running
+	ExpireAction func()      // a function that runs after the timer expires
+	StopAction   func()      // a function that runs after the timer stops
 }
 
-// NewTimer: generate a new timer
+// NewTimer: generate a new timer, which backs off by the default pacemaker config
 // params:
-// - duration: timeout period of the timer
+// - duration: the base timeout period of the timer
 // return
 // - a new timer
 func NewTimer(duration time.Duration) *MyTimer {
+	return NewPacemakerTimer(NewPacemaker(PacemakerConfig{BaseTimeout: duration}))
+}
+
+// NewPacemakerTimer: generate a new timer whose timeout period is decided by the pacemaker
+// params:
+// - pm: the pacemaker
+// return
+// - a new timer
+func NewPacemakerTimer(pm *Pacemaker) *MyTimer {
 	return &MyTimer{
-		duration:  duration,
-		stopChan:  make(chan bool),
+		Pacemaker: pm,
 		IsStopped: true,
 	}
 }
 
+// clock: get the clock of the pacemaker config, the real clock by default
+func (t *MyTimer) clock() Clock {
+	if t.Pacemaker.Config.Clock != nil {
+		return t.Pacemaker.Config.Clock
+	}
+	return realClock{}
+}
+
 // Start: start the timer
+// note: the actions run by the clock instead of the caller, so starting or stopping the timer never blocks when it has just expired,
+// and the timer which has expired runs its own actions instead of the ones of the next start
 // params
 // - fExpire: 	function that need to be executed after the timer expires
 // - fStop: 	function that need to be executed after the timer is stopped
 func (t *MyTimer) Start(fExpire func(), fStop func()) {
-	t.timer = time.NewTimer(t.duration)
+	duration := t.Pacemaker.Timeout()
 
 	if !t.IsStopped {
-		t.stopChan <- true
+		t.stop()
 	} else {
 		t.IsStopped = false
 	}
 
 	t.ExpireAction = fExpire
 	t.StopAction = fStop
-	go func() {
-		select {
-		case <-time.After(t.duration):
-			// execute the instructions you want here
-			t.IsStopped = true
-			t.ExpireAction()
-			t.duration = t.duration * 2
-			return
-		case <-t.stopChan:
-			t.timer.Stop()
-			t.StopAction()
-			t.duration = 5 * time.Second
-			return
-		}
-	}()
+	t.stopAction = fStop
+	pm := t.Pacemaker
+	t.cancel = t.clock().AfterFunc(duration, func() {
+		// execute the instructions you want here, the next timeout backs off
+		t.IsStopped = true
+		pm.Expire()
+		fExpire()
+	})
 }
 
 // Start: stop the timer
 func (t *MyTimer) Stop() {
 	if !t.IsStopped {
-		t.stopChan <- true
+		t.stop()
 		t.IsStopped = true
 	}
 }
 
+// stop: cancel the expiry of the current start, and run its stop action if it has not expired
+func (t *MyTimer) stop() {
+	if t.cancel == nil || !t.cancel() {
+		return
+	}
+	// the view makes progress, the backoff is reset
+	pm, fStop := t.Pacemaker, t.stopAction
+	t.clock().AfterFunc(0, func() {
+		pm.Progress()
+		fStop()
+	})
+}
+
 // ReSet: start the timer but there is no need to update timeout operations and stop stops
 func (t *MyTimer) ReSet() {
 	t.Stop()
@@ -75,7 +116,7 @@ func (t *MyTimer) ReSet() {
 
 // Duration: return timeout period of the timer
 // return:
-// - the timeout period of the timer
+// - the timeout period of the next start
 func (t *MyTimer) Duration() time.Duration {
-	return t.duration
+	return t.Pacemaker.Timeout()
 }
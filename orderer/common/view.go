@@ -4,26 +4,54 @@ import "strconv"
 
 // View: the view of consensus
 type View struct {
-	ViewNumber int // the consensus at which view
-	Leader     int // the unique identity in consensus of the node
-	NodesNum   int // the number of nodes participating in the consensus
+	ViewNumber int           // the consensus at which view
+	Leader     int           // the unique identity in consensus of the node
+	NodesNum   int           // the number of nodes participating in the consensus
+	Elector    LeaderElector `json:"-"` // the policy to elect the leader of each view, round-robin if it is nil
+}
+
+// elect: elect the leader of the view by the elector
+func (v *View) elect(viewNumber int) int {
+	if v.Elector == nil {
+		return RoundRobin{}.ElectLeader(viewNumber, *v)
+	}
+	return v.Elector.ElectLeader(viewNumber, *v)
 }
 
 // NextView: go to the next view and update the view number and leader
 func (v *View) NextView() {
-	v.Leader = (v.Leader + 1) % v.NodesNum
+	v.Leader = v.elect(v.ViewNumber + 1)
 	v.ViewNumber += 1
 }
 
 // NextLeader: get the next leader number of next view
 func (v *View) NextLeader() {
-	v.Leader = (v.Leader + 1) % v.NodesNum
+	v.Leader = v.elect(v.ViewNumber + 1)
 }
 
 // RefreshLeade: refresh the leader of the view
 // nodesnum changes because the current view does not start and the original leader exits
 func (v *View) RefreshLeader() {
-	v.Leader = v.Leader % v.NodesNum
+	v.Leader = v.elect(v.ViewNumber)
+}
+
+// Restore: restore the view number, leader and nodes number of the persisted view, the elector is kept
+// params:
+// - view: the persisted view
+func (v *View) Restore(view View) {
+	v.ViewNumber, v.Leader, v.NodesNum = view.ViewNumber, view.Leader, view.NodesNum
+}
+
+// Certify: tell the elector a block is certified by a QC or committed, the leaders of the later views
+// are elected by the chain of the highest certified block
+// params:
+// - viewNumber: the view number of the block
+// - blkHash: the hash of the block
+// - parentHash: the hash of the parent block
+func (v *View) Certify(viewNumber int, blkHash []byte, parentHash []byte) {
+	if v.Elector != nil {
+		v.Elector.Certify(viewNumber, blkHash, parentHash)
+	}
 }
 
 // UpdateView: go to the specified view and update the view number and leader
@@ -49,16 +77,25 @@ func (v *View) LeaderName() string {
 	return "r_" + strconv.Itoa(v.Leader)
 }
 
+// LeaderNameOf: get the leader name of the view, such as a later view whose proposal is pipelined
+// params:
+// - viewNumber: the view number
+// return:
+// - the leader name of the view
+func (v *View) LeaderNameOf(viewNumber int) string {
+	return "r_" + strconv.Itoa(v.elect(viewNumber))
+}
+
 // LeaderName: get the leader name of the next view
 // return:
 // - the leader name of the next view
 func (v *View) NextLeaderName() string {
-	return "r_" + strconv.Itoa((v.Leader+1)%v.NodesNum)
+	return "r_" + strconv.Itoa(v.elect(v.ViewNumber+1))
 }
 
 // LeaderName: get the leader name of the last view
 // return:
 // - the leader name of the last view
 func (v *View) LastLeaderName() string {
-	return "r_" + strconv.Itoa((v.Leader+v.NodesNum-1)%v.NodesNum)
+	return "r_" + strconv.Itoa(v.elect(v.ViewNumber-1))
 }
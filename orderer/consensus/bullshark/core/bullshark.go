@@ -0,0 +1,449 @@
+/*
+Bullshark in XBC
+
+A DAG-based consensus which separates the dissemination of the requests from their ordering as Narwhal. The worker of each
+node broadcasts the requests as a batch, and the batch is available once 2f+1 nodes acknowledge it. The primary of each
+node proposes a header of the certified batches in each round, which refers to 2f+1 certificates of the last round, and the
+header with 2f+1 votes is certified as a vertex of the DAG. The DAG is ordered without any extra message as the partially
+synchronous Bullshark: the leader of each wave proposes the anchor in the first round of the wave, the anchor is committed
+once f+1 certificates of the next round refer to it, and the causal history of the committed anchors is ordered by rounds.
+
+References
+----------
+Papers: << Narwhal and Tusk: A DAG-based Mempool and Efficient BFT Consensus >> EuroSys '22
+Links: https://arxiv.org/pdf/2105.11827
+Papers: << Bullshark: DAG BFT Protocols Made Practical >> CCS '22
+Links: https://arxiv.org/pdf/2201.05677
+Papers: << Shoal: Improving DAG-BFT Latency And Robustness >> FC '24
+Links: https://arxiv.org/pdf/2306.03058
+*/
+package core
+
+import (
+	"bcrequest"
+	"blockchain"
+	bstypes "bullshark/types"
+	common "common"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"message"
+	"mgmt"
+	"os"
+	"statemachine"
+	"strconv"
+	"sync"
+	"time"
+	"tss"
+	"wire"
+)
+
+const (
+	GC_DEPTH = 50 // the rounds of the DAG kept below the last committed anchor, the older certificates are never ordered
+)
+
+// Bullshark: the core of bullshark consensus
+type Bullshark struct {
+	Round  int         // the round of the DAG which the node is at
+	View   common.View // the view is the wave of the round, whose leader proposes the anchor in the first round of the wave
+	ConsId int         // the unique identity in consensus of the node
+
+	BatchSeq     int                     // the sequence number of the last batch of the worker
+	CurBatch     *bstypes.Batch          // the batch of the worker waiting for the acknowledgements, nil if the worker waits for the requests
+	AckMsgs      []*bstypes.Msg          // the acknowledgements of the current batch
+	Batches      map[string]*StoredBatch // the batches stored by the worker, keyed by the hex digest
+	BatchCerts   []bstypes.BatchCert     // the certified batches of the worker which are not in a certified header yet
+	ProposalLock sync.Mutex              // the lock of the state changed by the requests, the messages and the round timer
+
+	ProposedRound int                                  // the round of the last header of the node, -1 if it has not proposed
+	CurHeader     *bstypes.Header                      // the header of the node waiting for the votes, nil if it is certified
+	VoteMsgs      []*bstypes.Msg                       // the votes for the current header
+	Voted         map[string]bool                      // the headers the node has voted for, keyed by the round and author, the node never votes twice for them
+	DAG           map[int]map[int]*bstypes.Certificate // the certificates of the DAG, keyed by the round and author
+	Certs         map[string]*bstypes.Certificate      // the certificates of the DAG, keyed by the hex digest
+	PendingHdrs   []*bstypes.Msg                       // the headers waiting for their parents before the node votes for them
+	PendingCerts  []*bstypes.Certificate               // the certificates waiting for their parents before they are inserted into the DAG
+	Requested     map[string]bool                      // the batches and certificates which have been fetched, keyed by the hex digest
+	HighestRound  int                                  // the highest round of the certificates in the DAG
+	TimerRound    int                                  // the round whose timer has been started
+	TimerExpired  bool                                 // the timer of the current round has expired, so the node needn't wait for the anchor
+
+	LastCommittedRound int                       // the round of the last committed anchor, -1 if none
+	Committed          map[string]int            // the rounds of the committed certificates kept in the DAG, keyed by the hex digest
+	OrderedBlks        []*blockchain.Block       // the blocks ordered by the DAG, which are stored once 2f+1 nodes sign them
+	SignMsgs           map[string][]*bstypes.Msg // the signatures of the ordered blocks, keyed by the hex block hash
+
+	IgnoreCheckCert bool // the flag ignore the effectiveness of the certificates no later than SyncRound, which are signed by the old signer
+	SyncRound       int  // the round at which the nodes join or exit
+	StartRound      int  // the first round of the DAG whose headers have no parents, above 0 if the DAG is started on the tip of another protocol
+
+	ViewTimer       common.MyTimer            // the timer of the round responsible for liveness, the node moves on without the anchor after it expires
+	BlkStore        blockchain.BlockStore     // generate and store blocks
+	SendChan        chan message.ServerMsg    // the channel listened by a node can send messages in the channel to the corresponding node on the network
+	Codec           wire.Codec                // the codec of the consensus messages sent to the replicas, the zero value is JSON
+	Logger          log.Logger                `json:"logger"` // the role of recording logs
+	ThresholdSigner *tss.Signer               `json:"Signer"` // the role responsible for threshold signatures
+	StateMachine    statemachine.StateMachine // the replicated application which executes the committed commands
+	ExecResults     []string                  // the results of the executed commands which are not replied yet
+	ExecTxs         []string                  // the transactions of the executed commands, whose clients get the results
+	ReqValidator    *bcrequest.Validator      // the validator of client requests, the batch is not checked if it is nil
+}
+
+// StoredBatch: the batch stored by the worker, with the round of the node when it is stored for the garbage collection
+type StoredBatch struct {
+	Batch bstypes.Batch // the stored batch
+	Round int           // the round of the node when the batch is stored
+}
+
+// NewBullshark: create an instance of a new consensus of bullshark
+// params:
+// - timerDuration:	timeout period of the timer
+// - consId:		the unique id of this orderer
+// - nodeNum:		node number in system
+// - path:			the path of block storage
+// - senChan:		a channel provided by an upper-layer node through which messages can be sent
+// - siger:			signer for threshold sign
+// return:
+// - a new core of bullshark
+func NewBullshark(timerDuration int, consId int, nodeNum int, path string, sendChan chan message.ServerMsg, signer *tss.Signer) *Bullshark {
+	newBullshark := Bullshark{
+		Round: 0,
+		View: common.View{
+			ViewNumber: 0,
+			NodesNum:   nodeNum,
+			Leader:     0,
+		},
+		ConsId:             consId,
+		Batches:            make(map[string]*StoredBatch),
+		ProposedRound:      -1,
+		Voted:              make(map[string]bool),
+		DAG:                make(map[int]map[int]*bstypes.Certificate),
+		Certs:              make(map[string]*bstypes.Certificate),
+		Requested:          make(map[string]bool),
+		HighestRound:       -1,
+		TimerRound:         -1,
+		LastCommittedRound: -1,
+		Committed:          make(map[string]int),
+		SignMsgs:           make(map[string][]*bstypes.Msg),
+		SyncRound:          -1,
+		BlkStore: blockchain.BlockStore{
+			Base:   64,
+			Height: 0,
+			Path:   path + "\\r_" + strconv.Itoa(consId),
+		},
+		ViewTimer:       *common.NewTimer(time.Duration(timerDuration) * time.Millisecond),
+		Logger:          *log.New(os.Stdout, "", 0),
+		SendChan:        sendChan,
+		ThresholdSigner: signer,
+		StateMachine:    statemachine.NewStateMachine(),
+	}
+
+	// set log format
+	newBullshark.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+
+	return &newBullshark
+}
+
+// HandleBMsg: the node handle the message to consensus core and send its return messages
+// params:
+// - msgJson: json of bullshark message
+func (bs *Bullshark) HandleBMsg(msgJson []byte) {
+	// convert json to message
+	var msg bstypes.Msg
+	err := wire.Unmarshal(msgJson, &msg)
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), err)
+		return
+	}
+
+	// submit the message to bullshark and get its return messages
+	bs.ProposalLock.Lock()
+	round, committed, voted, proposed := bs.Round, bs.LastCommittedRound, len(bs.Voted), bs.ProposedRound
+	msgReturnSlice := bs.RouteBMsg(&msg)
+
+	// persist the state before sending any message if the round, the commit, the vote or the proposal advanced
+	if bs.Round != round || bs.LastCommittedRound != committed || len(bs.Voted) != voted || bs.ProposedRound != proposed {
+		bs.SaveState()
+	}
+	msgReturnSlice = append(msgReturnSlice, bs.replies()...)
+	bs.ProposalLock.Unlock()
+
+	for _, msgReturn := range msgReturnSlice {
+		bs.SendSerMsg(msgReturn)
+	}
+}
+
+// RouteBMsg: the node in bullshark choose conresponding func to handle the message by message type
+// params:
+// - msg: recieved message
+// return:
+// - messages waiting to be sent
+func (bs *Bullshark) RouteBMsg(msg *bstypes.Msg) []*bstypes.Msg {
+	switch msg.MType {
+	case bstypes.BATCH:
+		return bs.HandleBatch(msg)
+	case bstypes.ACK:
+		return bs.HandleAck(msg)
+	case bstypes.HEADER:
+		return bs.HandleHeader(msg)
+	case bstypes.VOTE:
+		return bs.HandleVote(msg)
+	case bstypes.CERT:
+		return bs.HandleCert(msg)
+	case bstypes.BATCH_REQ:
+		return bs.HandleBatchReq(msg)
+	case bstypes.CERT_REQ:
+		return bs.HandleCertReq(msg)
+	case bstypes.SIGN:
+		return bs.HandleSign(msg)
+	default:
+		fmt.Println("The type of this message isn't included konw type")
+		return nil
+	}
+}
+
+// HandleReq: the worker of the node disseminates the requests as a batch
+// params:
+// - req: recieved requests
+func (bs *Bullshark) HandleReq(req []bcrequest.BCRequest) {
+	bs.ProposalLock.Lock()
+	if !bs.IsWaitingReq() {
+		bs.ProposalLock.Unlock()
+		return
+	}
+	msgReturn := bs.Disseminate(req)
+	bs.SaveState()
+	bs.ProposalLock.Unlock()
+
+	bs.SendSerMsg(msgReturn)
+}
+
+// RestartBullshark: restart bullshark to handle the request and message after the nodes join or exit,
+// the certificates before the change are accepted without the signature check, the ordered blocks are signed
+// by the new signer again, and the round timer is restarted
+func (bs *Bullshark) RestartBullshark() {
+	bs.ProposalLock.Lock()
+	bs.IgnoreCheckCert = true
+	if bs.SyncRound < bs.Round {
+		bs.SyncRound = bs.Round
+	}
+	bs.TimerRound = -1
+	bs.ensureTimer()
+	msgReturnSlice := bs.resign()
+	bs.ProposalLock.Unlock()
+
+	for _, msgReturn := range msgReturnSlice {
+		bs.SendSerMsg(msgReturn)
+	}
+}
+
+// replies: group the results of the executed commands by clients
+// return:
+// - the reply messages
+func (bs *Bullshark) replies() []*bstypes.Msg {
+	replies := bcrequest.GroupResults(bs.ExecTxs, bs.ExecResults)
+	bs.ExecResults, bs.ExecTxs = nil, nil
+	msgs := make([]*bstypes.Msg, 0, len(replies))
+	for _, reply := range replies {
+		msgs = append(msgs, &bstypes.Msg{
+			Round:    bs.Round,
+			SendNode: bs.GetNodeName(),
+			ReciNode: reply.Id,
+			Results:  reply.Results,
+		})
+	}
+	return msgs
+}
+
+// IsLeader: check whether self is the leader of the current wave, which proposes the anchor
+func (bs *Bullshark) IsLeader() bool {
+	return bs.GetNodeName() == bs.View.LeaderName()
+}
+
+// IsWaitingReq: check whether the worker of self waits for the requests, every node disseminates its own batches
+func (bs *Bullshark) IsWaitingReq() bool {
+	return bs.CurBatch == nil
+}
+
+// InitLeader: nothing to init, every node disseminates its batches and proposes its headers from round 0
+func (bs *Bullshark) InitLeader() {}
+
+// quorum: the number of nodes of a quorum, (m = 2f+1)
+func (bs *Bullshark) quorum() int {
+	return (bs.View.NodesNum-1)/3*2 + 1
+}
+
+// validity: the number of nodes of which at least one is honest, (m = f+1)
+func (bs *Bullshark) validity() int {
+	return (bs.View.NodesNum-1)/3 + 1
+}
+
+// CombineSign: combine part signatures to a complete signature
+// params:
+// - msgs: the silce of recieved messages with part signature
+// - signMsg: the byte slice signed by the messages
+// return:
+// - byte silce of the complete signature
+func (bs *Bullshark) CombineSign(msgs []*bstypes.Msg, signMsg []byte) []byte {
+	var partSigs [][]byte
+	for _, m := range msgs {
+		partSigs = append(partSigs, m.PartialSig)
+	}
+	sig, err := bs.ThresholdSigner.CombineSig(signMsg, partSigs)
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), "combine sign", err)
+		return nil
+	}
+	return sig
+}
+
+// hasSender: check whether a message from the same node has been recieved
+func hasSender(msgs []*bstypes.Msg, msg *bstypes.Msg) bool {
+	for _, m := range msgs {
+		if m.SendNode == msg.SendNode {
+			return true
+		}
+	}
+	return false
+}
+
+// key: the hex key of the digest in the maps of the batches and the certificates
+func key(digest []byte) string {
+	return hex.EncodeToString(digest)
+}
+
+// nodeName: the name of the node by its consensus id
+func nodeName(consId int) string {
+	return "r_" + strconv.Itoa(consId)
+}
+
+// Execute: execute the commands of the committed block by the state machine,
+// the results are accumulated until they are replied to the client
+// params:
+// - blk: the committed block
+func (bs *Bullshark) Execute(blk *blockchain.Block) bool {
+	if bs.StateMachine != nil {
+		results := bs.StateMachine.Apply(*blk)
+		if results != nil {
+			bs.ExecResults = append(bs.ExecResults, results...)
+			bs.ExecTxs = append(bs.ExecTxs, blk.BlkData.Trans...)
+		}
+	}
+	return true
+}
+
+// ClearCurrentRound: clears the acknowledgements, the votes and the block signatures signed by the old signer after the nodes join or exit,
+// the batch of the worker is dropped and its requests are disseminated again,
+// and the batches of the header which is not certified are proposed again in the next round
+func (bs *Bullshark) ClearCurrentRound() {
+	bs.ProposalLock.Lock()
+	defer bs.ProposalLock.Unlock()
+
+	bs.CurBatch = nil
+	bs.AckMsgs = nil
+	if bs.CurHeader != nil {
+		bs.BatchCerts = append(bs.CurHeader.Batches, bs.BatchCerts...)
+		bs.CurHeader = nil
+	}
+	bs.VoteMsgs = nil
+	bs.SignMsgs = make(map[string][]*bstypes.Msg)
+}
+
+// SendSerMsg: send the message, in fact the chan provided by the outer layer is passed to the outer layer,
+// and the outer layer sends the message
+// params:
+// - msg: message that need to be sent
+func (bs *Bullshark) SendSerMsg(msg *bstypes.Msg) {
+	msgJson, err := wire.Marshal(msg, bs.Codec)
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), err)
+		return
+	}
+	serMsg := message.ServerMsg{
+		SType:      message.ORDER,
+		SendServer: msg.SendNode,
+		ReciServer: msg.ReciNode,
+		Payload:    msgJson,
+	}
+	bs.SendChan <- serMsg
+}
+
+// GetNodeName: return self node name
+func (bs *Bullshark) GetNodeName() string {
+	return nodeName(bs.ConsId)
+}
+
+// GetLeaderName: return the leader name of the current wave
+func (bs *Bullshark) GetLeaderName() string {
+	return bs.View.LeaderName()
+}
+
+// AddSyncInfo: add local information to message for sync, include the wave/leader/last stored and ordered blocks/DAG state
+// params:
+// - msg: message which sync information needs to be added
+func (bs *Bullshark) AddSyncInfo(msg *mgmt.NodeMgmtMsg) {
+	bs.ProposalLock.Lock()
+	defer bs.ProposalLock.Unlock()
+
+	msg.ViewNumber = bs.View.ViewNumber
+	msg.Leader = bs.View.Leader
+	if bs.BlkStore.Height > 0 {
+		if blk, err := bs.BlkStore.GetStorage().ReadBlock(bs.BlkStore.Height - 1); err == nil {
+			msg.Block = append(msg.Block, *blk)
+		}
+	}
+	for _, blk := range bs.OrderedBlks {
+		msg.Block = append(msg.Block, *blk)
+	}
+	msg.BSync = bstypes.SyncState{
+		Round:          bs.Round,
+		CommittedRound: bs.LastCommittedRound,
+	}
+	for digest := range bs.Committed {
+		msg.BSync.Committed = append(msg.BSync.Committed, digest)
+	}
+}
+
+// SyncInfo: bullshark sync information from the selected sync-message,
+// the node fetches the certificates after the committed round from the others and orders them as the others do
+// params:
+// - msg: the selected sync-message with sync information
+// - leader: the leader of this wave
+func (bs *Bullshark) SyncInfo(msg *mgmt.NodeMgmtMsg, leader int) {
+	bs.ProposalLock.Lock()
+	defer bs.ProposalLock.Unlock()
+
+	// the committed blocks are not synced, so the next ordered block extends the last block of the others
+	if n := len(msg.Block); n > 0 {
+		bs.BlkStore.Height = msg.Block[n-1].BlkHdr.Height + 1
+		bs.BlkStore.PreBlkHash = msg.Block[n-1].Hash()
+	}
+	bs.OrderedBlks = nil
+	bs.SignMsgs = make(map[string][]*bstypes.Msg)
+	bs.View.UpdateView(msg.ViewNumber, leader)
+	bs.Round = msg.BSync.Round
+	bs.LastCommittedRound = msg.BSync.CommittedRound
+	bs.Committed = make(map[string]int)
+	for _, digest := range msg.BSync.Committed {
+		bs.Committed[digest] = bs.LastCommittedRound
+	}
+	bs.IgnoreCheckCert = true
+	bs.SyncRound = bs.Round
+
+	// the node proposes from the synced round, and never votes for the headers before it
+	bs.ProposedRound = bs.Round - 1
+	bs.CurHeader, bs.VoteMsgs = nil, nil
+	bs.Voted = make(map[string]bool)
+	bs.DAG = make(map[int]map[int]*bstypes.Certificate)
+	bs.Certs = make(map[string]*bstypes.Certificate)
+	bs.PendingHdrs, bs.PendingCerts = nil, nil
+	bs.Requested = make(map[string]bool)
+	bs.HighestRound = bs.Round - 1
+}
+
+// UpdateNodesNum: update the node num
+// params:
+// - nodeNum: the node number need to update
+func (bs *Bullshark) UpdateNodesNum(nodeNum int) {
+	bs.View.NodesNum = nodeNum
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"blockchain"
+	bstypes "bullshark/types"
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// anchorOf: get the anchor of the round, which is the certificate of the leader of the wave in its first round
+// params:
+// - round: the even round
+// return:
+// - the anchor, nil if it is not in the DAG
+func (bs *Bullshark) anchorOf(round int) *bstypes.Certificate {
+	leader, err := strconv.Atoi(bs.View.LeaderNameOf(round / 2)[len("r_"):])
+	if err != nil {
+		return nil
+	}
+	return bs.DAG[round][leader]
+}
+
+// votesFor: count the certificates of the next round which refer to the anchor
+func (bs *Bullshark) votesFor(anchor *bstypes.Certificate) int {
+	digest := anchor.Digest()
+	votes := 0
+	for _, cert := range bs.DAG[anchor.Header.Round+1] {
+		for _, parent := range cert.Header.Parents {
+			if bytes.Equal(parent, digest) {
+				votes++
+				break
+			}
+		}
+	}
+	return votes
+}
+
+// linked: check whether there is a path from the certificate to the lower one in the DAG
+func (bs *Bullshark) linked(from *bstypes.Certificate, to *bstypes.Certificate) bool {
+	target := key(to.Digest())
+	visited := make(map[string]bool)
+	stack := []*bstypes.Certificate{from}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if cur.Header.Round <= to.Header.Round {
+			continue
+		}
+		for _, parent := range cur.Header.Parents {
+			k := key(parent)
+			if k == target {
+				return true
+			}
+			if cert, ok := bs.Certs[k]; ok && !visited[k] {
+				visited[k] = true
+				stack = append(stack, cert)
+			}
+		}
+	}
+	return false
+}
+
+// tryCommit: commit the anchors by the DAG, no extra message is needed
+// tryCommit implement bullshark description as follow:
+// upon f+1 certificates of round r+1 refer to the anchor a of round r
+//
+//	for each anchor a' of the rounds from r−2 down to the last committed round
+//	    if there is a path from a to a': a ← a'
+//	order the causal history of a, and go on committing from the DAG
+//
+// only the lowest anchor is committed each time, so the leaders of the later waves are elected
+// by the same committed history on all nodes as shoal
+// return:
+// - the signature messages of the ordered blocks, and the messages fetching the batches of the committed anchor
+func (bs *Bullshark) tryCommit() []*bstypes.Msg {
+	var msgReturn []*bstypes.Msg
+	for {
+		var anchor *bstypes.Certificate
+		start := bs.HighestRound - 1
+		if start%2 != 0 {
+			start--
+		}
+		for r := start; r > bs.LastCommittedRound; r -= 2 {
+			if a := bs.anchorOf(r); a != nil && bs.votesFor(a) >= bs.validity() {
+				anchor = a
+				break
+			}
+		}
+		if anchor == nil {
+			return msgReturn
+		}
+		for r := anchor.Header.Round - 2; r > bs.LastCommittedRound; r -= 2 {
+			if a := bs.anchorOf(r); a != nil && bs.linked(anchor, a) {
+				anchor = a
+			}
+		}
+		msgs, ok := bs.commitAnchor(anchor)
+		msgReturn = append(msgReturn, msgs...)
+		if !ok {
+			return msgReturn
+		}
+	}
+}
+
+// causalHistory: get the certificates of the causal history of the anchor which are not committed yet,
+// sorted by their rounds and authors, the certificates GC_DEPTH rounds below the anchor are never ordered
+func (bs *Bullshark) causalHistory(anchor *bstypes.Certificate) []*bstypes.Certificate {
+	history := []*bstypes.Certificate{anchor}
+	visited := map[string]bool{key(anchor.Digest()): true}
+	for i := 0; i < len(history); i++ {
+		for _, parent := range history[i].Header.Parents {
+			k := key(parent)
+			cert, ok := bs.Certs[k]
+			if !ok || visited[k] || cert.Header.Round <= anchor.Header.Round-GC_DEPTH {
+				continue
+			}
+			visited[k] = true
+			if _, committed := bs.Committed[k]; !committed {
+				history = append(history, cert)
+			}
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].Header.Round != history[j].Header.Round {
+			return history[i].Header.Round < history[j].Header.Round
+		}
+		return history[i].Header.Author < history[j].Header.Author
+	})
+	return history
+}
+
+// commitAnchor: order the causal history of the anchor as a block and sign it, the block with no transaction is dropped
+// params:
+// - anchor: the committed anchor
+// return:
+// - the signature message of the block, or the messages fetching the batches which are not stored yet,
+// and whether the anchor is committed
+func (bs *Bullshark) commitAnchor(anchor *bstypes.Certificate) ([]*bstypes.Msg, bool) {
+	history := bs.causalHistory(anchor)
+
+	// the transactions are ordered by the certificates, and each one is ordered once in a block
+	var msgReturn []*bstypes.Msg
+	missing := false
+	txs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, cert := range history {
+		for _, bc := range cert.Header.Batches {
+			k := key(bc.Digest)
+			stored, ok := bs.Batches[k]
+			if !ok {
+				missing = true
+				if !bs.Requested[k] {
+					bs.Requested[k] = true
+					msgReturn = append(msgReturn, &bstypes.Msg{
+						MType:    bstypes.BATCH_REQ,
+						Digest:   bc.Digest,
+						SendNode: bs.GetNodeName(),
+						ReciNode: "Broadcast",
+					})
+				}
+				continue
+			}
+			for _, tx := range stored.Batch.Trans {
+				if !seen[tx] {
+					seen[tx] = true
+					txs = append(txs, tx)
+				}
+			}
+		}
+	}
+	if missing {
+		return msgReturn, false
+	}
+
+	for _, cert := range history {
+		bs.Committed[key(cert.Digest())] = cert.Header.Round
+	}
+	bs.LastCommittedRound = anchor.Header.Round
+
+	// the block is stored once 2f+1 nodes sign it, but the leaders of the later waves are elected by it from now on
+	if len(txs) > 0 {
+		wave := anchor.Header.Round / 2
+		height, preHash := bs.chainTip()
+		blk := blockchain.NewBlock(height, preHash, wave, txs)
+		blk.BlkHdr.TimeStamp = anchor.Header.TimeStamp
+		bs.OrderedBlks = append(bs.OrderedBlks, &blk)
+		bs.View.Certify(wave, blk.Hash(), blk.BlkHdr.PreBlkHash)
+		if msg := bs.signMsg(&blk); msg != nil {
+			msgReturn = append(msgReturn, msg)
+		}
+	}
+	bs.gc()
+	return msgReturn, true
+}
+
+// gc: drop the certificates, batches, votes and pending messages GC_DEPTH rounds below the last committed anchor
+func (bs *Bullshark) gc() {
+	floor := bs.floor()
+	for r, certs := range bs.DAG {
+		if r < floor {
+			for _, cert := range certs {
+				delete(bs.Certs, key(cert.Digest()))
+			}
+			delete(bs.DAG, r)
+		}
+	}
+	for k, r := range bs.Committed {
+		if r < floor {
+			delete(bs.Committed, k)
+		}
+	}
+	for k, stored := range bs.Batches {
+		if stored.Round < floor {
+			delete(bs.Batches, k)
+		}
+	}
+	for k := range bs.Voted {
+		if r, err := strconv.Atoi(k[:strings.Index(k, ":")]); err == nil && r < floor {
+			delete(bs.Voted, k)
+		}
+	}
+	pendingHdrs := bs.PendingHdrs[:0]
+	for _, msg := range bs.PendingHdrs {
+		if msg.Header.Round >= floor {
+			pendingHdrs = append(pendingHdrs, msg)
+		}
+	}
+	bs.PendingHdrs = pendingHdrs
+	pendingCerts := bs.PendingCerts[:0]
+	for _, cert := range bs.PendingCerts {
+		if cert.Header.Round >= floor {
+			pendingCerts = append(pendingCerts, cert)
+		}
+	}
+	bs.PendingCerts = pendingCerts
+}
@@ -0,0 +1,481 @@
+package core
+
+import (
+	bstypes "bullshark/types"
+	"bytes"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// hasWork: check whether the node should go on with the DAG, which has the certified batches to propose,
+// or the DAG has the batches which are not committed yet, otherwise the DAG stops in the round until new batches come
+func (bs *Bullshark) hasWork() bool {
+	if len(bs.BatchCerts) > 0 || (bs.CurHeader != nil && len(bs.CurHeader.Batches) > 0) {
+		return true
+	}
+	for r := bs.LastCommittedRound; r <= bs.HighestRound; r++ {
+		for _, cert := range bs.DAG[r] {
+			if _, ok := bs.Committed[key(cert.Digest())]; !ok && len(cert.Header.Batches) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tryPropose: the primary proposes the header of the current round
+// tryPropose implement narwhal description as follow:
+// as a primary
+// wait for 2f+1 certificates of round r−1, unless r is the first round of the DAG
+//
+//	h ← header(r, batch certificates, digests of the certificates of round r−1)
+//	broadcast Msg(header, h)
+//
+// return:
+// - the header message, nil if the node has proposed in the round or can't propose
+func (bs *Bullshark) tryPropose() []*bstypes.Msg {
+	if bs.ProposedRound >= bs.Round || !bs.hasWork() {
+		return nil
+	}
+	var parents [][]byte
+	if bs.Round > bs.StartRound {
+		certs := bs.roundCerts(bs.Round - 1)
+		if len(certs) < bs.quorum() {
+			return nil
+		}
+		for _, cert := range certs {
+			parents = append(parents, cert.Digest())
+		}
+	}
+
+	// the batches of the last header which is not certified are proposed again
+	batches := bs.BatchCerts
+	if bs.CurHeader != nil {
+		batches = append(bs.CurHeader.Batches, batches...)
+	}
+	header := bstypes.Header{
+		Author:    bs.ConsId,
+		Round:     bs.Round,
+		TimeStamp: time.Now().UnixMilli(),
+		Batches:   batches,
+		Parents:   parents,
+	}
+	bs.CurHeader = &header
+	bs.BatchCerts = nil
+	bs.VoteMsgs = nil
+	bs.ProposedRound = bs.Round
+	bs.ensureTimer()
+
+	return []*bstypes.Msg{{
+		MType:    bstypes.HEADER,
+		Round:    bs.Round,
+		Digest:   header.Digest(),
+		Header:   header,
+		SendNode: bs.GetNodeName(),
+		ReciNode: "Broadcast",
+	}}
+}
+
+// HandleHeader: the primary votes for the header once it has all the parents of the header
+// HandleHeader implement narwhal description as follow:
+// upon recieving Msg(header, h) from h.author
+//
+//	h.round is the first round of the DAG or h has 2f+1 parents of round h.round−1, all batch certificates of h are valid
+//	(h.author, h.round) has not been voted
+//	send Msg(vote, digest(h)) signed by the node to h.author
+//
+// params:
+// - msg: the header message
+// return:
+// - the vote message, or the messages fetching the parents
+func (bs *Bullshark) HandleHeader(msg *bstypes.Msg) []*bstypes.Msg {
+	h := &msg.Header
+	if msg.SendNode != nodeName(h.Author) || h.Round < bs.floor() || h.Round > bs.Round+GC_DEPTH || bs.Voted[votedKey(h.Round, h.Author)] {
+		return nil
+	}
+	if (h.Round == bs.StartRound) != (len(h.Parents) == 0) || (h.Round > bs.StartRound && len(h.Parents) < bs.quorum()) {
+		bs.Logger.Println("[Error]: header parents error", bs.GetNodeName(), h.Round, msg.SendNode)
+		return nil
+	}
+	if !bs.ignoreCheck(h.Round) {
+		for _, bc := range h.Batches {
+			if !bs.ThresholdSigner.ThresholdSignVerify(bstypes.AckByte(bc.Digest), bc.Sign) {
+				bs.Logger.Println("[Error]: batch certificate verify error", bs.GetNodeName(), h.Round, msg.SendNode)
+				return nil
+			}
+		}
+	}
+
+	// the header is voted once all its parents are in the DAG
+	missing, ok := bs.checkParents(h)
+	if !ok {
+		bs.Logger.Println("[Error]: header parents error", bs.GetNodeName(), h.Round, msg.SendNode)
+		return nil
+	}
+	if len(missing) > 0 {
+		for _, m := range bs.PendingHdrs {
+			if m.SendNode == msg.SendNode && m.Header.Round == h.Round {
+				return bs.fetchCerts(missing)
+			}
+		}
+		bs.PendingHdrs = append(bs.PendingHdrs, msg)
+		return bs.fetchCerts(missing)
+	}
+
+	bs.Voted[votedKey(h.Round, h.Author)] = true
+	voteMsg := &bstypes.Msg{
+		MType:    bstypes.VOTE,
+		Round:    h.Round,
+		Digest:   h.Digest(),
+		SendNode: bs.GetNodeName(),
+		ReciNode: msg.SendNode,
+	}
+	partSig, err := bs.ThresholdSigner.ThresholdSign(voteMsg.Message2Byte())
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), "sign vote", err)
+		return nil
+	}
+	voteMsg.PartialSig = partSig
+	return []*bstypes.Msg{voteMsg}
+}
+
+// HandleVote: the primary collects the votes for its header, and the header with 2f+1 votes is certified
+// HandleVote implement narwhal description as follow:
+// as the primary of h.author
+// wait for 2f+1 votes: V ← {v | matchingMsg(v, vote, digest(h))}
+//
+//	cert ← (h, V)
+//	broadcast Msg(cert, cert)
+//
+// params:
+// - msg: the vote message
+// return:
+// - the certificate message
+func (bs *Bullshark) HandleVote(msg *bstypes.Msg) []*bstypes.Msg {
+	if bs.CurHeader == nil || msg.Round != bs.CurHeader.Round || !bytes.Equal(msg.Digest, bs.CurHeader.Digest()) || hasSender(bs.VoteMsgs, msg) {
+		return nil
+	}
+	if _, ok := bs.ThresholdSigner.PartialSignVerify(msg.Message2Byte(), msg.PartialSig); !ok {
+		bs.Logger.Println("[Error]: vote verify error", bs.GetNodeName(), msg.Round, msg.SendNode)
+		return nil
+	}
+	bs.VoteMsgs = append(bs.VoteMsgs, msg)
+
+	// check meet the threshold conditions, (m = 2f+1)
+	if len(bs.VoteMsgs) != bs.quorum() {
+		return nil
+	}
+	sign := bs.CombineSign(bs.VoteMsgs, msg.Message2Byte())
+	if sign == nil {
+		return nil
+	}
+	cert := bstypes.Certificate{Header: *bs.CurHeader, Sign: sign}
+	bs.CurHeader = nil
+	bs.VoteMsgs = nil
+
+	return []*bstypes.Msg{{
+		MType:    bstypes.CERT,
+		Round:    cert.Header.Round,
+		Digest:   cert.Digest(),
+		Cert:     cert,
+		SendNode: bs.GetNodeName(),
+		ReciNode: "Broadcast",
+	}}
+}
+
+// HandleCert: the node inserts the certificate into the DAG once it has all the parents of the certificate,
+// then it may go to the next round, commit the anchors and propose
+// params:
+// - msg: the certificate message
+// return:
+// - the messages fetching the parents or the batches, and the header message if the node proposes
+func (bs *Bullshark) HandleCert(msg *bstypes.Msg) []*bstypes.Msg {
+	cert := msg.Cert
+	digest := cert.Digest()
+	k := key(digest)
+	delete(bs.Requested, k)
+	if _, ok := bs.Certs[k]; ok || cert.Header.Round < bs.floor() {
+		return nil
+	}
+	for _, c := range bs.PendingCerts {
+		if bytes.Equal(c.Digest(), digest) {
+			return nil
+		}
+	}
+	if !bs.ignoreCheck(cert.Header.Round) && !bs.ThresholdSigner.ThresholdSignVerify(bstypes.VoteByte(digest), cert.Sign) {
+		bs.Logger.Println("[Error]: certificate verify error", bs.GetNodeName(), cert.Header.Round, msg.SendNode)
+		return nil
+	}
+
+	missing, ok := bs.certParents(&cert)
+	if !ok {
+		bs.Logger.Println("[Error]: certificate parents error", bs.GetNodeName(), cert.Header.Round, msg.SendNode)
+		return nil
+	}
+	if len(missing) > 0 {
+		bs.PendingCerts = append(bs.PendingCerts, &cert)
+		return bs.fetchCerts(missing)
+	}
+
+	bs.insert(&cert)
+	msgReturn := bs.retryPending()
+	return append(msgReturn, bs.advance()...)
+}
+
+// HandleCertReq: the node sends the certificate to the node which fetches it
+// params:
+// - msg: the message fetching the certificate
+// return:
+// - the certificate message, nil if the certificate is not in the DAG
+func (bs *Bullshark) HandleCertReq(msg *bstypes.Msg) []*bstypes.Msg {
+	cert, ok := bs.Certs[key(msg.Digest)]
+	if !ok {
+		return nil
+	}
+	return []*bstypes.Msg{{
+		MType:    bstypes.CERT,
+		Round:    cert.Header.Round,
+		Digest:   msg.Digest,
+		Cert:     *cert,
+		SendNode: bs.GetNodeName(),
+		ReciNode: msg.SendNode,
+	}}
+}
+
+// checkParents: check whether the parents of the header are the certificates of the last round from different nodes,
+// the parents below the rounds kept in the DAG are regarded as present
+// params:
+// - h: the header
+// return:
+// - the digests of the parents which are not in the DAG, and false if a parent is not valid
+func (bs *Bullshark) checkParents(h *bstypes.Header) ([][]byte, bool) {
+	var missing [][]byte
+	authors := make(map[int]bool)
+	for _, parent := range h.Parents {
+		cert, ok := bs.Certs[key(parent)]
+		if !ok {
+			if h.Round-1 >= bs.floor() {
+				missing = append(missing, parent)
+			}
+			continue
+		}
+		if cert.Header.Round != h.Round-1 || authors[cert.Header.Author] {
+			return nil, false
+		}
+		authors[cert.Header.Author] = true
+	}
+	return missing, true
+}
+
+// certParents: check the parents of the certificate as the header, but the committed certificate needn't its parents,
+// which are committed or never ordered, so the node which recovers fetches the certificates which are not committed only
+// params:
+// - cert: the certificate
+// return:
+// - the digests of the parents which are not in the DAG, and false if a parent is not valid
+func (bs *Bullshark) certParents(cert *bstypes.Certificate) ([][]byte, bool) {
+	missing, ok := bs.checkParents(&cert.Header)
+	if _, committed := bs.Committed[key(cert.Digest())]; committed {
+		return nil, ok
+	}
+	return missing, ok
+}
+
+// fetchCerts: fetch the certificates which are not in the DAG from all nodes, each certificate is fetched once
+// until the timer of the round expires
+// params:
+// - digests: the digests of the certificates
+// return:
+// - the messages fetching the certificates
+func (bs *Bullshark) fetchCerts(digests [][]byte) []*bstypes.Msg {
+	var msgs []*bstypes.Msg
+	for _, digest := range digests {
+		if bs.Requested[key(digest)] {
+			continue
+		}
+		bs.Requested[key(digest)] = true
+		msgs = append(msgs, &bstypes.Msg{
+			MType:    bstypes.CERT_REQ,
+			Digest:   digest,
+			SendNode: bs.GetNodeName(),
+			ReciNode: "Broadcast",
+		})
+	}
+	return msgs
+}
+
+// insert: insert the certificate into the DAG
+func (bs *Bullshark) insert(cert *bstypes.Certificate) {
+	h := &cert.Header
+	if bs.DAG[h.Round] == nil {
+		bs.DAG[h.Round] = make(map[int]*bstypes.Certificate)
+	}
+	if _, ok := bs.DAG[h.Round][h.Author]; ok {
+		return
+	}
+	bs.DAG[h.Round][h.Author] = cert
+	bs.Certs[key(cert.Digest())] = cert
+	if h.Round > bs.HighestRound {
+		bs.HighestRound = h.Round
+	}
+}
+
+// retryPending: insert the pending certificates and vote for the pending headers whose parents are all in the DAG now
+// return:
+// - the vote messages
+func (bs *Bullshark) retryPending() []*bstypes.Msg {
+	for inserted := true; inserted; {
+		inserted = false
+		pending := bs.PendingCerts[:0]
+		for _, cert := range bs.PendingCerts {
+			missing, ok := bs.certParents(cert)
+			if !ok || cert.Header.Round < bs.floor() {
+				continue
+			}
+			if len(missing) > 0 {
+				pending = append(pending, cert)
+				continue
+			}
+			bs.insert(cert)
+			inserted = true
+		}
+		bs.PendingCerts = pending
+	}
+
+	var msgReturn []*bstypes.Msg
+	headers := bs.PendingHdrs
+	bs.PendingHdrs = nil
+	for _, msg := range headers {
+		if missing, ok := bs.checkParents(&msg.Header); ok && len(missing) > 0 {
+			bs.PendingHdrs = append(bs.PendingHdrs, msg)
+			continue
+		}
+		msgReturn = append(msgReturn, bs.HandleHeader(msg)...)
+	}
+	return msgReturn
+}
+
+// roundCerts: get the certificates of the round sorted by their authors
+func (bs *Bullshark) roundCerts(round int) []*bstypes.Certificate {
+	certs := make([]*bstypes.Certificate, 0, len(bs.DAG[round]))
+	for _, cert := range bs.DAG[round] {
+		certs = append(certs, cert)
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Header.Author < certs[j].Header.Author })
+	return certs
+}
+
+// advance: go to the next rounds as far as the DAG allows, then commit the anchors and propose in the round
+// return:
+// - the messages fetching the batches, and the header message if the node proposes
+func (bs *Bullshark) advance() []*bstypes.Msg {
+	for bs.canAdvance() {
+		bs.EnterRound(bs.Round + 1)
+	}
+	msgReturn := bs.tryCommit()
+	return append(msgReturn, bs.tryPropose()...)
+}
+
+// canAdvance: check whether the node can leave the current round
+// canAdvance implement bullshark description as follow:
+// wait for 2f+1 certificates of round r, and
+//
+//	r is even: the anchor of r is in the DAG, or the timer of r expires
+//	r is odd: f+1 certificates of r refer to the anchor of r−1, or 2f+1 don't, or the timer of r expires
+//
+// the node which falls behind leaves the round once f+1 certificates of round r+1 are in the DAG
+func (bs *Bullshark) canAdvance() bool {
+	r := bs.Round
+	if len(bs.DAG[r+1]) >= bs.validity() {
+		return true
+	}
+	if len(bs.DAG[r]) < bs.quorum() {
+		return false
+	}
+	if bs.TimerExpired {
+		return true
+	}
+	if r%2 == 0 {
+		return bs.anchorOf(r) != nil
+	}
+	votes := 0
+	if anchor := bs.anchorOf(r - 1); anchor != nil {
+		votes = bs.votesFor(anchor)
+	}
+	return votes >= bs.validity() || len(bs.DAG[r])-votes >= bs.quorum()
+}
+
+// EnterRound: go to the round, and the wave of the round
+// params:
+// - round: the round to enter
+func (bs *Bullshark) EnterRound(round int) {
+	bs.Round = round
+	for bs.View.ViewNumber < round/2 {
+		bs.View.NextView()
+	}
+	bs.TimerExpired = false
+	if bs.hasWork() {
+		bs.ensureTimer()
+	} else {
+		bs.ViewTimer.Stop()
+	}
+}
+
+// ensureTimer: start the timer of the current round if it has not been started
+func (bs *Bullshark) ensureTimer() {
+	if bs.TimerRound == bs.Round {
+		return
+	}
+	bs.TimerRound = bs.Round
+	round := bs.Round
+	bs.ViewTimer.Start(func() {
+		bs.RoundTimeout(round)
+	}, func() {
+	})
+}
+
+// RoundTimeout: the node stops waiting for the anchor of the round when the timer of the round expires,
+// and the batches and certificates which are not fetched yet are fetched again
+// params:
+// - round: the round whose timer expires, it is ignored if the node has left the round
+func (bs *Bullshark) RoundTimeout(round int) {
+	bs.ProposalLock.Lock()
+	if round != bs.Round {
+		bs.ProposalLock.Unlock()
+		return
+	}
+	bs.TimerExpired = true
+	bs.Requested = make(map[string]bool)
+	msgReturnSlice := bs.advance()
+	for _, cert := range bs.PendingCerts {
+		missing, _ := bs.certParents(cert)
+		msgReturnSlice = append(msgReturnSlice, bs.fetchCerts(missing)...)
+	}
+	bs.SaveState()
+	msgReturnSlice = append(msgReturnSlice, bs.replies()...)
+	bs.ProposalLock.Unlock()
+
+	for _, msgReturn := range msgReturnSlice {
+		bs.SendSerMsg(msgReturn)
+	}
+
+	// log
+	bs.Logger.Println("[TIMEOUT]:", bs.GetNodeName(), "Round:", round)
+}
+
+// ignoreCheck: check whether the signatures of the round are not checked,
+// which are signed by the old signer before the nodes join or exit
+func (bs *Bullshark) ignoreCheck(round int) bool {
+	return bs.IgnoreCheckCert && round <= bs.SyncRound
+}
+
+// floor: the lowest round kept in the DAG
+func (bs *Bullshark) floor() int {
+	return bs.LastCommittedRound - GC_DEPTH
+}
+
+// votedKey: the key of the header in the voted headers
+func votedKey(round int, author int) string {
+	return strconv.Itoa(round) + ":" + strconv.Itoa(author)
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"blockchain"
+	bstypes "bullshark/types"
+	common "common"
+	"statemachine"
+)
+
+// BullsharkState: the persisted state of bullshark, which is saved when the round, the commit, the vote or the proposal advance
+// and reloaded when the node restarts, the DAG is not persisted and the certificates are fetched from the other nodes
+type BullsharkState struct {
+	Round              int                   // the round of the DAG which the node is at
+	View               common.View           // the wave of the round
+	BatchSeq           int                   // the sequence number of the last batch of the worker
+	ProposedRound      int                   // the round of the last header of the node, the node never proposes twice in a round
+	Voted              map[string]bool       // the headers the node has voted for, the node never votes twice for them
+	LastCommittedRound int                   // the round of the last committed anchor
+	StartRound         int                   // the first round of the DAG whose headers have no parents
+	Committed          map[string]int        // the rounds of the committed certificates which may be in the causal history of later anchors
+	OrderedBlks        []*blockchain.Block   // the ordered blocks which are not stored yet
+	BlkStore           blockchain.StoreState // the state of block store
+}
+
+// SaveState: persist the round, the wave, the proposal, the votes, the committed certificates and the block store state
+func (bs *Bullshark) SaveState() {
+	err := bs.BlkStore.SaveState(&BullsharkState{
+		Round:              bs.Round,
+		View:               bs.View,
+		BatchSeq:           bs.BatchSeq,
+		ProposedRound:      bs.ProposedRound,
+		Voted:              bs.Voted,
+		LastCommittedRound: bs.LastCommittedRound,
+		StartRound:         bs.StartRound,
+		Committed:          bs.Committed,
+		OrderedBlks:        bs.OrderedBlks,
+		BlkStore:           bs.BlkStore.GetStoreState(),
+	})
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), "save state", err)
+	}
+}
+
+// Recover: restart bullshark from the local block store
+// the committed blocks are replayed to the state machine and the persisted state is reloaded.
+// the DAG is rebuilt by fetching the parents of the certificates recieved later, the batches of the worker
+// which are not committed are dropped and their requests are disseminated again
+// return:
+// - true if there is local data to recover from, and error
+func (bs *Bullshark) Recover() (bool, error) {
+	tip, err := bs.BlkStore.Recover()
+	if err != nil {
+		return false, err
+	}
+	if err := statemachine.Replay(bs.StateMachine, &bs.BlkStore); err != nil {
+		return false, err
+	}
+
+	var state BullsharkState
+	ok, err := bs.BlkStore.LoadState(&state)
+	if err != nil {
+		return false, err
+	}
+	if !ok && tip == nil {
+		return false, nil
+	}
+
+	if ok {
+		bs.Round = state.Round
+		bs.View.Restore(state.View)
+		bs.BatchSeq = state.BatchSeq
+		bs.ProposedRound = state.ProposedRound
+		bs.LastCommittedRound = state.LastCommittedRound
+		bs.StartRound = state.StartRound
+		if state.Voted != nil {
+			bs.Voted = state.Voted
+		}
+		if state.Committed != nil {
+			bs.Committed = state.Committed
+		}
+		bs.OrderedBlks = state.OrderedBlks
+		bs.BlkStore.SetStoreState(state.BlkStore)
+	}
+
+	// the node never goes back to the wave of a committed block, and the ordered blocks extend the stored ones
+	if tip != nil && bs.LastCommittedRound < tip.BlkHdr.ViewNumber*2 {
+		bs.LastCommittedRound = tip.BlkHdr.ViewNumber * 2
+	}
+	for len(bs.OrderedBlks) > 0 && bs.OrderedBlks[0].BlkHdr.Height < bs.BlkStore.Height {
+		bs.OrderedBlks = bs.OrderedBlks[1:]
+	}
+	if bs.Round <= bs.LastCommittedRound {
+		bs.Round = bs.LastCommittedRound + 1
+	}
+	for bs.View.ViewNumber < bs.Round/2 {
+		bs.View.NextView()
+	}
+
+	bs.CurBatch, bs.AckMsgs, bs.BatchCerts = nil, nil, nil
+	bs.CurHeader, bs.VoteMsgs = nil, nil
+	bs.HighestRound = bs.Round - 1
+	bs.TimerRound = -1
+	bs.TimerExpired = false
+	return true, nil
+}
+
+// Rejoin: the node signs the ordered blocks again which are not stored yet, and the leaders of the later waves
+// are elected by them after the stored blocks are replayed, the node fetches the DAG once it recieves the certificates
+// of the current round
+// return:
+// - the signature messages of the ordered blocks
+func (bs *Bullshark) Rejoin() []*bstypes.Msg {
+	bs.ProposalLock.Lock()
+	defer bs.ProposalLock.Unlock()
+
+	for _, blk := range bs.OrderedBlks {
+		bs.View.Certify(blk.BlkHdr.ViewNumber, blk.Hash(), blk.BlkHdr.PreBlkHash)
+	}
+	bs.View.RefreshLeader()
+	return bs.resign()
+}
+
+// Handover: start the DAG from the recovered round on the tip committed by another protocol,
+// there are no certificates of the last round, so the headers of the round have no parents as the ones of round 0
+func (bs *Bullshark) Handover() {
+	bs.ProposalLock.Lock()
+	defer bs.ProposalLock.Unlock()
+
+	bs.StartRound = bs.Round
+	bs.ProposedRound = bs.Round - 1
+}
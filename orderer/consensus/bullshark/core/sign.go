@@ -0,0 +1,144 @@
+package core
+
+import (
+	"blockchain"
+	bstypes "bullshark/types"
+	"bytes"
+)
+
+// chainTip: get the height and the previous block hash of the next ordered block,
+// which extends the last ordered block, or the last stored block if every ordered block is stored
+func (bs *Bullshark) chainTip() (int, []byte) {
+	if n := len(bs.OrderedBlks); n > 0 {
+		last := bs.OrderedBlks[n-1]
+		return last.BlkHdr.Height + 1, last.Hash()
+	}
+	return bs.BlkStore.Height, bs.BlkStore.PreBlkHash
+}
+
+// signMsg: sign the hash of the ordered block, the DAG certificates don't sign the block,
+// so the block is validated by the signatures of 2f+1 nodes which order the same block
+// params:
+// - blk: the ordered block
+// return:
+// - the signature message, nil if it can't be signed
+func (bs *Bullshark) signMsg(blk *blockchain.Block) *bstypes.Msg {
+	msg := &bstypes.Msg{
+		MType:    bstypes.SIGN,
+		Round:    bs.Round,
+		Height:   blk.BlkHdr.Height,
+		Digest:   blk.Hash(),
+		SendNode: bs.GetNodeName(),
+		ReciNode: "Broadcast",
+	}
+	partSig, err := bs.ThresholdSigner.ThresholdSign(msg.Message2Byte())
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), "sign block", err)
+		return nil
+	}
+	msg.PartialSig = partSig
+	return msg
+}
+
+// HandleSign: the node collects the signatures of the ordered blocks, and stores the blocks in order once they are validated,
+// the node which has stored the block already sends its validation to the node signing the block late
+// params:
+// - msg: the signature message
+// return:
+// - the validation message of the stored block
+func (bs *Bullshark) HandleSign(msg *bstypes.Msg) []*bstypes.Msg {
+	// the validation of the stored block is taken once it signs the first ordered block
+	if len(msg.Validation) > 0 {
+		if len(bs.OrderedBlks) > 0 && bytes.Equal(bs.OrderedBlks[0].Hash(), msg.Digest) && bs.ThresholdSigner.ThresholdSignVerify(msg.Message2Byte(), msg.Validation) {
+			bs.store(msg.Validation)
+			bs.storeSigned()
+		}
+		return nil
+	}
+
+	if msg.Height < bs.BlkStore.Height {
+		if msg.SendNode == bs.GetNodeName() {
+			return nil
+		}
+		blk, err := bs.BlkStore.GetStorage().ReadBlock(msg.Height)
+		if err != nil || !bytes.Equal(blk.Hash(), msg.Digest) {
+			return nil
+		}
+		return []*bstypes.Msg{{
+			MType:      bstypes.SIGN,
+			Round:      bs.Round,
+			Height:     msg.Height,
+			Digest:     msg.Digest,
+			Validation: blk.BlkHdr.Validation,
+			SendNode:   bs.GetNodeName(),
+			ReciNode:   msg.SendNode,
+		}}
+	}
+
+	k := key(msg.Digest)
+	if hasSender(bs.SignMsgs[k], msg) {
+		return nil
+	}
+	if _, ok := bs.ThresholdSigner.PartialSignVerify(msg.Message2Byte(), msg.PartialSig); !ok {
+		bs.Logger.Println("[Error]: block signature verify error", bs.GetNodeName(), msg.Height, msg.SendNode)
+		return nil
+	}
+	bs.SignMsgs[k] = append(bs.SignMsgs[k], msg)
+	bs.storeSigned()
+	return nil
+}
+
+// storeSigned: store the ordered blocks in order which are signed by 2f+1 nodes, and execute them
+func (bs *Bullshark) storeSigned() {
+	for len(bs.OrderedBlks) > 0 {
+		hash := bs.OrderedBlks[0].Hash()
+		sigs := bs.SignMsgs[key(hash)]
+
+		// check meet the threshold conditions, (m = 2f+1)
+		if len(sigs) < bs.quorum() {
+			break
+		}
+		sign := bs.CombineSign(sigs[:bs.quorum()], bstypes.BlockByte(hash))
+		if sign == nil {
+			break
+		}
+		bs.store(sign)
+	}
+
+	// drop the signatures of the stored blocks
+	for k, sigs := range bs.SignMsgs {
+		if sigs[0].Height < bs.BlkStore.Height {
+			delete(bs.SignMsgs, k)
+		}
+	}
+}
+
+// store: store the first ordered block with its validation and execute it
+// params:
+// - validation: the combined signature of the block hash
+func (bs *Bullshark) store(validation []byte) {
+	blk := bs.OrderedBlks[0]
+	bs.OrderedBlks = bs.OrderedBlks[1:]
+	blk.BlkHdr.Validation = validation
+	blk.BlkHdr.ValidationMsg = bstypes.BlockByte(blk.Hash())
+	bs.BlkStore.CurBlkHash = blk.Hash()
+	bs.BlkStore.StoreBlock(*blk)
+	// the pacemaker sets the round timeout by the commit latency in adaptive mode
+	if latency, ok := blk.BlkHdr.Latency(); ok {
+		bs.ViewTimer.Pacemaker.ObserveCommit(latency)
+	}
+	bs.Execute(blk)
+}
+
+// resign: sign the ordered blocks again, such as by the new signer after the nodes join or exit
+// return:
+// - the signature messages
+func (bs *Bullshark) resign() []*bstypes.Msg {
+	var msgReturn []*bstypes.Msg
+	for _, blk := range bs.OrderedBlks {
+		if msg := bs.signMsg(blk); msg != nil {
+			msgReturn = append(msgReturn, msg)
+		}
+	}
+	return msgReturn
+}
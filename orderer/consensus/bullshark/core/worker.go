@@ -0,0 +1,155 @@
+package core
+
+import (
+	"bcrequest"
+	bstypes "bullshark/types"
+	"bytes"
+	common "common"
+)
+
+// Disseminate: the worker broadcasts the requests as a new batch
+// Disseminate implement narwhal description as follow:
+// as a worker
+//
+//	b ← batch(seq+1, client's command)
+//	broadcast Msg(batch, b)
+//
+// params:
+// - req: the requests
+// return:
+// - the batch message
+func (bs *Bullshark) Disseminate(req []bcrequest.BCRequest) *bstypes.Msg {
+	cmds := make([][]byte, 0, len(req))
+	for i := range req {
+		cmds = append(cmds, req[i].Encode())
+	}
+	bs.BatchSeq++
+	batch := bstypes.Batch{
+		Author: bs.ConsId,
+		Seq:    bs.BatchSeq,
+		Trans:  common.TwoDimByteSlice2StringSlice(cmds),
+	}
+	bs.CurBatch = &batch
+	bs.AckMsgs = nil
+
+	return &bstypes.Msg{
+		MType:    bstypes.BATCH,
+		Round:    bs.Round,
+		Digest:   batch.Digest(),
+		Batch:    batch,
+		SendNode: bs.GetNodeName(),
+		ReciNode: "Broadcast",
+	}
+}
+
+// HandleBatch: the worker stores the batch and acknowledges it to the author,
+// the fetched batch is stored without the acknowledgement and the commit waiting for it is retried
+// HandleBatch implement narwhal description as follow:
+// upon recieving Msg(batch, b) from the worker of b.author
+//
+//	store b
+//	send Msg(ack, digest(b)) signed by the node to b.author
+//
+// params:
+// - msg: the batch message
+// return:
+// - the acknowledgement message, or the messages of the retried commit
+func (bs *Bullshark) HandleBatch(msg *bstypes.Msg) []*bstypes.Msg {
+	batch := msg.Batch
+	digest := batch.Digest()
+	k := key(digest)
+
+	// the fetched batch is certified by the header which refers to it
+	if bs.Requested[k] {
+		delete(bs.Requested, k)
+		bs.Batches[k] = &StoredBatch{Batch: batch, Round: bs.Round}
+		return bs.advance()
+	}
+	if msg.SendNode != nodeName(batch.Author) {
+		return nil
+	}
+	if bs.ReqValidator != nil {
+		if err := bs.ReqValidator.CheckTxs(batch.Trans); err != nil {
+			bs.Logger.Println("[Error]: batch check error", bs.GetNodeName(), msg.SendNode, err)
+			return nil
+		}
+	}
+	if _, ok := bs.Batches[k]; !ok {
+		bs.Batches[k] = &StoredBatch{Batch: batch, Round: bs.Round}
+	}
+
+	ackMsg := &bstypes.Msg{
+		MType:    bstypes.ACK,
+		Round:    bs.Round,
+		Digest:   digest,
+		SendNode: bs.GetNodeName(),
+		ReciNode: msg.SendNode,
+	}
+	partSig, err := bs.ThresholdSigner.ThresholdSign(ackMsg.Message2Byte())
+	if err != nil {
+		bs.Logger.Println("[ERROR]:", bs.GetNodeName(), "sign ack", err)
+		return nil
+	}
+	ackMsg.PartialSig = partSig
+	return []*bstypes.Msg{ackMsg}
+}
+
+// HandleAck: the worker collects the acknowledgements of its batch, and the batch is certified by 2f+1 of them,
+// then the primary may propose the header of the certified batch
+// HandleAck implement narwhal description as follow:
+// as the worker of b.author
+// wait for 2f+1 acks: A ← {a | matchingMsg(a, ack, digest(b))}
+//
+//	batchCert ← (digest(b), A)
+//	the primary proposes batchCert in the next header
+//
+// params:
+// - msg: the acknowledgement message
+// return:
+// - the header message if the primary proposes
+func (bs *Bullshark) HandleAck(msg *bstypes.Msg) []*bstypes.Msg {
+	if bs.CurBatch == nil || !bytes.Equal(msg.Digest, bs.CurBatch.Digest()) || hasSender(bs.AckMsgs, msg) {
+		return nil
+	}
+	if _, ok := bs.ThresholdSigner.PartialSignVerify(msg.Message2Byte(), msg.PartialSig); !ok {
+		bs.Logger.Println("[Error]: ack verify error", bs.GetNodeName(), msg.SendNode)
+		return nil
+	}
+	bs.AckMsgs = append(bs.AckMsgs, msg)
+
+	// check meet the threshold conditions, (m = 2f+1)
+	if len(bs.AckMsgs) != bs.quorum() {
+		return nil
+	}
+	sign := bs.CombineSign(bs.AckMsgs, msg.Message2Byte())
+	if sign == nil {
+		return nil
+	}
+	bs.BatchCerts = append(bs.BatchCerts, bstypes.BatchCert{Digest: msg.Digest, Sign: sign})
+	bs.CurBatch = nil
+	bs.AckMsgs = nil
+
+	// the node may have been idle, so the round is started by the certified batch
+	bs.ensureTimer()
+	return bs.tryPropose()
+}
+
+// HandleBatchReq: the worker sends the stored batch to the node which fetches it
+// params:
+// - msg: the message fetching the batch
+// return:
+// - the batch message, nil if the batch is not stored
+func (bs *Bullshark) HandleBatchReq(msg *bstypes.Msg) []*bstypes.Msg {
+	stored, ok := bs.Batches[key(msg.Digest)]
+	if !ok {
+		return nil
+	}
+	return []*bstypes.Msg{{
+		MType:    bstypes.BATCH,
+		Round:    bs.Round,
+		Digest:   msg.Digest,
+		Batch:    stored.Batch,
+		SendNode: bs.GetNodeName(),
+		ReciNode: msg.SendNode,
+	}}
+}
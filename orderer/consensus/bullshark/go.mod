@@ -0,0 +1,3 @@
+module bullshark
+
+go 1.21.5
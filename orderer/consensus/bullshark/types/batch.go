@@ -0,0 +1,36 @@
+package bstypes
+
+import (
+	"canonical"
+	"merkle"
+)
+
+// Batch: the requests disseminated by the worker of a node, they are ordered once a committed header refers to the batch
+type Batch struct {
+	Author int      // the consensus id of the node whose worker disseminates the batch
+	Seq    int      // the sequence number of the batch of the author, so the batches of the same requests get different digests
+	Trans  []string // the encoded requests
+}
+
+// Digest: get the digest of the batch by the canonical encoding
+func (b *Batch) Digest() []byte {
+	e := canonical.NewEncoder(canonical.TAG_BULLSHARK_BATCH).Int(b.Author).Int(b.Seq).Strings(b.Trans)
+	return merkle.Sum(e.Encoded())
+}
+
+// BatchCert: the availability certificate of a batch, which is combined from the acknowledgements of 2f+1 nodes,
+// so at least f+1 correct nodes have stored the batch and the batch can always be fetched
+type BatchCert struct {
+	Digest []byte // the digest of the batch
+	Sign   []byte // the combined signature of the acknowledgements
+}
+
+// AckByte: convert the acknowledgement of the batch to the signed byte slice by the canonical encoding,
+// which is the same as the availability certificate
+// params:
+// - digest: the digest of the batch
+// return:
+// - the signed byte slice
+func AckByte(digest []byte) []byte {
+	return canonical.NewEncoder(canonical.TAG_BULLSHARK_ACK).Bytes(digest).Encoded()
+}
@@ -0,0 +1,49 @@
+package bstypes
+
+import (
+	"canonical"
+	"merkle"
+)
+
+// Header: the proposal of a node in a round, which refers to the certified batches of its worker
+// and at least 2f+1 certificates of the last round
+type Header struct {
+	Author    int         // the consensus id of the node which proposes the header
+	Round     int         // the round of the DAG
+	TimeStamp int64       // the time in milliseconds when the header is proposed, the block ordered by the header as an anchor takes it
+	Batches   []BatchCert // the availability certificates of the batches of the author
+	Parents   [][]byte    // the digests of the certificates of the last round, which are empty in round 0
+}
+
+// Digest: get the digest of the header by the canonical encoding, the signatures of the batches are excluded
+// because they only prove the availability of the batches
+func (h *Header) Digest() []byte {
+	batches := make([][]byte, len(h.Batches))
+	for i := range h.Batches {
+		batches[i] = h.Batches[i].Digest
+	}
+	e := canonical.NewEncoder(canonical.TAG_BULLSHARK_HEADER).Int(h.Author).Int(h.Round).Int64(h.TimeStamp)
+	return merkle.Sum(e.BytesList(batches).BytesList(h.Parents).Encoded())
+}
+
+// Certificate: the header with the votes of 2f+1 nodes, which is a vertex of the DAG,
+// its digest is the digest of the header
+type Certificate struct {
+	Header Header // the certified header
+	Sign   []byte // the combined signature of the votes
+}
+
+// Digest: get the digest of the certificate, which is the digest of its header
+func (c *Certificate) Digest() []byte {
+	return c.Header.Digest()
+}
+
+// VoteByte: convert the vote for the header to the signed byte slice by the canonical encoding,
+// which is the same as the certificate
+// params:
+// - digest: the digest of the header
+// return:
+// - the signed byte slice
+func VoteByte(digest []byte) []byte {
+	return canonical.NewEncoder(canonical.TAG_BULLSHARK_VOTE).Bytes(digest).Encoded()
+}
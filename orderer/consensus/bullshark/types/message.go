@@ -0,0 +1,66 @@
+package bstypes
+
+import "canonical"
+
+// Msg: bullshark message
+type Msg struct {
+	MType      StateType   // this message type
+	Round      int         // the round of the header, the vote or the certificate
+	Height     int         // the height of the signed block
+	Digest     []byte      // the digest of the acknowledged batch, the voted header or the signed block, or the fetched batch or certificate
+	Batch      Batch       // the disseminated or fetched batch
+	Header     Header      // the proposed header
+	Cert       Certificate // the certificate of the header
+	PartialSig []byte      // the partial signature of the acknowledgement, the vote or the block
+	Validation []byte      // the validation of the stored block, which is sent to the node signing the block late
+
+	SendNode string // the sending node of the message
+	ReciNode string // the receiving node of the message
+
+	Results []string `json:"Results,omitempty"` // the results of executed commands which reply to the client
+}
+
+// Message2Byte: convert message to the signed byte slice by the canonical encoding,
+// the acknowledgement, the vote and the block signature are signed as the certificates or validation they form
+func (m *Msg) Message2Byte() []byte {
+	switch m.MType {
+	case ACK:
+		return AckByte(m.Digest)
+	case SIGN:
+		return BlockByte(m.Digest)
+	default:
+		return VoteByte(m.Digest)
+	}
+}
+
+// BlockByte: convert the signature of the block to the signed byte slice by the canonical encoding,
+// which is the validation message of the stored block and contains the block hash
+// params:
+// - blkHash: the hash of the block
+// return:
+// - the signed byte slice
+func BlockByte(blkHash []byte) []byte {
+	return canonical.NewEncoder(canonical.TAG_BULLSHARK_BLOCK).Bytes(blkHash).Encoded()
+}
+
+// DecodeBlockByte: get the block hash from the signed byte slice of the block, such as the validation message of the stored block
+// params:
+// - b: the bytes written by BlockByte
+// return:
+// - the hash of the block, and error
+func DecodeBlockByte(b []byte) ([]byte, error) {
+	d := canonical.NewDecoder(canonical.TAG_BULLSHARK_BLOCK, b)
+	blkHash := d.Bytes()
+	if err := d.Finish(); err != nil {
+		return nil, err
+	}
+	return blkHash, nil
+}
+
+// SyncState: the state of the DAG which the joining node syncs from the other nodes,
+// the node orders the certificates after the committed round as the others do
+type SyncState struct {
+	Round          int      // the round of the DAG which the node is at
+	CommittedRound int      // the round of the last committed anchor
+	Committed      []string // the hex digests of the committed certificates which may still be in the causal history of later anchors
+}
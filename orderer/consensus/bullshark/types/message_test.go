@@ -0,0 +1,80 @@
+package bstypes_test
+
+import (
+	bstypes "bullshark/types"
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestSignedBytes: test the golden vectors of the signed bytes of messages, the certificates are verified by the bytes signed
+// by the acknowledgements and the votes, so they must be the same, and the acknowledgement is never taken as a vote
+func TestSignedBytes(t *testing.T) {
+	digest := []byte{1, 2}
+
+	ack := bstypes.Msg{MType: bstypes.ACK, Round: 3, Digest: digest}
+	golden := "00000019646373636861696e2f62756c6c736861726b2f61636b2f7631" + "000000020102"
+	if hex.EncodeToString(ack.Message2Byte()) != golden {
+		t.Fatalf("ack: expected %s, got %x", golden, ack.Message2Byte())
+	}
+	if !bytes.Equal(bstypes.AckByte(digest), ack.Message2Byte()) {
+		t.Fatal("batch certificate signed bytes are different from the ack")
+	}
+
+	vote := bstypes.Msg{MType: bstypes.VOTE, Round: 3, Digest: digest}
+	golden = "0000001a646373636861696e2f62756c6c736861726b2f766f74652f7631" + "000000020102"
+	if hex.EncodeToString(vote.Message2Byte()) != golden {
+		t.Fatalf("vote: expected %s, got %x", golden, vote.Message2Byte())
+	}
+	if !bytes.Equal(bstypes.VoteByte(digest), vote.Message2Byte()) || bytes.Equal(vote.Message2Byte(), ack.Message2Byte()) {
+		t.Fatal("wrong vote signed bytes")
+	}
+
+	sign := bstypes.Msg{MType: bstypes.SIGN, Height: 3, Digest: digest}
+	golden = "0000001b646373636861696e2f62756c6c736861726b2f626c6f636b2f7631" + "000000020102"
+	if hex.EncodeToString(sign.Message2Byte()) != golden {
+		t.Fatalf("sign: expected %s, got %x", golden, sign.Message2Byte())
+	}
+	if !bytes.Contains(bstypes.BlockByte(digest), digest) {
+		t.Fatal("block signed bytes don't contain the block hash")
+	}
+}
+
+// TestDigest: test the digests of batches and headers, every field of the header except the signatures of the batches is hashed,
+// and the certificate takes the digest of its header
+func TestDigest(t *testing.T) {
+	batch := bstypes.Batch{Author: 1, Seq: 1, Trans: []string{"a", "b"}}
+	again := bstypes.Batch{Author: 1, Seq: 2, Trans: []string{"a", "b"}}
+	if bytes.Equal(batch.Digest(), again.Digest()) {
+		t.Fatal("sequence is not hashed")
+	}
+
+	h := bstypes.Header{
+		Author:    2,
+		Round:     4,
+		TimeStamp: 1700000000000,
+		Batches:   []bstypes.BatchCert{{Digest: batch.Digest(), Sign: []byte{1}}},
+		Parents:   [][]byte{{3}, {4}, {5}},
+	}
+	resigned := h
+	resigned.Batches = []bstypes.BatchCert{{Digest: batch.Digest(), Sign: []byte{2}}}
+	if !bytes.Equal(h.Digest(), resigned.Digest()) {
+		t.Fatal("signature of batch is hashed")
+	}
+	for _, other := range []bstypes.Header{
+		{Author: 3, Round: 4, TimeStamp: h.TimeStamp, Batches: h.Batches, Parents: h.Parents},
+		{Author: 2, Round: 5, TimeStamp: h.TimeStamp, Batches: h.Batches, Parents: h.Parents},
+		{Author: 2, Round: 4, TimeStamp: h.TimeStamp + 1, Batches: h.Batches, Parents: h.Parents},
+		{Author: 2, Round: 4, TimeStamp: h.TimeStamp, Parents: h.Parents},
+		{Author: 2, Round: 4, TimeStamp: h.TimeStamp, Batches: h.Batches, Parents: h.Parents[:2]},
+	} {
+		if bytes.Equal(h.Digest(), other.Digest()) {
+			t.Fatalf("header collision %+v", other)
+		}
+	}
+
+	cert := bstypes.Certificate{Header: h, Sign: []byte{9}}
+	if !bytes.Equal(cert.Digest(), h.Digest()) {
+		t.Fatal("certificate digest is different from the header")
+	}
+}
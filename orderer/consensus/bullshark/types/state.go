@@ -0,0 +1,39 @@
+package bstypes
+
+// StateType: bullshark message type
+type StateType uint8
+
+const (
+	BATCH     StateType = iota // the batch disseminated by the worker, or sent to the node which fetches it
+	ACK                        // the acknowledgement that the batch is stored, signed for the availability certificate
+	HEADER                     // the header of a round proposed by the primary
+	VOTE                       // the vote for a header, signed for the certificate of the header
+	CERT                       // the certificate of a header, which is a vertex of the DAG
+	BATCH_REQ                  // the request to fetch a batch which is certified but not recieved
+	CERT_REQ                   // the request to fetch a certificate whose child is recieved
+	SIGN                       // the signature of a block ordered by the DAG, or the validation of the block stored already
+)
+
+// String: convert state type to string
+func (st StateType) String() string {
+	switch st {
+	case 0:
+		return "BATCH"
+	case 1:
+		return "ACK"
+	case 2:
+		return "HEADER"
+	case 3:
+		return "VOTE"
+	case 4:
+		return "CERT"
+	case 5:
+		return "BATCH_REQ"
+	case 6:
+		return "CERT_REQ"
+	case 7:
+		return "SIGN"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,67 @@
+package bstypes
+
+import "wire"
+
+// EncodeWire: write the bullshark message to the binary codec
+func (msg *Msg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(msg.MType)).Int(msg.Round).Int(msg.Height).Bytes(msg.Digest)
+	msg.Batch.EncodeWire(w)
+	msg.Header.EncodeWire(w)
+	msg.Cert.EncodeWire(w)
+	w.Bytes(msg.PartialSig).Bytes(msg.Validation)
+	w.String(msg.SendNode).String(msg.ReciNode).Strings(msg.Results)
+}
+
+// DecodeWire: read the bullshark message from the binary codec
+func (msg *Msg) DecodeWire(r *wire.Reader) {
+	msg.MType, msg.Round, msg.Height, msg.Digest = StateType(r.Uint8()), r.Int(), r.Int(), r.Bytes()
+	msg.Batch.DecodeWire(r)
+	msg.Header.DecodeWire(r)
+	msg.Cert.DecodeWire(r)
+	msg.PartialSig, msg.Validation = r.Bytes(), r.Bytes()
+	msg.SendNode, msg.ReciNode, msg.Results = r.String(), r.String(), r.Strings()
+}
+
+// EncodeWire: write the batch to the binary codec
+func (b *Batch) EncodeWire(w *wire.Writer) {
+	w.Int(b.Author).Int(b.Seq).Strings(b.Trans)
+}
+
+// DecodeWire: read the batch from the binary codec
+func (b *Batch) DecodeWire(r *wire.Reader) {
+	b.Author, b.Seq, b.Trans = r.Int(), r.Int(), r.Strings()
+}
+
+// EncodeWire: write the header to the binary codec
+func (h *Header) EncodeWire(w *wire.Writer) {
+	w.Int(h.Author).Int(h.Round).Varint(h.TimeStamp)
+	w.Count(len(h.Batches), h.Batches == nil)
+	for _, bc := range h.Batches {
+		w.Bytes(bc.Digest).Bytes(bc.Sign)
+	}
+	w.BytesList(h.Parents)
+}
+
+// DecodeWire: read the header from the binary codec
+func (h *Header) DecodeWire(r *wire.Reader) {
+	h.Author, h.Round, h.TimeStamp = r.Int(), r.Int(), r.Varint()
+	if n, null := r.Count(); !null {
+		h.Batches = make([]BatchCert, n)
+		for i := range h.Batches {
+			h.Batches[i].Digest, h.Batches[i].Sign = r.Bytes(), r.Bytes()
+		}
+	}
+	h.Parents = r.BytesList()
+}
+
+// EncodeWire: write the certificate to the binary codec
+func (c *Certificate) EncodeWire(w *wire.Writer) {
+	c.Header.EncodeWire(w)
+	w.Bytes(c.Sign)
+}
+
+// DecodeWire: read the certificate from the binary codec
+func (c *Certificate) DecodeWire(r *wire.Reader) {
+	c.Header.DecodeWire(r)
+	c.Sign = r.Bytes()
+}
@@ -0,0 +1,393 @@
+/*
+Fast-HotStuff in XBC
+
+A chained hotstuff variant with the two-chain commit rule: a block is committed once its child proposed in the next view
+is certified, instead of the three-chain rule of chained hotstuff. The view change is quadratic as Jolteon, the timeout
+messages are broadcast to all nodes, and the leader of the next view proves the highest QC by the aggregated QC of them.
+
+References
+----------
+Papers: << Fast-HotStuff: A Fast and Robust BFT Protocol for Blockchains >> IEEE TDSC '23
+Links: https://arxiv.org/pdf/2010.11454
+Papers: << Jolteon and Ditto: Network-Adaptive Efficient Consensus with Asynchronous Fallback >> FC '22
+Links: https://arxiv.org/pdf/2106.10362
+*/
+package core
+
+import (
+	"bcrequest"
+	"blockchain"
+	common "common"
+	fhstypes "fasthotstuff/types"
+	"fmt"
+	"log"
+	"message"
+	"mgmt"
+	"os"
+	"statemachine"
+	"strconv"
+	"sync"
+	"time"
+	"tss"
+	"wire"
+)
+
+// FastHotstuff: the core of fast-hotstuff consensus
+type FastHotstuff struct {
+	CurPhase      fhstypes.StateType // the consensus at which stage
+	View          common.View        // the view consist of view number/leader number/nodes number
+	ConsId        int                // the unique identity in consensus of the node
+	LastVotedView int                // the highest view in which the node has voted or timed out, the node never votes twice in a view
+
+	HighQC       fhstypes.QC    // the highest QC the node knows, the leader extends it and it is carried by the timeout message
+	AggQC        fhstypes.AggQC // the aggregated QC with which the current view is entered after the view change, empty if it is entered by a QC
+	PendingBlks  []*PendingBlk  // the proposed blocks which are not committed yet, they are committed by the two-chain rule
+	ProposalLock sync.Mutex     // the lock of the state changed by the requests, the messages and the view timer
+
+	IgnoreCheckQC bool // the flag ignore the effectiveness of QC, the QC of the first round after the nodes join or exit is signed by the old signer
+
+	VoteMsgs    map[string][]*fhstypes.Msg // the collection of votes this node recieved as the leader of the next view, keyed by the view and block
+	TimeoutMsgs map[int][]*fhstypes.Msg    // the collection of timeout messages this node recieved, keyed by the view
+
+	ViewTimer       common.MyTimer            // the timer responsible for liveness
+	BlkStore        blockchain.BlockStore     // generate and store blocks
+	SendChan        chan message.ServerMsg    // the channel listened by a node can send messages in the channel to the corresponding node on the network
+	Codec           wire.Codec                // the codec of the consensus messages sent to the replicas, the zero value is JSON
+	Logger          log.Logger                `json:"logger"` // the role of recording logs
+	ThresholdSigner *tss.Signer               `json:"Signer"` // the role responsible for threshold signatures
+	StateMachine    statemachine.StateMachine // the replicated application which executes the committed commands
+	ExecResults     []string                  // the results of the executed commands which are not replied yet
+	ExecTxs         []string                  // the transactions of the executed commands, whose clients get the results
+	ReqValidator    *bcrequest.Validator      // the validator of client requests, the proposed block is not checked if it is nil
+}
+
+// PendingBlk: the proposed block which is not committed yet, with the QC certifying it once the QC is known
+type PendingBlk struct {
+	Block blockchain.Block // the proposed block
+	QC    fhstypes.QC      // the QC certifying the block, whose signature is nil until it is known
+}
+
+// NewFastHotstuff: create an instance of a new consensus of fast-hotstuff
+// params:
+// - timerDuration:	timeout period of the timer
+// - consId:		the unique id of this orderer
+// - nodeNum:		node number in system
+// - path:			the path of block storage
+// - senChan:		a channel provided by an upper-layer node through which messages can be sent
+// - siger:			signer for threshold sign
+// return:
+// - a new core of fast-hotstuff
+func NewFastHotstuff(timerDuration int, consId int, nodeNum int, path string, sendChan chan message.ServerMsg, signer *tss.Signer) *FastHotstuff {
+	newFastHotstuff := FastHotstuff{
+		CurPhase: fhstypes.PROPOSE,
+		View: common.View{
+			ViewNumber: 0,
+			NodesNum:   nodeNum,
+			Leader:     0,
+		},
+		ConsId:        consId,
+		LastVotedView: -1,
+		HighQC:        fhstypes.GenesisQC(),
+		PendingBlks:   make([]*PendingBlk, 0),
+		VoteMsgs:      make(map[string][]*fhstypes.Msg),
+		TimeoutMsgs:   make(map[int][]*fhstypes.Msg),
+		BlkStore: blockchain.BlockStore{
+			Base:   64,
+			Height: 0,
+			Path:   path + "\\r_" + strconv.Itoa(consId),
+		},
+		ViewTimer:       *common.NewTimer(time.Duration(timerDuration) * time.Millisecond),
+		Logger:          *log.New(os.Stdout, "", 0),
+		SendChan:        sendChan,
+		ThresholdSigner: signer,
+		StateMachine:    statemachine.NewStateMachine(),
+	}
+
+	// set log format
+	newFastHotstuff.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+
+	return &newFastHotstuff
+}
+
+// HandleFMsg: the node handle the message to consensus core and send its return messages
+// params:
+// - msgJson: json of fast-hotstuff message
+func (fhs *FastHotstuff) HandleFMsg(msgJson []byte) {
+	// convert json to message
+	var msg fhstypes.Msg
+	err := wire.Unmarshal(msgJson, &msg)
+	if err != nil {
+		fhs.Logger.Println("[ERROR]:", fhs.GetNodeName(), err)
+		return
+	}
+
+	// submit the message to fast-hotstuff and get its return messages
+	fhs.ProposalLock.Lock()
+	phase, view, votedView, highView := fhs.CurPhase, fhs.View.ViewNumber, fhs.LastVotedView, fhs.HighQC.ViewNumber
+	msgReturnSlice := fhs.RouteFMsg(&msg)
+
+	// persist the state before sending any message if the phase, the view, the vote or the highest QC advanced
+	if fhs.CurPhase != phase || fhs.View.ViewNumber != view || fhs.LastVotedView != votedView || fhs.HighQC.ViewNumber != highView {
+		fhs.SaveState()
+	}
+
+	// each client gets the results of its own requests in the committed blocks
+	replies := bcrequest.GroupResults(fhs.ExecTxs, fhs.ExecResults)
+	fhs.ExecResults, fhs.ExecTxs = nil, nil
+	fhs.ProposalLock.Unlock()
+
+	for _, msgReturn := range msgReturnSlice {
+		msgReturn.SendNode = fhs.GetNodeName()
+		fhs.SendSerMsg(msgReturn)
+	}
+	for _, reply := range replies {
+		go fhs.SendSerMsg(&fhstypes.Msg{
+			ViewNumber: view,
+			SendNode:   fhs.GetNodeName(),
+			ReciNode:   reply.Id,
+			Results:    reply.Results,
+		})
+	}
+}
+
+// RouteFMsg: the node in fast-hotstuff choose conresponding func to handle the message by message type
+// params:
+// - msg: recieved message
+// return:
+// - messages waiting to be sent
+func (fhs *FastHotstuff) RouteFMsg(msg *fhstypes.Msg) []*fhstypes.Msg {
+	switch msg.MType {
+	case fhstypes.PROPOSE:
+		return fhs.HandleProposal(msg)
+	case fhstypes.VOTE:
+		return fhs.HandleVote(msg)
+	case fhstypes.TIMEOUT:
+		return fhs.HandleTimeout(msg)
+	default:
+		fmt.Println("The type of this message isn't included konw type")
+		return nil
+	}
+}
+
+// HandleReq: the leader of fast-hotstuff proposes the requests
+// params:
+// - height: 	block height, the block extends the highest QC instead
+// - preHash: 	hash of previous block, the block extends the highest QC instead
+// - req: 		recieved requests
+func (fhs *FastHotstuff) HandleReq(height int, preHash []byte, req []bcrequest.BCRequest) {
+	fhs.ProposalLock.Lock()
+	if !fhs.IsWaitingReq() {
+		fhs.ProposalLock.Unlock()
+		return
+	}
+	msgReturn := fhs.Propose(req)
+	fhs.CurPhase = fhstypes.PROPOSE
+	fhs.SaveState()
+	fhs.ProposalLock.Unlock()
+
+	fhs.SendSerMsg(msgReturn)
+}
+
+// RestartFastHotstuff: restart fast-hotstuff to handle the request and message after the nodes join or exit,
+// the leader which has not proposed keeps waiting for the requests, and the view timer is restarted
+func (fhs *FastHotstuff) RestartFastHotstuff() {
+	fhs.ProposalLock.Lock()
+	defer fhs.ProposalLock.Unlock()
+
+	fhs.IgnoreCheckQC = true
+	if fhs.CurPhase == fhstypes.WAITING && !fhs.readyToPropose() {
+		fhs.CurPhase = fhstypes.PROPOSE
+	}
+	fhs.StartViewTimer()
+}
+
+// IsLeader: check whether self is leader
+func (fhs *FastHotstuff) IsLeader() bool {
+	return fhs.GetNodeName() == fhs.View.LeaderName()
+}
+
+// IsWaitingReq: check whether self is the leader waiting for the requests to propose
+func (fhs *FastHotstuff) IsWaitingReq() bool {
+	return fhs.CurPhase == fhstypes.WAITING && fhs.IsLeader()
+}
+
+// InitLeader: the node which is leader in view init, the first block extends the genesis QC
+func (fhs *FastHotstuff) InitLeader() {
+	fhs.CurPhase = fhstypes.WAITING
+}
+
+// CheckQC: check whether the QC certifies a block, which is the genesis QC or has the valid combined signature
+func (fhs *FastHotstuff) CheckQC(qc *fhstypes.QC) bool {
+	if qc.IsGenesis() || fhs.IgnoreCheckQC {
+		return true
+	}
+	if qc.QType != fhstypes.VOTE {
+		return false
+	}
+	return fhs.ThresholdSigner.ThresholdSignVerify(qc.QC2SignMsgByte(), qc.Sign)
+}
+
+// CheckAggQC: check whether the aggregated QC consists of the valid timeout messages of 2f+1 different nodes in the view
+// params:
+// - aggQC: the aggregated QC
+// - viewNumber: the view which times out
+// return:
+// - a boolean
+func (fhs *FastHotstuff) CheckAggQC(aggQC *fhstypes.AggQC, viewNumber int) bool {
+	if aggQC.ViewNumber != viewNumber || len(aggQC.HighViews) != len(aggQC.Sigs) {
+		return false
+	}
+	signers := make(map[int]bool)
+	for i, sig := range aggQC.Sigs {
+		index, ok := fhs.ThresholdSigner.PartialSignVerify(fhstypes.TimeoutByte(viewNumber, aggQC.HighViews[i]), sig)
+		if !ok || signers[index] {
+			return false
+		}
+		signers[index] = true
+	}
+
+	// check meet the threshold conditions, (m > 2f+1)
+	return len(signers) > (fhs.View.NodesNum-1)/3*2
+}
+
+// CombineSign: combine part signatures to a complete signature
+// params:
+// - voteMsgs: the silce of recieved messages with part signature
+// - msgSign: the message signed by the votes
+// return:
+// - byte silce of the complete signature
+func (fhs *FastHotstuff) CombineSign(voteMsgs []*fhstypes.Msg, msgSign *fhstypes.Msg) []byte {
+	// declare a two-dimensional byte slices for collecting part signatures
+	var partSigs [][]byte
+	for _, m := range voteMsgs {
+		partSigs = append(partSigs, m.PartialSig)
+	}
+
+	// combine the complete signature according to part signature and recovered messages
+	sig, err := fhs.ThresholdSigner.CombineSig(msgSign.Message2Byte(), partSigs)
+	if err != nil {
+		fhs.Logger.Println("[ERROR]:", fhs.GetNodeName(), "combine sign", err)
+		return nil
+	}
+	return sig
+}
+
+// hasSender: check whether a message from the same node has been recieved
+func hasSender(msgs []*fhstypes.Msg, msg *fhstypes.Msg) bool {
+	for _, m := range msgs {
+		if m.SendNode == msg.SendNode {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute: execute the commands of the committed block by the state machine,
+// the results are accumulated until they are replied to the client
+// params:
+// - blk: the committed block
+func (fhs *FastHotstuff) Execute(blk *blockchain.Block) bool {
+	if fhs.StateMachine != nil {
+		results := fhs.StateMachine.Apply(*blk)
+		if results != nil {
+			fhs.ExecResults = append(fhs.ExecResults, results...)
+			fhs.ExecTxs = append(fhs.ExecTxs, blk.BlkData.Trans...)
+		}
+	}
+	return true
+}
+
+// ClearCurrentRound: clears the votes and the timeout messages signed by the old signer after the nodes join or exit,
+// the pending blocks and the highest QC are kept
+func (fhs *FastHotstuff) ClearCurrentRound() {
+	fhs.ProposalLock.Lock()
+	defer fhs.ProposalLock.Unlock()
+
+	fhs.VoteMsgs = make(map[string][]*fhstypes.Msg)
+	fhs.TimeoutMsgs = make(map[int][]*fhstypes.Msg)
+}
+
+// SendSerMsg: send the message, in fact the chan provided by the outer layer is passed to the outer layer,
+// and the outer layer sends the message
+// params:
+// - msg: message that need to be sent
+func (fhs *FastHotstuff) SendSerMsg(msg *fhstypes.Msg) {
+	msgJson, err := wire.Marshal(msg, fhs.Codec)
+	if err != nil {
+		fhs.Logger.Println("[ERROR]:", fhs.GetNodeName(), err)
+		return
+	}
+	serMsg := message.ServerMsg{
+		SType:      message.ORDER,
+		SendServer: msg.SendNode,
+		ReciServer: msg.ReciNode,
+		Payload:    msgJson,
+	}
+	fhs.SendChan <- serMsg
+}
+
+// GetNodeName: return self node name
+func (fhs *FastHotstuff) GetNodeName() string {
+	return "r_" + strconv.Itoa(fhs.ConsId)
+}
+
+// GetLeaderName: return leader of current view name
+func (fhs *FastHotstuff) GetLeaderName() string {
+	return fhs.View.LeaderName()
+}
+
+// AddSyncInfo: add local information to message for sync, include view number/pending blocks/highest QC/leader
+// params:
+// - msg: message which sync information needs to be added
+func (fhs *FastHotstuff) AddSyncInfo(msg *mgmt.NodeMgmtMsg) {
+	fhs.ProposalLock.Lock()
+	defer fhs.ProposalLock.Unlock()
+
+	msg.ViewNumber = fhs.View.ViewNumber
+	for _, pending := range fhs.PendingBlks {
+		msg.Block = append(msg.Block, pending.Block)
+	}
+	msg.FJustify = fhs.HighQC
+	msg.Leader = fhs.View.Leader
+}
+
+// SyncInfo: fast-hotstuff sync information from the selected sync-message,
+// the pending blocks are committed once the later blocks are certified
+// params:
+// - msg: the selected sync-message with sync information
+// - leader: the leader of this view
+func (fhs *FastHotstuff) SyncInfo(msg *mgmt.NodeMgmtMsg, leader int) {
+	fhs.ProposalLock.Lock()
+	defer fhs.ProposalLock.Unlock()
+
+	fhs.HighQC = msg.FJustify
+	fhs.PendingBlks = make([]*PendingBlk, 0)
+
+	// the committed blocks before the pending ones are not synced, so the lowest pending block extends the local tip
+	if len(msg.Block) > 0 {
+		fhs.BlkStore.Height = msg.Block[0].BlkHdr.Height
+		fhs.BlkStore.PreBlkHash = msg.Block[0].BlkHdr.PreBlkHash
+	} else if !fhs.HighQC.IsGenesis() {
+		fhs.BlkStore.Height = fhs.HighQC.Height + 1
+		fhs.BlkStore.PreBlkHash = fhs.HighQC.HsNode.CurHash
+	}
+	for i := range msg.Block {
+		fhs.addPendingBlk(&msg.Block[i])
+	}
+	fhs.IgnoreCheckQC = true
+
+	// go to the view and wait for its proposal
+	fhs.View.UpdateView(msg.ViewNumber, leader)
+	fhs.LastVotedView = msg.ViewNumber - 1
+	fhs.AggQC = fhstypes.AggQC{}
+	fhs.CurPhase = fhstypes.PROPOSE
+	fhs.VoteMsgs = make(map[string][]*fhstypes.Msg)
+	fhs.TimeoutMsgs = make(map[int][]*fhstypes.Msg)
+}
+
+// UpdateNodesNum: update the node num
+// params:
+// - nodeNum: the node number need to update
+func (fhs *FastHotstuff) UpdateNodesNum(nodeNum int) {
+	fhs.View.NodesNum = nodeNum
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	common "common"
+	fhstypes "fasthotstuff/types"
+)
+
+// readyToPropose: check whether the leader can propose in the current view,
+// which is entered by the QC of the last view, or by the aggregated QC of the last view after the view change
+func (fhs *FastHotstuff) readyToPropose() bool {
+	if !fhs.IsLeader() {
+		return false
+	}
+	return fhs.HighQC.ViewNumber == fhs.View.ViewNumber-1 || (!fhs.AggQC.IsEmpty() && fhs.AggQC.ViewNumber == fhs.View.ViewNumber-1)
+}
+
+// Propose: the leader proposes the requests as a new block extending the highest QC
+// Propose implement fast-hotstuff description as follow:
+// as a leader
+// wait for QC of view curView−1, or AggQC of view curView−1 after the view change
+//
+//	highQC ← QC, or arg max {qc.viewNumber | qc ∈ AggQC}
+//
+// b ← createLeaf(highQC.node, client's command)
+// broadcast Msg(propose, b, highQC, AggQC)
+// params:
+// - req: the requests
+// return:
+// - the propose message
+func (fhs *FastHotstuff) Propose(req []bcrequest.BCRequest) *fhstypes.Msg {
+	cmds := make([][]byte, 0, len(req))
+	for i := range req {
+		cmds = append(cmds, req[i].Encode())
+	}
+
+	// create new block extend from the block of the highest QC
+	justify := fhs.HighQC
+	blk := blockchain.NewBlock(justify.Height+1, justify.HsNode.CurHash, fhs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(cmds))
+	fhs.BlkStore.CurProposalBlk = blk
+
+	msg := &fhstypes.Msg{
+		MType:      fhstypes.PROPOSE,
+		ViewNumber: fhs.View.ViewNumber,
+		Height:     blk.BlkHdr.Height,
+		HsNode: common.HsNode{
+			CurHash:    blk.Hash(),
+			ParentHash: justify.HsNode.CurHash,
+		},
+		Block:    blk,
+		Justify:  justify,
+		SendNode: fhs.GetNodeName(),
+		ReciNode: "Broadcast",
+	}
+
+	// the proposal after the view change carries the aggregated QC which proves the highest QC
+	if justify.ViewNumber != fhs.View.ViewNumber-1 {
+		msg.AggQC = fhs.AggQC
+	}
+	return msg
+}
+
+// HandleProposal: the replica handles the proposal and votes for it
+// HandleProposal implement fast-hotstuff description as follow:
+// as a replica
+// wait for message m from leader(m.viewNumber), m.viewNumber ≥ curView
+//
+//	m : matchingMsg(m, propose, m.viewNumber) ∧ m.viewNumber > lastVotedView
+//
+// if (m.justify.viewNumber = m.viewNumber−1) ∨ (m.justify.viewNumber ≥ max {v | v ∈ m.AggQC}) then
+//
+//	b ← m.node; b′ ← m.justify.node; b" ← b′.parent
+//	curView ← m.viewNumber
+//	send voteMsg(vote, b, ⊥) to leader(curView+1)
+//
+// if b′.parent = b" ∧ b′.viewNumber = b".viewNumber+1 then
+//
+//	execute new commands through b", respond to clients
+//
+// params:
+// - msg: the propose message
+// return:
+// - the vote message
+func (fhs *FastHotstuff) HandleProposal(msg *fhstypes.Msg) []*fhstypes.Msg {
+	if msg.SendNode != fhs.View.LeaderNameOf(msg.ViewNumber) {
+		fhs.Logger.Println("[Error]: proposal is not from the leader", fhs.GetNodeName(), msg.ViewNumber, msg.SendNode)
+		return nil
+	}
+	if !fhs.SafeProposal(msg) {
+		return nil
+	}
+
+	// the justify certifies the parent block, which may commit its parent by the two-chain rule,
+	// and the block is kept even if it is recieved after the view, since the later blocks extend it
+	fhs.UpdateQC(&msg.Justify)
+	fhs.addPendingBlk(&msg.Block)
+
+	// the node never votes twice in a view, or goes back to a lower view
+	if msg.ViewNumber < fhs.View.ViewNumber || msg.ViewNumber <= fhs.LastVotedView {
+		return nil
+	}
+
+	// enter the view of the proposal, the view timer is restarted as the view makes progress
+	if msg.ViewNumber > fhs.View.ViewNumber {
+		fhs.EnterView(msg.ViewNumber, msg.AggQC)
+	} else {
+		fhs.StartViewTimer()
+	}
+	fhs.IgnoreCheckQC = false
+
+	// sign for the block and vote for it to the leader of the next view
+	vote := &fhstypes.Msg{
+		MType:      fhstypes.VOTE,
+		ViewNumber: msg.ViewNumber,
+		Height:     msg.Block.BlkHdr.Height,
+		HsNode:     msg.HsNode,
+		ReciNode:   fhs.View.LeaderNameOf(msg.ViewNumber + 1),
+	}
+	partSig, err := fhs.ThresholdSigner.ThresholdSign(vote.Message2Byte())
+	if err != nil {
+		fhs.Logger.Println("[ERROR]:", fhs.GetNodeName(), "sign vote", err)
+		return nil
+	}
+	vote.PartialSig = partSig
+	fhs.LastVotedView = msg.ViewNumber
+	fhs.CurPhase = fhstypes.VOTE
+
+	return []*fhstypes.Msg{vote}
+}
+
+// SafeProposal: check whether the proposal is safe to vote for,
+// its justify is the QC of the last view, or is not lower than any QC in the aggregated QC of the last view,
+// and its block extends the block of the justify
+func (fhs *FastHotstuff) SafeProposal(msg *fhstypes.Msg) bool {
+	justify := &msg.Justify
+	if !fhs.CheckQC(justify) {
+		fhs.Logger.Println("[Error]: justify verify error", fhs.GetNodeName(), msg.ViewNumber)
+		return false
+	}
+	if justify.ViewNumber != msg.ViewNumber-1 && (!fhs.CheckAggQC(&msg.AggQC, msg.ViewNumber-1) || justify.ViewNumber < msg.AggQC.HighView()) {
+		fhs.Logger.Println("[Error]: aggregated QC verify error", fhs.GetNodeName(), msg.ViewNumber, justify.ViewNumber)
+		return false
+	}
+
+	// the block with an invalid or replayed request, not hashed by the canonical encoding, or whose data differs from its header is not voted
+	blk := &msg.Block
+	if !blk.BlkHdr.IsCanonical() || blk.BlkHdr.ViewNumber != msg.ViewNumber || blk.BlkHdr.Height != justify.Height+1 ||
+		!bytes.Equal(blk.BlkHdr.PreBlkHash, justify.HsNode.CurHash) {
+		fhs.Logger.Println("[Error]: block doesn't extend the justify", fhs.GetNodeName(), msg.ViewNumber, blk.BlkHdr.Height)
+		return false
+	}
+	if err := blk.VerifyBlockData(); err != nil {
+		fhs.Logger.Println("[Error]: block data verify error", fhs.GetNodeName(), msg.ViewNumber, err)
+		return false
+	}
+	if !bytes.Equal(msg.HsNode.CurHash, blk.Hash()) || !bytes.Equal(msg.HsNode.ParentHash, justify.HsNode.CurHash) {
+		fhs.Logger.Println("[Error]: node doesn't match the block", fhs.GetNodeName(), msg.ViewNumber)
+		return false
+	}
+	if fhs.ReqValidator != nil {
+		if err := fhs.ReqValidator.CheckTxs(blk.BlkData.Trans); err != nil {
+			fhs.Logger.Println("[Error]: requests verify error", fhs.GetNodeName(), msg.ViewNumber, err)
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateQC: update the highest QC and the pending block it certifies, which may commit by the two-chain rule
+// params:
+// - qc: the valid QC
+func (fhs *FastHotstuff) UpdateQC(qc *fhstypes.QC) {
+	if qc.ViewNumber > fhs.HighQC.ViewNumber {
+		fhs.HighQC = *qc
+	}
+	// the leaders of the later views are elected by the chain of the QC which the proposals extend
+	if qc.Sign != nil {
+		fhs.View.Certify(qc.ViewNumber, qc.HsNode.CurHash, qc.HsNode.ParentHash)
+	}
+	certified := fhs.getPendingBlk(qc.HsNode.CurHash)
+	if certified == nil {
+		return
+	}
+	if certified.QC.Sign == nil {
+		certified.QC = *qc
+	}
+	fhs.commitTwoChain(certified)
+}
+
+// commitTwoChain: if the certified block b′ and its parent b" are proposed in the consecutive views,
+// b" and its ancestors are committed
+// params:
+// - certified: the pending block with its QC
+func (fhs *FastHotstuff) commitTwoChain(certified *PendingBlk) {
+	parent := fhs.getPendingBlk(certified.Block.BlkHdr.PreBlkHash)
+	if parent == nil || parent.Block.BlkHdr.ViewNumber+1 != certified.Block.BlkHdr.ViewNumber {
+		return
+	}
+	fhs.Commit(parent)
+}
+
+// Commit: store the block and its uncommitted ancestors in order of height, and execute them
+// params:
+// - pending: the committed block
+func (fhs *FastHotstuff) Commit(pending *PendingBlk) {
+	// collect the blocks from the committed tip to the block
+	chain := make([]*PendingBlk, 0)
+	for cur := pending; cur != nil && cur.Block.BlkHdr.Height >= fhs.BlkStore.Height; cur = fhs.getPendingBlk(cur.Block.BlkHdr.PreBlkHash) {
+		chain = append([]*PendingBlk{cur}, chain...)
+	}
+	if len(chain) == 0 || chain[0].Block.BlkHdr.Height != fhs.BlkStore.Height || !bytes.Equal(chain[0].Block.BlkHdr.PreBlkHash, fhs.BlkStore.PreBlkHash) {
+		fhs.Logger.Println("[Error]: the committed block doesn't extend the local tip", fhs.GetNodeName(), pending.Block.BlkHdr.Height, fhs.BlkStore.Height)
+		return
+	}
+	for _, blk := range chain {
+		if blk.QC.Sign == nil {
+			fhs.Logger.Println("[Error]: the committed block has no QC", fhs.GetNodeName(), blk.Block.BlkHdr.Height)
+			return
+		}
+	}
+
+	for _, blk := range chain {
+		blk.Block.BlkHdr.Validation = blk.QC.Sign
+		blk.Block.BlkHdr.ValidationMsg = blk.QC.QC2SignMsgByte()
+		fhs.BlkStore.CurBlkHash = blk.Block.Hash()
+		fhs.BlkStore.StoreBlock(blk.Block)
+		if latency, ok := blk.Block.BlkHdr.Latency(); ok {
+			fhs.ViewTimer.Pacemaker.ObserveCommit(latency)
+		}
+		// the ancestors committed with the two-chain may be certified by the QCs of the proposals this replica missed
+		fhs.View.Certify(blk.Block.BlkHdr.ViewNumber, blk.Block.Hash(), blk.Block.BlkHdr.PreBlkHash)
+		fhs.Execute(&blk.Block)
+	}
+
+	// drop the committed blocks and the forks which conflict with them
+	pendingBlks := make([]*PendingBlk, 0, len(fhs.PendingBlks))
+	for _, blk := range fhs.PendingBlks {
+		if blk.Block.BlkHdr.Height >= fhs.BlkStore.Height {
+			pendingBlks = append(pendingBlks, blk)
+		}
+	}
+	fhs.PendingBlks = pendingBlks
+}
+
+// getPendingBlk: get the pending block by its hash
+// return:
+// - the pending block, nil if it is not found
+func (fhs *FastHotstuff) getPendingBlk(hash []byte) *PendingBlk {
+	if hash == nil {
+		return nil
+	}
+	for _, blk := range fhs.PendingBlks {
+		if bytes.Equal(blk.QC.HsNode.CurHash, hash) {
+			return blk
+		}
+	}
+	return nil
+}
+
+// addPendingBlk: add the proposed block to the pending blocks, if it is certified by the QC recieved before it,
+// the QC is attached and it may commit its parent
+func (fhs *FastHotstuff) addPendingBlk(blk *blockchain.Block) {
+	hash := blk.Hash()
+	if blk.BlkHdr.Height < fhs.BlkStore.Height || fhs.getPendingBlk(hash) != nil {
+		return
+	}
+	pending := &PendingBlk{
+		Block: *blk,
+		QC:    fhstypes.QC{QType: fhstypes.VOTE, ViewNumber: blk.BlkHdr.ViewNumber, Height: blk.BlkHdr.Height, HsNode: common.HsNode{CurHash: hash, ParentHash: blk.BlkHdr.PreBlkHash}},
+	}
+	fhs.PendingBlks = append(fhs.PendingBlks, pending)
+	if bytes.Equal(fhs.HighQC.HsNode.CurHash, hash) {
+		pending.QC = fhs.HighQC
+		fhs.commitTwoChain(pending)
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"blockchain"
+	common "common"
+	fhstypes "fasthotstuff/types"
+	"statemachine"
+)
+
+// FastHotstuffState: the persisted state of fast-hotstuff, which is saved when the phase, the view, the vote or the highest QC advance
+// and reloaded when the node restarts
+type FastHotstuffState struct {
+	CurPhase      fhstypes.StateType    // the phase of the node
+	View          common.View           // the view which the node has entered
+	LastVotedView int                   // the highest view in which the node has voted or timed out, used to avoid voting twice in a view
+	HighQC        fhstypes.QC           // the highest QC
+	PendingBlks   []*PendingBlk         // the proposed blocks which are not committed yet
+	BlkStore      blockchain.StoreState // the state of block store
+}
+
+// SaveState: persist the phase, the view, the vote, the highest QC, the pending blocks and the block store state
+func (fhs *FastHotstuff) SaveState() {
+	err := fhs.BlkStore.SaveState(&FastHotstuffState{
+		CurPhase:      fhs.CurPhase,
+		View:          fhs.View,
+		LastVotedView: fhs.LastVotedView,
+		HighQC:        fhs.HighQC,
+		PendingBlks:   fhs.PendingBlks,
+		BlkStore:      fhs.BlkStore.GetStoreState(),
+	})
+	if err != nil {
+		fhs.Logger.Println("[ERROR]:", fhs.GetNodeName(), "save state", err)
+	}
+}
+
+// Recover: restart fast-hotstuff from the local block store
+// the committed blocks are replayed to the state machine and the persisted state is reloaded.
+// the leader which has not proposed keeps waiting for the requests, the other nodes wait for the proposal
+// and move to the next view by the view timer
+// return:
+// - true if there is local data to recover from, and error
+func (fhs *FastHotstuff) Recover() (bool, error) {
+	tip, err := fhs.BlkStore.Recover()
+	if err != nil {
+		return false, err
+	}
+	if err := statemachine.Replay(fhs.StateMachine, &fhs.BlkStore); err != nil {
+		return false, err
+	}
+
+	var state FastHotstuffState
+	ok, err := fhs.BlkStore.LoadState(&state)
+	if err != nil {
+		return false, err
+	}
+	if !ok && tip == nil {
+		return false, nil
+	}
+
+	phase := fhstypes.PROPOSE
+	if ok {
+		phase = state.CurPhase
+		fhs.View.Restore(state.View)
+		fhs.LastVotedView = state.LastVotedView
+		fhs.HighQC = state.HighQC
+		fhs.PendingBlks = state.PendingBlks
+		fhs.BlkStore.SetStoreState(state.BlkStore)
+	}
+
+	// the node never goes back to the view of a committed block
+	if tip != nil && fhs.View.ViewNumber <= tip.BlkHdr.ViewNumber {
+		for fhs.View.ViewNumber <= tip.BlkHdr.ViewNumber {
+			fhs.View.NextView()
+		}
+		phase = fhstypes.PROPOSE
+	}
+	fhs.CurPhase = fhstypes.PROPOSE
+	if phase == fhstypes.WAITING && fhs.readyToPropose() {
+		fhs.CurPhase = fhstypes.WAITING
+	}
+
+	// drop the messages of view 0 and start the view timer of the recovered view
+	fhs.IgnoreCheckQC = false
+	fhs.AggQC = fhstypes.AggQC{}
+	fhs.VoteMsgs = make(map[string][]*fhstypes.Msg)
+	fhs.TimeoutMsgs = make(map[int][]*fhstypes.Msg)
+	fhs.StartViewTimer()
+	return true, nil
+}
+
+// Handover: start fast-hotstuff on the tip committed by another consensus protocol, which has no QC of this protocol,
+// so the highest QC refers to the tip without signature, and the first proposal extending it isn't checked by the QC
+func (fhs *FastHotstuff) Handover() {
+	fhs.ProposalLock.Lock()
+	defer fhs.ProposalLock.Unlock()
+
+	fhs.HighQC = fhstypes.QC{
+		QType:      fhstypes.VOTE,
+		ViewNumber: fhs.View.ViewNumber - 1,
+		Height:     fhs.BlkStore.Height - 1,
+		HsNode:     common.HsNode{CurHash: fhs.BlkStore.PreBlkHash},
+	}
+	fhs.IgnoreCheckQC = true
+	if fhs.readyToPropose() {
+		fhs.CurPhase = fhstypes.WAITING
+	}
+}
+
+// Rejoin: fast-hotstuff needn't send any message to rejoin,
+// the node waits for the proposal or the view change of the recovered view
+// return:
+// - nil
+func (fhs *FastHotstuff) Rejoin() *fhstypes.Msg {
+	return nil
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	fhstypes "fasthotstuff/types"
+	"strconv"
+	"strings"
+)
+
+// StartViewTimer: start the view timer of the current view, the view change of the view starts when it expires
+func (fhs *FastHotstuff) StartViewTimer() {
+	view := fhs.View.ViewNumber
+	fhs.ViewTimer.Start(func() {
+		fhs.StartViewChange(view)
+	}, func() {
+	})
+}
+
+// StartViewChange: start the view-change protocol when the timer of the view expires
+// StartViewChange implement fast-hotstuff description as follow:
+// upon the view timer of curView expires
+//
+//	lastVotedView ← max(lastVotedView, curView)
+//	broadcast Msg(timeout, curView, highQC) signed by the node
+//
+// params:
+// - view: the view whose timer expires, it is ignored if the node has left the view
+func (fhs *FastHotstuff) StartViewChange(view int) {
+	fhs.ProposalLock.Lock()
+	if view != fhs.View.ViewNumber {
+		fhs.ProposalLock.Unlock()
+		return
+	}
+
+	// the node never votes in the view after it times out, and the timeout message is sent again if the view keeps timing out
+	fhs.CurPhase = fhstypes.TIMEOUT
+	if fhs.LastVotedView < view {
+		fhs.LastVotedView = view
+	}
+	timeoutMsg := fhs.timeoutMsg()
+	fhs.SaveState()
+	fhs.StartViewTimer()
+	fhs.ProposalLock.Unlock()
+
+	if timeoutMsg != nil {
+		fhs.SendSerMsg(timeoutMsg)
+	}
+
+	// log
+	fhs.Logger.Println("[VIEW_CHANGE]:", fhs.GetNodeName(), "ViewNumber:", view)
+}
+
+// timeoutMsg: generate the timeout message of the current view, which carries the highest QC of the node
+// return:
+// - the timeout message, nil if it can't be signed
+func (fhs *FastHotstuff) timeoutMsg() *fhstypes.Msg {
+	msg := &fhstypes.Msg{
+		MType:      fhstypes.TIMEOUT,
+		ViewNumber: fhs.View.ViewNumber,
+		Justify:    fhs.HighQC,
+		SendNode:   fhs.GetNodeName(),
+		ReciNode:   "Broadcast",
+	}
+	partSig, err := fhs.ThresholdSigner.ThresholdSign(msg.Message2Byte())
+	if err != nil {
+		fhs.Logger.Println("[ERROR]:", fhs.GetNodeName(), "sign timeout", err)
+		return nil
+	}
+	msg.PartialSig = partSig
+	return msg
+}
+
+// HandleTimeout: the node collects the timeout messages, and enters the next view with the aggregated QC of them
+// HandleTimeout implement fast-hotstuff description as follow:
+// upon recieving Msg(timeout, v, qc) with v ≥ curView
+//
+//	highQC ← max(highQC, qc), the node which falls behind catches up the view of the QC
+//	if f+1 timeout messages of v: curView ← v and broadcast its own timeout message of v
+//	if 2f+1 timeout messages of v: AggQC ← {(qc.viewNumber, σ) | timeout messages}, curView ← v+1
+//
+// params:
+// - msg: the timeout message
+// return:
+// - the timeout message of the node if it joins the view change
+func (fhs *FastHotstuff) HandleTimeout(msg *fhstypes.Msg) []*fhstypes.Msg {
+	view := msg.ViewNumber
+	if view < fhs.View.ViewNumber || hasSender(fhs.TimeoutMsgs[view], msg) {
+		return nil
+	}
+	if _, ok := fhs.ThresholdSigner.PartialSignVerify(msg.Message2Byte(), msg.PartialSig); !ok || !fhs.CheckQC(&msg.Justify) {
+		fhs.Logger.Println("[Error]: timeout verify error", fhs.GetNodeName(), view, msg.SendNode)
+		return nil
+	}
+	fhs.TimeoutMsgs[view] = append(fhs.TimeoutMsgs[view], msg)
+
+	// the QC carried by the timeout message proves the view before it has finished
+	fhs.UpdateQC(&msg.Justify)
+	if msg.Justify.ViewNumber+1 > fhs.View.ViewNumber {
+		fhs.EnterView(msg.Justify.ViewNumber+1, fhstypes.AggQC{})
+	}
+	if view < fhs.View.ViewNumber {
+		return nil
+	}
+
+	// f+1 nodes time out in the view, so at least one honest node does, and the node joins the view change
+	var msgReturn []*fhstypes.Msg
+	if len(fhs.TimeoutMsgs[view]) > (fhs.View.NodesNum-1)/3 && (view > fhs.View.ViewNumber || fhs.CurPhase != fhstypes.TIMEOUT) {
+		if view > fhs.View.ViewNumber {
+			fhs.EnterView(view, fhstypes.AggQC{})
+		}
+		fhs.CurPhase = fhstypes.TIMEOUT
+		if fhs.LastVotedView < view {
+			fhs.LastVotedView = view
+		}
+		if timeoutMsg := fhs.timeoutMsg(); timeoutMsg != nil {
+			msgReturn = append(msgReturn, timeoutMsg)
+		}
+	}
+
+	// check meet the threshold conditions, (m = 2f+1)
+	if len(fhs.TimeoutMsgs[view]) != (fhs.View.NodesNum-1)/3*2+1 {
+		return msgReturn
+	}
+	aggQC := fhstypes.AggQC{ViewNumber: view}
+	for _, m := range fhs.TimeoutMsgs[view] {
+		aggQC.HighViews = append(aggQC.HighViews, m.Justify.ViewNumber)
+		aggQC.Sigs = append(aggQC.Sigs, m.PartialSig)
+	}
+	for v := range fhs.TimeoutMsgs {
+		if v <= view {
+			delete(fhs.TimeoutMsgs, v)
+		}
+	}
+	fhs.EnterView(view+1, aggQC)
+
+	// log
+	fhs.Logger.Println("[TIMEOUT]:", fhs.GetNodeName(), "ViewNumber:", view, "Succeed!")
+
+	return msgReturn
+}
+
+// EnterView: go to the view, the leader waits for the requests if it has the QC or the aggregated QC of the last view
+// params:
+// - viewNumber: the view to enter
+// - aggQC: the aggregated QC of the last view if the view is entered after the view change
+func (fhs *FastHotstuff) EnterView(viewNumber int, aggQC fhstypes.AggQC) {
+	for fhs.View.ViewNumber < viewNumber {
+		fhs.View.NextView()
+	}
+	fhs.AggQC = fhstypes.AggQC{}
+	if !aggQC.IsEmpty() && aggQC.ViewNumber == viewNumber-1 {
+		fhs.AggQC = aggQC
+	}
+	fhs.CurPhase = fhstypes.PROPOSE
+	if fhs.readyToPropose() {
+		fhs.CurPhase = fhstypes.WAITING
+	}
+
+	// drop the votes of the views which can't form the highest QC
+	for key := range fhs.VoteMsgs {
+		if v, err := strconv.Atoi(key[:strings.Index(key, ":")]); err == nil && v < viewNumber-1 {
+			delete(fhs.VoteMsgs, key)
+		}
+	}
+	fhs.StartViewTimer()
+}
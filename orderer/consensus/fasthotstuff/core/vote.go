@@ -0,0 +1,64 @@
+package core
+
+import (
+	fhstypes "fasthotstuff/types"
+	"strconv"
+)
+
+// HandleVote: the leader of the next view collects the votes and forms the QC, then enters the next view to propose
+// HandleVote implement fast-hotstuff description as follow:
+// as the leader of curView+1
+// wait for 2f+1 votes: V ← {v | matchingMsg(v, vote, curView)}
+//
+//	qc ← QC(V)
+//	highQC ← qc
+//	curView ← curView+1
+//
+// params:
+// - msg: the vote message
+// return:
+// - nil, the leader proposes when the requests are handled
+func (fhs *FastHotstuff) HandleVote(msg *fhstypes.Msg) []*fhstypes.Msg {
+	if fhs.View.LeaderNameOf(msg.ViewNumber+1) != fhs.GetNodeName() || msg.ViewNumber <= fhs.HighQC.ViewNumber {
+		return nil
+	}
+	if _, ok := fhs.ThresholdSigner.PartialSignVerify(msg.Message2Byte(), msg.PartialSig); !ok {
+		fhs.Logger.Println("[Error]: vote verify error", fhs.GetNodeName(), msg.ViewNumber, msg.SendNode)
+		return nil
+	}
+
+	// the votes for different blocks in the same view are collected separately
+	key := strconv.Itoa(msg.ViewNumber) + ":" + string(msg.HsNode.CurHash)
+	if hasSender(fhs.VoteMsgs[key], msg) {
+		return nil
+	}
+	fhs.VoteMsgs[key] = append(fhs.VoteMsgs[key], msg)
+
+	// check meet the threshold conditions, (m = 2f+1)
+	if len(fhs.VoteMsgs[key]) != (fhs.View.NodesNum-1)/3*2+1 {
+		return nil
+	}
+	qc := fhstypes.QC{
+		QType:      fhstypes.VOTE,
+		ViewNumber: msg.ViewNumber,
+		Height:     msg.Height,
+		HsNode:     msg.HsNode,
+	}
+	qc.Sign = fhs.CombineSign(fhs.VoteMsgs[key], msg)
+	if qc.Sign == nil {
+		return nil
+	}
+	delete(fhs.VoteMsgs, key)
+
+	// the QC certifies the block of the view, and the leader enters the next view
+	fhs.UpdateQC(&qc)
+	if msg.ViewNumber+1 > fhs.View.ViewNumber {
+		fhs.EnterView(msg.ViewNumber+1, fhstypes.AggQC{})
+	}
+	fhs.IgnoreCheckQC = false
+
+	// log
+	// fhs.Logger.Println("[QC]", fhs.GetNodeName(), "ViewNumber:", msg.ViewNumber, "Success!")
+
+	return nil
+}
@@ -0,0 +1,3 @@
+module fasthotstuff
+
+go 1.21.5
@@ -0,0 +1,45 @@
+package fhstypes
+
+import (
+	"blockchain"
+	"canonical"
+	"common"
+)
+
+// Msg: fast-hotstuff message
+type Msg struct {
+	MType      StateType        // this message type
+	ViewNumber int              // the view number when the message is sent
+	Height     int              // the height of the proposed or voted block
+	HsNode     common.HsNode    // consist of the hash corresponding to current block and with parent hash
+	Block      blockchain.Block // the proposed block in the view
+	Justify    QC               // the QC the proposal extends, or the highest QC of the node in the timeout message
+	AggQC      AggQC            // the aggregated QC of the last view, with which the proposal enters the view after the view change
+	PartialSig []byte           // the partial signature of the vote or the timeout message
+
+	SendNode string // the sending node of the message
+	ReciNode string // the receiving node of the message
+
+	Results []string `json:"Results,omitempty"` // the results of executed commands which reply to the client
+}
+
+// Message2Byte: convert message to the signed byte slice by the canonical encoding,
+// the vote is signed as the QC it forms, and the timeout message is signed with the view of its highest QC
+func (m *Msg) Message2Byte() []byte {
+	if m.MType == TIMEOUT {
+		return TimeoutByte(m.ViewNumber, m.Justify.ViewNumber)
+	}
+	e := canonical.NewEncoder(canonical.TAG_FAST_HOTSTUFF_VOTE).Uint8(uint8(m.MType)).Int(m.ViewNumber).Int(m.Height)
+	return m.HsNode.Encode(e).Encoded()
+}
+
+// TimeoutByte: convert the timeout message to the signed byte slice by the canonical encoding,
+// so the aggregated QC is verified by the views without the QCs of the nodes
+// params:
+// - viewNumber: the view which times out
+// - highQCView: the view of the highest QC of the node
+// return:
+// - the signed byte slice
+func TimeoutByte(viewNumber int, highQCView int) []byte {
+	return canonical.NewEncoder(canonical.TAG_FAST_HOTSTUFF_TIMEOUT).Int(viewNumber).Int(highQCView).Encoded()
+}
@@ -0,0 +1,48 @@
+package fhstypes_test
+
+import (
+	"bytes"
+	"common"
+	"encoding/hex"
+	fhstypes "fasthotstuff/types"
+	"testing"
+)
+
+// TestSignedBytes: test the golden vectors of the signed bytes of messages, the QC is verified by the bytes signed by the votes,
+// so they must be the same, and the timeout messages of different views or highest QCs get different bytes
+func TestSignedBytes(t *testing.T) {
+	node := common.HsNode{CurHash: []byte{1, 2}, ParentHash: []byte{3}}
+
+	m := fhstypes.Msg{MType: fhstypes.VOTE, ViewNumber: 257, Height: 3, HsNode: node}
+	golden := "0000001d646373636861696e2f66617374686f7473747566662f766f74652f7631" + "02" + "0000000000000101" + "0000000000000003" + "00000002010200000001" + "03"
+	if hex.EncodeToString(m.Message2Byte()) != golden {
+		t.Fatalf("message: expected %s, got %x", golden, m.Message2Byte())
+	}
+	qc := fhstypes.QC{QType: m.MType, ViewNumber: m.ViewNumber, Height: m.Height, HsNode: node}
+	if !bytes.Equal(qc.QC2SignMsgByte(), m.Message2Byte()) {
+		t.Fatal("QC signed bytes are different from the vote")
+	}
+	higher := m
+	higher.Height = 4
+	if bytes.Equal(higher.Message2Byte(), m.Message2Byte()) {
+		t.Fatal("height is not signed")
+	}
+
+	timeout := fhstypes.Msg{MType: fhstypes.TIMEOUT, ViewNumber: 257, Justify: fhstypes.QC{ViewNumber: 255}, HsNode: node}
+	golden = "00000020646373636861696e2f66617374686f7473747566662f74696d656f75742f7631" + "0000000000000101" + "00000000000000ff"
+	if hex.EncodeToString(timeout.Message2Byte()) != golden {
+		t.Fatalf("timeout: expected %s, got %x", golden, timeout.Message2Byte())
+	}
+	if bytes.Equal(fhstypes.TimeoutByte(257, 255), fhstypes.TimeoutByte(257, 256)) || bytes.Equal(fhstypes.TimeoutByte(1, 255), fhstypes.TimeoutByte(257, 255)) {
+		t.Fatal("timeout collision")
+	}
+
+	agg := fhstypes.AggQC{ViewNumber: 257, HighViews: []int{254, 255, -1}, Sigs: [][]byte{{1}, {2}, {3}}}
+	if agg.IsEmpty() || agg.HighView() != 255 {
+		t.Fatal("wrong aggregated QC", agg.HighView())
+	}
+	genesis := fhstypes.GenesisQC()
+	if !genesis.IsGenesis() || qc.IsGenesis() {
+		t.Fatal("wrong genesis QC")
+	}
+}
@@ -0,0 +1,71 @@
+package fhstypes
+
+import (
+	"canonical"
+	"common"
+)
+
+// QC: the qurom certification for a block, which is combined from the votes of 2f+1 nodes
+type QC struct {
+	QType      StateType     // the QC type, which is the vote in fast-hotstuff
+	ViewNumber int           // the view number when the block was proposed
+	Height     int           // the height of block corresponding to the QC
+	HsNode     common.HsNode // the hash of block corresponding to the QC and last block
+	Sign       []byte        // the combined signature
+}
+
+// GenesisQC: the QC which the first block extends, it certifies no block and has no signature
+func GenesisQC() QC {
+	return QC{QType: VOTE, ViewNumber: -1, Height: -1}
+}
+
+// IsGenesis: check whether the QC is the genesis QC
+func (q *QC) IsGenesis() bool {
+	return q.ViewNumber == -1 && q.Height == -1 && q.HsNode.CurHash == nil && q.Sign == nil
+}
+
+// QC2SignMsgByte: convert QC to byte slice, which is the same as the voted message
+func (q *QC) QC2SignMsgByte() []byte {
+	e := canonical.NewEncoder(canonical.TAG_FAST_HOTSTUFF_VOTE).Uint8(uint8(q.QType)).Int(q.ViewNumber).Int(q.Height)
+	return q.HsNode.Encode(e).Encoded()
+}
+
+// DecodeQC: decode the signed message of QC, such as the validation message of the committed block
+// params:
+// - b: the bytes written by QC2SignMsgByte
+// return:
+// - the QC without signature, and error
+func DecodeQC(b []byte) (*QC, error) {
+	q := &QC{}
+	d := canonical.NewDecoder(canonical.TAG_FAST_HOTSTUFF_VOTE, b)
+	q.QType, q.ViewNumber, q.Height = StateType(d.Uint8()), d.Int(), d.Int()
+	if err := q.HsNode.Decode(d).Finish(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// AggQC: the aggregated QC of the timeout messages of 2f+1 nodes in a view, which proves the view of the highest QC of them,
+// so the leader of the next view extends a block which is not lower than any block the nodes may have committed
+// note: the partial signatures are of different messages, so they are kept instead of being combined
+type AggQC struct {
+	ViewNumber int      // the view which times out
+	HighViews  []int    // the view of the highest QC of each node
+	Sigs       [][]byte // the partial signature of each node on the view and the view of its highest QC
+}
+
+// IsEmpty: check whether the aggregated QC is empty, such as the view is entered by a QC
+func (a *AggQC) IsEmpty() bool {
+	return len(a.Sigs) == 0
+}
+
+// HighView: get the view of the highest QC in the aggregated QC
+func (a *AggQC) HighView() int {
+	high := -1
+	for _, view := range a.HighViews {
+		if view > high {
+			high = view
+		}
+	}
+	return high
+}
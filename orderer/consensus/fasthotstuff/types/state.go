@@ -0,0 +1,27 @@
+package fhstypes
+
+// StateType: fast-hotstuff protocol phase state, message type, QC type
+type StateType uint8
+
+const (
+	WAITING StateType = iota // the leader waits for the requests to propose
+	PROPOSE                  // the proposal, and the phase that the node waits for the proposal of the view
+	VOTE                     // the vote, and the phase that the node has voted in the view
+	TIMEOUT                  // the timeout message, and the phase that the node has timed out in the view
+)
+
+// String: convert state type to string
+func (st StateType) String() string {
+	switch st {
+	case 0:
+		return "WAITING"
+	case 1:
+		return "PROPOSE"
+	case 2:
+		return "VOTE"
+	case 3:
+		return "TIMEOUT"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,61 @@
+package fhstypes
+
+import "wire"
+
+// EncodeWire: write the fast-hotstuff message to the binary codec
+func (msg *Msg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(msg.MType)).Int(msg.ViewNumber).Int(msg.Height)
+	msg.HsNode.EncodeWire(w)
+	msg.Block.EncodeWire(w)
+	msg.Justify.EncodeWire(w)
+	msg.AggQC.EncodeWire(w)
+	w.Bytes(msg.PartialSig)
+	w.String(msg.SendNode).String(msg.ReciNode).Strings(msg.Results)
+}
+
+// DecodeWire: read the fast-hotstuff message from the binary codec
+func (msg *Msg) DecodeWire(r *wire.Reader) {
+	msg.MType, msg.ViewNumber, msg.Height = StateType(r.Uint8()), r.Int(), r.Int()
+	msg.HsNode.DecodeWire(r)
+	msg.Block.DecodeWire(r)
+	msg.Justify.DecodeWire(r)
+	msg.AggQC.DecodeWire(r)
+	msg.PartialSig = r.Bytes()
+	msg.SendNode, msg.ReciNode, msg.Results = r.String(), r.String(), r.Strings()
+}
+
+// EncodeWire: write the QC to the binary codec
+func (qc *QC) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(qc.QType)).Int(qc.ViewNumber).Int(qc.Height)
+	qc.HsNode.EncodeWire(w)
+	w.Bytes(qc.Sign)
+}
+
+// DecodeWire: read the QC from the binary codec
+func (qc *QC) DecodeWire(r *wire.Reader) {
+	qc.QType, qc.ViewNumber, qc.Height = StateType(r.Uint8()), r.Int(), r.Int()
+	qc.HsNode.DecodeWire(r)
+	qc.Sign = r.Bytes()
+}
+
+// EncodeWire: write the aggregated QC to the binary codec
+func (a *AggQC) EncodeWire(w *wire.Writer) {
+	w.Int(a.ViewNumber)
+	w.Count(len(a.HighViews), a.HighViews == nil)
+	for _, view := range a.HighViews {
+		w.Int(view)
+	}
+	w.BytesList(a.Sigs)
+}
+
+// DecodeWire: read the aggregated QC from the binary codec
+func (a *AggQC) DecodeWire(r *wire.Reader) {
+	a.ViewNumber = r.Int()
+	if n, null := r.Count(); !null {
+		a.HighViews = make([]int, n)
+		for i := range a.HighViews {
+			a.HighViews[i] = r.Int()
+		}
+	}
+	a.Sigs = r.BytesList()
+}
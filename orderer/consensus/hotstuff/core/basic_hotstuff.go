@@ -13,7 +13,6 @@ import (
 	"blockchain"
 	"bytes"
 	common "common"
-	"encoding/json"
 	"fmt"
 	hstypes "hotstuff/types"
 	"log"
@@ -21,10 +20,12 @@ import (
 	"message"
 	"mgmt"
 	"os"
+	"statemachine"
 	"strconv"
 	"sync"
 	"time"
 	"tss"
+	"wire"
 )
 
 // BCHotstuff: the core of basic hotstuff consensus
@@ -37,6 +38,9 @@ type BCHotstuff struct {
 	PrepareQC hstypes.QC    // a quorum certificate storing the highest QC for which a replica voted pre-commit
 	LockedQC  hstypes.QC    // a locked quorum certificate storing the highest QC for which a replica voted commit
 
+	VotedView  int               // the last view in which the node voted, it is persisted before the vote is sent
+	VotedPhase hstypes.StateType // the phase of the last vote
+
 	LastProposal hstypes.Proposal // last proposal of this view
 	CurProposal  hstypes.Proposal // current proposal of this view
 	ProposalLock sync.Mutex       // generate proposal lock
@@ -47,16 +51,29 @@ type BCHotstuff struct {
 	LastRoundMsg   []*hstypes.Msg // the collection of messages sent by this node in the last view
 	CurRoundMsg    []*hstypes.Msg // the collection of messages sent by this node in the current view
 	NewViewMsgs    []*hstypes.Msg // the collection of new-view messages this node recieved
+	LaterViewMsgs  []*hstypes.Msg // the new-view messages of the later views recieved before the node enters them
+	LaterPrepare   *hstypes.Msg   // the prepare message of a later view recieved before the node enters it
 	PrepareVotes   []*hstypes.Msg // the collection of prepare vote messages this node recieved
 	PreCommitVotes []*hstypes.Msg // the collection of pre-commit vote messages this node recieved
 	CommitVotes    []*hstypes.Msg // the collection of commit vote messages this node recieved
 
-	ViewTimer       common.MyTimer         // the timer responsible for liveness
-	BlkStore        blockchain.BlockStore  // the unit to generate and store blocks
-	ForwardChan     chan []byte            // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
-	SendChan        chan message.ServerMsg // the channel listened by a node can send messages in the channel to the corresponding node on the network
-	Logger          log.Logger             `json:"logger"` // the role of recording logs
-	ThresholdSigner *tss.Signer            `json:"Signer"` // the role responsible for threshold signatures
+	ViewTimer       common.MyTimer            // the timer responsible for liveness
+	BlkStore        blockchain.BlockStore     // the unit to generate and store blocks
+	ForwardChan     chan []byte               // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
+	SendChan        chan message.ServerMsg    // the channel listened by a node can send messages in the channel to the corresponding node on the network
+	Codec           wire.Codec                // the codec of the consensus messages sent to the replicas, the zero value is JSON
+	Logger          log.Logger                `json:"logger"` // the role of recording logs
+	ThresholdSigner *tss.Signer               `json:"Signer"` // the role responsible for threshold signatures
+	StateMachine    statemachine.StateMachine // the replicated application which executes the committed commands
+	ExecResults     []string                  // the results of the last executed commands
+	ExecTxs         []string                  // the transactions of the last executed commands, whose clients get the results
+	ReqValidator    *bcrequest.Validator      // the validator of client requests, the proposed block is not checked if it is nil
+
+	Window         int            // the max number of proposals in flight, the leader of the next view proposes before the decide if it is more than 1
+	PipelineView   int            // the next view which the pipelined messages belong to
+	NextNewViews   []*hstypes.Msg // the new-view messages of the next view sent once the current view is prepared
+	NextPrepare    *hstypes.Msg   // the prepare message of the next view proposed by this node before the current view is decided
+	PipelineBuffer []*hstypes.Msg // the messages of the next view which wait for the current view to be decided
 }
 
 // NewBCHotstuff: create an instance of a new consensus of basic hotstuff
@@ -106,6 +123,7 @@ func NewBCHotstuff(timerDuration int, consId int, nodeNum int, path string, send
 			PreBlkHash: merkle.EmptyHash(),
 			CurBlkHash: merkle.EmptyHash(),
 		},
+		VotedView:       -1,
 		LastRoundMsg:    []*hstypes.Msg{{ViewNumber: -1}},
 		CurRoundMsg:     make([]*hstypes.Msg, 0),
 		NewViewMsgs:     make([]*hstypes.Msg, 0),
@@ -116,6 +134,8 @@ func NewBCHotstuff(timerDuration int, consId int, nodeNum int, path string, send
 		Logger:          *log.New(os.Stdout, "", 0),
 		SendChan:        sendChan,
 		ThresholdSigner: signer,
+		StateMachine:    statemachine.NewStateMachine(),
+		Window:          1,
 	}
 	// set log format
 	newBCHotstuff.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
@@ -126,16 +146,37 @@ func NewBCHotstuff(timerDuration int, consId int, nodeNum int, path string, send
 // HandleBMsg: the node handle the message to consensus core and send its return message
 // params:
 // - msgJson: json of basic-hostuff message
-func (bhs *BCHotstuff) HandleBMsg(msgJson []byte, pk []byte) {
+func (bhs *BCHotstuff) HandleBMsg(msgJson []byte) {
 	// convert json to basic-hotstuff message
 	var msg hstypes.Msg
-	err := json.Unmarshal(msgJson, &msg)
+	err := wire.Unmarshal(msgJson, &msg)
 	if err != nil {
 		bhs.Logger.Println("[ERROR]:", bhs.GetNodeName(), err)
 		return
 	}
+	// the message of the next view waits for the current view to be decided if the proposals are pipelined
+	if bhs.Pipelined() && msg.ViewNumber == bhs.View.ViewNumber+1 {
+		bhs.HandlePipelinedMsg(&msg)
+		return
+	}
+
 	// submit the message to basic hotstuff and get its return messages
-	msgReturn := bhs.RouteBMsg(&msg, pk)
+	view, lockedView, preparedView := bhs.View.ViewNumber, bhs.LockedQC.ViewNumber, bhs.PrepareQC.ViewNumber
+	votedView, votedPhase := bhs.VotedView, bhs.VotedPhase
+	msgReturn := bhs.RouteBMsg(&msg)
+	if msgReturn != nil && IsVote(msgReturn.MType) {
+		bhs.VotedView, bhs.VotedPhase = msgReturn.ViewNumber, msgReturn.MType
+	}
+
+	// persist the state before sending any message if the view, the lock or the last vote advanced,
+	// so that the node never votes twice in a view after restarting
+	if bhs.View.ViewNumber != view || bhs.LockedQC.ViewNumber != lockedView || bhs.VotedView != votedView || bhs.VotedPhase != votedPhase {
+		bhs.SaveState()
+	}
+	// the leader of the next view gets the prepareQC before the decide, so that it proposes in advance
+	if bhs.Pipelined() && bhs.PrepareQC.ViewNumber != preparedView && bhs.PrepareQC.ViewNumber == bhs.View.ViewNumber {
+		bhs.SendSerMsg(bhs.NextNewView())
+	}
 	if msgReturn == nil {
 		return
 	}
@@ -150,13 +191,17 @@ func (bhs *BCHotstuff) HandleBMsg(msgJson []byte, pk []byte) {
 
 		// if node successfully execute it, store it to blockchain
 		if bhs.Execute() {
-			go bhs.SendSerMsg(&hstypes.Msg{
-				ViewNumber: bhs.View.ViewNumber - 1,
-				HsNode:     bhs.HsNode,
-				Proposal:   hstypes.Proposal{},
-				SendNode:   bhs.GetNodeName(),
-				ReciNode:   "Client",
-			})
+			// each client gets the results of its own requests
+			for _, reply := range bcrequest.GroupResults(bhs.ExecTxs, bhs.ExecResults) {
+				go bhs.SendSerMsg(&hstypes.Msg{
+					ViewNumber: bhs.View.ViewNumber - 1,
+					HsNode:     bhs.HsNode,
+					Proposal:   hstypes.Proposal{},
+					SendNode:   bhs.GetNodeName(),
+					ReciNode:   reply.Id,
+					Results:    reply.Results,
+				})
+			}
 
 			// bhs.Logger.Println("[EXECUTE]", bhs.GetNodeName()+" Success!", bhs.View.ViewNumber-1)
 			// n.NodeManager.MsgLog = n.BasicHotstuff.LastRoundMsg
@@ -164,6 +209,12 @@ func (bhs *BCHotstuff) HandleBMsg(msgJson []byte, pk []byte) {
 		}
 	}
 
+	// handle the messages of the new view which are recieved before the decide
+	if bhs.Pipelined() && bhs.View.ViewNumber != view {
+		bhs.ReplayPipeline()
+	} else if bhs.View.ViewNumber != view {
+		bhs.ReplayLaterPrepare()
+	}
 }
 
 // RouteBMsg: the node in basic hotstuff choose conresponding func to handle the message by message type
@@ -171,12 +222,12 @@ func (bhs *BCHotstuff) HandleBMsg(msgJson []byte, pk []byte) {
 // - recieved message
 // return:
 // - message waiting to be sent
-func (bhs *BCHotstuff) RouteBMsg(msg *hstypes.Msg, pk []byte) *hstypes.Msg {
+func (bhs *BCHotstuff) RouteBMsg(msg *hstypes.Msg) *hstypes.Msg {
 	switch msg.MType {
 	case 0:
 		return bhs.HandleNewView(msg)
 	case 1:
-		return bhs.HandlePrepare(msg, pk)
+		return bhs.HandlePrepare(msg)
 	case 2:
 		return bhs.HandlePrepareVote(msg)
 	case 3:
@@ -201,6 +252,14 @@ func (bhs *BCHotstuff) RouteBMsg(msg *hstypes.Msg, pk []byte) *hstypes.Msg {
 // - preHash: 	hash of previous block
 // - req: 		recieved requests
 func (bhs *BCHotstuff) HandleReq(height int, preHash []byte, req []bcrequest.BCRequest) {
+	// the leader of the next view proposes before the current view is decided if the proposals are pipelined
+	if bhs.Pipelined() && bhs.Proposed() {
+		if msgReturn := bhs.ProposeNext(req); msgReturn != nil {
+			bhs.SendSerMsg(msgReturn)
+		}
+		return
+	}
+
 	bhs.ProposalLock.Lock()
 	defer bhs.ProposalLock.Unlock()
 
@@ -214,7 +273,7 @@ func (bhs *BCHotstuff) HandleReq(height int, preHash []byte, req []bcrequest.BCR
 	// fmt.Println(len(req), bhs.View.ViewNumber)
 
 	for i := 0; i < len(req); i++ {
-		bhs.CurProposal.Commands = append(bhs.CurProposal.Commands, req[i].Cmd)
+		bhs.CurProposal.Commands = append(bhs.CurProposal.Commands, req[i].Encode())
 		bhs.CurProposal.Signs = append(bhs.CurProposal.Signs, req[i].Sign)
 	}
 
@@ -241,7 +300,7 @@ func (bhs *BCHotstuff) HandleReq(height int, preHash []byte, req []bcrequest.BCR
 // params:
 // - msg: message that need to be sent
 func (bhs *BCHotstuff) SendSerMsg(msg *hstypes.Msg) {
-	msgJson, err := json.Marshal(msg)
+	msgJson, err := wire.Marshal(msg, bhs.Codec)
 	if err != nil {
 		return
 	}
@@ -307,6 +366,75 @@ func (bhs *BCHotstuff) CheckQC(msg *hstypes.Msg, code hstypes.StateType, viewNum
 	return true
 }
 
+// LeaderVote: the leader votes for the node of its own message of the phase as the replicas do, so that the votes of the phase
+// reach the threshold with f faulty replicas, the vote is added to the recieved votes instead of being sent
+// params:
+// - phase: the phase the leader enters, hstypes.PREPARE, hstypes.PRE_COMMIT or hstypes.COMMIT
+func (bhs *BCHotstuff) LeaderVote(phase hstypes.StateType) {
+	vote := &hstypes.Msg{
+		MType:      phase,
+		ViewNumber: bhs.View.ViewNumber,
+		HsNode:     bhs.HsNode,
+		SendNode:   bhs.GetNodeName(),
+		ReciNode:   bhs.GetNodeName(),
+	}
+	partSig, err := bhs.ThresholdSigner.ThresholdSign(vote.Message2Byte())
+	if err != nil {
+		bhs.Logger.Println("[ERROR]", bhs.GetNodeName(), err)
+		return
+	}
+	vote.PartialSig = partSig
+	bhs.VotedView, bhs.VotedPhase = vote.ViewNumber, phase
+	switch phase {
+	case hstypes.PREPARE:
+		vote.MType = hstypes.PREPARE_VOTE
+		bhs.PrepareVotes = append(bhs.PrepareVotes, vote)
+	case hstypes.PRE_COMMIT:
+		vote.MType = hstypes.PRE_COMMIT_VOTE
+		bhs.PreCommitVotes = append(bhs.PreCommitVotes, vote)
+	case hstypes.COMMIT:
+		vote.MType = hstypes.COMMIT_VOTE
+		bhs.CommitVotes = append(bhs.CommitVotes, vote)
+	}
+}
+
+// IsVote: check whether the message is a vote of the replica for the phase
+// params:
+// - mType: the type of the message
+// return:
+// - true if the message is a prepare, pre-commit or commit vote
+func IsVote(mType hstypes.StateType) bool {
+	return mType == hstypes.PREPARE_VOTE || mType == hstypes.PRE_COMMIT_VOTE || mType == hstypes.COMMIT_VOTE
+}
+
+// CheckVote: check the vote is the first one of its sender and its partial signature is on the node of this phase,
+// so that the forged, repeated or conflicting votes are never combined
+// params:
+// - votes: the votes recieved in this phase
+// - msg: the recieved vote message
+// return:
+// - true if the vote is counted, false otherwise
+func (bhs *BCHotstuff) CheckVote(votes []*hstypes.Msg, msg *hstypes.Msg) bool {
+	for _, m := range votes {
+		if m.SendNode == msg.SendNode {
+			return false
+		}
+	}
+	if !bytes.Equal(msg.HsNode.CurHash, bhs.HsNode.CurHash) || !bytes.Equal(msg.HsNode.ParentHash, bhs.HsNode.ParentHash) {
+		return false
+	}
+	signed := hstypes.Msg{
+		MType:      bhs.CurPhase,
+		ViewNumber: bhs.View.ViewNumber,
+		HsNode:     bhs.HsNode,
+	}
+	if _, ok := bhs.ThresholdSigner.PartialSignVerify(signed.Message2Byte(), msg.PartialSig); !ok {
+		bhs.Logger.Println("[Error]: vote verify error", bhs.GetNodeName(), msg.ViewNumber, msg.SendNode)
+		return false
+	}
+	return true
+}
+
 // CombineSig: combine message's part signature to a complete signature
 // params:
 // - voteMsgs: the silce of recieved messages with part signature
@@ -337,6 +465,17 @@ func (bhs *BCHotstuff) CombineSign(voteMsgs *[]*hstypes.Msg) []byte {
 	return nil
 }
 
+// CertifyQC: tell the elector the node certified by the QC, the leaders of the later views
+// are elected by the chain of the QC which the proposals extend
+// params:
+// - qc: the QC, the QC without a valid signature certifies nothing
+func (bhs *BCHotstuff) CertifyQC(qc *hstypes.QC) {
+	if qc.Sign == nil || !bhs.ThresholdSigner.ThresholdSignVerify(qc.QC2SignMsgByte(), qc.Sign) {
+		return
+	}
+	bhs.View.Certify(qc.ViewNumber, qc.HsNode.CurHash, qc.HsNode.ParentHash)
+}
+
 // CreateLeaf: generate a new node extend from parent
 // params:
 // -parent: byte slice for parent which is last proposal hash
@@ -539,22 +678,43 @@ func (bhs *BCHotstuff) FixLeader() {
 	}
 }
 
-// Execute: execute the commands
+// Execute: execute the commands of the committed block by the state machine and keep the results for the client
+// note: only the block with validation has been committed in decide phase and can be executed
 func (bhs *BCHotstuff) Execute() bool {
+	bhs.ExecResults, bhs.ExecTxs = nil, nil
+	if bhs.StateMachine != nil && len(bhs.BlkStore.CurProposalBlk.BlkHdr.Validation) != 0 {
+		bhs.ExecResults = bhs.StateMachine.Apply(bhs.BlkStore.CurProposalBlk)
+		bhs.ExecTxs = bhs.BlkStore.CurProposalBlk.BlkData.Trans
+	}
 	return true
 }
 
-func (bhs *BCHotstuff) VerifyReqs(reqs [][]byte, signs [][]byte, pk []byte) bool {
+// VerifyReqs: verify the client requests of the proposed block, the replica doesn't vote for the block
+// with an invalid or replayed request
+// params:
+// - reqs: the commands of the proposal
+// - blk:  the proposed block, whose transactions are executed after commit
+// return:
+// - true if the requests are valid
+func (bhs *BCHotstuff) VerifyReqs(reqs [][]byte, blk blockchain.Block) bool {
 	length := len(reqs)
 	if length == 0 {
 		bhs.Logger.Println("[Error]: requests length is zero", bhs.GetNodeName(), bhs.View.ViewNumber, bhs.CurPhase)
 		return false
 	}
-	// for i := 0; i < length; i++ {
-	// 	if !sm2.Sm2Verify(signs[i], pk, reqs[i]) {
-	// 		bhs.Logger.Println("[Error]: requests sign verify error")
-	// 		return false
-	// 	}
-	// }
+	if !blk.BlkHdr.IsCanonical() {
+		bhs.Logger.Println("[Error]: block version error", bhs.GetNodeName(), bhs.View.ViewNumber, blk.BlkHdr.Version)
+		return false
+	}
+	if err := blk.VerifyBlockData(); err != nil {
+		bhs.Logger.Println("[Error]: block data verify error", bhs.GetNodeName(), bhs.View.ViewNumber, err)
+		return false
+	}
+	if bhs.ReqValidator != nil {
+		if err := bhs.ReqValidator.CheckTxs(blk.BlkData.Trans); err != nil {
+			bhs.Logger.Println("[Error]: requests verify error", bhs.GetNodeName(), bhs.View.ViewNumber, err)
+			return false
+		}
+	}
 	return true
 }
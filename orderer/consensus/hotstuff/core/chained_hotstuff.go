@@ -13,7 +13,6 @@ import (
 	"blockchain"
 	"bytes"
 	common "common"
-	"encoding/json"
 	"fmt"
 	hstypes "hotstuff/types"
 	"log"
@@ -21,10 +20,12 @@ import (
 	"message"
 	"mgmt"
 	"os"
+	"statemachine"
 	"strconv"
 	"sync"
 	"time"
 	"tss"
+	"wire"
 )
 
 // CHotstuff: the core of chained hotstuff consensus
@@ -36,10 +37,13 @@ type CHotstuff struct {
 	LastLeaderState bool              // the flag indicating whether a new-view message from the previous view leader was received
 
 	// b*, b", b', b
-	HsNodes   [4]common.HsNode    // 4 current hotstuff nodes of this view, which each is consist of hash of current block and its parent block
-	Blocks    [4]blockchain.Block // 4 current blocks of this view, which went through the stages of prepare, pre-commit, commit and decide respectively
-	GenericQC hstypes.ChainedQC   // the same as PrepareQC in basic hotstuff, a quorum certificate storing the highest QC for which a replica voted pre-commit
-	LockedQC  hstypes.ChainedQC   // the same as LockedQC in basic hotstuff, a locked quorum certificate storing the highest QC for which a replica voted commit
+	HsNodes   [4]common.HsNode            // 4 current hotstuff nodes of this view, which each is consist of hash of current block and its parent block
+	Blocks    [4]blockchain.Block         // 4 current blocks of this view, which went through the stages of prepare, pre-commit, commit and decide respectively
+	Pending   map[string]blockchain.Block // the blocks of the recieved proposals by their hash, which are kept until committed, even if their views are missed
+	Parents   map[string][]byte           // the parent hashes of the hotstuff nodes carried by the recieved proposals
+	GenericQC hstypes.ChainedQC           // the same as PrepareQC in basic hotstuff, a quorum certificate storing the highest QC for which a replica voted pre-commit
+	LockedQC  hstypes.ChainedQC           // the same as LockedQC in basic hotstuff, a locked quorum certificate storing the highest QC for which a replica voted commit
+	VotedView int                         // the last view in which the node voted, it is persisted before the vote is sent
 
 	LastProposal hstypes.Proposal // last proposal of this view
 	CurProposal  hstypes.Proposal // current proposal of this view
@@ -47,17 +51,23 @@ type CHotstuff struct {
 
 	CurRoundMsg     *hstypes.CMsg   // the generic message sent by this node in the current view
 	NewViewMsgs     []*hstypes.CMsg // the collection of new-view messages this node recieved
+	LaterViewMsgs   []*hstypes.CMsg // the new-view messages of the later views recieved before the node enters them
 	GenericVoteMsgs []*hstypes.CMsg // the collection of generic vote messages this node recieved
 
 	ViewChangeSendFlag bool // the flag that the view-change message should send
 	ViewChangeFlag     bool // the flag that is in the view-change phase
 
-	ViewTimer       common.MyTimer         // the timer responsible for liveness
-	BlkStore        blockchain.BlockStore  // generate and store blocks
-	ForwardChan     chan []byte            // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
-	SendChan        chan message.ServerMsg // the channel listened by a node can send messages in the channel to the corresponding node on the network
-	Logger          log.Logger             `json:"logger"` // the role of recording logs
-	ThresholdSigner *tss.Signer            `json:"Signer"` // the role responsible for threshold signatures
+	ViewTimer       common.MyTimer            // the timer responsible for liveness
+	BlkStore        blockchain.BlockStore     // generate and store blocks
+	ForwardChan     chan []byte               // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
+	SendChan        chan message.ServerMsg    // the channel listened by a node can send messages in the channel to the corresponding node on the network
+	Codec           wire.Codec                // the codec of the consensus messages sent to the replicas, the zero value is JSON
+	Logger          log.Logger                `json:"logger"` // the role of recording logs
+	ThresholdSigner *tss.Signer               `json:"Signer"` // the role responsible for threshold signatures
+	StateMachine    statemachine.StateMachine // the replicated application which executes the committed commands
+	ExecResults     []string                  // the results of the last executed commands
+	ExecTxs         []string                  // the transactions of the last executed commands, whose clients get the results
+	ReqValidator    *bcrequest.Validator      // the validator of client requests, the proposed block is not checked if it is nil
 }
 
 // NewChainedHotstuff: create an instance of a new consensus of chained hotstuff
@@ -100,6 +110,7 @@ func NewChainedHotstuff(timerDuration int, consId int, nodeNum int, path string,
 			ViewNumber: -1,
 			HsNodes:    hsNodes,
 		},
+		VotedView: -1,
 		BlkStore: blockchain.BlockStore{
 			Base:            64,
 			Height:          0,
@@ -110,6 +121,7 @@ func NewChainedHotstuff(timerDuration int, consId int, nodeNum int, path string,
 		Logger:          *log.New(os.Stdout, "", 0),
 		SendChan:        sendChan,
 		ThresholdSigner: signer,
+		StateMachine:    statemachine.NewStateMachine(),
 	}
 
 	// set log format
@@ -124,15 +136,22 @@ func NewChainedHotstuff(timerDuration int, consId int, nodeNum int, path string,
 func (chs *CHotstuff) HandleCMsg(msgJson []byte) {
 	// convert json to message
 	var msg hstypes.CMsg
-	err := json.Unmarshal(msgJson, &msg)
+	err := wire.Unmarshal(msgJson, &msg)
 	if err != nil {
 		chs.Logger.Println("[ERROR]:", chs.GetNodeName(), err)
 		return
 	}
 
 	// submit the chained message to chained hotstuff and get its return messages
+	view, lockedView, votedView := chs.View.ViewNumber, chs.LockedQC.ViewNumber, chs.VotedView
 	msgReturnSlice := chs.RouteCMsg(&msg)
 
+	// persist the state before sending any message if the view, the lock or the last vote advanced,
+	// so that the node never votes twice in a view after restarting
+	if chs.View.ViewNumber != view || chs.LockedQC.ViewNumber != lockedView || chs.VotedView != votedView {
+		chs.SaveState()
+	}
+
 	// send its return messages and execute
 	if len(msgReturnSlice) == 0 {
 		return
@@ -155,12 +174,16 @@ func (chs *CHotstuff) HandleCMsg(msgJson []byte) {
 
 			// if node successfully execute it, store it to blockchain
 			if chs.Execute() {
-				go chs.SendSerMsg(&hstypes.CMsg{
-					ViewNumber: chs.View.ViewNumber - 1,
-					Proposal:   hstypes.Proposal{},
-					SendNode:   chs.GetNodeName(),
-					ReciNode:   "Client",
-				})
+				// each client gets the results of its own requests
+				for _, reply := range bcrequest.GroupResults(chs.ExecTxs, chs.ExecResults) {
+					go chs.SendSerMsg(&hstypes.CMsg{
+						ViewNumber: chs.View.ViewNumber - 1,
+						Proposal:   hstypes.Proposal{},
+						SendNode:   chs.GetNodeName(),
+						ReciNode:   reply.Id,
+						Results:    reply.Results,
+					})
+				}
 
 				// fmt.Println(time.Now())
 				// chs.Logger.Println("[EXECUTE]", chs.GetNodeName(), " Success!", chs.View.ViewNumber)
@@ -206,7 +229,7 @@ func (chs *CHotstuff) HandleReq(height int, preHash []byte, req []bcrequest.BCRe
 			Commands:   make([][]byte, 0),
 		}
 		for i := 0; i < len(req); i++ {
-			chs.CurProposal.Commands = append(chs.CurProposal.Commands, req[i].Cmd)
+			chs.CurProposal.Commands = append(chs.CurProposal.Commands, req[i].Encode())
 		}
 		chs.CurProposal.RootHash = merkle.HashFromByteSlicesIterative(chs.CurProposal.Commands)
 
@@ -266,6 +289,150 @@ func (chs *CHotstuff) UpdateBlock(blk *blockchain.Block) {
 	chs.BlkStore.GeneratedHeight = blk.BlkHdr.Height + 1
 }
 
+// ExtendBlock: update local blocks with the new block, and keep the ancestors carried by the hotstuff nodes of the new block,
+// the blocks of the proposals which are never certified are dropped, so that the blocks stay aligned with the nodes
+// params:
+// - blk: the block of the new proposal
+// - nodes: the hotstuff nodes of the new proposal, b*, b", b', b
+func (chs *CHotstuff) ExtendBlock(blk *blockchain.Block, nodes [4]common.HsNode) {
+	blocks := chs.Blocks
+	chs.UpdateBlock(blk)
+	for i := 1; i < len(nodes); i++ {
+		chs.Blocks[i] = blockchain.Block{}
+		if blk, ok := FindBlock(blocks[:], chs.Pending, nodes[i].CurHash); ok {
+			chs.Blocks[i] = blk
+		}
+	}
+}
+
+// FindBlock: find the block carried by a hotstuff node in the blocks of the recent views and the kept blocks
+// params:
+// - blocks: the blocks of the recent views
+// - pending: the kept blocks by their hash
+// - hash: the hash of the hotstuff node
+// return: the block and whether it is found
+func FindBlock(blocks []blockchain.Block, pending map[string]blockchain.Block, hash []byte) (blockchain.Block, bool) {
+	for _, b := range blocks {
+		if bytes.Equal(BlockNodeHash(&b), hash) {
+			return b, true
+		}
+	}
+	blk, ok := pending[string(hash)]
+	return blk, ok
+}
+
+// KeepBlock: keep the block of a recieved proposal until it is committed, so that the replica which misses the view of the proposal
+// finds it when the later proposals extending it are recieved
+// params:
+// - blk: the block of the recieved proposal
+// - nodes: the hotstuff nodes of the recieved proposal, whose parents are kept to find the ancestors of the committed block
+func (chs *CHotstuff) KeepBlock(blk *blockchain.Block, nodes [4]common.HsNode) {
+	if chs.Pending == nil {
+		chs.Pending = make(map[string]blockchain.Block)
+		chs.Parents = make(map[string][]byte)
+	}
+	if !blk.IsEmpty() {
+		chs.Pending[string(blk.Hash())] = *blk
+	}
+	for _, node := range nodes {
+		if node.CurHash != nil && node.ParentHash != nil && !bytes.Equal(node.CurHash, merkle.EmptyHash()) {
+			chs.Parents[string(node.CurHash)] = node.ParentHash
+		}
+	}
+}
+
+// PruneBlocks: drop the kept blocks which are not higher than the committed block
+// params: the height of the committed block
+func (chs *CHotstuff) PruneBlocks(height int) {
+	for hash, blk := range chs.Pending {
+		if blk.BlkHdr.Height <= height {
+			delete(chs.Pending, hash)
+			delete(chs.Parents, hash)
+		}
+	}
+}
+
+// MissedAncestors: get the kept ancestors of the block which are not committed, from the lowest one
+// params: the hash of the block
+// return: the uncommitted ancestors
+func (chs *CHotstuff) MissedAncestors(hash []byte) []blockchain.Block {
+	ancestors := make([]blockchain.Block, 0)
+	for parent, ok := chs.Parents[string(hash)]; ok; parent, ok = chs.Parents[string(parent)] {
+		blk, kept := chs.Pending[string(parent)]
+		if !kept || chs.IsCommitted(&blk) {
+			break
+		}
+		ancestors = append([]blockchain.Block{blk}, ancestors...)
+	}
+	return ancestors
+}
+
+// CommitBlock: store the block certified by the QC, and update the pacemaker and the view by it
+// params:
+// - blk: the committed block
+// - qc: the QC which certifies the block or its descendant
+func (chs *CHotstuff) CommitBlock(blk *blockchain.Block, qc *hstypes.ChainedQC) {
+	blk.BlkHdr.Validation = qc.Sign
+	blk.BlkHdr.ValidationMsg = qc.QC2SignMsgByte()
+	// chs.BlkStore.CurProposalBlk.BlkHdr.Validation = msg.Justify.Sign
+	chs.BlkStore.CurBlkHash = blk.Hash()
+	chs.BlkStore.StoreBlock(*blk)
+	chs.PruneBlocks(blk.BlkHdr.Height)
+	if latency, ok := blk.BlkHdr.Latency(); ok {
+		chs.ViewTimer.Pacemaker.ObserveCommit(latency)
+	}
+	// the block committed by the three-chain is observed again, since its generic QC may have come while this replica was behind
+	chs.View.Certify(blk.BlkHdr.ViewNumber, chs.BlkStore.CurBlkHash, blk.BlkHdr.PreBlkHash)
+	chs.BlkStore.Height -= 1
+}
+
+// CertifyQC: tell the elector the newest node certified by the generic QC, the leaders of the later views
+// are elected by the chain of the QC which the proposals extend
+// params:
+// - qc: the generic QC, the QC without a valid signature certifies nothing
+func (chs *CHotstuff) CertifyQC(qc *hstypes.ChainedQC) {
+	if qc.Sign == nil || !chs.ThresholdSigner.ThresholdSignVerify(qc.QC2SignMsgByte(), qc.Sign) {
+		return
+	}
+	chs.View.Certify(qc.ViewNumber, qc.HsNodes[0].CurHash, qc.HsNodes[0].ParentHash)
+}
+
+// CertifiedHeight: get the height of the block extending the hotstuff nodes certified by a QC,
+// which follows the highest block among the nodes, or the committed blocks if the nodes carry no block
+// params: the hotstuff nodes certified by the QC
+// return: the height of the new block
+func (chs *CHotstuff) CertifiedHeight(nodes [4]common.HsNode) int {
+	for _, node := range nodes {
+		if blk, ok := FindBlock(chs.Blocks[:], chs.Pending, node.CurHash); ok && !blk.IsEmpty() {
+			return blk.BlkHdr.Height + 1
+		}
+	}
+	height, err := chs.BlkStore.GetStorage().GetBlockHeight()
+	if err != nil {
+		return chs.BlkStore.GeneratedHeight
+	}
+	return height + 1
+}
+
+// IsCommitted: check whether the block is stored at its height, the empty block is never stored
+// params: the block to check
+// return: a boolean
+func (chs *CHotstuff) IsCommitted(blk *blockchain.Block) bool {
+	if blk.IsEmpty() {
+		return false
+	}
+	_, err := chs.BlkStore.GetStorage().ReadBlock(blk.BlkHdr.Height)
+	return err == nil
+}
+
+// BlockNodeHash: get the hash of the block carried by a hotstuff node, the empty block is the empty hash
+func BlockNodeHash(blk *blockchain.Block) []byte {
+	if blk.IsEmpty() {
+		return merkle.EmptyHash()
+	}
+	return blk.Hash()
+}
+
 // CreateLeaf: generate a new node extend from parent
 // params: byte slice for parent which is last proposal hash
 // return: new node
@@ -306,6 +473,34 @@ func MatchingCQC(qc *hstypes.QC, code hstypes.StateType, curView int) bool {
 	return false
 }
 
+// CheckGenericVote: check the generic-vote is the first one of its sender and its partial signature is on the proposal of this view,
+// so that the forged, repeated or conflicting votes are never combined
+// params: the recieved generic-vote message
+// return: whether the vote is counted
+func (chs *CHotstuff) CheckGenericVote(msg *hstypes.CMsg) bool {
+	if chs.CurRoundMsg == nil {
+		return false
+	}
+	for _, m := range chs.GenericVoteMsgs {
+		if m.SendNode == msg.SendNode {
+			return false
+		}
+	}
+	signed := hstypes.CMsg{
+		MType:      hstypes.GENERIC,
+		ViewNumber: msg.ViewNumber,
+		HsNodes:    msg.HsNodes,
+	}
+	if !bytes.Equal(signed.ChainedMessage2Byte(), chs.CurRoundMsg.ChainedMessage2Byte()) {
+		return false
+	}
+	if _, ok := chs.ThresholdSigner.PartialSignVerify(signed.ChainedMessage2Byte(), msg.PartialSig); !ok {
+		chs.Logger.Println("[Error]: vote verify error", chs.GetNodeName(), msg.ViewNumber, msg.SendNode)
+		return false
+	}
+	return true
+}
+
 // CombineSign: combine part signatures to a complete signature
 // params: the silce of recieved messages with part signature
 // ruturn: byte silce of the complete signature
@@ -418,7 +613,7 @@ func (chs *CHotstuff) FixLeader() {
 // params:
 // - msg: message that need to be sent
 func (chs *CHotstuff) SendSerMsg(msg *hstypes.CMsg) {
-	msgJson, err := json.Marshal(msg)
+	msgJson, err := wire.Marshal(msg, chs.Codec)
 	if err != nil {
 		return
 	}
@@ -432,8 +627,13 @@ func (chs *CHotstuff) SendSerMsg(msg *hstypes.CMsg) {
 	chs.SendChan <- serMsg
 }
 
-// Execute: execute the commands
+// Execute: execute the commands of the committed block b* by the state machine and keep the results for the client
 func (chs *CHotstuff) Execute() bool {
+	chs.ExecResults, chs.ExecTxs = nil, nil
+	if chs.StateMachine != nil && len(chs.Blocks[3].BlkHdr.Validation) != 0 {
+		chs.ExecResults = chs.StateMachine.Apply(chs.Blocks[3])
+		chs.ExecTxs = chs.Blocks[3].BlkData.Trans
+	}
 	return true
 }
 
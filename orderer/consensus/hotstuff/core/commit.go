@@ -25,8 +25,9 @@ func (bhs *BCHotstuff) HandlePreCommitVote(msg *hstypes.Msg) *hstypes.Msg {
 		return nil
 	}
 
-	// check whether message's type and view number are matching current view
-	if bhs.MatchingMsg(msg, hstypes.PRE_COMMIT_VOTE, bhs.View.ViewNumber) {
+	// check whether message's type and view number are matching current view,
+	// and the vote is the first one of its sender for the node of this phase
+	if bhs.MatchingMsg(msg, hstypes.PRE_COMMIT_VOTE, bhs.View.ViewNumber) && bhs.CheckVote(bhs.PreCommitVotes, msg) {
 		bhs.PreCommitVotes = append(bhs.PreCommitVotes, msg)
 	}
 
@@ -52,6 +53,7 @@ func (bhs *BCHotstuff) HandlePreCommitVote(msg *hstypes.Msg) *hstypes.Msg {
 	// change the local phase to commit
 	bhs.LockedQC = lockQC
 	bhs.CurPhase = hstypes.COMMIT
+	bhs.LeaderVote(hstypes.COMMIT)
 
 	// log
 	// bhs.Logger.Println("[COMMIT]", bhs.GetNodeName(), "ViewNumber:", bhs.View.ViewNumber)
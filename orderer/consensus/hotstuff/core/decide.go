@@ -24,8 +24,9 @@ func (bhs *BCHotstuff) HandleCommitVote(msg *hstypes.Msg) *hstypes.Msg {
 		return nil
 	}
 
-	// check whether message's type and view number are matching current view
-	if bhs.MatchingMsg(msg, hstypes.COMMIT_VOTE, bhs.View.ViewNumber) {
+	// check whether message's type and view number are matching current view,
+	// and the vote is the first one of its sender for the node of this phase
+	if bhs.MatchingMsg(msg, hstypes.COMMIT_VOTE, bhs.View.ViewNumber) && bhs.CheckVote(bhs.CommitVotes, msg) {
 		bhs.CommitVotes = append(bhs.CommitVotes, msg)
 	}
 
@@ -96,7 +97,13 @@ func (bhs *BCHotstuff) HandleDecide(msg *hstypes.Msg) *hstypes.Msg {
 
 	// add validation to the block and store it
 	bhs.BlkStore.CurProposalBlk.BlkHdr.Validation = msg.Justify.Sign
+	bhs.BlkStore.CurProposalBlk.BlkHdr.ValidationMsg = msg.Justify.QC2SignMsgByte()
 	bhs.BlkStore.StoreBlock(bhs.BlkStore.CurProposalBlk)
+	if latency, ok := bhs.BlkStore.CurProposalBlk.BlkHdr.Latency(); ok {
+		bhs.ViewTimer.Pacemaker.ObserveCommit(latency)
+	}
+	// the commit QC of DECIDE certifies the block for the replica which missed its prepare QC
+	bhs.View.Certify(bhs.BlkStore.CurProposalBlk.BlkHdr.ViewNumber, bhs.BlkStore.CurProposalBlk.Hash(), bhs.BlkStore.CurProposalBlk.BlkHdr.PreBlkHash)
 
 	// refresh the local consensus state include view update
 	bhs.NewRound()
@@ -21,19 +21,34 @@ import (
 // broadcast Msg(generic, curProposal, ⊥) # prepare phase (leader-half)
 func (chs *CHotstuff) CHandleNewView(msg *hstypes.CMsg) []*hstypes.CMsg {
 
+	// the replicas whose view timers expire earlier send the new-view messages before the leader enters the view,
+	// so the messages are kept until then
+	if msg.MType == hstypes.NEW_VIEW && msg.ViewNumber > chs.View.ViewNumber {
+		chs.LaterViewMsgs = append(chs.LaterViewMsgs, msg)
+		return nil
+	}
+
 	// check whether the node state is new-view phase
 	if chs.CurPhase != hstypes.NEW_VIEW {
 		return nil
 	}
 
-	// check whether message's type and view number are matching current view
-	if MatchingCMsg(msg, hstypes.NEW_VIEW, chs.View.ViewNumber) {
+	// check whether message's type and view number are matching current view,
+	// and the message is the first one of its sender in this view
+	msgs := []*hstypes.CMsg{msg}
+	if len(chs.LaterViewMsgs) != 0 {
+		msgs = append(chs.TakeLaterViewMsgs(), msg)
+	}
+	for _, m := range msgs {
+		if !MatchingCMsg(m, hstypes.NEW_VIEW, chs.View.ViewNumber) || chs.HasNewView(m.SendNode) {
+			continue
+		}
 
 		// log new-view message
-		chs.NewViewMsgs = append(chs.NewViewMsgs, msg)
+		chs.NewViewMsgs = append(chs.NewViewMsgs, m)
 
 		// estimate whether recieve the new-view message from the last leader
-		if msg.SendNode == chs.GetChainedLastLeader() {
+		if m.SendNode == chs.GetChainedLastLeader() {
 			chs.LastLeaderState = true
 		}
 	}
@@ -86,22 +101,25 @@ func (chs *CHotstuff) CHandleNewView(msg *hstypes.CMsg) []*hstypes.CMsg {
 	// get the message with the hignest QC, and update local genericQC
 	hignQcMsg, _ := GetHighChainedQC(&chs.NewViewMsgs)
 	chs.GenericQC = hignQcMsg.Justify
+	chs.CertifyQC(&chs.GenericQC)
 
-	// create a new hotstuff node extend the hignest QC's node and local HsNode
+	// create a new hotstuff node extend the hignest QC's node and local HsNode,
+	// the height of the block follows the blocks certified by the QC
+	qcNodes := hignQcMsg.Justify.HsNodes
 	if len(chs.CurProposal.Commands) == 0 {
 		chs.BlkStore.GenEmptyBlock()
 		chs.BlkStore.Height += 1
 	} else {
-		reqs := common.CutOffTwoDimByteSlice(chs.CurProposal.Commands, 128)
-		chs.BlkStore.GenNewBlock(chs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(reqs), chs.BlkStore.GeneratedHeight)
+		chs.BlkStore.GenNewBlock(chs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(chs.CurProposal.Commands), chs.CertifiedHeight(qcNodes))
 		chs.BlkStore.Height += 1
 	}
 
-	// leader create leaf node extend from the hignest QC's node but doesn't update it to local CHsNode
+	// leader create leaf node extend from the hignest QC's node but doesn't update it to local CHsNode,
+	// the ancestors are the ones certified by the QC, which differ from the local ones if the last proposal is not certified
 	// leader update block to lock block
-	newCHsNode := chs.CreateLeaf((hignQcMsg.Justify.HsNodes[0]).CurHash)
-	msgCHsNode := [4]common.HsNode{newCHsNode, chs.HsNodes[0], chs.HsNodes[1], chs.HsNodes[2]}
-	chs.UpdateBlock(&chs.BlkStore.CurProposalBlk)
+	newCHsNode := chs.CreateLeaf(qcNodes[0].CurHash)
+	msgCHsNode := [4]common.HsNode{newCHsNode, qcNodes[0], qcNodes[1], qcNodes[2]}
+	chs.ExtendBlock(&chs.BlkStore.CurProposalBlk, msgCHsNode)
 
 	// update local state
 	chs.CurPhase = hstypes.HALF_GENERIC
@@ -141,21 +159,24 @@ func (chs *CHotstuff) GenProposal() *hstypes.CMsg {
 	// get the message with the hignest QC, and update local genericQC
 	hignQcMsg, _ := GetHighChainedQC(&chs.NewViewMsgs)
 	chs.GenericQC = hignQcMsg.Justify
+	chs.CertifyQC(&chs.GenericQC)
 
-	// create a new hotstuff node extend the hignest QC's node and local HsNode
+	// create a new hotstuff node extend the hignest QC's node and local HsNode,
+	// the height of the block follows the blocks certified by the QC
+	qcNodes := hignQcMsg.Justify.HsNodes
 	if len(chs.CurProposal.Commands) == 0 {
 		chs.BlkStore.GenEmptyBlock()
 		chs.BlkStore.Height += 1
 	} else {
-		reqs := common.CutOffTwoDimByteSlice(chs.CurProposal.Commands, 128)
-		chs.BlkStore.GenNewBlock(chs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(reqs), chs.BlkStore.GeneratedHeight)
+		chs.BlkStore.GenNewBlock(chs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(chs.CurProposal.Commands), chs.CertifiedHeight(qcNodes))
 	}
 
-	// leader create leaf node extend from the hignest QC's node but doesn't update it to local CHsNode
+	// leader create leaf node extend from the hignest QC's node but doesn't update it to local CHsNode,
+	// the ancestors are the ones certified by the QC, which differ from the local ones if the last proposal is not certified
 	// leader update block to lock block
-	newCHsNode := chs.CreateLeaf((hignQcMsg.Justify.HsNodes[0]).CurHash)
-	msgCHsNode := [4]common.HsNode{newCHsNode, chs.HsNodes[0], chs.HsNodes[1], chs.HsNodes[2]}
-	chs.UpdateBlock(&chs.BlkStore.CurProposalBlk)
+	newCHsNode := chs.CreateLeaf(qcNodes[0].CurHash)
+	msgCHsNode := [4]common.HsNode{newCHsNode, qcNodes[0], qcNodes[1], qcNodes[2]}
+	chs.ExtendBlock(&chs.BlkStore.CurProposalBlk, msgCHsNode)
 
 	// update local state
 	chs.CurPhase = hstypes.HALF_GENERIC
@@ -205,23 +226,63 @@ func (chs *CHotstuff) GenProposal() *hstypes.CMsg {
 //	execute new commands through b, respond to clients
 func (chs *CHotstuff) CHandleGeneric(msg *hstypes.CMsg) []*hstypes.CMsg {
 
+	// keep the block even if the view is missed, so that it is committed with the later proposals extending it
+	chs.KeepBlock(&msg.Blk, msg.HsNodes)
+
+	// the replica which falls behind enters the view of the proposal from its leader, if the proposal carries the valid QC
+	// of the view before, since a quorum of the replicas have left the former views
+	if msg.ViewNumber > chs.View.ViewNumber && msg.Justify.ViewNumber == msg.ViewNumber-1 &&
+		msg.SendNode == chs.View.LeaderNameOf(msg.ViewNumber) &&
+		chs.ThresholdSigner.ThresholdSignVerify(msg.Justify.QC2SignMsgByte(), msg.Justify.Sign) {
+		for chs.View.ViewNumber < msg.ViewNumber {
+			chs.View.NextView()
+		}
+		chs.CurPhase = hstypes.NEW_VIEW
+	}
+
 	// check whether message is from this view
 	if msg.ViewNumber != chs.View.ViewNumber {
 		// fmt.Println(msg.ViewNumber, chs.View.ViewNumber)
 		return nil
 	}
 
+	// the node votes once in a view, the view voted before restarting is never voted again,
+	// since the proposal voted in it is lost and the leader may have proposed a conflicting one
+	if msg.ViewNumber <= chs.VotedView {
+		return nil
+	}
+
 	// check whether message's nodes and it's new node is safe
 	if !chs.CheckNewCHsNode(msg) {
 		return nil
 	}
+	chs.CertifyQC(&msg.Justify)
 
 	chs.ViewChangeFlag = false
 
 	// if this node isn't leader, update the proposal and node carried by the message
 	if !chs.IsLeader() {
 
-		chs.UpdateBlock(&msg.Blk)
+		// the block with an invalid or replayed request, not hashed by the canonical encoding, or whose data differs from its header is not voted
+		if !msg.Blk.IsEmpty() && !msg.Blk.BlkHdr.IsCanonical() {
+			chs.Logger.Println("[Error]: block version error", chs.GetNodeName(), chs.View.ViewNumber, msg.Blk.BlkHdr.Version)
+			chs.rejectProposal()
+			return nil
+		}
+		if err := msg.Blk.VerifyBlockData(); err != nil {
+			chs.Logger.Println("[Error]: block data verify error", chs.GetNodeName(), chs.View.ViewNumber, err)
+			chs.rejectProposal()
+			return nil
+		}
+		if chs.ReqValidator != nil {
+			if err := chs.ReqValidator.CheckTxs(msg.Blk.BlkData.Trans); err != nil {
+				chs.Logger.Println("[Error]: requests verify error", chs.GetNodeName(), chs.View.ViewNumber, err)
+				chs.rejectProposal()
+				return nil
+			}
+		}
+
+		chs.ExtendBlock(&msg.Blk, msg.HsNodes)
 
 		// stop view timer set in the previous "CHandleGeneric" func in last view
 		chs.ViewTimer.Stop()
@@ -244,6 +305,7 @@ func (chs *CHotstuff) CHandleGeneric(msg *hstypes.CMsg) []*hstypes.CMsg {
 		HsNodes:    msg.HsNodes,
 		PartialSig: partSig,
 	}
+	chs.VotedView = genericVote.ViewNumber
 
 	// b*.parent = b"
 	if bytes.Equal(msg.HsNodes[0].ParentHash, msg.HsNodes[1].CurHash) {
@@ -253,8 +315,9 @@ func (chs *CHotstuff) CHandleGeneric(msg *hstypes.CMsg) []*hstypes.CMsg {
 		if bytes.Equal(msg.HsNodes[1].ParentHash, msg.HsNodes[2].CurHash) {
 			chs.LockedQC = msg.Justify
 
-			// b*.parent = b" && b".parent = b' && b'.parent = b
-			if bytes.Equal(msg.HsNodes[2].ParentHash, msg.HsNodes[3].CurHash) {
+			// b*.parent = b" && b".parent = b' && b'.parent = b, and b is not committed by the former views,
+			// since the proposals extending the same QC certify it again if their views fail
+			if bytes.Equal(msg.HsNodes[2].ParentHash, msg.HsNodes[3].CurHash) && !chs.IsCommitted(&chs.Blocks[3]) {
 				chs.ExecuteState = true
 
 				// if block[3] isn't empty and its hash and lock HsNodes[3].CurHash is equal, store the block
@@ -264,11 +327,14 @@ func (chs *CHotstuff) CHandleGeneric(msg *hstypes.CMsg) []*hstypes.CMsg {
 					// 	common.String2ByteSlice(chs.Blocks[1].BlkData.Trans)[0][:5],
 					// 	common.String2ByteSlice(chs.Blocks[2].BlkData.Trans)[0][:5],
 					// 	common.String2ByteSlice(chs.Blocks[3].BlkData.Trans)[0][:5])
-					chs.Blocks[3].BlkHdr.Validation = msg.Justify.Sign
-					// chs.BlkStore.CurProposalBlk.BlkHdr.Validation = msg.Justify.Sign
-					chs.BlkStore.CurBlkHash = chs.Blocks[3].Hash()
-					chs.BlkStore.StoreBlock(chs.Blocks[3])
-					chs.BlkStore.Height -= 1
+					// the ancestors are committed with the block, such as the ones whose commits are missed by the replica falling behind
+					for _, blk := range chs.MissedAncestors(chs.HsNodes[3].CurHash) {
+						chs.CommitBlock(&blk, &msg.Justify)
+						if chs.StateMachine != nil {
+							chs.StateMachine.Apply(blk)
+						}
+					}
+					chs.CommitBlock(&chs.Blocks[3], &msg.Justify)
 				}
 			}
 		}
@@ -305,9 +371,27 @@ func (chs *CHotstuff) CHandleGeneric(msg *hstypes.CMsg) []*hstypes.CMsg {
 
 		return []*hstypes.CMsg{genericVote, newViewMsg}
 	}
+
+	// the leader sets the view timer while it waits for the votes, so that it changes the view with the replicas
+	// if its proposal is never certified, such as the replicas recieve the conflicting proposals
+	chs.ViewTimer.Start(func() {
+		chs.StartViewChange()
+	}, func() {
+	})
 	return []*hstypes.CMsg{genericVote}
 }
 
+// rejectProposal: the replica which rejects the proposal of the leader starts the view timer if the view was not entered by the timer,
+// such as the first view, so that it changes the view with the others instead of waiting for the leader forever
+func (chs *CHotstuff) rejectProposal() {
+	if chs.ViewTimer.IsStopped {
+		chs.ViewTimer.Start(func() {
+			chs.StartViewChange()
+		}, func() {
+		})
+	}
+}
+
 // CHandleGenericVote: the leader in leader-half handle the message
 // CHandleGenericVote implement chained hotstuff description as follow:
 // as a leader // pre-commit phase (leader-half)
@@ -323,8 +407,9 @@ func (chs *CHotstuff) CHandleGenericVote(msg *hstypes.CMsg) []*hstypes.CMsg {
 		return nil
 	}
 
-	// check whether message's type and view number are matching current view
-	if CheckCMsg(msg, hstypes.GENERIC_VOTE, chs.View.ViewNumber) {
+	// check whether message's type and view number are matching current view,
+	// and the vote is the first one of its sender for the proposal of this view
+	if CheckCMsg(msg, hstypes.GENERIC_VOTE, chs.View.ViewNumber) && chs.CheckGenericVote(msg) {
 		chs.GenericVoteMsgs = append(chs.GenericVoteMsgs, msg)
 	}
 
@@ -354,6 +439,7 @@ func (chs *CHotstuff) CHandleGenericVote(msg *hstypes.CMsg) []*hstypes.CMsg {
 
 	// update leader's local GenericQC, view and phase state
 	chs.GenericQC = genericQC
+	chs.CertifyQC(&chs.GenericQC)
 	chs.View.NextView()
 	chs.CurPhase = hstypes.NEW_VIEW
 	chs.CurProposal = hstypes.Proposal{}
@@ -379,6 +465,34 @@ func (chs *CHotstuff) CHandleGenericVote(msg *hstypes.CMsg) []*hstypes.CMsg {
 	}
 }
 
+// TakeLaterViewMsgs: take the kept new-view messages of the current view, and drop the ones of the former views
+// return: the new-view messages of the current view
+func (chs *CHotstuff) TakeLaterViewMsgs() []*hstypes.CMsg {
+	msgs := make([]*hstypes.CMsg, 0)
+	later := make([]*hstypes.CMsg, 0)
+	for _, m := range chs.LaterViewMsgs {
+		if m.ViewNumber == chs.View.ViewNumber {
+			msgs = append(msgs, m)
+		} else if m.ViewNumber > chs.View.ViewNumber {
+			later = append(later, m)
+		}
+	}
+	chs.LaterViewMsgs = later
+	return msgs
+}
+
+// HasNewView: check whether the new-view message of the node in the current view is recieved
+// params: the name of the node
+// return: a boolean
+func (chs *CHotstuff) HasNewView(node string) bool {
+	for _, m := range chs.NewViewMsgs {
+		if m.SendNode == node {
+			return true
+		}
+	}
+	return false
+}
+
 // GetHighChainedQC: in chained-hotstuff, get the highest QC
 // params: recieved n-f new-view messages
 // return: the point of message with the highest QC
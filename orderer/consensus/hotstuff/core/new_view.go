@@ -21,6 +21,13 @@ func (bhs *BCHotstuff) HandleNewView(msg *hstypes.Msg) *hstypes.Msg {
 	bhs.ProposalLock.Lock()
 	defer bhs.ProposalLock.Unlock()
 
+	// the replicas whose view timers expire earlier send the new-view messages before the leader enters the view,
+	// so the messages are kept until then
+	if msg.ViewNumber > bhs.View.ViewNumber {
+		bhs.LaterViewMsgs = append(bhs.LaterViewMsgs, msg)
+		return nil
+	}
+
 	// check the node whether in new-view phase
 	if bhs.CurPhase != hstypes.NEW_VIEW && bhs.CurPhase != hstypes.WAITING {
 		return nil
@@ -31,13 +38,18 @@ func (bhs *BCHotstuff) HandleNewView(msg *hstypes.Msg) *hstypes.Msg {
 		return nil
 	}
 
-	// check whether message's type and view number are matching current view
-	if len(bhs.LastRoundMsg) == 0 {
-		if bhs.MatchingMsg(msg, hstypes.NEW_VIEW, bhs.View.ViewNumber) && bhs.CheckQC(msg, hstypes.PREPARE, bhs.View.ViewNumber-1) {
-			bhs.NewViewMsgs = append(bhs.NewViewMsgs, msg)
+	// check whether message's type and view number are matching current view,
+	// the prepareQC may be of any former view since the views without prepareQC are skipped by the view change,
+	// and it is the initial one without signature if no prepareQC has been generated since view 0 or the handover
+	msgs := []*hstypes.Msg{msg}
+	if len(bhs.LaterViewMsgs) != 0 {
+		msgs = append(bhs.TakeLaterViewMsgs(), msg)
+	}
+	for _, m := range msgs {
+		if bhs.MatchingMsg(m, hstypes.NEW_VIEW, bhs.View.ViewNumber) && m.Justify.ViewNumber < bhs.View.ViewNumber &&
+			(m.Justify.ViewNumber < 0 || bhs.CheckQC(m, hstypes.PREPARE, m.Justify.ViewNumber)) {
+			bhs.NewViewMsgs = append(bhs.NewViewMsgs, m)
 		}
-	} else if bhs.MatchingMsg(msg, hstypes.NEW_VIEW, bhs.View.ViewNumber) && bhs.CheckQC(msg, hstypes.PREPARE, bhs.LastRoundMsg[len(bhs.LastRoundMsg)-1].ViewNumber) {
-		bhs.NewViewMsgs = append(bhs.NewViewMsgs, msg)
 	}
 
 	// check meet the threshold conditions, (m > 2f+1)
@@ -66,6 +78,7 @@ func (bhs *BCHotstuff) HandleNewView(msg *hstypes.Msg) *hstypes.Msg {
 	bhs.HsNode = bhs.CreateLeaf(bhs.NewViewMsgs[HignQCNum].Justify.HsNode.CurHash)
 	// fmt.Println("gener proposal Handle NewView", bhs.GetNodeName(), bhs.View.ViewNumber, bhs.CurPhase, bhs.HsNode)
 	bhs.CurPhase = hstypes.PREPARE
+	bhs.LeaderVote(hstypes.PREPARE)
 
 	// log
 	// bhs.Logger.Println("New Round in view", bhs.View.ViewNumber, ":"+strconv.Itoa(bhs.View.ViewNumber))
@@ -91,6 +104,23 @@ func (bhs *BCHotstuff) HandleNewView(msg *hstypes.Msg) *hstypes.Msg {
 	}
 }
 
+// TakeLaterViewMsgs: take the kept new-view messages of the current view, and drop the ones of the former views
+// return:
+// - the new-view messages of the current view
+func (bhs *BCHotstuff) TakeLaterViewMsgs() []*hstypes.Msg {
+	msgs := make([]*hstypes.Msg, 0)
+	later := make([]*hstypes.Msg, 0)
+	for _, m := range bhs.LaterViewMsgs {
+		if m.ViewNumber == bhs.View.ViewNumber {
+			msgs = append(msgs, m)
+		} else if m.ViewNumber > bhs.View.ViewNumber {
+			later = append(later, m)
+		}
+	}
+	bhs.LaterViewMsgs = later
+	return msgs
+}
+
 // GetHighQCIndex: from some messages, return the index of message with the highest QC
 // params: recieved new-view messages
 // return: the index
@@ -149,11 +179,11 @@ func (bhs *BCHotstuff) GenProposal() *hstypes.Msg {
 	// create new node with new command extend from last node
 	// get the index for message with the highest QC from n-f new-view message
 	// change the node local state to prepare
-	reqs := common.CutOffTwoDimByteSlice(bhs.CurProposal.Commands, 128)
-	bhs.BlkStore.GenNewBlock(bhs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(reqs))
+	bhs.BlkStore.GenNewBlock(bhs.View.ViewNumber, common.TwoDimByteSlice2StringSlice(bhs.CurProposal.Commands))
 	HignQCNum := GetHighQCIndex(&bhs.NewViewMsgs)
 	bhs.HsNode = bhs.CreateLeaf(bhs.NewViewMsgs[HignQCNum].Justify.HsNode.CurHash)
 	// fmt.Println("gener proposal ", bhs.GetNodeName(), bhs.View.ViewNumber, bhs.HsNode)
+	bhs.LeaderVote(hstypes.PREPARE)
 
 	bhs.IgnoreCheckQC = false
 
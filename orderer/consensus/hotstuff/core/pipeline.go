@@ -0,0 +1,235 @@
+package core
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	"common"
+	hstypes "hotstuff/types"
+	"merkle"
+)
+
+// MaxWindow: the max number of proposals in flight of basic hotstuff, the proposal of the next view extends the prepareQC
+// of the current view, and the replicas keep the phases of one view only, so the next view is prepared after the current one
+// is decided. A proposal extending a later block is a sibling of the next one, so no more than two views are in flight,
+// and a deeper pipeline is chained hotstuff, which proposes in every phase
+const MaxWindow = 2
+
+// Pipelined: check whether the proposals are pipelined, then the leader of the next view proposes
+// once the current view is prepared, and the replicas vote for it after the current view is decided
+// note: the window is checked against MaxWindow when the consensus is created, so it is 2 if it is more than 1
+func (bhs *BCHotstuff) Pipelined() bool {
+	return bhs.Window > 1
+}
+
+// Proposed: check whether the leader of the current view has proposed
+func (bhs *BCHotstuff) Proposed() bool {
+	return bhs.CurPhase != hstypes.NEW_VIEW && bhs.CurPhase != hstypes.WAITING
+}
+
+// IsWaitingReq: check whether the node is waiting for the requests to propose,
+// if the proposals are pipelined, the leader of the next view proposes before the current view is decided
+func (bhs *BCHotstuff) IsWaitingReq() bool {
+	if !bhs.Pipelined() || !bhs.Proposed() {
+		return bhs.CurPhase == hstypes.WAITING
+	}
+	bhs.ProposalLock.Lock()
+	defer bhs.ProposalLock.Unlock()
+	return bhs.readyToProposeNext()
+}
+
+// GetProposerName: get the name of the node which proposes the next requests, which is the leader of the current view,
+// or the leader of the next view if the proposals are pipelined and the current view has been proposed
+func (bhs *BCHotstuff) GetProposerName() string {
+	if !bhs.Pipelined() || !bhs.Proposed() {
+		return bhs.GetLeaderName()
+	}
+	return bhs.View.LeaderNameOf(bhs.View.ViewNumber + 1)
+}
+
+// NextNewView: generate the new-view message of the next view once the current view is prepared
+// return:
+// - the new-view message sent to the leader of the next view
+func (bhs *BCHotstuff) NextNewView() *hstypes.Msg {
+	return &hstypes.Msg{
+		MType:      hstypes.NEW_VIEW,
+		ViewNumber: bhs.View.ViewNumber + 1,
+		SendNode:   bhs.GetNodeName(),
+		Justify:    bhs.PrepareQC,
+		ReciNode:   bhs.View.LeaderNameOf(bhs.View.ViewNumber + 1),
+	}
+}
+
+// nextView: get the next view, and drop the pipelined messages of the other views
+func (bhs *BCHotstuff) nextView() int {
+	if bhs.PipelineView != bhs.View.ViewNumber+1 {
+		bhs.PipelineView = bhs.View.ViewNumber + 1
+		bhs.NextNewViews = make([]*hstypes.Msg, 0)
+		bhs.NextPrepare = nil
+		bhs.PipelineBuffer = make([]*hstypes.Msg, 0)
+	}
+	return bhs.PipelineView
+}
+
+// readyToProposeNext: check whether this node is the leader of the next view which has not proposed, and the new-view messages
+// of the next view meet the threshold with the prepareQC of the block this node accepted in the current view
+// note: the pipelined messages are dropped by the message handler only, so they are kept while the view is being decided
+func (bhs *BCHotstuff) readyToProposeNext() bool {
+	if bhs.PipelineView != bhs.View.ViewNumber+1 || bhs.View.LeaderNameOf(bhs.PipelineView) != bhs.GetNodeName() || bhs.NextPrepare != nil {
+		return false
+	}
+	// check meet the threshold conditions, (m > 2f+1)
+	if len(bhs.NextNewViews) <= (bhs.View.NodesNum-1)/3*2 {
+		return false
+	}
+	return bytes.Equal(bhs.NextNewViews[0].Justify.HsNode.CurHash, bhs.BlkStore.CurBlkHash)
+}
+
+// ProposeNext: the leader of the next view proposes the requests before the current view is decided,
+// whose block extends the block of the current view
+// params:
+// - req: the requests, the ones proposed in the current view are not proposed again
+// return:
+// - the prepare message of the next view
+func (bhs *BCHotstuff) ProposeNext(req []bcrequest.BCRequest) *hstypes.Msg {
+	bhs.ProposalLock.Lock()
+	defer bhs.ProposalLock.Unlock()
+
+	if !bhs.Proposed() || !bhs.readyToProposeNext() {
+		return nil
+	}
+
+	// the requests of the current view are not proposed again
+	parent := bhs.BlkStore.CurProposalBlk
+	inFlight := make(map[string]bool)
+	for _, tx := range parent.BlkData.Trans {
+		inFlight[tx] = true
+	}
+	proposal := hstypes.Proposal{
+		Height:     parent.BlkHdr.Height + 1,
+		PreBlkHash: bhs.BlkStore.CurBlkHash,
+		Commands:   make([][]byte, 0),
+		Signs:      make([][]byte, 0),
+	}
+	for i := range req {
+		if cmd := req[i].Encode(); !inFlight[string(cmd)] {
+			proposal.Commands = append(proposal.Commands, cmd)
+			proposal.Signs = append(proposal.Signs, req[i].Sign)
+		}
+	}
+	if len(proposal.Commands) == 0 {
+		return nil
+	}
+	proposal.RootHash = merkle.HashFromByteSlicesIterative(proposal.Commands)
+
+	// create new node with the new block extend from the node of the prepareQC
+	viewNumber := bhs.PipelineView
+	blk := blockchain.NewBlock(proposal.Height, proposal.PreBlkHash, viewNumber, common.TwoDimByteSlice2StringSlice(proposal.Commands))
+	justify := bhs.NextNewViews[GetHighQCIndex(&bhs.NextNewViews)].Justify
+	bhs.NextPrepare = &hstypes.Msg{
+		MType:      hstypes.PREPARE,
+		ViewNumber: viewNumber,
+		HsNode: common.HsNode{
+			ParentHash: justify.HsNode.CurHash,
+			CurHash:    blk.Hash(),
+		},
+		Justify:  justify,
+		Proposal: proposal,
+		Block:    blk,
+		SendNode: bhs.GetNodeName(),
+		ReciNode: "Broadcast",
+	}
+	return bhs.NextPrepare
+}
+
+// HandlePipelinedMsg: handle the message of the next view before the current view is decided,
+// the leader of the next view collects the new-view messages, and the other messages wait for the decide
+// params:
+// - msg: the recieved message of the next view
+func (bhs *BCHotstuff) HandlePipelinedMsg(msg *hstypes.Msg) {
+	bhs.ProposalLock.Lock()
+	defer bhs.ProposalLock.Unlock()
+
+	viewNumber := bhs.nextView()
+	if msg.MType == hstypes.NEW_VIEW {
+		// the new-view message carries the prepareQC of the current view
+		if bhs.View.LeaderNameOf(viewNumber) != bhs.GetNodeName() || bhs.NextPrepare != nil || hasSender(bhs.NextNewViews, msg) {
+			return
+		}
+		if bhs.CheckQC(msg, hstypes.PREPARE, bhs.View.ViewNumber) {
+			bhs.NextNewViews = append(bhs.NextNewViews, msg)
+		}
+		return
+	}
+
+	// the prepare message is only proposed by the leader of the next view, and this node keeps its own one
+	if msg.MType == hstypes.PREPARE && (msg.SendNode != bhs.View.LeaderNameOf(viewNumber) || msg.SendNode == bhs.GetNodeName()) {
+		return
+	}
+	if !hasSender(bhs.PipelineBuffer, msg) {
+		bhs.PipelineBuffer = append(bhs.PipelineBuffer, msg)
+	}
+}
+
+// hasSender: check whether a message of the same type from the same node has been recieved
+func hasSender(msgs []*hstypes.Msg, msg *hstypes.Msg) bool {
+	for _, m := range msgs {
+		if m.MType == msg.MType && m.SendNode == msg.SendNode {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayPipeline: after the view is decided, the leader accepts its proposal of the new view,
+// and the node handles the messages of the new view recieved before the decide
+func (bhs *BCHotstuff) ReplayPipeline() {
+	bhs.ProposalLock.Lock()
+	prepare, buffer := bhs.NextPrepare, bhs.PipelineBuffer
+	if prepare == nil {
+		// the leader which has not proposed in advance collects the new-view messages as usual
+		buffer = append(bhs.NextNewViews, buffer...)
+	}
+	if bhs.PipelineView != bhs.View.ViewNumber {
+		prepare, buffer = nil, nil
+	}
+	bhs.nextView()
+	bhs.ProposalLock.Unlock()
+
+	if prepare != nil && bhs.IsLeader() && !bhs.Proposed() {
+		bhs.acceptNextPrepare(prepare)
+	}
+	preparedView := bhs.PrepareQC.ViewNumber
+	for _, msg := range buffer {
+		msgReturn := bhs.RouteBMsg(msg)
+		if msgReturn == nil {
+			continue
+		}
+		msgReturn.SendNode = bhs.GetNodeName()
+		bhs.CurRoundMsg = append(bhs.CurRoundMsg, msgReturn)
+		bhs.SendSerMsg(msgReturn)
+	}
+	if bhs.PrepareQC.ViewNumber != preparedView && bhs.PrepareQC.ViewNumber == bhs.View.ViewNumber {
+		bhs.SendSerMsg(bhs.NextNewView())
+	}
+}
+
+// acceptNextPrepare: the leader accepts the proposal made before the decide and processes the prepare phase
+// params:
+// - prepare: the prepare message sent by this node
+func (bhs *BCHotstuff) acceptNextPrepare(prepare *hstypes.Msg) {
+	bhs.ViewTimer.Stop()
+	bhs.CurPhase = hstypes.PREPARE
+	bhs.CurProposal = prepare.Proposal
+	bhs.BlkStore.CurProposalBlk = prepare.Block
+	bhs.BlkStore.CurBlkHash = prepare.Block.Hash()
+	bhs.HsNode = prepare.HsNode
+	bhs.IgnoreCheckQC = false
+	bhs.CurRoundMsg = append(bhs.CurRoundMsg, prepare)
+	bhs.LeaderVote(hstypes.PREPARE)
+
+	bhs.ViewTimer.Start(func() {
+		bhs.StartViewChange()
+	}, func() {
+	})
+}
@@ -30,8 +30,9 @@ func (bhs *BCHotstuff) HandlePrepareVote(msg *hstypes.Msg) *hstypes.Msg {
 		return nil
 	}
 
-	// check whether message's type and view number are matching current view
-	if bhs.MatchingMsg(msg, hstypes.PREPARE_VOTE, bhs.View.ViewNumber) {
+	// check whether message's type and view number are matching current view,
+	// and the vote is the first one of its sender for the node of this phase
+	if bhs.MatchingMsg(msg, hstypes.PREPARE_VOTE, bhs.View.ViewNumber) && bhs.CheckVote(bhs.PrepareVotes, msg) {
 		bhs.PrepareVotes = append(bhs.PrepareVotes, msg)
 	}
 
@@ -57,7 +58,9 @@ func (bhs *BCHotstuff) HandlePrepareVote(msg *hstypes.Msg) *hstypes.Msg {
 	// update the local prepareQC
 	// change the local phase to pre-commit
 	bhs.PrepareQC = prepareQC
+	bhs.CertifyQC(&bhs.PrepareQC)
 	bhs.CurPhase = hstypes.PRE_COMMIT
+	bhs.LeaderVote(hstypes.PRE_COMMIT)
 
 	// log
 	// bhs.Logger.Println("[PRE-COMMIT]", bhs.GetNodeName(), "ViewNumber:", bhs.View.ViewNumber)
@@ -108,6 +111,7 @@ func (bhs *BCHotstuff) HandlePreCommit(msg *hstypes.Msg) *hstypes.Msg {
 	// update local hotstuff node and prepareQC
 	bhs.HsNode = msg.Justify.HsNode
 	bhs.PrepareQC = msg.Justify
+	bhs.CertifyQC(&msg.Justify)
 
 	// generate the pre-commit vote and sign for it
 	preComVote := hstypes.Msg{
@@ -12,7 +12,14 @@ import (
 //
 // if m.node extends fromm.justify.node ∧  safeNode(m.node, m.justify) then
 // send voteMsg(prepare, m.node, ⊥) to leader(curView)
-func (bhs *BCHotstuff) HandlePrepare(msg *hstypes.Msg, pk []byte) *hstypes.Msg {
+func (bhs *BCHotstuff) HandlePrepare(msg *hstypes.Msg) *hstypes.Msg {
+
+	// the replica which is late for the view change recieves the prepare message before it enters the view,
+	// so the one of the leader is kept until then
+	if msg.ViewNumber > bhs.View.ViewNumber {
+		bhs.KeepLaterPrepare(msg)
+		return nil
+	}
 
 	// check whether the node state is new-view phase
 	if bhs.CurPhase != hstypes.NEW_VIEW {
@@ -34,14 +41,18 @@ func (bhs *BCHotstuff) HandlePrepare(msg *hstypes.Msg, pk []byte) *hstypes.Msg {
 		return nil
 	}
 
-	// check whether this message's node is valid
-	if bhs.View.ViewNumber != 0 && !bhs.CheckNewHsNode(msg) {
+	// check whether this message's node is valid, the QC isn't checked in view 0 or the first round after the handover
+	if bhs.View.ViewNumber != 0 && !bhs.IgnoreCheckQC && !bhs.CheckNewHsNode(msg) {
 		return nil
 	}
+	// the leaders of the later views are elected by the chain of the QC which the proposal extends
+	bhs.CertifyQC(&msg.Justify)
 
-	if !bhs.VerifyReqs(msg.Proposal.Commands, msg.Proposal.Signs, pk) {
+	if !bhs.VerifyReqs(msg.Proposal.Commands, msg.Block) {
+		bhs.rejectProposal()
 		return nil
 	}
+	bhs.IgnoreCheckQC = false
 
 	bhs.ViewTimer.Stop()
 
@@ -84,3 +95,49 @@ func (bhs *BCHotstuff) HandlePrepare(msg *hstypes.Msg, pk []byte) *hstypes.Msg {
 
 	return &prepareVote
 }
+
+// KeepLaterPrepare: keep the prepare message of a later view proposed by the leader of that view
+// params:
+// - msg: the recieved prepare message of a later view
+func (bhs *BCHotstuff) KeepLaterPrepare(msg *hstypes.Msg) {
+	if msg.SendNode != bhs.View.LeaderNameOf(msg.ViewNumber) {
+		return
+	}
+	bhs.ProposalLock.Lock()
+	defer bhs.ProposalLock.Unlock()
+	if bhs.LaterPrepare == nil || bhs.LaterPrepare.ViewNumber < msg.ViewNumber {
+		bhs.LaterPrepare = msg
+	}
+}
+
+// ReplayLaterPrepare: handle the kept prepare message once the node enters its view, and send the vote to the leader
+func (bhs *BCHotstuff) ReplayLaterPrepare() {
+	bhs.ProposalLock.Lock()
+	prepare := bhs.LaterPrepare
+	if prepare != nil && prepare.ViewNumber <= bhs.View.ViewNumber {
+		bhs.LaterPrepare = nil
+	}
+	bhs.ProposalLock.Unlock()
+	if prepare == nil || prepare.ViewNumber != bhs.View.ViewNumber {
+		return
+	}
+
+	msgReturn := bhs.HandlePrepare(prepare)
+	if msgReturn == nil {
+		return
+	}
+	msgReturn.SendNode = bhs.GetNodeName()
+	bhs.CurRoundMsg = append(bhs.CurRoundMsg, msgReturn)
+	bhs.SendSerMsg(msgReturn)
+}
+
+// rejectProposal: the replica which rejects the proposal of the leader starts the view timer if the view was not entered by the timer,
+// such as the first view, so that it changes the view with the others instead of waiting for the leader forever
+func (bhs *BCHotstuff) rejectProposal() {
+	if bhs.ViewTimer.IsStopped {
+		bhs.ViewTimer.Start(func() {
+			bhs.StartViewChange()
+		}, func() {
+		})
+	}
+}
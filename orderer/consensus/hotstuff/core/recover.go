@@ -0,0 +1,249 @@
+package core
+
+import (
+	"blockchain"
+	common "common"
+	hstypes "hotstuff/types"
+	"statemachine"
+)
+
+// BasicState: the persisted state of basic hotstuff, which is saved when the view, the lock or the last vote advances
+// and reloaded when the node restarts
+type BasicState struct {
+	View       common.View           // the view which the node has entered
+	HsNode     common.HsNode         // the hotstuff node of the last view
+	PrepareQC  hstypes.QC            // the highest QC for which the node voted pre-commit
+	LockedQC   hstypes.QC            // the locked QC for which the node voted commit
+	VotedView  int                   // the last view in which the node voted
+	VotedPhase hstypes.StateType     // the phase of the last vote
+	BlkStore   blockchain.StoreState // the state of block store
+}
+
+// SaveState: persist the view, the QCs, the last vote and the block store state
+func (bhs *BCHotstuff) SaveState() {
+	err := bhs.BlkStore.SaveState(&BasicState{
+		View:       bhs.View,
+		HsNode:     bhs.HsNode,
+		PrepareQC:  bhs.PrepareQC,
+		LockedQC:   bhs.LockedQC,
+		VotedView:  bhs.VotedView,
+		VotedPhase: bhs.VotedPhase,
+		BlkStore:   bhs.BlkStore.GetStoreState(),
+	})
+	if err != nil {
+		bhs.Logger.Println("[ERROR]:", bhs.GetNodeName(), "save state", err)
+	}
+}
+
+// Recover: restart basic hotstuff from the local block store
+// the committed blocks are replayed to the state machine and the persisted state is reloaded,
+// then the node stays in the new-view phase of the persisted view, or the view after its last vote, and waits for Rejoin
+// return:
+// - true if there is local data to recover from, and error
+func (bhs *BCHotstuff) Recover() (bool, error) {
+	tip, err := bhs.BlkStore.Recover()
+	if err != nil {
+		return false, err
+	}
+	if err := statemachine.Replay(bhs.StateMachine, &bhs.BlkStore); err != nil {
+		return false, err
+	}
+
+	var state BasicState
+	ok, err := bhs.BlkStore.LoadState(&state)
+	if err != nil {
+		return false, err
+	}
+	if !ok && tip == nil {
+		return false, nil
+	}
+	if ok {
+		bhs.View.Restore(state.View)
+		bhs.HsNode = state.HsNode
+		bhs.PrepareQC = state.PrepareQC
+		bhs.LockedQC = state.LockedQC
+		bhs.VotedView, bhs.VotedPhase = state.VotedView, state.VotedPhase
+		bhs.BlkStore.SetStoreState(state.BlkStore)
+	}
+
+	// the proposal which the node voted for in the persisted view is lost, so the node goes past the view
+	// instead of voting again in it, which may be for a conflicting proposal of an equivocating leader
+	for bhs.View.ViewNumber <= bhs.VotedView {
+		bhs.View.NextView()
+	}
+
+	// the block of tip may be stored without saving the state when crashing,
+	// the node never goes back to the view of a committed block
+	if tip != nil {
+		for bhs.View.ViewNumber <= tip.BlkHdr.ViewNumber {
+			bhs.View.NextView()
+		}
+		if bhs.BlkStore.Height <= tip.BlkHdr.Height {
+			bhs.BlkStore.Height = tip.BlkHdr.Height + 1
+			bhs.BlkStore.PreBlkHash = tip.Hash()
+		}
+	}
+
+	// drop the messages and the state of view 0 set by InitLeader
+	view := bhs.View
+	bhs.NewRound()
+	bhs.View = view
+	bhs.CurPhase = hstypes.NEW_VIEW
+	bhs.IgnoreCheckQC = false
+	bhs.CurProposal = hstypes.Proposal{}
+	bhs.LastRoundMsg = []*hstypes.Msg{{ViewNumber: bhs.PrepareQC.ViewNumber}}
+
+	// set the view timer to enter the next view with the others if the recovered view doesn't go on
+	bhs.ViewTimer.Start(func() {
+		bhs.StartViewChange()
+	}, func() {
+	})
+	return true, nil
+}
+
+// Rejoin: send the new-view message of the recovered view to its leader,
+// the leader of the recovered view has lost the new-view messages and may have proposed,
+// so it starts the view-change at once and waits for the replicas in the next view
+// return:
+// - the new-view message, or nil for the leader
+func (bhs *BCHotstuff) Rejoin() *hstypes.Msg {
+	if bhs.GetLeaderName() == bhs.GetNodeName() {
+		bhs.StartViewChange()
+		return nil
+	}
+	return &hstypes.Msg{
+		MType:      hstypes.NEW_VIEW,
+		ViewNumber: bhs.View.ViewNumber,
+		SendNode:   bhs.GetNodeName(),
+		Justify:    bhs.PrepareQC,
+		ReciNode:   bhs.GetLeaderName(),
+	}
+}
+
+// Handover: start basic hotstuff on the tip committed by another consensus protocol, which has no prepareQC of this protocol,
+// so the first proposal isn't checked by the QC as the one in view 0, and the leader waits for the requests to propose
+func (bhs *BCHotstuff) Handover() {
+	bhs.IgnoreCheckQC = true
+	if bhs.GetLeaderName() == bhs.GetNodeName() {
+		bhs.InitLeader()
+	}
+}
+
+// ChainedState: the persisted state of chained hotstuff, which is saved when the view, the lock or the last vote advances
+// and reloaded when the node restarts
+type ChainedState struct {
+	View      common.View           // the view which the node has entered
+	HsNodes   [4]common.HsNode      // the 4 hotstuff nodes in the pipeline
+	Blocks    [4]blockchain.Block   // the 4 blocks in the pipeline which are not all committed
+	GenericQC hstypes.ChainedQC     // the highest generic QC
+	LockedQC  hstypes.ChainedQC     // the locked QC
+	VotedView int                   // the last view in which the node voted
+	BlkStore  blockchain.StoreState // the state of block store
+}
+
+// SaveState: persist the view, the pipeline, the QCs, the last vote and the block store state
+func (chs *CHotstuff) SaveState() {
+	err := chs.BlkStore.SaveState(&ChainedState{
+		View:      chs.View,
+		HsNodes:   chs.HsNodes,
+		Blocks:    chs.Blocks,
+		GenericQC: chs.GenericQC,
+		LockedQC:  chs.LockedQC,
+		VotedView: chs.VotedView,
+		BlkStore:  chs.BlkStore.GetStoreState(),
+	})
+	if err != nil {
+		chs.Logger.Println("[ERROR]:", chs.GetNodeName(), "save state", err)
+	}
+}
+
+// Recover: restart chained hotstuff from the local block store
+// the committed blocks are replayed to the state machine and the persisted state is reloaded,
+// then the node stays in the new-view phase of the persisted view, or the view after its last vote, and waits for Rejoin
+// return:
+// - true if there is local data to recover from, and error
+func (chs *CHotstuff) Recover() (bool, error) {
+	tip, err := chs.BlkStore.Recover()
+	if err != nil {
+		return false, err
+	}
+	if err := statemachine.Replay(chs.StateMachine, &chs.BlkStore); err != nil {
+		return false, err
+	}
+
+	var state ChainedState
+	ok, err := chs.BlkStore.LoadState(&state)
+	if err != nil {
+		return false, err
+	}
+	if !ok && tip == nil {
+		return false, nil
+	}
+	if ok {
+		chs.View.Restore(state.View)
+		chs.HsNodes = state.HsNodes
+		chs.Blocks = state.Blocks
+		chs.GenericQC = state.GenericQC
+		chs.LockedQC = state.LockedQC
+		chs.VotedView = state.VotedView
+		chs.BlkStore.SetStoreState(state.BlkStore)
+	}
+
+	// the node goes past the view it voted in before crashing instead of voting again in it
+	for chs.View.ViewNumber <= chs.VotedView {
+		chs.View.NextView()
+	}
+
+	// the node never goes back to the view of a committed block
+	if tip != nil {
+		for chs.View.ViewNumber <= tip.BlkHdr.ViewNumber {
+			chs.View.NextView()
+		}
+	}
+
+	// drop the messages and the state of view 0 set by InitLeader
+	view := chs.View
+	chs.NewRound()
+	chs.View = view
+	chs.CurPhase = hstypes.NEW_VIEW
+	chs.CurProposal = hstypes.Proposal{}
+	chs.ExecuteState = false
+	chs.LastLeaderState = false
+	chs.ViewChangeFlag = false
+
+	// set the view timer to enter the next view with the others if the recovered view doesn't go on
+	chs.ViewTimer.Start(func() {
+		chs.StartViewChange()
+	}, func() {
+	})
+	return true, nil
+}
+
+// Rejoin: send the new-view message of the recovered view to its leader,
+// the leader of the recovered view has lost the new-view messages and may have proposed,
+// so it sends nothing and enters the next view by the view timer together with the replicas
+// waiting for its proposal, since the pipeline goes on only if the views of the nodes are the same
+// return:
+// - the new-view message, or nil for the leader
+func (chs *CHotstuff) Rejoin() *hstypes.CMsg {
+	if chs.GetChainedCurLeader() == chs.GetNodeName() {
+		return nil
+	}
+	return &hstypes.CMsg{
+		MType:      hstypes.NEW_VIEW,
+		ViewNumber: chs.View.ViewNumber,
+		SendNode:   chs.GetNodeName(),
+		HsNodes:    chs.HsNodes,
+		Justify:    chs.GenericQC,
+		ReciNode:   chs.GetChainedCurLeader(),
+	}
+}
+
+// Handover: start chained hotstuff on the tip committed by another consensus protocol, which has no generic QC of this protocol,
+// so the leader proposes the first block on the empty pipeline as the one in view 0 without waiting for the new-view messages
+func (chs *CHotstuff) Handover() {
+	if chs.GetChainedCurLeader() == chs.GetNodeName() {
+		chs.InitLeader()
+		chs.FixLeader()
+	}
+}
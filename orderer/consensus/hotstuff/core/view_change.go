@@ -10,7 +10,12 @@ import (
 // send Msg(new-view, ⊥, prepareQC) to leader(curView + 1)
 func (bhs *BCHotstuff) StartViewChange() {
 	// update the view number to expect to enter
+	// the votes and the new-view messages of the abandoned view are dropped
 	bhs.View.NextView()
+	bhs.NewViewMsgs = make([]*hstypes.Msg, 0)
+	bhs.PrepareVotes = make([]*hstypes.Msg, 0)
+	bhs.PreCommitVotes = make([]*hstypes.Msg, 0)
+	bhs.CommitVotes = make([]*hstypes.Msg, 0)
 
 	// generate new-view message
 	newViewMsg := hstypes.Msg{
@@ -55,4 +60,7 @@ func (bhs *BCHotstuff) StartViewChange() {
 	}, func() {
 		// bhs.Logger.Println("StartViewChange View Timer stop", bhs.GetNodeName())
 	})
+
+	// the prepare message of the new view may be recieved before the view change
+	bhs.ReplayLaterPrepare()
 }
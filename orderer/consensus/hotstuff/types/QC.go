@@ -1,6 +1,9 @@
 package hstypes
 
-import common "common"
+import (
+	"canonical"
+	common "common"
+)
 
 // QC: qurom certificate
 type QC struct {
@@ -10,9 +13,25 @@ type QC struct {
 	Sign       []byte        // part signature or complete signature
 }
 
-// QC2SignMsgByte: convert QC to signed message's byte slice
+// QC2SignMsgByte: convert QC to signed message's byte slice, which is the same as the voted message
 func (q *QC) QC2SignMsgByte() []byte {
-	return append([]byte{byte(q.QType), byte(q.ViewNumber)}, q.HsNode.Object2Byte()...)
+	e := canonical.NewEncoder(canonical.TAG_HOTSTUFF_VOTE).Uint8(uint8(q.QType)).Int(q.ViewNumber)
+	return q.HsNode.Encode(e).Encoded()
+}
+
+// DecodeQC: decode the signed message of QC, such as the validation message of the committed block
+// params:
+// - b: the bytes written by QC2SignMsgByte
+// return:
+// - the QC without signature, and error
+func DecodeQC(b []byte) (*QC, error) {
+	q := &QC{}
+	d := canonical.NewDecoder(canonical.TAG_HOTSTUFF_VOTE, b)
+	q.QType, q.ViewNumber = StateType(d.Uint8()), d.Int()
+	if err := q.HsNode.Decode(d).Finish(); err != nil {
+		return nil, err
+	}
+	return q, nil
 }
 
 const MsgBufferLength uint8 = 8
@@ -1,6 +1,9 @@
 package hstypes
 
-import common "common"
+import (
+	"canonical"
+	common "common"
+)
 
 // ChainedQC: qurom certificate in chained hotstuff
 type ChainedQC struct {
@@ -9,3 +12,30 @@ type ChainedQC struct {
 	HsNodes    [4]common.HsNode // four qurom certificate nodes
 	Sign       []byte           // part signature or complete signature
 }
+
+// QC2SignMsgByte: convert chained QC to signed message's byte slice, which is the same as the voted generic message
+func (q *ChainedQC) QC2SignMsgByte() []byte {
+	e := canonical.NewEncoder(canonical.TAG_CHAINED_VOTE).Uint8(uint8(q.QType)).Int(q.ViewNumber)
+	for i := range q.HsNodes {
+		q.HsNodes[i].Encode(e)
+	}
+	return e.Encoded()
+}
+
+// DecodeChainedQC: decode the signed message of chained QC, such as the validation message of the committed block
+// params:
+// - b: the bytes written by QC2SignMsgByte
+// return:
+// - the chained QC without signature, and error
+func DecodeChainedQC(b []byte) (*ChainedQC, error) {
+	q := &ChainedQC{}
+	d := canonical.NewDecoder(canonical.TAG_CHAINED_VOTE, b)
+	q.QType, q.ViewNumber = StateType(d.Uint8()), d.Int()
+	for i := range q.HsNodes {
+		q.HsNodes[i].Decode(d)
+	}
+	if err := d.Finish(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
@@ -2,6 +2,7 @@ package hstypes
 
 import (
 	"blockchain"
+	"canonical"
 	common "common"
 )
 
@@ -16,6 +17,8 @@ type CMsg struct {
 	PartialSig []byte           // part signature
 	Proposal   Proposal         // the new proposal
 	Blk        blockchain.Block // block
+
+	Results []string `json:"Results,omitempty"` // the results of executed commands which reply to the client
 }
 
 // ChainedMessage2Byte: convert chained message to byte slice
@@ -23,9 +26,9 @@ type CMsg struct {
 // - the byte slice of chined message
 // note: the difference is that chained message has four hotstuff node but basic message has only one
 func (cm *CMsg) ChainedMessage2Byte() []byte {
-	qcByte := []byte{byte(cm.MType), byte(cm.ViewNumber)}
+	e := canonical.NewEncoder(canonical.TAG_CHAINED_VOTE).Uint8(uint8(cm.MType)).Int(cm.ViewNumber)
 	for i := range cm.HsNodes {
-		qcByte = append(qcByte, cm.HsNodes[i].Object2Byte()...)
+		cm.HsNodes[i].Encode(e)
 	}
-	return qcByte
+	return e.Encoded()
 }
@@ -2,6 +2,7 @@ package hstypes
 
 import (
 	"blockchain"
+	"canonical"
 	common "common"
 )
 
@@ -18,9 +19,12 @@ type Msg struct {
 	Block    blockchain.Block // the proposed block in the view
 	SendNode string           // the message send node
 	ReciNode string           // the message recieve node
+
+	Results []string `json:"Results,omitempty"` // the results of executed commands which reply to the client
 }
 
-// Message2Byte: convert message to byte slice
+// Message2Byte: convert message to the signed byte slice by the canonical encoding, which is the same as the QC of the vote
 func (m *Msg) Message2Byte() []byte {
-	return append([]byte{byte(m.MType), byte(m.ViewNumber)}, m.HsNode.Object2Byte()...)
+	e := canonical.NewEncoder(canonical.TAG_HOTSTUFF_VOTE).Uint8(uint8(m.MType)).Int(m.ViewNumber)
+	return m.HsNode.Encode(e).Encoded()
 }
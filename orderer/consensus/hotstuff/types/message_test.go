@@ -0,0 +1,47 @@
+package hstypes_test
+
+import (
+	"bytes"
+	common "common"
+	"encoding/hex"
+	hstypes "hotstuff/types"
+	"testing"
+)
+
+// TestSignedBytes: test the golden vectors of the signed bytes of messages, the QC is verified by the bytes signed by the votes,
+// so they must be the same, and the view numbers which wrap in a byte get different bytes
+func TestSignedBytes(t *testing.T) {
+	node := common.HsNode{CurHash: []byte{1, 2}, ParentHash: []byte{3}}
+
+	m := hstypes.Msg{MType: hstypes.PREPARE_VOTE, ViewNumber: 257, HsNode: node}
+	golden := "0000001f646373636861696e2f686f7473747566662f62617369632f766f74652f7631" + "02" + "0000000000000101" + "00000002010200000001" + "03"
+	if hex.EncodeToString(m.Message2Byte()) != golden {
+		t.Fatalf("message: expected %s, got %x", golden, m.Message2Byte())
+	}
+	qc := hstypes.QC{QType: m.MType, ViewNumber: m.ViewNumber, HsNode: node}
+	if !bytes.Equal(qc.QC2SignMsgByte(), m.Message2Byte()) {
+		t.Fatal("QC signed bytes are different from the vote")
+	}
+	wrapped := m
+	wrapped.ViewNumber = 1
+	if bytes.Equal(wrapped.Message2Byte(), m.Message2Byte()) {
+		t.Fatal("wrapped view number collision")
+	}
+
+	cm := hstypes.CMsg{MType: hstypes.GENERIC, ViewNumber: 257, HsNodes: [4]common.HsNode{node, node, node, node}}
+	golden = "00000021646373636861696e2f686f7473747566662f636861696e65642f766f74652f7631" + "0a" + "0000000000000101" +
+		"0000000201020000000103000000020102000000010300000002010200000001030000000201020000000103"
+	if hex.EncodeToString(cm.ChainedMessage2Byte()) != golden {
+		t.Fatalf("chained message: expected %s, got %x", golden, cm.ChainedMessage2Byte())
+	}
+	cqc := hstypes.ChainedQC{QType: cm.MType, ViewNumber: cm.ViewNumber, HsNodes: cm.HsNodes}
+	if !bytes.Equal(cqc.QC2SignMsgByte(), cm.ChainedMessage2Byte()) {
+		t.Fatal("chained QC signed bytes are different from the vote")
+	}
+
+	p := hstypes.Proposal{Height: 300, PreBlkHash: []byte{1}, RootHash: []byte{2}, Commands: [][]byte{[]byte("a"), []byte("bc")}}
+	golden = "9b2ca8ed498523597a4c783529fbe3bfad64c1e7ba9646a65dba8840b39776db"
+	if hex.EncodeToString(p.GenProposalHash()) != golden {
+		t.Fatalf("proposal hash: expected %s, got %x", golden, p.GenProposalHash())
+	}
+}
@@ -1,7 +1,7 @@
 package hstypes
 
 import (
-	common "common"
+	"canonical"
 	"merkle"
 )
 
@@ -26,10 +26,7 @@ func (p *Proposal) GenProposalHash() []byte {
 	if p.IsEmpty() {
 		return merkle.EmptyHash()
 	}
-	proContent := make([]byte, 0)
-	proContent = append(proContent, byte(p.Height))
-	proContent = append(proContent, p.PreBlkHash...)
-	proContent = append(proContent, p.RootHash...)
-	proContent = append(proContent, common.TwoDimByteSlice2OneDimByteSlice(p.Commands)...)
-	return merkle.Sum(proContent)
+	e := canonical.NewEncoder(canonical.TAG_HOTSTUFF_PROPOSAL)
+	e.Int(p.Height).Bytes(p.PreBlkHash).Bytes(p.RootHash).BytesList(p.Commands)
+	return merkle.Sum(e.Encoded())
 }
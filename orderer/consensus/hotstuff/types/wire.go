@@ -0,0 +1,95 @@
+package hstypes
+
+import "wire"
+
+// EncodeWire: write the basic hotstuff message to the binary codec
+func (msg *Msg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(msg.MType)).Uint8(uint8(msg.NMType)).Int(msg.ViewNumber)
+	msg.HsNode.EncodeWire(w)
+	msg.Justify.EncodeWire(w)
+	w.Bytes(msg.PartialSig)
+	msg.Proposal.EncodeWire(w)
+	msg.Block.EncodeWire(w)
+	w.String(msg.SendNode).String(msg.ReciNode).Strings(msg.Results)
+}
+
+// DecodeWire: read the basic hotstuff message from the binary codec
+func (msg *Msg) DecodeWire(r *wire.Reader) {
+	msg.MType, msg.NMType, msg.ViewNumber = StateType(r.Uint8()), StateType(r.Uint8()), r.Int()
+	msg.HsNode.DecodeWire(r)
+	msg.Justify.DecodeWire(r)
+	msg.PartialSig = r.Bytes()
+	msg.Proposal.DecodeWire(r)
+	msg.Block.DecodeWire(r)
+	msg.SendNode, msg.ReciNode, msg.Results = r.String(), r.String(), r.Strings()
+}
+
+// EncodeWire: write the QC to the binary codec
+func (qc *QC) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(qc.QType)).Int(qc.ViewNumber)
+	qc.HsNode.EncodeWire(w)
+	w.Bytes(qc.Sign)
+}
+
+// DecodeWire: read the QC from the binary codec
+func (qc *QC) DecodeWire(r *wire.Reader) {
+	qc.QType, qc.ViewNumber = StateType(r.Uint8()), r.Int()
+	qc.HsNode.DecodeWire(r)
+	qc.Sign = r.Bytes()
+}
+
+// EncodeWire: write the proposal to the binary codec
+func (p *Proposal) EncodeWire(w *wire.Writer) {
+	w.Int(p.Height).Bytes(p.PreBlkHash).Bytes(p.RootHash).BytesList(p.Commands).BytesList(p.Signs)
+	p.Qc.EncodeWire(w)
+}
+
+// DecodeWire: read the proposal from the binary codec
+func (p *Proposal) DecodeWire(r *wire.Reader) {
+	p.Height, p.PreBlkHash, p.RootHash, p.Commands, p.Signs = r.Int(), r.Bytes(), r.Bytes(), r.BytesList(), r.BytesList()
+	p.Qc.DecodeWire(r)
+}
+
+// EncodeWire: write the chained hotstuff message to the binary codec
+func (cMsg *CMsg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(cMsg.MType)).Int(cMsg.ViewNumber).String(cMsg.SendNode).String(cMsg.ReciNode)
+	for i := range cMsg.HsNodes {
+		cMsg.HsNodes[i].EncodeWire(w)
+	}
+	cMsg.Justify.EncodeWire(w)
+	w.Bytes(cMsg.PartialSig)
+	cMsg.Proposal.EncodeWire(w)
+	cMsg.Blk.EncodeWire(w)
+	w.Strings(cMsg.Results)
+}
+
+// DecodeWire: read the chained hotstuff message from the binary codec
+func (cMsg *CMsg) DecodeWire(r *wire.Reader) {
+	cMsg.MType, cMsg.ViewNumber, cMsg.SendNode, cMsg.ReciNode = StateType(r.Uint8()), r.Int(), r.String(), r.String()
+	for i := range cMsg.HsNodes {
+		cMsg.HsNodes[i].DecodeWire(r)
+	}
+	cMsg.Justify.DecodeWire(r)
+	cMsg.PartialSig = r.Bytes()
+	cMsg.Proposal.DecodeWire(r)
+	cMsg.Blk.DecodeWire(r)
+	cMsg.Results = r.Strings()
+}
+
+// EncodeWire: write the chained QC to the binary codec
+func (cqc *ChainedQC) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(cqc.QType)).Int(cqc.ViewNumber)
+	for i := range cqc.HsNodes {
+		cqc.HsNodes[i].EncodeWire(w)
+	}
+	w.Bytes(cqc.Sign)
+}
+
+// DecodeWire: read the chained QC from the binary codec
+func (cqc *ChainedQC) DecodeWire(r *wire.Reader) {
+	cqc.QType, cqc.ViewNumber = StateType(r.Uint8()), r.Int()
+	for i := range cqc.HsNodes {
+		cqc.HsNodes[i].DecodeWire(r)
+	}
+	cqc.Sign = r.Bytes()
+}
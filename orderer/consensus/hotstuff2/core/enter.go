@@ -17,11 +17,11 @@ func (hs2 *Hotstuff2) HandleNewView(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	}
 
 	// check this message carrying two qurom certification
-	if !hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.BlkStore.Height) {
+	if msg.Justify1.QType != hs2types.NEW_VIEW && !hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.CertifiedHeight(&msg.Justify1)) {
 		fmt.Println("[ERROR]: HandleNewView CheckQC1", msg.SendNode, msg)
 		return nil
 	}
-	if !hs2.CheckQC(&msg.Justify2, hs2types.PREPARE, msg.Justify2.ViewNumber, msg.Justify2.Height) {
+	if msg.Justify2.QType != hs2types.NEW_VIEW && !hs2.CheckQC(&msg.Justify2, hs2types.PREPARE, msg.Justify2.ViewNumber, msg.Justify2.Height) {
 		fmt.Println("[ERROR]: HandleNewView CheckQC2", msg.SendNode, msg)
 		return nil
 	}
@@ -97,6 +97,7 @@ func (hs2 *Hotstuff2) HandleOptimisticEnter(msg *hs2types.H2Msg) *hs2types.H2Msg
 	} else {
 		hs2.CurPhase = hs2types.NEW_VIEW
 		hs2.PrepareQC = msg.Justify2
+		hs2.CertifyQC(&hs2.PrepareQC)
 		// hs2.Logger.Println("[Optime replica]:", hs2.GetNodeName(), hs2.View.ViewNumber, " Succeed!")
 		return nil
 	}
@@ -117,6 +118,11 @@ func (hs2 *Hotstuff2) HandleTC(msg *hs2types.H2Msg) *hs2types.H2Msg {
 		return nil
 	}
 
+	// the TC sent again to the party which missed it is ignored by the parties which have entered the view
+	if hs2.View.ViewNumber >= msg.ViewNumber {
+		return nil
+	}
+
 	// update the local view to proposed view in message, reset the pacemaker OptimisticFlag
 	// hs2.View.ViewNumber = msg.ViewNumber
 	for hs2.View.ViewNumber < msg.ViewNumber {
@@ -156,6 +162,7 @@ func (hs2 *Hotstuff2) HandleTC(msg *hs2types.H2Msg) *hs2types.H2Msg {
 				// hs2.Logger.Println("[TIMER-EXPIRE]:", hs2.GetNodeName())
 				msg := &hs2types.H2Msg{
 					MType:    hs2types.NEW_PROPOSE,
+					SendNode: hs2.GetNodeName(),
 					ReciNode: hs2.GetNodeName(),
 				}
 				msgJson, err := json.Marshal(msg)
@@ -11,8 +11,8 @@ package core
 import (
 	"bcrequest"
 	"blockchain"
+	"bytes"
 	common "common"
-	"encoding/json"
 	"fmt"
 	"hotstuff2/pacemaker"
 	hs2types "hotstuff2/types"
@@ -21,10 +21,12 @@ import (
 	"message"
 	"mgmt"
 	"os"
+	"statemachine"
 	"strconv"
 	"sync"
 	"time"
 	"tss"
+	"wire"
 )
 
 // Hotstuff2: the hotstuff-2 consensus core
@@ -38,6 +40,8 @@ type Hotstuff2 struct {
 	ProposalLock sync.Mutex
 	ProposalQC   hs2types.QuromCert // highest locked single certification, the name and meaning is the same as hotstuff
 	PrepareQC    hs2types.QuromCert // highest locked double certification, the name and meaning is the same as hotstuff
+	VotedView    int                // the last view in which the node voted, it is persisted before the vote is sent
+	VotedPhase   hs2types.StateType // the phase of the last vote, hs2types.VOTE1 or hs2types.VOTE2
 
 	LockBlk     []*blockchain.Block // local locked block which is consist of all blocks that have been voted(refer to Vote2) but have not yet been committed
 	LockHs2Node []common.HsNode     // local locked Node which is consist of all Nodes that have been voted(refer to Vote2) but have not yet been committed
@@ -50,12 +54,17 @@ type Hotstuff2 struct {
 	Vote1        []*hs2types.H2Msg // the collection of vote1 messages this node recieved
 	Vote2        []*hs2types.H2Msg // the collection of vote2 messages this node recieved
 
-	BlkStore        blockchain.BlockStore  // generate and store blocks
-	PM              pacemaker.Pacemaker    // the pacemaker in the same paper controls the activity of consensus
-	ForwardChan     chan []byte            // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
-	SendChan        chan message.ServerMsg // the channel listened by a node can send messages in the channel to the corresponding node on the network
-	Logger          log.Logger             `json:"logger"` // the role of recording logs
-	ThresholdSigner *tss.Signer            `json:"Signer"` // the role responsible for threshold signatures
+	BlkStore        blockchain.BlockStore     // generate and store blocks
+	PM              pacemaker.Pacemaker       // the pacemaker in the same paper controls the activity of consensus
+	ForwardChan     chan []byte               // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
+	SendChan        chan message.ServerMsg    // the channel listened by a node can send messages in the channel to the corresponding node on the network
+	Codec           wire.Codec                // the codec of the consensus messages sent to the replicas, the zero value is JSON
+	Logger          log.Logger                `json:"logger"` // the role of recording logs
+	ThresholdSigner *tss.Signer               `json:"Signer"` // the role responsible for threshold signatures
+	StateMachine    statemachine.StateMachine // the replicated application which executes the committed commands
+	ExecResults     []string                  // the results of the last executed commands
+	ExecTxs         []string                  // the transactions of the last executed commands, whose clients get the results
+	ReqValidator    *bcrequest.Validator      // the validator of client requests, the proposed block is not checked if it is nil
 }
 
 // NewHotstuff2: create an instance of a new consensus of hotstuff-2
@@ -77,7 +86,8 @@ func NewHotstuff2(enterTD int, viewTD int, consId int, nodeNum int, path string,
 			NodesNum:   nodeNum,
 			Leader:     0,
 		},
-		ConsId: consId,
+		ConsId:    consId,
+		VotedView: -1,
 
 		Logger: *log.New(os.Stdout, "", 0),
 		PM: pacemaker.Pacemaker{
@@ -94,6 +104,7 @@ func NewHotstuff2(enterTD int, viewTD int, consId int, nodeNum int, path string,
 		ThresholdSigner: signer,
 		SendChan:        sendChan,
 		IgnoreCheckQC:   false,
+		StateMachine:    statemachine.NewStateMachine(),
 	}
 
 	newHotstuff2.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
@@ -107,12 +118,23 @@ func (hs2 *Hotstuff2) HandleH2Msg(msgJson []byte) {
 	var msg hs2types.H2Msg
 
 	// convert json to message
-	json.Unmarshal(msgJson, &msg)
+	wire.Unmarshal(msgJson, &msg)
 	// fmt.Println(msg.MType, msg.SendNode, msg.ReciNode)
 
 	// submit the chained message to hotstuff-2 and get its return messages
+	phase, view := hs2.CurPhase, hs2.View.ViewNumber
+	proposalView, prepareView := hs2.ProposalQC.ViewNumber, hs2.PrepareQC.ViewNumber
+	votedView, votedPhase := hs2.VotedView, hs2.VotedPhase
 	msgReturn := hs2.RouteH2Msg(&msg)
 
+	// persist the state before sending any message if the phase, the view, the certifications or the last vote advanced,
+	// so that the node never votes twice in a view after restarting
+	if hs2.CurPhase != phase || hs2.View.ViewNumber != view ||
+		hs2.ProposalQC.ViewNumber != proposalView || hs2.PrepareQC.ViewNumber != prepareView ||
+		hs2.VotedView != votedView || hs2.VotedPhase != votedPhase {
+		hs2.SaveState()
+	}
+
 	// send its return messages and execute
 	if msgReturn != nil {
 
@@ -120,12 +142,17 @@ func (hs2 *Hotstuff2) HandleH2Msg(msgJson []byte) {
 		msgReturn.SendNode = hs2.GetNodeName()
 		hs2.CurRoundMsgs = append(hs2.CurRoundMsgs, msgReturn)
 		if msgReturn.MType == hs2types.ENTER {
-			go hs2.SendSerMsg(&hs2types.H2Msg{
-				ViewNumber: hs2.View.ViewNumber - 1,
-				// Hs2Node:    hs2.LockHs2Node[0],
-				SendNode: hs2.GetNodeName(),
-				ReciNode: "Client",
-			})
+			// each client gets the results of its own requests
+			for _, reply := range bcrequest.GroupResults(hs2.ExecTxs, hs2.ExecResults) {
+				go hs2.SendSerMsg(&hs2types.H2Msg{
+					ViewNumber: hs2.View.ViewNumber - 1,
+					// Hs2Node:    hs2.LockHs2Node[0],
+					SendNode: hs2.GetNodeName(),
+					ReciNode: reply.Id,
+					Results:  reply.Results,
+				})
+			}
+			hs2.ExecResults, hs2.ExecTxs = nil, nil
 		}
 
 		hs2.SendSerMsg(msgReturn)
@@ -177,7 +204,7 @@ func (hs2 *Hotstuff2) HandleReq(height int, preHash []byte, req []bcrequest.BCRe
 		Command:    make([][]byte, 0),
 	}
 	for i := 0; i < len(req); i++ {
-		hs2.CurProposal.Command = append(hs2.CurProposal.Command, req[i].Cmd)
+		hs2.CurProposal.Command = append(hs2.CurProposal.Command, req[i].Encode())
 	}
 
 	hs2.CurProposal.RootHash = merkle.HashFromByteSlicesIterative(hs2.CurProposal.Command)
@@ -195,6 +222,7 @@ func (hs2 *Hotstuff2) HandleReq(height int, preHash []byte, req []bcrequest.BCRe
 			return
 		}
 		hs2.CurPhase = hs2types.PROPOSE
+		hs2.SaveState()
 		hs2.SendSerMsg(msgReturn)
 	}
 }
@@ -232,6 +260,17 @@ func (hs2 *Hotstuff2) CreateLeaf(parent []byte) common.HsNode {
 	}
 }
 
+// CertifyQC: tell the elector the node certified by the QC, the leaders of the later views
+// are elected by the chain of the QC which the proposals extend
+// params:
+// - qc: the proposal or prepare QC, the QC without a valid signature certifies nothing
+func (hs2 *Hotstuff2) CertifyQC(qc *hs2types.QuromCert) {
+	if qc.Sign == nil || !hs2.ThresholdSigner.ThresholdSignVerify(qc.QC2SignMsgByte(), qc.Sign) {
+		return
+	}
+	hs2.View.Certify(qc.ViewNumber, qc.Hs2Node.CurHash, qc.Hs2Node.ParentHash)
+}
+
 // CheckQC: check message's QC is valid, include QC's type, view, height and signature
 func (hs2 *Hotstuff2) CheckQC(qc *hs2types.QuromCert, code hs2types.StateType, viewNumber int, height int) bool {
 
@@ -252,6 +291,18 @@ func (hs2 *Hotstuff2) CheckQC(qc *hs2types.QuromCert, code hs2types.StateType, v
 	return true
 }
 
+// CertifiedHeight: get the expected height of the block certified by the proposal QC
+// the certified block is committed by the proposal in the normal case,
+// while it has been committed already when the view is entered by a TC after its double certificate
+// params: the proposal QC
+// return: the expected height
+func (hs2 *Hotstuff2) CertifiedHeight(qc *hs2types.QuromCert) int {
+	if qc.Height == hs2.BlkStore.Height-1 {
+		return hs2.BlkStore.Height - 1
+	}
+	return hs2.BlkStore.Height
+}
+
 // MatchingQC: check QC's type and view
 // params: qurom certfication, qc's type, current view
 // return: result
@@ -280,6 +331,42 @@ func MatchingMsg(msg *hs2types.H2Msg, code hs2types.StateType, curView int) bool
 	return msg.MType == code && msg.ViewNumber == curView
 }
 
+// CheckVote: check the vote is the first one of its sender and its partial signature is on the message it votes for,
+// so that the forged or repeated votes are never combined
+// params:
+// - votes: the votes recieved before
+// - msg:   the recieved vote
+// - code:  the type of the voted message
+// return: whether the vote is counted
+func (hs2 *Hotstuff2) CheckVote(votes []*hs2types.H2Msg, msg *hs2types.H2Msg, code hs2types.StateType) bool {
+	for _, m := range votes {
+		if m.SendNode == msg.SendNode {
+			return false
+		}
+	}
+	signed := hs2types.H2Msg{
+		MType:      code,
+		ViewNumber: msg.ViewNumber,
+		Hs2Node:    msg.Hs2Node,
+	}
+	if _, ok := hs2.ThresholdSigner.PartialSignVerify(signed.Message2Byte(), msg.ConsSign); !ok {
+		hs2.Logger.Println("[Error]: vote verify error", hs2.GetNodeName(), msg.ViewNumber, msg.SendNode)
+		return false
+	}
+	return true
+}
+
+// MatchingVotes: get the votes for the hotstuff-2 node, the votes for the conflicting node proposed by an equivocating leader are left out
+func MatchingVotes(votes []*hs2types.H2Msg, node common.HsNode) []*hs2types.H2Msg {
+	matching := make([]*hs2types.H2Msg, 0, len(votes))
+	for _, m := range votes {
+		if bytes.Equal(m.Hs2Node.CurHash, node.CurHash) && bytes.Equal(m.Hs2Node.ParentHash, node.ParentHash) {
+			matching = append(matching, m)
+		}
+	}
+	return matching
+}
+
 // CombineSig: combine message's part signature to a complete signature
 // params: the silce of recieved messages with part signature
 // ruturn: byte silce of the complete signature
@@ -333,11 +420,32 @@ func (hs2 *Hotstuff2) WriteNewH2Block(start int, end int) {
 	// from start to end write blocks in order
 	for i := start; i <= end; i++ {
 		hs2.BlkStore.StoreBlock(*hs2.LockBlk[i])
+		if latency, ok := hs2.LockBlk[i].BlkHdr.Latency(); ok {
+			hs2.PM.ViewTimer.Pacemaker.ObserveCommit(latency)
+		}
+		// the locked blocks written at once may be proposed in the views this replica skipped, whose QCs CertifyQC never saw
+		hs2.View.Certify(hs2.LockBlk[i].BlkHdr.ViewNumber, hs2.LockBlk[i].Hash(), hs2.LockBlk[i].BlkHdr.PreBlkHash)
+		hs2.Execute(hs2.LockBlk[i])
 	}
 	hs2.UpdateAfterCommit(start, end)
 	hs2.CurProposal.PreBlkHash = hs2.BlkStore.PreBlkHash
 }
 
+// Execute: execute the commands of the committed block by the state machine,
+// the results are accumulated until they are replied to the client
+// params:
+// - blk: the committed block
+func (hs2 *Hotstuff2) Execute(blk *blockchain.Block) bool {
+	if hs2.StateMachine != nil {
+		results := hs2.StateMachine.Apply(*blk)
+		if results != nil {
+			hs2.ExecResults = append(hs2.ExecResults, results...)
+			hs2.ExecTxs = append(hs2.ExecTxs, blk.BlkData.Trans...)
+		}
+	}
+	return true
+}
+
 // UpdateAfterCommit; update locked Hs2Node and block by delete commited and stored blk after commit
 // params: the index range [start,end] of the locked block to be deleted
 func (hs2 *Hotstuff2) UpdateAfterCommit(start int, end int) {
@@ -378,7 +486,7 @@ func (hs2 *Hotstuff2) GetLeaderName() string {
 // params:
 // - msg: message that need to be sent
 func (hs2 *Hotstuff2) SendSerMsg(msg *hs2types.H2Msg) {
-	msgJson, err := json.Marshal(msg)
+	msgJson, err := wire.Marshal(msg, hs2.Codec)
 	if err != nil {
 		fmt.Println(err)
 		return
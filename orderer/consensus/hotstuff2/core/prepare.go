@@ -14,6 +14,9 @@ func (hs2 *Hotstuff2) HandleVote1(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	if msg.ViewNumber != hs2.View.ViewNumber {
 		return nil
 	}
+	if !hs2.CheckVote(hs2.Vote1, msg, hs2types.PROPOSE) {
+		return nil
+	}
 	hs2.Vote1 = append(hs2.Vote1, msg)
 
 	// check the local phase
@@ -21,8 +24,9 @@ func (hs2 *Hotstuff2) HandleVote1(msg *hs2types.H2Msg) *hs2types.H2Msg {
 		return nil
 	}
 
-	// check threshold
-	if len(hs2.Vote1) <= (hs2.View.NodesNum-1)/3*2 {
+	// check threshold of the votes for the proposal of this view
+	votes := MatchingVotes(hs2.Vote1, hs2.CurHs2Node)
+	if len(votes) <= (hs2.View.NodesNum-1)/3*2 {
 		return nil
 	}
 
@@ -42,12 +46,16 @@ func (hs2 *Hotstuff2) HandleVote1(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	}
 
 	// combine the part signature, and add it to the proposalQC
-	proposalSign := hs2.CombineSign(hs2.Vote1, msgSign)
+	proposalSign := hs2.CombineSign(votes, msgSign)
+	if proposalSign == nil {
+		return nil
+	}
 	proposalQC.Sign = proposalSign
 
 	// update the local proposalQC
 	// change the local phase to prepare
 	hs2.ProposalQC = proposalQC
+	hs2.CertifyQC(&hs2.ProposalQC)
 	hs2.CurPhase = hs2types.PREPARE
 
 	// log
@@ -25,6 +25,7 @@ func (hs2 *Hotstuff2) GenProposal(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	// if it is valid, update local locked prepare QC and pacemaker OptimisticFlag which means process is normal
 	if hs2.PM.OptimisticFlag && msg.Justify2.QType != hs2types.NEW_VIEW && hs2.CheckQC(&msg.Justify2, hs2types.PREPARE, msg.ViewNumber, msg.Justify2.Height) {
 		hs2.PrepareQC = msg.Justify2
+		hs2.CertifyQC(&hs2.PrepareQC)
 		hs2.PM.OptimisticFlag = false
 	}
 
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"blockchain"
+	common "common"
+	hs2types "hotstuff2/types"
+	"statemachine"
+)
+
+// Hotstuff2State: the persisted state of hotstuff-2, which is saved when the phase, the view, the certificates or the last vote advance
+// and reloaded when the node restarts
+type Hotstuff2State struct {
+	CurPhase       hs2types.StateType    // the phase of the node, used to avoid voting twice in the same view
+	View           common.View           // the view which the node has entered
+	CurHs2Node     common.HsNode         // the hotstuff-2 node of this view
+	ProposalQC     hs2types.QuromCert    // the highest single certification
+	PrepareQC      hs2types.QuromCert    // the highest double certification
+	VotedView      int                   // the last view in which the node voted
+	VotedPhase     hs2types.StateType    // the phase of the last vote
+	LockBlk        []*blockchain.Block   // the locked blocks which have not yet been committed
+	LockHs2Node    []common.HsNode       // the locked Hs2Nodes which have not yet been committed
+	OptimisticFlag bool                  // the pacemaker flag that the view is entered by the double certificate
+	BlkStore       blockchain.StoreState // the state of block store
+}
+
+// SaveState: persist the phase, the view, the certifications, the last vote, the locked blocks and the block store state
+func (hs2 *Hotstuff2) SaveState() {
+	err := hs2.BlkStore.SaveState(&Hotstuff2State{
+		CurPhase:       hs2.CurPhase,
+		View:           hs2.View,
+		CurHs2Node:     hs2.CurHs2Node,
+		ProposalQC:     hs2.ProposalQC,
+		PrepareQC:      hs2.PrepareQC,
+		VotedView:      hs2.VotedView,
+		VotedPhase:     hs2.VotedPhase,
+		LockBlk:        hs2.LockBlk,
+		LockHs2Node:    hs2.LockHs2Node,
+		OptimisticFlag: hs2.PM.OptimisticFlag,
+		BlkStore:       hs2.BlkStore.GetStoreState(),
+	})
+	if err != nil {
+		hs2.Logger.Println("[ERROR]:", hs2.GetNodeName(), "save state", err)
+	}
+}
+
+// Recover: restart hotstuff-2 from the local block store
+// the committed blocks are replayed to the state machine and the persisted state is reloaded.
+// if the node restarts at the beginning of a view, the leader waits for requests to propose and the replica waits for the proposal,
+// and the node which has voted in the persisted view goes past it instead of voting again for a conflicting proposal of an equivocating leader
+// return:
+// - true if there is local data to recover from, and error
+func (hs2 *Hotstuff2) Recover() (bool, error) {
+	tip, err := hs2.BlkStore.Recover()
+	if err != nil {
+		return false, err
+	}
+	if err := statemachine.Replay(hs2.StateMachine, &hs2.BlkStore); err != nil {
+		return false, err
+	}
+
+	var state Hotstuff2State
+	ok, err := hs2.BlkStore.LoadState(&state)
+	if err != nil {
+		return false, err
+	}
+	if !ok && tip == nil {
+		return false, nil
+	}
+
+	hs2.CurPhase = hs2types.NEW_VIEW
+	if ok {
+		hs2.CurPhase = state.CurPhase
+		hs2.View.Restore(state.View)
+		hs2.CurHs2Node = state.CurHs2Node
+		hs2.ProposalQC = state.ProposalQC
+		hs2.PrepareQC = state.PrepareQC
+		hs2.VotedView, hs2.VotedPhase = state.VotedView, state.VotedPhase
+		hs2.LockBlk = state.LockBlk
+		hs2.LockHs2Node = state.LockHs2Node
+		hs2.PM.OptimisticFlag = state.OptimisticFlag
+		hs2.BlkStore.SetStoreState(state.BlkStore)
+	}
+
+	// the node never goes back to the view of a committed block, or the view it voted in,
+	// whose proposal is lost
+	last := hs2.VotedView
+	if tip != nil && tip.BlkHdr.ViewNumber > last {
+		last = tip.BlkHdr.ViewNumber
+	}
+	if hs2.View.ViewNumber <= last {
+		for hs2.View.ViewNumber <= last {
+			hs2.View.NextView()
+		}
+		hs2.CurPhase = hs2types.NEW_VIEW
+		hs2.CurHs2Node = common.HsNode{}
+	}
+	if hs2.CurPhase == hs2types.NEW_VIEW || hs2.CurPhase == hs2types.NEW_PROPOSE {
+		hs2.CurPhase = hs2types.NEW_VIEW
+		if hs2.IsLeader() {
+			hs2.CurPhase = hs2types.NEW_PROPOSE
+		}
+	}
+
+	// drop the messages of view 0 and start the view timer of the recovered view
+	hs2.IgnoreCheckQC = false
+	hs2.CurProposal = hs2types.Proposal{}
+	hs2.CurRoundMsgs = make([]*hs2types.H2Msg, 0)
+	hs2.LastRoundMsg = make([]*hs2types.H2Msg, 0)
+	hs2.NewViewMsgs = make([]*hs2types.H2Msg, 0)
+	hs2.Vote1 = make([]*hs2types.H2Msg, 0)
+	hs2.Vote2 = make([]*hs2types.H2Msg, 0)
+	hs2.PM.ViewTimer.Start(func() {
+		hs2.StartViewChange()
+	}, func() {
+	})
+	return true, nil
+}
+
+// Handover: start hotstuff-2 on the tip committed by another consensus protocol, which has no QC of this protocol,
+// so the first proposal isn't checked by the QCs as the one in view 0
+func (hs2 *Hotstuff2) Handover() {
+	hs2.IgnoreCheckQC = true
+}
+
+// Rejoin: hotstuff-2 needn't send any message to rejoin,
+// the node waits for the proposal or the view change of the recovered view
+// return:
+// - nil
+func (hs2 *Hotstuff2) Rejoin() *hs2types.H2Msg {
+	return nil
+}
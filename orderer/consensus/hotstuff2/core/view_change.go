@@ -9,13 +9,15 @@ import (
 // StartViewChange implement Hotstuff description as follow:
 // – send a timeout message ⟨wish, 𝑣 + 1⟩ to the 𝑡 + 1 view leaders in the epoch
 // – any one of the 𝑡 + 1 leaders that collects 2𝑡 + 1 ⟨wish, 𝑣 + 1⟩ messages forming a 𝑇𝐶𝑣+1, or obtains 𝑇𝐶𝑣+1, broadcasts the TC to all parties.
+// note: the wish message is broadcast rather than sent to the t+1 leaders, so that the TC is formed by any party
+// even if the next leader is faulty, and the view whose leader is faulty is left when the view timer expires again
 func (hs2 *Hotstuff2) StartViewChange() {
 	// generate wish message with signature and send it
 	wishMsg := &hs2types.H2Msg{
 		MType:      hs2types.WISH,
 		ViewNumber: hs2.View.ViewNumber + 1,
 		SendNode:   hs2.GetNodeName(),
-		ReciNode:   hs2.GetNextLeaderName(),
+		ReciNode:   "Broadcast",
 	}
 	wishMsgSgin, err := hs2.ThresholdSigner.ThresholdSign(wishMsg.Message2Byte())
 	if err == nil {
@@ -31,41 +33,77 @@ func (hs2 *Hotstuff2) StartViewChange() {
 			hs2.SendSerMsg(wishMsg)
 		}
 	}
+
+	// the wish message is sent again when the view timer expires before the TC is recieved,
+	// since the messages sent during a partition are lost
+	hs2.PM.ViewTimer.Start(func() {
+		hs2.StartViewChange()
+	}, func() {
+	})
 }
 
-// HandleWish: the next leader of view v+1 (the current view is v) handle the wish message collect 2f+1 wish message
+// HandleWish: the party handle the wish message of view v+1 (the current view is v) and collect 2f+1 wish message,
+// the party whose wish message is recieved again after the TC is generated missed it, and the TC is sent to it again
 func (hs2 *Hotstuff2) HandleWish(msg *hs2types.H2Msg) *hs2types.H2Msg {
 
-	if _, ok := hs2.PM.WishMsgs[msg.ViewNumber]; !ok {
-		// if not exists, add it a bew slice belong to this view number
-		hs2.PM.WishMsgs[msg.ViewNumber] = []*hs2types.H2Msg{msg}
-	} else {
-		hs2.PM.WishMsgs[msg.ViewNumber] = append(hs2.PM.WishMsgs[msg.ViewNumber], msg)
+	// the wish messages of the views before the last one are never used
+	for view := range hs2.PM.WishMsgs {
+		if view < msg.ViewNumber-1 {
+			delete(hs2.PM.WishMsgs, view)
+		}
 	}
 
-	// check the threshold
-	if len(hs2.PM.WishMsgs[msg.ViewNumber]) != (hs2.View.NodesNum-1)/3*2+1 {
+	// the forged wish message is never combined
+	if _, ok := hs2.ThresholdSigner.PartialSignVerify(msg.Message2Byte(), msg.ConsSign); !ok {
 		return nil
 	}
 
-	// recover the signed message and generate the wish signature
-	wishMsg := hs2types.H2Msg{
-		MType:      hs2types.WISH,
-		ViewNumber: msg.ViewNumber,
+	// each party is counted once in a view
+	threshold := (hs2.View.NodesNum-1)/3*2 + 1
+	wishMsgs := hs2.PM.WishMsgs[msg.ViewNumber]
+	recieved := false
+	for _, m := range wishMsgs {
+		if m.SendNode == msg.SendNode {
+			recieved = true
+			break
+		}
+	}
+	if !recieved {
+		wishMsgs = append(wishMsgs, msg)
+		hs2.PM.WishMsgs[msg.ViewNumber] = wishMsgs
 	}
-	wishSign := hs2.CombineSign(hs2.PM.WishMsgs[msg.ViewNumber], wishMsg)
 
-	// generate message with TC and delete handled wish messages of this view for liveness
-	TCMSG := hs2types.H2Msg{
-		MType:      hs2types.TCMSG,
-		ViewNumber: msg.ViewNumber,
-		ReciNode:   "Broadcast",
-		ConsSign:   wishSign,
+	// check the threshold, the TC has been broadcast if the threshold was reached before this message
+	if len(wishMsgs) < threshold {
+		return nil
+	}
+	if len(wishMsgs) > threshold || recieved {
+		return hs2.GenTC(msg.ViewNumber, wishMsgs[:threshold], msg.SendNode)
 	}
-	delete(hs2.PM.WishMsgs, msg.ViewNumber)
 
 	// log
 	hs2.Logger.Println("[WISH]: r_", hs2.ConsId, "Succeed!")
 
-	return &TCMSG
+	return hs2.GenTC(msg.ViewNumber, wishMsgs, "Broadcast")
+}
+
+// GenTC: generate the message with TC from the wish messages
+// params:
+// - view:     the view which the parties wish to enter
+// - wishMsgs: the 2f+1 wish messages of the view
+// - reciNode: the reciever of the TC
+// return:
+// - the message with TC
+func (hs2 *Hotstuff2) GenTC(view int, wishMsgs []*hs2types.H2Msg, reciNode string) *hs2types.H2Msg {
+	// recover the signed message and generate the wish signature
+	wishMsg := hs2types.H2Msg{
+		MType:      hs2types.WISH,
+		ViewNumber: view,
+	}
+	return &hs2types.H2Msg{
+		MType:      hs2types.TCMSG,
+		ViewNumber: view,
+		ReciNode:   reciNode,
+		ConsSign:   hs2.CombineSign(wishMsgs, wishMsg),
+	}
 }
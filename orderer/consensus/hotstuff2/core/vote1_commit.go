@@ -20,28 +20,59 @@ func (hs2 *Hotstuff2) HandlePropose(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	if hs2.View.ViewNumber != msg.ViewNumber {
 		return nil
 	}
+	// the node votes once in a view, the view voted before restarting is never voted again,
+	// since the proposal voted in it is lost and the leader may have proposed a conflicting one
+	if msg.ViewNumber <= hs2.VotedView {
+		return nil
+	}
+
+	// the block with an invalid or replayed request, not hashed by the canonical encoding, or whose data differs from its header is not voted
+	if !hs2.IsLeader() && !msg.Block.BlkHdr.IsCanonical() {
+		hs2.Logger.Println("[Error]: block version error", hs2.GetNodeName(), hs2.View.ViewNumber, msg.Block.BlkHdr.Version)
+		hs2.rejectProposal()
+		return nil
+	}
+	if !hs2.IsLeader() {
+		if err := msg.Block.VerifyBlockData(); err != nil {
+			hs2.Logger.Println("[Error]: block data verify error", hs2.GetNodeName(), hs2.View.ViewNumber, err)
+			hs2.rejectProposal()
+			return nil
+		}
+	}
+	if !hs2.IsLeader() && hs2.ReqValidator != nil {
+		if err := hs2.ReqValidator.CheckTxs(msg.Block.BlkData.Trans); err != nil {
+			hs2.Logger.Println("[Error]: requests verify error", hs2.GetNodeName(), hs2.View.ViewNumber, err)
+			hs2.rejectProposal()
+			return nil
+		}
+	}
 
 	// check 𝐶𝑣′ (𝐵𝑘−1) , single authentication block type is propose
 	// the leader without the need to check itself message
+	// the proposal without a certified block extends the genesis, which is voted only if no block is locked,
+	// such as the proposals of the first views are never certified
+	genesis := msg.Justify1.QType == hs2types.NEW_VIEW && hs2.ProposalQC.QType == hs2types.NEW_VIEW
 	if hs2.IsLeader() && hs2.GetNodeName() == msg.SendNode {
-		if hs2.View.ViewNumber != 0 && !hs2.IgnoreCheckQC &&
-			!hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.BlkStore.Height-1) {
-			fmt.Println("Leader error", hs2.View.ViewNumber != 0, !hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.BlkStore.Height-1))
+		if hs2.View.ViewNumber != 0 && !hs2.IgnoreCheckQC && !genesis &&
+			!hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.CertifiedHeight(&msg.Justify1)) {
+			fmt.Println("Leader error", hs2.GetNodeName(), hs2.View.ViewNumber)
 			return nil
 		}
-	} else if hs2.View.ViewNumber != 0 && !hs2.IgnoreCheckQC &&
-		!hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.BlkStore.Height) {
+	} else if hs2.View.ViewNumber != 0 && !hs2.IgnoreCheckQC && !genesis &&
+		!hs2.CheckQC(&msg.Justify1, hs2types.PROPOSE, msg.Justify1.ViewNumber, hs2.CertifiedHeight(&msg.Justify1)) {
 		fmt.Println("Prepare 1", hs2.GetNodeName())
 		return nil
 
 	} else if hs2.ProposalQC.ViewNumber < msg.Justify1.ViewNumber {
 		hs2.ProposalQC = msg.Justify1
+		hs2.CertifyQC(&hs2.ProposalQC)
 	}
 
 	// commit start
 	// the replica check 𝐶𝑣"(𝐶𝑣"(𝐵𝑘")) namely double single authentication block
-	// if valid add validation and store block
-	if !hs2.IsLeader() {
+	// if valid add validation and store block, nothing is committed if no block is double certified yet,
+	// such as the views before are all changed by the TC
+	if !hs2.IsLeader() && msg.Justify2.QType != hs2types.NEW_VIEW {
 		if hs2.View.ViewNumber != 0 && !hs2.IgnoreCheckQC &&
 			!hs2.CheckQC(&msg.Justify2, hs2types.PREPARE, msg.Justify2.ViewNumber, msg.Justify2.Height) {
 			fmt.Println("Prepare 2")
@@ -76,6 +107,16 @@ func (hs2 *Hotstuff2) HandlePropose(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	vote1.ConsSign = partSign
 	vote1.ReciNode = msg.SendNode
 	vote1.MType = hs2types.VOTE1
+	hs2.VotedView, hs2.VotedPhase = vote1.ViewNumber, hs2types.VOTE1
+
+	// the view timer is started once the proposal is voted if the view was not entered by the timer,
+	// such as the first view, so that the view is changed if the proposal of an equivocating leader is never certified
+	if hs2.PM.ViewTimer.IsStopped {
+		hs2.PM.ViewTimer.Start(func() {
+			hs2.StartViewChange()
+		}, func() {
+		})
+	}
 
 	// update local phase and log
 	hs2.CurPhase = hs2types.PROPOSE
@@ -112,7 +153,19 @@ func (hs2 *Hotstuff2) AddValidation2Blk(qc hs2types.QuromCert) {
 	for _, blk := range hs2.LockBlk {
 		if blk.BlkHdr.ViewNumber == qc.ViewNumber {
 			blk.BlkHdr.Validation = qc.Sign
+			blk.BlkHdr.ValidationMsg = qc.QC2SignMsgByte()
 			break
 		}
 	}
 }
+
+// rejectProposal: the replica which rejects the proposal of the leader starts the view timer if the view was not entered by the timer,
+// such as the first view, so that it changes the view with the others instead of waiting for the leader forever
+func (hs2 *Hotstuff2) rejectProposal() {
+	if hs2.PM.ViewTimer.IsStopped {
+		hs2.PM.ViewTimer.Start(func() {
+			hs2.StartViewChange()
+		}, func() {
+		})
+	}
+}
@@ -14,6 +14,11 @@ func (hs2 *Hotstuff2) HandlePrepare(msg *hs2types.H2Msg) *hs2types.H2Msg {
 		return nil
 	}
 
+	// the vote2 is sent once in a view, and never in the view before the last vote
+	if msg.ViewNumber < hs2.VotedView || msg.ViewNumber == hs2.VotedView && hs2.VotedPhase == hs2types.VOTE2 {
+		return nil
+	}
+
 	// when the leader is not in prepare phase and the replica is not in propose phase, return nil
 	if (hs2.IsLeader() && hs2.CurPhase != hs2types.PREPARE) || (!hs2.IsLeader() && hs2.CurPhase != hs2types.PROPOSE) {
 		return nil
@@ -37,13 +42,18 @@ func (hs2 *Hotstuff2) HandlePrepare(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	vote2.ConsSign = partSign
 	vote2.ReciNode = hs2.GetNextLeaderName()
 	vote2.MType = hs2types.VOTE2
+	hs2.VotedView, hs2.VotedPhase = vote2.ViewNumber, hs2types.VOTE2
 
 	// in general, until now the round has finished for itself
-	// and it will stop the ViewTimer
-	hs2.PM.ViewTimer.Stop()
+	// and it will restart the ViewTimer, which expires if the next view is not entered in time
+	hs2.PM.ViewTimer.Start(func() {
+		hs2.StartViewChange()
+	}, func() {
+	})
 
 	// update local proposal QC
 	hs2.ProposalQC = msg.Justify1
+	hs2.CertifyQC(&hs2.ProposalQC)
 	hs2.CurPhase = hs2types.PREPARE
 
 	// log
@@ -60,13 +70,17 @@ func (hs2 *Hotstuff2) HandleVote2(msg *hs2types.H2Msg) *hs2types.H2Msg {
 		return nil
 	}
 
+	if !hs2.CheckVote(hs2.Vote2, msg, hs2types.PREPARE) {
+		return nil
+	}
 	hs2.Vote2 = append(hs2.Vote2, msg)
 	if hs2.CurPhase != hs2types.PREPARE {
 		return nil
 	}
 
-	// check threshold
-	if len(hs2.Vote2) <= (hs2.View.NodesNum-1)/3*2 {
+	// check threshold of the votes for the block certified in this view
+	votes := MatchingVotes(hs2.Vote2, hs2.CurHs2Node)
+	if len(votes) <= (hs2.View.NodesNum-1)/3*2 {
 		return nil
 	}
 
@@ -86,7 +100,7 @@ func (hs2 *Hotstuff2) HandleVote2(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	}
 
 	// combine the part signature, and add it to the proposalQC
-	prepareSign := hs2.CombineSign(hs2.Vote2, msgSign)
+	prepareSign := hs2.CombineSign(votes, msgSign)
 	if prepareSign == nil {
 		return nil
 	}
@@ -95,6 +109,7 @@ func (hs2 *Hotstuff2) HandleVote2(msg *hs2types.H2Msg) *hs2types.H2Msg {
 	// update the local proposalQC
 	// change the local phase to NEW-VIEW
 	hs2.PrepareQC = prepareQC
+	hs2.CertifyQC(&hs2.PrepareQC)
 	hs2.CurPhase = hs2types.NEW_VIEW
 
 	// log
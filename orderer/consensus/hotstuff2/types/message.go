@@ -2,6 +2,7 @@ package hs2types
 
 import (
 	"blockchain"
+	"canonical"
 	"common"
 )
 
@@ -17,9 +18,12 @@ type H2Msg struct {
 
 	SendNode string // the sending node of the message
 	ReciNode string // the receiving node of the message
+
+	Results []string `json:"Results,omitempty"` // the results of executed commands which reply to the client
 }
 
-// Message2Byte: convert message to byte slice
+// Message2Byte: convert message to the signed byte slice by the canonical encoding, which is the same as the QC of the vote
 func (m *H2Msg) Message2Byte() []byte {
-	return append([]byte{byte(m.MType), byte(m.ViewNumber)}, m.Hs2Node.Object2Byte()...)
+	e := canonical.NewEncoder(canonical.TAG_HOTSTUFF2_VOTE).Uint8(uint8(m.MType)).Int(m.ViewNumber)
+	return m.Hs2Node.Encode(e).Encoded()
 }
@@ -0,0 +1,36 @@
+package hs2types_test
+
+import (
+	"bytes"
+	"common"
+	"encoding/hex"
+	hs2types "hotstuff2/types"
+	"testing"
+)
+
+// TestSignedBytes: test the golden vectors of the signed bytes of messages, the QC is verified by the bytes signed by the votes,
+// so they must be the same, and the view numbers which wrap in a byte get different bytes
+func TestSignedBytes(t *testing.T) {
+	node := common.HsNode{CurHash: []byte{1, 2}, ParentHash: []byte{3}}
+
+	m := hs2types.H2Msg{MType: hs2types.VOTE1, ViewNumber: 257, Hs2Node: node}
+	golden := "0000001a646373636861696e2f686f747374756666322f766f74652f7631" + "03" + "0000000000000101" + "00000002010200000001" + "03"
+	if hex.EncodeToString(m.Message2Byte()) != golden {
+		t.Fatalf("message: expected %s, got %x", golden, m.Message2Byte())
+	}
+	qc := hs2types.QuromCert{QType: m.MType, ViewNumber: m.ViewNumber, Hs2Node: node}
+	if !bytes.Equal(qc.QC2SignMsgByte(), m.Message2Byte()) {
+		t.Fatal("QC signed bytes are different from the vote")
+	}
+	wrapped := m
+	wrapped.ViewNumber = 1
+	if bytes.Equal(wrapped.Message2Byte(), m.Message2Byte()) {
+		t.Fatal("wrapped view number collision")
+	}
+
+	p := hs2types.Proposal{Height: 300, ViewNumber: 257, PreBlkHash: []byte{1}, RootHash: []byte{2}, Command: [][]byte{[]byte("a"), []byte("bc")}}
+	golden = "409df0a9dec06d0bb56ad5de8947a6435360d20c5d56c702f96ca8b40df26c4f"
+	if hex.EncodeToString(p.GenProposalHash()) != golden {
+		t.Fatalf("proposal hash: expected %s, got %x", golden, p.GenProposalHash())
+	}
+}
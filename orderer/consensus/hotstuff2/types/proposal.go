@@ -1,7 +1,7 @@
 package hs2types
 
 import (
-	common "common"
+	"canonical"
 	"merkle"
 )
 
@@ -25,11 +25,7 @@ func (p *Proposal) GenProposalHash() []byte {
 	if p.IsEmpty() {
 		return merkle.EmptyHash()
 	}
-	proContent := make([]byte, 0)
-	proContent = append(proContent, byte(p.Height))
-	proContent = append(proContent, byte(p.ViewNumber))
-	proContent = append(proContent, p.PreBlkHash...)
-	proContent = append(proContent, p.RootHash...)
-	proContent = append(proContent, common.TwoDimByteSlice2OneDimByteSlice(p.Command)...)
-	return merkle.Sum(proContent)
+	e := canonical.NewEncoder(canonical.TAG_HOTSTUFF2_PROPOSAL)
+	e.Int(p.Height).Int(p.ViewNumber).Bytes(p.PreBlkHash).Bytes(p.RootHash).BytesList(p.Command)
+	return merkle.Sum(e.Encoded())
 }
@@ -1,6 +1,9 @@
 package hs2types
 
-import "common"
+import (
+	"canonical"
+	"common"
+)
 
 // QuromCert: the qurom certification for a block or proposal, QC for short
 type QuromCert struct {
@@ -11,7 +14,23 @@ type QuromCert struct {
 	Sign       []byte        // the combined signature
 }
 
-// QC2SignMsgByte: convert QuromCert to byte slice
+// QC2SignMsgByte: convert QuromCert to byte slice, which is the same as the voted message
 func (q *QuromCert) QC2SignMsgByte() []byte {
-	return append([]byte{byte(q.QType), byte(q.ViewNumber)}, q.Hs2Node.Object2Byte()...)
+	e := canonical.NewEncoder(canonical.TAG_HOTSTUFF2_VOTE).Uint8(uint8(q.QType)).Int(q.ViewNumber)
+	return q.Hs2Node.Encode(e).Encoded()
+}
+
+// DecodeQuromCert: decode the signed message of QC, such as the validation message of the committed block
+// params:
+// - b: the bytes written by QC2SignMsgByte
+// return:
+// - the QC without height and signature, and error
+func DecodeQuromCert(b []byte) (*QuromCert, error) {
+	q := &QuromCert{}
+	d := canonical.NewDecoder(canonical.TAG_HOTSTUFF2_VOTE, b)
+	q.QType, q.ViewNumber = StateType(d.Uint8()), d.Int()
+	if err := q.Hs2Node.Decode(d).Finish(); err != nil {
+		return nil, err
+	}
+	return q, nil
 }
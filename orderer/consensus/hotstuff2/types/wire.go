@@ -0,0 +1,39 @@
+package hs2types
+
+import "wire"
+
+// EncodeWire: write the hotstuff-2 message to the binary codec
+func (msg *H2Msg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(msg.MType)).Int(msg.ViewNumber)
+	msg.Hs2Node.EncodeWire(w)
+	msg.Block.EncodeWire(w)
+	w.Bytes(msg.ConsSign)
+	msg.Justify1.EncodeWire(w)
+	msg.Justify2.EncodeWire(w)
+	w.String(msg.SendNode).String(msg.ReciNode).Strings(msg.Results)
+}
+
+// DecodeWire: read the hotstuff-2 message from the binary codec
+func (msg *H2Msg) DecodeWire(r *wire.Reader) {
+	msg.MType, msg.ViewNumber = StateType(r.Uint8()), r.Int()
+	msg.Hs2Node.DecodeWire(r)
+	msg.Block.DecodeWire(r)
+	msg.ConsSign = r.Bytes()
+	msg.Justify1.DecodeWire(r)
+	msg.Justify2.DecodeWire(r)
+	msg.SendNode, msg.ReciNode, msg.Results = r.String(), r.String(), r.Strings()
+}
+
+// EncodeWire: write the QC to the binary codec
+func (qc *QuromCert) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(qc.QType)).Int(qc.ViewNumber).Int(qc.Height)
+	qc.Hs2Node.EncodeWire(w)
+	w.Bytes(qc.Sign)
+}
+
+// DecodeWire: read the QC from the binary codec
+func (qc *QuromCert) DecodeWire(r *wire.Reader) {
+	qc.QType, qc.ViewNumber, qc.Height = StateType(r.Uint8()), r.Int(), r.Int()
+	qc.Hs2Node.DecodeWire(r)
+	qc.Sign = r.Bytes()
+}
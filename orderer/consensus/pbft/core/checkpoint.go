@@ -33,7 +33,15 @@ func (p *PBFT) HandleCheckPoint(msg *ptypes.PMsg) *ptypes.PMsg {
 	p.CheckPoint.Seq = msg.SeqNum
 	copy(p.CheckPoint.CPMsgs, p.CheckPoint.CPMsgsBuffer[msg.SeqNum])
 
-	p.MsgLog = make([]ptypes.MsgsLog, ptypes.CHECKPOINTNUM)
+	// the logs above the stable checkpoint are kept if the proposals are pipelined, since the view change reports the prepared
+	// certificates of the sequence numbers above it, including the committed ones
+	if p.Pipelined() {
+		for i := range p.MsgLog {
+			p.MsgLog[i].DropBefore(p.CheckPoint.Seq + 1)
+		}
+	} else {
+		p.MsgLog = make([]ptypes.MsgsLog, ptypes.CHECKPOINTNUM)
+	}
 	p.CheckPoint.CPMsgsBuffer[msg.SeqNum] = make([]*ptypes.PMsg, 0)
 
 	// log
@@ -32,6 +32,7 @@ func (p *PBFT) HandleCommitMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 		validation = append(validation, valJson...)
 	}
 	p.BlkStore.CurProposalBlk.BlkHdr.Validation = validation
+	p.BlkStore.CurProposalBlk.BlkHdr.ValidationMsg = msg.CommitByte()
 
 	// generate reply message and add it to local log
 	replyMsg := &ptypes.PMsg{
@@ -47,6 +48,11 @@ func (p *PBFT) HandleCommitMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 
 	// store block and update with an empty block
 	p.BlkStore.StoreBlock(p.BlkStore.CurProposalBlk)
+	if latency, ok := p.BlkStore.CurProposalBlk.BlkHdr.Latency(); ok {
+		p.PTimer.Timer.Pacemaker.ObserveCommit(latency)
+	}
+	// PBFT certifies no block by a QC, so the elector only observes the block committed by 2f+1 commit messages
+	p.View.Certify(p.BlkStore.CurProposalBlk.BlkHdr.ViewNumber, p.BlkStore.CurProposalBlk.Hash(), p.BlkStore.CurProposalBlk.BlkHdr.PreBlkHash)
 
 	// check whether execute the check point
 
@@ -100,7 +106,7 @@ func (p *PBFT) commited(msg *ptypes.PMsg) bool {
 	}
 
 	// the if clause replaces prepared()
-	if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) <= (p.View.NodesNum-1)/3*2 {
+	if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) < p.prepareQuorum() {
 		return false
 	}
 
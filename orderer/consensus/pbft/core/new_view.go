@@ -22,21 +22,44 @@ func (p *PBFT) HandleNewViewMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 	}
 	p.LogMsg(msg)
 
-	if msg.ViewNumber != p.View.ViewNumber {
+	if msg.ViewNumber < p.View.ViewNumber {
 		return nil
 	}
 
-	// check the OSet of the message
+	// check the VSet and the OSet of the message
+	if !p.VerifyVSet(msg) {
+		p.Logger.Println("VerifyVSet Err", len(msg.VSet), p.GetNodeName())
+		return nil
+	}
 	if !p.VerifyOSet(msg) {
 		p.Logger.Println("VerifyOSet Err", len(msg.OSet), p.GetNodeName())
 		return nil
 	}
 
+	// the replica which missed the view-change messages enters the view by the new-view message
+	if msg.ViewNumber > p.View.ViewNumber {
+		for p.View.ViewNumber < msg.ViewNumber {
+			p.View.NextView()
+		}
+		p.CurPhase = ptypes.VIEW_CHANGE
+	}
+	p.ViewChangeMsgs.NewViewMsgs = msg.VSet
+
+	// the pipelined proposals keep the sequence numbers in flight, and the prepared ones are proposed again by the O-set
+	// the new-view message sent again is ignored once the replica entered the view, and the O-set is accepted only from the primary
+	if p.Pipelined() {
+		if p.CurPhase == ptypes.VIEW_CHANGE && msg.SendNode == p.GetLeaderName() {
+			p.EnterPipelinedView(msg)
+		}
+		return nil
+	}
+
 	// update local state and clear the previous state
 	p.CurProposal = ptypes.Proposal{}
 	p.BlkStore.GenEmptyBlock()
 
 	p.MsgLog = make([]ptypes.MsgsLog, 64)
+	p.PrePrepareBuffer = make(map[int]*ptypes.PMsg)
 
 	// If there is no request to redo, start the normal process directly
 	if len(msg.OSet) == 0 {
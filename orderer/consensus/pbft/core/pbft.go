@@ -12,7 +12,6 @@ import (
 	"bcrequest"
 	"blockchain"
 	common "common"
-	"encoding/json"
 	"fmt"
 	"log"
 	"merkle"
@@ -21,9 +20,11 @@ import (
 	"os"
 	ptypes "pbft/types"
 	ssm2 "ssm2"
+	"statemachine"
 	"strconv"
 	"sync"
 	"time"
+	"wire"
 )
 
 // PBFT: the PBFT consensus core
@@ -36,18 +37,26 @@ type PBFT struct {
 	CurProposal  ptypes.Proposal // current proposal of this view
 	ProposalLock sync.Mutex
 
+	Window           int                  // the max number of sequence numbers in flight, the proposals are pipelined if it is more than 1
+	PrePrepareBuffer map[int]*ptypes.PMsg // the pre-prepare messages of the sequence numbers in flight which wait for the one of the previous sequence number
+
 	CheckPoint     ptypes.CheckPoint      // the unit of checkpoint maintained by this node,
 	ViewChangeMsgs ptypes.MsgsLog         // the collection of view-change messages this node recieved
 	NewViewMsgs    map[int][]*ptypes.PMsg // the collection of new-view messages this node recieved
 	ReplyMsgs      []*ptypes.PMsg         // the collection of reply messages this node sent
 	MsgLog         []ptypes.MsgsLog       // the collection of MsgLog,and there will be one for each view
 
-	BlkStore    blockchain.BlockStore  // the unit to generate and store blocks
-	PTimer      ptypes.PTimer          // the timer responsible for liveness
-	ForwardChan chan []byte            // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
-	SendChan    chan message.ServerMsg // the channel listened by a node can send messages in the channel to the corresponding node on the network
-	Logger      log.Logger             `json:"logger"` // the role of recording logs
-	Signer      *ssm2.Signer           `json:"Signer"` // the role responsible for signatures
+	BlkStore     blockchain.BlockStore     // the unit to generate and store blocks
+	PTimer       ptypes.PTimer             // the timer responsible for liveness
+	ForwardChan  chan []byte               // the channel through which this node receives messages can be responsible for sending messages from the consensus layer to the data layer
+	SendChan     chan message.ServerMsg    // the channel listened by a node can send messages in the channel to the corresponding node on the network
+	Codec        wire.Codec                // the codec of the consensus messages sent to the replicas, the zero value is JSON
+	Logger       log.Logger                `json:"logger"` // the role of recording logs
+	Signer       *ssm2.Signer              `json:"Signer"` // the role responsible for signatures
+	StateMachine statemachine.StateMachine // the replicated application which executes the committed commands
+	ExecResults  []string                  // the results of the last executed commands
+	ExecTxs      []string                  // the transactions of the last executed commands, whose clients get the results
+	ReqValidator *bcrequest.Validator      // the validator of client requests, the proposed block is not checked if it is nil
 }
 
 // NewPBFT: create an instance of a new consensus of PBFT
@@ -69,10 +78,12 @@ func NewPBFT(timerDuration int, consId int, nodeNum int, path string,
 			NodesNum:   nodeNum,
 			Leader:     0,
 		},
-		ConsId:      consId,
-		NewViewMsgs: make(map[int][]*ptypes.PMsg),
-		MsgLog:      make([]ptypes.MsgsLog, ptypes.CHECKPOINTNUM),
-		Logger:      *log.New(os.Stdout, "", 0),
+		ConsId:           consId,
+		Window:           1,
+		PrePrepareBuffer: make(map[int]*ptypes.PMsg),
+		NewViewMsgs:      make(map[int][]*ptypes.PMsg),
+		MsgLog:           make([]ptypes.MsgsLog, ptypes.CHECKPOINTNUM),
+		Logger:           *log.New(os.Stdout, "", 0),
 		BlkStore: blockchain.BlockStore{
 			Base:       64,
 			Height:     0,
@@ -93,8 +104,9 @@ func NewPBFT(timerDuration int, consId int, nodeNum int, path string,
 				SendNode:   "r_" + strconv.Itoa(consId),
 			}},
 		},
-		SendChan: sendChan,
-		Signer:   signer,
+		SendChan:     sendChan,
+		Signer:       signer,
+		StateMachine: statemachine.NewStateMachine(),
 	}
 	// set log format
 	newPBFTConsensus.Logger.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
@@ -109,7 +121,7 @@ func (p *PBFT) HandlePMsg(payload []byte) {
 	var msg ptypes.PMsg
 
 	// convert json to message
-	json.Unmarshal(payload, &msg)
+	wire.Unmarshal(payload, &msg)
 	// fmt.Println(p.GetNodeName(),
 	// 	p.View.ViewNumber,
 	// 	msg.SendNode,
@@ -122,8 +134,23 @@ func (p *PBFT) HandlePMsg(payload []byte) {
 		return
 	}
 
+	// the normal-case messages of the pipelined proposals are handled for each sequence number in flight
+	if p.Pipelined() {
+		switch msg.MType {
+		case ptypes.PREPREPARE, ptypes.PREPARE, ptypes.COMMIT, ptypes.CHECKPOINT:
+			p.HandlePipelinedMsg(&msg)
+			return
+		}
+	}
+
 	// submit the pbft message to pbft and get its return messages
+	phase, view, seq, cpSeq := p.CurPhase, p.View.ViewNumber, p.SequenceNum, p.CheckPoint.Seq
 	msgReturn := p.RoutePMsg(&msg)
+
+	// persist the state before sending any message if the phase, the view, the sequence or the checkpoint advanced
+	if p.CurPhase != phase || p.View.ViewNumber != view || p.SequenceNum != seq || p.CheckPoint.Seq != cpSeq {
+		p.SaveState()
+	}
 	// fmt.Println(p.GetNodeName(), p.View.ViewNumber, msg.ViewNumber, msg.MType, msg.SendNode)
 
 	// send its return messages and execute
@@ -133,13 +160,8 @@ func (p *PBFT) HandlePMsg(payload []byte) {
 		// case reply message, the leader of the next node will prepare for next round
 		case ptypes.REPLY:
 			if p.Execute() {
-				go p.SendSerMsg(&ptypes.PMsg{
-					ViewNumber: p.View.ViewNumber - 1,
-					// HsNode:     bhs.HsNode,
-					Proposal: ptypes.Proposal{},
-					SendNode: p.GetNodeName(),
-					ReciNode: "Client",
-				})
+				// each client gets the results of its own requests
+				p.SendResults()
 
 				// p.Logger.Println("[EXECUTE]:", p.GetNodeName(), "View:", p.View.ViewNumber-1)
 
@@ -149,23 +171,18 @@ func (p *PBFT) HandlePMsg(payload []byte) {
 						p.CurPhase = ptypes.WAITING
 					}
 
-					go func() {
-						if p.ProposalLock.TryLock() {
-							msg := p.Preprepare()
-							if msg != nil {
-								msg.SendNode = p.GetNodeName()
-								p.SendSerMsg(msg)
-							}
-							p.ProposalLock.Unlock()
+					// the next proposal is sent in order after the messages of this one, unless the leader is proposing
+					if p.ProposalLock.TryLock() {
+						msg := p.Preprepare()
+						if msg != nil {
+							msg.SendNode = p.GetNodeName()
+							p.SendSerMsg(msg)
 						}
-					}()
+						p.ProposalLock.Unlock()
+					}
 				}
 
-				// if this reply's sequence is evenly divided by the const number CHECKPOINTNUM preset
-				// and checkpoint message is not empty, the node will implement garbage collection mechanisms and update checkpoint
-				if (msgReturn.SeqNum+1)%ptypes.CHECKPOINTNUM == 0 && len(p.CheckPoint.CPMsgsBuffer[msgReturn.SeqNum]) != 0 {
-					p.SendSerMsg(p.CheckPoint.CPMsgsBuffer[msgReturn.SeqNum][0])
-				}
+				p.SendCheckPoint(msgReturn.SeqNum)
 				return
 			}
 		// case vc_reply message, which indicated the redo round after the view change
@@ -187,16 +204,15 @@ func (p *PBFT) HandlePMsg(payload []byte) {
 			// the leader will start new view and prepare for new request
 			if p.IsLeader() {
 				p.CurPhase = ptypes.WAITING
-				go func() {
-					if p.ProposalLock.TryLock() {
-						msg := p.Preprepare()
-						if msg != nil {
-							msg.SendNode = p.GetNodeName()
-							p.SendSerMsg(msg)
-						}
-						p.ProposalLock.Unlock()
+				// the next proposal is sent in order after the messages of this one, unless the leader is proposing
+				if p.ProposalLock.TryLock() {
+					msg := p.Preprepare()
+					if msg != nil {
+						msg.SendNode = p.GetNodeName()
+						p.SendSerMsg(msg)
 					}
-				}()
+					p.ProposalLock.Unlock()
+				}
 			}
 		default:
 			// add node name and record it
@@ -245,6 +261,11 @@ func (p *PBFT) RoutePMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 // - preHash: 	hash of previous block
 // - req: 		recieved requests
 func (p *PBFT) HandleReq(height int, preHash []byte, curHash []byte, req []bcrequest.BCRequest) {
+	// the pipelined proposal takes the next sequence number in flight, and extends the block of the previous one
+	if p.Pipelined() {
+		p.ProposePipelined(req)
+		return
+	}
 
 	// generate a new proposal
 	p.CurProposal = ptypes.Proposal{
@@ -254,7 +275,7 @@ func (p *PBFT) HandleReq(height int, preHash []byte, curHash []byte, req []bcreq
 		Command:    make([][]byte, 0),
 	}
 	for i := 0; i < len(req); i++ {
-		p.CurProposal.Command = append(p.CurProposal.Command, req[i].Cmd)
+		p.CurProposal.Command = append(p.CurProposal.Command, req[i].Encode())
 	}
 
 	// p.CurProposal.RootHash = merkle.HashFromByteSlicesIterative(p.CurProposal.Command)
@@ -269,6 +290,7 @@ func (p *PBFT) HandleReq(height int, preHash []byte, curHash []byte, req []bcreq
 		p.ProposalLock.Unlock()
 		return
 	}
+	p.SaveState()
 	p.SendSerMsg(msgReturn)
 	p.ProposalLock.Unlock()
 
@@ -0,0 +1,472 @@
+package core
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	"common"
+	"encoding/json"
+	ptypes "pbft/types"
+)
+
+// Pipelined: check whether the proposals are pipelined, then the primary of the view assigns the next sequence numbers
+// before the previous one is committed, and each sequence number in flight has its own message log
+// note: the view doesn't change as the sequence numbers are committed, the primary keeps proposing until the view change,
+// and the sequence numbers in flight are between the next one to commit, SequenceNum, and the high water mark.
+// The view change keeps them, the prepared ones are proposed again by the primary of the new view, see EnterPipelinedView
+func (p *PBFT) Pipelined() bool {
+	return p.Window > 1
+}
+
+// IsWaitingReq: check whether the node is waiting for the requests to propose,
+// if the proposals are pipelined, the primary proposes until the window of sequence numbers is full
+func (p *PBFT) IsWaitingReq() bool {
+	if !p.Pipelined() {
+		return p.CurPhase == ptypes.WAITING
+	}
+	p.ProposalLock.Lock()
+	defer p.ProposalLock.Unlock()
+	if p.CurPhase == ptypes.VIEW_CHANGE || !p.IsLeader() {
+		return false
+	}
+	_, ok := p.nextPipelinedSeq()
+	return ok
+}
+
+// GetProposerName: get the name of the node which proposes the next requests, which is the primary of the current view
+func (p *PBFT) GetProposerName() string {
+	return p.GetLeaderName()
+}
+
+// slot: get the message log of the sequence number in flight, the messages of the earlier sequence numbers which used the log are dropped
+// note: the sequence numbers in flight are less than CHECKPOINTNUM apart and not above the high water mark, so each of them has its own log,
+// and the dropped ones are not above the last stable checkpoint
+// params:
+// - seq: the sequence number in flight
+// return:
+// - the message log of the sequence number
+func (p *PBFT) slot(seq int) *ptypes.MsgsLog {
+	ml := &p.MsgLog[seq%ptypes.CHECKPOINTNUM]
+	ml.DropBefore(seq)
+	return ml
+}
+
+// inWindow: check whether the sequence number may be in flight, which is not committed yet, and is not above
+// the high water mark of the last stable checkpoint, or CHECKPOINTNUM after the next sequence number to commit
+func (p *PBFT) inWindow(seq int) bool {
+	return seq >= p.SequenceNum && seq < p.SequenceNum+ptypes.CHECKPOINTNUM && seq <= p.CheckPoint.Seq+ptypes.CHECKPOINTNUM
+}
+
+// nextPipelinedSeq: get the next sequence number to assign, which is the first one in flight without the accepted pre-prepare message
+// return:
+// - the sequence number, and false if the window is full or it is above the high water mark
+func (p *PBFT) nextPipelinedSeq() (int, bool) {
+	for seq := p.SequenceNum; seq < p.SequenceNum+p.Window; seq++ {
+		if !p.inWindow(seq) {
+			return seq, false
+		}
+		if p.slot(seq).PreprepareMsg == nil {
+			return seq, true
+		}
+	}
+	return p.SequenceNum + p.Window, false
+}
+
+// ProposePipelined: the primary assigns the next sequence number to the requests,
+// whose block extends the block of the previous sequence number in flight, or the last committed block
+// params:
+// - req: the requests, the ones proposed in the sequence numbers in flight are not proposed again
+func (p *PBFT) ProposePipelined(req []bcrequest.BCRequest) {
+	p.ProposalLock.Lock()
+	defer p.ProposalLock.Unlock()
+
+	if p.CurPhase == ptypes.VIEW_CHANGE || !p.IsLeader() {
+		return
+	}
+	seq, ok := p.nextPipelinedSeq()
+	if !ok {
+		return
+	}
+
+	// the requests in flight are not proposed again
+	inFlight := make(map[string]bool)
+	for s := p.SequenceNum; s < seq; s++ {
+		for _, tx := range p.slot(s).PreprepareMsg.Block.BlkData.Trans {
+			inFlight[tx] = true
+		}
+	}
+	commands := make([][]byte, 0, len(req))
+	for i := range req {
+		if cmd := req[i].Encode(); !inFlight[string(cmd)] {
+			commands = append(commands, cmd)
+		}
+	}
+	if len(commands) == 0 {
+		return
+	}
+
+	// extend the block of the previous sequence number in flight, or the last committed block
+	height, preHash := p.BlkStore.Height, p.BlkStore.PreBlkHash
+	if seq > p.SequenceNum {
+		parent := p.slot(seq - 1).PreprepareMsg
+		height, preHash = parent.Block.BlkHdr.Height+1, parent.Digest
+	}
+	blk := blockchain.NewBlock(height, preHash, p.View.ViewNumber, common.TwoDimByteSlice2StringSlice(commands))
+
+	// generate pre-prepare message with new block, proposal, digest of block, and accept it
+	prePrepareMsg := &ptypes.PMsg{
+		MType:      ptypes.PREPREPARE,
+		ViewNumber: p.View.ViewNumber,
+		SeqNum:     seq,
+		Digest:     blk.Hash(),
+		SendNode:   p.GetNodeName(),
+		ReciNode:   "Broadcast",
+		Proposal: ptypes.Proposal{
+			Height:     height,
+			ViewNumber: p.View.ViewNumber,
+			PreBlkHash: preHash,
+			CurBlkHash: blk.Hash(),
+			Command:    commands,
+		},
+		Block: blk,
+	}
+	prePrepareMsg.Signature = p.Signer.Sign(prePrepareMsg.Message2Byte(0))
+	p.slot(seq).PreprepareMsg = prePrepareMsg
+	if seq == p.SequenceNum {
+		p.startPipelineTimer()
+	}
+
+	// persist the accepted pre-prepare message before sending it
+	p.SaveState()
+	p.SendSerMsg(prePrepareMsg)
+}
+
+// HandlePipelinedMsg: handle the pre-prepare, prepare, commit and checkpoint messages if the proposals are pipelined,
+// the node accepts the pre-prepare messages in order of sequence number, and commits them in the same order
+// params:
+// - msg: the recieved message
+func (p *PBFT) HandlePipelinedMsg(msg *ptypes.PMsg) {
+	p.ProposalLock.Lock()
+	defer p.ProposalLock.Unlock()
+
+	// the sequence numbers in flight stop until the new view, but the prepare and commit messages of the view which the replica
+	// is changing to are logged, since they may arrive before the new-view message
+	if p.CurPhase == ptypes.VIEW_CHANGE {
+		if msg.MType == ptypes.PREPARE || msg.MType == ptypes.COMMIT {
+			p.logPipelinedVote(msg)
+		}
+		return
+	}
+
+	changed := false
+	switch msg.MType {
+	case ptypes.CHECKPOINT:
+		// the stable checkpoint raises the high water mark, so that the pre-prepare messages above it may be accepted
+		cpSeq := p.CheckPoint.Seq
+		p.HandleCheckPoint(msg)
+		changed = p.CheckPoint.Seq != cpSeq
+	case ptypes.PREPREPARE:
+		if !p.checkPipelinedPrePrepare(msg) {
+			return
+		}
+		p.PrePrepareBuffer[msg.SeqNum] = msg
+	default:
+		if !p.logPipelinedVote(msg) {
+			return
+		}
+	}
+
+	msgsReturn, advanced := p.advancePipeline()
+
+	// persist the state before sending any message if any pre-prepare message is accepted or any sequence number is committed
+	if changed || advanced {
+		p.SaveState()
+	}
+	for _, m := range msgsReturn {
+		p.SendSerMsg(m)
+	}
+}
+
+// logPipelinedVote: log the prepare or commit message of a sequence number in flight, which is signed by its sender in the current view
+// return:
+// - whether the message is logged
+func (p *PBFT) logPipelinedVote(msg *ptypes.PMsg) bool {
+	if msg.ViewNumber != p.View.ViewNumber || !p.inWindow(msg.SeqNum) || !p.Signer.VerifySign(msg.SendNode, msg.Signature, msg.Message2Byte(1)) {
+		return false
+	}
+	ml := p.slot(msg.SeqNum)
+	if msg.MType == ptypes.PREPARE {
+		ml.PrepareMsgs = append(ml.PrepareMsgs, msg)
+	} else {
+		ml.CommitMsgs = append(ml.CommitMsgs, msg)
+	}
+	return true
+}
+
+// EnterPipelinedView: the replica enters the view of the verified new-view message if the proposals are pipelined,
+// the pre-prepare messages of the O-set wait to be accepted in order of sequence number as the ones from the primary,
+// so that the blocks prepared in the earlier views are prepared and committed again, and the other sequence numbers in flight
+// are dropped, which the new primary assigns again. Each sequence number proposed again keeps its prepared certificate,
+// which the next view change reports until the sequence number prepares in the new view
+// params:
+// - msg: the new-view message which passed VerifyVSet and VerifyOSet
+func (p *PBFT) EnterPipelinedView(msg *ptypes.PMsg) {
+	p.ProposalLock.Lock()
+	defer p.ProposalLock.Unlock()
+
+	certs := make(map[int]*ptypes.Pm)
+	for _, cert := range p.Reproposals(msg.VSet) {
+		certs[cert.PrePrepareMsg.SeqNum] = cert
+	}
+	for seq := p.SequenceNum; p.inWindow(seq); seq++ {
+		ml := p.slot(seq)
+		ml.PreprepareMsg, ml.SelfMsgs, ml.Prepared = nil, nil, certs[seq]
+	}
+
+	// the committed sequence numbers are not proposed again, and the ones above the high water mark wait for the checkpoint
+	p.PrePrepareBuffer = make(map[int]*ptypes.PMsg)
+	for _, m := range msg.OSet {
+		if m.SeqNum >= p.SequenceNum {
+			p.PrePrepareBuffer[m.SeqNum] = m
+		}
+	}
+	p.CurProposal = ptypes.Proposal{}
+	p.CurPhase = ptypes.NEW_VIEW
+	if p.IsLeader() {
+		p.CurPhase = ptypes.WAITING
+	}
+	p.ReSetViewchangeMsgs()
+
+	// the earliest sequence number in flight should be committed in the new view within the specified time
+	msgsReturn, _ := p.advancePipeline()
+	p.PTimer.Timer.Stop()
+	p.startPipelineTimer()
+
+	// log
+	p.Logger.Println("[NEW-VIEW]:", p.GetNodeName(), "View:", p.View.ViewNumber, "Seq:", p.SequenceNum, "Reproposals:", len(msg.OSet))
+
+	// persist the state before sending any message
+	p.SaveState()
+	for _, m := range msgsReturn {
+		p.SendSerMsg(m)
+	}
+}
+
+// checkPipelinedPrePrepare: check the pre-prepare message of a sequence number in flight before it waits for the previous one,
+// it is signed by the primary of the current view, its sequence number is in the window, and its digest is the hash of the block
+func (p *PBFT) checkPipelinedPrePrepare(msg *ptypes.PMsg) bool {
+	if msg.ViewNumber != p.View.ViewNumber || !p.inWindow(msg.SeqNum) || p.PrePrepareBuffer[msg.SeqNum] != nil || p.slot(msg.SeqNum).PreprepareMsg != nil {
+		return false
+	}
+	if msg.SendNode != p.GetLeaderName() || !p.Signer.VerifySign(msg.SendNode, msg.Signature, msg.Message2Byte(0)) {
+		return false
+	}
+
+	// the block with an invalid or replayed request, not hashed by the canonical encoding, or whose data differs from its header is not accepted
+	if !msg.Block.BlkHdr.IsCanonical() || msg.Block.BlkHdr.ViewNumber != msg.ViewNumber || !bytes.Equal(msg.Digest, msg.Block.Hash()) {
+		return false
+	}
+	if err := msg.Block.VerifyBlockData(); err != nil {
+		p.Logger.Println("[ERROR]:", p.GetNodeName(), "pipelined pre-prepare", msg.SeqNum, err)
+		return false
+	}
+	if p.ReqValidator != nil {
+		if err := p.ReqValidator.CheckTxs(msg.Block.BlkData.Trans); err != nil {
+			p.Logger.Println("[ERROR]:", p.GetNodeName(), "pipelined pre-prepare", msg.SeqNum, err)
+			return false
+		}
+	}
+	return true
+}
+
+// advancePipeline: accept the waiting pre-prepare messages, send the prepare and commit messages of the sequence numbers in flight,
+// and commit the earliest sequence numbers which are committed-local
+// return:
+// - the messages to send, and whether any pre-prepare message is accepted or any sequence number is committed
+func (p *PBFT) advancePipeline() ([]*ptypes.PMsg, bool) {
+	msgsReturn := make([]*ptypes.PMsg, 0)
+	advanced := false
+	for {
+		for seq := p.SequenceNum; p.inWindow(seq); seq++ {
+			ml := p.slot(seq)
+
+			// the pre-prepare message is accepted if its block extends the block of the previous sequence number
+			if ml.PreprepareMsg == nil {
+				prePrepareMsg := p.acceptablePrePrepare(seq)
+				if prePrepareMsg == nil {
+					break
+				}
+				delete(p.PrePrepareBuffer, seq)
+				ml.PreprepareMsg = prePrepareMsg
+				advanced = true
+				if seq == p.SequenceNum {
+					p.startPipelineTimer()
+				}
+
+				// the backups multicast the prepare message
+				if prePrepareMsg.SendNode != p.GetNodeName() {
+					msgsReturn = append(msgsReturn, p.pipelinedVote(ptypes.PREPARE, prePrepareMsg, ml))
+				}
+			}
+
+			// multicast the commit message when prepared(m, v, n, i) becomes true
+			if !sentVote(ml, ptypes.COMMIT) && p.pipelinedPrepared(ml) {
+				msgsReturn = append(msgsReturn, p.pipelinedVote(ptypes.COMMIT, ml.PreprepareMsg, ml))
+			}
+		}
+
+		// the sequence numbers are committed in order
+		if !p.inWindow(p.SequenceNum) {
+			break
+		}
+		ml := p.slot(p.SequenceNum)
+		if !sentVote(ml, ptypes.COMMIT) || countVotes(ml.CommitMsgs, ml.PreprepareMsg) <= (p.View.NodesNum-1)/3*2 {
+			break
+		}
+		p.commitPipelined(ml)
+		advanced = true
+	}
+
+	// the pre-prepare messages of the committed sequence numbers are dropped
+	for seq := range p.PrePrepareBuffer {
+		if seq < p.SequenceNum {
+			delete(p.PrePrepareBuffer, seq)
+		}
+	}
+	return msgsReturn, advanced
+}
+
+// acceptablePrePrepare: get the waiting pre-prepare message of the sequence number, if its block extends the accepted block
+// of the previous sequence number in flight, or the last committed block
+// return:
+// - the pre-prepare message, or nil if there is none
+func (p *PBFT) acceptablePrePrepare(seq int) *ptypes.PMsg {
+	prePrepareMsg := p.PrePrepareBuffer[seq]
+	if prePrepareMsg == nil {
+		return nil
+	}
+	height, preHash := p.BlkStore.Height, p.BlkStore.PreBlkHash
+	if seq > p.SequenceNum {
+		parent := p.slot(seq - 1).PreprepareMsg
+		if parent == nil {
+			return nil
+		}
+		height, preHash = parent.Block.BlkHdr.Height+1, parent.Digest
+	}
+	if prePrepareMsg.Block.BlkHdr.Height != height || !bytes.Equal(prePrepareMsg.Block.BlkHdr.PreBlkHash, preHash) {
+		return nil
+	}
+	return prePrepareMsg
+}
+
+// pipelinedPrepared: the predicate prepared(m, v, n, i) of the sequence number in flight,
+// the pre-prepare message is taken as the prepare of the primary, so 2f prepares from different backups are needed
+func (p *PBFT) pipelinedPrepared(ml *ptypes.MsgsLog) bool {
+	return ml.PreprepareMsg != nil && countVotes(ml.PrepareMsgs, ml.PreprepareMsg)+1 > (p.View.NodesNum-1)/3*2
+}
+
+// pipelinedVote: generate the prepare or commit message matching the pre-prepare message and sign for it,
+// it is logged to the self-sent messages so that it is sent only once
+func (p *PBFT) pipelinedVote(mType ptypes.StateType, prePrepareMsg *ptypes.PMsg, ml *ptypes.MsgsLog) *ptypes.PMsg {
+	vote := &ptypes.PMsg{
+		MType:      mType,
+		ViewNumber: prePrepareMsg.ViewNumber,
+		SeqNum:     prePrepareMsg.SeqNum,
+		SendNode:   p.GetNodeName(),
+		Digest:     prePrepareMsg.Digest,
+		ReciNode:   "Broadcast",
+	}
+	vote.Signature = p.Signer.Sign(vote.Message2Byte(1))
+	ml.SelfMsgs = append(ml.SelfMsgs, vote)
+	return vote
+}
+
+// commitPipelined: commit the earliest sequence number in flight, which stores and executes its block,
+// the view is kept and the next sequence number becomes the earliest one
+// params:
+// - ml: the message log of the committed sequence number
+func (p *PBFT) commitPipelined(ml *ptypes.MsgsLog) {
+	prePrepareMsg := ml.PreprepareMsg
+
+	// generate the block validation from the matching commit messages
+	commitMsgs := make([]*ptypes.PMsg, 0, len(ml.CommitMsgs))
+	for _, m := range ml.CommitMsgs {
+		if m.SeqNum == prePrepareMsg.SeqNum && bytes.Equal(m.Digest, prePrepareMsg.Digest) {
+			commitMsgs = append(commitMsgs, m)
+		}
+	}
+	blk := prePrepareMsg.Block
+	if valJson, err := json.Marshal(commitMsgs); err == nil {
+		blk.BlkHdr.Validation = valJson
+	}
+	blk.BlkHdr.ValidationMsg = prePrepareMsg.CommitByte()
+	p.BlkStore.CurProposalBlk = blk
+	p.BlkStore.CurBlkHash = blk.Hash()
+
+	// generate reply message and add it to local log
+	replyMsg := &ptypes.PMsg{
+		MType:      ptypes.REPLY,
+		ViewNumber: p.View.ViewNumber,
+		SeqNum:     p.SequenceNum,
+		Digest:     prePrepareMsg.Digest,
+		ReciNode:   prePrepareMsg.SendNode,
+	}
+	p.ReplyMsgs = append(p.ReplyMsgs, replyMsg)
+
+	// store block, the pacemaker and the leader election observe it
+	p.BlkStore.StoreBlock(blk)
+	if latency, ok := blk.BlkHdr.Latency(); ok {
+		p.PTimer.Timer.Pacemaker.ObserveCommit(latency)
+	}
+	p.View.Certify(blk.BlkHdr.ViewNumber, blk.Hash(), blk.BlkHdr.PreBlkHash)
+
+	// the later sequence numbers go on, so the checkpoint doesn't stop the proposals but the high water mark does
+	p.GenCheckPoint(replyMsg)
+	p.CurProposal = ptypes.Proposal{}
+	p.SequenceNum += 1
+	p.startPipelineTimer()
+
+	// execute the block and reply to the clients
+	if p.Execute() {
+		p.SendResults()
+		p.SendCheckPoint(replyMsg.SeqNum)
+	}
+}
+
+// startPipelineTimer: set a timer for liveness, the earliest sequence number in flight should be committed within the specified time
+func (p *PBFT) startPipelineTimer() {
+	p.PTimer.Timer.Start(func() {
+		p.Logger.Println("[TIMER-EXPIRE-PIPELINE]:", p.GetNodeName(), "View:", p.View.ViewNumber, "Seq:", p.SequenceNum)
+		p.StartViewChange()
+	}, func() {
+	})
+}
+
+// sentVote: check whether the node has sent the vote of the type for the sequence number
+func sentVote(ml *ptypes.MsgsLog, mType ptypes.StateType) bool {
+	for _, m := range ml.SelfMsgs {
+		if m.MType == mType {
+			return true
+		}
+	}
+	return false
+}
+
+// countVotes: count the different senders of the votes which match the pre-prepare message
+func countVotes(votes []*ptypes.PMsg, prePrepareMsg *ptypes.PMsg) int {
+	if prePrepareMsg == nil {
+		return 0
+	}
+	senders := make(map[string]bool)
+	for _, m := range votes {
+		if m.ViewNumber != prePrepareMsg.ViewNumber || m.SeqNum != prePrepareMsg.SeqNum || !bytes.Equal(m.Digest, prePrepareMsg.Digest) {
+			continue
+		}
+		// the primary doesn't prepare, its pre-prepare message is taken as its prepare
+		if m.MType == ptypes.PREPARE && m.SendNode == prePrepareMsg.SendNode {
+			continue
+		}
+		senders[m.SendNode] = true
+	}
+	return len(senders)
+}
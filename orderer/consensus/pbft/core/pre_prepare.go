@@ -26,17 +26,31 @@ func (p *PBFT) HandlePrePrepareMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 
 	// check whether the message matching pre-prepare message
 	if !p.CheckPrePrepareMsg(msg) {
+		// the backup suspects the primary which sends an invalid pre-prepare of this view, such as the conflicting one,
+		// so the view changes if no valid one is committed in time
+		if !p.IsLeader() && msg.ViewNumber == p.View.ViewNumber && p.PTimer.Timer.IsStopped {
+			p.PTimer.Timer.Start(func() {
+				p.Logger.Println("[TIMER-EXPIRE-PREPREPARE]:", p.GetNodeName(), "View:", p.View.ViewNumber)
+				p.StartViewChange()
+			}, func() {
+			})
+		}
 		return nil
 	}
 
-	// the replica update local state for this view and stop the Timer which was set on last commit or view-change phase
+	// the replica update local state for this view and restart the Timer which was set on last commit or view-change phase,
+	// so that the view changes if the proposal is not committed in time
 	if !p.IsLeader() {
 		p.UpdateConsensus(*msg)
 
 		p.CurPhase = ptypes.PREPREPARE
 		p.CurProposal = msg.Proposal
 		p.SequenceNum = msg.SeqNum
-		p.PTimer.Timer.Stop()
+		p.PTimer.Timer.Start(func() {
+			p.Logger.Println("[TIMER-EXPIRE-PREPREPARE]:", p.GetNodeName(), "View:", p.View.ViewNumber)
+			p.StartViewChange()
+		}, func() {
+		})
 	}
 
 	// check whether has recieved enough matching prepare messages or commit messages before the pre-prepare message
@@ -96,6 +110,24 @@ func (p *PBFT) CheckPrePrepareMsg(msg *ptypes.PMsg) bool {
 		return false
 	}
 
+	// the block with an invalid or replayed request, not hashed by the canonical encoding, or whose data differs from its header is not accepted
+	if !p.IsLeader() && !msg.Block.BlkHdr.IsCanonical() {
+		p.Logger.Println("[Error]:", p.GetNodeName(), "reject the pre-prepare of seq", msg.SeqNum, "whose block version is", msg.Block.BlkHdr.Version)
+		return false
+	}
+	if !p.IsLeader() {
+		if err := msg.Block.VerifyBlockData(); err != nil {
+			p.Logger.Println("[Error]:", p.GetNodeName(), "reject the pre-prepare of seq", msg.SeqNum, err)
+			return false
+		}
+	}
+	if !p.IsLeader() && p.ReqValidator != nil {
+		if err := p.ReqValidator.CheckTxs(msg.Block.BlkData.Trans); err != nil {
+			p.Logger.Println("[Error]:", p.GetNodeName(), "reject the pre-prepare of seq", msg.SeqNum, err)
+			return false
+		}
+	}
+
 	p.LogMsg(msg)
 	return true
 }
@@ -107,7 +139,10 @@ func (p *PBFT) CheckPrePrepareMsg(msg *ptypes.PMsg) bool {
 // - nil, the reply message or commit message
 func (p *PBFT) CheckPrepareAndCommit(msg *ptypes.PMsg) *ptypes.PMsg {
 
-	if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) != 0 {
+	// the commit messages received before the pre-prepare message are kept if they match it,
+	// and the prepare messages are checked when they are not enough to commit
+	committed := false
+	if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs) != 0 {
 		commitMsgs := p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs
 		p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs = make([]*ptypes.PMsg, 0, len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs))
 		for _, commitMsg := range commitMsgs {
@@ -115,11 +150,10 @@ func (p *PBFT) CheckPrepareAndCommit(msg *ptypes.PMsg) *ptypes.PMsg {
 				p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs = append(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs, commitMsg)
 			}
 		}
+		committed = len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs) > (p.View.NodesNum-1)/3*2
+	}
 
-		if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].CommitMsgs) <= (p.View.NodesNum-1)/3*2 {
-			return nil
-		}
-
+	if committed {
 		for p.View.ViewNumber < msg.ViewNumber {
 			p.View.NextView()
 		}
@@ -134,6 +168,7 @@ func (p *PBFT) CheckPrepareAndCommit(msg *ptypes.PMsg) *ptypes.PMsg {
 			validation = append(validation, valJson...)
 		}
 		p.BlkStore.CurProposalBlk.BlkHdr.Validation = validation
+		p.BlkStore.CurProposalBlk.BlkHdr.ValidationMsg = msg.CommitByte()
 
 		replyMsg := &ptypes.PMsg{
 			MType:      ptypes.REPLY,
@@ -148,6 +183,11 @@ func (p *PBFT) CheckPrepareAndCommit(msg *ptypes.PMsg) *ptypes.PMsg {
 
 		// store block and update with an empty block
 		p.BlkStore.StoreBlock(p.BlkStore.CurProposalBlk)
+		if latency, ok := p.BlkStore.CurProposalBlk.BlkHdr.Latency(); ok {
+			p.PTimer.Timer.Pacemaker.ObserveCommit(latency)
+		}
+		// the commit messages came before the pre-prepare, so the elector observes the block here instead of in HandleCommitMsg
+		p.View.Certify(p.BlkStore.CurProposalBlk.BlkHdr.ViewNumber, p.BlkStore.CurProposalBlk.Hash(), p.BlkStore.CurProposalBlk.BlkHdr.PreBlkHash)
 
 		// check whether execute the check point
 
@@ -182,7 +222,7 @@ func (p *PBFT) CheckPrepareAndCommit(msg *ptypes.PMsg) *ptypes.PMsg {
 			}
 		}
 
-		if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) <= (p.View.NodesNum-1)/3*2 {
+		if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) < p.prepareQuorum() {
 			return nil
 		}
 
@@ -70,7 +70,7 @@ func (p *PBFT) prepared(msg *ptypes.PMsg) bool {
 	}
 
 	// check threshold
-	if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) <= (p.View.NodesNum-1)/3*2 {
+	if len(p.MsgLog[p.View.ViewNumber%ptypes.CHECKPOINTNUM].PrepareMsgs) < p.prepareQuorum() {
 		return false
 	}
 	return true
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"blockchain"
+	common "common"
+	ptypes "pbft/types"
+	"statemachine"
+)
+
+// PBFTState: the persisted state of PBFT, which is saved when the phase, the view, the sequence or the checkpoint advance
+// and reloaded when the node restarts
+type PBFTState struct {
+	CurPhase    ptypes.StateType      // the phase of the node
+	View        common.View           // the view which the node has entered
+	SequenceNum int                   // the sequence number of the next request
+	CPSeq       int                   // the sequence of the stable checkpoint
+	CPMsgs      []*ptypes.PMsg        // the proof of the stable checkpoint
+	WaitSeq     int                   // the sequence which the node is waiting for a checkpoint
+	MsgLog      []ptypes.MsgsLog      // the message logs since the stable checkpoint, which keep the accepted pre-prepare messages
+	BlkStore    blockchain.StoreState // the state of block store
+}
+
+// SaveState: persist the phase, the view, the sequence, the stable checkpoint, the message logs and the block store state
+func (p *PBFT) SaveState() {
+	err := p.BlkStore.SaveState(&PBFTState{
+		CurPhase:    p.CurPhase,
+		View:        p.View,
+		SequenceNum: p.SequenceNum,
+		CPSeq:       p.CheckPoint.Seq,
+		CPMsgs:      p.CheckPoint.CPMsgs,
+		WaitSeq:     p.CheckPoint.WaitSeq,
+		MsgLog:      p.MsgLog,
+		BlkStore:    p.BlkStore.GetStoreState(),
+	})
+	if err != nil {
+		p.Logger.Println("[ERROR]:", p.GetNodeName(), "save state", err)
+	}
+}
+
+// Recover: restart PBFT from the local block store
+// the committed blocks are replayed to the state machine and the persisted state is reloaded,
+// the accepted pre-prepare messages are kept in the message logs so that the node never prepares another request
+// with the same view and sequence. if the view doesn't go on, the timer starts the view-change
+// return:
+// - true if there is local data to recover from, and error
+func (p *PBFT) Recover() (bool, error) {
+	tip, err := p.BlkStore.Recover()
+	if err != nil {
+		return false, err
+	}
+	if err := statemachine.Replay(p.StateMachine, &p.BlkStore); err != nil {
+		return false, err
+	}
+
+	var state PBFTState
+	ok, err := p.BlkStore.LoadState(&state)
+	if err != nil {
+		return false, err
+	}
+	if !ok && tip == nil {
+		return false, nil
+	}
+
+	height := p.BlkStore.Height
+	p.CurPhase = ptypes.NEW_VIEW
+	if ok {
+		p.CurPhase = state.CurPhase
+		p.View.Restore(state.View)
+		p.SequenceNum = state.SequenceNum
+		p.CheckPoint.Seq = state.CPSeq
+		p.CheckPoint.CPMsgs = state.CPMsgs
+		p.CheckPoint.WaitSeq = state.WaitSeq
+		if len(state.MsgLog) == ptypes.CHECKPOINTNUM {
+			p.MsgLog = state.MsgLog
+		}
+		p.BlkStore.SetStoreState(state.BlkStore)
+	}
+
+	// the block of tip may be stored without saving the state when crashing,
+	// every committed block takes a sequence number and the node never goes back to the view of a committed block,
+	// the pipelined sequence numbers are committed in the view of the same primary, so the node stays in the view of the tip
+	if tip != nil && p.View.ViewNumber <= tip.BlkHdr.ViewNumber {
+		p.SequenceNum += height - p.BlkStore.Height
+		p.BlkStore.Height = height
+		p.BlkStore.PreBlkHash = tip.Hash()
+		lastView := tip.BlkHdr.ViewNumber
+		if p.Pipelined() {
+			lastView--
+		}
+		for p.View.ViewNumber <= lastView {
+			p.View.NextView()
+		}
+		p.CurPhase = ptypes.NEW_VIEW
+	}
+	if p.CurPhase == ptypes.NEW_VIEW || p.CurPhase == ptypes.WAITING || p.CurPhase == ptypes.CHECKPOINT {
+		p.CurPhase = ptypes.NEW_VIEW
+		if p.IsLeader() {
+			p.CurPhase = ptypes.WAITING
+		}
+	}
+
+	p.CurProposal = ptypes.Proposal{}
+	p.NewViewMsgs = make(map[int][]*ptypes.PMsg)
+	p.ReSetViewchangeMsgs()
+	p.PTimer.Timer.Start(func() {
+		p.Logger.Println("[TIMER-EXPIRE-RECOVER]:", p.GetNodeName(), "View:", p.View.ViewNumber)
+		p.StartViewChange()
+	}, func() {
+	})
+	return true, nil
+}
+
+// Rejoin: PBFT needn't send any message to rejoin,
+// the node waits for the pre-prepare message or the view-change of the recovered view
+// return:
+// - nil
+func (p *PBFT) Rejoin() *ptypes.PMsg {
+	return nil
+}
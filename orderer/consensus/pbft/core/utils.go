@@ -1,12 +1,13 @@
 package core
 
 import (
+	"bcrequest"
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"message"
 	ptypes "pbft/types"
 	"strconv"
+	"wire"
 )
 
 // IsLeader: return whether the current node is a leader(true if leader)
@@ -78,6 +79,12 @@ func (p *PBFT) LogMsg(msg *ptypes.PMsg) {
 	case ptypes.CHECKPOINT:
 		p.CheckPoint.CPMsgsBuffer[msg.SeqNum] = append(p.CheckPoint.CPMsgsBuffer[msg.SeqNum], msg)
 	case ptypes.VIEW_CHANGE:
+		// the view-change message sent again is logged once
+		for _, m := range p.ViewChangeMsgs.NewViewMsgs {
+			if m.SendNode == msg.SendNode && m.ViewNumber == msg.ViewNumber {
+				return
+			}
+		}
 		p.ViewChangeMsgs.NewViewMsgs = append(p.ViewChangeMsgs.NewViewMsgs, msg)
 	case ptypes.VC_PREPARE:
 		p.ViewChangeMsgs.PrepareMsgs = append(p.ViewChangeMsgs.PrepareMsgs, msg)
@@ -93,27 +100,61 @@ func (p *PBFT) UpdateConsensus(msg ptypes.PMsg) {
 	p.BlkStore.CurBlkHash = p.BlkStore.CurProposalBlk.Hash()
 }
 
-// GetValidMsgs: get all valid pre-prepare message and matching prepare message
-// valid: a pre-prepare message has 2f+1 matching prepare message which is considered to be valid
+// prepareQuorum: the number of matching prepare messages from different backups for the predicate prepared,
+// the pre-prepare message is taken as the prepare of the primary, so 2f prepares are needed
+func (p *PBFT) prepareQuorum() int {
+	return (p.View.NodesNum - 1) / 3 * 2
+}
+
+// GetValidMsgs: get the prepared certificates of the sequence numbers from the last stable checkpoint to the high water mark,
+// the certificate of the latest view is taken if the sequence number is prepared in more than one view
+// valid: a pre-prepare message has 2f matching prepare message from different backups which is considered to be valid
+// note: the message logs are looked up by the sequence number in the pre-prepare message, since the pipelined proposals keep them
+// by sequence number and the others by view, and the sequence number which is not prepared doesn't hide the later ones
 func (p *PBFT) GetValidMsgs() []*ptypes.Pm {
 	pm := make([]*ptypes.Pm, 0)
-	j := 0
-	threshold := (p.View.NodesNum - 1) / 3 * 2
-	for i := 0; i < len(p.MsgLog); i++ {
-		if p.MsgLog[i].IsEmpty() || len(p.MsgLog[i].PrepareMsgs) <= threshold {
-			break
+	for seq := p.CheckPoint.Seq; seq <= p.CheckPoint.Seq+ptypes.CHECKPOINTNUM; seq++ {
+		var cert *ptypes.Pm
+		for i := range p.MsgLog {
+			if c := p.preparedCert(&p.MsgLog[i], seq); c != nil && (cert == nil || c.PrePrepareMsg.ViewNumber > cert.PrePrepareMsg.ViewNumber) {
+				cert = c
+			}
 		}
+		if cert != nil {
+			pm = append(pm, cert)
+		}
+	}
+	return pm
+}
 
-		pm = append(pm, &ptypes.Pm{
-			PrePrepareMsg: p.MsgLog[i].PreprepareMsg.PMsg2VCMsg(),
+// preparedCert: get the prepared certificate of the sequence number in the message log, which is the pre-prepare message
+// and the matching prepare messages of different backups if prepared(m, v, n, i) is true, or else the certificate of an earlier view
+// which the log keeps since the sequence number is proposed again in the new view
+// return:
+// - the certificate, or nil if the sequence number is not prepared in the log
+func (p *PBFT) preparedCert(ml *ptypes.MsgsLog, seq int) *ptypes.Pm {
+	if ppMsg := ml.PreprepareMsg; ppMsg != nil && ppMsg.SeqNum == seq {
+		cert := &ptypes.Pm{
+			PrePrepareMsg: ppMsg.PMsg2VCMsg(),
 			PrepareMsgs:   make([]*ptypes.VCMsg, 0),
-		})
-		for _, v := range p.MsgLog[i].PrepareMsgs {
-			pm[j].PrepareMsgs = append(pm[j].PrepareMsgs, v.PMsg2VCMsg())
+			Block:         ppMsg.Block,
+		}
+		senders := make(map[string]bool)
+		for _, m := range ml.PrepareMsgs {
+			if m.ViewNumber != ppMsg.ViewNumber || m.SeqNum != seq || !bytes.Equal(m.Digest, ppMsg.Digest) || m.SendNode == ppMsg.SendNode || senders[m.SendNode] {
+				continue
+			}
+			senders[m.SendNode] = true
+			cert.PrepareMsgs = append(cert.PrepareMsgs, m.PMsg2VCMsg())
+		}
+		if len(cert.PrepareMsgs) >= p.prepareQuorum() {
+			return cert
 		}
-		j++
 	}
-	return pm
+	if ml.Prepared != nil && ml.Prepared.PrePrepareMsg.SeqNum == seq {
+		return ml.Prepared
+	}
+	return nil
 }
 
 // ReSetViewchangeMsgs: reset the veiw-change message log
@@ -126,7 +167,7 @@ func (p *PBFT) ReSetViewchangeMsgs() {
 // params:
 // - msg: message that need to be sent
 func (p *PBFT) SendSerMsg(msg *ptypes.PMsg) {
-	msgJson, err := json.Marshal(msg)
+	msgJson, err := wire.Marshal(msg, p.Codec)
 	if err != nil {
 		return
 	}
@@ -140,6 +181,31 @@ func (p *PBFT) SendSerMsg(msg *ptypes.PMsg) {
 	p.SendChan <- serMsg
 }
 
+// SendResults: send the results of the executed commands, each client gets the results of its own requests
+func (p *PBFT) SendResults() {
+	for _, reply := range bcrequest.GroupResults(p.ExecTxs, p.ExecResults) {
+		go p.SendSerMsg(&ptypes.PMsg{
+			ViewNumber: p.View.ViewNumber - 1,
+			// HsNode:     bhs.HsNode,
+			Proposal: ptypes.Proposal{},
+			SendNode: p.GetNodeName(),
+			ReciNode: reply.Id,
+			Results:  reply.Results,
+		})
+	}
+}
+
+// SendCheckPoint: send the checkpoint message after the request of the sequence is executed
+// if this reply's sequence is evenly divided by the const number CHECKPOINTNUM preset
+// and checkpoint message is not empty, the node will implement garbage collection mechanisms and update checkpoint
+// params:
+// - seq: the sequence of the executed request
+func (p *PBFT) SendCheckPoint(seq int) {
+	if (seq+1)%ptypes.CHECKPOINTNUM == 0 && len(p.CheckPoint.CPMsgsBuffer[seq]) != 0 {
+		p.SendSerMsg(p.CheckPoint.CPMsgsBuffer[seq][0])
+	}
+}
+
 // initLeader: the node which is leader in view init
 func (p *PBFT) InitLeader() {
 	p.CurPhase = ptypes.WAITING
@@ -150,7 +216,13 @@ func (p *PBFT) GetLeaderName() string {
 	return p.View.LeaderName()
 }
 
-// Execute: execute the commands
+// Execute: execute the commands of the committed block by the state machine and keep the results for the client
+// note: only the block with validation generated from commit messages has been committed and can be executed
 func (p *PBFT) Execute() bool {
+	p.ExecResults, p.ExecTxs = nil, nil
+	if p.StateMachine != nil && len(p.BlkStore.CurProposalBlk.BlkHdr.Validation) != 0 {
+		p.ExecResults = p.StateMachine.Apply(p.BlkStore.CurProposalBlk)
+		p.ExecTxs = p.BlkStore.CurProposalBlk.BlkData.Trans
+	}
 	return true
 }
@@ -50,6 +50,12 @@ func (p *PBFT) StartViewChange() {
 		}
 	}
 
+	// the view-change message is sent again when the timer expires before the new view,
+	// since the messages sent during a partition are lost
+	p.PTimer.Timer.Start(func() {
+		p.StartViewChange()
+	}, func() {})
+
 	// log
 	p.Logger.Println("[VIEW-CHANGE-START]:", p.GetNodeName(), "Expect enter view", p.View.ViewNumber+1)
 }
@@ -67,16 +73,41 @@ func (p *PBFT) HandleViewChangeMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 		return nil
 	}
 	p.LogMsg(msg)
+	vCMsgs := p.GetViewChangeMsgs(msg.ViewNumber)
+
+	// the replica which falls behind joins the view change once f+1 replicas wish to enter a later view,
+	// since at least one of them is correct
+	target := p.View.ViewNumber
+	if p.CurPhase == ptypes.VIEW_CHANGE {
+		target++
+	}
+	if msg.ViewNumber > target && len(vCMsgs) == (p.View.NodesNum-1)/3+1 {
+		for p.View.ViewNumber < msg.ViewNumber-1 {
+			p.View.NextView()
+		}
+		p.StartViewChange()
+	}
 
 	// check the threshold, the equality here is to prevent multiple response messages
-	if len(p.ViewChangeMsgs.NewViewMsgs) != (p.View.NodesNum-1)/3*2+1 {
+	if len(vCMsgs) != (p.View.NodesNum-1)/3*2+1 {
 		return nil
 	}
 
+	// the view-change messages of the other views are dropped
+	p.ViewChangeMsgs.NewViewMsgs = vCMsgs
 	for p.View.ViewNumber < msg.ViewNumber {
 		p.View.NextView()
 	}
 
+	// the replica whose timer has not expired enters the view change with the others
+	if p.CurPhase != ptypes.VIEW_CHANGE {
+		p.CurPhase = ptypes.VIEW_CHANGE
+		p.PTimer.Timer.Start(func() {
+			p.StartViewChange()
+		}, func() {
+		})
+	}
+
 	// fmt.Println(p.GetNodeName(), p.View)
 	// the replica only stop timer after recieve enough message
 	if !p.IsLeader() {
@@ -92,11 +123,14 @@ func (p *PBFT) HandleViewChangeMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 	OSet := make([]*ptypes.PMsg, 0)
 
 	// get the min-s(sequence of the last stable checkpoint) and max-s(the max sequence of valid pre-prepare message)
-	minS, maxS := p.GetSeq()
+	minS, maxS := GetSeq(VSet)
 
 	// generate new pre-prepare messages for each valid pre-prepare message after checkpoint
 	// sign them respectively and add them to new-view message OSet
-	if minS != -1 && maxS != -1 {
+	if p.Pipelined() {
+		OSet = p.PipelinedOSet(VSet)
+	} else if minS != -1 && maxS != -1 {
+		certs := p.PreparedCerts(VSet)
 		for i := minS; i <= maxS; i++ {
 			prePrepareMsg := &ptypes.PMsg{
 				MType:      ptypes.PREPREPARE,
@@ -104,16 +138,9 @@ func (p *PBFT) HandleViewChangeMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 				SeqNum:     i,
 			}
 
-			// add the same sequence digest of PSet of some view-change message in VSet
-		outloop:
-			for _, vCMsg := range p.ViewChangeMsgs.NewViewMsgs {
-				for _, pm := range vCMsg.PSet {
-					if pm.PrePrepareMsg.SeqNum == i && len(pm.PrepareMsgs) > (p.View.NodesNum-1)/3*2 {
-						prePrepareMsg.Digest = pm.PrePrepareMsg.Digest
-						// fmt.Println(prePrepareMsg.Block)
-						break outloop
-					}
-				}
+			// add the digest of the prepared certificate of the latest view of the sequence in VSet
+			if cert, ok := certs[i]; ok {
+				prePrepareMsg.Digest = cert.PrePrepareMsg.Digest
 			}
 
 			sign := p.Signer.Sign(prePrepareMsg.Message2Byte(0))
@@ -144,24 +171,25 @@ func (p *PBFT) HandleViewChangeMsg(msg *ptypes.PMsg) *ptypes.PMsg {
 // GetSeq implement PBFT description as follow:
 // The primary determines the sequence number min-s of the latest stable checkpoint in V and
 // the highest sequence number max-s in a prepare message in V.
-func (p *PBFT) GetSeq() (int, int) {
-	if len(p.ViewChangeMsgs.NewViewMsgs) == 0 || len(p.ViewChangeMsgs.NewViewMsgs[0].CSet) == 0 {
-		fmt.Println("GetSeq eixst zero", p.GetNodeName(), len(p.ViewChangeMsgs.NewViewMsgs), len(p.ViewChangeMsgs.NewViewMsgs[0].CSet))
+// params:
+// - vSet: the view-change messages of the new view
+func GetSeq(vSet []*ptypes.PMsg) (int, int) {
+	if len(vSet) == 0 || len(vSet[0].CSet) == 0 {
 		return -1, -1
 	}
 	minS := -1
 	maxS := -1
 
-	for i := 0; i < len(p.ViewChangeMsgs.NewViewMsgs); i++ {
-		for j := 0; j < len(p.ViewChangeMsgs.NewViewMsgs[i].CSet); j++ {
-			if minS < p.ViewChangeMsgs.NewViewMsgs[i].CSet[j].SeqNum {
-				minS = p.ViewChangeMsgs.NewViewMsgs[i].CSet[j].SeqNum
+	for i := 0; i < len(vSet); i++ {
+		for j := 0; j < len(vSet[i].CSet); j++ {
+			if minS < vSet[i].CSet[j].SeqNum {
+				minS = vSet[i].CSet[j].SeqNum
 			}
 		}
-		for k := 0; k < len(p.ViewChangeMsgs.NewViewMsgs[i].PSet); k++ {
-			for l := 0; l < len(p.ViewChangeMsgs.NewViewMsgs[i].PSet[k].PrepareMsgs); l++ {
-				if maxS < p.ViewChangeMsgs.NewViewMsgs[i].PSet[k].PrepareMsgs[l].SeqNum {
-					maxS = p.ViewChangeMsgs.NewViewMsgs[i].PSet[k].PrepareMsgs[l].SeqNum
+		for k := 0; k < len(vSet[i].PSet); k++ {
+			for l := 0; l < len(vSet[i].PSet[k].PrepareMsgs); l++ {
+				if maxS < vSet[i].PSet[k].PrepareMsgs[l].SeqNum {
+					maxS = vSet[i].PSet[k].PrepareMsgs[l].SeqNum
 				}
 			}
 		}
@@ -169,17 +197,62 @@ func (p *PBFT) GetSeq() (int, int) {
 	return minS, maxS
 }
 
-// VerifyOSet: the replica verify the OSet of the new-view message
+// GetViewChangeMsgs: get the logged view-change messages which wish to enter the view
+func (p *PBFT) GetViewChangeMsgs(view int) []*ptypes.PMsg {
+	vCMsgs := make([]*ptypes.PMsg, 0)
+	for _, m := range p.ViewChangeMsgs.NewViewMsgs {
+		if m.ViewNumber == view {
+			vCMsgs = append(vCMsgs, m)
+		}
+	}
+	return vCMsgs
+}
+
+// VerifyVSet: the replica verify the VSet of the new-view message contains 2f+1 valid view-change messages
+// of different replicas for the view
+func (p *PBFT) VerifyVSet(msg *ptypes.PMsg) bool {
+	senders := make(map[string]bool)
+	for _, vCMsg := range msg.VSet {
+		if vCMsg.MType != ptypes.VIEW_CHANGE || vCMsg.ViewNumber != msg.ViewNumber || senders[vCMsg.SendNode] {
+			return false
+		}
+		if !p.Signer.VerifySign(vCMsg.SendNode, vCMsg.Signature, vCMsg.Message2Byte(2)) {
+			return false
+		}
+		senders[vCMsg.SendNode] = true
+	}
+	return len(senders) > (p.View.NodesNum-1)/3*2
+}
+
+// VerifyOSet: the replica verify the OSet of the new-view message by recreating it from the VSet
 func (p *PBFT) VerifyOSet(msg *ptypes.PMsg) bool {
 
+	// the pipelined proposals are proposed again with their blocks, which are the ones of the certificates
+	if p.Pipelined() {
+		certs := p.Reproposals(msg.VSet)
+		if len(msg.OSet) != len(certs) {
+			return false
+		}
+		for i, m := range msg.OSet {
+			cert := certs[i].PrePrepareMsg
+			if m.MType != ptypes.PREPREPARE || m.ViewNumber != msg.ViewNumber || m.SeqNum != cert.SeqNum || !bytes.Equal(m.Digest, cert.Digest) {
+				return false
+			}
+			if m.SendNode != msg.SendNode || !p.Signer.VerifySign(m.SendNode, m.Signature, m.Message2Byte(0)) || !bytes.Equal(m.Block.Hash(), m.Digest) || m.Block.VerifyBlockData() != nil {
+				return false
+			}
+		}
+		return true
+	}
+
 	// the replica recreate O similar to the leader
-	// myOSet := make([]*ptypes.PMsg, 0)
-	minS, maxS := p.GetSeq()
+	minS, maxS := GetSeq(msg.VSet)
+	certs := p.PreparedCerts(msg.VSet)
 
 	// when msg.OSet is empty reture true if and only if the all view-change messages' PSet is empty
 	// otherwise reture false
 	if len(msg.OSet) == 0 {
-		for _, vCMsg := range p.ViewChangeMsgs.NewViewMsgs {
+		for _, vCMsg := range msg.VSet {
 			if len(vCMsg.PSet) != 0 {
 				fmt.Println("len(msg.OSet) == 0, len(vCMsg.PSet) != 0", vCMsg.SendNode)
 				return false
@@ -193,17 +266,127 @@ func (p *PBFT) VerifyOSet(msg *ptypes.PMsg) bool {
 		return false
 	}
 
-	j := 0
-	for i := minS; i < maxS; i++ {
-		for _, vCMsg := range p.ViewChangeMsgs.NewViewMsgs {
-			for _, pm := range vCMsg.PSet {
-				if pm.PrePrepareMsg.SeqNum == i && len(pm.PrepareMsgs) > (p.View.NodesNum-1)/3*2 {
-					if !bytes.Equal(msg.OSet[j].Digest, pm.PrePrepareMsg.Digest) || !p.Signer.VerifySign(msg.SendNode, msg.OSet[i].Signature, msg.OSet[i].Message2Byte(0)) {
-						return false
-					}
-				}
-			}
+	for i := minS; i <= maxS; i++ {
+		m := msg.OSet[i-minS]
+		if m.SeqNum != i || !p.Signer.VerifySign(msg.SendNode, m.Signature, m.Message2Byte(0)) {
+			return false
+		}
+		if cert, ok := certs[i]; ok && !bytes.Equal(m.Digest, cert.PrePrepareMsg.Digest) {
+			return false
 		}
 	}
 	return true
 }
+
+// VerifyPm: check the Pm of a view-change message is a prepared certificate, whose pre-prepare message is signed by its sender,
+// and whose prepare messages are signed by 2f different backups other than the sender and match the pre-prepare message
+func (p *PBFT) VerifyPm(pm *ptypes.Pm) bool {
+	if pm == nil || pm.PrePrepareMsg == nil {
+		return false
+	}
+	ppMsg := pm.PrePrepareMsg
+	if ppMsg.MType != ptypes.PREPREPARE || !p.Signer.VerifySign(ppMsg.SendNode, ppMsg.Signature, ppMsg.VCMsg2Byte(0)) {
+		return false
+	}
+	senders := make(map[string]bool)
+	for _, m := range pm.PrepareMsgs {
+		if m == nil || m.MType != ptypes.PREPARE || m.ViewNumber != ppMsg.ViewNumber || m.SeqNum != ppMsg.SeqNum || !bytes.Equal(m.Digest, ppMsg.Digest) {
+			continue
+		}
+		if m.SendNode == ppMsg.SendNode || senders[m.SendNode] || !p.Signer.VerifySign(m.SendNode, m.Signature, m.VCMsg2Byte(1)) {
+			continue
+		}
+		senders[m.SendNode] = true
+	}
+	return len(senders) >= p.prepareQuorum()
+}
+
+// PreparedCerts: get the prepared certificate of the latest view of each sequence number in the view-change messages,
+// the certificates which fail VerifyPm are ignored. The block of the certificate is taken from any certificate of the same digest
+// whose block is the one of the digest, so that the forged block of a faulty replica doesn't hide the certificate
+// params:
+// - vSet: the view-change messages of the new view
+// return:
+// - the certificates by sequence number, the block of the certificate is empty if no certificate carries the block of its digest
+func (p *PBFT) PreparedCerts(vSet []*ptypes.PMsg) map[int]*ptypes.Pm {
+	certs := make(map[int]*ptypes.Pm)
+	valid := make([]*ptypes.Pm, 0)
+	for _, vCMsg := range vSet {
+		for _, pm := range vCMsg.PSet {
+			if !p.VerifyPm(pm) {
+				continue
+			}
+			valid = append(valid, pm)
+			seq := pm.PrePrepareMsg.SeqNum
+			if cert, ok := certs[seq]; !ok || pm.PrePrepareMsg.ViewNumber > cert.PrePrepareMsg.ViewNumber {
+				certs[seq] = &ptypes.Pm{PrePrepareMsg: pm.PrePrepareMsg, PrepareMsgs: pm.PrepareMsgs}
+			}
+		}
+	}
+	for _, pm := range valid {
+		cert := certs[pm.PrePrepareMsg.SeqNum]
+		digest := cert.PrePrepareMsg.Digest
+		if !bytes.Equal(cert.Block.Hash(), digest) && bytes.Equal(pm.PrePrepareMsg.Digest, digest) && bytes.Equal(pm.Block.Hash(), digest) && pm.Block.VerifyBlockData() == nil {
+			cert.Block = pm.Block
+		}
+	}
+	return certs
+}
+
+// Reproposals: get the prepared certificates which the primary of the new view proposes again if the proposals are pipelined,
+// which are the ones of the sequence numbers from the last stable checkpoint on, up to the first sequence number without
+// the certificate or whose block doesn't extend the block of the previous one
+// note: the replicas commit the sequence numbers in order, and the sequence number committed by a correct replica is prepared by
+// f+1 correct replicas, one of which sends its view-change message in the VSet, so the committed sequence numbers are
+// in the prefix of the certificates, the later ones are not committed by any correct replica and the new primary may reassign them
+// params:
+// - vSet: the view-change messages of the new view
+// return:
+// - the certificates in order of sequence number
+func (p *PBFT) Reproposals(vSet []*ptypes.PMsg) []*ptypes.Pm {
+	minS, _ := GetSeq(vSet)
+	certs := p.PreparedCerts(vSet)
+
+	// the stable checkpoint is proposed again only if its log is kept, and the replicas which executed it ignore it
+	seq := minS
+	if _, ok := certs[seq]; !ok {
+		seq++
+	}
+	reproposals := make([]*ptypes.Pm, 0)
+	for ; seq <= minS+ptypes.CHECKPOINTNUM; seq++ {
+		cert, ok := certs[seq]
+		if !ok || !bytes.Equal(cert.Block.Hash(), cert.PrePrepareMsg.Digest) {
+			break
+		}
+		if n := len(reproposals); n > 0 && !bytes.Equal(cert.Block.BlkHdr.PreBlkHash, reproposals[n-1].PrePrepareMsg.Digest) {
+			break
+		}
+		reproposals = append(reproposals, cert)
+	}
+	return reproposals
+}
+
+// PipelinedOSet: the primary of the new view generates the pre-prepare messages of the new view for the prepared certificates
+// which are proposed again, see Reproposals, each of them carries the block of the certificate
+// params:
+// - vSet: the view-change messages of the new view
+// return:
+// - the signed pre-prepare messages in order of sequence number
+func (p *PBFT) PipelinedOSet(vSet []*ptypes.PMsg) []*ptypes.PMsg {
+	oSet := make([]*ptypes.PMsg, 0)
+	for _, cert := range p.Reproposals(vSet) {
+		prePrepareMsg := &ptypes.PMsg{
+			MType:      ptypes.PREPREPARE,
+			ViewNumber: p.View.ViewNumber,
+			SeqNum:     cert.PrePrepareMsg.SeqNum,
+			Digest:     cert.PrePrepareMsg.Digest,
+			SendNode:   p.GetNodeName(),
+			ReciNode:   "Broadcast",
+			Proposal:   cert.PrePrepareMsg.Proposal,
+			Block:      cert.Block,
+		}
+		prePrepareMsg.Signature = p.Signer.Sign(prePrepareMsg.Message2Byte(0))
+		oSet = append(oSet, prePrepareMsg)
+	}
+	return oSet
+}
@@ -2,6 +2,8 @@ package ptypes
 
 import (
 	"blockchain"
+	"canonical"
+	"errors"
 )
 
 // PMsg: PBFT message
@@ -23,6 +25,8 @@ type PMsg struct {
 	PSet []*Pm   `json:"PSet,omitempty"` // the collection of Pm
 	VSet []*PMsg `json:"VSet,omitempty"` // the collection of the valid view-change messages received by the primary
 	OSet []*PMsg `json:"OSet,omitempty"` // the collection of newly generated pre-prepare messages
+
+	Results []string `json:"Results,omitempty"` // the results of executed commands which reply to the client
 }
 
 // Pm:  pre-prepare messages and a collection of prepare messages
@@ -30,8 +34,9 @@ type PMsg struct {
 // Pm contains a valid pre-prepare message (without the corresponding client message) and 2f matching, valid
 // prepare messages signed by different backups with the same view, sequence number, and the digest of m .
 type Pm struct {
-	PrePrepareMsg *VCMsg   `json:"PrePrepareMsg,omitempty"` // the pre-prepare messages
-	PrepareMsgs   []*VCMsg `json:"PrepareMsgs,omitempty"`   // a collection of prepare messages corresponds to the pre-prepare message
+	PrePrepareMsg *VCMsg           `json:"PrePrepareMsg,omitempty"` // the pre-prepare messages
+	PrepareMsgs   []*VCMsg         `json:"PrepareMsgs,omitempty"`   // a collection of prepare messages corresponds to the pre-prepare message
+	Block         blockchain.Block `json:"Block"`                   // the block of the pre-prepare message, which the primary of the new view proposes again
 }
 
 type VCMsg struct {
@@ -48,7 +53,7 @@ type VCMsg struct {
 	ReciNode string // the receiving node of the message
 }
 
-// VCMsg2Byte: convert the VCMsg to byte slice
+// VCMsg2Byte: convert the VCMsg to byte slice by the canonical encoding, which is the same as the PMsg it comes from
 // params:
 // - transType: conversion type
 // -- 0: convert message type, view number, sequence, digest
@@ -58,16 +63,15 @@ type VCMsg struct {
 func (vcm *VCMsg) VCMsg2Byte(transType int) []byte {
 	switch transType {
 	case 0:
-		return append([]byte{byte(vcm.MType), byte(vcm.ViewNumber), byte(vcm.SeqNum)}, vcm.Digest...)
+		return encodeMsg(canonical.TAG_PBFT_DIGEST, vcm.MType, vcm.ViewNumber, vcm.SeqNum, vcm.Digest).Encoded()
 	case 1:
-		res := append([]byte{byte(vcm.MType), byte(vcm.ViewNumber), byte(vcm.SeqNum)}, vcm.Digest...)
-		return append(res, []byte(vcm.SendNode)...)
+		return encodeMsg(canonical.TAG_PBFT_SIGNED, vcm.MType, vcm.ViewNumber, vcm.SeqNum, vcm.Digest).String(vcm.SendNode).Encoded()
 	default:
 		return nil
 	}
 }
 
-// Message2Byte: convert message to byte slice
+// Message2Byte: convert message to byte slice by the canonical encoding, each conversion type has its own tag
 // params:
 // - transType: conversion type
 // -- 0 : return message type, view number, sequence number, digest
@@ -79,44 +83,78 @@ func (vcm *VCMsg) VCMsg2Byte(transType int) []byte {
 func (m *PMsg) Message2Byte(transType int) []byte {
 	switch transType {
 	case 0:
-		return append([]byte{byte(m.MType), byte(m.ViewNumber), byte(m.SeqNum)}, m.Digest...)
+		return encodeMsg(canonical.TAG_PBFT_DIGEST, m.MType, m.ViewNumber, m.SeqNum, m.Digest).Encoded()
 	case 1:
-		res := append([]byte{byte(m.MType), byte(m.ViewNumber), byte(m.SeqNum)}, m.Digest...)
-		return append(res, []byte(m.SendNode)...)
+		return encodeMsg(canonical.TAG_PBFT_SIGNED, m.MType, m.ViewNumber, m.SeqNum, m.Digest).String(m.SendNode).Encoded()
 	case 2:
-		res := append([]byte{byte(m.MType), byte(m.ViewNumber), byte(m.SeqNum)}, m.Digest...)
+		cset := make([][]byte, len(m.CSet))
 		for i := 0; i < len(m.CSet); i++ {
-			res = append(res, m.CSet[i].Message2Byte(1)...)
+			cset[i] = m.CSet[i].Message2Byte(1)
 		}
+		pset := make([][]byte, 0, len(m.PSet))
 		for i := 0; i < len(m.PSet); i++ {
 			if m.PSet[i] == nil {
 				break
 			}
-			res = append(res, m.PSet[i].Pm2Byte()...)
+			pset = append(pset, m.PSet[i].Pm2Byte())
 		}
-		return append(res, []byte(m.SendNode)...)
+		e := encodeMsg(canonical.TAG_PBFT_VIEW_CHANGE, m.MType, m.ViewNumber, m.SeqNum, m.Digest)
+		return e.BytesList(cset).BytesList(pset).String(m.SendNode).Encoded()
 	case 3:
-		res := []byte{byte(m.MType), byte(m.ViewNumber)}
+		vset := make([][]byte, len(m.VSet))
 		for i := 0; i < len(m.VSet); i++ {
-			res = append(res, m.VSet[i].Message2Byte(0)...)
+			vset[i] = m.VSet[i].Message2Byte(0)
 		}
+		oset := make([][]byte, len(m.OSet))
 		for i := 0; i < len(m.OSet); i++ {
-			res = append(res, m.OSet[i].Message2Byte(0)...)
+			oset[i] = m.OSet[i].Message2Byte(0)
 		}
-		return res
+		e := canonical.NewEncoder(canonical.TAG_PBFT_NEW_VIEW).Uint8(uint8(m.MType)).Int(m.ViewNumber)
+		return e.BytesList(vset).BytesList(oset).Encoded()
 	default:
-		return []byte{byte(m.MType), byte(m.ViewNumber)}
+		return canonical.NewEncoder(canonical.TAG_PBFT_HEADER).Uint8(uint8(m.MType)).Int(m.ViewNumber).Encoded()
+	}
+}
+
+// encodeMsg: start the canonical encoding of message with its type, view number, sequence number and digest
+func encodeMsg(tag string, mType StateType, viewNumber int, seqNum int, digest []byte) *canonical.Encoder {
+	return canonical.NewEncoder(tag).Uint8(uint8(mType)).Int(viewNumber).Int(seqNum).Bytes(digest)
+}
+
+// CommitByte: convert the commit of the pre-prepare to the byte slice without sender, which is the validation message
+// of the committed block, so the view, the sequence number and the block hash of the commit messages are verified by it
+// return:
+// - the byte slice of the commit without sender
+func (m *PMsg) CommitByte() []byte {
+	return encodeMsg(canonical.TAG_PBFT_DIGEST, COMMIT, m.ViewNumber, m.SeqNum, m.Digest).Encoded()
+}
+
+// DecodeCommitByte: decode the byte slice written by CommitByte
+// params:
+// - b: the validation message of the committed block
+// return:
+// - the commit message without sender and signature, and error
+func DecodeCommitByte(b []byte) (*PMsg, error) {
+	m := &PMsg{}
+	d := canonical.NewDecoder(canonical.TAG_PBFT_DIGEST, b)
+	m.MType, m.ViewNumber, m.SeqNum, m.Digest = StateType(d.Uint8()), d.Int(), d.Int(), d.Bytes()
+	if err := d.Finish(); err != nil {
+		return nil, err
+	}
+	if m.MType != COMMIT {
+		return nil, errors.New("the validation message is not a commit")
 	}
+	return m, nil
 }
 
 // Pm2Byte: convert Pm to byte slice
 func (pm *Pm) Pm2Byte() []byte {
-	res := make([]byte, 0)
-	res = append(res, pm.PrePrepareMsg.VCMsg2Byte(0)...)
+	prepares := make([][]byte, len(pm.PrepareMsgs))
 	for i := 0; i < len(pm.PrepareMsgs); i++ {
-		res = append(res, pm.PrepareMsgs[i].VCMsg2Byte(1)...)
+		prepares[i] = pm.PrepareMsgs[i].VCMsg2Byte(1)
 	}
-	return res
+	e := canonical.NewEncoder(canonical.TAG_PBFT_PM).Bytes(pm.PrePrepareMsg.VCMsg2Byte(0))
+	return e.BytesList(prepares).Encoded()
 }
 
 // Pm2VCMsg: convert Pm to VCMsg
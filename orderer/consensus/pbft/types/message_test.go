@@ -0,0 +1,80 @@
+package ptypes_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	ptypes "pbft/types"
+	"reflect"
+	"testing"
+	"wire"
+)
+
+// TestSignedBytes: test the golden vectors of the signed bytes of messages, the VCMsg keeps the bytes of the message it comes from,
+// and the view numbers and sequence numbers which wrap in a byte get different bytes
+func TestSignedBytes(t *testing.T) {
+	m := ptypes.PMsg{MType: ptypes.PREPARE, ViewNumber: 257, SeqNum: 300, Digest: []byte{1, 2}, SendNode: "r_1"}
+	golden := "00000017646373636861696e2f706266742f6469676573742f7631" + "02" + "0000000000000101" + "000000000000012c" + "00000002" + "0102"
+	if hex.EncodeToString(m.Message2Byte(0)) != golden {
+		t.Fatalf("digest message: expected %s, got %x", golden, m.Message2Byte(0))
+	}
+	golden = "00000017646373636861696e2f706266742f7369676e65642f7631" + "02" + "0000000000000101" + "000000000000012c" + "00000002" + "0102" + "00000003725f31"
+	if hex.EncodeToString(m.Message2Byte(1)) != golden {
+		t.Fatalf("signed message: expected %s, got %x", golden, m.Message2Byte(1))
+	}
+	for i := 0; i < 2; i++ {
+		if !bytes.Equal(m.PMsg2VCMsg().VCMsg2Byte(i), m.Message2Byte(i)) {
+			t.Fatal("VCMsg bytes are different from the message", i)
+		}
+	}
+	wrapped := m
+	wrapped.ViewNumber, wrapped.SeqNum = 1, 44
+	if bytes.Equal(wrapped.Message2Byte(1), m.Message2Byte(1)) {
+		t.Fatal("wrapped view number collision")
+	}
+
+	// the view-change message nests the length-prefixed checkpoints and prepared sets
+	vc := ptypes.PMsg{
+		MType:      ptypes.VIEW_CHANGE,
+		ViewNumber: 2,
+		SeqNum:     3,
+		CSet:       []*ptypes.PMsg{&m},
+		PSet:       []*ptypes.Pm{{PrePrepareMsg: m.PMsg2VCMsg(), PrepareMsgs: []*ptypes.VCMsg{m.PMsg2VCMsg()}}},
+		SendNode:   "r_2",
+	}
+	sum := sha256.Sum256(vc.Message2Byte(2))
+	golden = "1b74baa001fad74a40d0d8c8c3435e1f5364ee573e95630a41760e3577866c2b"
+	if hex.EncodeToString(sum[:]) != golden {
+		t.Fatalf("view-change message: expected sha256 %s, got %x", golden, sum)
+	}
+}
+
+// TestWire: test the view-change message with the nested sets and the nil items survives the binary codec,
+// and the message nested too deep is rejected
+func TestWire(t *testing.T) {
+	m := ptypes.PMsg{MType: ptypes.PREPARE, ViewNumber: 257, SeqNum: 300, Digest: []byte{1, 2}, SendNode: "r_1"}
+	vc := &ptypes.PMsg{
+		MType:      ptypes.VIEW_CHANGE,
+		ViewNumber: 2,
+		CSet:       []*ptypes.PMsg{&m, nil},
+		PSet:       []*ptypes.Pm{{PrePrepareMsg: m.PMsg2VCMsg(), PrepareMsgs: []*ptypes.VCMsg{m.PMsg2VCMsg(), nil}}, nil, {}},
+		VSet:       []*ptypes.PMsg{},
+		SendNode:   "r_2",
+	}
+	data, err := wire.Marshal(vc, wire.BINARY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &ptypes.PMsg{}
+	if err := wire.Unmarshal(data, got); err != nil || !reflect.DeepEqual(vc, got) {
+		t.Fatalf("expected %+v, got %+v, %v", vc, got, err)
+	}
+
+	for i := 0; i < wire.MaxDepth; i++ {
+		vc = &ptypes.PMsg{CSet: []*ptypes.PMsg{vc}}
+	}
+	data, _ = wire.Marshal(vc, wire.BINARY)
+	if err := wire.Unmarshal(data, &ptypes.PMsg{}); err != wire.ErrTooDeep {
+		t.Fatal("deep message is accepted", err)
+	}
+}
@@ -8,6 +8,7 @@ type MsgsLog struct {
 	PreprepareMsg *PMsg   // the recieved pre-prepare message
 	PrepareMsgs   []*PMsg // the set of recieved prepare messages
 	CommitMsgs    []*PMsg // the set of recieved commit messages
+	Prepared      *Pm     // the prepared certificate of the sequence number in an earlier view, which is proposed again in the new view
 }
 
 // IsEmpty: check whether MsgLog is empty
@@ -17,3 +18,30 @@ func (ml *MsgsLog) IsEmpty() bool {
 	}
 	return ml.PreprepareMsg.Proposal.IsEmpty() || len(ml.PrepareMsgs) == 0
 }
+
+// DropBefore: drop the messages of the sequence numbers before the sequence number, the log is reused by the later one
+// params:
+// - seq: the earliest sequence number whose messages are kept
+func (ml *MsgsLog) DropBefore(seq int) {
+	if ml.PreprepareMsg != nil && ml.PreprepareMsg.SeqNum < seq {
+		ml.PreprepareMsg = nil
+	}
+	if ml.Prepared != nil && ml.Prepared.PrePrepareMsg.SeqNum < seq {
+		ml.Prepared = nil
+	}
+	ml.SelfMsgs = msgsFrom(ml.SelfMsgs, seq)
+	ml.NewViewMsgs = msgsFrom(ml.NewViewMsgs, seq)
+	ml.PrepareMsgs = msgsFrom(ml.PrepareMsgs, seq)
+	ml.CommitMsgs = msgsFrom(ml.CommitMsgs, seq)
+}
+
+// msgsFrom: get the messages from the sequence number on
+func msgsFrom(msgs []*PMsg, seq int) []*PMsg {
+	kept := msgs[:0]
+	for _, m := range msgs {
+		if m.SeqNum >= seq {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
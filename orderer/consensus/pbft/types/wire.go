@@ -0,0 +1,129 @@
+package ptypes
+
+import "wire"
+
+// EncodeWire: write the pbft message to the binary codec
+func (msg *PMsg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(msg.MType)).Int(msg.ViewNumber).Int(msg.SeqNum).Bytes(msg.Digest).Bytes(msg.Signature)
+	msg.Proposal.EncodeWire(w)
+	msg.Block.EncodeWire(w)
+	w.String(msg.SendNode).String(msg.ReciNode)
+	encodePMsgs(w, msg.CSet)
+	w.Count(len(msg.PSet), msg.PSet == nil)
+	for _, pm := range msg.PSet {
+		if w.Bool(pm != nil); pm != nil {
+			pm.EncodeWire(w)
+		}
+	}
+	encodePMsgs(w, msg.VSet)
+	encodePMsgs(w, msg.OSet)
+	w.Strings(msg.Results)
+}
+
+// DecodeWire: read the pbft message from the binary codec
+func (msg *PMsg) DecodeWire(r *wire.Reader) {
+	msg.MType, msg.ViewNumber, msg.SeqNum, msg.Digest, msg.Signature = StateType(r.Uint8()), r.Int(), r.Int(), r.Bytes(), r.Bytes()
+	msg.Proposal.DecodeWire(r)
+	msg.Block.DecodeWire(r)
+	msg.SendNode, msg.ReciNode = r.String(), r.String()
+	msg.CSet = decodePMsgs(r)
+	if n, null := r.Count(); !null {
+		msg.PSet = make([]*Pm, n)
+		for i := range msg.PSet {
+			if r.Bool() {
+				msg.PSet[i] = &Pm{}
+				msg.PSet[i].DecodeWire(r)
+			}
+		}
+	}
+	msg.VSet = decodePMsgs(r)
+	msg.OSet = decodePMsgs(r)
+	msg.Results = r.Strings()
+}
+
+// encodePMsgs: write a set of pbft messages, each item is preceded by whether it is nil
+func encodePMsgs(w *wire.Writer, msgs []*PMsg) {
+	w.Count(len(msgs), msgs == nil)
+	for _, msg := range msgs {
+		if w.Bool(msg != nil); msg != nil {
+			msg.EncodeWire(w)
+		}
+	}
+}
+
+// decodePMsgs: read a set of pbft messages written by encodePMsgs
+// note: the view-change messages nest the sets of messages, so the nesting depth is bounded against the forged messages
+func decodePMsgs(r *wire.Reader) []*PMsg {
+	if !r.Enter() {
+		return nil
+	}
+	defer r.Leave()
+	n, null := r.Count()
+	if null {
+		return nil
+	}
+	msgs := make([]*PMsg, n)
+	for i := range msgs {
+		if r.Bool() {
+			msgs[i] = &PMsg{}
+			msgs[i].DecodeWire(r)
+		}
+	}
+	return msgs
+}
+
+// EncodeWire: write the pre-prepare message, its prepare messages and its block to the binary codec
+func (pm *Pm) EncodeWire(w *wire.Writer) {
+	if w.Bool(pm.PrePrepareMsg != nil); pm.PrePrepareMsg != nil {
+		pm.PrePrepareMsg.EncodeWire(w)
+	}
+	w.Count(len(pm.PrepareMsgs), pm.PrepareMsgs == nil)
+	for _, msg := range pm.PrepareMsgs {
+		if w.Bool(msg != nil); msg != nil {
+			msg.EncodeWire(w)
+		}
+	}
+	pm.Block.EncodeWire(w)
+}
+
+// DecodeWire: read the pre-prepare message, its prepare messages and its block from the binary codec
+func (pm *Pm) DecodeWire(r *wire.Reader) {
+	if r.Bool() {
+		pm.PrePrepareMsg = &VCMsg{}
+		pm.PrePrepareMsg.DecodeWire(r)
+	}
+	if n, null := r.Count(); !null {
+		pm.PrepareMsgs = make([]*VCMsg, n)
+		for i := range pm.PrepareMsgs {
+			if r.Bool() {
+				pm.PrepareMsgs[i] = &VCMsg{}
+				pm.PrepareMsgs[i].DecodeWire(r)
+			}
+		}
+	}
+	pm.Block.DecodeWire(r)
+}
+
+// EncodeWire: write the message in the view-change message to the binary codec
+func (msg *VCMsg) EncodeWire(w *wire.Writer) {
+	w.Uint8(uint8(msg.MType)).Int(msg.ViewNumber).Int(msg.SeqNum).Bytes(msg.Digest).Bytes(msg.Signature)
+	msg.Proposal.EncodeWire(w)
+	w.String(msg.SendNode).String(msg.ReciNode)
+}
+
+// DecodeWire: read the message in the view-change message from the binary codec
+func (msg *VCMsg) DecodeWire(r *wire.Reader) {
+	msg.MType, msg.ViewNumber, msg.SeqNum, msg.Digest, msg.Signature = StateType(r.Uint8()), r.Int(), r.Int(), r.Bytes(), r.Bytes()
+	msg.Proposal.DecodeWire(r)
+	msg.SendNode, msg.ReciNode = r.String(), r.String()
+}
+
+// EncodeWire: write the proposal to the binary codec
+func (p *Proposal) EncodeWire(w *wire.Writer) {
+	w.Int(p.Height).Int(p.ViewNumber).Bytes(p.PreBlkHash).Bytes(p.CurBlkHash).BytesList(p.Command)
+}
+
+// DecodeWire: read the proposal from the binary codec
+func (p *Proposal) DecodeWire(r *wire.Reader) {
+	p.Height, p.ViewNumber, p.PreBlkHash, p.CurBlkHash, p.Command = r.Int(), r.Int(), r.Bytes(), r.Bytes(), r.BytesList()
+}
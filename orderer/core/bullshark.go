@@ -0,0 +1,167 @@
+package orderer
+
+import (
+	"bcrequest"
+	"blockchain"
+	bscore "bullshark/core"
+	bstypes "bullshark/types"
+	"common"
+	"errors"
+	"mgmt"
+	"statemachine"
+	"time"
+	"tss"
+	"wire"
+)
+
+const (
+	BullsharkTimeout = 1000 * time.Millisecond // the default base timeout of round in bullshark, which the node waits for the anchor
+)
+
+func init() {
+	Register(common.BULLSHARK, Protocol{
+		New:         NewBullshark,
+		NewSigners:  newThresholdSigners,
+		Rekey:       true,
+		NewMsg:      func() interface{} { return &bstypes.Msg{} },
+		VerifyBlock: verifyThresholdBlock(bullsharkCertified),
+		Classify:    classifyBullsharkMsg,
+	})
+}
+
+// Bullshark: the bullshark consensus run by the orderer
+type Bullshark struct {
+	*bscore.Bullshark
+}
+
+// NewBullshark: create the bullshark consensus
+// params:
+// - opts: the options, whose signer must be *tss.Signer
+// return:
+// - the consensus and error
+func NewBullshark(opts Options) (Consensus, error) {
+	signer, ok := opts.Signer.(*tss.Signer)
+	if !ok {
+		return nil, errors.New("signer type does not match")
+	}
+	pm := common.NewPacemaker(opts.Pacemaker.WithDefaults(BullsharkTimeout))
+	bs := bscore.NewBullshark(int(pm.Config.BaseTimeout/time.Millisecond), opts.ID, opts.NodeNum, opts.Path, opts.SendChan, signer)
+	bs.ViewTimer.Pacemaker = pm
+	bs.View.Elector = opts.Elector
+	if opts.StateMachine != nil {
+		bs.StateMachine = opts.StateMachine
+	}
+	return &Bullshark{bs}, nil
+}
+
+// HandleReq: disseminate the requests as a batch, the block is ordered by the DAG instead of the current block
+func (b *Bullshark) HandleReq(height int, preHash []byte, curHash []byte, reqs []bcrequest.BCRequest) {
+	b.Bullshark.HandleReq(reqs)
+}
+
+// HandleMsg: handle the bullshark message
+func (b *Bullshark) HandleMsg(payload []byte) {
+	b.HandleBMsg(payload)
+}
+
+// GetProposerName: every node disseminates its own requests
+func (b *Bullshark) GetProposerName() string {
+	return b.GetNodeName()
+}
+
+// FixLeader: nothing to patch, the anchor of each wave is elected by the committed history
+func (b *Bullshark) FixLeader() {}
+
+// RefreshLeader: refresh the leader of the wave
+func (b *Bullshark) RefreshLeader() {
+	b.View.RefreshLeader()
+}
+
+// Stop: stop the round timer
+func (b *Bullshark) Stop() {
+	b.ViewTimer.Stop()
+}
+
+// Restart: the certificates before the nodes join or exit are accepted without the signature check,
+// and the round timer is restarted
+func (b *Bullshark) Restart() {
+	b.RestartBullshark()
+}
+
+// Rejoin: send the messages of the recovered consensus
+func (b *Bullshark) Rejoin() {
+	for _, msgReturn := range b.Bullshark.Rejoin() {
+		b.SendSerMsg(msgReturn)
+	}
+}
+
+// Handover: start the DAG from the recovered round
+func (b *Bullshark) Handover() {
+	b.Bullshark.Handover()
+}
+
+// IsReady: the threshold signer matches the number of nodes
+func (b *Bullshark) IsReady() bool {
+	return b.View.NodesNum == b.ThresholdSigner.SignNum
+}
+
+// Pacemaker: get the pacemaker of the round timer
+func (b *Bullshark) Pacemaker() *common.Pacemaker {
+	return b.ViewTimer.Pacemaker
+}
+
+// BlockStore: get the block store
+func (b *Bullshark) BlockStore() *blockchain.BlockStore {
+	return &b.BlkStore
+}
+
+// PublicKey: get the shared public key of the threshold signature
+func (b *Bullshark) PublicKey() []byte {
+	return b.ThresholdSigner.PublicKeyBytes()
+}
+
+// Options: get the options of the consensus
+func (b *Bullshark) Options() Options {
+	return Options{ID: b.ConsId, NodeNum: b.View.NodesNum, Path: b.BlkStore.Path, SendChan: b.SendChan, Signer: b.ThresholdSigner, Pacemaker: b.ViewTimer.Pacemaker.Config, Elector: b.View.Elector, StateMachine: b.StateMachine}
+}
+
+// SetReqValidator: set the validator of client requests
+func (b *Bullshark) SetReqValidator(v *bcrequest.Validator) {
+	b.ReqValidator = v
+	b.StateMachine = statemachine.WithValidator(b.StateMachine, v, b.BlockStore())
+}
+
+// SetCodec: set the codec of the sent messages
+func (b *Bullshark) SetCodec(codec wire.Codec) {
+	b.Codec = codec
+}
+
+// SetSigner: replace the threshold signer
+func (b *Bullshark) SetSigner(signer interface{}) error {
+	return setThresholdSigner(&b.ThresholdSigner, signer)
+}
+
+// bullsharkCertified: get the hash of the block signed by the validation of bullshark
+func bullsharkCertified(validationMsg []byte) ([][]byte, error) {
+	blkHash, err := bstypes.DecodeBlockByte(validationMsg)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{blkHash}, nil
+}
+
+// classifyBullsharkMsg: classify the message of bullshark, every node proposes its header of each round and votes for the others,
+// and there is no timeout message since the round waits for the anchor locally
+func classifyBullsharkMsg(msg interface{}) mgmt.Participation {
+	m, ok := msg.(*bstypes.Msg)
+	if !ok {
+		return mgmt.PART_NONE
+	}
+	switch m.MType {
+	case bstypes.HEADER:
+		return mgmt.PART_PROPOSAL
+	case bstypes.VOTE:
+		return mgmt.PART_VOTE
+	}
+	return mgmt.PART_NONE
+}
@@ -0,0 +1,357 @@
+package orderer_test
+
+import (
+	"bcrequest"
+	"blockchain"
+	bstypes "bullshark/types"
+	"bytes"
+	"common"
+	"local"
+	"orderer"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"wire"
+)
+
+// decodePayload: decode the payload into the message of the protocol, and get the codec to encode it back
+func decodePayload(p orderer.Protocol, payload []byte) (interface{}, wire.Codec, bool) {
+	msg := p.NewMsg()
+	if err := wire.Unmarshal(payload, msg); err != nil {
+		return nil, "", false
+	}
+	codec := wire.JSON
+	if wire.IsBinary(payload) {
+		codec = wire.BINARY
+	}
+	return msg, codec, true
+}
+
+// encodePayload: encode the tampered message by the codec of the original payload
+func encodePayload(msg interface{}, codec wire.Codec) ([]byte, bool) {
+	payload, err := wire.Marshal(msg, codec)
+	return payload, err == nil
+}
+
+// replaceBytes: replace every byte slice equal to old in the message by new, such as the hashes referring to the block
+func replaceBytes(v reflect.Value, old []byte, new []byte) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			replaceBytes(v.Elem(), old, new)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				replaceBytes(v.Field(i), old, new)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			replaceBytes(v.Index(i), old, new)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if len(old) > 0 && bytes.Equal(v.Bytes(), old) {
+				v.SetBytes(append([]byte(nil), new...))
+			}
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			replaceBytes(v.Index(i), old, new)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			replaceBytes(elem, old, new)
+			v.SetMapIndex(k, elem)
+		}
+	}
+}
+
+// equivocator: make the conflicting proposal, which orders one more request in the block, or the header of bullshark
+// with another timestamp, and every hash in the message referring to the original one refers to the conflicting one
+func equivocator(p orderer.Protocol) local.Tamper {
+	extra := string((&bcrequest.BCRequest{Id: "c_1", Seq: 1, Cmd: []byte("put equivocated value")}).Encode())
+	return func(payload []byte) ([]byte, bool) {
+		msg, codec, ok := decodePayload(p, payload)
+		if !ok {
+			return nil, false
+		}
+		v := reflect.ValueOf(msg).Elem()
+		changed := false
+		if bsMsg, ok := msg.(*bstypes.Msg); ok && bsMsg.MType == bstypes.HEADER {
+			old := bsMsg.Header.Digest()
+			bsMsg.Header.TimeStamp++
+			replaceBytes(v, old, bsMsg.Header.Digest())
+			changed = true
+		}
+		for _, name := range []string{"Block", "Blk"} {
+			field := v.FieldByName(name)
+			if !field.IsValid() {
+				continue
+			}
+			blk := field.Addr().Interface().(*blockchain.Block)
+			if len(blk.BlkData.Trans) == 0 {
+				continue
+			}
+			old := *blk
+			conflict := blockchain.NewBlock(old.BlkHdr.Height, old.BlkHdr.PreBlkHash, old.BlkHdr.ViewNumber, append(append([]string{}, old.BlkData.Trans...), extra))
+			conflict.BlkHdr.TimeStamp = old.BlkHdr.TimeStamp
+			*blk = conflict
+			replaceBytes(v, old.Hash(), conflict.Hash())
+			replaceBytes(v, old.BlkHdr.RootHash, conflict.BlkHdr.RootHash)
+			if proposal := v.FieldByName("Proposal"); proposal.IsValid() {
+				if cmds := proposal.FieldByName("Commands"); cmds.IsValid() {
+					cmds.Set(reflect.Append(cmds, reflect.ValueOf([]byte(extra))))
+				}
+			}
+			changed = true
+		}
+		if !changed {
+			return nil, false
+		}
+		return encodePayload(msg, codec)
+	}
+}
+
+// signatureFields: the fields of the partial or own signatures of the messages of all protocols
+var signatureFields = []string{"PartialSig", "ConsSign", "Signature"}
+
+// forger: corrupt the signature of the message, so that it fails the verification
+func forger(p orderer.Protocol) local.Tamper {
+	return func(payload []byte) ([]byte, bool) {
+		msg, codec, ok := decodePayload(p, payload)
+		if !ok {
+			return nil, false
+		}
+		v := reflect.ValueOf(msg).Elem()
+		changed := false
+		for _, name := range signatureFields {
+			if field := v.FieldByName(name); field.IsValid() && field.Len() > 0 {
+				forged := append([]byte(nil), field.Bytes()...)
+				forged[len(forged)-1] ^= 0xff
+				field.SetBytes(forged)
+				changed = true
+			}
+		}
+		if !changed {
+			return nil, false
+		}
+		return encodePayload(msg, codec)
+	}
+}
+
+// voter: check whether the message is a vote, which is signed and carries no block
+func voter(p orderer.Protocol) func(payload []byte) bool {
+	return func(payload []byte) bool {
+		msg, _, ok := decodePayload(p, payload)
+		if !ok {
+			return false
+		}
+		v := reflect.ValueOf(msg).Elem()
+		for _, name := range []string{"Block", "Blk"} {
+			if field := v.FieldByName(name); field.IsValid() && len(field.Interface().(blockchain.Block).BlkData.Trans) > 0 {
+				return false
+			}
+		}
+		for _, name := range signatureFields {
+			if field := v.FieldByName(name); field.IsValid() && field.Len() > 0 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// checkSafety: check no two honest replicas commit different blocks at the same height
+// return:
+// - the number of blocks committed by every honest replica, the chain of a replica is counted up to its first missing block
+func (c *cluster) checkSafety(t *testing.T) int {
+	chain := make(map[int][]byte)
+	lowest := -1
+	for i, o := range c.orderers {
+		if _, faulty := c.faults[i]; faulty {
+			continue
+		}
+		storage := o.GetBlockStore().Storage
+		height, err := storage.GetBlockHeight()
+		if err != nil {
+			t.Fatal("r_"+strconv.Itoa(i), "can't get the height of the chain", err)
+		}
+		committed := 0
+		for h := 0; h <= height; h++ {
+			blk, err := storage.ReadBlock(h)
+			if err != nil {
+				continue
+			}
+			if hash, ok := chain[h]; ok && !bytes.Equal(hash, blk.Hash()) {
+				t.Fatal("r_"+strconv.Itoa(i), "commits a different block at", h)
+			}
+			chain[h] = blk.Hash()
+			if committed == h {
+				committed++
+			}
+		}
+		if lowest < 0 || committed < lowest {
+			lowest = committed
+		}
+	}
+	return lowest
+}
+
+// injected: get the number of messages affected by the faults of all faulty nodes
+func (c *cluster) injected() int {
+	n := 0
+	for _, fault := range c.faults {
+		n += fault.Injected()
+	}
+	return n
+}
+
+// TestByzantine: test the honest replicas of every registered protocol keep committing the blocks
+// and never commit different blocks at the same height while f of the nodes are byzantine,
+// and the faults are checked to affect the messages of the faulty nodes
+func TestByzantine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the byzantine scenarios take the view timeouts")
+	}
+	const (
+		nodeNum = 4
+		faulty  = (nodeNum - 1) / 3
+		blocks  = 3
+		timeout = 20 * time.Second
+	)
+	pacemaker := common.PacemakerConfig{BaseTimeout: 300 * time.Millisecond, MaxTimeout: time.Second}
+	for _, consType := range orderer.Protocols() {
+		consType := consType
+		p, _ := orderer.LookupProtocol(consType)
+
+		t.Run(string(consType), func(t *testing.T) {
+			t.Parallel()
+			for _, behaviour := range []local.Behaviour{local.SILENT, local.WITHHOLD, local.EQUIVOCATE, local.REPLAY, local.FORGE} {
+				t.Run(behaviour.String(), func(t *testing.T) {
+					c := newCluster(t, consType, nodeNum, withPacemaker(pacemaker))
+
+					// the faulty nodes follow the leader of the first view, except that the equivocating one is the leader,
+					// so that it proposes
+					id := c.leaders()[0].Consensus.Options().ID
+					if behaviour != local.EQUIVOCATE {
+						id++
+					}
+					for n := 0; n < faulty; n++ {
+						fault := local.NewFault(c.names(), behaviour)
+						fault.Equivocate = equivocator(p)
+						fault.Forge = forger(p)
+						fault.IsVote = voter(p)
+						c.inject((id+n)%nodeNum, fault)
+					}
+					c.start()
+					live := c.run(blocks, timeout)
+
+					c.stop()
+					committed := c.checkSafety(t)
+					t.Log("the honest replicas commit", committed, "blocks, and", c.injected(), "messages are affected by the faults")
+					if c.injected() == 0 {
+						t.Fatal("no message is affected by the faults")
+					}
+					if !live || committed < blocks {
+						t.Fatal("the honest replicas don't commit", blocks, "blocks")
+					}
+				})
+			}
+		})
+	}
+}
+
+// tamperer: make the proposal whose block orders its valid requests in another way under the same header, the first two are swapped,
+// or the only one is dropped, so the block hash and every hash referring to it are kept, and only the block data differs
+// from the one committed by the header
+func tamperer(p orderer.Protocol) local.Tamper {
+	return func(payload []byte) ([]byte, bool) {
+		msg, codec, ok := decodePayload(p, payload)
+		if !ok {
+			return nil, false
+		}
+		v := reflect.ValueOf(msg).Elem()
+		changed := false
+		for _, name := range []string{"Block", "Blk"} {
+			field := v.FieldByName(name)
+			if !field.IsValid() {
+				continue
+			}
+			blk := field.Addr().Interface().(*blockchain.Block)
+			trans := blk.BlkData.Trans
+			switch {
+			case len(trans) >= 2:
+				trans = append([]string{trans[1], trans[0]}, trans[2:]...)
+			case len(trans) == 1:
+				trans = []string{}
+			default:
+				continue
+			}
+			blk.BlkData.Trans = trans
+			changed = true
+		}
+		if !changed {
+			return nil, false
+		}
+		return encodePayload(msg, codec)
+	}
+}
+
+// TestTamperedBlockData: test the replicas of every protocol which carries the block in its proposal reject the block
+// whose transactions differ from the ones committed by its header, so the leader can't get different transactions
+// certified under the same block hash
+func TestTamperedBlockData(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the byzantine scenarios take the view timeouts")
+	}
+	const (
+		nodeNum = 4
+		blocks  = 3
+		timeout = 20 * time.Second
+	)
+	pacemaker := common.PacemakerConfig{BaseTimeout: 300 * time.Millisecond, MaxTimeout: time.Second}
+	for _, consType := range orderer.Protocols() {
+		consType := consType
+		p, _ := orderer.LookupProtocol(consType)
+
+		t.Run(string(consType), func(t *testing.T) {
+			t.Parallel()
+			c := newCluster(t, consType, nodeNum, withPacemaker(pacemaker))
+
+			// the leader of the first view sends the tampered block to the second half of the replicas
+			fault := local.NewFault(c.names(), local.EQUIVOCATE)
+			fault.Equivocate = tamperer(p)
+			c.inject(c.leaders()[0].Consensus.Options().ID, fault)
+			c.start()
+			live := c.run(blocks, timeout)
+
+			c.stop()
+			committed := c.checkSafety(t)
+			if c.injected() == 0 {
+				t.Skip("the proposal of", consType, "carries no block")
+			}
+			for i, o := range c.orderers {
+				if _, faulty := c.faults[i]; faulty {
+					continue
+				}
+				storage := o.GetBlockStore().Storage
+				height, _ := storage.GetBlockHeight()
+				for h := 0; h <= height; h++ {
+					if blk, err := storage.ReadBlock(h); err == nil {
+						if err := blk.VerifyBlockData(); err != nil {
+							t.Fatal("r_"+strconv.Itoa(i), "commits the tampered block at", h, err)
+						}
+					}
+				}
+			}
+			if !live || committed < blocks {
+				t.Fatal("the honest replicas don't commit", blocks, "blocks")
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package orderer_test
+
+import (
+	"bcrequest"
+	"blockchain"
+	bstypes "bullshark/types"
+	"bytes"
+	"common"
+	fhstypes "fasthotstuff/types"
+	"fmt"
+	hstypes "hotstuff/types"
+	hs2types "hotstuff2/types"
+	"message"
+	"orderer"
+	ptypes "pbft/types"
+	"reflect"
+	"testing"
+	"wire"
+)
+
+// protocol: generate the proposal message of a consensus protocol
+type protocol struct {
+	consType common.ConsensusType
+	gen      func(cmds [][]byte, blk blockchain.Block) interface{} // the proposal message with the commands and the block
+	new      func() interface{}                                    // the empty message to decode into
+}
+
+var protocols = []protocol{
+	{
+		consType: common.HOTSTUFF_PROTOCOL_BASIC,
+		gen: func(cmds [][]byte, blk blockchain.Block) interface{} {
+			return &hstypes.Msg{
+				MType:      hstypes.PREPARE,
+				ViewNumber: 300,
+				HsNode:     common.HsNode{CurHash: blk.BlkHdr.RootHash, ParentHash: blk.BlkHdr.PreBlkHash},
+				Justify:    hstypes.QC{QType: hstypes.PREPARE, ViewNumber: 299, Sign: bytes.Repeat([]byte{7}, 65)},
+				Proposal:   hstypes.Proposal{Height: 12, PreBlkHash: blk.BlkHdr.PreBlkHash, RootHash: blk.BlkHdr.RootHash, Commands: cmds},
+				Block:      blk,
+				SendNode:   "r_0",
+				ReciNode:   "Broadcast",
+			}
+		},
+		new: func() interface{} { return &hstypes.Msg{} },
+	},
+	{
+		consType: common.HOTSTUFF_PROTOCOL_CHAINED,
+		gen: func(cmds [][]byte, blk blockchain.Block) interface{} {
+			node := common.HsNode{CurHash: blk.BlkHdr.RootHash, ParentHash: blk.BlkHdr.PreBlkHash}
+			return &hstypes.CMsg{
+				MType:      hstypes.GENERIC,
+				ViewNumber: 300,
+				SendNode:   "r_0",
+				ReciNode:   "Broadcast",
+				HsNodes:    [4]common.HsNode{node, node, node, node},
+				Justify:    hstypes.ChainedQC{QType: hstypes.GENERIC, ViewNumber: 299, HsNodes: [4]common.HsNode{node, node, node, node}, Sign: bytes.Repeat([]byte{7}, 65)},
+				Proposal:   hstypes.Proposal{Height: 12, PreBlkHash: blk.BlkHdr.PreBlkHash, RootHash: blk.BlkHdr.RootHash, Commands: cmds},
+				Blk:        blk,
+			}
+		},
+		new: func() interface{} { return &hstypes.CMsg{} },
+	},
+	{
+		consType: common.HOTSTUFF_2_PROTOCOL,
+		gen: func(cmds [][]byte, blk blockchain.Block) interface{} {
+			node := common.HsNode{CurHash: blk.BlkHdr.RootHash, ParentHash: blk.BlkHdr.PreBlkHash}
+			qc := hs2types.QuromCert{QType: hs2types.PROPOSE, ViewNumber: 299, Height: 11, Hs2Node: node, Sign: bytes.Repeat([]byte{7}, 65)}
+			return &hs2types.H2Msg{
+				MType:      hs2types.PROPOSE,
+				ViewNumber: 300,
+				Hs2Node:    node,
+				Block:      blk,
+				ConsSign:   bytes.Repeat([]byte{8}, 65),
+				Justify1:   qc,
+				Justify2:   qc,
+				SendNode:   "r_0",
+				ReciNode:   "Broadcast",
+			}
+		},
+		new: func() interface{} { return &hs2types.H2Msg{} },
+	},
+	{
+		consType: common.FAST_HOTSTUFF_PROTOCOL,
+		gen: func(cmds [][]byte, blk blockchain.Block) interface{} {
+			node := common.HsNode{CurHash: blk.BlkHdr.RootHash, ParentHash: blk.BlkHdr.PreBlkHash}
+			return &fhstypes.Msg{
+				MType:      fhstypes.PROPOSE,
+				ViewNumber: 300,
+				Height:     12,
+				HsNode:     node,
+				Block:      blk,
+				Justify:    fhstypes.QC{QType: fhstypes.VOTE, ViewNumber: 297, Height: 11, HsNode: node, Sign: bytes.Repeat([]byte{7}, 65)},
+				AggQC:      fhstypes.AggQC{ViewNumber: 299, HighViews: []int{297, 296, 297}, Sigs: [][]byte{bytes.Repeat([]byte{8}, 66), bytes.Repeat([]byte{9}, 66), bytes.Repeat([]byte{10}, 66)}},
+				SendNode:   "r_0",
+				ReciNode:   "Broadcast",
+			}
+		},
+		new: func() interface{} { return &fhstypes.Msg{} },
+	},
+	{
+		consType: common.BULLSHARK,
+		gen: func(cmds [][]byte, blk blockchain.Block) interface{} {
+			header := bstypes.Header{
+				Author:    2,
+				Round:     40,
+				TimeStamp: blk.BlkHdr.TimeStamp,
+				Batches:   []bstypes.BatchCert{{Digest: blk.BlkHdr.RootHash, Sign: bytes.Repeat([]byte{7}, 65)}},
+				Parents:   [][]byte{blk.BlkHdr.PreBlkHash, blk.BlkHdr.RootHash, blk.BlkHdr.BlkDataHash},
+			}
+			return &bstypes.Msg{
+				MType:      bstypes.CERT,
+				Round:      40,
+				Height:     12,
+				Digest:     header.Digest(),
+				Batch:      bstypes.Batch{Author: 2, Seq: 9, Trans: common.TwoDimByteSlice2StringSlice(cmds)},
+				Header:     header,
+				Cert:       bstypes.Certificate{Header: header, Sign: bytes.Repeat([]byte{8}, 65)},
+				PartialSig: bytes.Repeat([]byte{9}, 66),
+				Validation: bytes.Repeat([]byte{10}, 65),
+				SendNode:   "r_2",
+				ReciNode:   "Broadcast",
+			}
+		},
+		new: func() interface{} { return &bstypes.Msg{} },
+	},
+	{
+		consType: common.PBFT,
+		gen: func(cmds [][]byte, blk blockchain.Block) interface{} {
+			return &ptypes.PMsg{
+				MType:      ptypes.PREPREPARE,
+				ViewNumber: 300,
+				SeqNum:     12,
+				Digest:     blk.BlkHdr.RootHash,
+				Signature:  bytes.Repeat([]byte{7}, 72),
+				Proposal:   ptypes.Proposal{Height: 12, ViewNumber: 300, PreBlkHash: blk.BlkHdr.PreBlkHash, CurBlkHash: blk.BlkHdr.RootHash, Command: cmds},
+				Block:      blk,
+				SendNode:   "r_0",
+				ReciNode:   "Broadcast",
+			}
+		},
+		new: func() interface{} { return &ptypes.PMsg{} },
+	},
+}
+
+// genBatch: generate the signed requests of a batch and the block packaging them
+func genBatch(batchSize int) ([][]byte, blockchain.Block) {
+	cmds := make([][]byte, batchSize)
+	for i := range cmds {
+		req := bcrequest.BCRequest{Id: "c_0", Seq: uint64(i + 1), Cmd: []byte(fmt.Sprintf("put key_%d value_%d", i, i)), Sign: bytes.Repeat([]byte{byte(i)}, 72)}
+		cmds[i] = req.Encode()
+	}
+	hash := bytes.Repeat([]byte{1}, 32)
+	blk := blockchain.Block{
+		BlkHdr: blockchain.BlockHeader{
+			Version:     blockchain.CANONICAL_VERSION,
+			Height:      12,
+			ViewNumber:  300,
+			TimeStamp:   1700000000000,
+			PreBlkHash:  hash,
+			RootHash:    hash,
+			BlkDataHash: hash,
+		},
+		BlkData: blockchain.BlockData{Height: 12, RootHash: hash, Trans: common.TwoDimByteSlice2StringSlice(cmds)},
+	}
+	return cmds, blk
+}
+
+// encode: encode the consensus message and the server message carrying it, as it is sent between replicas
+func encode(payload interface{}, codec wire.Codec) ([]byte, error) {
+	data, err := wire.Marshal(payload, codec)
+	if err != nil {
+		return nil, err
+	}
+	return message.EncodeMsg(message.ServerMsg{SType: message.ORDER, SendServer: "r_0", ReciServer: "Broadcast", Sign: bytes.Repeat([]byte{9}, 72), Payload: data}, codec)
+}
+
+// decode: decode the server message and the consensus message it carries
+func decode(data []byte, payload interface{}) error {
+	sMsg := message.DecodeMsg(data)
+	if sMsg == nil {
+		return fmt.Errorf("decode server message error")
+	}
+	return wire.Unmarshal(sMsg.Payload, payload)
+}
+
+// TestCodec: test the proposal messages of all protocols survive the round trip of both codecs,
+// the binary messages are smaller, and the payloads are transcoded to JSON for the clients
+func TestCodec(t *testing.T) {
+	cmds, blk := genBatch(8)
+	for _, p := range protocols {
+		msg := p.gen(cmds, blk)
+		sizes := make(map[wire.Codec]int)
+		for _, codec := range []wire.Codec{wire.JSON, wire.BINARY} {
+			data, err := encode(msg, codec)
+			if err != nil {
+				t.Fatal(p.consType, codec, err)
+			}
+			got := p.new()
+			if err := decode(data, got); err != nil {
+				t.Fatal(p.consType, codec, err)
+			}
+			if !reflect.DeepEqual(msg, got) {
+				t.Fatalf("%v %s: expected %+v, got %+v", p.consType, codec, msg, got)
+			}
+			sizes[codec] = len(data)
+		}
+		if sizes[wire.BINARY] >= sizes[wire.JSON] {
+			t.Fatal(p.consType, "binary message is not smaller", sizes)
+		}
+
+		o := orderer.Orderer{ConsType: p.consType}
+		payload, _ := wire.Marshal(msg, wire.BINARY)
+		jsonPayload, err := o.TranscodePayload(payload, wire.JSON)
+		if err != nil || wire.IsBinary(jsonPayload) {
+			t.Fatal(p.consType, "transcode error", err)
+		}
+		got := p.new()
+		if err := wire.Unmarshal(jsonPayload, got); err != nil || !reflect.DeepEqual(msg, got) {
+			t.Fatal(p.consType, "transcoded payload is different", err)
+		}
+	}
+}
+
+// BenchmarkCodec: compare the encoding and decoding cost and the message size of both codecs,
+// for the proposal messages of all protocols with the batch size from 128 to 4096
+// run: go test -run NONE -bench Codec -benchmem
+func BenchmarkCodec(b *testing.B) {
+	for _, batchSize := range []int{128, 512, 1024, 4096} {
+		cmds, blk := genBatch(batchSize)
+		for _, p := range protocols {
+			msg := p.gen(cmds, blk)
+			for _, codec := range []wire.Codec{wire.JSON, wire.BINARY} {
+				data, err := encode(msg, codec)
+				if err != nil {
+					b.Fatal(err)
+				}
+				name := fmt.Sprintf("%v/batch=%d/%s", p.consType, batchSize, codec)
+
+				b.Run(name+"/encode", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						encode(msg, codec)
+					}
+					b.SetBytes(int64(len(data)))
+					b.ReportMetric(float64(len(data)), "msg-bytes")
+				})
+				b.Run(name+"/decode", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						if err := decode(data, p.new()); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.SetBytes(int64(len(data)))
+					b.ReportMetric(float64(len(data)), "msg-bytes")
+				})
+			}
+		}
+	}
+}
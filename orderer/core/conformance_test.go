@@ -0,0 +1,700 @@
+package orderer_test
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	"common"
+	"local"
+	"message"
+	"mgmt"
+	"orderer"
+	ptypes "pbft/types"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cluster: the orderers of a protocol connected by the channels in memory, as the servers route the messages
+type cluster struct {
+	orderers  []*orderer.Orderer
+	sendChans []chan message.ServerMsg
+	quit      chan struct{}
+	stopOnce  sync.Once
+	routing   sync.WaitGroup                   // the goroutines routing and handling the messages
+	interval  time.Duration                    // the interval between two checks whether the proposers are waiting for the requests
+	inFlight  int                              // the max number of proposals in flight as a proposer proposes, which is more than 1 if the proposals are pipelined
+	faults    map[int]*local.Fault             // the byzantine behaviours injected to the links of the faulty nodes
+	seq       int                              // the sequence of the last proposed requests
+	observe   func(msg message.ServerMsg)      // called with each sent message before it is routed, such as to log the participation
+	drop      func(msg message.ServerMsg) bool // called with each sent message before it is routed, the message is lost if it returns true
+}
+
+// withElection: the orderers elect the leaders by the policy, round-robin by default
+func withElection(policy common.ElectionPolicy) func(o *orderer.Orderer) {
+	return func(o *orderer.Orderer) { o.Election = policy }
+}
+
+// withWindow: the orderers pipeline the proposals within the window, not pipelined by default
+func withWindow(window int) func(o *orderer.Orderer) {
+	return func(o *orderer.Orderer) { o.Window = window }
+}
+
+// withPacemaker: the orderers time out the views by the config, the defaults of the protocol by default
+func withPacemaker(config common.PacemakerConfig) func(o *orderer.Orderer) {
+	return func(o *orderer.Orderer) { o.Pacemaker = config }
+}
+
+// newCluster: create the orderers of all replicas, the messages are not routed until start is called
+// params:
+// - configs: the optional settings of the orderers before the consensus is created, such as withElection
+func newCluster(t *testing.T, consType common.ConsensusType, nodeNum int, configs ...func(o *orderer.Orderer)) *cluster {
+	p, err := orderer.LookupProtocol(consType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers := p.NewSigners(nodeNum)
+	dir := t.TempDir()
+	c := &cluster{quit: make(chan struct{}), interval: 20 * time.Millisecond, faults: make(map[int]*local.Fault)}
+	for i := 0; i < nodeNum; i++ {
+		sendChan := make(chan message.ServerMsg, 1024)
+		o := &orderer.Orderer{}
+		for _, config := range configs {
+			config(o)
+		}
+		o.InitConsensus(consType, i, nodeNum, dir, sendChan, signers[i])
+		o.GetBlockStore().GetStorage() // the storage is opened before the messages are handled, as the server does
+		c.orderers = append(c.orderers, o)
+		c.sendChans = append(c.sendChans, sendChan)
+	}
+	t.Cleanup(c.stop)
+	return c
+}
+
+// stop: stop routing the messages and wait for the handled ones, then stop the orderers,
+// so that no message is handled after the storage is removed
+func (c *cluster) stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+		c.routing.Wait()
+		for _, o := range c.orderers {
+			o.Stop()
+		}
+	})
+}
+
+// inject: inject the fault to the links of the node before the messages are routed
+func (c *cluster) inject(id int, fault *local.Fault) {
+	c.faults[id] = fault
+}
+
+// names: get the names of all nodes
+func (c *cluster) names() []string {
+	names := make([]string, len(c.orderers))
+	for i := range c.orderers {
+		names[i] = "r_" + strconv.Itoa(i)
+	}
+	return names
+}
+
+// start: route the sent messages to the orderers like the transport, the replies to the clients are dropped,
+// and the links of the faulty nodes are wrapped by their faults
+func (c *cluster) start() {
+	inboxes := make([]chan []byte, len(c.orderers))
+	links := make([]chan []byte, len(c.orderers))
+	for i, o := range c.orderers {
+		inboxes[i] = make(chan []byte, 1024)
+		links[i] = inboxes[i]
+		if fault, ok := c.faults[i]; ok {
+			links[i] = fault.WrapRecv(inboxes[i], c.quit)
+		}
+		c.routing.Add(1)
+		go func(o *orderer.Orderer, inbox chan []byte) {
+			defer c.routing.Done()
+			for {
+				select {
+				case payload := <-inbox:
+					o.HandleMsg(payload)
+				case <-c.quit:
+					return
+				}
+			}
+		}(o, inboxes[i])
+	}
+	for i, sendChan := range c.sendChans {
+		if fault, ok := c.faults[i]; ok {
+			sendChan = fault.WrapSend(sendChan, c.quit)
+		}
+		c.routing.Add(1)
+		go func(sendChan chan message.ServerMsg) {
+			defer c.routing.Done()
+			for {
+				select {
+				case msg := <-sendChan:
+					if c.observe != nil {
+						c.observe(msg)
+					}
+					if c.drop != nil && c.drop(msg) {
+						continue
+					}
+					for i, link := range links {
+						name := "r_" + strconv.Itoa(i)
+						if msg.ReciServer == "Broadcast" || (msg.ReciServer == "Gossip" && name != msg.SendServer) || msg.ReciServer == name {
+							select {
+							case link <- msg.Payload:
+							case <-c.quit:
+								return
+							}
+						}
+					}
+				case <-c.quit:
+					return
+				}
+			}
+		}(sendChan)
+	}
+}
+
+// leaders: get the orderers which are the leader of the current view
+func (c *cluster) leaders() []*orderer.Orderer {
+	leaders := make([]*orderer.Orderer, 0)
+	for _, o := range c.orderers {
+		if o.IsLeader() {
+			leaders = append(leaders, o)
+		}
+	}
+	return leaders
+}
+
+// commit: the proposers propose the requests as the servers do, until every honest replica commits the blocks
+// params:
+// - blocks: the number of blocks to commit
+func (c *cluster) commit(t *testing.T, blocks uint64) {
+	if !c.run(blocks, 20*time.Second) {
+		t.Fatal("no block is committed")
+	}
+}
+
+// run: the proposers propose the requests as the servers do, until every honest replica commits the blocks or the time is out
+// params:
+// - blocks:  the number of blocks to commit
+// - timeout: the time to propose
+// return:
+// - whether the blocks are committed
+func (c *cluster) run(blocks uint64, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !c.committed(blocks) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		c.propose()
+		time.Sleep(c.interval)
+	}
+	return true
+}
+
+// propose: the proposers which are waiting for the requests propose the next ones
+func (c *cluster) propose() {
+	for i, o := range c.orderers {
+		if o.GetProposerName() == "r_"+strconv.Itoa(i) && o.IsWaitingReq() {
+			// the proposals which the proposer hasn't committed are in flight
+			if n := c.seq + 1 - int(o.PacemakerMetrics().Commits); n > c.inFlight {
+				c.inFlight = n
+			}
+			c.seq++
+			bs := o.GetBlockStore()
+			o.HandleReq(bs.Height, bs.PreBlkHash, bs.CurBlkHash, genReqs(c.seq))
+		}
+	}
+}
+
+// committed: check whether every honest replica commits the blocks, the height of block store is not comparable
+// between protocols, so the committed block is read from the storage, and the committed blocks are counted by the pacemaker
+func (c *cluster) committed(blocks uint64) bool {
+	for i, o := range c.orderers {
+		if _, faulty := c.faults[i]; faulty {
+			continue
+		}
+		if _, err := o.GetBlockStore().Storage.ReadBlock(0); err != nil || o.PacemakerMetrics().Commits < blocks {
+			return false
+		}
+	}
+	return true
+}
+
+// genReqs: generate the requests of a batch, they are not signed because the orderers have no request validator
+func genReqs(seq int) []bcrequest.BCRequest {
+	return []bcrequest.BCRequest{{Id: "c_0", Seq: uint64(seq), Cmd: []byte("put key_" + strconv.Itoa(seq) + " value")}}
+}
+
+// TestRegistry: test all protocols are registered, and the unknown, duplicated or incomplete protocols are rejected
+func TestRegistry(t *testing.T) {
+	registered := make(map[common.ConsensusType]bool)
+	for _, consType := range orderer.Protocols() {
+		registered[consType] = true
+	}
+	for _, consType := range []common.ConsensusType{common.HOTSTUFF_PROTOCOL_BASIC, common.HOTSTUFF_PROTOCOL_CHAINED, common.HOTSTUFF_2_PROTOCOL, common.FAST_HOTSTUFF_PROTOCOL, common.BULLSHARK, common.PBFT} {
+		if !registered[consType] {
+			t.Fatal(consType, "is not registered")
+		}
+	}
+
+	if _, err := orderer.LookupProtocol("unknown"); err == nil {
+		t.Fatal("unknown protocol is found")
+	}
+	if _, err := (&orderer.Orderer{ConsType: "unknown"}).TranscodePayload([]byte("{}"), "binary"); err == nil {
+		t.Fatal("payload of unknown protocol is transcoded")
+	}
+
+	p, _ := orderer.LookupProtocol(common.PBFT)
+	for name, register := range map[string]func(){
+		"duplicated": func() { orderer.Register(common.PBFT, p) },
+		"incomplete": func() { orderer.Register("incomplete", orderer.Protocol{New: p.New}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal(name, "protocol is registered")
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+// TestConformance: test every registered protocol behaves as the orderer expects
+func TestConformance(t *testing.T) {
+	const nodeNum = 4
+	for _, consType := range orderer.Protocols() {
+		consType := consType
+		p, _ := orderer.LookupProtocol(consType)
+
+		t.Run(string(consType), func(t *testing.T) {
+
+			t.Run("New", func(t *testing.T) {
+				signer := p.NewSigners(1)[0]
+				if _, err := p.New(orderer.Options{ID: 0, NodeNum: 1, Path: t.TempDir(), Signer: struct{}{}}); err == nil {
+					t.Fatal("wrong signer type is accepted")
+				}
+
+				path := t.TempDir()
+				sendChan := make(chan message.ServerMsg, 1)
+				cons, err := p.New(orderer.Options{ID: 0, NodeNum: 1, Path: path, SendChan: sendChan, Signer: signer})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer cons.Stop()
+				opts := cons.Options()
+				if opts.ID != 0 || opts.NodeNum != 1 || opts.SendChan != sendChan || opts.Signer != signer || opts.Path != cons.BlockStore().Path {
+					t.Fatalf("wrong options %+v", opts)
+				}
+				if cons.Pacemaker() == nil || opts.Pacemaker.BaseTimeout <= 0 || cons.Pacemaker().Timeout() != opts.Pacemaker.BaseTimeout {
+					t.Fatalf("wrong pacemaker %+v", opts.Pacemaker)
+				}
+
+				// the pacemaker config of the options is kept, and the zero fields take the defaults
+				pmConfig := common.PacemakerConfig{BaseTimeout: 123 * time.Millisecond, Adaptive: true}
+				pmCons, err := p.New(orderer.Options{ID: 0, NodeNum: 1, Path: t.TempDir(), SendChan: sendChan, Signer: signer, Pacemaker: pmConfig})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer pmCons.Stop()
+				if got := pmCons.Options().Pacemaker; got != pmConfig.WithDefaults(0) || pmCons.Pacemaker().Timeout() != pmConfig.BaseTimeout {
+					t.Fatalf("wrong pacemaker config %+v", got)
+				}
+
+				if err := cons.SetSigner(struct{}{}); err == nil {
+					t.Fatal("wrong signer type is set")
+				}
+				if err := cons.SetSigner(p.NewSigners(1)[0]); err != nil {
+					t.Fatal(err)
+				}
+				if cons.Options().Signer == signer {
+					t.Fatal("signer is not replaced")
+				}
+			})
+
+			t.Run("Leader", func(t *testing.T) {
+				c := newCluster(t, consType, nodeNum)
+				leaders := c.leaders()
+				if len(leaders) != 1 {
+					t.Fatal("the number of leaders is", len(leaders))
+				}
+				for i, o := range c.orderers {
+					if o.GetLeaderName() != leaders[0].GetLeaderName() {
+						t.Fatal("r_"+strconv.Itoa(i), "follows another leader", o.GetLeaderName())
+					}
+					if !o.IsReady() {
+						t.Fatal("r_"+strconv.Itoa(i), "is not ready")
+					}
+					if bs := o.GetBlockStore(); bs == nil || bs.Height != 0 {
+						t.Fatal("r_"+strconv.Itoa(i), "has a wrong block store")
+					}
+					if len(o.PublicKey()) == 0 {
+						t.Fatal("r_"+strconv.Itoa(i), "has no public key")
+					}
+				}
+				if !leaders[0].IsWaitingReq() {
+					t.Fatal("leader is not waiting for the requests")
+				}
+			})
+
+			t.Run("Commit", func(t *testing.T) {
+				c := newCluster(t, consType, nodeNum)
+				c.start()
+
+				c.commit(t, 1)
+
+				// the pacemakers observe the commit latency
+				for i, o := range c.orderers {
+					if o.PacemakerMetrics().Commits == 0 {
+						t.Fatal("r_"+strconv.Itoa(i), "observes no commit")
+					}
+				}
+
+				// the committed block is validated by the consensus, and can't be verified by the key of another cluster
+				o := c.orderers[nodeNum-1]
+				proof, err := o.GenBlockProof(0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := orderer.VerifyBlockProof(proof, o.PublicKey()); err != nil {
+					t.Fatal(err)
+				}
+				other := newCluster(t, consType, nodeNum)
+				if err := orderer.VerifyBlockProof(proof, other.orderers[0].PublicKey()); err == nil {
+					t.Fatal("block proof is verified by another key")
+				}
+
+				// the proof without the message signed by the validation, or of another block header, is rejected
+				unsigned := *proof
+				unsigned.BlkHdr.ValidationMsg = nil
+				if err := orderer.VerifyBlockProof(&unsigned, o.PublicKey()); err == nil {
+					t.Fatal("block proof without validation message is verified")
+				}
+				changed := *proof
+				changed.BlkHdr.TimeStamp++
+				if err := orderer.VerifyBlockProof(&changed, o.PublicKey()); err == nil {
+					t.Fatal("block proof of another block header is verified")
+				}
+			})
+
+			t.Run("Participation", func(t *testing.T) {
+				c := newCluster(t, consType, nodeNum)
+				var mu sync.Mutex
+				logged := make(map[mgmt.Participation]int)
+				c.observe = func(msg message.ServerMsg) {
+					kind := c.orderers[0].Participation(msg.Payload)
+					mu.Lock()
+					logged[kind]++
+					mu.Unlock()
+				}
+				c.start()
+
+				// the messages of a committed block include the proposal and the votes of the replicas
+				c.commit(t, 1)
+				mu.Lock()
+				defer mu.Unlock()
+				if logged[mgmt.PART_PROPOSAL] == 0 || logged[mgmt.PART_VOTE] == 0 {
+					t.Fatal("the proposal and the votes are not classified", logged)
+				}
+			})
+
+			t.Run("Election", func(t *testing.T) {
+				for _, policy := range []common.ElectionPolicy{common.REPUTATION, common.HASH} {
+					c := newCluster(t, consType, nodeNum, withElection(policy))
+					if len(c.leaders()) != 1 || c.orderers[0].Consensus.Options().Elector.Policy() != policy {
+						t.Fatal(policy, "elects a wrong leader")
+					}
+					c.start()
+					c.commit(t, 1)
+
+					// the replicas which commit the same blocks elect the same leaders, the views are elected
+					// by the blocks which all replicas have committed
+					c.stop()
+					tip := -1
+					for _, o := range c.orderers {
+						storage := o.GetBlockStore().Storage
+						height, _ := storage.GetBlockHeight()
+						blk, err := storage.ReadBlock(height)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if tip < 0 || blk.BlkHdr.ViewNumber < tip {
+							tip = blk.BlkHdr.ViewNumber
+						}
+					}
+					v := common.View{NodesNum: nodeNum}
+					for view := 1; view <= tip+common.ElectionLag; view++ {
+						leader := c.orderers[0].Consensus.Options().Elector.ElectLeader(view, v)
+						for i, o := range c.orderers {
+							if o.Consensus.Options().Elector.ElectLeader(view, v) != leader {
+								t.Fatal(policy, "r_"+strconv.Itoa(i), "elects a different leader of view", view)
+							}
+						}
+					}
+				}
+				if func() (err interface{}) {
+					defer func() { err = recover() }()
+					newCluster(t, consType, nodeNum, withElection("unknown"))
+					return nil
+				}() == nil {
+					t.Fatal("unknown election policy is accepted")
+				}
+			})
+
+			t.Run("Pipeline", func(t *testing.T) {
+				const blocks = 12
+				p, err := orderer.LookupProtocol(consType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.MaxWindow <= 1 {
+					t.Skip("the protocol pipelines the proposals by itself")
+				}
+				if func() (err interface{}) {
+					defer func() { err = recover() }()
+					newCluster(t, consType, nodeNum, withWindow(p.MaxWindow+1))
+					return nil
+				}() == nil {
+					t.Fatal("the window above the max window is accepted")
+				}
+
+				// the proposer fills the window before the earliest proposal in flight is committed
+				c := newCluster(t, consType, nodeNum, withWindow(p.MaxWindow))
+				c.interval = time.Millisecond
+				c.start()
+				c.commit(t, blocks)
+				if depth := min(p.MaxWindow, 3); c.inFlight < depth {
+					t.Fatal("at most", c.inFlight, "proposals are in flight within the window", p.MaxWindow)
+				}
+				if c.inFlight > p.MaxWindow {
+					t.Fatal(c.inFlight, "proposals are in flight beyond the window", p.MaxWindow)
+				}
+
+				// the blocks proposed before the previous one is committed are chained in order of height,
+				// and every replica commits the same chain
+				c.stop()
+				var chain []*blockchain.Block
+				for i, o := range c.orderers {
+					storage := o.GetBlockStore().Storage
+					height, err := storage.GetBlockHeight()
+					if err != nil || height < blocks-1 {
+						t.Fatal("r_"+strconv.Itoa(i), "commits", height+1, "blocks", err)
+					}
+					for h := 0; h < blocks; h++ {
+						blk, err := storage.ReadBlock(h)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if blk.BlkHdr.Height != h {
+							t.Fatal("r_"+strconv.Itoa(i), "commits the block of height", blk.BlkHdr.Height, "at", h)
+						}
+						if i == 0 {
+							chain = append(chain, blk)
+						} else if !bytes.Equal(blk.Hash(), chain[h].Hash()) {
+							t.Fatal("r_"+strconv.Itoa(i), "commits a different block at", h)
+						}
+						if h > 0 && !bytes.Equal(blk.BlkHdr.PreBlkHash, chain[h-1].Hash()) {
+							t.Fatal("r_"+strconv.Itoa(i), "commits the block at", h, "which doesn't extend the previous one")
+						}
+					}
+				}
+			})
+
+			t.Run("StopAndRestart", func(t *testing.T) {
+				c := newCluster(t, consType, nodeNum)
+				leader := c.leaders()[0]
+				sendChan := c.sendChans[leader.Consensus.Options().ID]
+
+				// the stopped orderer ignores the requests
+				leader.Stop()
+				leader.HandleReq(0, nil, nil, genReqs(1))
+				select {
+				case msg := <-sendChan:
+					t.Fatal("stopped orderer sends", msg.ReciServer)
+				case <-time.After(100 * time.Millisecond):
+				}
+
+				// the restarted leader proposes the next requests
+				leader.ResetState()
+				leader.RestartCons()
+				if !leader.IsWaitingReq() {
+					t.Fatal("restarted leader is not waiting for the requests")
+				}
+				bs := leader.GetBlockStore()
+				leader.HandleReq(bs.Height, bs.PreBlkHash, bs.CurBlkHash, genReqs(2))
+				select {
+				case <-sendChan:
+				case <-time.After(time.Second):
+					t.Fatal("restarted leader doesn't propose")
+				}
+			})
+
+			t.Run("Reset", func(t *testing.T) {
+				c := newCluster(t, consType, nodeNum)
+				for _, o := range c.orderers {
+					opts, leader := o.Consensus.Options(), o.IsLeader()
+					o.Stop()
+					o.Reset()
+					got := o.Consensus.Options()
+					if got.ID != opts.ID || got.NodeNum != opts.NodeNum || got.Path != opts.Path || got.Signer != opts.Signer || got.Pacemaker != opts.Pacemaker {
+						t.Fatalf("expected options %+v, got %+v", opts, got)
+					}
+					if o.IsLeader() != leader || !o.HandleState || !o.ReqState {
+						t.Fatal("reset orderer has a wrong state")
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestRecoverVote: test the replica of the hotstuff protocols which crashes after voting restarts past the view of its last vote,
+// so that it never votes again in the view for another proposal after the one it voted for is lost
+func TestRecoverVote(t *testing.T) {
+	// the last voted view and the current view of each protocol
+	votes := map[common.ConsensusType]func(cons orderer.Consensus) (int, int){
+		common.HOTSTUFF_PROTOCOL_BASIC: func(cons orderer.Consensus) (int, int) {
+			bhs := cons.(*orderer.BasicHotstuff)
+			return bhs.VotedView, bhs.View.ViewNumber
+		},
+		common.HOTSTUFF_PROTOCOL_CHAINED: func(cons orderer.Consensus) (int, int) {
+			chs := cons.(*orderer.ChainedHotstuff)
+			return chs.VotedView, chs.View.ViewNumber
+		},
+		common.HOTSTUFF_2_PROTOCOL: func(cons orderer.Consensus) (int, int) {
+			hs2 := cons.(*orderer.Hotstuff2)
+			return hs2.VotedView, hs2.View.ViewNumber
+		},
+	}
+	for _, consType := range []common.ConsensusType{common.HOTSTUFF_PROTOCOL_BASIC, common.HOTSTUFF_PROTOCOL_CHAINED, common.HOTSTUFF_2_PROTOCOL} {
+		t.Run(string(consType), func(t *testing.T) {
+			c := newCluster(t, consType, 4)
+			c.start()
+			c.commit(t, 2)
+			c.stop()
+
+			for i, o := range c.orderers {
+				if o.IsLeader() {
+					continue
+				}
+				voted, _ := votes[consType](o.Consensus)
+				if voted < 0 {
+					t.Fatal("the vote of r_"+strconv.Itoa(i), "is not recorded")
+				}
+
+				// restart the replica as it crashes after voting in its current view
+				if err := o.GetBlockStore().Storage.Close(); err != nil {
+					t.Fatal(err)
+				}
+				o.Reset()
+				o.GetBlockStore().GetStorage()
+				if ok, err := o.Recover(); !ok || err != nil {
+					t.Fatal("recover error", ok, err)
+				}
+				recovered, view := votes[consType](o.Consensus)
+				o.Consensus.Stop()
+				if recovered != voted || view <= voted {
+					t.Fatal("r_"+strconv.Itoa(i), "recovers in view", view, "after voting in view", voted)
+				}
+				return
+			}
+			t.Fatal("no replica")
+		})
+	}
+}
+
+// TestPipelinedViewChange: test the view change of pipelined PBFT keeps the sequence numbers in flight, the blocks which
+// every replica prepared in the view of the failed primary are committed at their sequence numbers in the new view,
+// instead of being dropped or reassigned to other blocks by the new primary
+func TestPipelinedViewChange(t *testing.T) {
+	const (
+		nodeNum  = 4
+		prepared = 3
+	)
+	p, err := orderer.LookupProtocol(common.PBFT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pacemaker := common.PacemakerConfig{BaseTimeout: 300 * time.Millisecond, MaxTimeout: time.Second}
+	c := newCluster(t, common.PBFT, nodeNum, withWindow(ptypes.CHECKPOINTNUM), withPacemaker(pacemaker))
+
+	// the commit messages of the first view are lost, so the sequence numbers prepared in it are only committed in the new view
+	var mu sync.Mutex
+	digests := make(map[int][]byte)          // the digest of each sequence number which the replicas prepared
+	senders := make(map[int]map[string]bool) // the replicas which prepared each sequence number and sent the commit message
+	c.drop = func(msg message.ServerMsg) bool {
+		m, _, ok := decodePayload(p, msg.Payload)
+		if !ok {
+			return false
+		}
+		commit := m.(*ptypes.PMsg)
+		if commit.MType != ptypes.COMMIT || commit.ViewNumber != 0 {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if digest, ok := digests[commit.SeqNum]; ok && !bytes.Equal(digest, commit.Digest) {
+			t.Error("the replicas prepared different blocks at sequence number", commit.SeqNum)
+		}
+		digests[commit.SeqNum] = commit.Digest
+		if senders[commit.SeqNum] == nil {
+			senders[commit.SeqNum] = make(map[string]bool)
+		}
+		senders[commit.SeqNum][commit.SendNode] = true
+		return true
+	}
+	preparedByAll := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		seqs := make([]int, 0)
+		for seq, s := range senders {
+			if len(s) == nodeNum {
+				seqs = append(seqs, seq)
+			}
+		}
+		return seqs
+	}
+
+	// the primary of the first view fills the pipeline until more than one sequence number is prepared by every replica
+	c.interval = time.Millisecond
+	c.start()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(preparedByAll()) < prepared {
+		if time.Now().After(deadline) {
+			t.Fatal("only", len(preparedByAll()), "sequence numbers are prepared by every replica")
+		}
+		c.propose()
+		time.Sleep(c.interval)
+	}
+
+	// the view changes as no sequence number is committed, and the new primary commits the prepared ones before its own
+	seqs := preparedByAll()
+	highest := 0
+	for _, seq := range seqs {
+		highest = max(highest, seq)
+	}
+	c.interval = 20 * time.Millisecond
+	if !c.run(uint64(highest+2), 20*time.Second) {
+		t.Fatal("the prepared sequence numbers are not committed after the view change")
+	}
+	c.stop()
+	c.checkSafety(t)
+	for i, o := range c.orderers {
+		if view := o.Consensus.(*orderer.PBFT).View.ViewNumber; view == 0 {
+			t.Fatal("r_"+strconv.Itoa(i), "never changes the view")
+		}
+		storage := o.GetBlockStore().Storage
+		for _, seq := range seqs {
+			blk, err := storage.ReadBlock(seq)
+			if err != nil {
+				t.Fatal("r_"+strconv.Itoa(i), "doesn't commit sequence number", seq, err)
+			}
+			if !bytes.Equal(blk.Hash(), digests[seq]) {
+				t.Fatal("r_"+strconv.Itoa(i), "commits another block than the prepared one at sequence number", seq)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package orderer
+
+import (
+	"bcrequest"
+	"blockchain"
+	"common"
+	"fmt"
+	"message"
+	"mgmt"
+	"sort"
+	"statemachine"
+	"sync"
+	"wire"
+)
+
+// Consensus: the consensus protocol run by the orderer, every protocol implements it
+// and registers its constructor by Register, so the orderer never switches on the consensus type
+type Consensus interface {
+	// HandleReq: propose the requests as the block on the height, which is called by the leader
+	HandleReq(height int, preHash []byte, curHash []byte, reqs []bcrequest.BCRequest)
+	// HandleMsg: handle the consensus message encoded by either codec, and send the returned messages
+	HandleMsg(payload []byte)
+
+	// IsLeader: check whether self is leader of the current view
+	IsLeader() bool
+	// IsWaitingReq: check whether the leader is waiting for the requests to propose
+	IsWaitingReq() bool
+	// GetLeaderName: get the name of leader of the current view
+	GetLeaderName() string
+	// GetProposerName: get the name of the node which proposes the next requests, which is the leader of the current view
+	// unless the proposals are pipelined, or the node itself if every node disseminates its own requests
+	GetProposerName() string
+	// InitLeader: initialize the state of the leader
+	InitLeader()
+	// FixLeader: patch the leader state when the threshold is updated by a joined node
+	FixLeader()
+	// RefreshLeader: refresh the leader of the view
+	RefreshLeader()
+
+	// Stop: stop the timers, the orderer stops handling the requests and messages
+	Stop()
+	// Restart: continue the consensus after the nodes join or exit, and send the returned messages
+	Restart()
+	// Recover: restart the consensus from the local block store instead of height 0 and view 0
+	Recover() (bool, error)
+	// Rejoin: send the messages of the recovered consensus to rejoin the running cluster
+	Rejoin()
+	// Handover: start the recovered consensus on the tip committed by another protocol, instead of rejoining,
+	// the tip has no certificate of this protocol, so the first round is started as the one in view 0
+	Handover()
+	// ClearCurrentRound: clear the messages recieved in the current round
+	ClearCurrentRound()
+
+	// AddSyncInfo: add the local information to the sync-message for the joined node
+	AddSyncInfo(msg *mgmt.NodeMgmtMsg)
+	// SyncInfo: sync the information from the selected sync-message
+	SyncInfo(msg *mgmt.NodeMgmtMsg, leader int)
+	// UpdateNodesNum: update the number of nodes in the system
+	UpdateNodesNum(nodeNum int)
+	// IsReady: check whether the consensus is ready to start, such as the signer matches the number of nodes
+	IsReady() bool
+	// Pacemaker: get the pacemaker which decides the view timeout
+	Pacemaker() *common.Pacemaker
+
+	// BlockStore: get the block store of the consensus
+	BlockStore() *blockchain.BlockStore
+	// PublicKey: get the public key to verify the validation of blocks, see Protocol.VerifyBlock
+	PublicKey() []byte
+	// Options: get the options the consensus is created with, which rebuild it as the node crashes
+	Options() Options
+
+	// SetReqValidator: set the validator of client requests to the consensus and its state machine
+	SetReqValidator(v *bcrequest.Validator)
+	// SetCodec: set the codec of the consensus messages sent to the replicas
+	SetCodec(codec wire.Codec)
+	// SetSigner: replace the signer, such as the threshold signer updated after the nodes join or exit
+	SetSigner(signer interface{}) error
+}
+
+// Options: the options to create a consensus
+type Options struct {
+	ID           int                       // the unique identification of the server
+	NodeNum      int                       // the number of nodes in the system
+	Path         string                    // the path of block storage
+	SendChan     chan message.ServerMsg    // the channel within the server that receives all messages that need to be sent
+	Signer       interface{}               // the signer for signature, whose type is decided by the protocol
+	Pacemaker    common.PacemakerConfig    // the pacemaker config of view timeout, the zero fields take the defaults of the protocol
+	Elector      common.LeaderElector      // the policy to elect the leader of each view, round-robin if it is nil
+	Window       int                       // the max number of proposals in flight, basic hotstuff and PBFT pipeline the proposals if it is more than 1, see Protocol.MaxWindow
+	StateMachine statemachine.StateMachine // the replicated application taken over from the consensus of the last epoch, a new one is created if it is nil
+}
+
+// Protocol: the consensus protocol registered to the orderer
+type Protocol struct {
+	New         func(opts Options) (Consensus, error)                 // create the consensus, it returns the error if the signer type does not match
+	NewSigners  func(nodeNum int) []interface{}                       // generate the signers of all nodes
+	Rekey       bool                                                  // whether the signers depend on the number of nodes and are regenerated when the nodes join or exit
+	NewMsg      func() interface{}                                    // create an empty consensus message to decode the payload into
+	VerifyBlock func(blkHdr *blockchain.BlockHeader, pk []byte) error // verify the validation of block by the public key, see Consensus.PublicKey
+	Classify    func(msg interface{}) mgmt.Participation              // classify the decoded message as the participation of its sender, see Orderer.Participation
+	MaxWindow   int                                                   // the max number of proposals in flight, 0 if the protocol pipelines the proposals by itself and ignores the window
+}
+
+var (
+	protocols   = make(map[common.ConsensusType]Protocol)
+	protocolsMu sync.RWMutex
+)
+
+// Register: register the consensus protocol, it is called in the init function of the protocol
+// params:
+// - consType: the consensus type selected by the config
+// - p:        the protocol, all of its functions must be given
+func Register(consType common.ConsensusType, p Protocol) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+	if p.New == nil || p.NewSigners == nil || p.NewMsg == nil || p.VerifyBlock == nil || p.Classify == nil {
+		panic("orderer: Register protocol " + string(consType) + " is incomplete")
+	}
+	if _, ok := protocols[consType]; ok {
+		panic("orderer: Register called twice for protocol " + string(consType))
+	}
+	protocols[consType] = p
+}
+
+// LookupProtocol: get the registered consensus protocol
+// params:
+// - consType: the consensus type
+// return:
+// - the protocol and error if it is not registered
+func LookupProtocol(consType common.ConsensusType) (Protocol, error) {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+	p, ok := protocols[consType]
+	if !ok {
+		return Protocol{}, fmt.Errorf("unknown consensus type %q", consType)
+	}
+	return p, nil
+}
+
+// CheckWindow: check the pipeline window of the orderer against the max window of the protocol, see Protocol.MaxWindow,
+// the window is checked by the config instead of being bounded, since the consensus can't be created with a larger one
+// params:
+// - consType: the consensus type
+// - window:   the configured max number of proposals in flight
+// return:
+// - error if the protocol is unknown or the window is above its max window
+func CheckWindow(consType common.ConsensusType, window int) error {
+	p, err := LookupProtocol(consType)
+	if err != nil {
+		return err
+	}
+	if p.MaxWindow == 0 {
+		return nil
+	}
+	if _, err := common.PipelineWindow(window, p.MaxWindow); err != nil {
+		return fmt.Errorf("%s: %w", consType, err)
+	}
+	return nil
+}
+
+// Protocols: get the sorted types of all registered consensus protocols
+func Protocols() []common.ConsensusType {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+	types := make([]common.ConsensusType, 0, len(protocols))
+	for consType := range protocols {
+		types = append(types, consType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
@@ -0,0 +1,34 @@
+package orderer
+
+import (
+	"blockchain"
+	"common"
+)
+
+// replayElection: observe the latest committed blocks in the storage again, which start the certified chain the leader election depends on
+// params:
+// - elector: the leader elector of the consensus, nothing is replayed if it is nil
+// - storage: the block storage
+// return:
+// - error
+func replayElection(elector common.LeaderElector, storage blockchain.BlockStorage) error {
+	if elector == nil || elector.HistorySize() == 0 {
+		return nil
+	}
+	height, err := storage.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+	start := height - elector.HistorySize() + 1
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i <= height; i++ {
+		blk, err := storage.ReadBlock(i)
+		if err != nil {
+			return err
+		}
+		elector.Certify(blk.BlkHdr.ViewNumber, blk.Hash(), blk.BlkHdr.PreBlkHash)
+	}
+	return nil
+}
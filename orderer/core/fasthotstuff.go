@@ -0,0 +1,163 @@
+package orderer
+
+import (
+	"bcrequest"
+	"blockchain"
+	"common"
+	"errors"
+	fhcore "fasthotstuff/core"
+	fhstypes "fasthotstuff/types"
+	"mgmt"
+	"statemachine"
+	"time"
+	"tss"
+	"wire"
+)
+
+const (
+	FastHotstuffTimeout = 2000 * time.Millisecond // the default base timeout of view in fast-hotstuff
+)
+
+func init() {
+	Register(common.FAST_HOTSTUFF_PROTOCOL, Protocol{
+		New:         NewFastHotstuff,
+		NewSigners:  newThresholdSigners,
+		Rekey:       true,
+		NewMsg:      func() interface{} { return &fhstypes.Msg{} },
+		VerifyBlock: verifyThresholdBlock(fastHotstuffCertified),
+		Classify:    classifyFastHotstuffMsg,
+	})
+}
+
+// FastHotstuff: the fast-hotstuff consensus run by the orderer
+type FastHotstuff struct {
+	*fhcore.FastHotstuff
+}
+
+// NewFastHotstuff: create the fast-hotstuff consensus
+// params:
+// - opts: the options, whose signer must be *tss.Signer
+// return:
+// - the consensus and error
+func NewFastHotstuff(opts Options) (Consensus, error) {
+	signer, ok := opts.Signer.(*tss.Signer)
+	if !ok {
+		return nil, errors.New("signer type does not match")
+	}
+	pm := common.NewPacemaker(opts.Pacemaker.WithDefaults(FastHotstuffTimeout))
+	fhs := fhcore.NewFastHotstuff(int(pm.Config.BaseTimeout/time.Millisecond), opts.ID, opts.NodeNum, opts.Path, opts.SendChan, signer)
+	fhs.ViewTimer.Pacemaker = pm
+	fhs.View.Elector = opts.Elector
+	if opts.StateMachine != nil {
+		fhs.StateMachine = opts.StateMachine
+	}
+	return &FastHotstuff{fhs}, nil
+}
+
+// HandleReq: propose the requests, the block extends the highest QC instead of the current block
+func (f *FastHotstuff) HandleReq(height int, preHash []byte, curHash []byte, reqs []bcrequest.BCRequest) {
+	f.FastHotstuff.HandleReq(height, preHash, reqs)
+}
+
+// HandleMsg: handle the fast-hotstuff message
+func (f *FastHotstuff) HandleMsg(payload []byte) {
+	f.HandleFMsg(payload)
+}
+
+// GetProposerName: the leader of the current view proposes
+func (f *FastHotstuff) GetProposerName() string {
+	return f.GetLeaderName()
+}
+
+// FixLeader: nothing to patch, the leader of fast-hotstuff proposes by the QC or the aggregated QC it keeps
+func (f *FastHotstuff) FixLeader() {}
+
+// RefreshLeader: refresh the leader of the view
+func (f *FastHotstuff) RefreshLeader() {
+	f.View.RefreshLeader()
+}
+
+// Stop: stop the view timer
+func (f *FastHotstuff) Stop() {
+	f.ViewTimer.Stop()
+}
+
+// Restart: the leader which has not proposed waits for the requests,
+// and the QC is not checked in the first round after the nodes join or exit
+func (f *FastHotstuff) Restart() {
+	f.RestartFastHotstuff()
+}
+
+// Rejoin: send the messages of the recovered consensus
+func (f *FastHotstuff) Rejoin() {
+	if msgReturn := f.FastHotstuff.Rejoin(); msgReturn != nil {
+		f.SendSerMsg(msgReturn)
+	}
+}
+
+// IsReady: the threshold signer matches the number of nodes
+func (f *FastHotstuff) IsReady() bool {
+	return f.View.NodesNum == f.ThresholdSigner.SignNum
+}
+
+// Pacemaker: get the pacemaker of the view timer
+func (f *FastHotstuff) Pacemaker() *common.Pacemaker {
+	return f.ViewTimer.Pacemaker
+}
+
+// BlockStore: get the block store
+func (f *FastHotstuff) BlockStore() *blockchain.BlockStore {
+	return &f.BlkStore
+}
+
+// PublicKey: get the shared public key of the threshold signature
+func (f *FastHotstuff) PublicKey() []byte {
+	return f.ThresholdSigner.PublicKeyBytes()
+}
+
+// Options: get the options of the consensus
+func (f *FastHotstuff) Options() Options {
+	return Options{ID: f.ConsId, NodeNum: f.View.NodesNum, Path: f.BlkStore.Path, SendChan: f.SendChan, Signer: f.ThresholdSigner, Pacemaker: f.ViewTimer.Pacemaker.Config, Elector: f.View.Elector, StateMachine: f.StateMachine}
+}
+
+// SetReqValidator: set the validator of client requests
+func (f *FastHotstuff) SetReqValidator(v *bcrequest.Validator) {
+	f.ReqValidator = v
+	f.StateMachine = statemachine.WithValidator(f.StateMachine, v, f.BlockStore())
+}
+
+// SetCodec: set the codec of the sent messages
+func (f *FastHotstuff) SetCodec(codec wire.Codec) {
+	f.Codec = codec
+}
+
+// SetSigner: replace the threshold signer
+func (f *FastHotstuff) SetSigner(signer interface{}) error {
+	return setThresholdSigner(&f.ThresholdSigner, signer)
+}
+
+// fastHotstuffCertified: get the hash of the block certified by the QC of fast-hotstuff
+func fastHotstuffCertified(validationMsg []byte) ([][]byte, error) {
+	qc, err := fhstypes.DecodeQC(validationMsg)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{qc.HsNode.CurHash}, nil
+}
+
+// classifyFastHotstuffMsg: classify the message of fast hotstuff
+func classifyFastHotstuffMsg(msg interface{}) mgmt.Participation {
+	m, ok := msg.(*fhstypes.Msg)
+	if !ok {
+		return mgmt.PART_NONE
+	}
+	switch m.MType {
+	case fhstypes.PROPOSE:
+		return mgmt.PART_PROPOSAL
+	case fhstypes.VOTE:
+		return mgmt.PART_VOTE
+	case fhstypes.TIMEOUT:
+		return mgmt.PART_TIMEOUT
+	}
+	return mgmt.PART_NONE
+}
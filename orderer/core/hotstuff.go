@@ -0,0 +1,356 @@
+package orderer
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	"common"
+	"errors"
+	"hotstuff/core"
+	hstypes "hotstuff/types"
+	"mgmt"
+	"statemachine"
+	"time"
+	"tss"
+	"wire"
+)
+
+const (
+	BasicTimeout   = 5000 * time.Millisecond // the default base timeout of view in basic hotstuff
+	ChainedTimeout = 2000 * time.Millisecond // the default base timeout of view in chained hotstuff
+)
+
+func init() {
+	Register(common.HOTSTUFF_PROTOCOL_BASIC, Protocol{
+		New:         NewBasicHotstuff,
+		NewSigners:  newThresholdSigners,
+		Rekey:       true,
+		NewMsg:      func() interface{} { return &hstypes.Msg{} },
+		VerifyBlock: verifyThresholdBlock(basicCertified),
+		Classify:    classifyBasicMsg,
+		MaxWindow:   core.MaxWindow,
+	})
+	Register(common.HOTSTUFF_PROTOCOL_CHAINED, Protocol{
+		New:         NewChainedHotstuff,
+		NewSigners:  newThresholdSigners,
+		Rekey:       true,
+		NewMsg:      func() interface{} { return &hstypes.CMsg{} },
+		VerifyBlock: verifyThresholdBlock(chainedCertified),
+		Classify:    classifyChainedMsg,
+	})
+}
+
+// BasicHotstuff: the basic hotstuff consensus run by the orderer
+type BasicHotstuff struct {
+	*core.BCHotstuff
+}
+
+// NewBasicHotstuff: create the basic hotstuff consensus
+// params:
+// - opts: the options, whose signer must be *tss.Signer
+// return:
+// - the consensus and error
+func NewBasicHotstuff(opts Options) (Consensus, error) {
+	signer, ok := opts.Signer.(*tss.Signer)
+	if !ok {
+		return nil, errors.New("signer type does not match")
+	}
+	pm := common.NewPacemaker(opts.Pacemaker.WithDefaults(BasicTimeout))
+	bhs := core.NewBCHotstuff(int(pm.Config.BaseTimeout/time.Millisecond), opts.ID, opts.NodeNum, opts.Path, opts.SendChan, signer)
+	bhs.ViewTimer.Pacemaker = pm
+	bhs.View.Elector = opts.Elector
+	if opts.StateMachine != nil {
+		bhs.StateMachine = opts.StateMachine
+	}
+	window, err := common.PipelineWindow(opts.Window, core.MaxWindow)
+	if err != nil {
+		return nil, err
+	}
+	bhs.Window = window
+	return &BasicHotstuff{bhs}, nil
+}
+
+// HandleReq: propose the requests, the current block hash is not used by basic hotstuff
+func (b *BasicHotstuff) HandleReq(height int, preHash []byte, curHash []byte, reqs []bcrequest.BCRequest) {
+	b.BCHotstuff.HandleReq(height, preHash, reqs)
+}
+
+// HandleMsg: handle the basic hotstuff message
+func (b *BasicHotstuff) HandleMsg(payload []byte) {
+	b.HandleBMsg(payload)
+}
+
+// RefreshLeader: refresh the leader of the view
+func (b *BasicHotstuff) RefreshLeader() {
+	b.View.RefreshLeader()
+}
+
+// Stop: stop the view timer
+func (b *BasicHotstuff) Stop() {
+	b.ViewTimer.Stop()
+}
+
+// Restart: the leader proposes the kept proposal again or waits for the requests
+func (b *BasicHotstuff) Restart() {
+	if msgReturn := b.RestartBasicHotstuff(); msgReturn != nil {
+		b.SendSerMsg(msgReturn)
+	}
+}
+
+// Rejoin: send the messages of the recovered consensus
+func (b *BasicHotstuff) Rejoin() {
+	if msgReturn := b.BCHotstuff.Rejoin(); msgReturn != nil {
+		b.SendSerMsg(msgReturn)
+	}
+}
+
+// IsReady: the threshold signer matches the number of nodes
+func (b *BasicHotstuff) IsReady() bool {
+	return b.View.NodesNum == b.ThresholdSigner.SignNum
+}
+
+// Pacemaker: get the pacemaker of the view timer
+func (b *BasicHotstuff) Pacemaker() *common.Pacemaker {
+	return b.ViewTimer.Pacemaker
+}
+
+// BlockStore: get the block store
+func (b *BasicHotstuff) BlockStore() *blockchain.BlockStore {
+	return &b.BlkStore
+}
+
+// PublicKey: get the shared public key of the threshold signature
+func (b *BasicHotstuff) PublicKey() []byte {
+	return b.ThresholdSigner.PublicKeyBytes()
+}
+
+// Options: get the options of the consensus
+func (b *BasicHotstuff) Options() Options {
+	return Options{ID: b.ConsId, NodeNum: b.View.NodesNum, Path: b.BlkStore.Path, SendChan: b.SendChan, Signer: b.ThresholdSigner, Pacemaker: b.ViewTimer.Pacemaker.Config, Elector: b.View.Elector, Window: b.Window, StateMachine: b.StateMachine}
+}
+
+// SetReqValidator: set the validator of client requests
+func (b *BasicHotstuff) SetReqValidator(v *bcrequest.Validator) {
+	b.ReqValidator = v
+	b.StateMachine = statemachine.WithValidator(b.StateMachine, v, b.BlockStore())
+}
+
+// SetCodec: set the codec of the sent messages
+func (b *BasicHotstuff) SetCodec(codec wire.Codec) {
+	b.Codec = codec
+}
+
+// SetSigner: replace the threshold signer
+func (b *BasicHotstuff) SetSigner(signer interface{}) error {
+	return setThresholdSigner(&b.ThresholdSigner, signer)
+}
+
+// ChainedHotstuff: the chained hotstuff consensus run by the orderer
+type ChainedHotstuff struct {
+	*core.CHotstuff
+}
+
+// NewChainedHotstuff: create the chained hotstuff consensus
+// params:
+// - opts: the options, whose signer must be *tss.Signer
+// return:
+// - the consensus and error
+func NewChainedHotstuff(opts Options) (Consensus, error) {
+	signer, ok := opts.Signer.(*tss.Signer)
+	if !ok {
+		return nil, errors.New("signer type does not match")
+	}
+	pm := common.NewPacemaker(opts.Pacemaker.WithDefaults(ChainedTimeout))
+	chs := core.NewChainedHotstuff(int(pm.Config.BaseTimeout/time.Millisecond), opts.ID, opts.NodeNum, opts.Path, opts.SendChan, signer)
+	chs.ViewTimer.Pacemaker = pm
+	chs.View.Elector = opts.Elector
+	if opts.StateMachine != nil {
+		chs.StateMachine = opts.StateMachine
+	}
+	return &ChainedHotstuff{chs}, nil
+}
+
+// HandleReq: propose the requests, the current block hash is not used by chained hotstuff
+func (c *ChainedHotstuff) HandleReq(height int, preHash []byte, curHash []byte, reqs []bcrequest.BCRequest) {
+	c.CHotstuff.HandleReq(height, preHash, reqs)
+}
+
+// HandleMsg: handle the chained hotstuff message
+func (c *ChainedHotstuff) HandleMsg(payload []byte) {
+	c.HandleCMsg(payload)
+}
+
+// GetProposerName: the leader of the current view proposes, the generic phase pipelines the proposals by itself
+func (c *ChainedHotstuff) GetProposerName() string {
+	return c.GetLeaderName()
+}
+
+// IsWaitingReq: check whether the leader is waiting for the requests
+func (c *ChainedHotstuff) IsWaitingReq() bool {
+	return c.CurPhase == hstypes.WAITING
+}
+
+// RefreshLeader: refresh the leader of the view
+func (c *ChainedHotstuff) RefreshLeader() {
+	c.View.RefreshLeader()
+}
+
+// Stop: stop the view timer
+func (c *ChainedHotstuff) Stop() {
+	c.ViewTimer.Stop()
+}
+
+// Restart: the leader proposes the kept proposal again or waits for the requests
+func (c *ChainedHotstuff) Restart() {
+	if msgReturn := c.RestartChainedHotstuff(); msgReturn != nil {
+		c.SendSerMsg(msgReturn)
+	}
+}
+
+// Rejoin: send the messages of the recovered consensus
+func (c *ChainedHotstuff) Rejoin() {
+	if msgReturn := c.CHotstuff.Rejoin(); msgReturn != nil {
+		c.SendSerMsg(msgReturn)
+	}
+}
+
+// IsReady: the threshold signer matches the number of nodes
+func (c *ChainedHotstuff) IsReady() bool {
+	return c.View.NodesNum == c.ThresholdSigner.SignNum
+}
+
+// Pacemaker: get the pacemaker of the view timer
+func (c *ChainedHotstuff) Pacemaker() *common.Pacemaker {
+	return c.ViewTimer.Pacemaker
+}
+
+// BlockStore: get the block store
+func (c *ChainedHotstuff) BlockStore() *blockchain.BlockStore {
+	return &c.BlkStore
+}
+
+// PublicKey: get the shared public key of the threshold signature
+func (c *ChainedHotstuff) PublicKey() []byte {
+	return c.ThresholdSigner.PublicKeyBytes()
+}
+
+// Options: get the options of the consensus
+func (c *ChainedHotstuff) Options() Options {
+	return Options{ID: c.ConsId, NodeNum: c.View.NodesNum, Path: c.BlkStore.Path, SendChan: c.SendChan, Signer: c.ThresholdSigner, Pacemaker: c.ViewTimer.Pacemaker.Config, Elector: c.View.Elector, StateMachine: c.StateMachine}
+}
+
+// SetReqValidator: set the validator of client requests
+func (c *ChainedHotstuff) SetReqValidator(v *bcrequest.Validator) {
+	c.ReqValidator = v
+	c.StateMachine = statemachine.WithValidator(c.StateMachine, v, c.BlockStore())
+}
+
+// SetCodec: set the codec of the sent messages
+func (c *ChainedHotstuff) SetCodec(codec wire.Codec) {
+	c.Codec = codec
+}
+
+// SetSigner: replace the threshold signer
+func (c *ChainedHotstuff) SetSigner(signer interface{}) error {
+	return setThresholdSigner(&c.ThresholdSigner, signer)
+}
+
+// newThresholdSigners: generate the threshold signers, 2f+1 of n nodes sign the QC
+func newThresholdSigners(nodeNum int) []interface{} {
+	signers := make([]interface{}, 0, nodeNum)
+	for _, s := range tss.NewSigners(nodeNum, (nodeNum-1)/3*2+1) {
+		signers = append(signers, s)
+	}
+	return signers
+}
+
+// setThresholdSigner: replace the threshold signer of the protocols based on hotstuff
+func setThresholdSigner(dst **tss.Signer, signer interface{}) error {
+	s, ok := signer.(*tss.Signer)
+	if !ok {
+		return errors.New("signer type does not match")
+	}
+	*dst = s
+	return nil
+}
+
+// verifyThresholdBlock: verify the validation of block which is the threshold signature of QC certifying the block hash,
+// the QC is decoded from the validation message, and one of the hashes of the blocks it certifies must be the block hash
+// params:
+// - certified: get the hashes of the blocks certified by the validation message of the protocol
+// return:
+// - the function to verify the block of the protocol, see Protocol.VerifyBlock
+func verifyThresholdBlock(certified func(validationMsg []byte) ([][]byte, error)) func(blkHdr *blockchain.BlockHeader, pk []byte) error {
+	return func(blkHdr *blockchain.BlockHeader, pk []byte) error {
+		if len(blkHdr.ValidationMsg) == 0 {
+			return errors.New("the block has no validation message")
+		}
+		hashes, err := certified(blkHdr.ValidationMsg)
+		if err != nil {
+			return err
+		}
+		blkHash, matched := blkHdr.Hash(), false
+		for _, hash := range hashes {
+			matched = matched || bytes.Equal(hash, blkHash)
+		}
+		if !matched {
+			return errors.New("the validation does not certify the block")
+		}
+		if !tss.VerifyByPublicKey(pk, blkHdr.ValidationMsg, blkHdr.Validation) {
+			return errors.New("threshold signature verify error")
+		}
+		return nil
+	}
+}
+
+// basicCertified: get the hash of the block certified by the QC of basic hotstuff
+func basicCertified(validationMsg []byte) ([][]byte, error) {
+	qc, err := hstypes.DecodeQC(validationMsg)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{qc.HsNode.CurHash}, nil
+}
+
+// chainedCertified: get the hashes of the blocks certified by the QC of chained hotstuff, the committed block is one of its nodes
+func chainedCertified(validationMsg []byte) ([][]byte, error) {
+	qc, err := hstypes.DecodeChainedQC(validationMsg)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, 0, len(qc.HsNodes))
+	for _, node := range qc.HsNodes {
+		hashes = append(hashes, node.CurHash)
+	}
+	return hashes, nil
+}
+
+// classifyBasicMsg: classify the message of basic hotstuff, the new view is sent in every view, so it isn't logged as a timeout
+func classifyBasicMsg(msg interface{}) mgmt.Participation {
+	m, ok := msg.(*hstypes.Msg)
+	if !ok {
+		return mgmt.PART_NONE
+	}
+	switch m.MType {
+	case hstypes.PREPARE, hstypes.PRE_COMMIT, hstypes.COMMIT, hstypes.DECIDE:
+		return mgmt.PART_PROPOSAL
+	case hstypes.PREPARE_VOTE, hstypes.PRE_COMMIT_VOTE, hstypes.COMMIT_VOTE:
+		return mgmt.PART_VOTE
+	}
+	return mgmt.PART_NONE
+}
+
+// classifyChainedMsg: classify the message of chained hotstuff
+func classifyChainedMsg(msg interface{}) mgmt.Participation {
+	m, ok := msg.(*hstypes.CMsg)
+	if !ok {
+		return mgmt.PART_NONE
+	}
+	switch m.MType {
+	case hstypes.GENERIC, hstypes.HALF_GENERIC:
+		return mgmt.PART_PROPOSAL
+	case hstypes.GENERIC_VOTE:
+		return mgmt.PART_VOTE
+	}
+	return mgmt.PART_NONE
+}
@@ -0,0 +1,188 @@
+package orderer
+
+import (
+	"bcrequest"
+	"blockchain"
+	"common"
+	"errors"
+	h2core "hotstuff2/core"
+	hs2types "hotstuff2/types"
+	"mgmt"
+	"statemachine"
+	"time"
+	"tss"
+	"wire"
+)
+
+const (
+	Hotstuff2EnterTimeout = 500 * time.Millisecond  // the default base timeout of the enter phase in hotstuff-2
+	Hotstuff2ViewTimeout  = 2000 * time.Millisecond // the default base timeout of view in hotstuff-2
+)
+
+func init() {
+	Register(common.HOTSTUFF_2_PROTOCOL, Protocol{
+		New:         NewHotstuff2,
+		NewSigners:  newThresholdSigners,
+		Rekey:       true,
+		NewMsg:      func() interface{} { return &hs2types.H2Msg{} },
+		VerifyBlock: verifyThresholdBlock(hotstuff2Certified),
+		Classify:    classifyHotstuff2Msg,
+	})
+}
+
+// Hotstuff2: the hotstuff-2 consensus run by the orderer
+type Hotstuff2 struct {
+	*h2core.Hotstuff2
+}
+
+// NewHotstuff2: create the hotstuff-2 consensus
+// params:
+// - opts: the options, whose signer must be *tss.Signer
+// return:
+// - the consensus and error
+func NewHotstuff2(opts Options) (Consensus, error) {
+	signer, ok := opts.Signer.(*tss.Signer)
+	if !ok {
+		return nil, errors.New("signer type does not match")
+	}
+	pm := common.NewPacemaker(opts.Pacemaker.WithDefaults(Hotstuff2ViewTimeout))
+
+	// the enter phase waits for a fixed period P_pc+Δ which expires in every view entered by TC, so it never backs off,
+	// and it keeps the ratio of the default timeouts to the view so that the leader proposes before the view times out
+	enter := common.PacemakerConfig{
+		BaseTimeout: pm.Config.BaseTimeout / (Hotstuff2ViewTimeout / Hotstuff2EnterTimeout),
+		Multiplier:  1,
+		Clock:       opts.Pacemaker.Clock,
+	}
+	enter.MaxTimeout = enter.BaseTimeout
+	enterPM := common.NewPacemaker(enter.WithDefaults(Hotstuff2EnterTimeout))
+
+	hs2 := h2core.NewHotstuff2(int(enterPM.Config.BaseTimeout/time.Millisecond), int(pm.Config.BaseTimeout/time.Millisecond), opts.ID, opts.NodeNum, opts.Path, opts.SendChan, signer)
+	hs2.PM.EnterTimer.Pacemaker, hs2.PM.ViewTimer.Pacemaker = enterPM, pm
+	hs2.View.Elector = opts.Elector
+	if opts.StateMachine != nil {
+		hs2.StateMachine = opts.StateMachine
+	}
+	return &Hotstuff2{hs2}, nil
+}
+
+// HandleReq: propose the requests, the current block hash is not used by hotstuff-2
+func (h *Hotstuff2) HandleReq(height int, preHash []byte, curHash []byte, reqs []bcrequest.BCRequest) {
+	h.Hotstuff2.HandleReq(height, preHash, reqs)
+}
+
+// HandleMsg: handle the hotstuff-2 message
+func (h *Hotstuff2) HandleMsg(payload []byte) {
+	h.HandleH2Msg(payload)
+}
+
+// IsWaitingReq: check whether the leader is waiting for the requests
+func (h *Hotstuff2) IsWaitingReq() bool {
+	return h.CurPhase == hs2types.NEW_PROPOSE
+}
+
+// GetProposerName: the leader of the current view proposes
+func (h *Hotstuff2) GetProposerName() string {
+	return h.GetLeaderName()
+}
+
+// FixLeader: nothing to patch, the leader of hotstuff-2 doesn't keep the state depending on the threshold
+func (h *Hotstuff2) FixLeader() {}
+
+// RefreshLeader: refresh the leader of the view
+func (h *Hotstuff2) RefreshLeader() {
+	h.View.RefreshLeader()
+}
+
+// Stop: stop the timers of pacemaker
+func (h *Hotstuff2) Stop() {
+	h.PM.EnterTimer.Stop()
+	h.PM.ViewTimer.Stop()
+}
+
+// Restart: the leader proposes the kept proposal again,
+// and the QC is not checked in the first round after the nodes join or exit
+func (h *Hotstuff2) Restart() {
+	h.IgnoreCheckQC = true
+	if msgReturn := h.RestartHotstuff2(); msgReturn != nil {
+		h.SendSerMsg(msgReturn)
+	}
+}
+
+// Rejoin: send the messages of the recovered consensus
+func (h *Hotstuff2) Rejoin() {
+	if msgReturn := h.Hotstuff2.Rejoin(); msgReturn != nil {
+		h.SendSerMsg(msgReturn)
+	}
+}
+
+// ClearCurrentRound: nothing to clear, the messages of the current round are kept,
+// and the first round after the nodes join or exit ignores the QC instead, see Restart
+func (h *Hotstuff2) ClearCurrentRound() {}
+
+// IsReady: the threshold signer matches the number of nodes
+func (h *Hotstuff2) IsReady() bool {
+	return h.View.NodesNum == h.ThresholdSigner.SignNum
+}
+
+// Pacemaker: get the pacemaker of the view timer
+func (h *Hotstuff2) Pacemaker() *common.Pacemaker {
+	return h.PM.ViewTimer.Pacemaker
+}
+
+// BlockStore: get the block store
+func (h *Hotstuff2) BlockStore() *blockchain.BlockStore {
+	return &h.BlkStore
+}
+
+// PublicKey: get the shared public key of the threshold signature
+func (h *Hotstuff2) PublicKey() []byte {
+	return h.ThresholdSigner.PublicKeyBytes()
+}
+
+// Options: get the options of the consensus
+func (h *Hotstuff2) Options() Options {
+	return Options{ID: h.ConsId, NodeNum: h.View.NodesNum, Path: h.BlkStore.Path, SendChan: h.SendChan, Signer: h.ThresholdSigner, Pacemaker: h.PM.ViewTimer.Pacemaker.Config, Elector: h.View.Elector, StateMachine: h.StateMachine}
+}
+
+// SetReqValidator: set the validator of client requests
+func (h *Hotstuff2) SetReqValidator(v *bcrequest.Validator) {
+	h.ReqValidator = v
+	h.StateMachine = statemachine.WithValidator(h.StateMachine, v, h.BlockStore())
+}
+
+// SetCodec: set the codec of the sent messages
+func (h *Hotstuff2) SetCodec(codec wire.Codec) {
+	h.Codec = codec
+}
+
+// SetSigner: replace the threshold signer
+func (h *Hotstuff2) SetSigner(signer interface{}) error {
+	return setThresholdSigner(&h.ThresholdSigner, signer)
+}
+
+// hotstuff2Certified: get the hash of the block certified by the QC of hotstuff-2
+func hotstuff2Certified(validationMsg []byte) ([][]byte, error) {
+	qc, err := hs2types.DecodeQuromCert(validationMsg)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{qc.Hs2Node.CurHash}, nil
+}
+
+// classifyHotstuff2Msg: classify the message of hotstuff-2, the wish to enter the next view is sent after the view times out
+func classifyHotstuff2Msg(msg interface{}) mgmt.Participation {
+	m, ok := msg.(*hs2types.H2Msg)
+	if !ok {
+		return mgmt.PART_NONE
+	}
+	switch m.MType {
+	case hs2types.PROPOSE, hs2types.NEW_PROPOSE, hs2types.PREPARE:
+		return mgmt.PART_PROPOSAL
+	case hs2types.VOTE1, hs2types.VOTE2:
+		return mgmt.PART_VOTE
+	case hs2types.WISH:
+		return mgmt.PART_TIMEOUT
+	}
+	return mgmt.PART_NONE
+}
@@ -1,30 +1,35 @@
 package orderer
 
 import (
+	"bcrequest"
 	"common"
-	"hotstuff/core"
-	h2core "hotstuff2/core"
+	"errors"
 	"message"
 	"mgmt"
-	pcore "pbft/core"
-	"ssm2"
-	"tss"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wire"
 )
 
 // Orderer: the role responsible for consensus ordering in the system
 type Orderer struct {
-	ConsType        common.ConsensusType // the consensus protocol type selected by the server
-	HandleState     bool                 // the flag of whether the consensus message can be accepted
-	ReqState        bool                 // the flag of whether the request can be accepted
-	ReqFlagChan     chan bool
-	SendChan        chan message.ServerMsg // the channel that submits the message to the server that needs to be sent
-	BasicHotstuff   *core.BCHotstuff       // the core of basic hotstuff consensus
-	ChainedHotstuff *core.CHotstuff        // the core of chained hotstuff consensus
-	Hotstuff2       *h2core.Hotstuff2      // the core of hotstuff-2 consensus
-	PBFTConsensus   *pcore.PBFT            // the core of PBFT consensus
-}
-
-// InitConsensus: init consensus
+	ConsType     common.ConsensusType // the consensus protocol type selected by the server
+	HandleState  bool                 // the flag of whether the consensus message can be accepted
+	ReqState     bool                 // the flag of whether the request can be accepted
+	ReqFlagChan  chan bool
+	SendChan     chan message.ServerMsg // the channel that submits the message to the server that needs to be sent
+	Consensus    Consensus              // the consensus protocol of ConsType, which is created by its registered constructor
+	ReqValidator *bcrequest.Validator   // the validator of client requests shared by the leader and the consensus
+	Codec        wire.Codec             // the codec of the consensus messages sent to the replicas
+	Pacemaker    common.PacemakerConfig // the pacemaker config of view timeout, the zero fields take the defaults of the protocol, see SetBaseTimeout
+	Election     common.ElectionPolicy  // the policy to elect the leader of each view, round-robin by default
+	Window       int                    // the max number of proposals in flight, the proposals are pipelined if it is more than 1
+	pmLock       sync.Mutex             // guards the pacemaker config retuned while the consensus is rebuilt
+	msgType      atomic.Value           // the ConsType of the built consensus read by TranscodePayload, which is called by the goroutines of the transport
+}
+
+// InitConsensus: init consensus by the protocol registered for the consensus type
 // params:
 // - consType:	the consensus protocol type
 // - id:		the unique identification of the server
@@ -34,97 +39,115 @@ type Orderer struct {
 // - signer:	the signer for signature
 func (o *Orderer) InitConsensus(consType common.ConsensusType, id int, nodeNum int,
 	path string, sendChan chan message.ServerMsg, signer interface{}) {
+	if err := o.initConsensus(consType, Options{ID: id, NodeNum: nodeNum, Path: path, SendChan: sendChan, Signer: signer}); err != nil {
+		panic(err.Error())
+	}
+}
+
+// initConsensus: init consensus by the protocol registered for the consensus type, see InitConsensus
+// params:
+// - consType: the consensus protocol type
+// - opts:     the identity, number of nodes, storage path, send channel, signer and state machine of the consensus,
+// the other options are set by the orderer
+// return:
+// - error if the consensus type is unknown, the window is above the max window of the protocol or the signer type does not match,
+// and the orderer is not changed
+func (o *Orderer) initConsensus(consType common.ConsensusType, opts Options) error {
+
+	p, err := LookupProtocol(consType)
+	if err != nil {
+		return errors.New("Consensus type is unknown type!")
+	}
+	// the elector is created for each consensus, its certified history is dropped as the node crashes
+	elector, err := common.NewLeaderElector(o.Election)
+	if err != nil {
+		return errors.New("Leader election policy is unknown!")
+	}
+	o.pmLock.Lock()
+	pm := o.Pacemaker
+	o.pmLock.Unlock()
+	if err := CheckWindow(consType, o.Window); err != nil {
+		return err
+	}
+	opts.Pacemaker, opts.Elector, opts.Window = pm, elector, o.Window
+	consensus, err := p.New(opts)
+	if err != nil {
+		return errors.New("Signer type does not match!")
+	}
 
 	// update order
 	o.ConsType = consType
-	o.SendChan = sendChan
+	o.msgType.Store(consType)
+	o.SendChan = opts.SendChan
 	o.ReqFlagChan = make(chan bool, 1)
 	o.HandleState = true
 	o.ReqState = true
-	switch consType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		tssSigner, ok := signer.(*tss.Signer)
-		if !ok {
-			panic("Signer type does not match!")
-		}
-		o.BasicHotstuff = core.NewBCHotstuff(5000, id, nodeNum, path, sendChan, tssSigner)
-
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		tssSigner, ok := signer.(*tss.Signer)
-		if !ok {
-			panic("Signer type does not match!")
-		}
-		o.ChainedHotstuff = core.NewChainedHotstuff(2000, id, nodeNum, path, sendChan, tssSigner)
-
-	case common.HOTSTUFF_2_PROTOCOL:
-		tssSigner, ok := signer.(*tss.Signer)
-		if !ok {
-			panic("Signer type does not match!")
-		}
-		o.Hotstuff2 = h2core.NewHotstuff2(500, 2000, id, nodeNum, path, sendChan, tssSigner)
-
-	case common.PBFT:
-		sm2Signer, ok := signer.(*ssm2.Signer)
-		if !ok {
-			panic("Signer type does not match!")
-		}
-		o.PBFTConsensus = pcore.NewPBFT(10000, id, nodeNum, path, sendChan, sm2Signer)
-	default:
-		panic("Consensus type is unknown type!")
+	o.Consensus = consensus
+
+	// the rebuilt consensus keeps checking the client requests and encoding by the codec
+	if o.ReqValidator != nil {
+		o.SetReqValidator(o.ReqValidator)
 	}
+	o.SetCodec(o.Codec)
 
 	// if the orderer is leader, update its state to handle req
 	if o.IsLeader() {
 		o.InitLeader()
 	}
+	return nil
+}
+
+// SetReqValidator: set the validator of client requests to the consensus, the replicas check the proposed block by it,
+// and the requests of committed blocks are recorded in it by the state machine
+// note: it must be set before the blocks are replayed to rebuild the deduplication window
+func (o *Orderer) SetReqValidator(v *bcrequest.Validator) {
+	o.ReqValidator = v
+	o.Consensus.SetReqValidator(v)
+}
+
+// SetCodec: set the codec of the consensus messages sent to the replicas,
+// the recieved messages are decoded by either codec, so the replicas with different codecs work together
+func (o *Orderer) SetCodec(codec wire.Codec) {
+	o.Codec = codec
+	o.Consensus.SetCodec(codec)
+}
+
+// SetSigner: replace the signer of the consensus, such as the threshold signer updated after the nodes join or exit
+// params:
+// - signer: the signer whose type is decided by the protocol
+// return:
+// - error if the signer type does not match
+func (o *Orderer) SetSigner(signer interface{}) error {
+	return o.Consensus.SetSigner(signer)
+}
+
+// SetBaseTimeout: retune the base view timeout of the running consensus and the consensus rebuilt later,
+// such as by a committed reconfiguration, the pacemaker of consensus is read by its timers concurrently
+// params:
+// - timeout: the base timeout without backoff
+func (o *Orderer) SetBaseTimeout(timeout time.Duration) {
+	o.pmLock.Lock()
+	defer o.pmLock.Unlock()
+	o.Pacemaker.BaseTimeout = timeout
+	o.Consensus.Pacemaker().SetBaseTimeout(timeout)
 }
 
 // InitLeader: protocols need to initialize the leader
 func (o *Orderer) InitLeader() {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.InitLeader()
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.InitLeader()
-	case common.HOTSTUFF_2_PROTOCOL:
-		o.Hotstuff2.InitLeader()
-	case common.PBFT:
-		o.PBFTConsensus.InitLeader()
-	default:
-		return
-	}
+	o.Consensus.InitLeader()
 }
 
 // FixLeader: when the threshold f of a newly added node needs to be updated,
 // additional patching of the leader state is required
 func (o *Orderer) FixLeader() {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.FixLeader()
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.FixLeader()
-	case common.HOTSTUFF_2_PROTOCOL:
-	case common.PBFT:
-	default:
-		return
-	}
+	o.Consensus.FixLeader()
 }
 
 // Stop: stop the leader, update the orderer HandleState and ReqState to false, stop timer
 func (o *Orderer) Stop() {
 	o.HandleState = false
 	o.ReqState = false
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.ViewTimer.Stop()
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.ViewTimer.Stop()
-	case common.HOTSTUFF_2_PROTOCOL:
-		o.Hotstuff2.PM.EnterTimer.Stop()
-		o.Hotstuff2.PM.ViewTimer.Stop()
-	case common.PBFT:
-		o.PBFTConsensus.PTimer.Timer.Stop()
-	}
+	o.Consensus.Stop()
 }
 
 // ResetState: clear the current messages, update the orderer HandleState and ReqState to true
@@ -136,95 +159,168 @@ func (o *Orderer) ResetState() {
 
 // RestartCons: restart the consensus
 func (o *Orderer) RestartCons() {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		msgReturn := o.BasicHotstuff.RestartBasicHotstuff()
-		if msgReturn != nil {
-			o.SendMsg(msgReturn)
-		}
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		msgReturn := o.ChainedHotstuff.RestartChainedHotstuff()
-		if msgReturn != nil {
-			o.SendMsg(msgReturn)
-		}
-	case common.HOTSTUFF_2_PROTOCOL:
-		// ignore to check QC in the first round after join or exit
-		o.Hotstuff2.IgnoreCheckQC = true
-		msgReturn := o.Hotstuff2.RestartHotstuff2()
-		if msgReturn != nil {
-			o.SendMsg(msgReturn)
-		}
+	o.Consensus.Restart()
+}
+
+// Recover: restart the consensus from the local block store instead of height 0 and view 0
+// return:
+// - true if there is local data to recover from, and error
+func (o *Orderer) Recover() (bool, error) {
+	ok, err := o.Consensus.Recover()
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	// the leader election depends on the chain of the certified blocks, so the latest committed ones are observed again
+	// and the leader of the recovered view is elected by them
+	if err := replayElection(o.Consensus.Options().Elector, o.GetBlockStore().GetStorage()); err != nil {
+		return false, err
 	}
+	o.RefreshLeader()
+	return true, nil
+}
+
+// Rejoin: the recovered consensus sends the messages to rejoin the running cluster
+func (o *Orderer) Rejoin() {
+	o.Consensus.Rejoin()
+}
+
+// Handover: the consensus switched to starts on the tip committed by the old one, see Switch
+func (o *Orderer) Handover() {
+	o.Consensus.Handover()
+}
+
+// Reset: rebuild the consensus core with the same identity, signer and storage path,
+// all the state in memory is dropped as the node crashes, and the request channel is kept
+func (o *Orderer) Reset() {
+	if o.Consensus == nil {
+		return
+	}
+	opts := o.Consensus.Options()
+
+	// the new state machine replays the blocks from height 0, so does the window of client requests
+	if o.ReqValidator != nil {
+		o.ReqValidator.Reset()
+	}
+	reqFlagChan := o.ReqFlagChan
+	o.InitConsensus(o.ConsType, opts.ID, opts.NodeNum, "", o.SendChan, opts.Signer)
+	o.ReqFlagChan = reqFlagChan
+	o.GetBlockStore().Path = opts.Path
+}
+
+// Halt: stop committing after the current block, the later committed blocks are neither stored nor executed,
+// so all replicas which halt at the same committed block keep the same tip, such as the consensus is switched at it
+// note: it is called as the block is committed, and the orderer stops handling the messages
+func (o *Orderer) Halt() {
+	o.HandleState = false
+	o.GetBlockStore().Halt()
+}
+
+// Switch: rebuild the consensus core by another protocol with the same identity, number of nodes and storage path,
+// the new consensus recovers from the tip and the view of the local block store and starts on it, see Recover and Handover,
+// and the consensus state persisted by the old protocol is removed, since the new one can't decode it
+// note: the consensus must be stopped and the storage closed before, and the request channel is kept
+// params:
+// - consType: the consensus protocol type switched to
+// - signer:   the signer of the protocol
+// return:
+// - error if the consensus type is unknown or the signer type does not match, and the old consensus is kept
+func (o *Orderer) Switch(consType common.ConsensusType, signer interface{}) error {
+	if o.Consensus == nil {
+		return errors.New("consensus is not initialized")
+	}
+	return o.Reconfigure(consType, o.Consensus.Options().NodeNum, signer)
+}
+
+// Reconfigure: rebuild the consensus core by the protocol with the number of nodes, such as the nodes of the epoch
+// started by the committed join or exit, the new consensus starts on the tip of the local block store as Switch
+// note: the consensus must be stopped and the storage closed before, and the request channel is kept
+// params:
+// - consType: the consensus protocol type
+// - nodeNum:  the number of nodes
+// - signer:   the signer of the protocol which fits the number of nodes
+// return:
+// - error if the consensus type is unknown or the signer type does not match, and the old consensus is kept
+func (o *Orderer) Reconfigure(consType common.ConsensusType, nodeNum int, signer interface{}) error {
+	if o.Consensus == nil {
+		return errors.New("consensus is not initialized")
+	}
+	opts := o.Consensus.Options()
+	reqFlagChan := o.ReqFlagChan
+	if err := o.initConsensus(consType, Options{ID: opts.ID, NodeNum: nodeNum, SendChan: o.SendChan, Signer: signer}); err != nil {
+		return err
+	}
+	o.ReqFlagChan = reqFlagChan
+
+	// the new state machine replays the blocks from height 0, so does the window of client requests
+	if o.ReqValidator != nil {
+		o.ReqValidator.Reset()
+	}
+	bs := o.GetBlockStore()
+	bs.Path = opts.Path
+	return bs.RemoveState()
+}
+
+// NextEpoch: continue the halted consensus of the running protocol with the nodes of the next epoch, such as the ones started
+// by the committed join or exit, the consensus core of the epoch takes over the block storage and the state machine of the running one,
+// so the storage is kept open and the blocks are not replayed again, only the blocks stored but not executed yet are applied by Recover,
+// and the state of the last epoch, such as the QCs and the blocks proposed after the tip, is dropped since it is certified by the old nodes
+// note: the consensus starts on the tip of the local block store by Recover and Handover as Reconfigure, and the request channel is kept
+// params:
+// - nodeNum: the number of nodes of the epoch
+// - signer:  the signer of the protocol which fits the number of nodes
+// return:
+// - error if the signer type does not match, and the old consensus is kept
+func (o *Orderer) NextEpoch(nodeNum int, signer interface{}) error {
+	if o.Consensus == nil {
+		return errors.New("consensus is not initialized")
+	}
+	o.Consensus.Stop()
+	opts := o.Consensus.Options()
+	storage := o.GetBlockStore().GetStorage()
+	reqFlagChan := o.ReqFlagChan
+	err := o.initConsensus(o.ConsType, Options{ID: opts.ID, NodeNum: nodeNum, SendChan: o.SendChan, Signer: signer, StateMachine: opts.StateMachine})
+	if err != nil {
+		return err
+	}
+	o.ReqFlagChan = reqFlagChan
+
+	bs := o.GetBlockStore()
+	bs.Path = opts.Path
+	bs.SetStorage(storage)
+	return bs.RemoveState()
 }
 
 // AddSyncInfo: add sync information to a message
 func (o *Orderer) AddSyncInfo(msg *mgmt.NodeMgmtMsg) {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.AddSyncInfo(msg)
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.AddSyncInfo(msg)
-	case common.HOTSTUFF_2_PROTOCOL:
-		o.Hotstuff2.AddSyncInfo(msg)
-	case common.PBFT:
-		o.PBFTConsensus.AddSyncInfo(msg)
-	}
+	o.Consensus.AddSyncInfo(msg)
 }
 
 // ClearCurrentRound: clear recieved messages in current round
 func (o *Orderer) ClearCurrentRound() {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.ClearCurrentRound()
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.ClearCurrentRound()
-	}
+	o.Consensus.ClearCurrentRound()
 }
 
 // RefreshLeader: refresh the leader of the view
 func (o *Orderer) RefreshLeader() {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.View.RefreshLeader()
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.View.RefreshLeader()
-	case common.HOTSTUFF_2_PROTOCOL:
-		o.Hotstuff2.View.RefreshLeader()
-	case common.PBFT:
-		o.PBFTConsensus.View.RefreshLeader()
-	}
+	o.Consensus.RefreshLeader()
 }
 
 // IsReady: the orderer is ready to start
 func (o *Orderer) IsReady() bool {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		return o.BasicHotstuff.View.NodesNum == o.BasicHotstuff.ThresholdSigner.SignNum
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		return o.ChainedHotstuff.View.NodesNum == o.ChainedHotstuff.ThresholdSigner.SignNum
-	case common.HOTSTUFF_2_PROTOCOL:
-		return o.Hotstuff2.View.NodesNum == o.Hotstuff2.ThresholdSigner.SignNum
-	case common.PBFT:
-		return true
-	default:
-		return true
-	}
+	return o.Consensus.IsReady()
 }
 
 // UpdateNodesNum: update the node num
 // params:
 // - nodeNum: the node number need to update
 func (o *Orderer) UpdateNodesNum(nodesNum int) {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.UpdateNodesNum(nodesNum)
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.UpdateNodesNum(nodesNum)
-	case common.HOTSTUFF_2_PROTOCOL:
-		o.Hotstuff2.UpdateNodesNum(nodesNum)
-	case common.PBFT:
-		o.PBFTConsensus.UpdateNodesNum(nodesNum)
-	}
+	o.Consensus.UpdateNodesNum(nodesNum)
+}
+
+// PacemakerMetrics: get the decisions of the pacemaker, such as the current view timeout and the observed commit latency
+func (o *Orderer) PacemakerMetrics() common.PacemakerMetrics {
+	return o.Consensus.Pacemaker().Metrics()
 }
 
 // SyncInfo: sync information from the selected sync-message
@@ -232,14 +328,5 @@ func (o *Orderer) UpdateNodesNum(nodesNum int) {
 // - msg: the selected sync-message with sync information
 // - leader: the leader of this view
 func (o *Orderer) SyncInfo(msg *mgmt.NodeMgmtMsg, leader int) {
-	switch o.ConsType {
-	case common.HOTSTUFF_PROTOCOL_BASIC:
-		o.BasicHotstuff.SyncInfo(msg, leader)
-	case common.HOTSTUFF_PROTOCOL_CHAINED:
-		o.ChainedHotstuff.SyncInfo(msg, leader)
-	case common.HOTSTUFF_2_PROTOCOL:
-		o.Hotstuff2.SyncInfo(msg, leader)
-	case common.PBFT:
-		o.PBFTConsensus.SyncInfo(msg, leader)
-	}
+	o.Consensus.SyncInfo(msg, leader)
 }
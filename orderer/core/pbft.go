@@ -0,0 +1,208 @@
+package orderer
+
+import (
+	"bcrequest"
+	"blockchain"
+	"bytes"
+	"common"
+	"encoding/json"
+	"errors"
+	"mgmt"
+	pcore "pbft/core"
+	ptypes "pbft/types"
+	"ssm2"
+	"statemachine"
+	"time"
+	"wire"
+)
+
+const PBFTTimeout = 10000 * time.Millisecond // the default base timeout of view in PBFT
+
+func init() {
+	Register(common.PBFT, Protocol{
+		New:         NewPBFT,
+		NewSigners:  newSM2Signers,
+		NewMsg:      func() interface{} { return &ptypes.PMsg{} },
+		VerifyBlock: verifyPBFTBlock,
+		Classify:    classifyPBFTMsg,
+		MaxWindow:   ptypes.CHECKPOINTNUM,
+	})
+}
+
+// PBFT: the PBFT consensus run by the orderer
+type PBFT struct {
+	*pcore.PBFT
+}
+
+// NewPBFT: create the PBFT consensus
+// params:
+// - opts: the options, whose signer must be *ssm2.Signer
+// return:
+// - the consensus and error
+func NewPBFT(opts Options) (Consensus, error) {
+	signer, ok := opts.Signer.(*ssm2.Signer)
+	if !ok {
+		return nil, errors.New("signer type does not match")
+	}
+	pm := common.NewPacemaker(opts.Pacemaker.WithDefaults(PBFTTimeout))
+	p := pcore.NewPBFT(int(pm.Config.BaseTimeout/time.Millisecond), opts.ID, opts.NodeNum, opts.Path, opts.SendChan, signer)
+	p.PTimer.Timer.Pacemaker = pm
+	p.View.Elector = opts.Elector
+	if opts.StateMachine != nil {
+		p.StateMachine = opts.StateMachine
+	}
+	window, err := common.PipelineWindow(opts.Window, ptypes.CHECKPOINTNUM)
+	if err != nil {
+		return nil, err
+	}
+	p.Window = window
+	return &PBFT{p}, nil
+}
+
+// HandleMsg: handle the PBFT message
+func (p *PBFT) HandleMsg(payload []byte) {
+	p.HandlePMsg(payload)
+}
+
+// FixLeader: nothing to patch, the leader of PBFT doesn't keep the state depending on the threshold
+func (p *PBFT) FixLeader() {}
+
+// RefreshLeader: refresh the leader of the view
+func (p *PBFT) RefreshLeader() {
+	p.View.RefreshLeader()
+}
+
+// Stop: stop the timer
+func (p *PBFT) Stop() {
+	p.PTimer.Timer.Stop()
+}
+
+// Restart: nothing to send, the leader proposes the next requests when it is waked up,
+// and the replicas which miss the proposal catch up by the view change
+func (p *PBFT) Restart() {}
+
+// Handover: nothing to do, the pre-prepare message of PBFT doesn't carry the certificate of the previous block
+func (p *PBFT) Handover() {}
+
+// Rejoin: send the messages of the recovered consensus
+func (p *PBFT) Rejoin() {
+	if msgReturn := p.PBFT.Rejoin(); msgReturn != nil {
+		p.SendSerMsg(msgReturn)
+	}
+}
+
+// ClearCurrentRound: nothing to clear, the message log of PBFT is indexed by the sequence number
+// and cleared by the checkpoint
+func (p *PBFT) ClearCurrentRound() {}
+
+// IsReady: PBFT is always ready, the signature of each node doesn't depend on the number of nodes
+func (p *PBFT) IsReady() bool {
+	return true
+}
+
+// Pacemaker: get the pacemaker of the view timer
+func (p *PBFT) Pacemaker() *common.Pacemaker {
+	return p.PTimer.Timer.Pacemaker
+}
+
+// BlockStore: get the block store
+func (p *PBFT) BlockStore() *blockchain.BlockStore {
+	return &p.BlkStore
+}
+
+// PublicKey: get the json of all nodes' public keys
+func (p *PBFT) PublicKey() []byte {
+	pks, err := json.Marshal(p.Signer.Pks)
+	if err != nil {
+		return nil
+	}
+	return pks
+}
+
+// Options: get the options of the consensus
+func (p *PBFT) Options() Options {
+	return Options{ID: p.ConsId, NodeNum: p.View.NodesNum, Path: p.BlkStore.Path, SendChan: p.SendChan, Signer: p.Signer, Pacemaker: p.PTimer.Timer.Pacemaker.Config, Elector: p.View.Elector, Window: p.Window, StateMachine: p.StateMachine}
+}
+
+// SetReqValidator: set the validator of client requests
+func (p *PBFT) SetReqValidator(v *bcrequest.Validator) {
+	p.ReqValidator = v
+	p.StateMachine = statemachine.WithValidator(p.StateMachine, v, p.BlockStore())
+}
+
+// SetCodec: set the codec of the sent messages
+func (p *PBFT) SetCodec(codec wire.Codec) {
+	p.Codec = codec
+}
+
+// SetSigner: replace the sm2 signer
+func (p *PBFT) SetSigner(signer interface{}) error {
+	s, ok := signer.(*ssm2.Signer)
+	if !ok {
+		return errors.New("signer type does not match")
+	}
+	p.Signer = s
+	return nil
+}
+
+// newSM2Signers: generate the sm2 signers, each of which knows the public keys of all nodes
+func newSM2Signers(nodeNum int) []interface{} {
+	signers := make([]interface{}, 0, nodeNum)
+	for _, s := range ssm2.NewSigners(nodeNum) {
+		signers = append(signers, s)
+	}
+	return signers
+}
+
+// verifyPBFTBlock: verify the validation of block which is the json of commit messages,
+// and 2f+1 of them should sign the commit of the validation message, whose digest is the block hash
+func verifyPBFTBlock(blkHdr *blockchain.BlockHeader, pk []byte) error {
+	signer := ssm2.Signer{}
+	if err := json.Unmarshal(pk, &signer.Pks); err != nil {
+		return err
+	}
+	if len(blkHdr.ValidationMsg) == 0 {
+		return errors.New("the block has no validation message")
+	}
+	commit, err := ptypes.DecodeCommitByte(blkHdr.ValidationMsg)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(commit.Digest, blkHdr.Hash()) {
+		return errors.New("the validation does not certify the block")
+	}
+	var commitMsgs []*ptypes.PMsg
+	if err := json.Unmarshal(blkHdr.Validation, &commitMsgs); err != nil {
+		return err
+	}
+	signed := make(map[string]bool)
+	for _, m := range commitMsgs {
+		if m == nil || m.MType != ptypes.COMMIT || m.ViewNumber != commit.ViewNumber || m.SeqNum != commit.SeqNum || !bytes.Equal(m.Digest, commit.Digest) {
+			continue
+		}
+		if signer.VerifySign(m.SendNode, m.Signature, m.Message2Byte(1)) {
+			signed[m.SendNode] = true
+		}
+	}
+	if len(signed) <= (len(signer.Pks)-1)/3*2 {
+		return errors.New("not enough commit signatures")
+	}
+	return nil
+}
+
+// classifyPBFTMsg: classify the message of PBFT, the prepare and the commit are the votes for the pre-prepare of the primary
+func classifyPBFTMsg(msg interface{}) mgmt.Participation {
+	m, ok := msg.(*ptypes.PMsg)
+	if !ok {
+		return mgmt.PART_NONE
+	}
+	switch m.MType {
+	case ptypes.PREPREPARE:
+		return mgmt.PART_PROPOSAL
+	case ptypes.PREPARE, ptypes.COMMIT:
+		return mgmt.PART_VOTE
+	case ptypes.VIEW_CHANGE:
+		return mgmt.PART_TIMEOUT
+	}
+	return mgmt.PART_NONE
+}
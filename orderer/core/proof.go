@@ -0,0 +1,61 @@
+package orderer
+
+import (
+	"blockchain"
+	"errors"
+)
+
+// GetBlockStore: get the block store of the consensus core
+func (o *Orderer) GetBlockStore() *blockchain.BlockStore {
+	if o.Consensus == nil {
+		return nil
+	}
+	return o.Consensus.BlockStore()
+}
+
+// PublicKey: get the public key to verify the validation of blocks
+// the threshold protocols return the shared public key, PBFT returns the json of all nodes' public keys
+func (o *Orderer) PublicKey() []byte {
+	if o.Consensus == nil {
+		return nil
+	}
+	return o.Consensus.PublicKey()
+}
+
+// GenBlockProof: generate the proof of the request in the local committed block
+// params:
+// - height: the height of block
+// - index:  the index of the request in the block
+// return:
+// - the block proof and error
+func (o *Orderer) GenBlockProof(height int, index int) (*blockchain.BlockProof, error) {
+	bs := o.GetBlockStore()
+	if bs == nil {
+		return nil, errors.New("consensus type is unknown type")
+	}
+	proof, err := bs.GenBlockProof(height, index)
+	if err != nil {
+		return nil, err
+	}
+	proof.ConsType = o.ConsType
+	return proof, nil
+}
+
+// VerifyBlockProof: verify the proof of the request, that is, the request is included by the root hash of block
+// and the block is validated by the consensus
+// params:
+// - bp: the block proof
+// - pk: the public key given to the verifier out of band, see PublicKey
+// return:
+// - nil if the proof is valid, or the error
+func VerifyBlockProof(bp *blockchain.BlockProof, pk []byte) error {
+	if err := bp.VerifyInclusion(); err != nil {
+		return err
+	}
+
+	p, err := LookupProtocol(bp.ConsType)
+	if err != nil {
+		return err
+	}
+	return p.VerifyBlock(&bp.BlkHdr, pk)
+}
@@ -0,0 +1,160 @@
+package orderer_test
+
+import (
+	"common"
+	"local"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// simulation: the orderers of a cluster connected by the simulated network, all of them run in the events of
+// the virtual clock one by one, so a run is reproduced by the seed
+type simulation struct {
+	*cluster
+	net *local.SimNetwork
+}
+
+// newSimulation: create the orderers whose timers are measured by the virtual clock of the simulated network
+// params:
+// - seed: the seed of the simulated network
+// - link: the model of all links
+// - pacemaker: the timeouts of the views, which are measured by the virtual clock
+func newSimulation(t *testing.T, consType common.ConsensusType, nodeNum int, seed int64, link local.LinkConfig, pacemaker common.PacemakerConfig) *simulation {
+	s := &simulation{}
+	names := make([]string, nodeNum)
+	for i := range names {
+		names[i] = "r_" + strconv.Itoa(i)
+	}
+	s.net = local.NewSimNetwork(seed, names, func(reciName string, msg []byte) {
+		id, _ := strconv.Atoi(reciName[len("r_"):])
+		s.orderers[id].HandleMsg(msg)
+	})
+	s.net.SetDefaultLink(link)
+	pacemaker.Clock = s.net.Clock
+	s.cluster = newCluster(t, consType, nodeNum, withPacemaker(pacemaker))
+
+	// the proposers check whether they are waiting for the requests in every interval, as the servers do
+	var tick func()
+	tick = func() {
+		s.propose()
+		s.net.Clock.AfterFunc(s.interval, tick)
+	}
+	s.net.Clock.AfterFunc(0, tick)
+	return s
+}
+
+// route: send the messages of the orderers to the simulated network in order of the nodes,
+// the replies to the clients are dropped
+func (s *simulation) route() {
+	for _, sendChan := range s.sendChans {
+		for len(sendChan) > 0 {
+			msg := <-sendChan
+			switch msg.ReciServer {
+			case "Broadcast":
+				s.net.Broadcast(msg.Payload, msg.SendServer)
+			case "Gossip":
+				s.net.Gossip(msg.Payload, msg.SendServer)
+			default:
+				s.net.Unicast(msg.Payload, msg.ReciServer, msg.SendServer)
+			}
+		}
+	}
+}
+
+// runFor: run the events of the duration of virtual time
+func (s *simulation) runFor(d time.Duration) {
+	s.net.Clock.RunUntil(s.net.Clock.Now()+d, s.route)
+}
+
+// runUntil: run the events in steps until the condition holds or the duration of virtual time passes
+// return:
+// - whether the condition holds
+func (s *simulation) runUntil(cond func() bool, d time.Duration) bool {
+	deadline := s.net.Clock.Now() + d
+	for !cond() {
+		if s.net.Clock.Now() >= deadline {
+			return false
+		}
+		s.runFor(100 * time.Millisecond)
+	}
+	return true
+}
+
+// commits: get the number of blocks committed by each node
+func (s *simulation) commits() []uint64 {
+	commits := make([]uint64, len(s.orderers))
+	for i, o := range s.orderers {
+		commits[i] = o.PacemakerMetrics().Commits
+	}
+	return commits
+}
+
+// progressed: count the nodes which commit at least the blocks more than before
+func progressed(before []uint64, after []uint64, blocks uint64) int {
+	n := 0
+	for i := range after {
+		if after[i] >= before[i]+blocks {
+			n++
+		}
+	}
+	return n
+}
+
+// TestPartition: test 2f+1 nodes commit again after the partition which leaves no quorum is healed,
+// the replica which falls behind during the partition is not required to catch up, and the run is reproduced by the seed
+func TestPartition(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the partition scenarios take the view timeouts")
+	}
+	const (
+		nodeNum   = 4
+		quorum    = (nodeNum-1)/3*2 + 1
+		blocks    = 3
+		seed      = 20240601
+		partition = 10 * time.Second
+	)
+	// the servers talk over TCP, so the messages on a link arrive in order with the jitter
+	link := local.LinkConfig{
+		Latency:   local.NormalLatency{Mean: 20 * time.Millisecond, StdDev: 5 * time.Millisecond},
+		Bandwidth: 10 << 20,
+		Ordered:   true,
+	}
+	pacemaker := common.PacemakerConfig{BaseTimeout: time.Second, MaxTimeout: 4 * time.Second}
+	for _, consType := range []common.ConsensusType{common.HOTSTUFF_PROTOCOL_BASIC, common.HOTSTUFF_2_PROTOCOL, common.PBFT} {
+		consType := consType
+		t.Run(string(consType), func(t *testing.T) {
+			run := func() ([]uint64, local.SimStats) {
+				s := newSimulation(t, consType, nodeNum, seed, link, pacemaker)
+				start := make([]uint64, nodeNum)
+				if !s.runUntil(func() bool { return progressed(start, s.commits(), blocks) == nodeNum }, 10*time.Second) {
+					t.Fatal("the nodes commit no block before the partition", s.commits())
+				}
+
+				// neither half has a quorum, so no block is committed until the partition is healed
+				s.net.Partition(s.net.Clock.Now(), partition, []string{"r_0", "r_1"}, []string{"r_2", "r_3"})
+				s.runFor(partition)
+				healed := s.commits()
+
+				if !s.runUntil(func() bool { return progressed(healed, s.commits(), blocks) >= quorum }, time.Minute) {
+					t.Fatal("the nodes commit no block after the partition is healed, healed:", healed, "after:", s.commits())
+				}
+				s.stop()
+				s.checkSafety(t)
+				return s.commits(), s.net.Stats()
+			}
+
+			commits, stats := run()
+			replayed, replayedStats := run()
+			if stats != replayedStats {
+				t.Fatalf("the network is not reproduced by the seed, %+v and %+v", stats, replayedStats)
+			}
+			for i := range commits {
+				if commits[i] != replayed[i] {
+					t.Fatal("the commits are not reproduced by the seed", commits, replayed)
+				}
+			}
+			t.Log("the nodes commit", commits, "blocks, the network", stats)
+		})
+	}
+}
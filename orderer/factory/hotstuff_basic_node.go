@@ -104,7 +104,7 @@ func (n *Node) HandleConsMsg(msg hstypes.Msg) {
 	}
 
 	// submit the message to basic hotstuff and get its return messages
-	msgReturn := n.BasicHotstuff.RouteBMsg(&msg, nil)
+	msgReturn := n.BasicHotstuff.RouteBMsg(&msg)
 	if msgReturn != nil {
 		msgReturn.SendNode = n.NodeID.ID.Name
 		n.BasicHotstuff.CurRoundMsg = append(n.BasicHotstuff.CurRoundMsg, msgReturn)
@@ -117,7 +117,7 @@ func (n *Node) InitConsensus(consType common.ConsensusType, path string, id int)
 func (n *Node) InitNodeManager(nmType mgmt.NodeManagerType, id int, nodesTable map[string]mgmt.NodeKey) {
 
 	switch nmType {
-	case mgmt.BASIC:
+	case mgmt.BASIC, mgmt.BFT_SMART, mgmt.BASED_HISTORY:
 		n.NodeManager = *bcmanager.NewNodeManager(id, nodesTable, map[string]chan []byte{})
 	default:
 		fmt.Println("NodeManager type is unknown type!")